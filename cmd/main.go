@@ -1,7 +1,17 @@
 package main
 
 import (
+	"fmt"
 	"log"
+	"os"
+	"wdiet/lockout"
+	"wdiet/mailer"
+	"wdiet/mailer/file"
+	"wdiet/mailer/smtp"
+	"wdiet/notifier"
+	"wdiet/notifier/email"
+	"wdiet/notifier/logsink"
+	"wdiet/notifier/webhook"
 	"wdiet/service"
 	"wdiet/store/postgres"
 
@@ -28,7 +38,58 @@ func main() {
 		//e.g. zap.String() takes in two values, one is gonna be a key, the other a value.
 	}
 
-	svc := service.New(pg, l)
+	cfg, err := service.ConfigFromEnvironment()
+	if err != nil {
+		l.Fatal("cannot load the service config", zap.Error(err))
+	}
+
+	cfg.Mailer, err = newMailer()
+	if err != nil {
+		l.Fatal("cannot set up the mailer", zap.Error(err))
+	}
+
+	cfg.DigestChannels = newDigestChannels(cfg.Mailer, l)
+
+	switch backend := os.Getenv("WDIET_LOCKOUT_BACKEND"); backend { //memory is fine for one instance, several have to share the counts
+	case "", "memory":
+		cfg.Lockout = lockout.New(lockout.NewMemory(), lockout.DefaultAccountPolicy, lockout.DefaultIPPolicy)
+	case "postgres":
+		cfg.Lockout = lockout.New(pg.LockoutBackend(), lockout.DefaultAccountPolicy, lockout.DefaultIPPolicy)
+	default:
+		l.Fatal("unknown WDIET_LOCKOUT_BACKEND, use memory or postgres", zap.String("backend", backend))
+	}
+
+	svc := service.New(pg, l, cfg)
 
 	svc.Run()
 }
+
+// newMailer picks the mailer from WDIET_MAILER. "file" drops mails into WDIET_MAILER_DIR instead of sending them, for running locally.
+func newMailer() (mailer.Mailer, error) {
+	switch kind := os.Getenv("WDIET_MAILER"); kind {
+	case "smtp":
+		return smtp.New()
+	case "file":
+		dir, exists := os.LookupEnv("WDIET_MAILER_DIR")
+		if !exists {
+			return nil, fmt.Errorf("error getting WDIET_MAILER_DIR from environment")
+		}
+		return file.New(dir)
+	default:
+		return nil, fmt.Errorf("unknown WDIET_MAILER %q, use smtp or file", kind)
+	}
+}
+
+// newDigestChannels is how digests can go out: by email with the mailer, and to webhooks signed with
+// WDIET_WEBHOOK_SECRET if it's set. WDIET_DIGEST_LOG=true only logs them, every channel name included, for running locally.
+func newDigestChannels(m mailer.Mailer, l *zap.Logger) map[string]notifier.Channel {
+	if os.Getenv("WDIET_DIGEST_LOG") == "true" {
+		sink := logsink.New(l)
+		return map[string]notifier.Channel{"email": sink, "webhook": sink}
+	}
+
+	return map[string]notifier.Channel{
+		"email":   email.New(m),
+		"webhook": webhook.New([]byte(os.Getenv("WDIET_WEBHOOK_SECRET"))),
+	}
+}
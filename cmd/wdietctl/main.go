@@ -0,0 +1,107 @@
+// wdietctl does the things nobody can do through the API, like making the first admin.
+// It talks to the same database as the service, configured with the same WDIET_DB_* variables.
+//
+//	wdietctl set-role -email jywoo92324@gmail.com -role admin
+//	wdietctl rebuild-fridge -dry-run
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"wdiet/store"
+	"wdiet/store/postgres"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	var err error
+
+	switch os.Args[1] {
+	case "set-role":
+		err = setRole(os.Args[2:])
+	case "rebuild-fridge":
+		err = rebuildFridge(os.Args[2:])
+	default:
+		usage()
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: wdietctl set-role -email <email address> -role <user|moderator|admin>")
+	fmt.Fprintln(os.Stderr, "       wdietctl rebuild-fridge [-dry-run]")
+}
+
+// setRole gives the user with the email address a role. Once there's an admin, the rest can go through POST /admin/users/:id/role.
+func setRole(args []string) error {
+	fs := flag.NewFlagSet("set-role", flag.ExitOnError)
+	email := fs.String("email", "", "email address of the user")
+	role := fs.String("role", store.RoleAdmin, "user, moderator or admin")
+	fs.Parse(args)
+
+	if *email == "" || !store.IsValidRole(*role) {
+		usage()
+		os.Exit(2)
+	}
+
+	pg, err := postgres.New()
+	if err != nil {
+		return fmt.Errorf("error connecting to the database: %w", err)
+	}
+
+	user, err := pg.GetUserByEmail(context.Background(), *email)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return fmt.Errorf("no user with the email address %s", *email)
+		}
+		return err
+	}
+
+	user, err = pg.SetUserRole(context.Background(), user.UserUUID, *role)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%s (%s) is now %s\n", user.EmailAddress, user.UserUUID, user.Role)
+
+	return nil
+}
+
+// rebuildFridge makes every fridge again out of the ledger, see PG.RebuildFridgeIngredients. With -dry-run it only says
+// how many lots would change, so it's also how to check the fridges are in step with the ledger.
+func rebuildFridge(args []string) error {
+	fs := flag.NewFlagSet("rebuild-fridge", flag.ExitOnError)
+	dryRun := fs.Bool("dry-run", false, "only say what would change")
+	fs.Parse(args)
+
+	pg, err := postgres.New()
+	if err != nil {
+		return fmt.Errorf("error connecting to the database: %w", err)
+	}
+
+	rebuild, err := pg.RebuildFridgeIngredients(context.Background(), *dryRun)
+	if err != nil {
+		return err
+	}
+
+	if *dryRun {
+		fmt.Printf("replayed %d events into %d lots, %d would change\n", rebuild.Events, rebuild.Lots, rebuild.Changed)
+		return nil
+	}
+
+	fmt.Printf("replayed %d events into %d lots, %d changed\n", rebuild.Events, rebuild.Lots, rebuild.Changed)
+
+	return nil
+}
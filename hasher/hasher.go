@@ -0,0 +1,28 @@
+package hasher
+
+import (
+	"errors"
+	"strings"
+)
+
+var ErrUnknownHash = errors.New("unknown password hash format")
+
+// PasswordHasher hashes passwords for storing. Hashes carry their own parameters, so Verify works on any hash this
+// package ever made, and NeedsRehash tells when a hash was made with something other than what we'd use today.
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	Verify(hash, password string) (bool, error)
+	NeedsRehash(hash string) bool
+}
+
+// verify checks password against hash, whatever algorithm made it.
+func verify(hash, password string) (bool, error) {
+	switch {
+	case strings.HasPrefix(hash, argon2idPrefix):
+		return verifyArgon2id(hash, password)
+	case isBcrypt(hash):
+		return verifyBcrypt(hash, password)
+	default:
+		return false, ErrUnknownHash
+	}
+}
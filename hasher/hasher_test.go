@@ -0,0 +1,85 @@
+package hasher
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var testArgon2id = Argon2id{Memory: 1024, Time: 1, Threads: 1, SaltLen: 16, KeyLen: 32} //cheap, tests don't need to be slow
+
+func TestHashAndVerify(t *testing.T) {
+	testcases := []struct {
+		name   string
+		hasher PasswordHasher
+	}{
+		{"bcrypt", Bcrypt{Cost: bcrypt.MinCost}},
+		{"argon2id", testArgon2id},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			hash, err := testcase.hasher.Hash("correct horse battery staple")
+			assert.NoError(t, err)
+
+			ok, err := testcase.hasher.Verify(hash, "correct horse battery staple")
+			assert.NoError(t, err)
+			assert.True(t, ok)
+
+			ok, err = testcase.hasher.Verify(hash, "correct horse battery stable")
+			assert.NoError(t, err)
+			assert.False(t, ok)
+
+			assert.False(t, testcase.hasher.NeedsRehash(hash))
+		})
+	}
+}
+
+func TestVerifyAcrossAlgorithms(t *testing.T) {
+	bcryptHash, err := Bcrypt{Cost: bcrypt.MinCost}.Hash("hello")
+	assert.NoError(t, err)
+
+	argonHash, err := testArgon2id.Hash("hello")
+	assert.NoError(t, err)
+
+	ok, err := testArgon2id.Verify(bcryptHash, "hello") //users hashed before the switch still get in
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	ok, err = Bcrypt{Cost: bcrypt.MinCost}.Verify(argonHash, "hello")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	_, err = testArgon2id.Verify("5994471abb01112afcc18159f6cc74b4f511b99806da59b3caf5a9c173cacfc5", "hello")
+	assert.ErrorIs(t, err, ErrUnknownHash)
+}
+
+func TestNeedsRehash(t *testing.T) {
+	minCost, err := Bcrypt{Cost: bcrypt.MinCost}.Hash("hello")
+	assert.NoError(t, err)
+
+	argonHash, err := testArgon2id.Hash("hello")
+	assert.NoError(t, err)
+
+	testcases := []struct {
+		name     string
+		hasher   PasswordHasher
+		hash     string
+		expected bool
+	}{
+		{"bcrypt:sameCost", Bcrypt{Cost: bcrypt.MinCost}, minCost, false},
+		{"bcrypt:higherCost", Bcrypt{Cost: bcrypt.MinCost + 1}, minCost, true},
+		{"bcrypt:fromArgon2id", Bcrypt{Cost: bcrypt.MinCost}, argonHash, true},
+		{"argon2id:fromBcrypt", testArgon2id, minCost, true},
+		{"argon2id:moreMemory", Argon2id{Memory: 2048, Time: 1, Threads: 1, SaltLen: 16, KeyLen: 32}, argonHash, true},
+		{"argon2id:longerKey", Argon2id{Memory: 1024, Time: 1, Threads: 1, SaltLen: 16, KeyLen: 64}, argonHash, true},
+		{"argon2id:garbage", testArgon2id, "$argon2id$v=19$potatoes", true},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			assert.Equal(t, testcase.expected, testcase.hasher.NeedsRehash(testcase.hash))
+		})
+	}
+}
@@ -0,0 +1,153 @@
+package lockout
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Attempts is what a backend remembers about one key, an account or an IP.
+type Attempts struct {
+	Failures    int
+	LastFailure time.Time
+}
+
+// Backend stores failed attempts. Memory is enough for a single instance, with several instances they have to share
+// one, e.g. the postgres one, or an attacker just spreads their guesses over the instances.
+type Backend interface {
+	Get(ctx context.Context, key string) (Attempts, error)
+	// AddFailure counts a failure at now, atomically. If the last failure is older than window the count starts over.
+	AddFailure(ctx context.Context, key string, now time.Time, window time.Duration) (Attempts, error)
+	Reset(ctx context.Context, key string) error
+}
+
+// Policy says how long to wait after so many failures. The first FreeAttempts failures cost nothing, every failure after
+// that doubles the wait starting from BaseDelay up to MaxDelay, and from LockoutAfter failures on the key is locked for LockoutFor.
+type Policy struct {
+	FreeAttempts int
+	BaseDelay    time.Duration
+	MaxDelay     time.Duration
+	LockoutAfter int
+	LockoutFor   time.Duration
+	Window       time.Duration //failures older than this are forgotten. keep it at least LockoutFor or lockouts end early
+}
+
+var (
+	DefaultAccountPolicy = Policy{FreeAttempts: 3, BaseDelay: time.Second, MaxDelay: 5 * time.Minute, LockoutAfter: 10, LockoutFor: 15 * time.Minute, Window: time.Hour}
+	DefaultIPPolicy      = Policy{FreeAttempts: 20, BaseDelay: time.Second, MaxDelay: 5 * time.Minute, LockoutAfter: 100, LockoutFor: time.Hour, Window: time.Hour} //offices and NATs share IPs, be gentler
+)
+
+// BlockedUntil is when the next attempt is allowed after a. Zero time if it's allowed right away.
+func (p Policy) BlockedUntil(a Attempts) time.Time {
+	switch {
+	case a.Failures >= p.LockoutAfter:
+		return a.LastFailure.Add(p.LockoutFor)
+	case a.Failures > p.FreeAttempts:
+		delay := p.BaseDelay
+		for i := p.FreeAttempts + 1; i < a.Failures && delay < p.MaxDelay; i++ {
+			delay *= 2
+		}
+		if delay > p.MaxDelay {
+			delay = p.MaxDelay
+		}
+		return a.LastFailure.Add(delay)
+	default:
+		return time.Time{}
+	}
+}
+
+const (
+	ScopeAccount = "account"
+	ScopeIP      = "ip"
+)
+
+// Event is a key getting locked out, for admins to look at.
+type Event struct {
+	Scope       string //ScopeAccount or ScopeIP
+	Subject     string //the email or the IP
+	Failures    int
+	LockedUntil time.Time
+}
+
+// Tracker tracks failed logins per account and per IP.
+type Tracker struct {
+	backend Backend
+	account Policy
+	ip      Policy
+	now     func() time.Time
+}
+
+func New(b Backend, account, ip Policy) *Tracker {
+	return &Tracker{backend: b, account: account, ip: ip, now: time.Now}
+}
+
+// Check returns how long the caller has to wait before trying email from ip again, 0 if they can try now.
+func (t *Tracker) Check(ctx context.Context, email, ip string) (time.Duration, error) {
+	now := t.now()
+	var wait time.Duration
+
+	for _, k := range t.keys(email, ip) {
+		a, err := t.backend.Get(ctx, k.key)
+		if err != nil {
+			return 0, fmt.Errorf("error checking login attempts: %w", err)
+		}
+
+		if w := k.policy.BlockedUntil(a).Sub(now); w > wait {
+			wait = w
+		}
+	}
+
+	return wait, nil
+}
+
+// Fail records a failed login. It returns an Event for every key this failure locked out.
+func (t *Tracker) Fail(ctx context.Context, email, ip string) ([]Event, error) {
+	now := t.now()
+	var events []Event
+
+	for _, k := range t.keys(email, ip) {
+		a, err := t.backend.AddFailure(ctx, k.key, now, k.policy.Window)
+		if err != nil {
+			return nil, fmt.Errorf("error recording login attempt: %w", err)
+		}
+
+		if a.Failures == k.policy.LockoutAfter { //only the failure that crosses the line, not every one after it
+			events = append(events, Event{Scope: k.scope, Subject: k.subject, Failures: a.Failures, LockedUntil: k.policy.BlockedUntil(a)})
+		}
+	}
+
+	return events, nil
+}
+
+// Succeed forgets the account's failures. The IP's stay, otherwise logging into your own account in between would
+// reset the counter for guessing everybody else's.
+func (t *Tracker) Succeed(ctx context.Context, email string) error {
+	if err := t.backend.Reset(ctx, accountKey(email)); err != nil {
+		return fmt.Errorf("error resetting login attempts: %w", err)
+	}
+
+	return nil
+}
+
+type trackedKey struct {
+	scope   string
+	subject string
+	key     string
+	policy  Policy
+}
+
+func (t *Tracker) keys(email, ip string) []trackedKey {
+	return []trackedKey{
+		{scope: ScopeAccount, subject: normalizeEmail(email), key: accountKey(email), policy: t.account},
+		{scope: ScopeIP, subject: ip, key: ScopeIP + ":" + ip, policy: t.ip},
+	}
+}
+
+func accountKey(email string) string {
+	return ScopeAccount + ":" + normalizeEmail(email)
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
@@ -0,0 +1,102 @@
+package lockout
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testNow = time.Date(2022, 12, 25, 12, 0, 0, 0, time.UTC)
+
+func TestBlockedUntil(t *testing.T) {
+	p := Policy{FreeAttempts: 3, BaseDelay: time.Second, MaxDelay: 10 * time.Second, LockoutAfter: 10, LockoutFor: 15 * time.Minute, Window: time.Hour}
+
+	testcases := []struct {
+		failures int
+		expected time.Time
+	}{
+		{0, time.Time{}},
+		{3, time.Time{}},
+		{4, testNow.Add(1 * time.Second)},
+		{5, testNow.Add(2 * time.Second)},
+		{6, testNow.Add(4 * time.Second)},
+		{7, testNow.Add(8 * time.Second)},
+		{8, testNow.Add(10 * time.Second)}, //capped
+		{9, testNow.Add(10 * time.Second)},
+		{10, testNow.Add(15 * time.Minute)}, //locked out
+		{50, testNow.Add(15 * time.Minute)},
+	}
+
+	for _, testcase := range testcases {
+		assert.Equal(t, testcase.expected, p.BlockedUntil(Attempts{Failures: testcase.failures, LastFailure: testNow}), "failures: %d", testcase.failures)
+	}
+}
+
+func TestTracker(t *testing.T) {
+	now := testNow
+	account := Policy{FreeAttempts: 1, BaseDelay: time.Minute, MaxDelay: time.Hour, LockoutAfter: 3, LockoutFor: time.Hour, Window: time.Hour}
+	ip := Policy{FreeAttempts: 10, BaseDelay: time.Minute, MaxDelay: time.Hour, LockoutAfter: 20, LockoutFor: time.Hour, Window: time.Hour}
+
+	tracker := New(NewMemory(), account, ip)
+	tracker.now = func() time.Time { return now }
+
+	ctx := context.Background()
+
+	wait, err := tracker.Check(ctx, "jywoo92324@gmail.com", "192.0.2.1")
+	assert.NoError(t, err)
+	assert.Zero(t, wait)
+
+	events, err := tracker.Fail(ctx, "jywoo92324@gmail.com", "192.0.2.1") //free
+	assert.NoError(t, err)
+	assert.Empty(t, events)
+
+	wait, err = tracker.Check(ctx, "JYWOO92324@gmail.com ", "192.0.2.1") //same account, however it's spelled
+	assert.NoError(t, err)
+	assert.Zero(t, wait)
+
+	_, err = tracker.Fail(ctx, "jywoo92324@gmail.com", "192.0.2.1")
+	assert.NoError(t, err)
+
+	wait, err = tracker.Check(ctx, "jywoo92324@gmail.com", "192.0.2.1")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Minute, wait)
+
+	wait, err = tracker.Check(ctx, "someoneelse@gmail.com", "192.0.2.2") //other accounts from other IPs don't care
+	assert.NoError(t, err)
+	assert.Zero(t, wait)
+
+	now = now.Add(time.Minute)
+	events, err = tracker.Fail(ctx, "jywoo92324@gmail.com", "192.0.2.1")
+	assert.NoError(t, err)
+	assert.Equal(t, []Event{{Scope: ScopeAccount, Subject: "jywoo92324@gmail.com", Failures: 3, LockedUntil: now.Add(time.Hour)}}, events)
+
+	wait, err = tracker.Check(ctx, "jywoo92324@gmail.com", "192.0.2.2") //locked is locked, whatever the IP
+	assert.NoError(t, err)
+	assert.Equal(t, time.Hour, wait)
+
+	assert.NoError(t, tracker.Succeed(ctx, "jywoo92324@gmail.com"))
+
+	wait, err = tracker.Check(ctx, "jywoo92324@gmail.com", "192.0.2.1")
+	assert.NoError(t, err)
+	assert.Zero(t, wait)
+}
+
+func TestMemoryWindow(t *testing.T) {
+	m := NewMemory()
+	ctx := context.Background()
+
+	a, err := m.AddFailure(ctx, "ip:192.0.2.1", testNow, time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, a.Failures)
+
+	a, err = m.AddFailure(ctx, "ip:192.0.2.1", testNow.Add(59*time.Minute), time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, a.Failures)
+
+	a, err = m.AddFailure(ctx, "ip:192.0.2.1", testNow.Add(2*time.Hour), time.Hour) //forgotten, starts over
+	assert.NoError(t, err)
+	assert.Equal(t, 1, a.Failures)
+	assert.Equal(t, testNow.Add(2*time.Hour), a.LastFailure)
+}
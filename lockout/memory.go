@@ -0,0 +1,70 @@
+package lockout
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+var _ Backend = (*Memory)(nil)
+
+// Memory keeps attempts in process. It's the default, fine as long as there's one instance.
+type Memory struct {
+	mu       sync.Mutex
+	attempts map[string]Attempts
+	window   time.Duration //biggest window seen, for sweeping
+	writes   int
+}
+
+func NewMemory() *Memory {
+	return &Memory{attempts: map[string]Attempts{}}
+}
+
+func (m *Memory) Get(ctx context.Context, key string) (Attempts, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.attempts[key], nil
+}
+
+func (m *Memory) AddFailure(ctx context.Context, key string, now time.Time, window time.Duration) (Attempts, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	a := m.attempts[key]
+	if now.Sub(a.LastFailure) > window {
+		a.Failures = 0
+	}
+
+	a.Failures++
+	a.LastFailure = now
+	m.attempts[key] = a
+
+	if window > m.window {
+		m.window = window
+	}
+
+	m.writes++
+	if m.writes%1024 == 0 { //every now and then drop what nobody will look at again, otherwise an attacker rotating IPs fills the map
+		m.sweep(now)
+	}
+
+	return a, nil
+}
+
+func (m *Memory) Reset(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.attempts, key)
+
+	return nil
+}
+
+func (m *Memory) sweep(now time.Time) {
+	for k, a := range m.attempts {
+		if now.Sub(a.LastFailure) > m.window {
+			delete(m.attempts, k)
+		}
+	}
+}
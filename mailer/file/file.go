@@ -0,0 +1,38 @@
+package file
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+	"wdiet/mailer"
+
+	"github.com/google/uuid"
+)
+
+var _ mailer.Mailer = (*Mailer)(nil)
+
+// Mailer writes every message to its own file in dir instead of sending it. For running locally without an SMTP server.
+type Mailer struct {
+	dir string
+}
+
+func New(dir string) (*Mailer, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("error creating mail directory: %w", err)
+	}
+
+	return &Mailer{dir: dir}, nil
+}
+
+func (m *Mailer) Send(ctx context.Context, msg mailer.Message) error {
+	name := fmt.Sprintf("%s_%s.txt", time.Now().UTC().Format("20060102T150405"), uuid.NewString())
+	content := fmt.Sprintf("To: %s\nSubject: %s\n\n%s\n", msg.To, msg.Subject, msg.Body)
+
+	if err := os.WriteFile(filepath.Join(m.dir, name), []byte(content), 0o600); err != nil {
+		return fmt.Errorf("error writing mail: %w", err)
+	}
+
+	return nil
+}
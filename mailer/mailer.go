@@ -0,0 +1,15 @@
+package mailer
+
+import "context"
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string //plain text
+}
+
+// Mailer sends emails to users. Like store.Store, the service only knows this interface, so tests can swap in
+// memory.Mailer and local runs file.Mailer instead of a real SMTP server.
+type Mailer interface {
+	Send(ctx context.Context, m Message) error
+}
@@ -0,0 +1,38 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"wdiet/mailer"
+)
+
+var _ mailer.Mailer = (*Mailer)(nil)
+
+// Mailer keeps sent messages in memory so tests can look at them.
+type Mailer struct {
+	mu   sync.Mutex
+	sent []mailer.Message
+
+	SendOverride func(ctx context.Context, m mailer.Message) error
+}
+
+func (m *Mailer) Send(ctx context.Context, msg mailer.Message) error {
+	if m.SendOverride != nil {
+		return m.SendOverride(ctx, msg)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.sent = append(m.sent, msg)
+
+	return nil
+}
+
+// Sent returns what has been sent so far, oldest first.
+func (m *Mailer) Sent() []mailer.Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]mailer.Message(nil), m.sent...)
+}
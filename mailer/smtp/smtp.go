@@ -0,0 +1,78 @@
+package smtp
+
+import (
+	"context"
+	"fmt"
+	"net"
+	gosmtp "net/smtp"
+	"os"
+	"strings"
+	"time"
+	"wdiet/mailer"
+)
+
+var _ mailer.Mailer = (*Mailer)(nil)
+
+type Mailer struct {
+	addr string
+	auth gosmtp.Auth
+	from string
+}
+
+func New() (*Mailer, error) {
+	host, exists := os.LookupEnv("WDIET_SMTP_HOST")
+	if !exists {
+		return nil, fmt.Errorf("error getting WDIET_SMTP_HOST from environment")
+	}
+
+	port, exists := os.LookupEnv("WDIET_SMTP_PORT")
+	if !exists {
+		return nil, fmt.Errorf("error getting WDIET_SMTP_PORT from environment")
+	}
+
+	from, exists := os.LookupEnv("WDIET_SMTP_FROM")
+	if !exists {
+		return nil, fmt.Errorf("error getting WDIET_SMTP_FROM from environment")
+	}
+
+	m := &Mailer{addr: net.JoinHostPort(host, port), from: from}
+
+	if user, exists := os.LookupEnv("WDIET_SMTP_USER"); exists { //no user, no auth. fine for a local relay.
+		m.auth = gosmtp.PlainAuth("", user, os.Getenv("WDIET_SMTP_PASS"), host)
+	}
+
+	return m, nil
+}
+
+func (m *Mailer) Send(ctx context.Context, msg mailer.Message) error {
+	errCh := make(chan error, 1)
+
+	go func() { //net/smtp doesn't take a context, so at least don't make the caller wait past its deadline
+		errCh <- gosmtp.SendMail(m.addr, m.auth, m.from, []string{msg.To}, m.format(msg))
+	}()
+
+	select {
+	case err := <-errCh:
+		if err != nil {
+			return fmt.Errorf("error sending mail: %w", err)
+		}
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("error sending mail: %w", ctx.Err())
+	}
+}
+
+func (m *Mailer) format(msg mailer.Message) []byte {
+	var b strings.Builder
+
+	b.WriteString("From: " + m.from + "\r\n")
+	b.WriteString("To: " + msg.To + "\r\n")
+	b.WriteString("Subject: " + msg.Subject + "\r\n")
+	b.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+
+	return []byte(b.String())
+}
@@ -0,0 +1,44 @@
+package email
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"wdiet/mailer"
+	"wdiet/notifier"
+)
+
+var _ notifier.Channel = (*Channel)(nil)
+
+// Channel mails digests with whatever mailer the service sends its other mails with, SMTP in production.
+type Channel struct {
+	m mailer.Mailer
+}
+
+func New(m mailer.Mailer) *Channel {
+	return &Channel{m: m}
+}
+
+func (ch *Channel) Send(ctx context.Context, d notifier.Digest) error {
+	if err := ch.m.Send(ctx, message(d)); err != nil {
+		return fmt.Errorf("error mailing digest: %w", err)
+	}
+	return nil
+}
+
+func message(d notifier.Digest) mailer.Message {
+	subject := "1 thing in your fridge is about to go off"
+	if len(d.Items) != 1 {
+		subject = fmt.Sprintf("%d things in your fridge are about to go off", len(d.Items))
+	}
+
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "Hi %s, here's what to eat first:\n\n", d.FirstName)
+	for _, i := range d.Items {
+		fmt.Fprintf(&b, "- %s, %s %s in the %s, goes off %s\n", i.IngredientName, i.Amount, i.Unit, i.Location, i.ExpirationDate.Format("Mon Jan 2"))
+	}
+	b.WriteString("\nYou can change when you get this mail or turn it off in your digest settings.")
+
+	return mailer.Message{To: d.EmailAddress, Subject: subject, Body: b.String()}
+}
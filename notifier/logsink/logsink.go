@@ -0,0 +1,48 @@
+package logsink
+
+import (
+	"context"
+	"sync"
+	"wdiet/notifier"
+
+	"go.uber.org/zap"
+)
+
+var _ notifier.Channel = (*Sink)(nil)
+
+// Sink logs digests instead of sending them and keeps them in memory so tests can look at them.
+type Sink struct {
+	l *zap.Logger
+
+	mu   sync.Mutex
+	sent []notifier.Digest
+
+	SendOverride func(ctx context.Context, d notifier.Digest) error
+}
+
+func New(l *zap.Logger) *Sink {
+	return &Sink{l: l.Named("digests")}
+}
+
+func (s *Sink) Send(ctx context.Context, d notifier.Digest) error {
+	if s.SendOverride != nil {
+		return s.SendOverride(ctx, d)
+	}
+
+	s.l.Info("digest", zap.String("user_uuid", d.UserUUID.String()), zap.String("day", d.Day), zap.Int("items", len(d.Items)))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sent = append(s.sent, d)
+
+	return nil
+}
+
+// Sent returns what has been sent so far, oldest first.
+func (s *Sink) Sent() []notifier.Digest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]notifier.Digest(nil), s.sent...)
+}
@@ -0,0 +1,36 @@
+package notifier
+
+import (
+	"context"
+	"time"
+	"wdiet/units"
+
+	"github.com/google/uuid"
+)
+
+// Digest is a user's daily list of what's about to go off in their fridge.
+type Digest struct {
+	UserUUID     uuid.UUID    `json:"user_uuid"`
+	FirstName    string       `json:"-"`
+	EmailAddress string       `json:"-"`   //where the email channel sends it
+	WebhookURL   string       `json:"-"`   //where the webhook channel posts it
+	Day          string       `json:"day"` //the user's local date it's for, 2023-03-24
+	Items        []DigestItem `json:"items"`
+}
+
+// DigestItem is one lot in the fridge, soonest to go off first.
+type DigestItem struct {
+	FridgeItemUUID uuid.UUID    `json:"fridge_item_uuid"`
+	IngredientUUID uuid.UUID    `json:"ingredient_uuid"`
+	IngredientName string       `json:"ingredient_name"`
+	Amount         units.Amount `json:"amount"`
+	Unit           string       `json:"unit"`
+	Location       string       `json:"location"`
+	ExpirationDate time.Time    `json:"expiration_date"`
+}
+
+// Channel sends digests somewhere. Like mailer.Mailer, the service only knows this interface, so users can pick email
+// or a webhook and tests can swap in logsink.Sink.
+type Channel interface {
+	Send(ctx context.Context, d Digest) error
+}
@@ -0,0 +1,144 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+	"wdiet/notifier"
+)
+
+var _ notifier.Channel = (*Channel)(nil)
+
+const (
+	SignatureHeader = "X-Wdiet-Signature"
+	timeout         = 10 * time.Second
+)
+
+// ErrForbiddenAddress is a webhook URL that leads somewhere only we can reach, like localhost or the cloud metadata service.
+var ErrForbiddenAddress = errors.New("webhook address not allowed")
+
+// notPublic are the ranges net.IP doesn't have a method for that aren't on the internet either.
+var notPublic = mustParseCIDRs("0.0.0.0/8", "100.64.0.0/10", "192.0.0.0/24", "198.18.0.0/15", "240.0.0.0/4", "64:ff9b::/96")
+
+// Channel posts digests as JSON to the URL the user set. With a secret, every post is signed with it, the
+// X-Wdiet-Signature header is sha256= and the hex HMAC-SHA256 of the body, so the receiver can tell it's from us.
+// Anybody can set any URL, so it only ever connects to public addresses and doesn't follow redirects.
+type Channel struct {
+	client *http.Client
+	secret []byte
+}
+
+func New(secret []byte) *Channel {
+	return newChannel(secret, IsPublic)
+}
+
+// newChannel is New with another idea of which addresses it may connect to, tests post to httptest servers on localhost.
+func newChannel(secret []byte, allowed func(net.IP) bool) *Channel {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: func(network, address string, _ syscall.RawConn) error { //after the name is resolved, so a name pointing inside doesn't get through
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !allowed(ip) {
+				return fmt.Errorf("%w: %s", ErrForbiddenAddress, host)
+			}
+			return nil
+		},
+	}
+
+	client := &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{ //no proxy, we'd be checking the proxy's address instead of the webhook's
+			DialContext:         dialer.DialContext,
+			ForceAttemptHTTP2:   true,
+			TLSHandshakeTimeout: timeout,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error { //a public address could send us to an inside one
+			return fmt.Errorf("%w: redirected to %s", ErrForbiddenAddress, req.URL.Redacted())
+		},
+	}
+
+	return &Channel{client: client, secret: secret}
+}
+
+// IsPublic tells if ip is on the internet, not loopback, private, link local, unspecified, multicast or reserved.
+func IsPublic(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() {
+		return false
+	}
+
+	for _, n := range notPublic {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	nets := make([]*net.IPNet, len(cidrs))
+
+	for i, c := range cidrs {
+		_, n, err := net.ParseCIDR(c)
+		if err != nil {
+			panic(err)
+		}
+		nets[i] = n
+	}
+
+	return nets
+}
+
+func (ch *Channel) Send(ctx context.Context, d notifier.Digest) error {
+	if d.WebhookURL == "" {
+		return errors.New("error posting digest: no webhook url")
+	}
+
+	body, err := json.Marshal(d)
+	if err != nil {
+		return fmt.Errorf("error posting digest: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("error posting digest: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	if len(ch.secret) > 0 {
+		req.Header.Set(SignatureHeader, Sign(ch.secret, body))
+	}
+
+	res, err := ch.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error posting digest: %w", err)
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(res.Body, 1<<16)) //so the connection can be reused
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("error posting digest: %s answered %d", d.WebhookURL, res.StatusCode)
+	}
+
+	return nil
+}
+
+// Sign is what goes in the X-Wdiet-Signature header of a post with body.
+func Sign(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,122 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"wdiet/notifier"
+	"wdiet/units"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSend(t *testing.T) {
+	secret := []byte("jyoonieisthebest")
+
+	var gotBody []byte
+	var gotSignature string
+	status := http.StatusNoContent
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotBody, _ = io.ReadAll(r.Body)
+		gotSignature = r.Header.Get(SignatureHeader)
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	d := notifier.Digest{
+		UserUUID:     uuid.MustParse("080b5f09-527b-4581-bb56-19adbfe50ebf"),
+		EmailAddress: "jywoo92324@gmail.com",
+		WebhookURL:   server.URL,
+		Day:          "2023-03-24",
+		Items: []notifier.DigestItem{
+			{IngredientName: "onion", Amount: units.Whole(3), Unit: "kg", Location: "fridge", ExpirationDate: time.Date(2023, time.March, 25, 15, 0, 0, 0, time.UTC)},
+		},
+	}
+
+	ch := newChannel(secret, anywhere)
+
+	assert.NoError(t, ch.Send(context.Background(), d))
+	assert.Equal(t, Sign(secret, gotBody), gotSignature)
+
+	var got map[string]interface{}
+	assert.NoError(t, json.Unmarshal(gotBody, &got))
+	assert.Equal(t, "2023-03-24", got["day"])
+	assert.NotContains(t, got, "email_address") //the receiver doesn't need it
+	assert.Len(t, got["items"], 1)
+
+	status = http.StatusInternalServerError
+	assert.Error(t, ch.Send(context.Background(), d))
+
+	d.WebhookURL = ""
+	assert.Error(t, ch.Send(context.Background(), d))
+}
+
+func TestSendUnsigned(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Empty(t, r.Header.Get(SignatureHeader))
+	}))
+	defer server.Close()
+
+	assert.NoError(t, newChannel(nil, anywhere).Send(context.Background(), notifier.Digest{WebhookURL: server.URL}))
+}
+
+func anywhere(net.IP) bool { return true } //httptest servers are on localhost
+
+func TestSendLocalhost(t *testing.T) {
+	hit := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hit = true
+	}))
+	defer server.Close()
+
+	err := New(nil).Send(context.Background(), notifier.Digest{WebhookURL: server.URL}) //127.0.0.1
+	assert.True(t, errors.Is(err, ErrForbiddenAddress), "error: %v", err)
+	assert.False(t, hit)
+}
+
+func TestSendRedirect(t *testing.T) {
+	hit := false
+	inside := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hit = true
+	}))
+	defer inside.Close()
+
+	outside := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, inside.URL, http.StatusPermanentRedirect)
+	}))
+	defer outside.Close()
+
+	err := newChannel(nil, anywhere).Send(context.Background(), notifier.Digest{WebhookURL: outside.URL})
+	assert.True(t, errors.Is(err, ErrForbiddenAddress), "error: %v", err)
+	assert.False(t, hit)
+}
+
+func TestIsPublic(t *testing.T) {
+	for ip, expected := range map[string]bool{
+		"93.184.216.34":   true,
+		"2606:4700::1111": true,
+		"127.0.0.1":       false,
+		"::1":             false,
+		"10.1.2.3":        false,
+		"172.16.0.1":      false,
+		"192.168.1.1":     false,
+		"169.254.169.254": false, //cloud metadata
+		"fe80::1":         false,
+		"fd00::1":         false,
+		"0.0.0.0":         false,
+		"::":              false,
+		"100.64.0.1":      false,
+		"::ffff:10.0.0.1": false,
+		"224.0.0.1":       false,
+	} {
+		assert.Equal(t, expected, IsPublic(net.ParseIP(ip)), ip)
+	}
+}
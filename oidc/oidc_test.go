@@ -0,0 +1,231 @@
+package oidc_test
+
+import (
+	"context"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"wdiet/oidc"
+	"wdiet/oidc/oidctest"
+)
+
+const redirectURL = "http://wdiet.test/oidc/stub/callback"
+
+var stubUser = oidctest.User{Subject: "248289761001", Email: "jane@example.com", EmailVerified: true, GivenName: "Jane", FamilyName: "Doe"}
+
+// login runs the whole flow against the stub and returns what VerifyIDToken made of it.
+func login(t *testing.T, stub *oidctest.Server, p *oidc.Provider) (*oidc.Identity, error) {
+	ctx := context.Background()
+
+	verifier, err := oidc.NewVerifier()
+	require.NoError(t, err)
+
+	authURL, err := p.AuthCodeURL(ctx, "the-state", "the-nonce", verifier)
+	require.NoError(t, err)
+
+	callback, err := stub.Authorize(authURL, stubUser)
+	require.NoError(t, err)
+
+	u, err := url.Parse(callback)
+	require.NoError(t, err)
+	require.Equal(t, "the-state", u.Query().Get("state"))
+
+	raw, err := p.Exchange(ctx, u.Query().Get("code"), verifier)
+	if err != nil {
+		return nil, err
+	}
+
+	return p.VerifyIDToken(ctx, raw, "the-nonce")
+}
+
+func TestAuthCodeURL(t *testing.T) {
+	stub := oidctest.NewServer()
+	defer stub.Close()
+
+	p := oidc.New(stub.Config("stub", redirectURL), nil)
+
+	authURL, err := p.AuthCodeURL(context.Background(), "the-state", "the-nonce", "the-verifier")
+	require.NoError(t, err)
+
+	u, err := url.Parse(authURL)
+	require.NoError(t, err)
+	assert.Equal(t, stub.URL+"/authorize", u.Scheme+"://"+u.Host+u.Path)
+
+	q := u.Query()
+	assert.Equal(t, "code", q.Get("response_type"))
+	assert.Equal(t, oidctest.ClientID, q.Get("client_id"))
+	assert.Equal(t, redirectURL, q.Get("redirect_uri"))
+	assert.Equal(t, "openid email profile", q.Get("scope"))
+	assert.Equal(t, "the-state", q.Get("state"))
+	assert.Equal(t, "the-nonce", q.Get("nonce"))
+	assert.Equal(t, oidc.CodeChallenge("the-verifier"), q.Get("code_challenge"))
+	assert.Equal(t, "S256", q.Get("code_challenge_method"))
+}
+
+// the example from RFC 7636 appendix B
+func TestCodeChallenge(t *testing.T) {
+	assert.Equal(t, "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM", oidc.CodeChallenge("dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"))
+}
+
+func TestLogin(t *testing.T) {
+	stub := oidctest.NewServer()
+	defer stub.Close()
+
+	p := oidc.New(stub.Config("stub", redirectURL), nil)
+
+	id, err := login(t, stub, p)
+	require.NoError(t, err)
+	assert.Equal(t, &oidc.Identity{Subject: "248289761001", Email: "jane@example.com", EmailVerified: true, GivenName: "Jane", FamilyName: "Doe"}, id)
+}
+
+func TestExchange(t *testing.T) {
+	stub := oidctest.NewServer()
+	defer stub.Close()
+
+	p := oidc.New(stub.Config("stub", redirectURL), nil)
+	ctx := context.Background()
+
+	verifier, err := oidc.NewVerifier()
+	require.NoError(t, err)
+
+	authURL, err := p.AuthCodeURL(ctx, "the-state", "the-nonce", verifier)
+	require.NoError(t, err)
+
+	callback, err := stub.Authorize(authURL, stubUser)
+	require.NoError(t, err)
+	u, err := url.Parse(callback)
+	require.NoError(t, err)
+	code := u.Query().Get("code")
+
+	//the wrong verifier, somebody who got hold of the code but not the verifier
+	_, err = p.Exchange(ctx, code, "not-the-verifier")
+	assert.ErrorIs(t, err, oidc.ErrExchange)
+
+	//the code is gone after a failed try too
+	_, err = p.Exchange(ctx, code, verifier)
+	assert.ErrorIs(t, err, oidc.ErrExchange)
+
+	//wrong client secret
+	cfg := stub.Config("stub", redirectURL)
+	cfg.ClientSecret = "guess"
+	other := oidc.New(cfg, nil)
+
+	authURL, err = other.AuthCodeURL(ctx, "the-state", "the-nonce", verifier)
+	require.NoError(t, err)
+	callback, err = stub.Authorize(authURL, stubUser)
+	require.NoError(t, err)
+	u, err = url.Parse(callback)
+	require.NoError(t, err)
+
+	_, err = other.Exchange(ctx, u.Query().Get("code"), verifier)
+	assert.ErrorIs(t, err, oidc.ErrExchange)
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	stub := oidctest.NewServer()
+	defer stub.Close()
+
+	testcases := []struct {
+		name   string
+		claims func(jwt.MapClaims)
+		nonce  string
+		valid  bool
+	}{
+		{name: "valid", nonce: "n", valid: true},
+		{name: "wrong nonce", nonce: "other", valid: false},
+		{name: "no nonce", claims: func(c jwt.MapClaims) { delete(c, "nonce") }, nonce: "n", valid: false},
+		{name: "wrong issuer", claims: func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" }, nonce: "n", valid: false},
+		{name: "wrong audience", claims: func(c jwt.MapClaims) { c["aud"] = "somebody-else" }, nonce: "n", valid: false},
+		{name: "several audiences without azp", claims: func(c jwt.MapClaims) { c["aud"] = []string{oidctest.ClientID, "somebody-else"} }, nonce: "n", valid: false},
+		{name: "several audiences with azp", claims: func(c jwt.MapClaims) {
+			c["aud"] = []string{oidctest.ClientID, "somebody-else"}
+			c["azp"] = oidctest.ClientID
+		}, nonce: "n", valid: true},
+		{name: "expired", claims: func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Minute).Unix() }, nonce: "n", valid: false},
+		{name: "no expiry", claims: func(c jwt.MapClaims) { delete(c, "exp") }, nonce: "n", valid: false},
+		{name: "issued in the future", claims: func(c jwt.MapClaims) { c["iat"] = time.Now().Add(time.Hour).Unix() }, nonce: "n", valid: false},
+		{name: "no subject", claims: func(c jwt.MapClaims) { delete(c, "sub") }, nonce: "n", valid: false},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			stub.Claims = testcase.claims
+			defer func() { stub.Claims = nil }()
+
+			p := oidc.New(stub.Config("stub", redirectURL), nil)
+
+			_, err := p.VerifyIDToken(context.Background(), stub.IDToken(stubUser, "n"), testcase.nonce)
+			if testcase.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, oidc.ErrInvalidToken)
+			}
+		})
+	}
+}
+
+func TestVerifyIDTokenSignature(t *testing.T) {
+	stub := oidctest.NewServer()
+	defer stub.Close()
+	other := oidctest.NewServer() //same kid, different key
+	defer other.Close()
+
+	p := oidc.New(stub.Config("stub", redirectURL), nil)
+	ctx := context.Background()
+
+	//signed by the wrong key
+	other.Claims = func(c jwt.MapClaims) { c["iss"] = stub.URL }
+	_, err := p.VerifyIDToken(ctx, other.IDToken(stubUser, "n"), "n")
+	assert.ErrorIs(t, err, oidc.ErrInvalidToken)
+
+	//a kid the provider doesn't have
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{"iss": stub.URL, "aud": oidctest.ClientID, "sub": "x", "nonce": "n", "exp": time.Now().Add(time.Minute).Unix()})
+	token.Header["kid"] = "unknown"
+	raw, err := token.SignedString(stub.Key)
+	require.NoError(t, err)
+	_, err = p.VerifyIDToken(ctx, raw, "n")
+	assert.ErrorIs(t, err, oidc.ErrInvalidToken)
+
+	//alg none
+	token = jwt.NewWithClaims(jwt.SigningMethodNone, jwt.MapClaims{"iss": stub.URL, "aud": oidctest.ClientID, "sub": "x", "nonce": "n", "exp": time.Now().Add(time.Minute).Unix()})
+	raw, err = token.SignedString(jwt.UnsafeAllowNoneSignatureType)
+	require.NoError(t, err)
+	_, err = p.VerifyIDToken(ctx, raw, "n")
+	assert.ErrorIs(t, err, oidc.ErrInvalidToken)
+
+	//HS256 with the client secret
+	token = jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"iss": stub.URL, "aud": oidctest.ClientID, "sub": "x", "nonce": "n", "exp": time.Now().Add(time.Minute).Unix()})
+	token.Header["kid"] = oidctest.KeyID
+	raw, err = token.SignedString([]byte(oidctest.ClientSecret))
+	require.NoError(t, err)
+	_, err = p.VerifyIDToken(ctx, raw, "n")
+	assert.ErrorIs(t, err, oidc.ErrInvalidToken)
+}
+
+func TestEmailVerifiedAsString(t *testing.T) {
+	stub := oidctest.NewServer()
+	defer stub.Close()
+
+	stub.Claims = func(c jwt.MapClaims) { c["email_verified"] = "true" }
+	p := oidc.New(stub.Config("stub", redirectURL), nil)
+
+	id, err := p.VerifyIDToken(context.Background(), stub.IDToken(stubUser, "n"), "n")
+	require.NoError(t, err)
+	assert.True(t, id.EmailVerified)
+}
+
+func TestDiscoveryIssuerMismatch(t *testing.T) {
+	stub := oidctest.NewServer()
+	defer stub.Close()
+
+	cfg := stub.Config("stub", redirectURL)
+	cfg.Issuer = stub.URL + "/"
+
+	_, err := oidc.New(cfg, nil).AuthCodeURL(context.Background(), "s", "n", "v")
+	assert.Error(t, err)
+}
@@ -0,0 +1,52 @@
+package service
+
+import (
+	"reflect"
+	"wdiet/units"
+
+	"github.com/gin-gonic/gin"
+)
+
+const amountsFraction = "fraction" //?amounts=fraction, "1 1/2" instead of 1.5
+
+var amountType = reflect.TypeOf(units.Amount{})
+
+// amountsJSON is c.JSON for responses with amounts in them. Amounts are decimal numbers, or fraction strings like
+// "1 1/2" when the request asks for ?amounts=fraction.
+func amountsJSON(c *gin.Context, code int, obj interface{}) {
+	if c.Query("amounts") == amountsFraction {
+		v := reflect.New(reflect.TypeOf(obj)).Elem() //a copy we can set things on
+		v.Set(reflect.ValueOf(obj))
+		asFractions(v)
+		obj = v.Interface()
+	}
+
+	c.JSON(code, obj)
+}
+
+// asFractions goes through v and turns every amount in it into one that's written as a fraction. The response is
+// ours, so it's fine to change slices and pointers in place.
+func asFractions(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if !v.IsNil() {
+			asFractions(v.Elem())
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			asFractions(v.Index(i))
+		}
+	case reflect.Struct:
+		if v.Type() == amountType {
+			if v.CanSet() {
+				v.Set(reflect.ValueOf(v.Interface().(units.Amount).AsFraction()))
+			}
+			return
+		}
+		for i := 0; i < v.NumField(); i++ {
+			if f := v.Field(i); f.CanSet() {
+				asFractions(f)
+			}
+		}
+	}
+}
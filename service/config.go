@@ -0,0 +1,238 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"wdiet/hasher"
+	"wdiet/lockout"
+	"wdiet/mailer"
+	"wdiet/notifier"
+	"wdiet/oidc"
+)
+
+type Config struct {
+	Keys      *KeySet
+	Mailer    mailer.Mailer
+	PublicURL string //where users reach us, links in emails start with this
+	Hasher    hasher.PasswordHasher
+	Lockout   *lockout.Tracker //failed login tracking. the backend depends on the deployment, so main sets it up
+
+	TrustedProxies []string //addresses or CIDRs of the reverse proxies whose X-Forwarded-For we believe. none means the address the request came from
+
+	OIDCProviders []oidc.Config //none means only email and password
+
+	DeletionGracePeriod time.Duration //how long a deleted account can still be reactivated. 0 means defaultDeletionGracePeriod
+
+	DigestChannels map[string]notifier.Channel //how daily digests can go out, users pick one by name. none means no digests
+}
+
+const (
+	defaultDeletionGracePeriod = 30 * 24 * time.Hour
+	purgeInterval              = time.Hour //how often accounts past their grace period are looked for
+)
+
+func ConfigFromEnvironment() (Config, error) {
+	keys, err := getKeySetFromEnvironment()
+	if err != nil {
+		return Config{}, fmt.Errorf("error creating config: %w", err)
+	}
+
+	h, err := getHasherFromEnvironment()
+	if err != nil {
+		return Config{}, fmt.Errorf("error creating config: %w", err)
+	}
+
+	publicURL, exists := os.LookupEnv("WDIET_PUBLIC_URL")
+	if !exists {
+		publicURL = "http://localhost:8080"
+	}
+
+	publicURL = strings.TrimRight(publicURL, "/")
+
+	providers, err := getOIDCProvidersFromEnvironment(publicURL)
+	if err != nil {
+		return Config{}, fmt.Errorf("error creating config: %w", err)
+	}
+
+	trustedProxies, err := parseTrustedProxies(os.Getenv("WDIET_TRUSTED_PROXIES")) //e.g. 10.0.0.0/8,192.168.1.10
+	if err != nil {
+		return Config{}, fmt.Errorf("error creating config: %w", err)
+	}
+
+	var gracePeriod time.Duration
+	if raw, exists := os.LookupEnv("WDIET_DELETION_GRACE_PERIOD"); exists { //e.g. 720h
+		gracePeriod, err = time.ParseDuration(raw)
+		if err != nil || gracePeriod <= 0 {
+			return Config{}, fmt.Errorf("error creating config: WDIET_DELETION_GRACE_PERIOD has to be a positive duration like 720h")
+		}
+	}
+
+	return Config{
+		Keys:                keys,
+		PublicURL:           publicURL,
+		Hasher:              h,
+		OIDCProviders:       providers,
+		DeletionGracePeriod: gracePeriod,
+		TrustedProxies:      trustedProxies,
+	}, nil
+}
+
+// parseTrustedProxies reads a comma separated list of addresses and CIDRs. Anyone can send X-Forwarded-For, so only
+// proxies listed here get to say who the client is, otherwise the login lockout per IP is easy to dodge.
+func parseTrustedProxies(raw string) ([]string, error) {
+	var proxies []string
+
+	for _, p := range strings.Split(raw, ",") {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+
+		if _, _, err := net.ParseCIDR(p); err != nil && net.ParseIP(p) == nil {
+			return nil, fmt.Errorf("WDIET_TRUSTED_PROXIES: %q is not an address or a CIDR", p)
+		}
+		proxies = append(proxies, p)
+	}
+
+	return proxies, nil
+}
+
+var providerName = regexp.MustCompile(`^[a-z0-9_-]{1,64}$`) //it goes in urls and wdiet.user_identities.provider
+
+// getOIDCProvidersFromEnvironment reads the openid providers inline from WDIET_OIDC_PROVIDERS, or from the file
+// WDIET_OIDC_PROVIDERS_FILE points at. Neither set is fine, then there are none. e.g.
+//
+//	[
+//	  {"name": "google", "issuer": "https://accounts.google.com", "client_id": "...", "client_secret": "..."}
+//	]
+//
+// redirect_url defaults to <WDIET_PUBLIC_URL>/oidc/<name>/callback, register that one at the provider.
+func getOIDCProvidersFromEnvironment(publicURL string) ([]oidc.Config, error) {
+	raw, exists := os.LookupEnv("WDIET_OIDC_PROVIDERS")
+	if !exists {
+		path, exists := os.LookupEnv("WDIET_OIDC_PROVIDERS_FILE")
+		if !exists {
+			return nil, nil
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("error reading oidc providers: %w", err)
+		}
+		raw = string(data)
+	}
+
+	return parseOIDCProviders([]byte(raw), publicURL)
+}
+
+func parseOIDCProviders(data []byte, publicURL string) ([]oidc.Config, error) {
+	var providers []oidc.Config
+
+	if err := json.Unmarshal(data, &providers); err != nil {
+		return nil, fmt.Errorf("error parsing oidc providers: %w", err)
+	}
+
+	seen := make(map[string]bool, len(providers))
+	for i, p := range providers {
+		switch {
+		case !providerName.MatchString(p.Name):
+			return nil, fmt.Errorf("error parsing oidc providers: name %q has to be lowercase letters, digits, - and _", p.Name)
+		case seen[p.Name]:
+			return nil, fmt.Errorf("error parsing oidc providers: %q is there twice", p.Name)
+		case p.Issuer == "" || p.ClientID == "":
+			return nil, fmt.Errorf("error parsing oidc providers: %q needs an issuer and a client_id", p.Name)
+		}
+		seen[p.Name] = true
+
+		if p.RedirectURL == "" {
+			providers[i].RedirectURL = publicURL + "/oidc/" + p.Name + "/callback"
+		}
+	}
+
+	return providers, nil
+}
+
+// getHasherFromEnvironment builds the hasher new passwords get hashed with. WDIET_PASSWORD_HASH picks argon2id (default)
+// or bcrypt, the other variables tune it. Changing any of them is fine, old hashes still verify and get upgraded on login.
+func getHasherFromEnvironment() (hasher.PasswordHasher, error) {
+	switch alg := os.Getenv("WDIET_PASSWORD_HASH"); alg {
+	case "", "argon2id":
+		a := hasher.DefaultArgon2id
+
+		memory, err := getUintFromEnvironment("WDIET_ARGON2_MEMORY_KIB", uint64(a.Memory), 32)
+		if err != nil {
+			return nil, err
+		}
+
+		time, err := getUintFromEnvironment("WDIET_ARGON2_TIME", uint64(a.Time), 32)
+		if err != nil {
+			return nil, err
+		}
+
+		threads, err := getUintFromEnvironment("WDIET_ARGON2_THREADS", uint64(a.Threads), 8)
+		if err != nil {
+			return nil, err
+		}
+
+		a.Memory, a.Time, a.Threads = uint32(memory), uint32(time), uint8(threads)
+		if a.Memory < 8*uint32(a.Threads) || a.Time == 0 || a.Threads == 0 {
+			return nil, fmt.Errorf("error creating hasher: invalid argon2id parameters")
+		}
+
+		return a, nil
+
+	case "bcrypt":
+		cost, err := getUintFromEnvironment("WDIET_BCRYPT_COST", 12, 8)
+		if err != nil {
+			return nil, err
+		}
+
+		if cost < 10 || cost > 31 { //under 10 is too weak to bother
+			return nil, fmt.Errorf("error creating hasher: WDIET_BCRYPT_COST has to be between 10 and 31")
+		}
+
+		return hasher.Bcrypt{Cost: int(cost)}, nil
+
+	default:
+		return nil, fmt.Errorf("error creating hasher: unknown WDIET_PASSWORD_HASH %q, use argon2id or bcrypt", alg)
+	}
+}
+
+func getUintFromEnvironment(key string, fallback uint64, bits int) (uint64, error) {
+	raw, exists := os.LookupEnv(key)
+	if !exists {
+		return fallback, nil
+	}
+
+	v, err := strconv.ParseUint(raw, 10, bits)
+	if err != nil {
+		return 0, fmt.Errorf("error parsing %s: %w", key, err)
+	}
+
+	return v, nil
+}
+
+// getKeySetFromEnvironment reads the key set inline from WDIET_JWT_KEYS, or from the file WDIET_JWT_KEYS_FILE points at.
+func getKeySetFromEnvironment() (*KeySet, error) {
+	if raw, exists := os.LookupEnv("WDIET_JWT_KEYS"); exists {
+		return ParseKeySet([]byte(raw))
+	}
+
+	path, exists := os.LookupEnv("WDIET_JWT_KEYS_FILE")
+	if !exists {
+		return nil, fmt.Errorf("error getting WDIET_JWT_KEYS or WDIET_JWT_KEYS_FILE from environment")
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading key set: %w", err)
+	}
+
+	return ParseKeySet(data)
+}
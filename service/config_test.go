@@ -0,0 +1,76 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseOIDCProviders(t *testing.T) {
+	testcases := []struct {
+		name                string
+		data                string
+		expectedRedirectURL string
+		expectedError       bool
+	}{
+		{
+			"happyPath:defaultRedirect",
+			`[{"name": "google", "issuer": "https://accounts.google.com", "client_id": "id", "client_secret": "secret"}]`,
+			"https://wdiet.test/oidc/google/callback",
+			false,
+		},
+		{
+			"happyPath:ownRedirect",
+			`[{"name": "google", "issuer": "https://accounts.google.com", "client_id": "id", "redirect_url": "https://app.wdiet.test/cb"}]`,
+			"https://app.wdiet.test/cb",
+			false,
+		},
+		{"badName", `[{"name": "Google Accounts", "issuer": "https://accounts.google.com", "client_id": "id"}]`, "", true},
+		{"noIssuer", `[{"name": "google", "client_id": "id"}]`, "", true},
+		{"noClientID", `[{"name": "google", "issuer": "https://accounts.google.com"}]`, "", true},
+		{"twice", `[{"name": "google", "issuer": "https://a", "client_id": "id"}, {"name": "google", "issuer": "https://b", "client_id": "id"}]`, "", true},
+		{"notJSON", `google`, "", true},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			providers, err := parseOIDCProviders([]byte(testcase.data), "https://wdiet.test")
+			if testcase.expectedError {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			if assert.Len(t, providers, 1) {
+				assert.Equal(t, testcase.expectedRedirectURL, providers[0].RedirectURL)
+			}
+		})
+	}
+}
+
+func TestParseTrustedProxies(t *testing.T) {
+	testcases := []struct {
+		name          string
+		raw           string
+		expected      []string
+		expectedError bool
+	}{
+		{"none", "", nil, false},
+		{"happyPath", "10.0.0.0/8, 192.168.1.10,,2001:db8::/32", []string{"10.0.0.0/8", "192.168.1.10", "2001:db8::/32"}, false},
+		{"hostname", "proxy.internal", nil, true},
+		{"badCIDR", "10.0.0.0/33", nil, true},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			proxies, err := parseTrustedProxies(testcase.raw)
+			if testcase.expectedError {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, testcase.expected, proxies)
+		})
+	}
+}
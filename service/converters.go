@@ -1,7 +1,12 @@
 package service
 
 import (
+	"fmt"
+	"math/big"
+	"time"
+	"wdiet/shelflife"
 	"wdiet/store"
+	"wdiet/units"
 
 	"github.com/google/uuid"
 )
@@ -9,7 +14,6 @@ import (
 func apiUser2DBUser(u User) store.User { //your user always submits a value, that's why you take the value. 이 모델은 핸들러에서 요청 받은거 db model로 변환할 때 쓴다.
 	return store.User{
 		UserUUID:     u.UserUUID, //for every user related request, this field is needed, but for createuser request, you don't need this field. So you can just leave it empty.
-		Active:       u.Active,
 		FirstName:    u.FirstName,
 		LastName:     u.LastName,
 		EmailAddress: u.EmailAddress,
@@ -18,11 +22,32 @@ func apiUser2DBUser(u User) store.User { //your user always submits a value, tha
 
 func dbUser2ApiUser(u *store.User) User { //your db always spits out the pointer, that's why you take the pointer.
 	return User{
-		UserUUID:     u.UserUUID,
-		Active:       u.Active,
-		FirstName:    u.FirstName,
-		LastName:     u.LastName,
-		EmailAddress: u.EmailAddress,
+		UserUUID:        u.UserUUID,
+		Active:          u.Active,
+		Role:            u.Role,
+		FirstName:       u.FirstName,
+		LastName:        u.LastName,
+		EmailAddress:    u.EmailAddress,
+		EmailVerifiedAt: u.EmailVerifiedAt,
+	}
+}
+
+func apiPAT2DBPAT(t PersonalAccessToken) store.PersonalAccessToken {
+	return store.PersonalAccessToken{
+		Name:      t.Name,
+		Scopes:    t.Scopes,
+		ExpiresAt: t.ExpiresAt,
+	}
+}
+
+func dbPAT2ApiPAT(t *store.PersonalAccessToken) PersonalAccessToken {
+	return PersonalAccessToken{
+		PersonalAccessTokenUUID: t.PersonalAccessTokenUUID,
+		Name:                    t.Name,
+		Scopes:                  t.Scopes,
+		ExpiresAt:               t.ExpiresAt,
+		LastUsedAt:              t.LastUsedAt,
+		CreatedAt:               t.CreatedAt,
 	}
 }
 
@@ -32,6 +57,10 @@ func apiIngr2DBIngr(i Ingredient) store.Ingredient {
 		IngredientName: i.IngredientName,
 		Category:       i.Category,
 		DaysUntilExp:   i.DaysUntilExp,
+		FreezerDays:    i.FreezerDays,
+		PantryDays:     i.PantryDays,
+		OpenedDays:     i.OpenedDays,
+		Density:        i.Density,
 	}
 }
 
@@ -41,6 +70,19 @@ func dbIngr2ApiIngr(i *store.Ingredient) Ingredient {
 		IngredientName: i.IngredientName,
 		Category:       i.Category,
 		DaysUntilExp:   i.DaysUntilExp,
+		FreezerDays:    i.FreezerDays,
+		PantryDays:     i.PantryDays,
+		OpenedDays:     i.OpenedDays,
+		Density:        i.Density,
+	}
+}
+
+func dbIngr2Life(i *store.Ingredient) shelflife.Life {
+	return shelflife.Life{
+		Fridge:  i.DaysUntilExp,
+		Freezer: i.FreezerDays,
+		Pantry:  i.PantryDays,
+		Opened:  i.OpenedDays,
 	}
 }
 
@@ -58,26 +100,141 @@ func apiSearchIngr2DBSearchIngr(i SearchIngredient) store.SearchIngredient {
 
 func apiFIngr2DBFIngr(f FridgeIngredient) store.FridgeIngredient { //api model에 있는 필드만 신경써.
 	return store.FridgeIngredient{
+		FridgeItemUUID: f.FridgeItemUUID,
+		HouseholdUUID:  f.HouseholdUUID,
 		UserUUID:       f.UserUUID,
 		IngredientUUID: f.IngredientUUID,
 		Amount:         f.Amount,
-		Unit:           f.Unit,
+		Unit:           units.Canonical(f.Unit),
 		PurchasedDate:  f.PurchasedDate,
 		ExpirationDate: f.ExpirationDate,
+		Location:       f.Location,
+		OpenedDate:     f.OpenedDate,
 	}
 }
 
 func dbFIngr2ApiFIngr(f *store.FridgeIngredient) FridgeIngredient {
 	return FridgeIngredient{
+		FridgeItemUUID: f.FridgeItemUUID,
+		HouseholdUUID:  f.HouseholdUUID,
 		UserUUID:       f.UserUUID,
 		IngredientUUID: f.IngredientUUID,
 		Amount:         f.Amount,
 		Unit:           f.Unit,
 		PurchasedDate:  f.PurchasedDate,
 		ExpirationDate: f.ExpirationDate,
+		Location:       f.Location,
+		OpenedDate:     f.OpenedDate,
+	}
+}
+
+func dbFridgeEvent2ApiFridgeEvent(e *store.FridgeEvent) FridgeEvent {
+	event := FridgeEvent{
+		FridgeEventUUID: e.FridgeEventUUID,
+		EventType:       e.EventType,
+		HouseholdUUID:   e.HouseholdUUID,
+		FridgeItemUUID:  e.FridgeItemUUID,
+		IngredientUUID:  e.IngredientUUID,
+		IngredientName:  e.IngredientName,
+		Category:        e.Category,
+		Amount:          e.Amount,
+		Unit:            e.Unit,
+		Location:        e.Location,
+		OpenedDate:      e.OpenedDate,
+		Reason:          e.Reason,
+		EstimatedCost:   e.EstimatedCost,
+		CreatedAt:       e.CreatedAt,
+	}
+	if purchased := e.PurchasedDate; !purchased.IsZero() { //copies, e is often a loop variable
+		event.PurchasedDate = &purchased
+	}
+	if expiration := e.ExpirationDate; !expiration.IsZero() {
+		event.ExpirationDate = &expiration
+	}
+
+	return event
+}
+
+// dbFIngrs2ApiGroups groups the lots by ingredient. The store lists the lots of an ingredient next to each other, oldest
+// expiry first, so the groups keep that order.
+func dbFIngrs2ApiGroups(fs []store.FridgeIngredient) []FridgeIngredientGroup {
+	var groups []FridgeIngredientGroup
+
+	for _, f := range fs {
+		if len(groups) == 0 || groups[len(groups)-1].IngredientUUID != f.IngredientUUID {
+			groups = append(groups, FridgeIngredientGroup{IngredientUUID: f.IngredientUUID, ExpirationDate: f.ExpirationDate})
+		}
+
+		last := &groups[len(groups)-1]
+		if f.ExpirationDate.Before(last.ExpirationDate) {
+			last.ExpirationDate = f.ExpirationDate
+		}
+		last.Lots = append(last.Lots, dbFIngr2ApiFIngr(&f))
+	}
+
+	return groups
+}
+
+func dbHousehold2ApiHousehold(h *store.Household, members []store.HouseholdMember) Household {
+	household := Household{
+		HouseholdUUID: h.HouseholdUUID,
+		HouseholdName: h.HouseholdName,
+		CreatedAt:     h.CreatedAt,
+	}
+
+	for _, m := range members {
+		household.Members = append(household.Members, dbMember2ApiMember(&m))
+	}
+
+	return household
+}
+
+func dbMember2ApiMember(m *store.HouseholdMember) HouseholdMember {
+	return HouseholdMember{
+		UserUUID:     m.UserUUID,
+		Role:         m.Role,
+		FirstName:    m.FirstName,
+		LastName:     m.LastName,
+		EmailAddress: m.EmailAddress,
+		JoinedAt:     m.CreatedAt,
+	}
+}
+
+func dbMembership2ApiMembership(m *store.HouseholdMembership) HouseholdMembership {
+	return HouseholdMembership{
+		HouseholdUUID: m.HouseholdUUID,
+		HouseholdName: m.HouseholdName,
+		Role:          m.Role,
+		Active:        m.Active,
+		JoinedAt:      m.CreatedAt,
+	}
+}
+
+func dbInvitation2ApiInvitation(i *store.HouseholdInvitation) HouseholdInvitation {
+	return HouseholdInvitation{
+		HouseholdInvitationUUID: i.HouseholdInvitationUUID,
+		EmailAddress:            i.EmailAddress,
+		Role:                    i.Role,
+		ExpiresAt:               i.ExpiresAt,
 	}
 }
 
+func apiDeleteFIngr2DBFridgeEvent(o DeleteFIngrOptions, hid, uid, fid uuid.UUID) store.FridgeEvent {
+	e := store.FridgeEvent{
+		HouseholdUUID:  hid,
+		UserUUID:       uid,
+		FridgeItemUUID: fid,
+		Reason:         o.Reason,
+	}
+
+	if o.EstimatedCost != "" { //validated already
+		cost := units.MustParseAmount(o.EstimatedCost)
+		e.EstimatedCost = &cost
+	}
+
+	return e
+}
+
 // func apiDeleteFI2DBDeleteFI(f DeleteFIngr) store.DeleteFIngr { //이제 user_uuid랑 ingredient_uuid 둘 다 파람으로 넘겨줘서 필요없어짐 ㅋ
 // 	return store.DeleteFIngr{
 // 		UserUUID:       f.UserUUID,
@@ -93,7 +250,7 @@ func apiRIngr2DBRIngr(r []RecipeIngredient) []store.RecipeIngredient {
 
 		s.IngredientUUID = ingr.IngredientUUID
 		s.Amount = ingr.Amount
-		s.Unit = ingr.Unit
+		s.Unit = units.Canonical(ingr.Unit) //validated already, so it's always one of ours
 		ingredients = append(ingredients, s)
 	}
 
@@ -180,3 +337,113 @@ func apiSearchR2DBSearchR(r SearchRecipes) store.SearchRecipes {
 
 	return out
 }
+
+func dbSuggestion2ApiSuggestion(r *store.RecipeSuggestion, now time.Time) RecipeSuggestion {
+	var missing []MissingIngredient
+
+	for _, ingr := range r.Ingredients {
+		short := units.NewAmount(new(big.Rat).Sub(ingr.Amount.Rat(), available(ingr, now)))
+		if short.Sign() <= 0 {
+			continue
+		}
+
+		missing = append(missing, MissingIngredient{
+			IngredientUUID: ingr.IngredientUUID,
+			Amount:         ingr.Amount,
+			AmountShort:    short, //in the recipe's unit
+			Unit:           ingr.Unit,
+		})
+	}
+
+	return RecipeSuggestion{
+		RecipeUUID:         r.RecipeUUID,
+		UserUUID:           r.UserUUID,
+		RecipeName:         r.RecipeName,
+		Category:           r.Category,
+		Coverage:           r.Coverage,
+		MissingIngredients: missing,
+	}
+}
+
+func apiDeductions2DBDeductions(ds []CookDeduction) []store.FridgeDeduction {
+	var deductions []store.FridgeDeduction
+
+	for _, d := range ds {
+		deductions = append(deductions, store.FridgeDeduction{
+			FridgeItemUUID: d.FridgeItemUUID,
+			Amount:         d.Amount,
+			Unit:           d.Unit,
+			LeftAmount:     d.AmountLeft,
+			LeftUnit:       d.UnitLeft,
+		})
+	}
+
+	return deductions
+}
+
+func dbCookLog2ApiCookLog(l *store.CookLog) CookLog {
+	return CookLog{
+		CookLogUUID:   l.CookLogUUID,
+		HouseholdUUID: l.HouseholdUUID,
+		RecipeUUID:    l.RecipeUUID,
+		RecipeName:    l.RecipeName,
+		Servings:      l.Servings,
+		CookedAt:      l.CreatedAt,
+	}
+}
+
+func dbLockoutEvent2ApiLockoutEvent(e *store.LockoutEvent) LockoutEvent {
+	return LockoutEvent{
+		LockoutEventUUID: e.LockoutEventUUID,
+		Scope:            e.Scope,
+		Subject:          e.Subject,
+		Failures:         e.Failures,
+		LockedUntil:      e.LockedUntil,
+		CreatedAt:        e.CreatedAt,
+	}
+}
+
+func dbIdentity2ApiIdentity(i *store.UserIdentity) UserIdentity {
+	return UserIdentity{
+		Provider:     i.Provider,
+		Subject:      i.Subject,
+		EmailAddress: i.EmailAddress,
+		CreatedAt:    i.CreatedAt,
+		LastLoginAt:  i.LastLoginAt,
+	}
+}
+
+func dbRefreshToken2ApiSession(t *store.RefreshToken) Session {
+	return Session{
+		FamilyUUID: t.FamilyUUID,
+		CreatedAt:  t.CreatedAt,
+		ExpiresAt:  t.ExpiresAt,
+		RevokedAt:  t.RevokedAt,
+	}
+}
+
+func apiDigest2DBDigest(d DigestSettings) store.DigestSettings {
+	t, _ := time.Parse(digestTimeLayout, d.Time) //validated already
+
+	return store.DigestSettings{
+		UserUUID:   d.UserUUID,
+		Enabled:    d.Enabled,
+		Minute:     t.Hour()*60 + t.Minute(),
+		Timezone:   d.Timezone,
+		Channel:    d.Channel,
+		WebhookURL: d.WebhookURL,
+		WithinDays: d.WithinDays,
+	}
+}
+
+func dbDigest2ApiDigest(d *store.DigestSettings) DigestSettings {
+	return DigestSettings{
+		UserUUID:   d.UserUUID,
+		Enabled:    d.Enabled,
+		Time:       fmt.Sprintf("%02d:%02d", d.Minute/60, d.Minute%60),
+		Timezone:   d.Timezone,
+		Channel:    d.Channel,
+		WebhookURL: d.WebhookURL,
+		WithinDays: d.WithinDays,
+	}
+}
@@ -0,0 +1,215 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"sort"
+	"wdiet/store"
+	"wdiet/units"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// CookRecipe takes everything the recipe uses out of the caller's fridge, from the lots that go off first, and logs
+// that it got cooked. If the fridge is short of anything nothing changes and the answer is a 409 with the shortfalls.
+// A dry run only answers with what cooking would do, viewers can do that too.
+func (s *Service) CookRecipe(c *gin.Context) {
+	l := s.l.Named("CookRecipe")
+
+	id := c.Param("id")
+
+	rid, err := uuid.Parse(id)
+	if err != nil {
+		l.Info("error cooking recipe", zap.Error(err))
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	var cookRequest CookRequest
+
+	if err := json.NewDecoder(c.Request.Body).Decode(&cookRequest); err != nil {
+		l.Info("error cooking recipe", zap.Error(err))
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	if !isValidCookRequest(cookRequest) {
+		l.Info("error cooking recipe")
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	if cookRequest.Servings == 0 {
+		cookRequest.Servings = 1
+	}
+
+	if !isOwner(c, cookRequest.UserUUID) {
+		l.Info("error cooking recipe, forbidden")
+		c.Status(http.StatusForbidden)
+		return
+	}
+
+	recipe, err := s.db.GetRecipe(context.Background(), rid)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			l.Info("error cooking recipe", zap.Error(err))
+			c.Status(http.StatusNotFound)
+			return
+		}
+		l.Error("error cooking recipe", zap.Error(err))
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	household, ok := s.activeHousehold(c, l, cookRequest.UserUUID)
+	if !ok {
+		return
+	}
+
+	if !cookRequest.DryRun && !canChangeFridge(household) {
+		l.Info("error cooking recipe, viewer")
+		c.Status(http.StatusForbidden)
+		return
+	}
+
+	fridge, err := s.db.ListFridgeIngredients(context.Background(), household.HouseholdUUID)
+	if err != nil {
+		l.Error("error cooking recipe", zap.Error(err))
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	densities, err := s.densities(recipe.Ingredients, fridge)
+	if err != nil {
+		l.Error("error cooking recipe", zap.Error(err))
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	result := CookResult{
+		RecipeUUID: recipe.RecipeUUID,
+		RecipeName: recipe.RecipeName,
+		Servings:   cookRequest.Servings,
+		DryRun:     cookRequest.DryRun,
+	}
+	result.Deductions, result.Shortfalls = planCook(recipe.Ingredients, cookRequest.Servings, fridge, densities)
+
+	if cookRequest.DryRun {
+		amountsJSON(c, http.StatusOK, result)
+		return
+	}
+
+	if len(result.Shortfalls) > 0 {
+		l.Info("error cooking recipe, not enough in the fridge")
+		amountsJSON(c, http.StatusConflict, result)
+		return
+	}
+
+	cookLog, err := s.db.CookRecipe(context.Background(), store.CookLog{
+		HouseholdUUID: household.HouseholdUUID,
+		UserUUID:      cookRequest.UserUUID,
+		RecipeUUID:    recipe.RecipeUUID,
+		RecipeName:    recipe.RecipeName,
+		Servings:      cookRequest.Servings,
+	}, apiDeductions2DBDeductions(result.Deductions))
+	if err != nil {
+		if errors.Is(err, store.ErrConflict) { //the fridge changed since we listed it, cooking again works it out anew
+			l.Info("error cooking recipe", zap.Error(err))
+			c.Status(http.StatusConflict)
+			return
+		}
+		l.Error("error cooking recipe", zap.Error(err))
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	result.CookLogUUID = cookLog.CookLogUUID
+	result.CookedAt = &cookLog.CreatedAt
+
+	amountsJSON(c, http.StatusOK, result)
+}
+
+// planCook works out what cooking the recipe ingredients servings times takes out of which lots of the fridge, oldest
+// expiry first, and what the fridge is short of. densities are what the units package needs to go between mass and
+// volume, by ingredient.
+func planCook(ingredients []store.RecipeIngredient, servings float64, fridge []store.FridgeIngredient, densities map[uuid.UUID]float64) ([]CookDeduction, []MissingIngredient) {
+	lots := make([]store.FridgeIngredient, len(fridge))
+	copy(lots, fridge)
+	sort.SliceStable(lots, func(i, j int) bool {
+		return lots[i].ExpirationDate.Before(lots[j].ExpirationDate)
+	})
+
+	var deductions []CookDeduction
+	var shortfalls []MissingIngredient
+
+	for _, ingr := range ingredients {
+		amount := units.NewAmount(new(big.Rat).Mul(ingr.Amount.Rat(), new(big.Rat).SetFloat64(servings)))
+
+		var ingrLots []store.FridgeIngredient
+		for _, lot := range lots {
+			if lot.IngredientUUID == ingr.IngredientUUID {
+				ingrLots = append(ingrLots, lot)
+			}
+		}
+
+		taken, short := store.TakeFromLots(ingrLots, amount, ingr.Unit, densities[ingr.IngredientUUID])
+
+		for _, d := range taken {
+			deductions = append(deductions, CookDeduction{
+				FridgeItemUUID: d.FridgeItemUUID,
+				IngredientUUID: ingr.IngredientUUID,
+				Amount:         d.Amount,
+				Unit:           d.Unit,
+				AmountLeft:     d.LeftAmount,
+				UnitLeft:       d.LeftUnit,
+			})
+		}
+
+		if short.Sign() > 0 {
+			shortfalls = append(shortfalls, MissingIngredient{
+				IngredientUUID: ingr.IngredientUUID,
+				Amount:         amount,
+				AmountShort:    short, //in the recipe's unit
+				Unit:           ingr.Unit,
+			})
+		}
+	}
+
+	return deductions, shortfalls
+}
+
+// densities gets the density of the ingredients the fridge has in another kind of unit than the recipe asks for, say
+// flour in grams for a recipe in cups. Everything else converts without one.
+func (s *Service) densities(ingredients []store.RecipeIngredient, fridge []store.FridgeIngredient) (map[uuid.UUID]float64, error) {
+	densities := map[uuid.UUID]float64{}
+
+	for _, ingr := range ingredients {
+		u, err := units.Parse(ingr.Unit)
+		if err != nil {
+			continue
+		}
+
+		for _, lot := range fridge {
+			if lot.IngredientUUID != ingr.IngredientUUID {
+				continue
+			}
+			if lu, err := units.Parse(lot.Unit); err != nil || lu.Kind == u.Kind {
+				continue
+			}
+
+			ingredient, err := s.db.GetIngredient(context.Background(), ingr.IngredientUUID)
+			if err != nil {
+				return nil, err
+			}
+			densities[ingr.IngredientUUID] = ingredient.Density
+			break
+		}
+	}
+
+	return densities, nil
+}
@@ -0,0 +1,377 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	_ "time/tzdata" //users pick their timezone, and the container doesn't have to ship a zoneinfo for that
+	"wdiet/notifier"
+	"wdiet/store"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+const (
+	digestInterval       = time.Minute //how often we look for digests that are due
+	digestTimeLayout     = "15:04"
+	digestDayLayout      = "2006-01-02"
+	digestChannelEmail   = "email"
+	digestChannelWebhook = "webhook"
+
+	defaultDigestTime       = "08:00"
+	defaultDigestTimezone   = "UTC"
+	defaultDigestWithinDays = 3
+	maxDigestWithinDays     = 30
+
+	maxExpiringWithin = 90 * 24 * time.Hour
+)
+
+// parseWithin parses how far ahead to look for things that go off, days like 3d or a duration like 12h.
+func parseWithin(s string) (time.Duration, bool) {
+	var within time.Duration
+
+	if days := strings.TrimSuffix(s, "d"); days != s {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, false
+		}
+		within = time.Duration(n) * 24 * time.Hour
+	} else {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return 0, false
+		}
+		within = d
+	}
+
+	return within, within > 0 && within <= maxExpiringWithin
+}
+
+// expiringLots is the lots that have gone off or go off by until, soonest first.
+func expiringLots(lots []store.FridgeIngredient, until time.Time) []store.FridgeIngredient {
+	var expiring []store.FridgeIngredient
+
+	for _, lot := range lots {
+		if !lot.ExpirationDate.After(until) {
+			expiring = append(expiring, lot)
+		}
+	}
+
+	sort.SliceStable(expiring, func(i, j int) bool {
+		return expiring[i].ExpirationDate.Before(expiring[j].ExpirationDate)
+	})
+
+	return expiring
+}
+
+// ListExpiringFridgeIngredients lists the lots in the fridge that go off within ?within=, 3d if it's not there, soonest
+// first. What has gone off already is in it too, it's the first thing to deal with.
+func (s *Service) ListExpiringFridgeIngredients(c *gin.Context) {
+	l := s.l.Named("ListExpiringFridgeIngredients")
+
+	uid, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		l.Info("error listing expiring fridge ingredients", zap.Error(err))
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	var options ExpiringOptions
+
+	if err := c.ShouldBindQuery(&options); err != nil {
+		l.Info("error listing expiring fridge ingredients", zap.Error(err))
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	if !isValidExpiringOptions(options) {
+		l.Info("error listing expiring fridge ingredients")
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	if !isOwner(c, uid) {
+		l.Info("error listing expiring fridge ingredients, forbidden")
+		c.Status(http.StatusForbidden)
+		return
+	}
+
+	household, ok := s.activeHousehold(c, l, uid)
+	if !ok {
+		return
+	}
+
+	lots, err := s.db.ListFridgeIngredients(context.Background(), household.HouseholdUUID)
+	if err != nil {
+		l.Error("error listing expiring fridge ingredients", zap.Error(err))
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	within, _ := parseWithin(options.Within)
+
+	expiring := expiringLots(lots, s.now().Add(within))
+	if len(expiring) == 0 {
+		c.Status(http.StatusOK)
+		return
+	}
+
+	var expiringResponse []FridgeIngredient
+
+	for _, f := range expiring {
+		expiringResponse = append(expiringResponse, dbFIngr2ApiFIngr(&f))
+	}
+
+	amountsJSON(c, http.StatusOK, expiringResponse)
+}
+
+// withDigestDefaults fills in what d leaves out.
+func withDigestDefaults(d DigestSettings) DigestSettings {
+	if d.Time == "" {
+		d.Time = defaultDigestTime
+	}
+	if d.Timezone == "" {
+		d.Timezone = defaultDigestTimezone
+	}
+	if d.Channel == "" {
+		d.Channel = digestChannelEmail
+	}
+	if d.WithinDays == 0 {
+		d.WithinDays = defaultDigestWithinDays
+	}
+	return d
+}
+
+// GetDigestSettings gets when and how user id gets their digest. Somebody who never set it gets the defaults, turned off.
+func (s *Service) GetDigestSettings(c *gin.Context) {
+	l := s.l.Named("GetDigestSettings")
+
+	uid, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		l.Info("error getting digest settings", zap.Error(err))
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	if !isOwner(c, uid) {
+		l.Info("error getting digest settings, forbidden")
+		c.Status(http.StatusForbidden)
+		return
+	}
+
+	settings, err := s.db.GetDigestSettings(context.Background(), uid)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			c.JSON(http.StatusOK, withDigestDefaults(DigestSettings{UserUUID: uid}))
+			return
+		}
+		l.Error("error getting digest settings", zap.Error(err))
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(http.StatusOK, dbDigest2ApiDigest(settings))
+}
+
+// SetDigestSettings sets when and how user id gets their digest. Changing the time doesn't send today's again if it's
+// been sent already.
+func (s *Service) SetDigestSettings(c *gin.Context) {
+	l := s.l.Named("SetDigestSettings")
+
+	uid, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		l.Info("error setting digest settings", zap.Error(err))
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	var settingsRequest DigestSettings
+
+	if err := json.NewDecoder(c.Request.Body).Decode(&settingsRequest); err != nil {
+		l.Info("error setting digest settings", zap.Error(err))
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	settingsRequest = withDigestDefaults(settingsRequest)
+
+	if !isValidDigestSettingsRequest(settingsRequest, uid) {
+		l.Info("error setting digest settings")
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	if _, ok := s.digestChannels[settingsRequest.Channel]; !ok { //this deployment doesn't send them that way
+		l.Info("error setting digest settings, unknown channel", zap.String("channel", settingsRequest.Channel))
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	if !isOwner(c, uid) {
+		l.Info("error setting digest settings, forbidden")
+		c.Status(http.StatusForbidden)
+		return
+	}
+
+	settings, err := s.db.SetDigestSettings(context.Background(), apiDigest2DBDigest(settingsRequest))
+	if err != nil {
+		l.Error("error setting digest settings", zap.Error(err))
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(http.StatusOK, dbDigest2ApiDigest(settings))
+}
+
+// digestDue tells if d's digest is due at now: it's past the digest time where the user is, and the digest for their
+// day hasn't been sent. day is that day, midnight UTC.
+func digestDue(d store.DigestSettings, now time.Time) (day time.Time, due bool) {
+	loc, err := time.LoadLocation(d.Timezone)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	local := now.In(loc)
+	day = time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, time.UTC)
+
+	if local.Hour()*60+local.Minute() < d.Minute {
+		return day, false
+	}
+
+	return day, d.LastSentOn == nil || d.LastSentOn.Before(day)
+}
+
+// sendDigestsEvery runs sendDigests every interval until ctx is done.
+func (s *Service) sendDigestsEvery(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		s.sendDigests(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// sendDigests sends the digests that are due. A digest is claimed before it's sent, so with several instances
+// everyone gets one a day, and a digest that fails to send isn't tried again until the next day. Nothing about to go
+// off is no digest. It returns how many it sent.
+func (s *Service) sendDigests(ctx context.Context) int {
+	l := s.l.Named("sendDigests")
+
+	if len(s.digestChannels) == 0 {
+		return 0
+	}
+
+	settings, err := s.db.ListEnabledDigestSettings(ctx)
+	if err != nil {
+		l.Error("error listing digest settings", zap.Error(err))
+		return 0
+	}
+
+	now := s.now()
+	sent := 0
+
+	for _, d := range settings {
+		day, due := digestDue(d, now)
+		if !due {
+			continue
+		}
+
+		channel, ok := s.digestChannels[d.Channel]
+		if !ok {
+			l.Error("error sending digest, unknown channel", zap.String("user_uuid", d.UserUUID.String()), zap.String("channel", d.Channel))
+			continue
+		}
+
+		claimed, err := s.db.ClaimDigest(ctx, d.UserUUID, day)
+		if err != nil {
+			l.Error("error claiming digest", zap.String("user_uuid", d.UserUUID.String()), zap.Error(err))
+			continue
+		}
+		if !claimed { //another instance got there first
+			continue
+		}
+
+		digest, err := s.digest(ctx, d, day, now)
+		if err != nil {
+			l.Error("error making digest", zap.String("user_uuid", d.UserUUID.String()), zap.Error(err))
+			continue
+		}
+		if len(digest.Items) == 0 {
+			continue
+		}
+
+		if err := channel.Send(ctx, digest); err != nil {
+			l.Error("error sending digest", zap.String("user_uuid", d.UserUUID.String()), zap.Error(err))
+			continue
+		}
+		sent++
+	}
+
+	return sent
+}
+
+// digest is d's user's digest for day: what in their active household's fridge goes off within d.WithinDays of now.
+func (s *Service) digest(ctx context.Context, d store.DigestSettings, day, now time.Time) (notifier.Digest, error) {
+	user, err := s.db.GetUser(ctx, d.UserUUID)
+	if err != nil {
+		return notifier.Digest{}, err
+	}
+
+	digest := notifier.Digest{
+		UserUUID:     d.UserUUID,
+		FirstName:    user.FirstName,
+		EmailAddress: user.EmailAddress,
+		WebhookURL:   d.WebhookURL,
+		Day:          day.Format(digestDayLayout),
+	}
+
+	household, err := s.db.GetActiveHousehold(ctx, d.UserUUID)
+	if errors.Is(err, store.ErrNotFound) { //no fridge, nothing in it
+		return digest, nil
+	}
+	if err != nil {
+		return notifier.Digest{}, err
+	}
+
+	lots, err := s.db.ListFridgeIngredients(ctx, household.HouseholdUUID)
+	if err != nil {
+		return notifier.Digest{}, err
+	}
+
+	names := make(map[uuid.UUID]string)
+
+	for _, lot := range expiringLots(lots, now.AddDate(0, 0, d.WithinDays)) {
+		if _, ok := names[lot.IngredientUUID]; !ok {
+			ingredient, err := s.db.GetIngredient(ctx, lot.IngredientUUID)
+			if err != nil {
+				return notifier.Digest{}, err
+			}
+			names[lot.IngredientUUID] = ingredient.IngredientName
+		}
+
+		digest.Items = append(digest.Items, notifier.DigestItem{
+			FridgeItemUUID: lot.FridgeItemUUID,
+			IngredientUUID: lot.IngredientUUID,
+			IngredientName: names[lot.IngredientUUID],
+			Amount:         lot.Amount,
+			Unit:           lot.Unit,
+			Location:       lot.Location,
+			ExpirationDate: lot.ExpirationDate,
+		})
+	}
+
+	return digest, nil
+}
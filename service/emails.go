@@ -0,0 +1,92 @@
+package service
+
+import (
+	"fmt"
+	"html/template"
+	"net/url"
+	"wdiet/mailer"
+)
+
+func passwordResetMessage(to, publicURL, token string) mailer.Message {
+	link := publicURL + "/password_reset/confirm?token=" + url.QueryEscape(token)
+
+	return mailer.Message{
+		To:      to,
+		Subject: "Reset your What Do I Eat Today password",
+		Body: fmt.Sprintf(`Somebody (hopefully you) asked to reset your password.
+
+Open the link to set a new one, or use the token with POST /password_reset/confirm. It works once and expires in %d minutes:
+
+%s
+
+%s
+
+If you didn't ask for this, ignore this mail and your password stays the same.`, int(passwordResetTTL.Minutes()), token, link),
+	}
+}
+
+// passwordResetPage is what the link in passwordResetMessage opens: a form that posts the token and the new password
+// to POST /password_reset/confirm. The token only gets checked there.
+var passwordResetPage = template.Must(template.New("passwordReset").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Reset your What Do I Eat Today password</title>
+</head>
+<body>
+<form id="reset">
+<input type="hidden" name="token" value="{{.}}">
+<label>New password <input type="password" name="new_password" autocomplete="new-password" required></label>
+<button type="submit">Set password</button>
+</form>
+<p id="result"></p>
+<script>
+document.getElementById("reset").addEventListener("submit", async function (e) {
+	e.preventDefault();
+	const res = await fetch(location.pathname, {
+		method: "POST",
+		headers: {"Content-Type": "application/json"},
+		body: JSON.stringify({token: this.token.value, new_password: this.new_password.value}),
+	});
+	document.getElementById("result").textContent = res.ok
+		? "Your password is changed, log in with the new one."
+		: "That didn't work. The password might be too weak, or the link used or expired.";
+});
+</script>
+</body>
+</html>
+`))
+
+func verificationMessage(to, publicURL, token string) mailer.Message {
+	link := publicURL + "/users/verify?token=" + url.QueryEscape(token)
+
+	return mailer.Message{
+		To:      to,
+		Subject: "Verify your What Do I Eat Today email address",
+		Body: fmt.Sprintf(`Welcome! Open this link to verify your email address, it expires in %d hours:
+
+%s
+
+Until then you can only look at and edit your account.
+
+If you didn't sign up, ignore this mail.`, int(emailVerificationTTL.Hours()), link),
+	}
+}
+
+func householdInvitationMessage(to, publicURL, inviter, household, token string) mailer.Message {
+	link := publicURL + "/household_invitations/accept?token=" + url.QueryEscape(token)
+
+	return mailer.Message{
+		To:      to,
+		Subject: inviter + " invited you to share a fridge on What Do I Eat Today",
+		Body: fmt.Sprintf(`%s invited you to join %q and share its fridge.
+
+Log in with this email address and use this token to join, it works once and expires in %d days:
+
+%s
+
+%s
+
+If you don't know %s, ignore this mail.`, inviter, household, int(householdInvitationTTL.Hours()/24), token, link, inviter),
+	}
+}
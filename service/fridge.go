@@ -0,0 +1,301 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+	"wdiet/shelflife"
+	"wdiet/store"
+	"wdiet/units"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// ConsumeFridgeIngredient takes some of the ingredient iid out of user id's fridge, from the lots that go off first. Lots
+// that run out are removed. Asking for more than the fridge has is a 409 and nothing changes. The answer is what's left.
+func (s *Service) ConsumeFridgeIngredient(c *gin.Context) {
+	l := s.l.Named("ConsumeFridgeIngredient")
+
+	id := c.Param("id")
+	id2 := c.Param("iid")
+
+	uid, err := uuid.Parse(id)
+	if err != nil {
+		l.Info("error consuming fridge ingredient", zap.Error(err))
+		c.Status(http.StatusBadRequest)
+		return
+	}
+	iid, err := uuid.Parse(id2)
+	if err != nil {
+		l.Info("error consuming fridge ingredient", zap.Error(err))
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	var consumeRequest ConsumeFridgeIngredient
+
+	if err := json.NewDecoder(c.Request.Body).Decode(&consumeRequest); err != nil {
+		l.Info("error consuming fridge ingredient", zap.Error(err))
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	if !isValidConsumeFIngrRequest(consumeRequest) {
+		l.Info("error consuming fridge ingredient")
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	if !isOwner(c, uid) {
+		l.Info("error consuming fridge ingredient, forbidden")
+		c.Status(http.StatusForbidden)
+		return
+	}
+
+	household, ok := s.activeHousehold(c, l, uid)
+	if !ok {
+		return
+	}
+
+	if !canChangeFridge(household) {
+		l.Info("error consuming fridge ingredient, viewer")
+		c.Status(http.StatusForbidden)
+		return
+	}
+
+	left, err := s.db.ConsumeFridgeIngredient(context.Background(), household.HouseholdUUID, iid, uid, consumeRequest.Amount, units.Canonical(consumeRequest.Unit))
+	if err != nil {
+		if errors.Is(err, store.ErrNotEnough) {
+			l.Info("error consuming fridge ingredient", zap.Error(err))
+			c.Status(http.StatusConflict)
+			return
+		}
+		l.Error("error consuming fridge ingredient", zap.Error(err))
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	if len(left) == 0 {
+		c.Status(http.StatusOK)
+		return
+	}
+
+	var consumeResponse []FridgeIngredient
+
+	for _, f := range left {
+		consumeResponse = append(consumeResponse, dbFIngr2ApiFIngr(&f))
+	}
+
+	amountsJSON(c, http.StatusOK, consumeResponse)
+}
+
+// MoveFridgeIngredient moves the lot id to another location, the freezer or the pantry or back to the fridge. It keeps
+// the share of its shelf life it had left, see the shelflife package.
+func (s *Service) MoveFridgeIngredient(c *gin.Context) {
+	l := s.l.Named("MoveFridgeIngredient")
+
+	fid, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		l.Info("error moving fridge ingredient", zap.Error(err))
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	var moveRequest MoveFridgeIngredient
+
+	if err := json.NewDecoder(c.Request.Body).Decode(&moveRequest); err != nil {
+		l.Info("error moving fridge ingredient", zap.Error(err))
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	if !isValidMoveFIngrRequest(moveRequest) {
+		l.Info("error moving fridge ingredient")
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	at := s.now()
+	if moveRequest.MovedAt != nil {
+		at = *moveRequest.MovedAt
+	}
+
+	lot, life, ok := s.fridgeLot(c, l, moveRequest.UserUUID, fid, at)
+	if !ok {
+		return
+	}
+
+	to := shelflife.Location(moveRequest.Location)
+
+	moved := *lot
+	moved.ExpirationDate = shelflife.Move(life, lot.ExpirationDate, shelflife.Location(lot.Location), to, at, lot.OpenedDate != nil)
+	moved.Location = string(to)
+
+	s.setFridgeLotStorage(c, l, lot, &moved, moveRequest.UserUUID, store.FridgeEventTypeMove)
+}
+
+// OpenFridgeIngredient opens the lot id. Opened, it might go off sooner, see the shelflife package. A lot only gets
+// opened once, opening it again is a 409.
+func (s *Service) OpenFridgeIngredient(c *gin.Context) {
+	l := s.l.Named("OpenFridgeIngredient")
+
+	fid, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		l.Info("error opening fridge ingredient", zap.Error(err))
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	var openRequest OpenFridgeIngredient
+
+	if err := json.NewDecoder(c.Request.Body).Decode(&openRequest); err != nil {
+		l.Info("error opening fridge ingredient", zap.Error(err))
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	if !isValidOpenFIngrRequest(openRequest) {
+		l.Info("error opening fridge ingredient")
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	at := s.now()
+	if openRequest.OpenedAt != nil {
+		at = *openRequest.OpenedAt
+	}
+
+	lot, life, ok := s.fridgeLot(c, l, openRequest.UserUUID, fid, at)
+	if !ok {
+		return
+	}
+
+	if lot.OpenedDate != nil {
+		l.Info("error opening fridge ingredient, already opened")
+		c.Status(http.StatusConflict)
+		return
+	}
+
+	opened := *lot
+	opened.ExpirationDate = shelflife.Open(life, lot.ExpirationDate, shelflife.Location(lot.Location), at)
+	opened.OpenedDate = &at
+
+	s.setFridgeLotStorage(c, l, lot, &opened, openRequest.UserUUID, store.FridgeEventTypeOpen)
+}
+
+// updatedExpiry is when lot goes off once it's updated to f. Only what changes changes the expiry, so what a move or an
+// open did to it isn't lost when somebody fixes the amount. A different ingredient, or an opened date that changes or
+// goes away, is a correction we can't apply on top of the old expiry, that one's worked out from scratch as if the lot's
+// been where it is since it was bought.
+func updatedExpiry(life shelflife.Life, lot *store.FridgeIngredient, f FridgeIngredient, now time.Time) time.Time {
+	from, to := shelflife.Location(lot.Location), shelflife.Location(f.Location)
+
+	if f.IngredientUUID != lot.IngredientUUID || (lot.OpenedDate != nil && (f.OpenedDate == nil || !f.OpenedDate.Equal(*lot.OpenedDate))) {
+		var opened time.Time
+		if f.OpenedDate != nil {
+			opened = *f.OpenedDate
+		}
+		return shelflife.Expiry(life, f.PurchasedDate, to, opened)
+	}
+
+	expiry := lot.ExpirationDate
+
+	if shift := f.PurchasedDate.Sub(lot.PurchasedDate); shift != 0 { //bought another day, it goes off that much earlier or later
+		expiry = expiry.Add(shift)
+		if lot.OpenedDate != nil { //but not later than opening lets it
+			expiry = shelflife.Open(life, expiry, from, *lot.OpenedDate)
+		}
+	}
+
+	if from != to {
+		expiry = shelflife.Move(life, expiry, from, to, now, lot.OpenedDate != nil)
+	}
+
+	if lot.OpenedDate == nil && f.OpenedDate != nil {
+		expiry = shelflife.Open(life, expiry, to, *f.OpenedDate)
+	}
+
+	return expiry
+}
+
+// fridgeLot gets the lot fid out of uid's active household's fridge and its ingredient's shelf life, for something
+// that happens to it at at, some time between when it was bought and now. If it returns false it already answered the
+// request.
+func (s *Service) fridgeLot(c *gin.Context, l *zap.Logger, uid, fid uuid.UUID, at time.Time) (*store.FridgeIngredient, shelflife.Life, bool) {
+	if !isOwner(c, uid) {
+		l.Info("error changing fridge ingredient, forbidden")
+		c.Status(http.StatusForbidden)
+		return nil, shelflife.Life{}, false
+	}
+
+	if at.After(s.now()) { //it hasn't happened yet
+		l.Info("error changing fridge ingredient, in the future")
+		c.Status(http.StatusBadRequest)
+		return nil, shelflife.Life{}, false
+	}
+
+	household, ok := s.activeHousehold(c, l, uid)
+	if !ok {
+		return nil, shelflife.Life{}, false
+	}
+
+	if !canChangeFridge(household) {
+		l.Info("error changing fridge ingredient, viewer")
+		c.Status(http.StatusForbidden)
+		return nil, shelflife.Life{}, false
+	}
+
+	lot, err := s.db.GetFridgeIngredient(context.Background(), household.HouseholdUUID, fid)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			l.Info("error changing fridge ingredient", zap.Error(err))
+			c.Status(http.StatusNotFound)
+			return nil, shelflife.Life{}, false
+		}
+		l.Error("error changing fridge ingredient", zap.Error(err))
+		c.Status(http.StatusInternalServerError)
+		return nil, shelflife.Life{}, false
+	}
+
+	if at.Before(lot.PurchasedDate) { //it wasn't here yet
+		l.Info("error changing fridge ingredient, before it was bought")
+		c.Status(http.StatusBadRequest)
+		return nil, shelflife.Life{}, false
+	}
+
+	ingredient, err := s.db.GetIngredient(context.Background(), lot.IngredientUUID)
+	if err != nil {
+		l.Error("error changing fridge ingredient", zap.Error(err))
+		c.Status(http.StatusInternalServerError)
+		return nil, shelflife.Life{}, false
+	}
+
+	return lot, dbIngr2Life(ingredient), true
+}
+
+// setFridgeLotStorage writes where lot is, when it was opened and when it goes off, as uid's eventType, and answers
+// with it. was is the lot as fridgeLot got it, if somebody moved or opened it since, it's a 409 and they can try again.
+func (s *Service) setFridgeLotStorage(c *gin.Context, l *zap.Logger, was, lot *store.FridgeIngredient, uid uuid.UUID, eventType string) {
+	fridgeIngredient, err := s.db.SetFridgeIngredientStorage(context.Background(), *was, *lot, uid, eventType)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			l.Info("error changing fridge ingredient", zap.Error(err))
+			c.Status(http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, store.ErrConflict) {
+			l.Info("error changing fridge ingredient", zap.Error(err))
+			c.Status(http.StatusConflict)
+			return
+		}
+		l.Error("error changing fridge ingredient", zap.Error(err))
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	amountsJSON(c, http.StatusOK, dbFIngr2ApiFIngr(fridgeIngredient))
+}
@@ -1,20 +1,25 @@
 package service
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
-	"fmt"
+	"io"
+	"math"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
+	"wdiet/lockout"
+	"wdiet/shelflife"
 	"wdiet/store"
+	"wdiet/totp"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v4"
 	"github.com/google/uuid"
 	"go.uber.org/zap"
-	"golang.org/x/crypto/bcrypt"
 )
 
 func (s *Service) Ping(c *gin.Context) {
@@ -48,182 +53,1819 @@ func (s *Service) Login(c *gin.Context) {
 		return
 	}
 
-	user, err := s.db.GetUserByEmail(context.Background(), loginRequest.EmailAddress)
+	user, ok := s.checkCredentials(c, l, loginRequest.EmailAddress, loginRequest.Password)
+	if !ok {
+		return
+	}
+
+	if !user.Active {
+		l.Info("error logging in, user is deactivated")
+		c.Status(http.StatusForbidden)
+		return
+	}
+
+	if s.hasher.NeedsRehash(user.HashedPassword) { //login is the only time we see the plain password, so this is where old hashes get upgraded
+		s.rehashPassword(l, user, loginRequest.Password)
+	}
+
+	s.finishLogin(c, l, user)
+}
+
+// finishLogin is the end of every first factor, the password or a provider. It asks for the second factor if the user
+// has one, otherwise logs them in.
+func (s *Service) finishLogin(c *gin.Context, l *zap.Logger, user *store.User) {
+	enrolment, err := s.db.GetTOTP(context.Background(), user.UserUUID)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		l.Error("error getting totp", zap.Error(err))
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	if enrolment != nil && enrolment.EnabledAt != nil { //the first factor was step one, POST /login/2fa is step two
+		if s.throttled(c, l, user.EmailAddress) { //wrong codes count against the account, a new challenge doesn't start over
+			return
+		}
+
+		challenge, err := newOpaqueToken()
+		if err != nil {
+			l.Error("error creating login challenge", zap.Error(err))
+			c.Status(http.StatusInternalServerError)
+			return
+		}
+
+		created, err := s.db.CreateLoginChallenge(context.Background(), store.LoginChallenge{
+			UserUUID:    user.UserUUID,
+			HashedToken: hashToken(challenge),
+			ExpiresAt:   s.now().Add(loginChallengeTTL),
+		})
+		if err != nil {
+			l.Error("error creating login challenge", zap.Error(err))
+			c.Status(http.StatusInternalServerError)
+			return
+		}
+
+		c.JSON(http.StatusOK, TwoFactorChallenge{TwoFactorRequired: true, ChallengeToken: challenge, ExpiresAt: created.ExpiresAt})
+		return
+	}
+
+	s.issueSession(c, l, user)
+}
+
+// issueSession is the end of a successful login, a new access token and a new refresh token family for user.
+func (s *Service) issueSession(c *gin.Context, l *zap.Logger, user *store.User) {
+	if err := s.lockout.Succeed(context.Background(), user.EmailAddress); err != nil { //only now, a right password alone doesn't forget wrong codes
+		l.Error("error resetting login attempts", zap.Error(err))
+	}
+
+	signedToken, err := s.signAccessToken(user.UserUUID, user.Role, true)
+	if err != nil {
+		l.Error("error signing the token", zap.Error(err))
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	refreshToken, err := s.issueRefreshToken(context.Background(), user.UserUUID, uuid.New(), nil) //every login starts a new family
+	if err != nil {
+		l.Error("error creating refresh token", zap.Error(err))
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(http.StatusOK, Token{Token: signedToken, RefreshToken: refreshToken})
+}
+
+// LoginTwoFactor swaps the challenge token from Login and a code from the user's authenticator app, or one of their
+// recovery codes, for the real tokens.
+func (s *Service) LoginTwoFactor(c *gin.Context) {
+	l := s.l.Named("LoginTwoFactor")
+
+	var twoFactorRequest TwoFactorLogin
+
+	if err := json.NewDecoder(c.Request.Body).Decode(&twoFactorRequest); err != nil {
+		l.Info("error logging in", zap.Error(err))
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	if !isValidTwoFactorLoginRequest(twoFactorRequest) {
+		l.Info("error logging in")
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	challenge, err := s.db.AttemptLoginChallenge(context.Background(), hashToken(twoFactorRequest.ChallengeToken))
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			l.Info("error logging in, unknown challenge", zap.Error(err))
+			c.Status(http.StatusUnauthorized)
+			return
+		}
+		l.Error("error logging in", zap.Error(err))
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	if s.now().After(challenge.ExpiresAt) || challenge.Attempts > loginChallengeRetries {
+		l.Info("error logging in, challenge expired or out of attempts", zap.Int("attempts", challenge.Attempts))
+		c.Status(http.StatusUnauthorized)
+		return
+	}
+
+	user, err := s.db.GetUser(context.Background(), challenge.UserUUID)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			l.Info("error logging in", zap.Error(err))
+			c.Status(http.StatusUnauthorized)
+			return
+		}
+		l.Error("error logging in", zap.Error(err))
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	if s.throttled(c, l, user.EmailAddress) {
+		return
+	}
+
+	ok, err := s.checkSecondFactor(challenge.UserUUID, twoFactorRequest.Code)
+	if err != nil {
+		l.Error("error logging in", zap.Error(err))
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		l.Info("error logging in, wrong code")
+		s.failLogin(l, user.EmailAddress, c.ClientIP()) //the challenge's own retries don't stop anyone who knows the password, they'd just log in again
+		c.Status(http.StatusUnauthorized)
+		return
+	}
+
+	if err := s.db.UseLoginChallenge(context.Background(), challenge.LoginChallengeUUID); err != nil {
+		if errors.Is(err, store.ErrRevoked) { //used in the meantime by somebody else with the same challenge
+			l.Warn("error logging in, challenge used twice", zap.String("user_uuid", challenge.UserUUID.String()))
+			c.Status(http.StatusUnauthorized)
+			return
+		}
+		l.Error("error logging in", zap.Error(err))
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	if !user.Active { //deactivated between the two steps
+		l.Info("error logging in, user is deactivated")
+		c.Status(http.StatusForbidden)
+		return
+	}
+
+	s.issueSession(c, l, user)
+}
+
+// checkSecondFactor tells if code is a current authenticator code or an unused recovery code for uid, and uses it up.
+func (s *Service) checkSecondFactor(uid uuid.UUID, code string) (bool, error) {
+	enrolment, err := s.db.GetTOTP(context.Background(), uid)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) { //turned off since the password step
+			return false, nil
+		}
+		return false, err
+	}
+	if enrolment.EnabledAt == nil {
+		return false, nil
+	}
+
+	if step, ok := totp.Verify(enrolment.Secret, code, s.now(), 1); ok {
+		return s.db.UseTOTPStep(context.Background(), uid, step) //false if the code was already used
+	}
+
+	if err := s.db.UseRecoveryCode(context.Background(), uid, hashRecoveryCode(code)); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return true, nil
+}
+
+// throttled tells if email or the client's IP has to wait before trying again. On true it has written the response
+// already.
+func (s *Service) throttled(c *gin.Context, l *zap.Logger, email string) bool {
+	wait, err := s.lockout.Check(context.Background(), email, c.ClientIP())
+	if err != nil {
+		l.Error("error checking login attempts", zap.Error(err))
+		c.Status(http.StatusInternalServerError)
+		return true
+	}
+	if wait > 0 {
+		l.Info("error logging in, too many attempts", zap.Duration("wait", wait))
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		c.Status(http.StatusTooManyRequests)
+		return true
+	}
+
+	return false
+}
+
+// failLogin counts a wrong password or second factor against email and ip.
+func (s *Service) failLogin(l *zap.Logger, email, ip string) {
+	events, err := s.lockout.Fail(context.Background(), email, ip)
+	if err != nil {
+		l.Error("error recording login attempt", zap.Error(err))
+	}
+	for _, e := range events {
+		s.recordLockout(l, e)
+	}
+}
+
+// checkCredentials is the password check shared by everything that logs a user in. It throttles guessing per account and
+// per IP, and unknown emails and wrong passwords look the same from outside, same status and about the same time.
+// The account's failures are only forgotten once a login is done, see issueSession. On false it has written the response
+// already.
+func (s *Service) checkCredentials(c *gin.Context, l *zap.Logger, email, password string) (*store.User, bool) {
+	if s.throttled(c, l, email) {
+		return nil, false
+	}
+
+	user, err := s.db.GetUserByEmail(context.Background(), email)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		l.Error("error logging in", zap.Error(err))
+		c.Status(http.StatusInternalServerError)
+		return nil, false
+	}
+
+	hash := s.dummyHash //no user, still hash something so the response takes as long as a wrong password does
+	if user != nil {
+		hash = user.HashedPassword
+	}
+
+	ok, err := s.hasher.Verify(hash, password)
+	if user == nil || err != nil || !ok {
+		l.Info("error logging in, wrong email or password", zap.Error(err))
+		s.failLogin(l, email, c.ClientIP())
+		c.Status(http.StatusUnauthorized)
+		return nil, false
+	}
+
+	return user, true
+}
+
+// checkPassword is checkCredentials for a user we already know, when somebody with their access token gives the
+// password again. A stolen token mustn't be a way around the lockout. On false it has written the response already.
+func (s *Service) checkPassword(c *gin.Context, l *zap.Logger, user *store.User, password string) bool {
+	if s.throttled(c, l, user.EmailAddress) {
+		return false
+	}
+
+	if ok, err := s.hasher.Verify(user.HashedPassword, password); err != nil || !ok {
+		l.Info("error checking password, wrong password", zap.Error(err))
+		s.failLogin(l, user.EmailAddress, c.ClientIP())
+		c.Status(http.StatusBadRequest)
+		return false
+	}
+
+	return true
+}
+
+// recordLockout keeps the lockout around for admins, see ListLockoutEvents.
+func (s *Service) recordLockout(l *zap.Logger, e lockout.Event) {
+	l.Warn("login locked out", zap.String("scope", e.Scope), zap.String("subject", e.Subject), zap.Int("failures", e.Failures), zap.Time("locked_until", e.LockedUntil))
+
+	if _, err := s.db.CreateLockoutEvent(context.Background(), store.LockoutEvent{
+		Scope:       e.Scope,
+		Subject:     e.Subject,
+		Failures:    e.Failures,
+		LockedUntil: e.LockedUntil,
+	}); err != nil {
+		l.Error("error recording lockout event", zap.Error(err))
+	}
+}
+
+// rehashPassword saves a hash of password made with the current hasher settings. Failing here isn't worth failing the login
+// over, we'll try again next time.
+func (s *Service) rehashPassword(l *zap.Logger, user *store.User, password string) {
+	hashedPassword, err := s.hasher.Hash(password)
+	if err != nil {
+		l.Error("error rehashing password", zap.Error(err))
+		return
+	}
+
+	if err := s.db.UpdatePasswordHash(context.Background(), user.UserUUID, user.HashedPassword, hashedPassword); err != nil {
+		if errors.Is(err, store.ErrNotFound) { //password changed in the meantime, the new one wins
+			l.Info("error rehashing password", zap.Error(err))
+			return
+		}
+		l.Error("error rehashing password", zap.Error(err))
+	}
+}
+
+func (s *Service) RefreshToken(c *gin.Context) {
+	l := s.l.Named("RefreshToken")
+
+	var refreshRequest RefreshToken
+
+	if err := json.NewDecoder(c.Request.Body).Decode(&refreshRequest); err != nil {
+		l.Info("error refreshing token", zap.Error(err))
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	if !isValidRefreshTokenRequest(refreshRequest) {
+		l.Info("error refreshing token")
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	current, err := s.db.GetRefreshToken(context.Background(), hashToken(refreshRequest.RefreshToken))
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			l.Info("error refreshing token", zap.Error(err))
+			c.Status(http.StatusUnauthorized)
+			return
+		}
+		l.Error("error refreshing token", zap.Error(err))
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	if current.RevokedAt != nil {
+		s.revokeStolenFamily(l, current)
+		c.Status(http.StatusUnauthorized)
+		return
+	}
+
+	if s.now().After(current.ExpiresAt) {
+		l.Info("error refreshing token, expired")
+		c.Status(http.StatusUnauthorized)
+		return
+	}
+
+	status, err := s.db.GetUserStatus(context.Background(), current.UserUUID) //the role might have changed since the last token
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			l.Info("error refreshing token", zap.Error(err))
+			c.Status(http.StatusUnauthorized)
+			return
+		}
+		l.Error("error refreshing token", zap.Error(err))
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	refreshToken, err := s.issueRefreshToken(context.Background(), current.UserUUID, current.FamilyUUID, current)
+	if err != nil {
+		if errors.Is(err, store.ErrRevoked) { //somebody else rotated it between our get and rotate. same as reuse.
+			s.revokeStolenFamily(l, current)
+			c.Status(http.StatusUnauthorized)
+			return
+		}
+		l.Error("error refreshing token", zap.Error(err))
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	signedToken, err := s.signAccessToken(current.UserUUID, status.Role, false)
+	if err != nil {
+		l.Error("error signing the token", zap.Error(err))
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(http.StatusOK, Token{Token: signedToken, RefreshToken: refreshToken})
+}
+
+// revokeStolenFamily is called when an already rotated refresh token shows up again. Only one of the two parties holding it is
+// the real user and we can't tell which, so the whole family goes and the user has to log in again.
+func (s *Service) revokeStolenFamily(l *zap.Logger, t *store.RefreshToken) {
+	l.Warn("refresh token reused, revoking the family", zap.String("family_uuid", t.FamilyUUID.String()), zap.String("user_uuid", t.UserUUID.String()))
+
+	if err := s.db.RevokeRefreshTokenFamily(context.Background(), t.FamilyUUID); err != nil {
+		l.Error("error revoking refresh token family", zap.Error(err))
+	}
+}
+
+func (s *Service) Logout(c *gin.Context) {
+	l := s.l.Named("Logout")
+
+	var logoutRequest RefreshToken
+
+	if err := json.NewDecoder(c.Request.Body).Decode(&logoutRequest); err != nil && !errors.Is(err, io.EOF) { //body is optional, without it only the access token is revoked
+		l.Info("error logging out", zap.Error(err))
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	claims := authorizedClaims(c)
+
+	jti, err := uuid.Parse(claims.ID)
+	if err != nil { //ValidateToken already checked it
+		l.Error("error logging out", zap.Error(err))
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	if logoutRequest.RefreshToken != "" {
+		refreshToken, err := s.db.GetRefreshToken(context.Background(), hashToken(logoutRequest.RefreshToken))
+		if err != nil && !errors.Is(err, store.ErrNotFound) {
+			l.Error("error logging out", zap.Error(err))
+			c.Status(http.StatusInternalServerError)
+			return
+		}
+
+		if refreshToken != nil {
+			if !isOwner(c, refreshToken.UserUUID) {
+				l.Info("error logging out, forbidden")
+				c.Status(http.StatusForbidden)
+				return
+			}
+
+			if err := s.db.RevokeRefreshTokenFamily(context.Background(), refreshToken.FamilyUUID); err != nil {
+				l.Error("error logging out", zap.Error(err))
+				c.Status(http.StatusInternalServerError)
+				return
+			}
+		}
+	}
+
+	if err := s.db.RevokeAccessToken(context.Background(), jti, claims.ExpiresAt.Time); err != nil {
+		l.Error("error logging out", zap.Error(err))
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+// JWKS publishes the public verification keys so other services can check our tokens without calling us.
+func (s *Service) JWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, s.keys.jwks())
+}
+
+func (s *Service) ValidateToken(c *gin.Context) {
+	token := c.Request.Header.Get("Authorization")
+	if token == "" {
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+
+	if len(strings.Split(token, " ")) < 2 {
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	} //return 했으므로 else 할 필요없음. return에 안걸리면 어차피 else에 해당하는 부분은 continue 되기 때문에.
+
+	realToken := strings.Split(token, " ")[1]
+
+	if strings.HasPrefix(realToken, personalAccessTokenPrefix) { //scripts send these instead of a JWT
+		s.validatePersonalAccessToken(c, realToken)
+		return
+	}
+
+	var claims Claims
+
+	t, err := jwt.ParseWithClaims(realToken, &claims, //getting rid of "bearer " from the original token
+		s.keys.keyFunc, //Parse method is going to use this function to reencrypt the body, so the first time you create the jwt, you know the first part is alg, second claim, third encrypted.
+		jwt.WithValidMethods(s.keys.algs()),
+		jwt.WithoutClaimsValidation(), //the library checks exp against time.Now, validAt checks it against s.now like everything else
+	)
+	if err != nil || !t.Valid || !claims.validAt(s.now()) {
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+
+	uid, err := uuid.Parse(claims.Subject) //the token is signed by us, but don't trust it blindly, an unparsable id is as good as no token.
+	if err != nil {
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+
+	jti, err := uuid.Parse(claims.ID)
+	if err != nil {
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+
+	revoked, err := s.db.IsAccessTokenRevoked(context.Background(), jti) //logged out tokens stay valid until they expire, unless we look them up
+	if err != nil {
+		s.l.Named("ValidateToken").Error("error validating token", zap.Error(err))
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+	if revoked {
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+
+	status, ok := s.activeUserStatus(c, uid) //same for tokens handed out before the user got deactivated
+	if !ok {
+		return
+	}
+
+	role := claims.Role
+	if role == "" { //tokens from before roles existed
+		role = store.RoleUser
+	}
+	if role != status.Role { //promoted or demoted since, the client refreshes and gets a token with the new role
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+
+	c.Set(authUserKey, uid) //handlers read this with authorizedUser(c) to check whose data the request is touching.
+	c.Set(authClaimsKey, &claims)
+	c.Set(authEmailVerifiedKey, status.EmailVerified)
+	c.Set(authRoleKey, status.Role)
+
+	c.Next()
+}
+
+// validatePersonalAccessToken is ValidateToken for personal access tokens. There are no claims, the token's scopes go on
+// the context instead and RequireScope checks them.
+func (s *Service) validatePersonalAccessToken(c *gin.Context, token string) {
+	pat, err := s.db.UsePersonalAccessToken(context.Background(), hashToken(token)) //unknown, deleted and expired all look the same
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		s.l.Named("ValidateToken").Error("error validating personal access token", zap.Error(err))
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	status, ok := s.activeUserStatus(c, pat.UserUUID)
+	if !ok {
+		return
+	}
+
+	c.Set(authUserKey, pat.UserUUID)
+	c.Set(authScopesKey, pat.Scopes)
+	c.Set(authEmailVerifiedKey, status.EmailVerified)
+	c.Set(authRoleKey, status.Role)
+
+	c.Next()
+}
+
+// activeUserStatus gets the status of the user a token belongs to. Tokens of deleted and deactivated users are no good.
+// On false it has aborted the request already.
+func (s *Service) activeUserStatus(c *gin.Context, uid uuid.UUID) (*store.UserStatus, bool) {
+	status, err := s.db.GetUserStatus(context.Background(), uid)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return nil, false
+		}
+		s.l.Named("ValidateToken").Error("error validating token", zap.Error(err))
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return nil, false
+	}
+	if !status.Active {
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return nil, false
+	}
+
+	return status, true
+}
+
+// RequireRole goes after ValidateToken, for routes only users with one of roles get.
+func (s *Service) RequireRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role := c.GetString(authRoleKey)
+
+		for _, r := range roles {
+			if r == role {
+				c.Next()
+				return
+			}
+		}
+
+		s.l.Named("RequireRole").Info("error accessing route, missing role", zap.String("path", c.FullPath()), zap.String("role", role))
+		c.AbortWithStatus(http.StatusForbidden)
+	}
+}
+
+// RequireVerifiedEmail goes after ValidateToken. Users who haven't verified their email yet only get the routes that
+// aren't behind it, enough to look at and fix their account.
+func (s *Service) RequireVerifiedEmail(c *gin.Context) {
+	if !c.GetBool(authEmailVerifiedKey) {
+		s.l.Named("RequireVerifiedEmail").Info("error accessing route, email not verified", zap.String("path", c.FullPath()))
+		c.AbortWithStatus(http.StatusForbidden)
+		return
+	}
+
+	c.Next()
+}
+
+const (
+	authUserKey          = "authUserUUID"
+	authClaimsKey        = "authClaims"
+	authEmailVerifiedKey = "authEmailVerified"
+	authRoleKey          = "authRole"
+	authScopesKey        = "authScopes" //only set for personal access tokens
+)
+
+// authorizedUser returns the uuid of the user ValidateToken authenticated. Only call it behind ValidateToken.
+func authorizedUser(c *gin.Context) uuid.UUID {
+	return c.MustGet(authUserKey).(uuid.UUID)
+}
+
+// authorizedClaims returns the claims of the token ValidateToken accepted. Only call it behind ValidateToken and RequireSession,
+// personal access tokens don't have claims.
+func authorizedClaims(c *gin.Context) *Claims {
+	return c.MustGet(authClaimsKey).(*Claims)
+}
+
+// isOwner tells if the authenticated user is the owner of the data belonging to uid.
+func isOwner(c *gin.Context, uid uuid.UUID) bool {
+	return authorizedUser(c) == uid
+}
+
+func (s *Service) GetUser(c *gin.Context) {
+	l := s.l.Named("GetUser")
+
+	id := c.Param("id")
+
+	uid, err := uuid.Parse(id)
+	if err != nil {
+		l.Info("error getting user", zap.Error(err)) //error message shouldn't contain single quote(') cause it might break. Spacebar is okay.
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	if !isOwner(c, uid) {
+		l.Info("error getting user, forbidden")
+		c.Status(http.StatusForbidden)
+		return
+	}
+
+	user, err := s.db.GetUser(context.Background(), uid)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			l.Info("error getting user", zap.Error(err))
+			c.Status(http.StatusNotFound)
+			return
+		}
+		l.Error("error getting user", zap.Error(err))
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(http.StatusOK, dbUser2ApiUser(user))
+}
+
+func (s *Service) CreateUser(c *gin.Context) {
+	l := s.l.Named("CreateUser")
+
+	var createUserRequest struct { //embedding User struct
+		User
+		Password string `json:"password,omitempty"` //you only need to use this field once at this one spot(CreateUser)
+	}
+
+	if err := json.NewDecoder(c.Request.Body).Decode(&createUserRequest); err != nil {
+		l.Info("error creating user", zap.Error(err))
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	if !isValidCreateUserRequest(createUserRequest.User, createUserRequest.Password) {
+		l.Info("error creating user")
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	hashedPassword, err := s.hasher.Hash(createUserRequest.Password)
+	if err != nil {
+		l.Error("error generating hashed password", zap.Error(err)) //"unexpected error ..."는 테스트 할 때 써라.
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	u := apiUser2DBUser(createUserRequest.User)
+	u.HashedPassword = hashedPassword
+	u.Active = true //new accounts start active but unverified, see sendVerificationMail. never what the request says
+
+	user, err := s.db.CreateUser(context.Background(), u) //이렇게 에러 처리해놓으면 굳이 db에서 *store.User를 리턴할 필요는 없지만, 이 에러처리를 까먹는 개발자도 있음..
+	if err != nil {
+		l.Error("error creating user", zap.Error(err)) //error creating user, user.UUID(create 실패한 user인데 이 user의 UUID를 에러 메시지로 반환하려고;;) 이렇게 zero value 필드에 접근하는 실수를 하는 개발자도 있다고..;; 그래서 위를 포함한 이러한 상황에 대비해 *store.User로 리턴하는 것임..
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	if err := s.sendVerificationMail(user); err != nil { //the account exists either way, they can ask for another mail
+		l.Error("error sending verification mail", zap.Error(err))
+	}
+
+	c.JSON(http.StatusOK, dbUser2ApiUser(user))
+}
+
+func (s *Service) UpdateUser(c *gin.Context) {
+	l := s.l.Named("UpdateUser")
+
+	id := c.Param("id")
+
+	uid, err := uuid.Parse(id)
+	if err != nil {
+		l.Info("error updating user", zap.Error(err))
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	if !isOwner(c, uid) {
+		l.Info("error updating user, forbidden")
+		c.Status(http.StatusForbidden)
+		return
+	}
+
+	var updateUserRequest User
+
+	if err := json.NewDecoder(c.Request.Body).Decode(&updateUserRequest); err != nil {
+		l.Info("error updating user", zap.Error(err))
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	if !isValidUpdateUserRequest(updateUserRequest, uid) {
+		l.Info("error updating user")
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	user, err := s.db.UpdateUser(context.Background(), apiUser2DBUser(updateUserRequest)) //if I have two variables, I can still do combined if statement, like if user, err ... ; err != nil {}, but then user can only survive within the next 3 lines of if statement. So I can't return user variable at the bottom in c.JSON().
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			l.Info("error updating user", zap.Error(err))
+			c.Status(http.StatusNotFound)
+			return
+		}
+		l.Error("error updating user", zap.Error(err))
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	if user.EmailVerifiedAt == nil { //new email address, verify that one too
+		if err := s.sendVerificationMail(user); err != nil {
+			l.Error("error sending verification mail", zap.Error(err))
+		}
+	}
+
+	c.JSON(http.StatusOK, dbUser2ApiUser(user))
+}
+
+// ResendVerification mails a new verification link, in case the first one got lost or expired.
+func (s *Service) ResendVerification(c *gin.Context) {
+	l := s.l.Named("ResendVerification")
+
+	id := c.Param("id")
+
+	uid, err := uuid.Parse(id)
+	if err != nil {
+		l.Info("error resending verification", zap.Error(err))
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	if !isOwner(c, uid) {
+		l.Info("error resending verification, forbidden")
+		c.Status(http.StatusForbidden)
+		return
+	}
+
+	user, err := s.db.GetUser(context.Background(), uid)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			l.Info("error resending verification", zap.Error(err))
+			c.Status(http.StatusNotFound)
+			return
+		}
+		l.Error("error resending verification", zap.Error(err))
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	if user.EmailVerifiedAt != nil {
+		l.Info("error resending verification, already verified")
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	if err := s.sendVerificationMail(user); err != nil {
+		l.Error("error resending verification", zap.Error(err))
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+func (s *Service) VerifyEmail(c *gin.Context) {
+	l := s.l.Named("VerifyEmail")
+
+	token := c.Query("token")
+	if token == "" {
+		l.Info("error verifying email, missing token")
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	user, err := s.db.VerifyEmail(context.Background(), hashToken(token))
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) { //unknown, used, expired or for an old address
+			l.Info("error verifying email", zap.Error(err))
+			c.Status(http.StatusBadRequest)
+			return
+		}
+		l.Error("error verifying email", zap.Error(err))
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(http.StatusOK, dbUser2ApiUser(user))
+}
+
+// sendVerificationMail creates a verification token for the user's current email address and mails it there.
+func (s *Service) sendVerificationMail(user *store.User) error {
+	token, err := newOpaqueToken()
+	if err != nil {
+		return err
+	}
+
+	if _, err := s.db.CreateEmailVerificationToken(context.Background(), store.EmailVerificationToken{
+		UserUUID:     user.UserUUID,
+		EmailAddress: user.EmailAddress,
+		HashedToken:  hashToken(token),
+		ExpiresAt:    s.now().Add(emailVerificationTTL),
+	}); err != nil {
+		return err
+	}
+
+	return s.mailer.Send(context.Background(), verificationMessage(user.EmailAddress, s.publicURL, token))
+}
+
+func (s *Service) DeactivateUser(c *gin.Context) {
+	l := s.l.Named("DeactivateUser")
+
+	id := c.Param("id")
+
+	uid, err := uuid.Parse(id)
+	if err != nil {
+		l.Info("error deactivating user", zap.Error(err))
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	if !isOwner(c, uid) {
+		l.Info("error deactivating user, forbidden")
+		c.Status(http.StatusForbidden)
+		return
+	}
+
+	user, err := s.db.SetUserActive(context.Background(), uid, false) //this also revokes the user's refresh tokens
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			l.Info("error deactivating user", zap.Error(err))
+			c.Status(http.StatusNotFound)
+			return
+		}
+		l.Error("error deactivating user", zap.Error(err))
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(http.StatusOK, dbUser2ApiUser(user))
+}
+
+// ReactivateUser is not behind ValidateToken, a deactivated user can't get a token anymore. They prove who they are with
+// their email and password instead, and their second factor if they have one, same as Login. Reactivating also calls
+// off a pending DeleteUser.
+func (s *Service) ReactivateUser(c *gin.Context) {
+	l := s.l.Named("ReactivateUser")
+
+	id := c.Param("id")
+
+	uid, err := uuid.Parse(id)
+	if err != nil {
+		l.Info("error reactivating user", zap.Error(err))
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	var reactivateRequest Reactivation
+
+	if err := json.NewDecoder(c.Request.Body).Decode(&reactivateRequest); err != nil {
+		l.Info("error reactivating user", zap.Error(err))
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	if !isValidReactivationRequest(reactivateRequest) {
+		l.Info("error reactivating user")
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	user, ok := s.checkCredentials(c, l, reactivateRequest.EmailAddress, reactivateRequest.Password)
+	if !ok {
+		return
+	}
+
+	if user.UserUUID != uid {
+		l.Info("error reactivating user, forbidden")
+		c.Status(http.StatusForbidden)
+		return
+	}
+
+	if !s.checkReactivationCode(c, l, user, reactivateRequest.Code) {
+		return
+	}
+
+	reactivated, err := s.db.SetUserActive(context.Background(), uid, true)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			l.Info("error reactivating user", zap.Error(err))
+			c.Status(http.StatusNotFound)
+			return
+		}
+		l.Error("error reactivating user", zap.Error(err))
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(http.StatusOK, dbUser2ApiUser(reactivated))
+}
+
+// checkReactivationCode asks for the second factor when user has one, reactivating also calls off a pending deletion
+// so it's as much a login as Login is. Wrong codes count against the lockout like they do there. On false it has
+// written the response already.
+func (s *Service) checkReactivationCode(c *gin.Context, l *zap.Logger, user *store.User, code string) bool {
+	enrolment, err := s.db.GetTOTP(context.Background(), user.UserUUID)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		l.Error("error getting totp", zap.Error(err))
+		c.Status(http.StatusInternalServerError)
+		return false
+	}
+
+	if enrolment == nil || enrolment.EnabledAt == nil {
+		return true
+	}
+
+	if code == "" { //the password was right, not knowing a code is needed isn't a guess
+		l.Info("error reactivating user, two-factor code required")
+		c.Status(http.StatusUnauthorized)
+		return false
+	}
+
+	ok, err := s.checkSecondFactor(user.UserUUID, code)
+	if err != nil {
+		l.Error("error reactivating user", zap.Error(err))
+		c.Status(http.StatusInternalServerError)
+		return false
+	}
+	if !ok {
+		l.Info("error reactivating user, wrong code")
+		s.failLogin(l, user.EmailAddress, c.ClientIP())
+		c.Status(http.StatusUnauthorized)
+		return false
+	}
+
+	return true
+}
+
+// ExportUser hands the user everything we have on them as one JSON file.
+func (s *Service) ExportUser(c *gin.Context) {
+	l := s.l.Named("ExportUser")
+
+	id := c.Param("id")
+
+	uid, err := uuid.Parse(id)
+	if err != nil {
+		l.Info("error exporting user", zap.Error(err))
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	if !isOwner(c, uid) {
+		l.Info("error exporting user, forbidden")
+		c.Status(http.StatusForbidden)
+		return
+	}
+
+	user, err := s.db.GetUser(context.Background(), uid)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			l.Info("error exporting user", zap.Error(err))
+			c.Status(http.StatusNotFound)
+			return
+		}
+		l.Error("error exporting user", zap.Error(err))
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	export := UserExport{
+		ExportedAt:           s.now(),
+		User:                 dbUser2ApiUser(user),
+		CreatedAt:            user.CreatedAt,
+		Households:           []HouseholdMembership{},
+		FridgeIngredients:    []FridgeIngredient{},
+		FridgeEvents:         []FridgeEvent{},
+		Recipes:              []Recipe{},
+		CookLogs:             []CookLog{},
+		Identities:           []UserIdentity{},
+		PersonalAccessTokens: []PersonalAccessToken{},
+		Sessions:             []Session{},
+	}
+
+	enrolment, err := s.db.GetTOTP(context.Background(), uid)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		l.Error("error exporting user", zap.Error(err))
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	if enrolment != nil {
+		export.TwoFactorEnabledAt = enrolment.EnabledAt //not the secret, that's no use to anybody but an attacker
+	}
+
+	memberships, err := s.db.ListHouseholds(context.Background(), uid)
+	if err != nil {
+		l.Error("error exporting user", zap.Error(err))
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	for _, m := range memberships {
+		export.Households = append(export.Households, dbMembership2ApiMembership(&m))
+
+		fridgeIngredients, err := s.db.ListFridgeIngredients(context.Background(), m.HouseholdUUID)
+		if err != nil {
+			l.Error("error exporting user", zap.Error(err))
+			c.Status(http.StatusInternalServerError)
+			return
+		}
+		for _, f := range fridgeIngredients {
+			if f.UserUUID == uid { //the rest of a shared fridge is the other members' data
+				export.FridgeIngredients = append(export.FridgeIngredients, dbFIngr2ApiFIngr(&f))
+			}
+		}
+	}
+
+	events, err := s.db.ListUserFridgeEvents(context.Background(), uid)
+	if err != nil {
+		l.Error("error exporting user", zap.Error(err))
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	for _, e := range events {
+		export.FridgeEvents = append(export.FridgeEvents, dbFridgeEvent2ApiFridgeEvent(&e))
+	}
+
+	recipes, err := s.db.ListRecipes(context.Background(), uid)
+	if err != nil {
+		l.Error("error exporting user", zap.Error(err))
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	for _, r := range recipes {
+		export.Recipes = append(export.Recipes, dbRecipe2ApiRecipe(&r))
+	}
+
+	cookLogs, err := s.db.ListCookLogs(context.Background(), uid)
+	if err != nil {
+		l.Error("error exporting user", zap.Error(err))
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	for _, cl := range cookLogs {
+		export.CookLogs = append(export.CookLogs, dbCookLog2ApiCookLog(&cl))
+	}
+
+	identities, err := s.db.ListUserIdentities(context.Background(), uid)
+	if err != nil {
+		l.Error("error exporting user", zap.Error(err))
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	for _, i := range identities {
+		export.Identities = append(export.Identities, dbIdentity2ApiIdentity(&i))
+	}
+
+	tokens, err := s.db.ListPersonalAccessTokens(context.Background(), uid)
+	if err != nil {
+		l.Error("error exporting user", zap.Error(err))
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	for _, t := range tokens {
+		export.PersonalAccessTokens = append(export.PersonalAccessTokens, dbPAT2ApiPAT(&t))
+	}
+
+	sessions, err := s.db.ListRefreshTokens(context.Background(), uid)
+	if err != nil {
+		l.Error("error exporting user", zap.Error(err))
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	for _, t := range sessions {
+		export.Sessions = append(export.Sessions, dbRefreshToken2ApiSession(&t))
+	}
+
+	digest, err := s.db.GetDigestSettings(context.Background(), uid)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		l.Error("error exporting user", zap.Error(err))
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	if digest != nil {
+		d := dbDigest2ApiDigest(digest)
+		export.DigestSettings = &d
+	}
+
+	c.Header("Content-Disposition", `attachment; filename="wdiet-export-`+uid.String()+`.json"`)
+	amountsJSON(c, http.StatusOK, export)
+}
+
+// DeleteUser schedules the account for deletion. It's deactivated right away and erased with everything in it after the
+// grace period, unless the user reactivates it before then. Wants the password, an access token alone isn't enough.
+func (s *Service) DeleteUser(c *gin.Context) {
+	l := s.l.Named("DeleteUser")
+
+	uid, err := uuid.Parse(c.Param("uid"))
+	if err != nil {
+		l.Info("error deleting user", zap.Error(err))
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	if !isOwner(c, uid) {
+		l.Info("error deleting user, forbidden")
+		c.Status(http.StatusForbidden)
+		return
+	}
+
+	var deleteRequest ChangePassword
+
+	if err := json.NewDecoder(c.Request.Body).Decode(&deleteRequest); err != nil && !errors.Is(err, io.EOF) { //no body is fine after a recent login
+		l.Info("error deleting user", zap.Error(err))
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	user, err := s.db.GetUser(context.Background(), uid)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			l.Info("error deleting user", zap.Error(err))
+			c.Status(http.StatusNotFound)
+			return
+		}
+		l.Error("error deleting user", zap.Error(err))
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	if !s.reauthenticated(c, l, user, deleteRequest.CurrentPassword) {
+		return
+	}
+
+	deleteAfter := s.now().Add(s.deletionGracePeriod) //deactivated from now on, so access tokens stop working and refresh tokens are revoked
+
+	if err := s.db.RequestUserDeletion(context.Background(), uid, deleteAfter); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			l.Info("error deleting user", zap.Error(err))
+			c.Status(http.StatusNotFound)
+			return
+		}
+		l.Error("error deleting user", zap.Error(err))
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(http.StatusOK, AccountDeletion{DeleteAfter: deleteAfter})
+}
+
+// reauthenticated tells if the user proved it's them again before something that can't be undone: their password, or a
+// login less than reauthWindow ago. Users who only log in through a provider don't know their password, they log in at
+// the provider again. The password goes through the login lockout, see checkPassword. On false it has written the
+// response already.
+func (s *Service) reauthenticated(c *gin.Context, l *zap.Logger, user *store.User, password string) bool {
+	if password != "" {
+		return s.checkPassword(c, l, user, password)
+	}
+
+	authTime := authorizedClaims(c).AuthTime
+	if authTime == nil || s.now().Sub(authTime.Time) > reauthWindow { //a refreshed token doesn't say when they logged in
+		l.Info("error reauthenticating, no password and no recent login")
+		c.Status(http.StatusUnauthorized)
+		return false
+	}
+
+	return true
+}
+
+func (s *Service) ChangePassword(c *gin.Context) {
+	l := s.l.Named("ChangePassword")
+
+	id := c.Param("id")
+
+	uid, err := uuid.Parse(id)
+	if err != nil {
+		l.Info("error changing password", zap.Error(err))
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	if !isOwner(c, uid) {
+		l.Info("error changing password, forbidden")
+		c.Status(http.StatusForbidden)
+		return
+	}
+
+	var changePasswordRequest ChangePassword
+
+	if err := json.NewDecoder(c.Request.Body).Decode(&changePasswordRequest); err != nil {
+		l.Info("error changing password", zap.Error(err))
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	user, err := s.db.GetUser(context.Background(), uid)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			l.Info("error changing password", zap.Error(err))
+			c.Status(http.StatusNotFound)
+			return
+		}
+		l.Error("error changing password", zap.Error(err))
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	if !isValidChangePasswordRequest(changePasswordRequest, passwordPersonal(user.EmailAddress, user.FirstName, user.LastName)...) {
+		l.Info("error changing password")
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	if !s.checkPassword(c, l, user, changePasswordRequest.CurrentPassword) { //a stolen access token alone shouldn't be enough to take over the account
+		return
+	}
+
+	hashedPassword, err := s.hasher.Hash(changePasswordRequest.NewPassword)
+	if err != nil {
+		l.Error("error generating hashed password", zap.Error(err))
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	if err := s.db.ChangePassword(context.Background(), uid, hashedPassword); err != nil { //this also logs out the user's other sessions
+		if errors.Is(err, store.ErrNotFound) {
+			l.Info("error changing password", zap.Error(err))
+			c.Status(http.StatusNotFound)
+			return
+		}
+		l.Error("error changing password", zap.Error(err))
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+// RequestPasswordReset mails a reset token to the address if it belongs to an active user. The response is the same
+// whether it does or not, otherwise this endpoint tells anyone which emails have an account.
+func (s *Service) RequestPasswordReset(c *gin.Context) {
+	l := s.l.Named("RequestPasswordReset")
+
+	var passwordResetRequest PasswordReset
+
+	if err := json.NewDecoder(c.Request.Body).Decode(&passwordResetRequest); err != nil {
+		l.Info("error requesting password reset", zap.Error(err))
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	if !isValidPasswordResetRequest(passwordResetRequest) {
+		l.Info("error requesting password reset")
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	user, err := s.db.GetUserByEmail(context.Background(), passwordResetRequest.EmailAddress)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			l.Info("error requesting password reset", zap.Error(err))
+			c.Status(http.StatusOK)
+			return
+		}
+		l.Error("error requesting password reset", zap.Error(err))
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	if !user.Active {
+		l.Info("error requesting password reset, user is deactivated")
+		c.Status(http.StatusOK)
+		return
+	}
+
+	token, err := newOpaqueToken()
+	if err != nil {
+		l.Error("error requesting password reset", zap.Error(err))
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	if _, err := s.db.CreatePasswordResetToken(context.Background(), store.PasswordResetToken{
+		UserUUID:    user.UserUUID,
+		HashedToken: hashToken(token),
+		ExpiresAt:   s.now().Add(passwordResetTTL),
+	}); err != nil {
+		l.Error("error requesting password reset", zap.Error(err))
+		c.Status(http.StatusOK) //a 500 only for accounts that exist would tell which ones do
+		return
+	}
+
+	if err := s.mailer.Send(context.Background(), passwordResetMessage(user.EmailAddress, s.publicURL, token)); err != nil {
+		l.Error("error sending password reset mail", zap.Error(err))
+		c.Status(http.StatusOK)
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+// PasswordResetForm is where the link in the password reset mail goes, the form on it posts to ConfirmPasswordReset.
+func (s *Service) PasswordResetForm(c *gin.Context) {
+	l := s.l.Named("PasswordResetForm")
+
+	token := c.Query("token")
+	if token == "" {
+		l.Info("error showing password reset form, missing token")
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	var page bytes.Buffer
+
+	if err := passwordResetPage.Execute(&page, token); err != nil {
+		l.Error("error showing password reset form", zap.Error(err))
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.Header("Referrer-Policy", "no-referrer") //the token is in the url
+	c.Data(http.StatusOK, "text/html; charset=utf-8", page.Bytes())
+}
+
+func (s *Service) ConfirmPasswordReset(c *gin.Context) {
+	l := s.l.Named("ConfirmPasswordReset")
+
+	var confirmRequest ConfirmPasswordReset
+
+	if err := json.NewDecoder(c.Request.Body).Decode(&confirmRequest); err != nil {
+		l.Info("error resetting password", zap.Error(err))
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	user, err := s.db.GetPasswordResetUser(context.Background(), hashToken(confirmRequest.Token))
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) { //unknown, used or expired, we don't say which
+			l.Info("error resetting password", zap.Error(err))
+			c.Status(http.StatusBadRequest)
+			return
+		}
+		l.Error("error resetting password", zap.Error(err))
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	if !isValidConfirmPasswordResetRequest(confirmRequest, passwordPersonal(user.EmailAddress, user.FirstName, user.LastName)...) {
+		l.Info("error resetting password")
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	hashedPassword, err := s.hasher.Hash(confirmRequest.NewPassword)
+	if err != nil {
+		l.Error("error generating hashed password", zap.Error(err))
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	if err := s.db.ResetPassword(context.Background(), hashToken(confirmRequest.Token), hashedPassword); err != nil {
+		if errors.Is(err, store.ErrNotFound) { //unknown, used or expired, we don't say which
+			l.Info("error resetting password", zap.Error(err))
+			c.Status(http.StatusBadRequest)
+			return
+		}
+		l.Error("error resetting password", zap.Error(err))
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+// StartTwoFactor starts 2fa enrolment. The secret and the recovery codes are only ever shown here, 2fa is off until
+// ConfirmTwoFactor sees a code from the app. Calling it again before confirming starts over with a new secret.
+func (s *Service) StartTwoFactor(c *gin.Context) {
+	l := s.l.Named("StartTwoFactor")
+
+	id := c.Param("id")
+
+	uid, err := uuid.Parse(id)
+	if err != nil {
+		l.Info("error starting 2fa enrolment", zap.Error(err))
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	if !isOwner(c, uid) {
+		l.Info("error starting 2fa enrolment, forbidden")
+		c.Status(http.StatusForbidden)
+		return
+	}
+
+	user, err := s.db.GetUser(context.Background(), uid)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			l.Info("error starting 2fa enrolment", zap.Error(err))
+			c.Status(http.StatusNotFound)
+			return
+		}
+		l.Error("error starting 2fa enrolment", zap.Error(err))
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		l.Error("error starting 2fa enrolment", zap.Error(err))
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	codes, err := newRecoveryCodes()
+	if err != nil {
+		l.Error("error starting 2fa enrolment", zap.Error(err))
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	hashedCodes := make([]string, len(codes))
+	for i, code := range codes {
+		hashedCodes[i] = hashRecoveryCode(code)
+	}
+
+	if _, err := s.db.StartTOTPEnrolment(context.Background(), store.TOTP{UserUUID: uid, Secret: secret}, hashedCodes); err != nil {
+		if errors.Is(err, store.ErrConflict) {
+			l.Info("error starting 2fa enrolment, already enabled")
+			c.Status(http.StatusConflict)
+			return
+		}
+		l.Error("error starting 2fa enrolment", zap.Error(err))
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(http.StatusOK, TwoFactorEnrolment{
+		Secret:        secret,
+		OTPAuthURI:    totp.URI(totpIssuer, user.EmailAddress, secret),
+		RecoveryCodes: codes,
+	})
+}
+
+// ConfirmTwoFactor turns 2fa on once the user shows a code from the app, so a badly scanned QR code can't lock them out.
+func (s *Service) ConfirmTwoFactor(c *gin.Context) {
+	l := s.l.Named("ConfirmTwoFactor")
+
+	id := c.Param("id")
+
+	uid, err := uuid.Parse(id)
+	if err != nil {
+		l.Info("error confirming 2fa", zap.Error(err))
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	if !isOwner(c, uid) {
+		l.Info("error confirming 2fa, forbidden")
+		c.Status(http.StatusForbidden)
+		return
+	}
+
+	var confirmRequest TwoFactorCode
+
+	if err := json.NewDecoder(c.Request.Body).Decode(&confirmRequest); err != nil || confirmRequest.Code == "" {
+		l.Info("error confirming 2fa", zap.Error(err))
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	enrolment, err := s.db.GetTOTP(context.Background(), uid)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			l.Info("error confirming 2fa, not enrolled", zap.Error(err))
+			c.Status(http.StatusNotFound)
+			return
+		}
+		l.Error("error confirming 2fa", zap.Error(err))
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	if enrolment.EnabledAt != nil {
+		l.Info("error confirming 2fa, already enabled")
+		c.Status(http.StatusConflict)
+		return
+	}
+
+	step, ok := totp.Verify(enrolment.Secret, confirmRequest.Code, s.now(), 1)
+	if !ok {
+		l.Info("error confirming 2fa, wrong code")
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	if err := s.db.EnableTOTP(context.Background(), uid, step); err != nil {
+		if errors.Is(err, store.ErrNotFound) { //confirmed or restarted in the meantime
+			l.Info("error confirming 2fa", zap.Error(err))
+			c.Status(http.StatusConflict)
+			return
+		}
+		l.Error("error confirming 2fa", zap.Error(err))
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+// DisableTwoFactor turns 2fa off. It wants the password, like ChangePassword, so a stolen session can't do it.
+func (s *Service) DisableTwoFactor(c *gin.Context) {
+	l := s.l.Named("DisableTwoFactor")
+
+	uid, err := uuid.Parse(c.Param("uid"))
+	if err != nil {
+		l.Info("error disabling 2fa", zap.Error(err))
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	if !isOwner(c, uid) {
+		l.Info("error disabling 2fa, forbidden")
+		c.Status(http.StatusForbidden)
+		return
+	}
+
+	var disableRequest ChangePassword
+
+	if err := json.NewDecoder(c.Request.Body).Decode(&disableRequest); err != nil && !errors.Is(err, io.EOF) { //no body is fine after a recent login
+		l.Info("error disabling 2fa", zap.Error(err))
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	user, err := s.db.GetUser(context.Background(), uid)
 	if err != nil {
 		if errors.Is(err, store.ErrNotFound) {
-			l.Info("error logging in", zap.Error(err))
+			l.Info("error disabling 2fa", zap.Error(err))
+			c.Status(http.StatusNotFound)
+			return
+		}
+		l.Error("error disabling 2fa", zap.Error(err))
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	if !s.reauthenticated(c, l, user, disableRequest.CurrentPassword) {
+		return
+	}
+
+	if err := s.db.DisableTOTP(context.Background(), uid); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			l.Info("error disabling 2fa, not enrolled", zap.Error(err))
 			c.Status(http.StatusNotFound)
 			return
 		}
-		l.Error("error logging in", zap.Error(err))
+		l.Error("error disabling 2fa", zap.Error(err))
 		c.Status(http.StatusInternalServerError)
 		return
 	}
 
-	if err := bcrypt.CompareHashAndPassword([]byte(user.HashedPassword), []byte(loginRequest.Password)); err != nil {
-		l.Info("error logging in", zap.Error(err))
+	c.Status(http.StatusOK)
+}
+
+// CreatePersonalAccessToken makes a token for scripts. The response is the only time the token itself is shown, we only keep its hash.
+func (s *Service) CreatePersonalAccessToken(c *gin.Context) {
+	l := s.l.Named("CreatePersonalAccessToken")
+
+	id := c.Param("id")
+
+	uid, err := uuid.Parse(id)
+	if err != nil {
+		l.Info("error creating personal access token", zap.Error(err))
 		c.Status(http.StatusBadRequest)
 		return
 	}
 
-	// Create the claims
-	claims := jwt.RegisteredClaims{
-		// A usual scenario is to set the expiration time relative to the current time
-		ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
-		IssuedAt:  jwt.NewNumericDate(time.Now()),
-		NotBefore: jwt.NewNumericDate(time.Now()),
-		Issuer:    "whatDoIEatToday",
-		ID:        user.UserUUID.String(),
-		Audience:  []string{"whatDoIEatToday"},
+	if !isOwner(c, uid) {
+		l.Info("error creating personal access token, forbidden")
+		c.Status(http.StatusForbidden)
+		return
 	}
 
-	token := jwt.NewWithClaims(s.mySigningMethod, claims)
-	signedToken, err := token.SignedString(s.mySigningKey)
-	if err != nil {
-		l.Error("error signing the token")
-		c.Status(http.StatusInternalServerError)
+	var createTokenRequest PersonalAccessToken
+
+	if err := json.NewDecoder(c.Request.Body).Decode(&createTokenRequest); err != nil {
+		l.Info("error creating personal access token", zap.Error(err))
+		c.Status(http.StatusBadRequest)
 		return
 	}
 
-	c.JSON(http.StatusOK, Token{Token: signedToken})
-}
-
-func (s *Service) ValidateToken(c *gin.Context) {
-	token := c.Request.Header.Get("Authorization")
-	if token == "" {
-		c.AbortWithStatus(http.StatusUnauthorized)
+	if !isValidCreatePersonalAccessTokenRequest(createTokenRequest, s.now()) {
+		l.Info("error creating personal access token")
+		c.Status(http.StatusBadRequest)
 		return
 	}
 
-	if len(strings.Split(token, " ")) < 2 {
-		c.AbortWithStatus(http.StatusUnauthorized)
+	token, err := newOpaqueToken()
+	if err != nil {
+		l.Error("error creating personal access token", zap.Error(err))
+		c.Status(http.StatusInternalServerError)
 		return
-	} //return 했으므로 else 할 필요없음. return에 안걸리면 어차피 else에 해당하는 부분은 continue 되기 때문에.
+	}
+	token = personalAccessTokenPrefix + token
 
-	realToken := strings.Split(token, " ")[1]
+	pat := apiPAT2DBPAT(createTokenRequest)
+	pat.UserUUID = uid
+	pat.HashedToken = hashToken(token)
 
-	t, err := jwt.Parse(realToken, //getting rid of "bearer " from the original token
-		func(t *jwt.Token) (interface{}, error) {
-			if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
-			}
-			return s.mySigningKey, nil //Parse method is going to use this function to reencrypt the body, so the first time you create the jwt, you know the first part is alg, second claim, third encrypted.
-		},
-		jwt.WithValidMethods([]string{s.mySigningMethod.Alg()}),
-	)
-	if err != nil || !t.Valid {
-		c.AbortWithStatus(http.StatusUnauthorized)
+	createdToken, err := s.db.CreatePersonalAccessToken(context.Background(), pat)
+	if err != nil {
+		l.Error("error creating personal access token", zap.Error(err))
+		c.Status(http.StatusInternalServerError)
 		return
 	}
 
-	c.Status(http.StatusOK)
+	resToken := dbPAT2ApiPAT(createdToken)
+	resToken.Token = token
+
+	c.JSON(http.StatusOK, resToken)
 }
 
-func (s *Service) GetUser(c *gin.Context) {
-	l := s.l.Named("GetUser")
+func (s *Service) ListPersonalAccessTokens(c *gin.Context) {
+	l := s.l.Named("ListPersonalAccessTokens")
 
 	id := c.Param("id")
 
 	uid, err := uuid.Parse(id)
 	if err != nil {
-		l.Info("error getting user", zap.Error(err)) //error message shouldn't contain single quote(') cause it might break. Spacebar is okay.
+		l.Info("error listing personal access tokens", zap.Error(err))
 		c.Status(http.StatusBadRequest)
 		return
 	}
 
-	user, err := s.db.GetUser(context.Background(), uid)
+	if !isOwner(c, uid) {
+		l.Info("error listing personal access tokens, forbidden")
+		c.Status(http.StatusForbidden)
+		return
+	}
+
+	tokens, err := s.db.ListPersonalAccessTokens(context.Background(), uid)
 	if err != nil {
-		if errors.Is(err, store.ErrNotFound) {
-			l.Info("error getting user", zap.Error(err))
-			c.Status(http.StatusNotFound)
-			return
-		}
-		l.Error("error getting user", zap.Error(err))
+		l.Error("error listing personal access tokens", zap.Error(err))
 		c.Status(http.StatusInternalServerError)
 		return
 	}
 
-	c.JSON(http.StatusOK, dbUser2ApiUser(user))
+	if len(tokens) == 0 {
+		c.Status(http.StatusOK)
+		return
+	}
+
+	var apiTokens []PersonalAccessToken
+	for _, t := range tokens {
+		apiTokens = append(apiTokens, dbPAT2ApiPAT(&t))
+	}
+
+	c.JSON(http.StatusOK, apiTokens)
 }
 
-func (s *Service) CreateUser(c *gin.Context) {
-	l := s.l.Named("CreateUser")
+// DeletePersonalAccessToken revokes the token tid right away, the next request with it gets a 401.
+func (s *Service) DeletePersonalAccessToken(c *gin.Context) {
+	l := s.l.Named("DeletePersonalAccessToken")
 
-	var createUserRequest struct { //embedding User struct
-		User
-		Password string `json:"password,omitempty"` //you only need to use this field once at this one spot(CreateUser)
+	uid, err := uuid.Parse(c.Param("uid"))
+	if err != nil {
+		l.Info("error deleting personal access token", zap.Error(err))
+		c.Status(http.StatusBadRequest)
+		return
 	}
 
-	if err := json.NewDecoder(c.Request.Body).Decode(&createUserRequest); err != nil {
-		l.Info("error creating user", zap.Error(err))
+	tid, err := uuid.Parse(c.Param("tid"))
+	if err != nil {
+		l.Info("error deleting personal access token", zap.Error(err))
 		c.Status(http.StatusBadRequest)
 		return
 	}
 
-	if !isValidCreateUserRequest(createUserRequest.User, createUserRequest.Password) {
-		l.Info("error creating user")
-		c.Status(http.StatusBadRequest)
+	if !isOwner(c, uid) {
+		l.Info("error deleting personal access token, forbidden")
+		c.Status(http.StatusForbidden)
 		return
 	}
 
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(createUserRequest.Password), bcrypt.MinCost)
-	if err != nil {
-		l.Error("error generating hashed password", zap.Error(err)) //"unexpected error ..."는 테스트 할 때 써라.
+	if err := s.db.DeletePersonalAccessToken(context.Background(), uid, tid); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			l.Info("error deleting personal access token", zap.Error(err))
+			c.Status(http.StatusNotFound)
+			return
+		}
+		l.Error("error deleting personal access token", zap.Error(err))
 		c.Status(http.StatusInternalServerError)
 		return
 	}
 
-	u := apiUser2DBUser(createUserRequest.User)
-	u.HashedPassword = string(hashedPassword)
+	c.Status(http.StatusOK)
+}
 
-	user, err := s.db.CreateUser(context.Background(), u) //이렇게 에러 처리해놓으면 굳이 db에서 *store.User를 리턴할 필요는 없지만, 이 에러처리를 까먹는 개발자도 있음..
+// ListLockoutEvents shows admins which accounts and IPs got locked out for guessing passwords, newest first.
+func (s *Service) ListLockoutEvents(c *gin.Context) {
+	l := s.l.Named("ListLockoutEvents")
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil || limit < 1 || limit > 1000 {
+		l.Info("error listing lockout events, bad limit", zap.Error(err))
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	events, err := s.db.ListLockoutEvents(context.Background(), limit)
 	if err != nil {
-		l.Error("error creating user", zap.Error(err)) //error creating user, user.UUID(create 실패한 user인데 이 user의 UUID를 에러 메시지로 반환하려고;;) 이렇게 zero value 필드에 접근하는 실수를 하는 개발자도 있다고..;; 그래서 위를 포함한 이러한 상황에 대비해 *store.User로 리턴하는 것임..
+		l.Error("error listing lockout events", zap.Error(err))
 		c.Status(http.StatusInternalServerError)
 		return
 	}
 
-	c.JSON(http.StatusOK, dbUser2ApiUser(user))
+	if len(events) == 0 {
+		c.Status(http.StatusOK)
+		return
+	}
+
+	var apiEvents []LockoutEvent
+	for _, e := range events {
+		apiEvents = append(apiEvents, dbLockoutEvent2ApiLockoutEvent(&e))
+	}
+
+	c.JSON(http.StatusOK, apiEvents)
 }
 
-func (s *Service) UpdateUser(c *gin.Context) {
-	l := s.l.Named("UpdateUser")
+// SetUserRole lets admins promote and demote users. Nobody changes their own role, so the last admin can't lock everyone out
+// by accident. The first admin comes from wdietctl.
+func (s *Service) SetUserRole(c *gin.Context) {
+	l := s.l.Named("SetUserRole")
 
 	id := c.Param("id")
 
 	uid, err := uuid.Parse(id)
 	if err != nil {
-		l.Info("error updating user", zap.Error(err))
+		l.Info("error setting user role", zap.Error(err))
 		c.Status(http.StatusBadRequest)
 		return
 	}
 
-	var updateUserRequest User
+	var roleRequest UserRole
 
-	if err := json.NewDecoder(c.Request.Body).Decode(&updateUserRequest); err != nil {
-		l.Info("error updating user", zap.Error(err))
+	if err := json.NewDecoder(c.Request.Body).Decode(&roleRequest); err != nil {
+		l.Info("error setting user role", zap.Error(err))
 		c.Status(http.StatusBadRequest)
 		return
 	}
 
-	if !isValidUpdateUserRequest(updateUserRequest, uid) {
-		l.Info("error updating user")
+	if !isValidUserRoleRequest(roleRequest) {
+		l.Info("error setting user role")
 		c.Status(http.StatusBadRequest)
 		return
 	}
 
-	user, err := s.db.UpdateUser(context.Background(), apiUser2DBUser(updateUserRequest)) //if I have two variables, I can still do combined if statement, like if user, err ... ; err != nil {}, but then user can only survive within the next 3 lines of if statement. So I can't return user variable at the bottom in c.JSON().
+	if isOwner(c, uid) {
+		l.Info("error setting user role, can't change your own role")
+		c.Status(http.StatusForbidden)
+		return
+	}
+
+	user, err := s.db.SetUserRole(context.Background(), uid, roleRequest.Role)
 	if err != nil {
 		if errors.Is(err, store.ErrNotFound) {
-			l.Info("error updating user", zap.Error(err))
+			l.Info("error setting user role", zap.Error(err))
 			c.Status(http.StatusNotFound)
 			return
 		}
-		l.Error("error updating user", zap.Error(err))
+		l.Error("error setting user role", zap.Error(err))
 		c.Status(http.StatusInternalServerError)
 		return
 	}
 
+	l.Info("user role changed", zap.String("user_uuid", uid.String()), zap.String("role", user.Role), zap.String("by", authorizedUser(c).String()))
+
 	c.JSON(http.StatusOK, dbUser2ApiUser(user))
 }
 
@@ -399,7 +2041,42 @@ func (s *Service) ListFridgeIngredients(c *gin.Context) {
 		return
 	}
 
-	fridgeIngredients, err := s.db.ListFridgeIngredients(context.Background(), uid)
+	if !isOwner(c, uid) {
+		l.Info("error listing fridge ingredients, forbidden")
+		c.Status(http.StatusForbidden)
+		return
+	}
+
+	var options FridgeListOptions
+
+	if err := c.ShouldBindQuery(&options); err != nil {
+		l.Info("error listing fridge ingredients", zap.Error(err))
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	if !isValidFridgeListOptions(options) {
+		l.Info("error listing fridge ingredients")
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	household, ok := s.activeHousehold(c, l, uid)
+	if !ok {
+		return
+	}
+
+	var fridgeIngredients []store.FridgeIngredient
+
+	if options.AsOf != "" { //replay the ledger up to then
+		asOf, _ := time.Parse(time.RFC3339, options.AsOf) //validated already
+
+		var events []store.FridgeEvent
+		events, err = s.db.ListFridgeEvents(context.Background(), household.HouseholdUUID, time.Time{}, asOf)
+		fridgeIngredients = store.ReplayFridgeEvents(events)
+	} else {
+		fridgeIngredients, err = s.db.ListFridgeIngredients(context.Background(), household.HouseholdUUID)
+	}
 	if err != nil {
 		// if errors.Is(err, store.ErrNotFound) {
 		// 	l.Info("error listing fridge ingredients", zap.Error(err))
@@ -416,6 +2093,11 @@ func (s *Service) ListFridgeIngredients(c *gin.Context) {
 		return
 	}
 
+	if options.GroupBy == fridgeGroupByIngredient {
+		amountsJSON(c, http.StatusOK, dbFIngrs2ApiGroups(fridgeIngredients))
+		return
+	}
+
 	var listFIngrResponse []FridgeIngredient
 
 	for _, f := range fridgeIngredients {
@@ -423,7 +2105,7 @@ func (s *Service) ListFridgeIngredients(c *gin.Context) {
 		listFIngrResponse = append(listFIngrResponse, fridgeIngredient)
 	}
 
-	c.JSON(http.StatusOK, listFIngrResponse)
+	amountsJSON(c, http.StatusOK, listFIngrResponse)
 }
 
 func (s *Service) CreateFridgeIngredient(c *gin.Context) {
@@ -443,6 +2125,23 @@ func (s *Service) CreateFridgeIngredient(c *gin.Context) {
 		return
 	}
 
+	if !isOwner(c, createFIngrRequest.UserUUID) {
+		l.Info("error creating fridge ingredient, forbidden")
+		c.Status(http.StatusForbidden)
+		return
+	}
+
+	household, ok := s.activeHousehold(c, l, createFIngrRequest.UserUUID)
+	if !ok {
+		return
+	}
+
+	if !canChangeFridge(household) {
+		l.Info("error creating fridge ingredient, viewer")
+		c.Status(http.StatusForbidden)
+		return
+	}
+
 	ingredient, err := s.db.GetIngredient(context.Background(), createFIngrRequest.IngredientUUID)
 	if err != nil {
 		l.Error("error creating fridge ingredient", zap.Error(err))
@@ -450,7 +2149,17 @@ func (s *Service) CreateFridgeIngredient(c *gin.Context) {
 		return
 	}
 
-	createFIngrRequest.ExpirationDate = createFIngrRequest.PurchasedDate.Add(24 * time.Hour * time.Duration(ingredient.DaysUntilExp))
+	if createFIngrRequest.Location == "" {
+		createFIngrRequest.Location = string(shelflife.Fridge)
+	}
+
+	var opened time.Time
+	if createFIngrRequest.OpenedDate != nil {
+		opened = *createFIngrRequest.OpenedDate
+	}
+
+	createFIngrRequest.ExpirationDate = shelflife.Expiry(dbIngr2Life(ingredient), createFIngrRequest.PurchasedDate, shelflife.Location(createFIngrRequest.Location), opened)
+	createFIngrRequest.HouseholdUUID = household.HouseholdUUID
 
 	fridgeIngredient, err := s.db.CreateFridgeIngredient(context.Background(), apiFIngr2DBFIngr(createFIngrRequest))
 	if err != nil {
@@ -459,7 +2168,7 @@ func (s *Service) CreateFridgeIngredient(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, dbFIngr2ApiFIngr(fridgeIngredient))
+	amountsJSON(c, http.StatusOK, dbFIngr2ApiFIngr(fridgeIngredient))
 }
 
 func (s *Service) UpdateFridgeIngredient(c *gin.Context) {
@@ -467,7 +2176,7 @@ func (s *Service) UpdateFridgeIngredient(c *gin.Context) {
 
 	id := c.Param("id")
 
-	uid, err := uuid.Parse(id)
+	fid, err := uuid.Parse(id)
 	if err != nil {
 		l.Info("error updating ingredient", zap.Error(err))
 		c.Status(http.StatusBadRequest)
@@ -482,12 +2191,29 @@ func (s *Service) UpdateFridgeIngredient(c *gin.Context) {
 		return
 	}
 
-	if !isValidUpdateFIngrRequest(updateFIngrRequest, uid) {
+	if !isValidUpdateFIngrRequest(updateFIngrRequest, fid) {
 		l.Info("error updating fridge ingredient")
 		c.Status(http.StatusBadRequest)
 		return
 	}
 
+	if !isOwner(c, updateFIngrRequest.UserUUID) {
+		l.Info("error updating fridge ingredient, forbidden")
+		c.Status(http.StatusForbidden)
+		return
+	}
+
+	household, ok := s.activeHousehold(c, l, updateFIngrRequest.UserUUID)
+	if !ok {
+		return
+	}
+
+	if !canChangeFridge(household) {
+		l.Info("error updating fridge ingredient, viewer")
+		c.Status(http.StatusForbidden)
+		return
+	}
+
 	ingredient, err := s.db.GetIngredient(context.Background(), updateFIngrRequest.IngredientUUID)
 	if err != nil {
 		l.Error("error upating fridge ingredient", zap.Error(err))
@@ -495,7 +2221,24 @@ func (s *Service) UpdateFridgeIngredient(c *gin.Context) {
 		return
 	}
 
-	updateFIngrRequest.ExpirationDate = updateFIngrRequest.PurchasedDate.Add(24 * time.Hour * time.Duration(ingredient.DaysUntilExp))
+	lot, err := s.db.GetFridgeIngredient(context.Background(), household.HouseholdUUID, fid)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			l.Info("error updating fridge ingredient", zap.Error(err))
+			c.Status(http.StatusNotFound)
+			return
+		}
+		l.Error("error updating fridge ingredient", zap.Error(err))
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	if updateFIngrRequest.Location == "" {
+		updateFIngrRequest.Location = string(shelflife.Fridge)
+	}
+
+	updateFIngrRequest.ExpirationDate = updatedExpiry(dbIngr2Life(ingredient), lot, updateFIngrRequest, s.now())
+	updateFIngrRequest.HouseholdUUID = household.HouseholdUUID
 
 	fridgeIngredient, err := s.db.UpdateFridgeIngredient(context.Background(), apiFIngr2DBFIngr(updateFIngrRequest))
 	if err != nil {
@@ -509,7 +2252,7 @@ func (s *Service) UpdateFridgeIngredient(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, dbFIngr2ApiFIngr(fridgeIngredient))
+	amountsJSON(c, http.StatusOK, dbFIngr2ApiFIngr(fridgeIngredient))
 }
 
 func (s *Service) DeleteFridgeIngredient(c *gin.Context) {
@@ -531,21 +2274,43 @@ func (s *Service) DeleteFridgeIngredient(c *gin.Context) {
 		return
 	}
 
-	// var deleteFIngrRequest DeleteFIngr
+	if !isOwner(c, uid) {
+		l.Info("error deleting fridge ingredient, forbidden")
+		c.Status(http.StatusForbidden)
+		return
+	}
+
+	household, ok := s.activeHousehold(c, l, uid)
+	if !ok {
+		return
+	}
+
+	if !canChangeFridge(household) {
+		l.Info("error deleting fridge ingredient, viewer")
+		c.Status(http.StatusForbidden)
+		return
+	}
+
+	var options DeleteFIngrOptions
 
-	// if err := json.NewDecoder(c.Request.Body).Decode(&deleteFIngrRequest); err != nil {
-	// 	l.Info("error deleting fridge ingredient", zap.Error(err))
-	// 	c.Status(http.StatusBadRequest)
-	// 	return
-	// }
+	if err := c.ShouldBindQuery(&options); err != nil {
+		l.Info("error deleting fridge ingredient", zap.Error(err))
+		c.Status(http.StatusBadRequest)
+		return
+	}
 
-	// if !isValidDeleteFIngrRequest(deleteFIngrRequest, uid) {
-	// 	l.Info("error deleting fridge ingredient")
-	// 	c.Status(http.StatusBadRequest)
-	// 	return
-	// }
+	if !isValidDeleteFIngrOptions(options) {
+		l.Info("error deleting fridge ingredient")
+		c.Status(http.StatusBadRequest)
+		return
+	}
 
-	if err := s.db.DeleteFridgeIngredient(context.Background(), uid, fid); err != nil {
+	if err := s.db.DeleteFridgeIngredient(context.Background(), apiDeleteFIngr2DBFridgeEvent(options, household.HouseholdUUID, uid, fid)); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			l.Info("error deleting fridge ingredient", zap.Error(err))
+			c.Status(http.StatusNotFound)
+			return
+		}
 		l.Error("error deleting fridge ingredient", zap.Error(err))
 		c.Status(http.StatusInternalServerError)
 		return
@@ -578,7 +2343,7 @@ func (s *Service) GetRecipe(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, dbRecipe2ApiRecipe(recipe))
+	amountsJSON(c, http.StatusOK, dbRecipe2ApiRecipe(recipe))
 }
 
 func (s *Service) ListRecipes(c *gin.Context) {
@@ -612,7 +2377,7 @@ func (s *Service) ListRecipes(c *gin.Context) {
 		listRecipesResponse = append(listRecipesResponse, r)
 	}
 
-	c.JSON(http.StatusOK, listRecipesResponse)
+	amountsJSON(c, http.StatusOK, listRecipesResponse)
 }
 
 func (s *Service) SearchRecipes(c *gin.Context) {
@@ -651,7 +2416,7 @@ func (s *Service) SearchRecipes(c *gin.Context) {
 		searchRecipesResponse = append(searchRecipesResponse, r)
 	}
 
-	c.JSON(http.StatusOK, searchRecipesResponse)
+	amountsJSON(c, http.StatusOK, searchRecipesResponse)
 }
 
 func (s *Service) CreateRecipe(c *gin.Context) {
@@ -671,6 +2436,12 @@ func (s *Service) CreateRecipe(c *gin.Context) {
 		return
 	}
 
+	if !isOwner(c, createRecipeRequest.UserUUID) {
+		l.Info("error creating recipe, forbidden")
+		c.Status(http.StatusForbidden)
+		return
+	}
+
 	recipe, err := s.db.CreateRecipe(context.Background(), apiRecipe2DBRecipe(createRecipeRequest))
 	if err != nil {
 		l.Error("error creating recipe", zap.Error(err))
@@ -678,7 +2449,7 @@ func (s *Service) CreateRecipe(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, dbRecipe2ApiRecipe(recipe))
+	amountsJSON(c, http.StatusOK, dbRecipe2ApiRecipe(recipe))
 }
 
 func (s *Service) UpdateRecipe(c *gin.Context) {
@@ -707,6 +2478,16 @@ func (s *Service) UpdateRecipe(c *gin.Context) {
 		return
 	}
 
+	if !isOwner(c, updateRecipeRequest.UserUUID) { //you can't hand your recipe over to someone else
+		l.Info("error updating recipe, forbidden")
+		c.Status(http.StatusForbidden)
+		return
+	}
+
+	if !s.isRecipeOwner(c, l, rid) { //and the recipe has to be yours in the first place
+		return
+	}
+
 	recipe, err := s.db.UpdateRecipe(context.Background(), apiRecipe2DBRecipe(updateRecipeRequest))
 	if err != nil {
 		if errors.Is(err, store.ErrNotFound) {
@@ -719,7 +2500,7 @@ func (s *Service) UpdateRecipe(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, dbRecipe2ApiRecipe(recipe))
+	amountsJSON(c, http.StatusOK, dbRecipe2ApiRecipe(recipe))
 }
 
 func (s *Service) DeleteRecipe(c *gin.Context) {
@@ -734,6 +2515,10 @@ func (s *Service) DeleteRecipe(c *gin.Context) {
 		return
 	}
 
+	if !s.isRecipeOwner(c, l, rid) {
+		return
+	}
+
 	if err = s.db.DeleteRecipe(context.Background(), rid); err != nil {
 		l.Error("error deleting recipe", zap.Error(err))
 		c.Status(http.StatusInternalServerError)
@@ -742,3 +2527,102 @@ func (s *Service) DeleteRecipe(c *gin.Context) {
 
 	c.Status(http.StatusOK)
 }
+
+func (s *Service) SuggestRecipes(c *gin.Context) {
+	l := s.l.Named("SuggestRecipes")
+
+	id := c.Param("id")
+
+	uid, err := uuid.Parse(id)
+	if err != nil {
+		l.Info("error suggesting recipes", zap.Error(err))
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	if !isOwner(c, uid) {
+		l.Info("error suggesting recipes, forbidden")
+		c.Status(http.StatusForbidden)
+		return
+	}
+
+	var options SuggestionOptions
+
+	if err := c.ShouldBindQuery(&options); err != nil {
+		l.Info("error suggesting recipes", zap.Error(err))
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	if !isValidSuggestionOptions(options) {
+		l.Info("error suggesting recipes")
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	household, ok := s.activeHousehold(c, l, uid)
+	if !ok {
+		return
+	}
+
+	now := s.now()
+
+	query := store.SuggestionQuery{
+		Now:            now,
+		WithinDays:     options.WithinDays,
+		CoverageWeight: 1,
+		Limit:          options.Limit,
+	}
+
+	if options.Mode == suggestionModeExpiring {
+		query.CoverageWeight, query.ExpiryWeight = options.CoverageWeight, options.ExpiryWeight
+	}
+
+	suggestions, err := s.db.SuggestRecipes(context.Background(), household.HouseholdUUID, query)
+	if err != nil {
+		l.Error("error suggesting recipes", zap.Error(err))
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	if len(suggestions) == 0 {
+		c.Status(http.StatusOK)
+		return
+	}
+
+	var suggestRecipesResponse []RecipeSuggestion
+
+	for _, suggestion := range suggestions { //ranked already
+		r := dbSuggestion2ApiSuggestion(&suggestion, now)
+		if options.Mode == suggestionModeExpiring {
+			r.Score, r.Explanations = suggestion.Score, explainSuggestion(&suggestion, options.WithinDays, now)
+		}
+		suggestRecipesResponse = append(suggestRecipesResponse, r)
+	}
+
+	amountsJSON(c, http.StatusOK, suggestRecipesResponse)
+}
+
+// isRecipeOwner looks the recipe up and checks that it belongs to the authenticated user.
+// When it returns false the response status is already written, the handler only has to return.
+func (s *Service) isRecipeOwner(c *gin.Context, l *zap.Logger, rid uuid.UUID) bool {
+	recipe, err := s.db.GetRecipe(context.Background(), rid)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			l.Info("error checking recipe owner", zap.Error(err))
+			c.Status(http.StatusNotFound)
+			return false
+		}
+		l.Error("error checking recipe owner", zap.Error(err))
+		c.Status(http.StatusInternalServerError)
+		return false
+	}
+
+	if !isOwner(c, recipe.UserUUID) {
+		l.Info("error checking recipe owner, forbidden")
+		c.Status(http.StatusForbidden)
+		return false
+	}
+
+	return true
+}
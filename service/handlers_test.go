@@ -3,26 +3,136 @@ package service
 import (
 	"bytes"
 	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
-	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"strings"
 	"testing"
 	"time"
 
+	"wdiet/hasher"
+	"wdiet/lockout"
+	"wdiet/mailer"
+	"wdiet/mailer/memory"
+	"wdiet/notifier"
+	"wdiet/notifier/logsink"
+	"wdiet/oidc"
+	"wdiet/oidc/oidctest"
 	"wdiet/store"
 	"wdiet/store/mockstore"
+	"wdiet/totp"
+	"wdiet/units"
 
 	"github.com/golang-jwt/jwt/v4"
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
 )
 
 var l = zap.NewNop()
 
-var testServer = New(&mockstore.Mockstore{}, l)
+var testMailer = &memory.Mailer{}
+
+var testDigests = logsink.New(l)
+
+var testServer = New(&mockstore.Mockstore{}, l, Config{Keys: newTestKeySet(), Mailer: testMailer, PublicURL: "https://wdiet.test", Hasher: testHasher,
+	DigestChannels: map[string]notifier.Channel{"email": testDigests, "webhook": testDigests}})
+
+// newTestLockout gives a test its own login attempt counters, so failures from other tests don't throttle it.
+func newTestLockout() *lockout.Tracker {
+	return lockout.New(lockout.NewMemory(), lockout.DefaultAccountPolicy, lockout.DefaultIPPolicy)
+}
+
+var testHasher = hasher.Bcrypt{Cost: bcrypt.MinCost} //what the mockstore hashes with, so nothing needs a rehash unless a test wants it
+
+var testPreviousSecret = []byte("jyoonieisthebestandsheisprettyandsheissmart")
+
+// newTestKeySet signs with a fresh ed25519 key and also accepts an HS512 key we "rotated away" from, plus a verify-only RSA key.
+func newTestKeySet() *KeySet {
+	edPublic, edPrivate, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+
+	rsaPrivate, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+
+	current := &signingKey{kid: "current", method: jwt.SigningMethodEdDSA, signKey: edPrivate, verifyKey: edPublic}
+
+	return &KeySet{
+		signing: current,
+		keys: map[string]*signingKey{
+			"current":  current,
+			"previous": {kid: "previous", method: jwt.SigningMethodHS512, signKey: testPreviousSecret, verifyKey: testPreviousSecret},
+			"rsa":      {kid: "rsa", method: jwt.SigningMethodRS256, verifyKey: &rsaPrivate.PublicKey},
+		},
+	}
+}
+
+var testUserUUID = uuid.MustParse("080b5f09-527b-4581-bb56-19adbfe50ebf")
+
+var testRecipeOwnerUUID = uuid.MustParse("2c98fff4-7ccc-4536-8259-67a88380e99c") //owner of the recipes the mockstore hands out
+
+var testHouseholdUUID = uuid.MustParse("5e1f0a8c-3b7d-4c2e-9f61-2d8a7b4c0e13") //the mockstore's active household
+
+// authorize signs a token for id and puts it on the request, so the request gets past ValidateToken.
+func authorize(t *testing.T, req *http.Request, id uuid.UUID) {
+	t.Helper()
+	authorizeAs(t, req, id, store.RoleUser)
+}
+
+// authorizeAs is authorize with a role other than user. The mockstore has to agree on the role, see statusWithRole.
+func authorizeAs(t *testing.T, req *http.Request, id uuid.UUID, role string) {
+	t.Helper()
+	authorizeToken(t, req, id, role, nil)
+}
+
+// authorizeLoggedIn is authorize with a token from a login at loggedInAt, instead of one that could be from a refresh.
+func authorizeLoggedIn(t *testing.T, req *http.Request, id uuid.UUID, loggedInAt time.Time) {
+	t.Helper()
+	authorizeToken(t, req, id, store.RoleUser, jwt.NewNumericDate(loggedInAt))
+}
+
+func authorizeToken(t *testing.T, req *http.Request, id uuid.UUID, role string, authTime *jwt.NumericDate) {
+	t.Helper()
+
+	now := testServer.now() //ValidateToken checks the token at the service's clock, pinned or not
+
+	claims := Claims{
+		Role:     role,
+		AuthTime: authTime,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(now.Add(24 * time.Hour)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			Issuer:    "whatDoIEatToday",
+			Subject:   id.String(),
+			ID:        uuid.NewString(),
+			Audience:  []string{"whatDoIEatToday"},
+		},
+	}
+
+	signedToken, err := testServer.keys.sign(claims)
+	assert.NoError(t, err, "unexpected error signing the token")
+
+	req.Header.Set("Authorization", "Bearer "+signedToken)
+}
+
+// statusWithRole is a GetUserStatusOverride for an active, verified user with role.
+func statusWithRole(role string) func(ctx context.Context, id uuid.UUID) (*store.UserStatus, error) {
+	return func(ctx context.Context, id uuid.UUID) (*store.UserStatus, error) {
+		return &store.UserStatus{Active: true, EmailVerified: true, Role: role}, nil
+	}
+}
 
 func TestPing(t *testing.T) {
 	testcases := []struct {
@@ -57,26 +167,65 @@ func TestLogin(t *testing.T) {
 	testcases := []struct {
 		name               string
 		getUserByEmailFunc func(ctx context.Context, email string) (*store.User, error)
+		createRefreshFunc  func(ctx context.Context, t store.RefreshToken) (*store.RefreshToken, error)
 		requestBody        Login
 		expectedStatus     int
 	}{
 		{
 			"happyPath",
 			nil,
+			nil,
 			Login{EmailAddress: "jywoo92324@gmail.com", Password: "hello"},
 			http.StatusOK,
 		},
 		{
 			"badRequest",
 			nil,
+			nil,
 			Login{EmailAddress: "", Password: "hello"},
 			http.StatusBadRequest,
 		},
+		{
+			"unauthorized:unknownEmail", //looks exactly like a wrong password
+			func(ctx context.Context, email string) (*store.User, error) {
+				return nil, store.ErrNotFound
+			},
+			nil,
+			Login{EmailAddress: "nobody@gmail.com", Password: "hello"},
+			http.StatusUnauthorized,
+		},
+		{
+			"unauthorized:wrongPassword",
+			nil,
+			nil,
+			Login{EmailAddress: "jywoo92324@gmail.com", Password: "potatoes"},
+			http.StatusUnauthorized,
+		},
 		{
 			"internalServerError",
 			func(ctx context.Context, email string) (*store.User, error) {
 				return nil, errors.New("internalServerError")
 			},
+			nil,
+			Login{EmailAddress: "jywoo92324@gmail.com", Password: "hello"},
+			http.StatusInternalServerError,
+		},
+		{
+			"forbidden:deactivated",
+			func(ctx context.Context, email string) (*store.User, error) {
+				hashedPassword, err := bcrypt.GenerateFromPassword([]byte("hello"), bcrypt.MinCost)
+				return &store.User{UserUUID: testUserUUID, HashedPassword: string(hashedPassword), Active: false, EmailAddress: email}, err
+			},
+			nil,
+			Login{EmailAddress: "jywoo92324@gmail.com", Password: "hello"},
+			http.StatusForbidden,
+		},
+		{
+			"internalServerError:refreshToken",
+			nil,
+			func(ctx context.Context, t store.RefreshToken) (*store.RefreshToken, error) {
+				return nil, errors.New("internalServerError")
+			},
 			Login{EmailAddress: "jywoo92324@gmail.com", Password: "hello"},
 			http.StatusInternalServerError,
 		},
@@ -90,7 +239,8 @@ func TestLogin(t *testing.T) {
 			req := httptest.NewRequest(http.MethodPost, "/login", bytes.NewBuffer(reqBody))
 			w := httptest.NewRecorder()
 
-			testServer.db = &mockstore.Mockstore{GetUserByEmailOverride: testcase.getUserByEmailFunc}
+			testServer.db = &mockstore.Mockstore{GetUserByEmailOverride: testcase.getUserByEmailFunc, CreateRefreshTokenOverride: testcase.createRefreshFunc}
+			testServer.lockout = newTestLockout()
 			testServer.r.ServeHTTP(w, req)
 
 			assert.Equal(t, testcase.expectedStatus, w.Code)
@@ -101,112 +251,140 @@ func TestLogin(t *testing.T) {
 				err = json.Unmarshal(w.Body.Bytes(), &resBody)
 				assert.NoError(t, err, "unexpected error unmarshalling the response body")
 
-				tkn, err := jwt.Parse(resBody.Token,
-					func(t *jwt.Token) (interface{}, error) {
-						if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
-							return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
-						}
-						return testServer.mySigningKey, nil
-					},
-					jwt.WithValidMethods([]string{testServer.mySigningMethod.Alg()}),
-				)
+				tkn, err := jwt.Parse(resBody.Token, testServer.keys.keyFunc, jwt.WithValidMethods(testServer.keys.algs()))
 				assert.NoError(t, err, "unexpected error parsing the token")
 
 				assert.Equal(t, true, tkn.Valid)
+				assert.Equal(t, "current", tkn.Header["kid"])
+				assert.NotNil(t, tkn.Claims.(jwt.MapClaims)["auth_time"], "a login says when it happened")
+				assert.NotEmpty(t, resBody.RefreshToken)
 			}
 		})
 	}
 }
 
-func TestValidateToken(t *testing.T) {
-	claims := jwt.RegisteredClaims{
-		// A usual scenario is to set the expiration time relative to the current time
-		ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
-		IssuedAt:  jwt.NewNumericDate(time.Now()),
-		NotBefore: jwt.NewNumericDate(time.Now()),
-		Issuer:    "whatDoIEatToday",
-		ID:        "080b5f09-527b-4581-bb56-19adbfe50ebf",
-		Audience:  []string{"whatDoIEatToday"},
+func TestLoginThrottle(t *testing.T) {
+	var recorded []store.LockoutEvent
+
+	testServer.db = &mockstore.Mockstore{
+		CreateLockoutEventOverride: func(ctx context.Context, e store.LockoutEvent) (*store.LockoutEvent, error) {
+			recorded = append(recorded, e)
+			return &e, nil
+		},
+	}
+	testServer.lockout = lockout.New(lockout.NewMemory(),
+		lockout.Policy{FreeAttempts: 1, BaseDelay: time.Minute, MaxDelay: time.Hour, LockoutAfter: 2, LockoutFor: time.Hour, Window: time.Hour},
+		lockout.DefaultIPPolicy)
+	defer func() { testServer.lockout = newTestLockout() }()
+
+	login := func(password string) *httptest.ResponseRecorder {
+		reqBody, err := json.Marshal(Login{EmailAddress: "jywoo92324@gmail.com", Password: password})
+		assert.NoError(t, err, "unexpected error marshalling the request body")
+
+		req := httptest.NewRequest(http.MethodPost, "/login", bytes.NewBuffer(reqBody))
+		w := httptest.NewRecorder()
+		testServer.r.ServeHTTP(w, req)
+		return w
 	}
 
-	token := jwt.NewWithClaims(testServer.mySigningMethod, claims)
-	signedToken, err := token.SignedString(testServer.mySigningKey)
-	assert.NoError(t, err, "unexpected error signing the token")
+	assert.Equal(t, http.StatusUnauthorized, login("potatoes").Code)
+	assert.Empty(t, recorded)
 
-	testcases := []struct {
-		name           string
-		authHeader     string
-		expecterStatus int
-	}{
-		{
-			"happyPath",
-			"Bearer " + signedToken,
-			http.StatusOK,
-		},
-		{
-			"invalidToken",
-			"Bearer " + "potatoes",
-			http.StatusUnauthorized,
-		},
-		{
-			"missingToken",
-			"Bearer " + "",
-			http.StatusUnauthorized,
-		},
-		{
-			"emptyHeader", //panic: tried to access part of an array that didn't exist, 왜냐하면 bearer 부분이 없기 때문 ㅋㅋ... 근데 "abc"가 아니라 아예 ""로 보내면 핸들러에서 toekn == ""에 걸리기 때문에, 그 뒤에 array access할 것도 없이 return되버리므로 panic이 안 났던것임..
-			"abc",
-			http.StatusUnauthorized,
-		},
+	assert.Equal(t, http.StatusUnauthorized, login("potatoes").Code)
+	assert.Len(t, recorded, 1, "the second failure should lock the account")
+	if len(recorded) == 1 {
+		assert.Equal(t, lockout.ScopeAccount, recorded[0].Scope)
+		assert.Equal(t, "jywoo92324@gmail.com", recorded[0].Subject)
+		assert.Equal(t, 2, recorded[0].Failures)
 	}
 
-	testServer.r.GET("/testValidateToken", testServer.ValidateToken)
+	w := login("hello") //right password, still locked
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "3600", w.Header().Get("Retry-After"))
+}
 
-	for _, testcase := range testcases {
-		t.Run(testcase.name, func(t *testing.T) {
-			req := httptest.NewRequest(http.MethodGet, "/testValidateToken", nil) //request body가 없어도 밑에 줄에서 header는 set할 수 있음. 밑에 줄이 중요한거. 이 new request는 어떤 request든 걍 명목적인거.
-			req.Header.Set("Authorization", testcase.authHeader)
-			w := httptest.NewRecorder()
+func TestLoginThrottleForwardedFor(t *testing.T) {
+	ipPolicy := lockout.Policy{FreeAttempts: 1, BaseDelay: time.Minute, MaxDelay: time.Hour, LockoutAfter: 2, LockoutFor: time.Hour, Window: time.Hour}
 
-			testServer.r.ServeHTTP(w, req)
+	login := func(server *Service, email, forwardedFor string) int {
+		reqBody, err := json.Marshal(Login{EmailAddress: email, Password: "potatoes"})
+		assert.NoError(t, err, "unexpected error marshalling the request body")
 
-			assert.Equal(t, testcase.expecterStatus, w.Code)
-		})
+		req := httptest.NewRequest(http.MethodPost, "/login", bytes.NewBuffer(reqBody)) //from 192.0.2.1
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		w := httptest.NewRecorder()
+		server.r.ServeHTTP(w, req)
+		return w.Code
 	}
+
+	t.Run("notTrusted", func(t *testing.T) {
+		testServer.db = &mockstore.Mockstore{}
+		testServer.lockout = lockout.New(lockout.NewMemory(), lockout.DefaultAccountPolicy, ipPolicy)
+		defer func() { testServer.lockout = newTestLockout() }()
+
+		assert.Equal(t, http.StatusUnauthorized, login(testServer, "a@gmail.com", "198.51.100.1"))
+		assert.Equal(t, http.StatusUnauthorized, login(testServer, "b@gmail.com", "198.51.100.2"))
+		assert.Equal(t, http.StatusTooManyRequests, login(testServer, "c@gmail.com", "198.51.100.3"), "a new X-Forwarded-For shouldn't reset the ip's failures")
+	})
+
+	t.Run("trustedProxy", func(t *testing.T) {
+		server := New(&mockstore.Mockstore{}, l, Config{Keys: newTestKeySet(), Mailer: testMailer, PublicURL: "https://wdiet.test", Hasher: testHasher, TrustedProxies: []string{"192.0.2.0/24"},
+			Lockout: lockout.New(lockout.NewMemory(), lockout.DefaultAccountPolicy, ipPolicy)})
+
+		assert.Equal(t, http.StatusUnauthorized, login(server, "a@gmail.com", "198.51.100.1"))
+		assert.Equal(t, http.StatusUnauthorized, login(server, "b@gmail.com", "198.51.100.1"))
+		assert.Equal(t, http.StatusUnauthorized, login(server, "c@gmail.com", "198.51.100.2"), "behind our proxy it's a different client")
+		assert.Equal(t, http.StatusTooManyRequests, login(server, "d@gmail.com", "198.51.100.1"))
+	})
 }
 
-func TestGetUser(t *testing.T) {
+func TestListLockoutEvents(t *testing.T) {
 	testcases := []struct {
 		name                   string
-		getUserOverrideFunc    func(ctx context.Context, id uuid.UUID) (*store.User, error)
-		requestBody            string
-		expectedResponse       *User
+		listOverrideFunc       func(ctx context.Context, limit int) ([]store.LockoutEvent, error)
+		requestRole            string
+		requestQuery           string
+		expectedResponse       []LockoutEvent
 		expectedResponseStatus int
 	}{
 		{
 			"happyPath",
 			nil,
-			"080b5f09-527b-4581-bb56-19adbfe50ebf",
-			&User{UserUUID: uuid.MustParse("080b5f09-527b-4581-bb56-19adbfe50ebf"),
-				Active:       true,
-				FirstName:    "jy",
-				LastName:     "woo",
-				EmailAddress: "jywoo92324@gmail.com"},
+			store.RoleAdmin,
+			"",
+			[]LockoutEvent{{
+				LockoutEventUUID: uuid.MustParse("7d4f1e1e-9a7b-4b0e-8f5e-3f1c2b6a9d10"),
+				Scope:            "account",
+				Subject:          "jywoo92324@gmail.com",
+				Failures:         10,
+				LockedUntil:      time.Date(2022, 12, 25, 0, 15, 0, 0, time.UTC),
+				CreatedAt:        time.Date(2022, 12, 25, 0, 0, 0, 0, time.UTC),
+			}},
 			http.StatusOK,
 		},
 		{
 			"badRequest",
 			nil,
-			"badrequesthehehe",
+			store.RoleAdmin,
+			"?limit=0",
 			nil,
 			http.StatusBadRequest,
 		},
+		{
+			"forbidden:moderator",
+			nil,
+			store.RoleModerator,
+			"",
+			nil,
+			http.StatusForbidden,
+		},
 		{
 			"internalServerError",
-			func(ctx context.Context, id uuid.UUID) (*store.User, error) {
+			func(ctx context.Context, limit int) ([]store.LockoutEvent, error) {
 				return nil, errors.New("internalServerError")
 			},
-			"080b5f09-527b-4581-bb56-19adbfe50ebf",
+			store.RoleAdmin,
+			"",
 			nil,
 			http.StatusInternalServerError,
 		},
@@ -214,83 +392,206 @@ func TestGetUser(t *testing.T) {
 
 	for _, testcase := range testcases {
 		t.Run(testcase.name, func(t *testing.T) {
-			req := httptest.NewRequest(http.MethodGet, "/users/"+testcase.requestBody, nil)
+			req := httptest.NewRequest(http.MethodGet, "/admin/lockout_events"+testcase.requestQuery, nil)
+			authorizeAs(t, req, testUserUUID, testcase.requestRole)
 			w := httptest.NewRecorder()
 
-			testServer.db = &mockstore.Mockstore{GetUserOverride: testcase.getUserOverrideFunc}
+			testServer.db = &mockstore.Mockstore{ListLockoutEventsOverride: testcase.listOverrideFunc, GetUserStatusOverride: statusWithRole(testcase.requestRole)}
 			testServer.r.ServeHTTP(w, req)
 
 			assert.Equal(t, testcase.expectedResponseStatus, w.Code)
 
-			if testcase.expectedResponse != nil { //if you have testcase.expectedResponse, check if it's not nil. Otherwise, you can just check if the testcase.expectedStatus is http.ok like in Login handler test.
-				var resBody User
+			if testcase.expectedResponse != nil {
+				var resBody []LockoutEvent
 
 				err := json.Unmarshal(w.Body.Bytes(), &resBody)
 				assert.NoError(t, err, "unexpected error unmarshalling the response body")
 
-				assert.Equal(t, *testcase.expectedResponse, resBody)
-				// assert.Equal(t, testcase.expectedResponse.UserUUID, resBody.UserUUID)
-				// assert.Equal(t, testcase.expectedResponse.Active, resBody.Active)
-				// assert.Equal(t, testcase.expectedResponse.FirstName, resBody.FirstName)
-				// assert.Equal(t, testcase.expectedResponse.LastName, resBody.LastName)
-				// assert.Equal(t, testcase.expectedResponse.EmailAddress, resBody.EmailAddress)
-			} else {
-				assert.Equal(t, 0, w.Body.Len())
+				assert.Equal(t, testcase.expectedResponse, resBody)
 			}
 		})
 	}
 }
 
-func TestCreateUser(t *testing.T) {
-	type createUserRequest struct {
-		User
-		Password string
+var testTOTPSecret = "JBSWY3DPEHPK3PXP"
+
+var testNow = time.Date(2022, 12, 25, 0, 1, 0, 0, time.UTC) //the mockstore's login challenge is good until 00:05
+
+// pinClock makes the service think it's testNow until the test is done.
+func pinClock(t *testing.T) {
+	testServer.now = func() time.Time { return testNow }
+	t.Cleanup(func() { testServer.now = time.Now })
+}
+
+func enabledTOTP(ctx context.Context, uid uuid.UUID) (*store.TOTP, error) {
+	enabledAt := time.Date(2022, 12, 1, 0, 0, 0, 0, time.UTC)
+	return &store.TOTP{UserUUID: uid, Secret: testTOTPSecret, EnabledAt: &enabledAt, LastStep: 1}, nil
+}
+
+func TestLoginTwoFactorRequired(t *testing.T) {
+	pinClock(t)
+
+	var created store.LoginChallenge
+
+	testServer.lockout = newTestLockout()
+	testServer.db = &mockstore.Mockstore{
+		GetTOTPOverride: enabledTOTP,
+		CreateLoginChallengeOverride: func(ctx context.Context, c store.LoginChallenge) (*store.LoginChallenge, error) {
+			created = c
+			return &c, nil
+		},
+		CreateRefreshTokenOverride: func(ctx context.Context, rt store.RefreshToken) (*store.RefreshToken, error) {
+			t.Error("no refresh token before the second factor")
+			return &rt, nil
+		},
 	}
 
-	goodUser := createUserRequest{
-		User: User{
-			Active:       true,
-			FirstName:    "jy",
-			LastName:     "woo",
-			EmailAddress: "jywoo92324@gmail.com"},
-		Password: "abcdefgh"}
+	reqBody, err := json.Marshal(Login{EmailAddress: "jywoo92324@gmail.com", Password: "hello"})
+	assert.NoError(t, err, "unexpected error marshalling the request body")
 
-	badUser := createUserRequest{
-		User: User{
-			Active:       true,
-			FirstName:    "",
-			LastName:     "",
-			EmailAddress: "jywoo92324@gmail.com"},
-		Password: "abcdefgh"}
+	req := httptest.NewRequest(http.MethodPost, "/login", bytes.NewBuffer(reqBody))
+	w := httptest.NewRecorder()
+	testServer.r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var resBody TwoFactorChallenge
+
+	err = json.Unmarshal(w.Body.Bytes(), &resBody)
+	assert.NoError(t, err, "unexpected error unmarshalling the response body")
+
+	assert.True(t, resBody.TwoFactorRequired)
+	assert.NotEmpty(t, resBody.ChallengeToken)
+	assert.Equal(t, hashToken(resBody.ChallengeToken), created.HashedToken)
+	assert.Equal(t, testUserUUID, created.UserUUID)
+	assert.Equal(t, testNow.Add(5*time.Minute), created.ExpiresAt)
+	assert.NotContains(t, w.Body.String(), "refresh_token")
+}
+
+func TestLoginTwoFactor(t *testing.T) {
+	pinClock(t)
+
+	code, err := totp.Code(testTOTPSecret, testNow)
+	assert.NoError(t, err)
+
+	lateChallenge := func(ctx context.Context, hashedToken string) (*store.LoginChallenge, error) {
+		return &store.LoginChallenge{LoginChallengeUUID: uuid.New(), UserUUID: testUserUUID, Attempts: 1, ExpiresAt: testNow.Add(-time.Second)}, nil
+	}
 
 	testcases := []struct {
-		name                   string
-		createUserOverrideFunc func(ctx context.Context, u store.User) (*store.User, error)
-		requestBody            createUserRequest
-		expectedResponse       *User
-		expectedResponseStatus int
+		name               string
+		attemptFunc        func(ctx context.Context, hashedToken string) (*store.LoginChallenge, error)
+		useStepFunc        func(ctx context.Context, uid uuid.UUID, step int64) (bool, error)
+		useRecoveryFunc    func(ctx context.Context, uid uuid.UUID, hashedCode string) error
+		useChallengeFunc   func(ctx context.Context, id uuid.UUID) error
+		requestBody        TwoFactorLogin
+		expectedStatusCode int
 	}{
 		{
 			"happyPath",
 			nil,
-			goodUser,
-			&goodUser.User,
+			func(ctx context.Context, uid uuid.UUID, step int64) (bool, error) {
+				return step == totp.Step(testNow), nil
+			},
+			nil,
+			nil,
+			TwoFactorLogin{ChallengeToken: "potatoes", Code: code},
+			http.StatusOK,
+		},
+		{
+			"happyPath:recoveryCode",
+			nil,
+			nil,
+			func(ctx context.Context, uid uuid.UUID, hashedCode string) error {
+				if hashedCode != hashRecoveryCode("k3j9a-x2mqp") {
+					return store.ErrNotFound
+				}
+				return nil
+			},
+			nil,
+			TwoFactorLogin{ChallengeToken: "potatoes", Code: "K3J9AX2MQP"},
 			http.StatusOK,
 		},
 		{
 			"badRequest",
 			nil,
-			badUser,
 			nil,
+			nil,
+			nil,
+			TwoFactorLogin{ChallengeToken: "potatoes"},
 			http.StatusBadRequest,
 		},
+		{
+			"unauthorized:wrongCode",
+			nil,
+			nil,
+			nil,
+			nil,
+			TwoFactorLogin{ChallengeToken: "potatoes", Code: "000000"},
+			http.StatusUnauthorized,
+		},
+		{
+			"unauthorized:codeReused",
+			nil,
+			func(ctx context.Context, uid uuid.UUID, step int64) (bool, error) {
+				return false, nil
+			},
+			nil,
+			nil,
+			TwoFactorLogin{ChallengeToken: "potatoes", Code: code},
+			http.StatusUnauthorized,
+		},
+		{
+			"unauthorized:unknownChallenge",
+			func(ctx context.Context, hashedToken string) (*store.LoginChallenge, error) {
+				return nil, store.ErrNotFound
+			},
+			nil,
+			nil,
+			nil,
+			TwoFactorLogin{ChallengeToken: "potatoes", Code: code},
+			http.StatusUnauthorized,
+		},
+		{
+			"unauthorized:expiredChallenge",
+			lateChallenge,
+			nil,
+			nil,
+			nil,
+			TwoFactorLogin{ChallengeToken: "potatoes", Code: code},
+			http.StatusUnauthorized,
+		},
+		{
+			"unauthorized:tooManyAttempts",
+			func(ctx context.Context, hashedToken string) (*store.LoginChallenge, error) {
+				return &store.LoginChallenge{LoginChallengeUUID: uuid.New(), UserUUID: testUserUUID, Attempts: 6, ExpiresAt: testNow.Add(time.Minute)}, nil
+			},
+			nil,
+			nil,
+			nil,
+			TwoFactorLogin{ChallengeToken: "potatoes", Code: code},
+			http.StatusUnauthorized,
+		},
+		{
+			"unauthorized:challengeUsedTwice",
+			nil,
+			nil,
+			nil,
+			func(ctx context.Context, id uuid.UUID) error {
+				return store.ErrRevoked
+			},
+			TwoFactorLogin{ChallengeToken: "potatoes", Code: code},
+			http.StatusUnauthorized,
+		},
 		{
 			"internalServerError",
-			func(ctx context.Context, u store.User) (*store.User, error) {
+			func(ctx context.Context, hashedToken string) (*store.LoginChallenge, error) {
 				return nil, errors.New("internalServerError")
 			},
-			goodUser,
 			nil,
+			nil,
+			nil,
+			TwoFactorLogin{ChallengeToken: "potatoes", Code: code},
 			http.StatusInternalServerError,
 		},
 	}
@@ -300,222 +601,278 @@ func TestCreateUser(t *testing.T) {
 			reqBody, err := json.Marshal(testcase.requestBody)
 			assert.NoError(t, err, "unexpected error marshalling the request body")
 
-			req := httptest.NewRequest(http.MethodPost, "/users", bytes.NewBuffer(reqBody))
+			req := httptest.NewRequest(http.MethodPost, "/login/2fa", bytes.NewBuffer(reqBody))
 			w := httptest.NewRecorder()
 
-			testServer.db = &mockstore.Mockstore{CreateUserOverride: testcase.createUserOverrideFunc}
+			testServer.lockout = newTestLockout()
+			testServer.db = &mockstore.Mockstore{
+				GetTOTPOverride:               enabledTOTP,
+				AttemptLoginChallengeOverride: testcase.attemptFunc,
+				UseTOTPStepOverride:           testcase.useStepFunc,
+				UseRecoveryCodeOverride:       testcase.useRecoveryFunc,
+				UseLoginChallengeOverride:     testcase.useChallengeFunc,
+			}
 			testServer.r.ServeHTTP(w, req)
 
-			assert.Equal(t, testcase.expectedResponseStatus, w.Code)
+			assert.Equal(t, testcase.expectedStatusCode, w.Code)
 
-			if testcase.expectedResponse != nil {
-				var resBody User
+			if testcase.expectedStatusCode == http.StatusOK {
+				var resBody Token
 
-				err := json.Unmarshal(w.Body.Bytes(), &resBody)
+				err = json.Unmarshal(w.Body.Bytes(), &resBody)
 				assert.NoError(t, err, "unexpected error unmarshalling the response body")
 
-				assert.NotEqual(t, resBody.UserUUID, uuid.Nil) //uuid가 랜덤으로 generate 됐기 때문에, 그냥 response uuid가 uuid Nil이 아닌지만 검사.
-				//assert.Equal(t, *testcase.expectedResponse, resBody)
-				assert.Equal(t, testcase.expectedResponse.Active, resBody.Active)
-				assert.Equal(t, testcase.expectedResponse.FirstName, resBody.FirstName)
-				assert.Equal(t, testcase.expectedResponse.LastName, resBody.LastName)
-				assert.Equal(t, testcase.expectedResponse.EmailAddress, resBody.EmailAddress)
-			} else {
-				assert.Equal(t, 0, w.Body.Len())
+				assert.NotEmpty(t, resBody.Token)
+				assert.NotEmpty(t, resBody.RefreshToken)
 			}
 		})
 	}
 }
 
-func TestUpdateUser(t *testing.T) {
-	goodUser := User{ //존 왈, requestBody랑 expectedResponse가 완전히 똑같으므로, 그냥 여기에 하나를 정의해서 복붙해라 ㅋㅋ
-		UserUUID:     uuid.MustParse("080b5f09-527b-4581-bb56-19adbfe50ebf"),
-		Active:       true,
-		FirstName:    "jy",
-		LastName:     "woo",
-		EmailAddress: "jywoo92324@gmail.com",
+func TestLoginTwoFactorLockout(t *testing.T) {
+	pinClock(t)
+
+	code, err := totp.Code(testTOTPSecret, testNow)
+	assert.NoError(t, err)
+
+	var recorded []store.LockoutEvent
+
+	testServer.db = &mockstore.Mockstore{
+		GetTOTPOverride: enabledTOTP,
+		CreateLockoutEventOverride: func(ctx context.Context, e store.LockoutEvent) (*store.LockoutEvent, error) {
+			recorded = append(recorded, e)
+			return &e, nil
+		},
+	}
+	testServer.lockout = lockout.New(lockout.NewMemory(),
+		lockout.Policy{FreeAttempts: 2, BaseDelay: time.Minute, MaxDelay: time.Hour, LockoutAfter: 3, LockoutFor: time.Hour, Window: time.Hour},
+		lockout.DefaultIPPolicy)
+	defer func() { testServer.lockout = newTestLockout() }()
+
+	post := func(path string, body interface{}) *httptest.ResponseRecorder {
+		reqBody, err := json.Marshal(body)
+		assert.NoError(t, err, "unexpected error marshalling the request body")
+
+		req := httptest.NewRequest(http.MethodPost, path, bytes.NewBuffer(reqBody))
+		w := httptest.NewRecorder()
+		testServer.r.ServeHTTP(w, req)
+		return w
+	}
+	login := func() (int, string) {
+		w := post("/login", Login{EmailAddress: "jywoo92324@gmail.com", Password: "hello"})
+
+		var resBody TwoFactorChallenge
+		if w.Code == http.StatusOK {
+			err := json.Unmarshal(w.Body.Bytes(), &resBody)
+			assert.NoError(t, err, "unexpected error unmarshalling the response body")
+		}
+		return w.Code, resBody.ChallengeToken
 	}
 
-	badUser := User{
-		UserUUID:     uuid.MustParse("080b5f09-527b-4581-bb56-19adbfe50ebf"),
-		Active:       true,
-		FirstName:    "",
-		LastName:     "",
-		EmailAddress: "jywoo92324@gmail.com",
+	var challenge string
+	for i := 0; i < 3; i++ { //the right password gets a fresh challenge every time, each one with its own retries
+		var status int
+		status, challenge = login()
+		assert.Equal(t, http.StatusOK, status)
+		assert.Equal(t, http.StatusUnauthorized, post("/login/2fa", TwoFactorLogin{ChallengeToken: challenge, Code: "000000"}).Code)
+	}
+
+	if assert.Len(t, recorded, 1, "the third wrong code should lock the account") {
+		assert.Equal(t, lockout.ScopeAccount, recorded[0].Scope)
+		assert.Equal(t, "jywoo92324@gmail.com", recorded[0].Subject)
 	}
 
+	status, _ := login()
+	assert.Equal(t, http.StatusTooManyRequests, status, "no new challenge while locked")
+
+	w := post("/login/2fa", TwoFactorLogin{ChallengeToken: challenge, Code: code}) //the right code, still locked
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "3600", w.Header().Get("Retry-After"))
+}
+
+func TestStartTwoFactor(t *testing.T) {
 	testcases := []struct {
 		name                   string
-		updateUserOverrideFunc func(ctx context.Context, u store.User) (*store.User, error)
-		requestBody            User
-		expectedResponse       *User
+		startOverrideFunc      func(ctx context.Context, t store.TOTP, hashedRecoveryCodes []string) (*store.TOTP, error)
+		requestPath            string
 		expectedResponseStatus int
 	}{
 		{
 			"happyPath",
 			nil,
-			goodUser,
-			&goodUser,
+			"080b5f09-527b-4581-bb56-19adbfe50ebf",
 			http.StatusOK,
 		},
 		{
-			"badRequest",
-			nil,
-			badUser,
+			"forbidden",
 			nil,
-			http.StatusBadRequest,
+			"2c98fff4-7ccc-4536-8259-67a88380e99c",
+			http.StatusForbidden,
+		},
+		{
+			"conflict:alreadyEnabled",
+			func(ctx context.Context, t store.TOTP, hashedRecoveryCodes []string) (*store.TOTP, error) {
+				return nil, store.ErrConflict
+			},
+			"080b5f09-527b-4581-bb56-19adbfe50ebf",
+			http.StatusConflict,
 		},
 		{
 			"internalServerError",
-			func(ctx context.Context, u store.User) (*store.User, error) {
+			func(ctx context.Context, t store.TOTP, hashedRecoveryCodes []string) (*store.TOTP, error) {
 				return nil, errors.New("internalServerError")
 			},
-			goodUser,
-			nil,
+			"080b5f09-527b-4581-bb56-19adbfe50ebf",
 			http.StatusInternalServerError,
 		},
 	}
 
 	for _, testcase := range testcases {
 		t.Run(testcase.name, func(t *testing.T) {
-			reqBody, err := json.Marshal(testcase.requestBody)
-			assert.NoError(t, err, "unexpected error marshalling request body")
-
-			req := httptest.NewRequest(http.MethodPost, "/users/"+testcase.requestBody.UserUUID.String(), bytes.NewBuffer(reqBody)) //이 경우는 특이. url에 param이랑, request body가 같이 오므로 "/users/" 뒤에 +도 해줘야돼고, bytes.NewBuffer도 해줘야 됨!
+			req := httptest.NewRequest(http.MethodPost, "/users/"+testcase.requestPath+"/2fa", nil)
 			w := httptest.NewRecorder()
+			authorize(t, req, testUserUUID)
+
+			var stored store.TOTP
+			var storedCodes []string
+			startOverride := testcase.startOverrideFunc
+			if startOverride == nil {
+				startOverride = func(ctx context.Context, t store.TOTP, hashedRecoveryCodes []string) (*store.TOTP, error) {
+					stored, storedCodes = t, hashedRecoveryCodes
+					return &t, nil
+				}
+			}
 
-			testServer.db = &mockstore.Mockstore{UpdateUserOverride: testcase.updateUserOverrideFunc}
+			testServer.db = &mockstore.Mockstore{StartTOTPEnrolmentOverride: startOverride}
 			testServer.r.ServeHTTP(w, req)
 
 			assert.Equal(t, testcase.expectedResponseStatus, w.Code)
 
-			if testcase.expectedResponse != nil {
-				var resBody User
+			if testcase.expectedResponseStatus == http.StatusOK {
+				var resBody TwoFactorEnrolment
 
-				err = json.Unmarshal(w.Body.Bytes(), &resBody)
+				err := json.Unmarshal(w.Body.Bytes(), &resBody)
 				assert.NoError(t, err, "unexpected error unmarshalling the response body")
 
-				assert.Equal(t, *testcase.expectedResponse, resBody)
-				// assert.Equal(t, testcase.expectedResponse.UserUUID, resBody.UserUUID)
-				// assert.Equal(t, testcase.expectedResponse.Active, resBody.Active)
-				// assert.Equal(t, testcase.expectedResponse.FirstName, resBody.FirstName)
-				// assert.Equal(t, testcase.expectedResponse.LastName, resBody.LastName)
-				// assert.Equal(t, testcase.expectedResponse.EmailAddress, resBody.EmailAddress)
-			} else {
-				assert.Equal(t, 0, w.Body.Len())
+				assert.Equal(t, stored.Secret, resBody.Secret)
+				assert.Equal(t, totp.URI("whatDoIEatToday", "jywoo92324@gmail.com", resBody.Secret), resBody.OTPAuthURI)
+				assert.Len(t, resBody.RecoveryCodes, 10)
+				assert.Len(t, storedCodes, 10)
+				for i, code := range resBody.RecoveryCodes {
+					assert.Equal(t, hashRecoveryCode(code), storedCodes[i], "only hashes get stored")
+				}
 			}
 		})
 	}
 }
 
-func TestGetIngredient(t *testing.T) {
+func TestConfirmTwoFactor(t *testing.T) {
+	pinClock(t)
+
+	code, err := totp.Code(testTOTPSecret, testNow)
+	assert.NoError(t, err)
+
+	pendingTOTP := func(ctx context.Context, uid uuid.UUID) (*store.TOTP, error) {
+		return &store.TOTP{UserUUID: uid, Secret: testTOTPSecret}, nil
+	}
+
 	testcases := []struct {
-		name                      string
-		getIngredientOverrideFunc func(ctx context.Context, id uuid.UUID) (*store.Ingredient, error)
-		requestBody               string
-		expectedResponse          *Ingredient
-		expectedStatus            int
+		name                   string
+		getTOTPFunc            func(ctx context.Context, uid uuid.UUID) (*store.TOTP, error)
+		requestBody            TwoFactorCode
+		expectedResponseStatus int
 	}{
 		{
 			"happyPath",
-			nil,
-			"080b5f09-527b-4581-bb56-19adbfe50ebf",
-			&Ingredient{
-				IngredientUUID: uuid.MustParse("080b5f09-527b-4581-bb56-19adbfe50ebf"),
-				IngredientName: "onion",
-				Category:       "vegetables",
-				DaysUntilExp:   7},
+			pendingTOTP,
+			TwoFactorCode{Code: code},
 			http.StatusOK,
 		},
 		{
-			"badRequest",
-			nil,
-			"maerong",
-			nil,
+			"badRequest:wrongCode",
+			pendingTOTP,
+			TwoFactorCode{Code: "000000"},
 			http.StatusBadRequest,
 		},
 		{
-			"internalServerError",
-			func(ctx context.Context, id uuid.UUID) (*store.Ingredient, error) {
-				return nil, errors.New("internalServerError")
-			},
-			"080b5f09-527b-4581-bb56-19adbfe50ebf",
+			"notFound",
 			nil,
-			http.StatusInternalServerError,
+			TwoFactorCode{Code: code},
+			http.StatusNotFound,
+		},
+		{
+			"conflict:alreadyEnabled",
+			enabledTOTP,
+			TwoFactorCode{Code: code},
+			http.StatusConflict,
 		},
 	}
 
 	for _, testcase := range testcases {
 		t.Run(testcase.name, func(t *testing.T) {
-			req := httptest.NewRequest(http.MethodGet, "/ingredients/"+testcase.requestBody, nil)
+			reqBody, err := json.Marshal(testcase.requestBody)
+			assert.NoError(t, err, "unexpected error marshalling the request body")
+
+			req := httptest.NewRequest(http.MethodPost, "/users/080b5f09-527b-4581-bb56-19adbfe50ebf/2fa/confirm", bytes.NewBuffer(reqBody))
 			w := httptest.NewRecorder()
+			authorize(t, req, testUserUUID)
 
-			testServer.db = &mockstore.Mockstore{GetIngredientOverride: testcase.getIngredientOverrideFunc}
+			var enabledStep int64
+			testServer.db = &mockstore.Mockstore{
+				GetTOTPOverride: testcase.getTOTPFunc,
+				EnableTOTPOverride: func(ctx context.Context, uid uuid.UUID, step int64) error {
+					enabledStep = step
+					return nil
+				},
+			}
 			testServer.r.ServeHTTP(w, req)
 
-			assert.Equal(t, testcase.expectedStatus, w.Code)
-
-			if testcase.expectedResponse != nil {
-				var resBody Ingredient
-
-				err := json.Unmarshal(w.Body.Bytes(), &resBody)
-				assert.NoError(t, err, "unexpected error unmarshalling the response body")
+			assert.Equal(t, testcase.expectedResponseStatus, w.Code)
 
-				assert.Equal(t, *testcase.expectedResponse, resBody)
-				// assert.Equal(t, testcase.expectedResponse.IngredientUUID, resBody.IngredientUUID)
-				// assert.Equal(t, testcase.expectedResponse.IngredientName, resBody.IngredientName)
-				// assert.Equal(t, testcase.expectedResponse.Category, resBody.Category)
-				// assert.Equal(t, testcase.expectedResponse.DaysUntilExp, resBody.DaysUntilExp)
-			} else {
-				assert.Equal(t, 0, w.Body.Len())
+			if testcase.expectedResponseStatus == http.StatusOK {
+				assert.Equal(t, totp.Step(testNow), enabledStep, "the confirming code can't be used to log in")
 			}
 		})
 	}
 }
 
-func TestSearchIngredients(t *testing.T) {
+func TestDisableTwoFactor(t *testing.T) {
 	testcases := []struct {
-		name                          string
-		searchIngredientsOverrideFunc func(ctx context.Context, i store.SearchIngredient) ([]store.Ingredient, error)
-		requestBody                   Ingredient
-		expectedResponse              []Ingredient
-		expectedStatus                int
+		name                   string
+		disableOverrideFunc    func(ctx context.Context, uid uuid.UUID) error
+		requestPath            string
+		requestBody            ChangePassword
+		expectedResponseStatus int
 	}{
 		{
 			"happyPath",
 			nil,
-			Ingredient{IngredientName: "tuna"},
-			[]Ingredient{
-				{
-					IngredientUUID: uuid.MustParse("080b5f09-527b-4581-bb56-19adbfe50ebf"),
-					IngredientName: "tuna",
-					Category:       "tuna kimbap",
-					DaysUntilExp:   3,
-				},
-				{
-					IngredientUUID: uuid.MustParse("080b5f09-527b-4581-bb56-19adbfe50ebf"),
-					IngredientName: "tuna",
-					Category:       "tuna sushi",
-					DaysUntilExp:   3,
-				},
-			},
+			"080b5f09-527b-4581-bb56-19adbfe50ebf",
+			ChangePassword{CurrentPassword: "hello"},
 			http.StatusOK,
 		},
 		{
-			"badRequest",
-			nil,
-			Ingredient{},
+			"badRequest:wrongPassword",
 			nil,
+			"080b5f09-527b-4581-bb56-19adbfe50ebf",
+			ChangePassword{CurrentPassword: "potatoes"},
 			http.StatusBadRequest,
 		},
 		{
-			"internalServerError",
-			func(ctx context.Context, i store.SearchIngredient) ([]store.Ingredient, error) {
-				return []store.Ingredient{}, errors.New("internalServerError")
-			},
-			Ingredient{IngredientName: "tuna"},
+			"forbidden",
 			nil,
-			http.StatusInternalServerError,
+			"2c98fff4-7ccc-4536-8259-67a88380e99c",
+			ChangePassword{CurrentPassword: "hello"},
+			http.StatusForbidden,
+		},
+		{
+			"notFound",
+			func(ctx context.Context, uid uuid.UUID) error {
+				return store.ErrNotFound
+			},
+			"080b5f09-527b-4581-bb56-19adbfe50ebf",
+			ChangePassword{CurrentPassword: "hello"},
+			http.StatusNotFound,
 		},
 	}
 
@@ -524,374 +881,947 @@ func TestSearchIngredients(t *testing.T) {
 			reqBody, err := json.Marshal(testcase.requestBody)
 			assert.NoError(t, err, "unexpected error marshalling the request body")
 
-			req := httptest.NewRequest(http.MethodPost, "/ingredients/search", bytes.NewBuffer(reqBody))
+			req := httptest.NewRequest(http.MethodDelete, "/users/"+testcase.requestPath+"/2fa", bytes.NewBuffer(reqBody))
 			w := httptest.NewRecorder()
+			authorize(t, req, testUserUUID)
 
-			testServer.db = &mockstore.Mockstore{SearchIngredientsOverride: testcase.searchIngredientsOverrideFunc}
+			testServer.db = &mockstore.Mockstore{
+				GetUserOverride: func(ctx context.Context, id uuid.UUID) (*store.User, error) {
+					hashedPassword, err := testHasher.Hash("hello")
+					return &store.User{UserUUID: id, HashedPassword: hashedPassword, Active: true, Role: store.RoleUser}, err
+				},
+				DisableTOTPOverride: testcase.disableOverrideFunc,
+			}
 			testServer.r.ServeHTTP(w, req)
 
-			assert.Equal(t, testcase.expectedStatus, w.Code)
+			assert.Equal(t, testcase.expectedResponseStatus, w.Code)
+		})
+	}
+}
 
-			if testcase.expectedResponse != nil {
-				var resBody []Ingredient
+// withStubProvider points the service's "stub" provider at a fresh stub OpenID provider for the test.
+func withStubProvider(t *testing.T) *oidctest.Server {
+	stub := oidctest.NewServer()
+	providers := testServer.providers
 
-				err := json.Unmarshal(w.Body.Bytes(), &resBody)
-				assert.NoError(t, err, "unexpected error unmarshaling the response body")
+	testServer.providers = map[string]*oidc.Provider{"stub": oidc.New(stub.Config("stub", "https://wdiet.test/oidc/stub/callback"), nil)}
+	t.Cleanup(func() {
+		testServer.providers = providers
+		stub.Close()
+	})
 
-				assert.Equal(t, len(testcase.expectedResponse), len(resBody))
+	return stub
+}
 
-				for i := range testcase.expectedResponse {
-					assert.Equal(t, testcase.expectedResponse[i], resBody[i])
-					// assert.Equal(t, testcase.expectedResponse[i].IngredientUUID, resBody[i].IngredientUUID)
-					// assert.Equal(t, testcase.expectedResponse[i].IngredientName, resBody[i].IngredientName)
-					// assert.Equal(t, testcase.expectedResponse[i].Category, resBody[i].Category)
-					// assert.Equal(t, testcase.expectedResponse[i].DaysUntilExp, resBody[i].DaysUntilExp)
-				}
-			} else {
-				assert.Equal(t, 0, w.Body.Len())
-			}
-		})
+// oidcStates is a mockstore's wdiet.oidc_states, single use like the real one.
+func oidcStates(m *mockstore.Mockstore) {
+	states := map[string]store.OIDCState{}
+
+	m.CreateOIDCStateOverride = func(ctx context.Context, st store.OIDCState) (*store.OIDCState, error) {
+		states[st.HashedState] = st
+		return &st, nil
+	}
+	m.UseOIDCStateOverride = func(ctx context.Context, hashedState string) (*store.OIDCState, error) {
+		st, ok := states[hashedState]
+		if !ok {
+			return nil, store.ErrNotFound
+		}
+		delete(states, hashedState)
+		return &st, nil
 	}
 }
 
-func TestCreateIngredient(t *testing.T) {
-	goodIngredient := Ingredient{
-		IngredientName: "onion",
-		Category:       "vegetables",
-		DaysUntilExp:   7,
+// oidcLogin starts a login through the service and has u log in at the stub. It returns the callback the stub
+// redirects back to, as a path on the service.
+func oidcLogin(t *testing.T, stub *oidctest.Server, u oidctest.User) string {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodGet, "/oidc/stub/login", nil)
+	w := httptest.NewRecorder()
+	testServer.r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusFound, w.Code)
+
+	callback, err := stub.Authorize(w.Header().Get("Location"), u)
+	assert.NoError(t, err, "unexpected error logging in at the stub")
+
+	return strings.TrimPrefix(callback, "https://wdiet.test")
+}
+
+var stubUser = oidctest.User{Subject: "248289761001", Email: "jywoo92324@gmail.com", EmailVerified: true, GivenName: "jy", FamilyName: "woo"}
+
+func TestOIDCLogin(t *testing.T) {
+	pinClock(t)
+	stub := withStubProvider(t)
+
+	var created store.OIDCState
+
+	testServer.db = &mockstore.Mockstore{
+		CreateOIDCStateOverride: func(ctx context.Context, st store.OIDCState) (*store.OIDCState, error) {
+			created = st
+			return &st, nil
+		},
 	}
 
-	badIngredient := Ingredient{
-		IngredientName: "",
-		Category:       "",
-		DaysUntilExp:   7,
+	req := httptest.NewRequest(http.MethodGet, "/oidc/stub/login", nil)
+	w := httptest.NewRecorder()
+	testServer.r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusFound, w.Code)
+
+	location := w.Header().Get("Location")
+	assert.True(t, strings.HasPrefix(location, stub.URL+"/authorize?"), location)
+
+	redirect, err := url.Parse(location)
+	assert.NoError(t, err)
+	q := redirect.Query()
+
+	assert.Equal(t, hashToken(q.Get("state")), created.HashedState)
+	assert.Equal(t, created.Nonce, q.Get("nonce"))
+	assert.Equal(t, oidc.CodeChallenge(created.CodeVerifier), q.Get("code_challenge"))
+	assert.Equal(t, "https://wdiet.test/oidc/stub/callback", q.Get("redirect_uri"))
+	assert.Equal(t, "stub", created.Provider)
+	assert.Equal(t, testNow.Add(10*time.Minute), created.ExpiresAt)
+
+	req = httptest.NewRequest(http.MethodGet, "/oidc/nope/login", nil)
+	w = httptest.NewRecorder()
+	testServer.r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestOIDCCallback(t *testing.T) {
+	stub := withStubProvider(t)
+
+	verifiedAt := time.Date(2022, 12, 1, 0, 0, 0, 0, time.UTC)
+	linkedUUID := uuid.MustParse("5b0c7e3a-2d41-4f6b-9a8e-1c2d3e4f5a6b")
+
+	linked := func(ctx context.Context, provider, subject string) (*store.UserIdentity, error) {
+		if provider != "stub" || subject != stubUser.Subject {
+			return nil, store.ErrNotFound
+		}
+		return &store.UserIdentity{UserUUID: linkedUUID, Provider: provider, Subject: subject}, nil
+	}
+	noUser := func(ctx context.Context, email string) (*store.User, error) {
+		return nil, store.ErrNotFound
+	}
+	verifiedUser := func(ctx context.Context, email string) (*store.User, error) {
+		return &store.User{UserUUID: testUserUUID, Active: true, Role: store.RoleUser, EmailAddress: email, EmailVerifiedAt: &verifiedAt}, nil
+	}
+	failIdentity := func(ctx context.Context, i store.UserIdentity) (*store.UserIdentity, error) {
+		t.Error("nothing should be linked")
+		return &i, nil
+	}
+	failSignUp := func(ctx context.Context, u store.User, i store.UserIdentity) (*store.User, error) {
+		t.Error("nobody should be signed up")
+		return &u, nil
 	}
 
 	testcases := []struct {
-		name                         string
-		createIngredientOverrideFunc func(ctx context.Context, i store.Ingredient) (*store.Ingredient, error)
-		requestBody                  Ingredient
-		expectedResponse             *Ingredient
-		expectedStatus               int
+		name               string
+		user               oidctest.User
+		mockstore          mockstore.Mockstore
+		expectedStatusCode int
+		expectedUserUUID   uuid.UUID //whose tokens come back
+		expectedTwoFactor  bool
+		expectedLinked     bool
+		expectedSignedUpAs string //email, if somebody new gets signed up
 	}{
 		{
-			"happyPath",
-			nil,
-			goodIngredient,
-			&goodIngredient,
-			http.StatusOK,
+			name:               "happyPath:linked",
+			user:               stubUser,
+			mockstore:          mockstore.Mockstore{UseUserIdentityOverride: linked, CreateUserIdentityOverride: failIdentity, CreateUserWithIdentityOverride: failSignUp},
+			expectedStatusCode: http.StatusOK,
+			expectedUserUUID:   linkedUUID,
 		},
 		{
-			"badRequest",
-			nil,
-			badIngredient,
-			nil,
-			http.StatusBadRequest,
+			name:               "happyPath:linkedEvenIfTheEmailChanged", //the subject is what counts once linked
+			user:               oidctest.User{Subject: stubUser.Subject, Email: "somebody@else.com"},
+			mockstore:          mockstore.Mockstore{UseUserIdentityOverride: linked, CreateUserIdentityOverride: failIdentity, CreateUserWithIdentityOverride: failSignUp},
+			expectedStatusCode: http.StatusOK,
+			expectedUserUUID:   linkedUUID,
 		},
 		{
-			"internalServerError",
-			func(ctx context.Context, i store.Ingredient) (*store.Ingredient, error) {
-				return nil, errors.New("internalServerError")
+			name:               "happyPath:linkByVerifiedEmail",
+			user:               stubUser,
+			mockstore:          mockstore.Mockstore{GetUserByEmailOverride: verifiedUser, CreateUserWithIdentityOverride: failSignUp},
+			expectedStatusCode: http.StatusOK,
+			expectedUserUUID:   testUserUUID,
+			expectedLinked:     true,
+		},
+		{
+			name:               "happyPath:signUp",
+			user:               stubUser,
+			mockstore:          mockstore.Mockstore{GetUserByEmailOverride: noUser, CreateUserIdentityOverride: failIdentity},
+			expectedStatusCode: http.StatusOK,
+			expectedSignedUpAs: stubUser.Email,
+		},
+		{
+			name:               "happyPath:twoFactor", //a provider login doesn't skip the user's second factor
+			user:               stubUser,
+			mockstore:          mockstore.Mockstore{UseUserIdentityOverride: linked, GetTOTPOverride: enabledTOTP},
+			expectedStatusCode: http.StatusOK,
+			expectedTwoFactor:  true,
+		},
+		{
+			name:               "forbidden:emailNotVerifiedByProvider",
+			user:               oidctest.User{Subject: "other", Email: stubUser.Email, EmailVerified: false},
+			mockstore:          mockstore.Mockstore{GetUserByEmailOverride: verifiedUser, CreateUserIdentityOverride: failIdentity, CreateUserWithIdentityOverride: failSignUp},
+			expectedStatusCode: http.StatusForbidden,
+		},
+		{
+			name: "conflict:accountNotVerified",
+			user: stubUser,
+			mockstore: mockstore.Mockstore{
+				GetUserByEmailOverride: func(ctx context.Context, email string) (*store.User, error) {
+					return &store.User{UserUUID: testUserUUID, Active: true, Role: store.RoleUser, EmailAddress: email}, nil
+				},
+				CreateUserIdentityOverride:     failIdentity,
+				CreateUserWithIdentityOverride: failSignUp,
 			},
-			goodIngredient,
-			nil,
-			http.StatusInternalServerError,
+			expectedStatusCode: http.StatusConflict,
 		},
-	}
-
-	for _, testcase := range testcases {
+		{
+			name: "conflict:alreadyLinkedToAnotherLogin",
+			user: stubUser,
+			mockstore: mockstore.Mockstore{
+				GetUserByEmailOverride: verifiedUser,
+				CreateUserIdentityOverride: func(ctx context.Context, i store.UserIdentity) (*store.UserIdentity, error) {
+					return nil, store.ErrConflict
+				},
+			},
+			expectedStatusCode: http.StatusConflict,
+		},
+		{
+			name: "forbidden:deactivated",
+			user: stubUser,
+			mockstore: mockstore.Mockstore{
+				UseUserIdentityOverride: linked,
+				GetUserOverride: func(ctx context.Context, id uuid.UUID) (*store.User, error) {
+					return &store.User{UserUUID: id, Active: false, Role: store.RoleUser}, nil
+				},
+			},
+			expectedStatusCode: http.StatusForbidden,
+		},
+		{
+			name: "internalServerError",
+			user: stubUser,
+			mockstore: mockstore.Mockstore{
+				UseUserIdentityOverride: func(ctx context.Context, provider, subject string) (*store.UserIdentity, error) {
+					return nil, errors.New("unexpected error")
+				},
+			},
+			expectedStatusCode: http.StatusInternalServerError,
+		},
+	}
+
+	for _, testcase := range testcases {
 		t.Run(testcase.name, func(t *testing.T) {
-			reqBody, err := json.Marshal(testcase.requestBody)
-			assert.NoError(t, err, "unexpected error marshalling the request body")
+			var identity *store.UserIdentity
+			var signedUp *store.User
+
+			m := testcase.mockstore
+			oidcStates(&m)
+			if m.CreateUserIdentityOverride == nil {
+				m.CreateUserIdentityOverride = func(ctx context.Context, i store.UserIdentity) (*store.UserIdentity, error) {
+					identity = &i
+					return &i, nil
+				}
+			}
+			if m.CreateUserWithIdentityOverride == nil {
+				m.CreateUserWithIdentityOverride = func(ctx context.Context, u store.User, i store.UserIdentity) (*store.User, error) {
+					identity = &i
+					u.UserUUID = uuid.New()
+					signedUp = &u
+					return &u, nil
+				}
+			}
+			testServer.db = &m
 
-			req := httptest.NewRequest(http.MethodPost, "/ingredients", bytes.NewBuffer(reqBody))
+			req := httptest.NewRequest(http.MethodGet, oidcLogin(t, stub, testcase.user), nil)
 			w := httptest.NewRecorder()
-
-			testServer.db = &mockstore.Mockstore{CreateIngredientOverride: testcase.createIngredientOverrideFunc}
 			testServer.r.ServeHTTP(w, req)
 
-			if testcase.expectedResponse != nil {
-				var resBody Ingredient
+			assert.Equal(t, testcase.expectedStatusCode, w.Code)
 
-				err := json.Unmarshal(w.Body.Bytes(), &resBody)
-				assert.NoError(t, err, "unexpected error unmarshalling the response body")
+			if testcase.expectedLinked || testcase.expectedSignedUpAs != "" {
+				if assert.NotNil(t, identity, "expected an identity to be linked") {
+					assert.Equal(t, "stub", identity.Provider)
+					assert.Equal(t, testcase.user.Subject, identity.Subject)
+					assert.Equal(t, testcase.user.Email, identity.EmailAddress)
+				}
+			}
+			if testcase.expectedLinked {
+				assert.Equal(t, testUserUUID, identity.UserUUID)
+			}
+			if testcase.expectedSignedUpAs != "" {
+				if assert.NotNil(t, signedUp, "expected a sign up") {
+					assert.Equal(t, testcase.expectedSignedUpAs, signedUp.EmailAddress)
+					assert.Equal(t, testcase.user.GivenName, signedUp.FirstName)
+					assert.True(t, signedUp.Active)
+					assert.NotEmpty(t, signedUp.HashedPassword)
+				}
+				testcase.expectedUserUUID = signedUp.UserUUID
+			}
 
-				//assert.Equal(t, *testcase.expectedResponse, resBody)
-				assert.NotEqual(t, resBody.IngredientUUID, uuid.Nil)
-				assert.Equal(t, testcase.expectedResponse.IngredientName, resBody.IngredientName)
-				assert.Equal(t, testcase.expectedResponse.Category, resBody.Category)
-				assert.Equal(t, testcase.expectedResponse.DaysUntilExp, resBody.DaysUntilExp)
-			} else {
-				assert.Equal(t, 0, w.Body.Len())
+			if w.Code != http.StatusOK {
+				return
+			}
+
+			if testcase.expectedTwoFactor {
+				var resBody TwoFactorChallenge
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resBody))
+				assert.True(t, resBody.TwoFactorRequired)
+				assert.NotContains(t, w.Body.String(), "refresh_token")
+				return
 			}
+
+			var resBody Token
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resBody))
+			assert.NotEmpty(t, resBody.RefreshToken)
+
+			claims := &Claims{}
+			_, err := jwt.ParseWithClaims(resBody.Token, claims, testServer.keys.keyFunc)
+			assert.NoError(t, err)
+			assert.Equal(t, testcase.expectedUserUUID.String(), claims.Subject)
 		})
 	}
 }
 
-func TestUpdateIngredient(t *testing.T) {
-	goodIngredient := Ingredient{
-		IngredientUUID: uuid.MustParse("080b5f09-527b-4581-bb56-19adbfe50ebf"),
-		IngredientName: "onion",
-		Category:       "vegetables",
-		DaysUntilExp:   7,
+func TestOIDCCallbackState(t *testing.T) {
+	stub := withStubProvider(t)
+
+	m := &mockstore.Mockstore{UseUserIdentityOverride: func(ctx context.Context, provider, subject string) (*store.UserIdentity, error) {
+		return &store.UserIdentity{UserUUID: testUserUUID, Provider: provider, Subject: subject}, nil
+	}}
+	oidcStates(m)
+	testServer.db = m
+
+	get := func(path string) int {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		w := httptest.NewRecorder()
+		testServer.r.ServeHTTP(w, req)
+		return w.Code
 	}
 
-	badIngredient := Ingredient{
-		IngredientUUID: uuid.MustParse("080b5f09-527b-4581-bb56-19adbfe50ebf"),
-		IngredientName: "",
-		Category:       "",
-		DaysUntilExp:   7,
+	//a callback works once
+	callback := oidcLogin(t, stub, stubUser)
+	assert.Equal(t, http.StatusOK, get(callback))
+	assert.Equal(t, http.StatusUnauthorized, get(callback))
+
+	//a state we never handed out
+	callback = oidcLogin(t, stub, stubUser)
+	forged, err := url.Parse(callback)
+	assert.NoError(t, err)
+	q := forged.Query()
+	q.Set("state", "forged")
+	assert.Equal(t, http.StatusUnauthorized, get(forged.Path+"?"+q.Encode()))
+
+	//a code the provider never handed out
+	callback = oidcLogin(t, stub, stubUser)
+	forged, err = url.Parse(callback)
+	assert.NoError(t, err)
+	q = forged.Query()
+	q.Set("code", "forged")
+	assert.Equal(t, http.StatusUnauthorized, get(forged.Path+"?"+q.Encode()))
+
+	//too slow at the provider
+	callback = oidcLogin(t, stub, stubUser)
+	testServer.now = func() time.Time { return time.Now().Add(oidcStateTTL + time.Second) }
+	t.Cleanup(func() { testServer.now = time.Now })
+	assert.Equal(t, http.StatusUnauthorized, get(callback))
+
+	//the user said no at the provider
+	assert.Equal(t, http.StatusUnauthorized, get("/oidc/stub/callback?error=access_denied&state=whatever"))
+
+	assert.Equal(t, http.StatusBadRequest, get("/oidc/stub/callback?state=whatever"))
+	assert.Equal(t, http.StatusNotFound, get("/oidc/nope/callback?code=x&state=y"))
+}
+
+func TestJWKS(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil)
+	w := httptest.NewRecorder()
+
+	testServer.r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var resBody JWKS
+
+	err := json.Unmarshal(w.Body.Bytes(), &resBody)
+	assert.NoError(t, err, "unexpected error unmarshalling the response body")
+
+	kids := map[string]JWK{}
+	for _, k := range resBody.Keys {
+		kids[k.Kid] = k
 	}
 
+	assert.Len(t, kids, 2) //the HS512 key is a secret, it must not be published
+	assert.Equal(t, "OKP", kids["current"].Kty)
+	assert.Equal(t, "Ed25519", kids["current"].Crv)
+	assert.Equal(t, base64.RawURLEncoding.EncodeToString(testServer.keys.keys["current"].verifyKey.(ed25519.PublicKey)), kids["current"].X)
+	assert.Equal(t, "RSA", kids["rsa"].Kty)
+	assert.Equal(t, "AQAB", kids["rsa"].E)
+	assert.NotEmpty(t, kids["rsa"].N)
+}
+
+func TestLoginRehash(t *testing.T) {
 	testcases := []struct {
-		name                         string
-		updateIngredientOverrideFunc func(ctx context.Context, i store.Ingredient) (*store.Ingredient, error)
-		requestBody                  Ingredient
-		expectedResponse             *Ingredient
-		expectedStatus               int
+		name            string
+		hasher          hasher.PasswordHasher
+		updateHashError error
+		expectedRehash  bool
+		expectedStatus  int
 	}{
 		{
-			"happyPath",
+			"upToDate",
+			testHasher,
 			nil,
-			goodIngredient,
-			&goodIngredient,
+			false,
 			http.StatusOK,
 		},
 		{
-			"badRequest",
-			//it's misleading to have database override here, because it's not gonna hit the database anyway. To more clearly see it's a bad request, just leave it nil.
-			nil,
-			badIngredient,
+			"higherCost",
+			hasher.Bcrypt{Cost: bcrypt.MinCost + 1},
 			nil,
-			http.StatusBadRequest,
+			true,
+			http.StatusOK,
 		},
 		{
-			"internalServerError",
-			func(ctx context.Context, i store.Ingredient) (*store.Ingredient, error) {
-				return nil, errors.New("internalServerError")
-			},
-			goodIngredient,
+			"switchedToArgon2id",
+			hasher.Argon2id{Memory: 1024, Time: 1, Threads: 1, SaltLen: 16, KeyLen: 32},
 			nil,
-			http.StatusInternalServerError,
+			true,
+			http.StatusOK,
+		},
+		{
+			"rehashFailed", //still logged in, the hash gets upgraded next time
+			hasher.Bcrypt{Cost: bcrypt.MinCost + 1},
+			errors.New("internalServerError"),
+			true,
+			http.StatusOK,
 		},
 	}
 
 	for _, testcase := range testcases {
 		t.Run(testcase.name, func(t *testing.T) {
-			reqBody, err := json.Marshal(testcase.requestBody)
+			reqBody, err := json.Marshal(Login{EmailAddress: "jywoo92324@gmail.com", Password: "hello"})
 			assert.NoError(t, err, "unexpected error marshalling the request body")
 
-			req := httptest.NewRequest(http.MethodPost, "/ingredients/"+testcase.requestBody.IngredientUUID.String(), bytes.NewBuffer(reqBody))
+			req := httptest.NewRequest(http.MethodPost, "/login", bytes.NewBuffer(reqBody))
 			w := httptest.NewRecorder()
 
-			testServer.db = &mockstore.Mockstore{UpdateIngredientOverride: testcase.updateIngredientOverrideFunc}
+			var oldHash, newHash string
+			testServer.db = &mockstore.Mockstore{
+				UpdatePasswordHashOverride: func(ctx context.Context, id uuid.UUID, old, new string) error {
+					oldHash, newHash = old, new
+					return testcase.updateHashError
+				},
+			}
+			testServer.hasher = testcase.hasher
+			defer func() { testServer.hasher = testHasher }()
+
 			testServer.r.ServeHTTP(w, req)
 
 			assert.Equal(t, testcase.expectedStatus, w.Code)
 
-			if testcase.expectedResponse != nil {
-				var resBody Ingredient
+			if !testcase.expectedRehash {
+				assert.Empty(t, newHash)
+				return
+			}
 
-				err := json.Unmarshal(w.Body.Bytes(), &resBody)
-				assert.NoError(t, err, "unexpected error unmarshalling the response body")
+			assert.NotEmpty(t, oldHash)
+			assert.False(t, testcase.hasher.NeedsRehash(newHash))
 
-				assert.Equal(t, *testcase.expectedResponse, resBody)
-				// assert.Equal(t, testcase.expectedResponse.IngredientName, resBody.IngredientName)
-				// assert.Equal(t, testcase.expectedResponse.Category, resBody.Category)
-				// assert.Equal(t, testcase.expectedResponse.DaysUntilExp, resBody.DaysUntilExp)
-				// assert.Equal(t, testcase.expectedResponse.IngredientUUID, resBody.IngredientUUID)
-			} else {
-				assert.Equal(t, 0, w.Body.Len()) //이거 w.Body.Len이 아니라 끝에 꼭 () 붙여줘 ㅎㅎ;;
-			}
+			ok, err := testcase.hasher.Verify(newHash, "hello")
+			assert.NoError(t, err)
+			assert.True(t, ok)
 		})
 	}
 }
 
-func TestDeleteIngredient(t *testing.T) {
+func TestValidateToken(t *testing.T) {
+	claims := jwt.RegisteredClaims{
+		// A usual scenario is to set the expiration time relative to the current time
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
+		IssuedAt:  jwt.NewNumericDate(time.Now()),
+		NotBefore: jwt.NewNumericDate(time.Now()),
+		Issuer:    "whatDoIEatToday",
+		Subject:   "080b5f09-527b-4581-bb56-19adbfe50ebf",
+		ID:        "a8a2b9a4-4a31-4bc4-9d0f-4b8a3d0f6d11",
+		Audience:  []string{"whatDoIEatToday"},
+	}
+
+	signedToken, err := testServer.keys.sign(claims)
+	assert.NoError(t, err, "unexpected error signing the token")
+
+	badClaims := claims
+	badClaims.Subject = "not a uuid"
+	badIDToken, err := testServer.keys.sign(badClaims)
+	assert.NoError(t, err, "unexpected error signing the token")
+
+	badClaims = claims
+	badClaims.ID = "not a uuid"
+	badJTIToken, err := testServer.keys.sign(badClaims)
+	assert.NoError(t, err, "unexpected error signing the token")
+
+	adminToken, err := testServer.keys.sign(Claims{Role: store.RoleAdmin, RegisteredClaims: claims})
+	assert.NoError(t, err, "unexpected error signing the token")
+
+	signWith := func(method jwt.SigningMethod, kid string, key interface{}) string {
+		token := jwt.NewWithClaims(method, claims)
+		if kid != "" {
+			token.Header["kid"] = kid
+		}
+		signed, err := token.SignedString(key)
+		assert.NoError(t, err, "unexpected error signing the token")
+		return signed
+	}
+
 	testcases := []struct {
-		name                         string
-		deleteIngredientOverrideFunc func(ctx context.Context, id uuid.UUID) error
-		requestBody                  string
-		expectedStatus               int
+		name                   string
+		isRevokedOverrideFunc  func(ctx context.Context, jti uuid.UUID) (bool, error)
+		authHeader             string
+		expecterStatus         int
+		userStatusOverrideFunc func(ctx context.Context, id uuid.UUID) (*store.UserStatus, error)
 	}{
 		{
 			"happyPath",
 			nil,
-			"080b5f09-527b-4581-bb56-19adbfe50ebf",
+			"Bearer " + signedToken,
 			http.StatusOK,
+			nil,
 		},
 		{
-			"badRequest",
+			"invalidToken",
+			nil,
+			"Bearer " + "potatoes",
+			http.StatusUnauthorized,
 			nil,
-			"maerongmaerong",
-			http.StatusBadRequest,
 		},
 		{
-			"happyPath",
-			func(ctx context.Context, id uuid.UUID) error {
-				return errors.New("internalServerError")
+			"invalidUserUUID",
+			nil,
+			"Bearer " + badIDToken,
+			http.StatusUnauthorized,
+			nil,
+		},
+		{
+			"invalidJTI",
+			nil,
+			"Bearer " + badJTIToken,
+			http.StatusUnauthorized,
+			nil,
+		},
+		{
+			"revokedToken",
+			func(ctx context.Context, jti uuid.UUID) (bool, error) {
+				return jti == uuid.MustParse("a8a2b9a4-4a31-4bc4-9d0f-4b8a3d0f6d11"), nil
 			},
-			"080b5f09-527b-4581-bb56-19adbfe50ebf",
+			"Bearer " + signedToken,
+			http.StatusUnauthorized,
+			nil,
+		},
+		{
+			"internalServerError",
+			func(ctx context.Context, jti uuid.UUID) (bool, error) {
+				return false, errors.New("internalServerError")
+			},
+			"Bearer " + signedToken,
 			http.StatusInternalServerError,
+			nil,
+		},
+		{
+			"rotatedKey", //signed before the rotation, still verifies
+			nil,
+			"Bearer " + signWith(jwt.SigningMethodHS512, "previous", testPreviousSecret),
+			http.StatusOK,
+			nil,
+		},
+		{
+			"unknownKid",
+			nil,
+			"Bearer " + signWith(jwt.SigningMethodHS512, "whoami", testPreviousSecret),
+			http.StatusUnauthorized,
+			nil,
+		},
+		{
+			"missingKid",
+			nil,
+			"Bearer " + signWith(jwt.SigningMethodHS512, "", testPreviousSecret),
+			http.StatusUnauthorized,
+			nil,
+		},
+		{
+			"wrongAlgForKid",
+			nil,
+			"Bearer " + signWith(jwt.SigningMethodHS256, "previous", testPreviousSecret),
+			http.StatusUnauthorized,
+			nil,
+		},
+		{
+			"deactivatedUser",
+			nil,
+			"Bearer " + signedToken,
+			http.StatusUnauthorized,
+			func(ctx context.Context, id uuid.UUID) (*store.UserStatus, error) {
+				return &store.UserStatus{Active: false, EmailVerified: true}, nil
+			},
+		},
+		{
+			"deletedUser",
+			nil,
+			"Bearer " + signedToken,
+			http.StatusUnauthorized,
+			func(ctx context.Context, id uuid.UUID) (*store.UserStatus, error) {
+				return nil, store.ErrNotFound
+			},
+		},
+		{
+			"happyPath:role",
+			nil,
+			"Bearer " + adminToken,
+			http.StatusOK,
+			statusWithRole(store.RoleAdmin),
+		},
+		{
+			"roleChanged", //demoted since the token was signed
+			nil,
+			"Bearer " + adminToken,
+			http.StatusUnauthorized,
+			nil,
+		},
+		{
+			"missingToken",
+			nil,
+			"Bearer " + "",
+			http.StatusUnauthorized,
+			nil,
+		},
+		{
+			"emptyHeader", //panic: tried to access part of an array that didn't exist, 왜냐하면 bearer 부분이 없기 때문 ㅋㅋ... 근데 "abc"가 아니라 아예 ""로 보내면 핸들러에서 toekn == ""에 걸리기 때문에, 그 뒤에 array access할 것도 없이 return되버리므로 panic이 안 났던것임..
+			nil,
+			"abc",
+			http.StatusUnauthorized,
+			nil,
 		},
 	}
 
+	testServer.r.GET("/testValidateToken", testServer.ValidateToken)
+
 	for _, testcase := range testcases {
 		t.Run(testcase.name, func(t *testing.T) {
-			req := httptest.NewRequest(http.MethodDelete, "/ingredients/"+testcase.requestBody, nil)
+			req := httptest.NewRequest(http.MethodGet, "/testValidateToken", nil) //request body가 없어도 밑에 줄에서 header는 set할 수 있음. 밑에 줄이 중요한거. 이 new request는 어떤 request든 걍 명목적인거.
+			req.Header.Set("Authorization", testcase.authHeader)
 			w := httptest.NewRecorder()
 
-			testServer.db = &mockstore.Mockstore{DeleteIngredientOverride: testcase.deleteIngredientOverrideFunc}
+			testServer.db = &mockstore.Mockstore{IsAccessTokenRevokedOverride: testcase.isRevokedOverrideFunc, GetUserStatusOverride: testcase.userStatusOverrideFunc}
 			testServer.r.ServeHTTP(w, req)
 
-			assert.Equal(t, testcase.expectedStatus, w.Code)
+			assert.Equal(t, testcase.expecterStatus, w.Code)
 		})
 	}
 }
 
-func TestListFridgeIngredients(t *testing.T) {
+func TestRefreshToken(t *testing.T) {
+	revokedAt := time.Now().Add(-time.Hour)
+
 	testcases := []struct {
-		name                              string
-		listFridgeIngredientsOverrideFunc func(ctx context.Context, id uuid.UUID) ([]store.FridgeIngredient, error)
-		requestBody                       string
-		expectedResponse                  []FridgeIngredient
-		expectedStatus                    int
+		name                      string
+		getRefreshTokenFunc       func(ctx context.Context, hashedToken string) (*store.RefreshToken, error)
+		rotateRefreshTokenFunc    func(ctx context.Context, id uuid.UUID, next store.RefreshToken) (*store.RefreshToken, error)
+		requestBody               RefreshToken
+		expectedStatus            int
+		expectedFamilyRevocations int
 	}{
 		{
 			"happyPath",
 			nil,
-			"080b5f09-527b-4581-bb56-19adbfe50ebf",
-			[]FridgeIngredient{
-				{
-					UserUUID:       uuid.MustParse("080b5f09-527b-4581-bb56-19adbfe50ebf"),
-					IngredientUUID: uuid.MustParse("ffff7c73-52b0-4e3d-bf3f-0c26785ef972"),
-					Amount:         3,
-					Unit:           "kg",
-					PurchasedDate:  time.Date(2023, time.March, 24, 15, 0, 0, 0, time.Now().Location()),
-					ExpirationDate: time.Date(2023, time.March, 24, 15, 0, 0, 0, time.Now().Location()),
-				},
-				{
-					UserUUID:       uuid.MustParse("080b5f09-527b-4581-bb56-19adbfe50ebf"),
-					IngredientUUID: uuid.MustParse("2c98fff4-7ccc-4536-8259-67a88380e99c"),
-					Amount:         2,
-					Unit:           "L",
-					PurchasedDate:  time.Date(2023, time.March, 24, 15, 0, 0, 0, time.Now().Location()),
-					ExpirationDate: time.Date(2023, time.March, 31, 15, 0, 0, 0, time.Now().Location()),
-				},
-			},
+			nil,
+			RefreshToken{RefreshToken: "potatoes"},
 			http.StatusOK,
+			0,
 		},
 		{
 			"badRequest",
 			nil,
-			"maerong",
 			nil,
+			RefreshToken{},
 			http.StatusBadRequest,
+			0,
 		},
 		{
-			"internalServerError",
-			func(ctx context.Context, id uuid.UUID) ([]store.FridgeIngredient, error) {
+			"unauthorized:unknown",
+			func(ctx context.Context, hashedToken string) (*store.RefreshToken, error) {
+				return nil, store.ErrNotFound
+			},
+			nil,
+			RefreshToken{RefreshToken: "potatoes"},
+			http.StatusUnauthorized,
+			0,
+		},
+		{
+			"unauthorized:expired",
+			func(ctx context.Context, hashedToken string) (*store.RefreshToken, error) {
+				return &store.RefreshToken{UserUUID: testUserUUID, FamilyUUID: uuid.New(), ExpiresAt: time.Now().Add(-time.Minute)}, nil
+			},
+			nil,
+			RefreshToken{RefreshToken: "potatoes"},
+			http.StatusUnauthorized,
+			0,
+		},
+		{
+			"unauthorized:reused", //already rotated token comes back, the whole family has to go
+			func(ctx context.Context, hashedToken string) (*store.RefreshToken, error) {
+				return &store.RefreshToken{UserUUID: testUserUUID, FamilyUUID: uuid.New(), ExpiresAt: time.Now().Add(time.Hour), RevokedAt: &revokedAt}, nil
+			},
+			nil,
+			RefreshToken{RefreshToken: "potatoes"},
+			http.StatusUnauthorized,
+			1,
+		},
+		{
+			"unauthorized:raced",
+			nil,
+			func(ctx context.Context, id uuid.UUID, next store.RefreshToken) (*store.RefreshToken, error) {
+				return nil, store.ErrRevoked
+			},
+			RefreshToken{RefreshToken: "potatoes"},
+			http.StatusUnauthorized,
+			1,
+		},
+		{
+			"internalServerError",
+			func(ctx context.Context, hashedToken string) (*store.RefreshToken, error) {
 				return nil, errors.New("internalServerError")
 			},
-			"080b5f09-527b-4581-bb56-19adbfe50ebf",
 			nil,
+			RefreshToken{RefreshToken: "potatoes"},
 			http.StatusInternalServerError,
+			0,
 		},
 	}
 
 	for _, testcase := range testcases {
 		t.Run(testcase.name, func(t *testing.T) {
-			req := httptest.NewRequest(http.MethodGet, "/users/"+testcase.requestBody+"/fridge_ingredients", nil)
+			reqBody, err := json.Marshal(testcase.requestBody)
+			assert.NoError(t, err, "unexpected error marshalling the request body")
+
+			req := httptest.NewRequest(http.MethodPost, "/token/refresh", bytes.NewBuffer(reqBody))
 			w := httptest.NewRecorder()
 
-			testServer.db = &mockstore.Mockstore{ListFridgeIngredientsOverride: testcase.listFridgeIngredientsOverrideFunc}
+			var familyRevocations int
+			testServer.db = &mockstore.Mockstore{
+				GetRefreshTokenOverride:    testcase.getRefreshTokenFunc,
+				RotateRefreshTokenOverride: testcase.rotateRefreshTokenFunc,
+				RevokeRefreshTokenFamilyOverride: func(ctx context.Context, familyID uuid.UUID) error {
+					familyRevocations++
+					return nil
+				},
+			}
 			testServer.r.ServeHTTP(w, req)
 
 			assert.Equal(t, testcase.expectedStatus, w.Code)
+			assert.Equal(t, testcase.expectedFamilyRevocations, familyRevocations)
 
-			if testcase.expectedResponse != nil {
-				var resBody []FridgeIngredient
+			if testcase.expectedStatus == http.StatusOK {
+				var resBody Token
 
-				err := json.Unmarshal(w.Body.Bytes(), &resBody)
+				err = json.Unmarshal(w.Body.Bytes(), &resBody)
 				assert.NoError(t, err, "unexpected error unmarshalling the response body")
 
-				assert.Equal(t, len(testcase.expectedResponse), len(resBody))
+				assert.NotEmpty(t, resBody.Token)
+				assert.NotEmpty(t, resBody.RefreshToken)
+				assert.NotEqual(t, testcase.requestBody.RefreshToken, resBody.RefreshToken)
 
-				for i := range testcase.expectedResponse {
-					assert.Equal(t, testcase.expectedResponse[i], resBody[i])
-				}
-			} else {
-				assert.Equal(t, 0, w.Body.Len())
+				var claims Claims
+				_, err = jwt.ParseWithClaims(resBody.Token, &claims, testServer.keys.keyFunc)
+				assert.NoError(t, err, "unexpected error parsing the token")
+				assert.Nil(t, claims.AuthTime, "a refresh isn't a login")
 			}
 		})
 	}
 }
 
-func TestCreateFridgeIngredient(t *testing.T) {
-	goodFridgeIngredient := FridgeIngredient{
-		UserUUID:       uuid.MustParse("080b5f09-527b-4581-bb56-19adbfe50ebf"),
-		IngredientUUID: uuid.MustParse("ffff7c73-52b0-4e3d-bf3f-0c26785ef972"),
-		Amount:         3,
-		Unit:           "kg",
-		PurchasedDate:  time.Now(),
-	}
+// TestRefreshTokenClock checks expiry is worked out on the service's clock, both the one it checks and the ones it hands out.
+func TestRefreshTokenClock(t *testing.T) {
+	pinClock(t)
 
-	badFridgeIngredient := FridgeIngredient{
-		UserUUID:       uuid.Nil,
-		IngredientUUID: uuid.MustParse("2c98fff4-7ccc-4536-8259-67a88380e99c"),
-		Amount:         3,
-		Unit:           "kg",
-		PurchasedDate:  time.Now(),
+	for _, testcase := range []struct {
+		name           string
+		expiresAt      time.Time
+		expectedStatus int
+	}{
+		{"happyPath", testNow.Add(time.Minute), http.StatusOK}, //long gone by the wall clock
+		{"unauthorized:expired", testNow.Add(-time.Minute), http.StatusUnauthorized},
+	} {
+		t.Run(testcase.name, func(t *testing.T) {
+			var gotNext store.RefreshToken
+
+			testServer.db = &mockstore.Mockstore{
+				GetRefreshTokenOverride: func(ctx context.Context, hashedToken string) (*store.RefreshToken, error) {
+					current, err := (&mockstore.Mockstore{}).GetRefreshToken(ctx, hashedToken)
+					current.ExpiresAt = testcase.expiresAt
+					return current, err
+				},
+				RotateRefreshTokenOverride: func(ctx context.Context, id uuid.UUID, next store.RefreshToken) (*store.RefreshToken, error) {
+					gotNext = next
+					return &next, nil
+				},
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/token/refresh", strings.NewReader(`{"refresh_token":"potatoes"}`))
+			w := httptest.NewRecorder()
+			testServer.r.ServeHTTP(w, req)
+
+			assert.Equal(t, testcase.expectedStatus, w.Code)
+
+			if testcase.expectedStatus != http.StatusOK {
+				return
+			}
+
+			assert.Equal(t, testNow.Add(refreshTokenTTL), gotNext.ExpiresAt)
+
+			var resBody Token
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resBody), "unexpected error unmarshalling the response body")
+
+			var claims Claims
+			_, err := jwt.ParseWithClaims(resBody.Token, &claims, testServer.keys.keyFunc, jwt.WithoutClaimsValidation()) //expired by the wall clock
+			assert.NoError(t, err, "unexpected error parsing the token")
+			assert.Equal(t, testNow.Add(accessTokenTTL).Unix(), claims.ExpiresAt.Unix())
+			assert.True(t, claims.validAt(testNow))
+		})
 	}
+}
 
+func TestLogout(t *testing.T) {
 	testcases := []struct {
-		name                               string
-		getIngredientOverrideFunc          func(ctx context.Context, id uuid.UUID) (*store.Ingredient, error)
-		createFridgeIngredientOverrideFunc func(ctx context.Context, f store.FridgeIngredient) (*store.FridgeIngredient, error)
-		requestBody                        FridgeIngredient
-		expectedResponse                   *FridgeIngredient
-		expectedStatus                     int
+		name                      string
+		getRefreshTokenFunc       func(ctx context.Context, hashedToken string) (*store.RefreshToken, error)
+		revokeAccessTokenFunc     func(ctx context.Context, jti uuid.UUID, expiresAt time.Time) error
+		requestBody               string
+		expectedStatus            int
+		expectedFamilyRevocations int
 	}{
 		{
 			"happyPath",
 			nil,
 			nil,
-			goodFridgeIngredient,
-			&FridgeIngredient{
-				UserUUID:       uuid.MustParse("080b5f09-527b-4581-bb56-19adbfe50ebf"),
-				IngredientUUID: uuid.MustParse("ffff7c73-52b0-4e3d-bf3f-0c26785ef972"),
-				Amount:         3,
-				Unit:           "kg",
-				PurchasedDate:  time.Now(),
-				ExpirationDate: time.Now().Add(7 * 24 * time.Hour), //여기서의 time.Now()는 직전의 time.Now()랑 아주 약간 달라질 것이므로 expectedResponse 검사할 때 정확한 time.Time을 검사하는게 아니라 year, month, day만 검사하래..
+			`{"refresh_token":"potatoes"}`,
+			http.StatusOK,
+			1,
+		},
+		{
+			"happyPath:noBody",
+			nil,
+			nil,
+			"",
+			http.StatusOK,
+			0,
+		},
+		{
+			"happyPath:unknownRefreshToken",
+			func(ctx context.Context, hashedToken string) (*store.RefreshToken, error) {
+				return nil, store.ErrNotFound
 			},
+			nil,
+			`{"refresh_token":"potatoes"}`,
 			http.StatusOK,
+			0,
 		},
 		{
 			"badRequest",
 			nil,
 			nil,
-			badFridgeIngredient,
-			nil,
+			`{"refresh_token":`,
 			http.StatusBadRequest,
+			0,
 		},
 		{
-			"internalServerError:getIngredient",
-			func(ctx context.Context, id uuid.UUID) (*store.Ingredient, error) {
-				return nil, errors.New("internalServerError:getIngredient")
+			"forbidden",
+			func(ctx context.Context, hashedToken string) (*store.RefreshToken, error) {
+				return &store.RefreshToken{UserUUID: testRecipeOwnerUUID, FamilyUUID: uuid.New()}, nil
 			},
 			nil,
-			goodFridgeIngredient,
+			`{"refresh_token":"potatoes"}`,
+			http.StatusForbidden,
+			0,
+		},
+		{
+			"internalServerError",
 			nil,
+			func(ctx context.Context, jti uuid.UUID, expiresAt time.Time) error {
+				return errors.New("internalServerError")
+			},
+			"",
 			http.StatusInternalServerError,
+			0,
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/logout", strings.NewReader(testcase.requestBody))
+			w := httptest.NewRecorder()
+			authorize(t, req, testUserUUID)
+
+			var familyRevocations int
+			testServer.db = &mockstore.Mockstore{
+				GetRefreshTokenOverride:   testcase.getRefreshTokenFunc,
+				RevokeAccessTokenOverride: testcase.revokeAccessTokenFunc,
+				RevokeRefreshTokenFamilyOverride: func(ctx context.Context, familyID uuid.UUID) error {
+					familyRevocations++
+					return nil
+				},
+			}
+			testServer.r.ServeHTTP(w, req)
+
+			assert.Equal(t, testcase.expectedStatus, w.Code)
+			assert.Equal(t, testcase.expectedFamilyRevocations, familyRevocations)
+		})
+	}
+}
+
+func TestGetUser(t *testing.T) {
+	testcases := []struct {
+		name                   string
+		getUserOverrideFunc    func(ctx context.Context, id uuid.UUID) (*store.User, error)
+		requestBody            string
+		expectedResponse       *User
+		expectedResponseStatus int
+	}{
+		{
+			"happyPath",
+			nil,
+			"080b5f09-527b-4581-bb56-19adbfe50ebf",
+			&User{UserUUID: uuid.MustParse("080b5f09-527b-4581-bb56-19adbfe50ebf"),
+				Active:       true,
+				Role:         store.RoleUser,
+				FirstName:    "jy",
+				LastName:     "woo",
+				EmailAddress: "jywoo92324@gmail.com"},
+			http.StatusOK,
 		},
 		{
-			"internalServerError:createFridgeIngredient",
+			"badRequest",
 			nil,
-			func(ctx context.Context, f store.FridgeIngredient) (*store.FridgeIngredient, error) {
-				return nil, errors.New("internalServerError:createFridgeIngredient")
+			"badrequesthehehe",
+			nil,
+			http.StatusBadRequest,
+		},
+		{
+			"forbidden",
+			nil,
+			"2c98fff4-7ccc-4536-8259-67a88380e99c",
+			nil,
+			http.StatusForbidden,
+		},
+		{
+			"internalServerError",
+			func(ctx context.Context, id uuid.UUID) (*store.User, error) {
+				return nil, errors.New("internalServerError")
 			},
-			goodFridgeIngredient,
+			"080b5f09-527b-4581-bb56-19adbfe50ebf",
 			nil,
 			http.StatusInternalServerError,
 		},
@@ -899,38 +1829,27 @@ func TestCreateFridgeIngredient(t *testing.T) {
 
 	for _, testcase := range testcases {
 		t.Run(testcase.name, func(t *testing.T) {
-			reqBody, err := json.Marshal(testcase.requestBody)
-			assert.NoError(t, err, "unexpected error marshalling the request body")
-
-			req := httptest.NewRequest(http.MethodPost, "/fridge_ingredients", bytes.NewBuffer(reqBody))
+			req := httptest.NewRequest(http.MethodGet, "/users/"+testcase.requestBody, nil)
 			w := httptest.NewRecorder()
+			authorize(t, req, testUserUUID)
 
-			testServer.db = &mockstore.Mockstore{
-				GetIngredientOverride:          testcase.getIngredientOverrideFunc,
-				CreateFridgeIngredientOverride: testcase.createFridgeIngredientOverrideFunc}
+			testServer.db = &mockstore.Mockstore{GetUserOverride: testcase.getUserOverrideFunc}
 			testServer.r.ServeHTTP(w, req)
 
-			assert.Equal(t, testcase.expectedStatus, w.Code)
+			assert.Equal(t, testcase.expectedResponseStatus, w.Code)
 
-			if testcase.expectedResponse != nil {
-				var resBody FridgeIngredient
+			if testcase.expectedResponse != nil { //if you have testcase.expectedResponse, check if it's not nil. Otherwise, you can just check if the testcase.expectedStatus is http.ok like in Login handler test.
+				var resBody User
 
 				err := json.Unmarshal(w.Body.Bytes(), &resBody)
 				assert.NoError(t, err, "unexpected error unmarshalling the response body")
 
-				assert.Equal(t, testcase.expectedResponse.PurchasedDate.Year(), resBody.PurchasedDate.Year())
-				assert.Equal(t, testcase.expectedResponse.PurchasedDate.Month(), resBody.PurchasedDate.Month())
-				assert.Equal(t, testcase.expectedResponse.PurchasedDate.Day(), resBody.PurchasedDate.Day()) //이거 한줄로 줄이는 방법 없을까..
-
-				assert.Equal(t, testcase.expectedResponse.ExpirationDate.Year(), resBody.ExpirationDate.Year())
-				assert.Equal(t, testcase.expectedResponse.ExpirationDate.Month(), resBody.ExpirationDate.Month())
-				assert.Equal(t, testcase.expectedResponse.ExpirationDate.Day(), resBody.ExpirationDate.Day())
-
-				assert.Equal(t, testcase.expectedResponse.UserUUID, resBody.UserUUID)
-				assert.Equal(t, testcase.expectedResponse.IngredientUUID, resBody.IngredientUUID)
-				assert.Equal(t, testcase.expectedResponse.Amount, resBody.Amount)
-				assert.Equal(t, testcase.expectedResponse.Amount, resBody.Amount)
-				assert.Equal(t, testcase.expectedResponse.Unit, resBody.Unit)
+				assert.Equal(t, *testcase.expectedResponse, resBody)
+				// assert.Equal(t, testcase.expectedResponse.UserUUID, resBody.UserUUID)
+				// assert.Equal(t, testcase.expectedResponse.Active, resBody.Active)
+				// assert.Equal(t, testcase.expectedResponse.FirstName, resBody.FirstName)
+				// assert.Equal(t, testcase.expectedResponse.LastName, resBody.LastName)
+				// assert.Equal(t, testcase.expectedResponse.EmailAddress, resBody.EmailAddress)
 			} else {
 				assert.Equal(t, 0, w.Body.Len())
 			}
@@ -938,50 +1857,5183 @@ func TestCreateFridgeIngredient(t *testing.T) {
 	}
 }
 
-func TestUpdateFridgeIngredient(t *testing.T) {
-	goodFridgeIngredient := FridgeIngredient{
-		UserUUID:       uuid.MustParse("080b5f09-527b-4581-bb56-19adbfe50ebf"),
-		IngredientUUID: uuid.MustParse("ffff7c73-52b0-4e3d-bf3f-0c26785ef972"),
-		Amount:         5,
-		Unit:           "lb",
-		PurchasedDate:  time.Now(),
+func TestCreateUser(t *testing.T) {
+	type createUserRequest struct {
+		User
+		Password string
 	}
 
-	badFridgeIngredient := FridgeIngredient{
-		UserUUID:       uuid.Nil,
-		IngredientUUID: uuid.MustParse("2c98fff4-7ccc-4536-8259-67a88380e99c"),
-		Amount:         5,
-		Unit:           "kg",
-		PurchasedDate:  time.Now(),
-	}
+	goodUser := createUserRequest{
+		User: User{
+			Active:       true,
+			FirstName:    "jy",
+			LastName:     "woo",
+			EmailAddress: "jywoo92324@gmail.com"},
+		Password: "kimchi jjigae"}
+
+	badUser := createUserRequest{
+		User: User{
+			Active:       true,
+			FirstName:    "",
+			LastName:     "",
+			EmailAddress: "jywoo92324@gmail.com"},
+		Password: "kimchi jjigae"}
+
+	inactiveUser := goodUser //signups don't get to say, they start active either way
+	inactiveUser.Active = false
+
+	weakPasswordUser := goodUser
+	weakPasswordUser.Password = "abcdefgh"
+
+	personalPasswordUser := goodUser
+	personalPasswordUser.Password = "JYWOO92324!!"
 
 	testcases := []struct {
-		name                               string
-		updateFridgeIngredientOverrideFunc func(ctx context.Context, f store.FridgeIngredient) (*store.FridgeIngredient, error)
-		requestBody                        FridgeIngredient
-		expectedResponse                   *FridgeIngredient
-		expectedStatus                     int
+		name                   string
+		createUserOverrideFunc func(ctx context.Context, u store.User) (*store.User, error)
+		requestBody            createUserRequest
+		expectedResponse       *User
+		expectedResponseStatus int
 	}{
 		{
-			"happyPath",
+			"happyPath",
+			nil,
+			goodUser,
+			&goodUser.User,
+			http.StatusOK,
+		},
+		{
+			"happyPath:activeNotSent",
+			nil,
+			inactiveUser,
+			&goodUser.User,
+			http.StatusOK,
+		},
+		{
+			"badRequest",
+			nil,
+			badUser,
+			nil,
+			http.StatusBadRequest,
+		},
+		{
+			"badRequest:weakPassword",
+			nil,
+			weakPasswordUser,
+			nil,
+			http.StatusBadRequest,
+		},
+		{
+			"badRequest:personalPassword", //it's the email with the caps lock on
+			nil,
+			personalPasswordUser,
+			nil,
+			http.StatusBadRequest,
+		},
+		{
+			"internalServerError",
+			func(ctx context.Context, u store.User) (*store.User, error) {
+				return nil, errors.New("internalServerError")
+			},
+			goodUser,
+			nil,
+			http.StatusInternalServerError,
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			reqBody, err := json.Marshal(testcase.requestBody)
+			assert.NoError(t, err, "unexpected error marshalling the request body")
+
+			req := httptest.NewRequest(http.MethodPost, "/users", bytes.NewBuffer(reqBody))
+			w := httptest.NewRecorder()
+
+			testServer.db = &mockstore.Mockstore{CreateUserOverride: testcase.createUserOverrideFunc}
+			sentBefore := len(testMailer.Sent())
+			testServer.r.ServeHTTP(w, req)
+
+			assert.Equal(t, testcase.expectedResponseStatus, w.Code)
+
+			if testcase.expectedResponse != nil {
+				var resBody User
+
+				err := json.Unmarshal(w.Body.Bytes(), &resBody)
+				assert.NoError(t, err, "unexpected error unmarshalling the response body")
+
+				assert.NotEqual(t, resBody.UserUUID, uuid.Nil) //uuid가 랜덤으로 generate 됐기 때문에, 그냥 response uuid가 uuid Nil이 아닌지만 검사.
+				//assert.Equal(t, *testcase.expectedResponse, resBody)
+				assert.Equal(t, testcase.expectedResponse.Active, resBody.Active)
+				assert.Equal(t, testcase.expectedResponse.FirstName, resBody.FirstName)
+				assert.Equal(t, testcase.expectedResponse.LastName, resBody.LastName)
+				assert.Equal(t, testcase.expectedResponse.EmailAddress, resBody.EmailAddress)
+				assert.Nil(t, resBody.EmailVerifiedAt)
+
+				sent := testMailer.Sent()[sentBefore:] //new accounts get a verification link
+				assert.Len(t, sent, 1)
+				assert.Equal(t, testcase.expectedResponse.EmailAddress, sent[0].To)
+				assert.Contains(t, sent[0].Body, "https://wdiet.test/users/verify?token=")
+			} else {
+				assert.Equal(t, 0, w.Body.Len())
+			}
+		})
+	}
+}
+
+func TestUpdateUser(t *testing.T) {
+	goodUser := User{ //존 왈, requestBody랑 expectedResponse가 완전히 똑같으므로, 그냥 여기에 하나를 정의해서 복붙해라 ㅋㅋ
+		UserUUID:     uuid.MustParse("080b5f09-527b-4581-bb56-19adbfe50ebf"),
+		Active:       true,
+		FirstName:    "jy",
+		LastName:     "woo",
+		EmailAddress: "jywoo92324@gmail.com",
+	}
+
+	badUser := User{
+		UserUUID:     uuid.MustParse("080b5f09-527b-4581-bb56-19adbfe50ebf"),
+		Active:       true,
+		FirstName:    "",
+		LastName:     "",
+		EmailAddress: "jywoo92324@gmail.com",
+	}
+
+	otherUser := goodUser
+	otherUser.UserUUID = uuid.MustParse("2c98fff4-7ccc-4536-8259-67a88380e99c")
+
+	testcases := []struct {
+		name                   string
+		updateUserOverrideFunc func(ctx context.Context, u store.User) (*store.User, error)
+		requestBody            User
+		expectedResponse       *User
+		expectedResponseStatus int
+	}{
+		{
+			"happyPath",
+			nil,
+			goodUser,
+			&goodUser,
+			http.StatusOK,
+		},
+		{
+			"badRequest",
+			nil,
+			badUser,
+			nil,
+			http.StatusBadRequest,
+		},
+		{
+			"forbidden",
+			nil,
+			otherUser,
+			nil,
+			http.StatusForbidden,
+		},
+		{
+			"internalServerError",
+			func(ctx context.Context, u store.User) (*store.User, error) {
+				return nil, errors.New("internalServerError")
+			},
+			goodUser,
+			nil,
+			http.StatusInternalServerError,
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			reqBody, err := json.Marshal(testcase.requestBody)
+			assert.NoError(t, err, "unexpected error marshalling request body")
+
+			req := httptest.NewRequest(http.MethodPost, "/users/"+testcase.requestBody.UserUUID.String(), bytes.NewBuffer(reqBody)) //이 경우는 특이. url에 param이랑, request body가 같이 오므로 "/users/" 뒤에 +도 해줘야돼고, bytes.NewBuffer도 해줘야 됨!
+			w := httptest.NewRecorder()
+			authorize(t, req, testUserUUID)
+
+			testServer.db = &mockstore.Mockstore{UpdateUserOverride: testcase.updateUserOverrideFunc}
+			testServer.r.ServeHTTP(w, req)
+
+			assert.Equal(t, testcase.expectedResponseStatus, w.Code)
+
+			if testcase.expectedResponse != nil {
+				var resBody User
+
+				err = json.Unmarshal(w.Body.Bytes(), &resBody)
+				assert.NoError(t, err, "unexpected error unmarshalling the response body")
+
+				assert.Equal(t, *testcase.expectedResponse, resBody)
+				// assert.Equal(t, testcase.expectedResponse.UserUUID, resBody.UserUUID)
+				// assert.Equal(t, testcase.expectedResponse.Active, resBody.Active)
+				// assert.Equal(t, testcase.expectedResponse.FirstName, resBody.FirstName)
+				// assert.Equal(t, testcase.expectedResponse.LastName, resBody.LastName)
+				// assert.Equal(t, testcase.expectedResponse.EmailAddress, resBody.EmailAddress)
+			} else {
+				assert.Equal(t, 0, w.Body.Len())
+			}
+		})
+	}
+}
+
+func TestDeactivateUser(t *testing.T) {
+	testcases := []struct {
+		name                      string
+		setUserActiveOverrideFunc func(ctx context.Context, id uuid.UUID, active bool) (*store.User, error)
+		requestPath               string
+		expectedResponse          *User
+		expectedResponseStatus    int
+	}{
+		{
+			"happyPath",
+			nil,
+			"080b5f09-527b-4581-bb56-19adbfe50ebf",
+			&User{UserUUID: uuid.MustParse("080b5f09-527b-4581-bb56-19adbfe50ebf"),
+				Role:         store.RoleUser,
+				FirstName:    "jy",
+				LastName:     "woo",
+				EmailAddress: "jywoo92324@gmail.com"},
+			http.StatusOK,
+		},
+		{
+			"badRequest",
+			nil,
+			"maerong",
+			nil,
+			http.StatusBadRequest,
+		},
+		{
+			"forbidden",
+			nil,
+			"2c98fff4-7ccc-4536-8259-67a88380e99c",
+			nil,
+			http.StatusForbidden,
+		},
+		{
+			"notFound",
+			func(ctx context.Context, id uuid.UUID, active bool) (*store.User, error) {
+				return nil, store.ErrNotFound
+			},
+			"080b5f09-527b-4581-bb56-19adbfe50ebf",
+			nil,
+			http.StatusNotFound,
+		},
+		{
+			"internalServerError",
+			func(ctx context.Context, id uuid.UUID, active bool) (*store.User, error) {
+				return nil, errors.New("internalServerError")
+			},
+			"080b5f09-527b-4581-bb56-19adbfe50ebf",
+			nil,
+			http.StatusInternalServerError,
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/users/"+testcase.requestPath+"/deactivate", nil)
+			w := httptest.NewRecorder()
+			authorize(t, req, testUserUUID)
+
+			testServer.db = &mockstore.Mockstore{SetUserActiveOverride: testcase.setUserActiveOverrideFunc}
+			testServer.lockout = newTestLockout()
+			testServer.r.ServeHTTP(w, req)
+
+			assert.Equal(t, testcase.expectedResponseStatus, w.Code)
+
+			if testcase.expectedResponse != nil {
+				var resBody User
+
+				err := json.Unmarshal(w.Body.Bytes(), &resBody)
+				assert.NoError(t, err, "unexpected error unmarshalling the response body")
+
+				assert.Equal(t, *testcase.expectedResponse, resBody)
+			}
+		})
+	}
+}
+
+func TestReactivateUser(t *testing.T) {
+	pinClock(t)
+
+	code, err := totp.Code(testTOTPSecret, testNow)
+	assert.NoError(t, err)
+
+	testcases := []struct {
+		name                      string
+		setUserActiveOverrideFunc func(ctx context.Context, id uuid.UUID, active bool) (*store.User, error)
+		getTOTPOverrideFunc       func(ctx context.Context, uid uuid.UUID) (*store.TOTP, error)
+		requestPath               string
+		requestBody               Reactivation
+		expectedResponse          *User
+		expectedResponseStatus    int
+	}{
+		{
+			"happyPath",
+			nil,
+			nil,
+			"080b5f09-527b-4581-bb56-19adbfe50ebf",
+			Reactivation{EmailAddress: "jywoo92324@gmail.com", Password: "hello"},
+			&User{UserUUID: uuid.MustParse("080b5f09-527b-4581-bb56-19adbfe50ebf"),
+				Active:       true,
+				Role:         store.RoleUser,
+				FirstName:    "jy",
+				LastName:     "woo",
+				EmailAddress: "jywoo92324@gmail.com"},
+			http.StatusOK,
+		},
+		{
+			"badRequest",
+			nil,
+			nil,
+			"080b5f09-527b-4581-bb56-19adbfe50ebf",
+			Reactivation{EmailAddress: "jywoo92324@gmail.com"},
+			nil,
+			http.StatusBadRequest,
+		},
+		{
+			"unauthorized:wrongPassword",
+			nil,
+			nil,
+			"080b5f09-527b-4581-bb56-19adbfe50ebf",
+			Reactivation{EmailAddress: "jywoo92324@gmail.com", Password: "potatoes"},
+			nil,
+			http.StatusUnauthorized,
+		},
+		{
+			"happyPath:twoFactor",
+			nil,
+			enabledTOTP,
+			"080b5f09-527b-4581-bb56-19adbfe50ebf",
+			Reactivation{EmailAddress: "jywoo92324@gmail.com", Password: "hello", Code: code},
+			&User{UserUUID: uuid.MustParse("080b5f09-527b-4581-bb56-19adbfe50ebf"),
+				Active:       true,
+				Role:         store.RoleUser,
+				FirstName:    "jy",
+				LastName:     "woo",
+				EmailAddress: "jywoo92324@gmail.com"},
+			http.StatusOK,
+		},
+		{
+			"unauthorized:twoFactorMissingCode", //the password alone isn't enough anymore
+			nil,
+			enabledTOTP,
+			"080b5f09-527b-4581-bb56-19adbfe50ebf",
+			Reactivation{EmailAddress: "jywoo92324@gmail.com", Password: "hello"},
+			nil,
+			http.StatusUnauthorized,
+		},
+		{
+			"unauthorized:twoFactorWrongCode",
+			nil,
+			enabledTOTP,
+			"080b5f09-527b-4581-bb56-19adbfe50ebf",
+			Reactivation{EmailAddress: "jywoo92324@gmail.com", Password: "hello", Code: "000000"},
+			nil,
+			http.StatusUnauthorized,
+		},
+		{
+			"internalServerError:totp",
+			nil,
+			func(ctx context.Context, uid uuid.UUID) (*store.TOTP, error) {
+				return nil, errors.New("internalServerError")
+			},
+			"080b5f09-527b-4581-bb56-19adbfe50ebf",
+			Reactivation{EmailAddress: "jywoo92324@gmail.com", Password: "hello", Code: code},
+			nil,
+			http.StatusInternalServerError,
+		},
+		{
+			"forbidden:someoneElse", //right credentials, but for another account
+			nil,
+			nil,
+			"2c98fff4-7ccc-4536-8259-67a88380e99c",
+			Reactivation{EmailAddress: "jywoo92324@gmail.com", Password: "hello"},
+			nil,
+			http.StatusForbidden,
+		},
+		{
+			"internalServerError",
+			func(ctx context.Context, id uuid.UUID, active bool) (*store.User, error) {
+				return nil, errors.New("internalServerError")
+			},
+			nil,
+			"080b5f09-527b-4581-bb56-19adbfe50ebf",
+			Reactivation{EmailAddress: "jywoo92324@gmail.com", Password: "hello"},
+			nil,
+			http.StatusInternalServerError,
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			reqBody, err := json.Marshal(testcase.requestBody)
+			assert.NoError(t, err, "unexpected error marshalling the request body")
+
+			req := httptest.NewRequest(http.MethodPost, "/users/"+testcase.requestPath+"/reactivate", bytes.NewBuffer(reqBody))
+			w := httptest.NewRecorder()
+
+			testServer.db = &mockstore.Mockstore{
+				SetUserActiveOverride: testcase.setUserActiveOverrideFunc,
+				GetTOTPOverride:       testcase.getTOTPOverrideFunc}
+			testServer.lockout = newTestLockout()
+			testServer.r.ServeHTTP(w, req)
+
+			assert.Equal(t, testcase.expectedResponseStatus, w.Code)
+
+			if testcase.expectedResponse != nil {
+				var resBody User
+
+				err := json.Unmarshal(w.Body.Bytes(), &resBody)
+				assert.NoError(t, err, "unexpected error unmarshalling the response body")
+
+				assert.Equal(t, *testcase.expectedResponse, resBody)
+			}
+		})
+	}
+}
+
+func TestReactivateUserLockout(t *testing.T) {
+	pinClock(t)
+
+	code, err := totp.Code(testTOTPSecret, testNow)
+	assert.NoError(t, err)
+
+	reactivated := false
+
+	testServer.db = &mockstore.Mockstore{
+		GetTOTPOverride: enabledTOTP,
+		SetUserActiveOverride: func(ctx context.Context, id uuid.UUID, active bool) (*store.User, error) {
+			reactivated = true
+			return &store.User{UserUUID: id, Active: active}, nil
+		},
+	}
+	testServer.lockout = lockout.New(lockout.NewMemory(),
+		lockout.Policy{FreeAttempts: 1, BaseDelay: time.Minute, MaxDelay: time.Hour, LockoutAfter: 2, LockoutFor: time.Hour, Window: time.Hour},
+		lockout.DefaultIPPolicy)
+	defer func() { testServer.lockout = newTestLockout() }()
+
+	post := func(code string) int {
+		reqBody, err := json.Marshal(Reactivation{EmailAddress: "jywoo92324@gmail.com", Password: "hello", Code: code})
+		assert.NoError(t, err, "unexpected error marshalling the request body")
+
+		req := httptest.NewRequest(http.MethodPost, "/users/080b5f09-527b-4581-bb56-19adbfe50ebf/reactivate", bytes.NewBuffer(reqBody))
+		w := httptest.NewRecorder()
+		testServer.r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, post("000000"))
+	assert.Equal(t, http.StatusUnauthorized, post("111111"))
+	assert.Equal(t, http.StatusTooManyRequests, post(code), "wrong codes count against the login lockout")
+	assert.False(t, reactivated)
+}
+
+func TestExportUser(t *testing.T) {
+	pinClock(t)
+
+	testcases := []struct {
+		name                   string
+		mockstore              mockstore.Mockstore
+		requestPath            string
+		expectedResponseStatus int
+	}{
+		{"happyPath", mockstore.Mockstore{}, "080b5f09-527b-4581-bb56-19adbfe50ebf", http.StatusOK},
+		{"badRequest", mockstore.Mockstore{}, "potatoes", http.StatusBadRequest},
+		{"forbidden", mockstore.Mockstore{}, "2c98fff4-7ccc-4536-8259-67a88380e99c", http.StatusForbidden},
+		{
+			"notFound",
+			mockstore.Mockstore{GetUserOverride: func(ctx context.Context, id uuid.UUID) (*store.User, error) {
+				return nil, store.ErrNotFound
+			}},
+			"080b5f09-527b-4581-bb56-19adbfe50ebf",
+			http.StatusNotFound,
+		},
+		{
+			"internalServerError",
+			mockstore.Mockstore{ListRecipesOverride: func(ctx context.Context, id uuid.UUID) ([]store.Recipe, error) {
+				return nil, errors.New("unexpected error")
+			}},
+			"080b5f09-527b-4581-bb56-19adbfe50ebf",
+			http.StatusInternalServerError,
+		},
+		{
+			"internalServerError:fridgeEvents",
+			mockstore.Mockstore{ListUserFridgeEventsOverride: func(ctx context.Context, uid uuid.UUID) ([]store.FridgeEvent, error) {
+				return nil, errors.New("unexpected error")
+			}},
+			"080b5f09-527b-4581-bb56-19adbfe50ebf",
+			http.StatusInternalServerError,
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/users/"+testcase.requestPath+"/export", nil)
+			w := httptest.NewRecorder()
+			authorize(t, req, testUserUUID)
+
+			m := testcase.mockstore
+			testServer.db = &m
+			testServer.r.ServeHTTP(w, req)
+
+			assert.Equal(t, testcase.expectedResponseStatus, w.Code)
+		})
+	}
+
+	//what's in it
+	m := &mockstore.Mockstore{
+		GetTOTPOverride: enabledTOTP,
+		ListFridgeIngredientsOverride: func(ctx context.Context, hid uuid.UUID) ([]store.FridgeIngredient, error) {
+			return []store.FridgeIngredient{
+				{HouseholdUUID: hid, UserUUID: testUserUUID, IngredientUUID: uuid.New(), Amount: units.Whole(3), Unit: "kg"},
+				{HouseholdUUID: hid, UserUUID: testRecipeOwnerUUID, IngredientUUID: uuid.New(), Amount: units.Whole(1), Unit: "kg"}, //shared fridge, not theirs
+			}, nil
+		},
+		ListUserIdentitiesOverride: func(ctx context.Context, uid uuid.UUID) ([]store.UserIdentity, error) {
+			return []store.UserIdentity{{UserUUID: uid, Provider: "google", Subject: "248289761001", EmailAddress: "jywoo92324@gmail.com"}}, nil
+		},
+		ListUserFridgeEventsOverride: func(ctx context.Context, uid uuid.UUID) ([]store.FridgeEvent, error) {
+			cost := units.MustParseAmount("2.5")
+			return []store.FridgeEvent{
+				//a household they left
+				{EventType: store.FridgeEventTypeAdd, HouseholdUUID: uuid.New(), UserUUID: uid, IngredientName: "tofu", Amount: units.Whole(1), Unit: "kg", PurchasedDate: time.Date(2022, 12, 20, 0, 0, 0, 0, time.UTC), ExpirationDate: time.Date(2022, 12, 27, 0, 0, 0, 0, time.UTC)},
+				//from before the ledger, no dates
+				{EventType: store.FridgeEventTypeDelete, HouseholdUUID: testHouseholdUUID, UserUUID: uid, IngredientName: "onion", Amount: units.Whole(1), Unit: "kg", Reason: store.FridgeEventExpired, EstimatedCost: &cost},
+			}, nil
+		},
+		GetDigestSettingsOverride: func(ctx context.Context, uid uuid.UUID) (*store.DigestSettings, error) {
+			return &store.DigestSettings{UserUUID: uid, Enabled: true, Minute: 7*60 + 30, Timezone: "Asia/Seoul", Channel: "webhook", WebhookURL: "https://hooks.example.com/wdiet", WithinDays: 2}, nil
+		},
+	}
+	testServer.db = m
+
+	req := httptest.NewRequest(http.MethodGet, "/users/"+testUserUUID.String()+"/export", nil)
+	w := httptest.NewRecorder()
+	authorize(t, req, testUserUUID)
+	testServer.r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `attachment; filename="wdiet-export-080b5f09-527b-4581-bb56-19adbfe50ebf.json"`, w.Header().Get("Content-Disposition"))
+	assert.NotContains(t, w.Body.String(), testTOTPSecret)
+	assert.NotContains(t, w.Body.String(), "hashed")
+
+	var export UserExport
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &export))
+
+	recipes, _ := m.ListRecipes(context.Background(), testUserUUID)
+	tokens, _ := m.ListPersonalAccessTokens(context.Background(), testUserUUID)
+
+	assert.Equal(t, testNow, export.ExportedAt)
+	assert.Equal(t, testUserUUID, export.User.UserUUID)
+	assert.NotNil(t, export.TwoFactorEnabledAt)
+	assert.Equal(t, []HouseholdMembership{{HouseholdUUID: testHouseholdUUID, HouseholdName: "jy's household", Role: store.HouseholdRoleOwner, Active: true, JoinedAt: time.Date(2022, 12, 1, 0, 0, 0, 0, time.UTC)}}, export.Households)
+	if assert.Len(t, export.FridgeIngredients, 1) {
+		assert.Equal(t, testUserUUID, export.FridgeIngredients[0].UserUUID)
+	}
+	if assert.Len(t, export.FridgeEvents, 2) {
+		assert.Equal(t, time.Date(2022, 12, 20, 0, 0, 0, 0, time.UTC), *export.FridgeEvents[0].PurchasedDate)
+		assert.Equal(t, time.Date(2022, 12, 27, 0, 0, 0, 0, time.UTC), *export.FridgeEvents[0].ExpirationDate)
+		assert.Nil(t, export.FridgeEvents[1].PurchasedDate)
+		assert.Equal(t, store.FridgeEventExpired, export.FridgeEvents[1].Reason)
+		assert.Equal(t, "2.5", export.FridgeEvents[1].EstimatedCost.String())
+	}
+	assert.Len(t, export.Recipes, len(recipes))
+	assert.Len(t, export.CookLogs, 1)
+	assert.Len(t, export.PersonalAccessTokens, len(tokens))
+	assert.Equal(t, []UserIdentity{{Provider: "google", Subject: "248289761001", EmailAddress: "jywoo92324@gmail.com"}}, export.Identities)
+	if assert.Len(t, export.Sessions, 2) {
+		assert.Nil(t, export.Sessions[0].RevokedAt)
+		assert.NotNil(t, export.Sessions[1].RevokedAt)
+	}
+	assert.Equal(t, &DigestSettings{UserUUID: testUserUUID, Enabled: true, Time: "07:30", Timezone: "Asia/Seoul", Channel: "webhook", WebhookURL: "https://hooks.example.com/wdiet", WithinDays: 2}, export.DigestSettings)
+
+	//no digest settings
+	m.GetDigestSettingsOverride = func(ctx context.Context, uid uuid.UUID) (*store.DigestSettings, error) {
+		return nil, store.ErrNotFound
+	}
+
+	w = httptest.NewRecorder()
+	testServer.r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), "digest_settings")
+}
+
+func TestDeleteUser(t *testing.T) {
+	pinClock(t)
+
+	testcases := []struct {
+		name                   string
+		requestOverrideFunc    func(ctx context.Context, id uuid.UUID, deleteAfter time.Time) error
+		requestPath            string
+		requestBody            ChangePassword
+		expectedResponseStatus int
+	}{
+		{
+			"happyPath",
+			func(ctx context.Context, id uuid.UUID, deleteAfter time.Time) error {
+				if id != testUserUUID || !deleteAfter.Equal(testNow.Add(defaultDeletionGracePeriod)) {
+					return errors.New("unexpected deletion request")
+				}
+				return nil
+			},
+			"080b5f09-527b-4581-bb56-19adbfe50ebf",
+			ChangePassword{CurrentPassword: "hello"},
+			http.StatusOK,
+		},
+		{
+			"unauthorized:noPassword", //and the token doesn't say they logged in recently, see TestReauthentication
+			nil,
+			"080b5f09-527b-4581-bb56-19adbfe50ebf",
+			ChangePassword{},
+			http.StatusUnauthorized,
+		},
+		{
+			"badRequest:wrongPassword",
+			func(ctx context.Context, id uuid.UUID, deleteAfter time.Time) error {
+				return errors.New("shouldn't get this far")
+			},
+			"080b5f09-527b-4581-bb56-19adbfe50ebf",
+			ChangePassword{CurrentPassword: "potatoes"},
+			http.StatusBadRequest,
+		},
+		{
+			"forbidden",
+			nil,
+			"2c98fff4-7ccc-4536-8259-67a88380e99c",
+			ChangePassword{CurrentPassword: "hello"},
+			http.StatusForbidden,
+		},
+		{
+			"notFound",
+			func(ctx context.Context, id uuid.UUID, deleteAfter time.Time) error {
+				return store.ErrNotFound
+			},
+			"080b5f09-527b-4581-bb56-19adbfe50ebf",
+			ChangePassword{CurrentPassword: "hello"},
+			http.StatusNotFound,
+		},
+		{
+			"internalServerError",
+			func(ctx context.Context, id uuid.UUID, deleteAfter time.Time) error {
+				return errors.New("unexpected error")
+			},
+			"080b5f09-527b-4581-bb56-19adbfe50ebf",
+			ChangePassword{CurrentPassword: "hello"},
+			http.StatusInternalServerError,
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			reqBody, err := json.Marshal(testcase.requestBody)
+			assert.NoError(t, err, "unexpected error marshalling the request body")
+
+			req := httptest.NewRequest(http.MethodDelete, "/users/"+testcase.requestPath, bytes.NewBuffer(reqBody))
+			w := httptest.NewRecorder()
+			authorize(t, req, testUserUUID)
+
+			testServer.db = &mockstore.Mockstore{
+				GetUserOverride: func(ctx context.Context, id uuid.UUID) (*store.User, error) {
+					hashedPassword, err := testHasher.Hash("hello")
+					return &store.User{UserUUID: id, HashedPassword: hashedPassword, Active: true, Role: store.RoleUser}, err
+				},
+				RequestUserDeletionOverride: testcase.requestOverrideFunc,
+				DeleteUserOverride: func(ctx context.Context, id uuid.UUID) error {
+					t.Error("nothing is deleted before the grace period is over")
+					return nil
+				},
+			}
+			testServer.r.ServeHTTP(w, req)
+
+			assert.Equal(t, testcase.expectedResponseStatus, w.Code)
+
+			if w.Code == http.StatusOK {
+				var resBody AccountDeletion
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resBody))
+				assert.Equal(t, testNow.Add(defaultDeletionGracePeriod), resBody.DeleteAfter)
+			}
+		})
+	}
+}
+
+func TestReauthentication(t *testing.T) {
+	pinClock(t) //a login a minute before testNow is recent, however long ago that is by the wall clock
+
+	ago := func(d time.Duration) *time.Time {
+		at := testNow.Add(-d)
+		return &at
+	}
+
+	testcases := []struct {
+		name           string
+		loggedInAt     *time.Time //nil is a token from a refresh
+		requestBody    string
+		expectedStatus int
+	}{
+		{"happyPath:password", nil, `{"current_password": "hello"}`, http.StatusOK},
+		{"happyPath:recentLogin", ago(time.Minute), "", http.StatusOK}, //logged in through their provider, no password to give
+		{"happyPath:recentLoginEmptyBody", ago(time.Minute), `{}`, http.StatusOK},
+		{"badRequest:wrongPassword", ago(0), `{"current_password": "potatoes"}`, http.StatusBadRequest}, //a wrong password is wrong even after a login
+		{"badRequest:notJSON", ago(0), `maerong`, http.StatusBadRequest},
+		{"unauthorized:oldLogin", ago(time.Hour), "", http.StatusUnauthorized},
+		{"unauthorized:refreshed", nil, "", http.StatusUnauthorized},
+	}
+
+	for _, path := range []string{"/users/" + testUserUUID.String(), "/users/" + testUserUUID.String() + "/2fa"} {
+		for _, testcase := range testcases {
+			t.Run(path+"/"+testcase.name, func(t *testing.T) {
+				req := httptest.NewRequest(http.MethodDelete, path, strings.NewReader(testcase.requestBody))
+				w := httptest.NewRecorder()
+				if testcase.loggedInAt != nil {
+					authorizeLoggedIn(t, req, testUserUUID, *testcase.loggedInAt)
+				} else {
+					authorize(t, req, testUserUUID)
+				}
+
+				testServer.db = &mockstore.Mockstore{
+					GetUserOverride: func(ctx context.Context, id uuid.UUID) (*store.User, error) {
+						hashedPassword, err := testHasher.Hash("hello")
+						return &store.User{UserUUID: id, HashedPassword: hashedPassword, Active: true, Role: store.RoleUser}, err
+					},
+				}
+				testServer.lockout = newTestLockout()
+				testServer.r.ServeHTTP(w, req)
+
+				assert.Equal(t, testcase.expectedStatus, w.Code)
+			})
+		}
+	}
+}
+
+func TestReauthenticationThrottle(t *testing.T) {
+	testServer.db = &mockstore.Mockstore{
+		GetUserOverride: func(ctx context.Context, id uuid.UUID) (*store.User, error) {
+			hashedPassword, err := testHasher.Hash("hello")
+			return &store.User{UserUUID: id, EmailAddress: "jywoo92324@gmail.com", HashedPassword: hashedPassword, Active: true, Role: store.RoleUser}, err
+		},
+	}
+	testServer.lockout = lockout.New(lockout.NewMemory(),
+		lockout.Policy{FreeAttempts: 1, BaseDelay: time.Minute, MaxDelay: time.Hour, LockoutAfter: 2, LockoutFor: time.Hour, Window: time.Hour},
+		lockout.DefaultIPPolicy)
+	defer func() { testServer.lockout = newTestLockout() }()
+
+	reauthenticate := func(path, password string) int {
+		req := httptest.NewRequest(http.MethodDelete, path, strings.NewReader(`{"current_password": "`+password+`"}`))
+		w := httptest.NewRecorder()
+		authorize(t, req, testUserUUID) //a stolen token, no recent login
+		testServer.r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusBadRequest, reauthenticate("/users/"+testUserUUID.String(), "potatoes"))
+	assert.Equal(t, http.StatusBadRequest, reauthenticate("/users/"+testUserUUID.String()+"/2fa", "potatoes")) //the same account either way
+	assert.Equal(t, http.StatusTooManyRequests, reauthenticate("/users/"+testUserUUID.String(), "hello"))
+}
+
+func TestPurgeDeletedUsers(t *testing.T) {
+	pinClock(t)
+
+	due := []uuid.UUID{uuid.New(), uuid.New(), uuid.New()}
+	var deleted []uuid.UUID
+
+	testServer.db = &mockstore.Mockstore{
+		ListUsersDueForDeletionOverride: func(ctx context.Context, now time.Time) ([]uuid.UUID, error) {
+			assert.Equal(t, testNow, now)
+			return due, nil
+		},
+		DeleteUserOverride: func(ctx context.Context, id uuid.UUID) error {
+			if id == due[1] {
+				return errors.New("unexpected error") //the others still go
+			}
+			deleted = append(deleted, id)
+			return nil
+		},
+	}
+
+	assert.Equal(t, 2, testServer.purgeDeletedUsers(context.Background()))
+	assert.Equal(t, []uuid.UUID{due[0], due[2]}, deleted)
+}
+
+func TestChangePassword(t *testing.T) {
+	getUserWithPassword := func(ctx context.Context, id uuid.UUID) (*store.User, error) {
+		hashedPassword, err := bcrypt.GenerateFromPassword([]byte("hello"), bcrypt.MinCost)
+		return &store.User{UserUUID: id, HashedPassword: string(hashedPassword), Active: true, FirstName: "jy", LastName: "woo", EmailAddress: "jywoo92324@gmail.com"}, err
+	}
+
+	testcases := []struct {
+		name                       string
+		changePasswordOverrideFunc func(ctx context.Context, id uuid.UUID, hashedPassword string) error
+		requestPath                string
+		requestBody                ChangePassword
+		expectedResponseStatus     int
+	}{
+		{
+			"happyPath",
+			nil,
+			"080b5f09-527b-4581-bb56-19adbfe50ebf",
+			ChangePassword{CurrentPassword: "hello", NewPassword: "Potatoes4ever"},
+			http.StatusOK,
+		},
+		{
+			"badRequest",
+			nil,
+			"080b5f09-527b-4581-bb56-19adbfe50ebf",
+			ChangePassword{CurrentPassword: "hello"},
+			http.StatusBadRequest,
+		},
+		{
+			"badRequest:weakPassword",
+			nil,
+			"080b5f09-527b-4581-bb56-19adbfe50ebf",
+			ChangePassword{CurrentPassword: "hello", NewPassword: "potatoes"},
+			http.StatusBadRequest,
+		},
+		{
+			"badRequest:personalPassword",
+			nil,
+			"080b5f09-527b-4581-bb56-19adbfe50ebf",
+			ChangePassword{CurrentPassword: "hello", NewPassword: "Jywoo92324!"}, //strong enough, but it's their email
+			http.StatusBadRequest,
+		},
+		{
+			"badRequest:wrongCurrentPassword",
+			nil,
+			"080b5f09-527b-4581-bb56-19adbfe50ebf",
+			ChangePassword{CurrentPassword: "maerong", NewPassword: "Potatoes4ever"},
+			http.StatusBadRequest,
+		},
+		{
+			"forbidden",
+			nil,
+			"2c98fff4-7ccc-4536-8259-67a88380e99c",
+			ChangePassword{CurrentPassword: "hello", NewPassword: "Potatoes4ever"},
+			http.StatusForbidden,
+		},
+		{
+			"internalServerError",
+			func(ctx context.Context, id uuid.UUID, hashedPassword string) error {
+				return errors.New("internalServerError")
+			},
+			"080b5f09-527b-4581-bb56-19adbfe50ebf",
+			ChangePassword{CurrentPassword: "hello", NewPassword: "Potatoes4ever"},
+			http.StatusInternalServerError,
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			reqBody, err := json.Marshal(testcase.requestBody)
+			assert.NoError(t, err, "unexpected error marshalling the request body")
+
+			req := httptest.NewRequest(http.MethodPost, "/users/"+testcase.requestPath+"/password", bytes.NewBuffer(reqBody))
+			w := httptest.NewRecorder()
+			authorize(t, req, testUserUUID)
+			testServer.lockout = newTestLockout()
+
+			var newHash string
+			testServer.db = &mockstore.Mockstore{
+				GetUserOverride: getUserWithPassword,
+				ChangePasswordOverride: func(ctx context.Context, id uuid.UUID, hashedPassword string) error {
+					newHash = hashedPassword
+					if testcase.changePasswordOverrideFunc != nil {
+						return testcase.changePasswordOverrideFunc(ctx, id, hashedPassword)
+					}
+					return nil
+				},
+			}
+			testServer.r.ServeHTTP(w, req)
+
+			assert.Equal(t, testcase.expectedResponseStatus, w.Code)
+
+			if testcase.expectedResponseStatus == http.StatusOK {
+				assert.NoError(t, bcrypt.CompareHashAndPassword([]byte(newHash), []byte(testcase.requestBody.NewPassword)))
+			}
+		})
+	}
+}
+
+func TestChangePasswordThrottle(t *testing.T) {
+	testServer.db = &mockstore.Mockstore{
+		GetUserOverride: func(ctx context.Context, id uuid.UUID) (*store.User, error) {
+			hashedPassword, err := testHasher.Hash("hello")
+			return &store.User{UserUUID: id, EmailAddress: "jywoo92324@gmail.com", HashedPassword: hashedPassword, Active: true, Role: store.RoleUser}, err
+		},
+	}
+	testServer.lockout = lockout.New(lockout.NewMemory(),
+		lockout.Policy{FreeAttempts: 1, BaseDelay: time.Minute, MaxDelay: time.Hour, LockoutAfter: 2, LockoutFor: time.Hour, Window: time.Hour},
+		lockout.DefaultIPPolicy)
+	defer func() { testServer.lockout = newTestLockout() }()
+
+	changePassword := func(current string) int {
+		reqBody, err := json.Marshal(ChangePassword{CurrentPassword: current, NewPassword: "Potatoes4ever"})
+		assert.NoError(t, err, "unexpected error marshalling the request body")
+
+		req := httptest.NewRequest(http.MethodPost, "/users/"+testUserUUID.String()+"/password", bytes.NewBuffer(reqBody))
+		w := httptest.NewRecorder()
+		authorize(t, req, testUserUUID)
+		testServer.r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusBadRequest, changePassword("maerong"))
+	assert.Equal(t, http.StatusBadRequest, changePassword("maerong"))
+	assert.Equal(t, http.StatusTooManyRequests, changePassword("hello"))
+}
+
+func TestRequestPasswordReset(t *testing.T) {
+	testcases := []struct {
+		name                   string
+		getUserByEmailFunc     func(ctx context.Context, email string) (*store.User, error)
+		sendOverrideFunc       func(ctx context.Context, m mailer.Message) error
+		requestBody            PasswordReset
+		expectedResponseStatus int
+		expectedMail           bool
+	}{
+		{
+			"happyPath",
+			nil,
+			nil,
+			PasswordReset{EmailAddress: "jywoo92324@gmail.com"},
+			http.StatusOK,
+			true,
+		},
+		{
+			"badRequest",
+			nil,
+			nil,
+			PasswordReset{},
+			http.StatusBadRequest,
+			false,
+		},
+		{
+			"unknownEmail", //looks exactly like happyPath from outside
+			func(ctx context.Context, email string) (*store.User, error) {
+				return nil, store.ErrNotFound
+			},
+			nil,
+			PasswordReset{EmailAddress: "nobody@gmail.com"},
+			http.StatusOK,
+			false,
+		},
+		{
+			"deactivatedUser",
+			func(ctx context.Context, email string) (*store.User, error) {
+				return &store.User{UserUUID: testUserUUID, Active: false, EmailAddress: email}, nil
+			},
+			nil,
+			PasswordReset{EmailAddress: "jywoo92324@gmail.com"},
+			http.StatusOK,
+			false,
+		},
+		{
+			"mailerError", //also looks like happyPath, otherwise only accounts that exist could get a 500
+			nil,
+			func(ctx context.Context, m mailer.Message) error {
+				return errors.New("internalServerError")
+			},
+			PasswordReset{EmailAddress: "jywoo92324@gmail.com"},
+			http.StatusOK,
+			false,
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			reqBody, err := json.Marshal(testcase.requestBody)
+			assert.NoError(t, err, "unexpected error marshalling the request body")
+
+			req := httptest.NewRequest(http.MethodPost, "/password_reset", bytes.NewBuffer(reqBody))
+			w := httptest.NewRecorder()
+
+			var stored *store.PasswordResetToken
+			testServer.db = &mockstore.Mockstore{
+				GetUserByEmailOverride: testcase.getUserByEmailFunc,
+				CreatePasswordResetTokenOverride: func(ctx context.Context, t store.PasswordResetToken) (*store.PasswordResetToken, error) {
+					stored = &t
+					return &t, nil
+				},
+			}
+			sentBefore := len(testMailer.Sent())
+			testMailer.SendOverride = testcase.sendOverrideFunc
+			defer func() { testMailer.SendOverride = nil }()
+
+			testServer.r.ServeHTTP(w, req)
+
+			assert.Equal(t, testcase.expectedResponseStatus, w.Code)
+
+			sent := testMailer.Sent()[sentBefore:]
+			if !testcase.expectedMail {
+				assert.Empty(t, sent)
+				return
+			}
+
+			assert.Len(t, sent, 1)
+			assert.Equal(t, testcase.requestBody.EmailAddress, sent[0].To)
+			assert.Contains(t, sent[0].Body, "https://wdiet.test/password_reset/confirm?token=")
+
+			assert.NotNil(t, stored)
+			assert.Equal(t, testUserUUID, stored.UserUUID)
+			assert.WithinDuration(t, time.Now().Add(passwordResetTTL), stored.ExpiresAt, time.Minute)
+
+			token := strings.TrimPrefix(sent[0].Body[strings.Index(sent[0].Body, "?token="):], "?token=")
+			token = strings.Fields(token)[0]
+			assert.Equal(t, stored.HashedToken, hashToken(token)) //we mail the token, we only keep its hash
+			assert.NotContains(t, sent[0].Body, stored.HashedToken)
+
+			link := sent[0].Body[strings.Index(sent[0].Body, "https://wdiet.test"):] //the link opens the form
+			link = strings.TrimPrefix(strings.Fields(link)[0], "https://wdiet.test")
+			w = httptest.NewRecorder()
+			testServer.r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, link, nil))
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Contains(t, w.Body.String(), `value="`+token+`"`)
+		})
+	}
+}
+
+func TestPasswordResetForm(t *testing.T) {
+	testcases := []struct {
+		name             string
+		query            string
+		expectedContains string
+		expectedStatus   int
+	}{
+		{"happyPath", "?token=" + url.QueryEscape("abc-123_x"), `<input type="hidden" name="token" value="abc-123_x">`, http.StatusOK},
+		{"happyPath:escaped", "?token=" + url.QueryEscape(`"><script>alert(1)</script>`), `value="&#34;&gt;&lt;script&gt;alert(1)&lt;/script&gt;"`, http.StatusOK},
+		{"badRequest", "", "", http.StatusBadRequest},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/password_reset/confirm"+testcase.query, nil)
+			w := httptest.NewRecorder()
+
+			testServer.db = &mockstore.Mockstore{}
+			testServer.r.ServeHTTP(w, req)
+
+			assert.Equal(t, testcase.expectedStatus, w.Code)
+
+			if testcase.expectedStatus != http.StatusOK {
+				assert.Equal(t, 0, w.Body.Len())
+				return
+			}
+
+			assert.Equal(t, "text/html; charset=utf-8", w.Header().Get("Content-Type"))
+			assert.Equal(t, "no-referrer", w.Header().Get("Referrer-Policy"))
+			assert.Contains(t, w.Body.String(), testcase.expectedContains)
+			assert.Contains(t, w.Body.String(), `fetch(location.pathname`) //posts back to ConfirmPasswordReset
+		})
+	}
+}
+
+func TestConfirmPasswordReset(t *testing.T) {
+	testcases := []struct {
+		name                      string
+		resetPasswordOverrideFunc func(ctx context.Context, hashedToken string, hashedPassword string) error
+		getUserOverrideFunc       func(ctx context.Context, hashedToken string) (*store.User, error)
+		requestBody               ConfirmPasswordReset
+		expectedResponseStatus    int
+	}{
+		{
+			"happyPath",
+			func(ctx context.Context, hashedToken string, hashedPassword string) error {
+				if hashedToken != hashToken("potatoes") {
+					return errors.New("token was not hashed")
+				}
+				return bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte("new password"))
+			},
+			nil,
+			ConfirmPasswordReset{Token: "potatoes", NewPassword: "new password"},
+			http.StatusOK,
+		},
+		{
+			"badRequest",
+			nil,
+			nil,
+			ConfirmPasswordReset{Token: "potatoes"},
+			http.StatusBadRequest,
+		},
+		{
+			"badRequest:weakPassword",
+			nil,
+			nil,
+			ConfirmPasswordReset{Token: "potatoes", NewPassword: "potatoes"},
+			http.StatusBadRequest,
+		},
+		{
+			"badRequest:personalPassword",
+			nil,
+			nil,
+			ConfirmPasswordReset{Token: "potatoes", NewPassword: "woo's new password"}, //the mockstore's user is jy woo
+			http.StatusBadRequest,
+		},
+		{
+			"badRequest:unknownToken",
+			nil,
+			func(ctx context.Context, hashedToken string) (*store.User, error) {
+				return nil, store.ErrNotFound
+			},
+			ConfirmPasswordReset{Token: "potatoes", NewPassword: "new password"},
+			http.StatusBadRequest,
+		},
+		{
+			"badRequest:usedOrExpired",
+			func(ctx context.Context, hashedToken string, hashedPassword string) error {
+				return store.ErrNotFound
+			},
+			nil,
+			ConfirmPasswordReset{Token: "potatoes", NewPassword: "new password"},
+			http.StatusBadRequest,
+		},
+		{
+			"internalServerError",
+			func(ctx context.Context, hashedToken string, hashedPassword string) error {
+				return errors.New("internalServerError")
+			},
+			nil,
+			ConfirmPasswordReset{Token: "potatoes", NewPassword: "new password"},
+			http.StatusInternalServerError,
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			reqBody, err := json.Marshal(testcase.requestBody)
+			assert.NoError(t, err, "unexpected error marshalling the request body")
+
+			req := httptest.NewRequest(http.MethodPost, "/password_reset/confirm", bytes.NewBuffer(reqBody))
+			w := httptest.NewRecorder()
+
+			testServer.db = &mockstore.Mockstore{ResetPasswordOverride: testcase.resetPasswordOverrideFunc, GetPasswordResetUserOverride: testcase.getUserOverrideFunc}
+			testServer.r.ServeHTTP(w, req)
+
+			assert.Equal(t, testcase.expectedResponseStatus, w.Code)
+		})
+	}
+}
+
+func TestRequireVerifiedEmail(t *testing.T) {
+	testcases := []struct {
+		name                   string
+		emailVerified          bool
+		requestPath            string
+		expectedResponseStatus int
+	}{
+		{
+			"happyPath",
+			true,
+			"/users/080b5f09-527b-4581-bb56-19adbfe50ebf/fridge_ingredients",
+			http.StatusOK,
+		},
+		{
+			"happyPath:unverifiedOnAccountRoute",
+			false,
+			"/users/080b5f09-527b-4581-bb56-19adbfe50ebf",
+			http.StatusOK,
+		},
+		{
+			"forbidden:unverified",
+			false,
+			"/users/080b5f09-527b-4581-bb56-19adbfe50ebf/fridge_ingredients",
+			http.StatusForbidden,
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, testcase.requestPath, nil)
+			w := httptest.NewRecorder()
+			authorize(t, req, testUserUUID)
+
+			testServer.db = &mockstore.Mockstore{
+				GetUserStatusOverride: func(ctx context.Context, id uuid.UUID) (*store.UserStatus, error) {
+					return &store.UserStatus{Active: true, EmailVerified: testcase.emailVerified, Role: store.RoleUser}, nil
+				},
+			}
+			testServer.r.ServeHTTP(w, req)
+
+			assert.Equal(t, testcase.expectedResponseStatus, w.Code)
+		})
+	}
+}
+
+func TestRequireRole(t *testing.T) {
+	testcases := []struct {
+		name                   string
+		role                   string
+		requestMethod          string
+		requestPath            string
+		expectedResponseStatus int
+	}{
+		{
+			"happyPath:moderatorOnCatalog",
+			store.RoleModerator,
+			http.MethodDelete,
+			"/ingredients/2c98fff4-7ccc-4536-8259-67a88380e99c",
+			http.StatusOK,
+		},
+		{
+			"happyPath:adminOnCatalog",
+			store.RoleAdmin,
+			http.MethodDelete,
+			"/ingredients/2c98fff4-7ccc-4536-8259-67a88380e99c",
+			http.StatusOK,
+		},
+		{
+			"happyPath:userReadsCatalog",
+			store.RoleUser,
+			http.MethodGet,
+			"/ingredients/2c98fff4-7ccc-4536-8259-67a88380e99c",
+			http.StatusOK,
+		},
+		{
+			"forbidden:userOnCatalog",
+			store.RoleUser,
+			http.MethodDelete,
+			"/ingredients/2c98fff4-7ccc-4536-8259-67a88380e99c",
+			http.StatusForbidden,
+		},
+		{
+			"forbidden:moderatorOnAdmin",
+			store.RoleModerator,
+			http.MethodGet,
+			"/admin/lockout_events",
+			http.StatusForbidden,
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			req := httptest.NewRequest(testcase.requestMethod, testcase.requestPath, nil)
+			w := httptest.NewRecorder()
+			authorizeAs(t, req, testUserUUID, testcase.role)
+
+			testServer.db = &mockstore.Mockstore{GetUserStatusOverride: statusWithRole(testcase.role)}
+			testServer.r.ServeHTTP(w, req)
+
+			assert.Equal(t, testcase.expectedResponseStatus, w.Code)
+		})
+	}
+}
+
+func TestSetUserRole(t *testing.T) {
+	testcases := []struct {
+		name                   string
+		setUserRoleFunc        func(ctx context.Context, id uuid.UUID, role string) (*store.User, error)
+		requestPath            string
+		requestBody            UserRole
+		expectedResponse       *User
+		expectedResponseStatus int
+	}{
+		{
+			"happyPath",
+			nil,
+			"2c98fff4-7ccc-4536-8259-67a88380e99c",
+			UserRole{Role: store.RoleModerator},
+			&User{UserUUID: testRecipeOwnerUUID,
+				Active:       true,
+				Role:         store.RoleModerator,
+				FirstName:    "jy",
+				LastName:     "woo",
+				EmailAddress: "jywoo92324@gmail.com"},
+			http.StatusOK,
+		},
+		{
+			"badRequest",
+			nil,
+			"2c98fff4-7ccc-4536-8259-67a88380e99c",
+			UserRole{Role: "superuser"},
+			nil,
+			http.StatusBadRequest,
+		},
+		{
+			"forbidden:self",
+			nil,
+			"080b5f09-527b-4581-bb56-19adbfe50ebf",
+			UserRole{Role: store.RoleUser},
+			nil,
+			http.StatusForbidden,
+		},
+		{
+			"notFound",
+			func(ctx context.Context, id uuid.UUID, role string) (*store.User, error) {
+				return nil, store.ErrNotFound
+			},
+			"2c98fff4-7ccc-4536-8259-67a88380e99c",
+			UserRole{Role: store.RoleModerator},
+			nil,
+			http.StatusNotFound,
+		},
+		{
+			"internalServerError",
+			func(ctx context.Context, id uuid.UUID, role string) (*store.User, error) {
+				return nil, errors.New("internalServerError")
+			},
+			"2c98fff4-7ccc-4536-8259-67a88380e99c",
+			UserRole{Role: store.RoleModerator},
+			nil,
+			http.StatusInternalServerError,
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			reqBody, err := json.Marshal(testcase.requestBody)
+			assert.NoError(t, err, "unexpected error marshalling the request body")
+
+			req := httptest.NewRequest(http.MethodPost, "/admin/users/"+testcase.requestPath+"/role", bytes.NewBuffer(reqBody))
+			w := httptest.NewRecorder()
+			authorizeAs(t, req, testUserUUID, store.RoleAdmin)
+
+			testServer.db = &mockstore.Mockstore{SetUserRoleOverride: testcase.setUserRoleFunc, GetUserStatusOverride: statusWithRole(store.RoleAdmin)}
+			testServer.r.ServeHTTP(w, req)
+
+			assert.Equal(t, testcase.expectedResponseStatus, w.Code)
+
+			if testcase.expectedResponse != nil {
+				var resBody User
+
+				err := json.Unmarshal(w.Body.Bytes(), &resBody)
+				assert.NoError(t, err, "unexpected error unmarshalling the response body")
+
+				assert.Equal(t, *testcase.expectedResponse, resBody)
+			}
+		})
+	}
+}
+
+func TestVerifyEmail(t *testing.T) {
+	verifiedAt := time.Date(2022, 12, 25, 0, 0, 0, 0, time.UTC)
+
+	testcases := []struct {
+		name                    string
+		verifyEmailOverrideFunc func(ctx context.Context, hashedToken string) (*store.User, error)
+		query                   string
+		expectedResponse        *User
+		expectedResponseStatus  int
+	}{
+		{
+			"happyPath",
+			func(ctx context.Context, hashedToken string) (*store.User, error) {
+				if hashedToken != hashToken("potatoes") {
+					return nil, store.ErrNotFound
+				}
+				return &store.User{UserUUID: testUserUUID, Active: true, FirstName: "jy", LastName: "woo", EmailAddress: "jywoo92324@gmail.com", EmailVerifiedAt: &verifiedAt}, nil
+			},
+			"?token=potatoes",
+			&User{UserUUID: testUserUUID, Active: true, FirstName: "jy", LastName: "woo", EmailAddress: "jywoo92324@gmail.com", EmailVerifiedAt: &verifiedAt},
+			http.StatusOK,
+		},
+		{
+			"badRequest",
+			nil,
+			"",
+			nil,
+			http.StatusBadRequest,
+		},
+		{
+			"badRequest:usedOrExpired",
+			func(ctx context.Context, hashedToken string) (*store.User, error) {
+				return nil, store.ErrNotFound
+			},
+			"?token=potatoes",
+			nil,
+			http.StatusBadRequest,
+		},
+		{
+			"internalServerError",
+			func(ctx context.Context, hashedToken string) (*store.User, error) {
+				return nil, errors.New("internalServerError")
+			},
+			"?token=potatoes",
+			nil,
+			http.StatusInternalServerError,
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/users/verify"+testcase.query, nil)
+			w := httptest.NewRecorder()
+
+			testServer.db = &mockstore.Mockstore{VerifyEmailOverride: testcase.verifyEmailOverrideFunc}
+			testServer.r.ServeHTTP(w, req)
+
+			assert.Equal(t, testcase.expectedResponseStatus, w.Code)
+
+			if testcase.expectedResponse != nil {
+				var resBody User
+
+				err := json.Unmarshal(w.Body.Bytes(), &resBody)
+				assert.NoError(t, err, "unexpected error unmarshalling the response body")
+
+				assert.Equal(t, *testcase.expectedResponse, resBody)
+			}
+		})
+	}
+}
+
+func TestResendVerification(t *testing.T) {
+	verifiedAt := time.Date(2022, 12, 25, 0, 0, 0, 0, time.UTC)
+
+	testcases := []struct {
+		name                   string
+		getUserOverrideFunc    func(ctx context.Context, id uuid.UUID) (*store.User, error)
+		requestPath            string
+		expectedResponseStatus int
+		expectedMail           bool
+	}{
+		{
+			"happyPath",
+			nil,
+			"080b5f09-527b-4581-bb56-19adbfe50ebf",
+			http.StatusOK,
+			true,
+		},
+		{
+			"badRequest:alreadyVerified",
+			func(ctx context.Context, id uuid.UUID) (*store.User, error) {
+				return &store.User{UserUUID: id, Active: true, EmailAddress: "jywoo92324@gmail.com", EmailVerifiedAt: &verifiedAt}, nil
+			},
+			"080b5f09-527b-4581-bb56-19adbfe50ebf",
+			http.StatusBadRequest,
+			false,
+		},
+		{
+			"forbidden",
+			nil,
+			"2c98fff4-7ccc-4536-8259-67a88380e99c",
+			http.StatusForbidden,
+			false,
+		},
+		{
+			"internalServerError",
+			func(ctx context.Context, id uuid.UUID) (*store.User, error) {
+				return nil, errors.New("internalServerError")
+			},
+			"080b5f09-527b-4581-bb56-19adbfe50ebf",
+			http.StatusInternalServerError,
+			false,
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/users/"+testcase.requestPath+"/verification", nil)
+			w := httptest.NewRecorder()
+			authorize(t, req, testUserUUID)
+
+			testServer.db = &mockstore.Mockstore{GetUserOverride: testcase.getUserOverrideFunc}
+			sentBefore := len(testMailer.Sent())
+			testServer.r.ServeHTTP(w, req)
+
+			assert.Equal(t, testcase.expectedResponseStatus, w.Code)
+
+			sent := testMailer.Sent()[sentBefore:]
+			if testcase.expectedMail {
+				assert.Len(t, sent, 1)
+			} else {
+				assert.Empty(t, sent)
+			}
+		})
+	}
+}
+
+func TestCreatePersonalAccessToken(t *testing.T) {
+	tomorrow := time.Now().Add(24 * time.Hour).UTC().Truncate(time.Second)
+	yesterday := time.Now().Add(-24 * time.Hour)
+
+	testcases := []struct {
+		name                   string
+		createOverrideFunc     func(ctx context.Context, t store.PersonalAccessToken) (*store.PersonalAccessToken, error)
+		requestPath            string
+		requestBody            PersonalAccessToken
+		expectedResponseStatus int
+	}{
+		{
+			"happyPath",
+			nil,
+			"080b5f09-527b-4581-bb56-19adbfe50ebf",
+			PersonalAccessToken{Name: "fridge sync", Scopes: []string{"fridge:read", "fridge:write"}, ExpiresAt: &tomorrow},
+			http.StatusOK,
+		},
+		{
+			"happyPath:noExpiry",
+			nil,
+			"080b5f09-527b-4581-bb56-19adbfe50ebf",
+			PersonalAccessToken{Name: "fridge sync", Scopes: []string{"recipes:read"}},
+			http.StatusOK,
+		},
+		{
+			"badRequest:unknownScope",
+			nil,
+			"080b5f09-527b-4581-bb56-19adbfe50ebf",
+			PersonalAccessToken{Name: "fridge sync", Scopes: []string{"fridge:everything"}},
+			http.StatusBadRequest,
+		},
+		{
+			"badRequest:noScopes",
+			nil,
+			"080b5f09-527b-4581-bb56-19adbfe50ebf",
+			PersonalAccessToken{Name: "fridge sync"},
+			http.StatusBadRequest,
+		},
+		{
+			"badRequest:noName",
+			nil,
+			"080b5f09-527b-4581-bb56-19adbfe50ebf",
+			PersonalAccessToken{Scopes: []string{"fridge:read"}},
+			http.StatusBadRequest,
+		},
+		{
+			"badRequest:expired",
+			nil,
+			"080b5f09-527b-4581-bb56-19adbfe50ebf",
+			PersonalAccessToken{Name: "fridge sync", Scopes: []string{"fridge:read"}, ExpiresAt: &yesterday},
+			http.StatusBadRequest,
+		},
+		{
+			"forbidden",
+			nil,
+			"2c98fff4-7ccc-4536-8259-67a88380e99c",
+			PersonalAccessToken{Name: "fridge sync", Scopes: []string{"fridge:read"}},
+			http.StatusForbidden,
+		},
+		{
+			"internalServerError",
+			func(ctx context.Context, t store.PersonalAccessToken) (*store.PersonalAccessToken, error) {
+				return nil, errors.New("internalServerError")
+			},
+			"080b5f09-527b-4581-bb56-19adbfe50ebf",
+			PersonalAccessToken{Name: "fridge sync", Scopes: []string{"fridge:read"}},
+			http.StatusInternalServerError,
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			reqBody, err := json.Marshal(testcase.requestBody)
+			assert.NoError(t, err, "unexpected error marshalling the request body")
+
+			req := httptest.NewRequest(http.MethodPost, "/users/"+testcase.requestPath+"/tokens", bytes.NewBuffer(reqBody))
+			w := httptest.NewRecorder()
+			authorize(t, req, testUserUUID)
+
+			var stored store.PersonalAccessToken
+			createOverride := testcase.createOverrideFunc
+			if createOverride == nil {
+				createOverride = func(ctx context.Context, t store.PersonalAccessToken) (*store.PersonalAccessToken, error) {
+					stored = t
+					return (&mockstore.Mockstore{}).CreatePersonalAccessToken(ctx, t)
+				}
+			}
+
+			testServer.db = &mockstore.Mockstore{CreatePersonalAccessTokenOverride: createOverride}
+			testServer.r.ServeHTTP(w, req)
+
+			assert.Equal(t, testcase.expectedResponseStatus, w.Code)
+
+			if testcase.expectedResponseStatus == http.StatusOK {
+				var resBody PersonalAccessToken
+
+				err := json.Unmarshal(w.Body.Bytes(), &resBody)
+				assert.NoError(t, err, "unexpected error unmarshalling the response body")
+
+				assert.True(t, strings.HasPrefix(resBody.Token, "wdiet_pat_"))
+				assert.Equal(t, hashToken(resBody.Token), stored.HashedToken, "only the hash gets stored")
+				assert.Equal(t, testUserUUID, stored.UserUUID)
+				assert.Equal(t, testcase.requestBody.Name, resBody.Name)
+				assert.Equal(t, testcase.requestBody.Scopes, resBody.Scopes)
+				if testcase.requestBody.ExpiresAt != nil {
+					assert.True(t, testcase.requestBody.ExpiresAt.Equal(*resBody.ExpiresAt))
+				}
+			}
+		})
+	}
+}
+
+func TestListPersonalAccessTokens(t *testing.T) {
+	lastUsedAt := time.Date(2022, 12, 26, 0, 0, 0, 0, time.UTC)
+
+	testcases := []struct {
+		name                   string
+		listOverrideFunc       func(ctx context.Context, uid uuid.UUID) ([]store.PersonalAccessToken, error)
+		requestPath            string
+		expectedResponse       []PersonalAccessToken
+		expectedResponseStatus int
+	}{
+		{
+			"happyPath",
+			nil,
+			"080b5f09-527b-4581-bb56-19adbfe50ebf",
+			[]PersonalAccessToken{{
+				PersonalAccessTokenUUID: uuid.MustParse("3f6c2a8e-1b4d-4c7e-9a2f-5d8e1c3b7a90"),
+				Name:                    "fridge sync",
+				Scopes:                  []string{"fridge:read", "fridge:write"},
+				LastUsedAt:              &lastUsedAt,
+				CreatedAt:               time.Date(2022, 12, 25, 0, 0, 0, 0, time.UTC),
+			}},
+			http.StatusOK,
+		},
+		{
+			"badRequest",
+			nil,
+			"maerong",
+			nil,
+			http.StatusBadRequest,
+		},
+		{
+			"forbidden",
+			nil,
+			"2c98fff4-7ccc-4536-8259-67a88380e99c",
+			nil,
+			http.StatusForbidden,
+		},
+		{
+			"internalServerError",
+			func(ctx context.Context, uid uuid.UUID) ([]store.PersonalAccessToken, error) {
+				return nil, errors.New("internalServerError")
+			},
+			"080b5f09-527b-4581-bb56-19adbfe50ebf",
+			nil,
+			http.StatusInternalServerError,
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/users/"+testcase.requestPath+"/tokens", nil)
+			w := httptest.NewRecorder()
+			authorize(t, req, testUserUUID)
+
+			testServer.db = &mockstore.Mockstore{ListPersonalAccessTokensOverride: testcase.listOverrideFunc}
+			testServer.r.ServeHTTP(w, req)
+
+			assert.Equal(t, testcase.expectedResponseStatus, w.Code)
+
+			if testcase.expectedResponse != nil {
+				var resBody []PersonalAccessToken
+
+				err := json.Unmarshal(w.Body.Bytes(), &resBody)
+				assert.NoError(t, err, "unexpected error unmarshalling the response body")
+
+				assert.Equal(t, testcase.expectedResponse, resBody)
+				assert.NotContains(t, w.Body.String(), "5994471abb01112afcc18159f6cc74b4f511b99806da59b3caf5a9c173cacfc5", "hashes stay in the db")
+			}
+		})
+	}
+}
+
+func TestDeletePersonalAccessToken(t *testing.T) {
+	testcases := []struct {
+		name                   string
+		deleteOverrideFunc     func(ctx context.Context, uid, tid uuid.UUID) error
+		requestPath            string
+		expectedResponseStatus int
+	}{
+		{
+			"happyPath",
+			nil,
+			"080b5f09-527b-4581-bb56-19adbfe50ebf/tokens/3f6c2a8e-1b4d-4c7e-9a2f-5d8e1c3b7a90",
+			http.StatusOK,
+		},
+		{
+			"badRequest",
+			nil,
+			"080b5f09-527b-4581-bb56-19adbfe50ebf/tokens/maerong",
+			http.StatusBadRequest,
+		},
+		{
+			"forbidden",
+			nil,
+			"2c98fff4-7ccc-4536-8259-67a88380e99c/tokens/3f6c2a8e-1b4d-4c7e-9a2f-5d8e1c3b7a90",
+			http.StatusForbidden,
+		},
+		{
+			"notFound",
+			func(ctx context.Context, uid, tid uuid.UUID) error {
+				return store.ErrNotFound
+			},
+			"080b5f09-527b-4581-bb56-19adbfe50ebf/tokens/3f6c2a8e-1b4d-4c7e-9a2f-5d8e1c3b7a90",
+			http.StatusNotFound,
+		},
+		{
+			"internalServerError",
+			func(ctx context.Context, uid, tid uuid.UUID) error {
+				return errors.New("internalServerError")
+			},
+			"080b5f09-527b-4581-bb56-19adbfe50ebf/tokens/3f6c2a8e-1b4d-4c7e-9a2f-5d8e1c3b7a90",
+			http.StatusInternalServerError,
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodDelete, "/users/"+testcase.requestPath, nil)
+			w := httptest.NewRecorder()
+			authorize(t, req, testUserUUID)
+
+			testServer.db = &mockstore.Mockstore{DeletePersonalAccessTokenOverride: testcase.deleteOverrideFunc}
+			testServer.r.ServeHTTP(w, req)
+
+			assert.Equal(t, testcase.expectedResponseStatus, w.Code)
+		})
+	}
+}
+
+// TestPersonalAccessTokenScopes uses the mockstore's default token, it has fridge:read and fridge:write.
+func TestPersonalAccessTokenScopes(t *testing.T) {
+	testcases := []struct {
+		name                   string
+		useOverrideFunc        func(ctx context.Context, hashedToken string) (*store.PersonalAccessToken, error)
+		requestMethod          string
+		requestPath            string
+		expectedResponseStatus int
+	}{
+		{
+			"happyPath",
+			nil,
+			http.MethodGet,
+			"/users/080b5f09-527b-4581-bb56-19adbfe50ebf/fridge_ingredients",
+			http.StatusOK,
+		},
+		{
+			"forbidden:missingScope",
+			nil,
+			http.MethodGet,
+			"/users/080b5f09-527b-4581-bb56-19adbfe50ebf/recipes",
+			http.StatusForbidden,
+		},
+		{
+			"forbidden:sessionOnly", //a leaked token can't manage the account or make more tokens
+			nil,
+			http.MethodGet,
+			"/users/080b5f09-527b-4581-bb56-19adbfe50ebf/tokens",
+			http.StatusForbidden,
+		},
+		{
+			"unauthorized:unknownOrExpired",
+			func(ctx context.Context, hashedToken string) (*store.PersonalAccessToken, error) {
+				return nil, store.ErrNotFound
+			},
+			http.MethodGet,
+			"/users/080b5f09-527b-4581-bb56-19adbfe50ebf/fridge_ingredients",
+			http.StatusUnauthorized,
+		},
+		{
+			"internalServerError",
+			func(ctx context.Context, hashedToken string) (*store.PersonalAccessToken, error) {
+				return nil, errors.New("internalServerError")
+			},
+			http.MethodGet,
+			"/users/080b5f09-527b-4581-bb56-19adbfe50ebf/fridge_ingredients",
+			http.StatusInternalServerError,
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			req := httptest.NewRequest(testcase.requestMethod, testcase.requestPath, nil)
+			req.Header.Set("Authorization", "Bearer wdiet_pat_potatoes")
+			w := httptest.NewRecorder()
+
+			var usedHash string
+			useOverride := testcase.useOverrideFunc
+			if useOverride == nil {
+				useOverride = func(ctx context.Context, hashedToken string) (*store.PersonalAccessToken, error) {
+					usedHash = hashedToken
+					return (&mockstore.Mockstore{}).UsePersonalAccessToken(ctx, hashedToken)
+				}
+			}
+
+			testServer.db = &mockstore.Mockstore{UsePersonalAccessTokenOverride: useOverride}
+			testServer.r.ServeHTTP(w, req)
+
+			assert.Equal(t, testcase.expectedResponseStatus, w.Code)
+
+			if testcase.useOverrideFunc == nil {
+				assert.Equal(t, hashToken("wdiet_pat_potatoes"), usedHash, "tokens are looked up by their hash")
+			}
+		})
+	}
+}
+
+func TestGetIngredient(t *testing.T) {
+	testcases := []struct {
+		name                      string
+		getIngredientOverrideFunc func(ctx context.Context, id uuid.UUID) (*store.Ingredient, error)
+		requestBody               string
+		expectedResponse          *Ingredient
+		expectedStatus            int
+	}{
+		{
+			"happyPath",
+			nil,
+			"080b5f09-527b-4581-bb56-19adbfe50ebf",
+			&Ingredient{
+				IngredientUUID: uuid.MustParse("080b5f09-527b-4581-bb56-19adbfe50ebf"),
+				IngredientName: "onion",
+				Category:       "vegetables",
+				DaysUntilExp:   7,
+				FreezerDays:    240,
+				PantryDays:     30,
+				OpenedDays:     3},
+			http.StatusOK,
+		},
+		{
+			"badRequest",
+			nil,
+			"maerong",
+			nil,
+			http.StatusBadRequest,
+		},
+		{
+			"internalServerError",
+			func(ctx context.Context, id uuid.UUID) (*store.Ingredient, error) {
+				return nil, errors.New("internalServerError")
+			},
+			"080b5f09-527b-4581-bb56-19adbfe50ebf",
+			nil,
+			http.StatusInternalServerError,
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/ingredients/"+testcase.requestBody, nil)
+			w := httptest.NewRecorder()
+			authorize(t, req, testUserUUID)
+
+			testServer.db = &mockstore.Mockstore{GetIngredientOverride: testcase.getIngredientOverrideFunc}
+			testServer.r.ServeHTTP(w, req)
+
+			assert.Equal(t, testcase.expectedStatus, w.Code)
+
+			if testcase.expectedResponse != nil {
+				var resBody Ingredient
+
+				err := json.Unmarshal(w.Body.Bytes(), &resBody)
+				assert.NoError(t, err, "unexpected error unmarshalling the response body")
+
+				assert.Equal(t, *testcase.expectedResponse, resBody)
+				// assert.Equal(t, testcase.expectedResponse.IngredientUUID, resBody.IngredientUUID)
+				// assert.Equal(t, testcase.expectedResponse.IngredientName, resBody.IngredientName)
+				// assert.Equal(t, testcase.expectedResponse.Category, resBody.Category)
+				// assert.Equal(t, testcase.expectedResponse.DaysUntilExp, resBody.DaysUntilExp)
+			} else {
+				assert.Equal(t, 0, w.Body.Len())
+			}
+		})
+	}
+}
+
+func TestSearchIngredients(t *testing.T) {
+	testcases := []struct {
+		name                          string
+		searchIngredientsOverrideFunc func(ctx context.Context, i store.SearchIngredient) ([]store.Ingredient, error)
+		requestBody                   Ingredient
+		expectedResponse              []Ingredient
+		expectedStatus                int
+	}{
+		{
+			"happyPath",
+			nil,
+			Ingredient{IngredientName: "tuna"},
+			[]Ingredient{
+				{
+					IngredientUUID: uuid.MustParse("080b5f09-527b-4581-bb56-19adbfe50ebf"),
+					IngredientName: "tuna",
+					Category:       "tuna kimbap",
+					DaysUntilExp:   3,
+				},
+				{
+					IngredientUUID: uuid.MustParse("080b5f09-527b-4581-bb56-19adbfe50ebf"),
+					IngredientName: "tuna",
+					Category:       "tuna sushi",
+					DaysUntilExp:   3,
+				},
+			},
+			http.StatusOK,
+		},
+		{
+			"badRequest",
+			nil,
+			Ingredient{},
+			nil,
+			http.StatusBadRequest,
+		},
+		{
+			"internalServerError",
+			func(ctx context.Context, i store.SearchIngredient) ([]store.Ingredient, error) {
+				return []store.Ingredient{}, errors.New("internalServerError")
+			},
+			Ingredient{IngredientName: "tuna"},
+			nil,
+			http.StatusInternalServerError,
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			reqBody, err := json.Marshal(testcase.requestBody)
+			assert.NoError(t, err, "unexpected error marshalling the request body")
+
+			req := httptest.NewRequest(http.MethodPost, "/ingredients/search", bytes.NewBuffer(reqBody))
+			w := httptest.NewRecorder()
+
+			testServer.db = &mockstore.Mockstore{SearchIngredientsOverride: testcase.searchIngredientsOverrideFunc}
+			testServer.r.ServeHTTP(w, req)
+
+			assert.Equal(t, testcase.expectedStatus, w.Code)
+
+			if testcase.expectedResponse != nil {
+				var resBody []Ingredient
+
+				err := json.Unmarshal(w.Body.Bytes(), &resBody)
+				assert.NoError(t, err, "unexpected error unmarshaling the response body")
+
+				assert.Equal(t, len(testcase.expectedResponse), len(resBody))
+
+				for i := range testcase.expectedResponse {
+					assert.Equal(t, testcase.expectedResponse[i], resBody[i])
+					// assert.Equal(t, testcase.expectedResponse[i].IngredientUUID, resBody[i].IngredientUUID)
+					// assert.Equal(t, testcase.expectedResponse[i].IngredientName, resBody[i].IngredientName)
+					// assert.Equal(t, testcase.expectedResponse[i].Category, resBody[i].Category)
+					// assert.Equal(t, testcase.expectedResponse[i].DaysUntilExp, resBody[i].DaysUntilExp)
+				}
+			} else {
+				assert.Equal(t, 0, w.Body.Len())
+			}
+		})
+	}
+}
+
+func TestCreateIngredient(t *testing.T) {
+	goodIngredient := Ingredient{
+		IngredientName: "onion",
+		Category:       "vegetables",
+		DaysUntilExp:   7,
+	}
+
+	badIngredient := Ingredient{
+		IngredientName: "",
+		Category:       "",
+		DaysUntilExp:   7,
+	}
+
+	testcases := []struct {
+		name                         string
+		createIngredientOverrideFunc func(ctx context.Context, i store.Ingredient) (*store.Ingredient, error)
+		requestBody                  Ingredient
+		expectedResponse             *Ingredient
+		expectedStatus               int
+	}{
+		{
+			"happyPath",
+			nil,
+			goodIngredient,
+			&goodIngredient,
+			http.StatusOK,
+		},
+		{
+			"badRequest",
+			nil,
+			badIngredient,
+			nil,
+			http.StatusBadRequest,
+		},
+		{
+			"internalServerError",
+			func(ctx context.Context, i store.Ingredient) (*store.Ingredient, error) {
+				return nil, errors.New("internalServerError")
+			},
+			goodIngredient,
+			nil,
+			http.StatusInternalServerError,
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			reqBody, err := json.Marshal(testcase.requestBody)
+			assert.NoError(t, err, "unexpected error marshalling the request body")
+
+			req := httptest.NewRequest(http.MethodPost, "/ingredients", bytes.NewBuffer(reqBody))
+			w := httptest.NewRecorder()
+			authorizeAs(t, req, testUserUUID, store.RoleModerator)
+
+			testServer.db = &mockstore.Mockstore{CreateIngredientOverride: testcase.createIngredientOverrideFunc, GetUserStatusOverride: statusWithRole(store.RoleModerator)}
+			testServer.r.ServeHTTP(w, req)
+
+			if testcase.expectedResponse != nil {
+				var resBody Ingredient
+
+				err := json.Unmarshal(w.Body.Bytes(), &resBody)
+				assert.NoError(t, err, "unexpected error unmarshalling the response body")
+
+				//assert.Equal(t, *testcase.expectedResponse, resBody)
+				assert.NotEqual(t, resBody.IngredientUUID, uuid.Nil)
+				assert.Equal(t, testcase.expectedResponse.IngredientName, resBody.IngredientName)
+				assert.Equal(t, testcase.expectedResponse.Category, resBody.Category)
+				assert.Equal(t, testcase.expectedResponse.DaysUntilExp, resBody.DaysUntilExp)
+			} else {
+				assert.Equal(t, 0, w.Body.Len())
+			}
+		})
+	}
+}
+
+func TestUpdateIngredient(t *testing.T) {
+	goodIngredient := Ingredient{
+		IngredientUUID: uuid.MustParse("080b5f09-527b-4581-bb56-19adbfe50ebf"),
+		IngredientName: "onion",
+		Category:       "vegetables",
+		DaysUntilExp:   7,
+	}
+
+	badIngredient := Ingredient{
+		IngredientUUID: uuid.MustParse("080b5f09-527b-4581-bb56-19adbfe50ebf"),
+		IngredientName: "",
+		Category:       "",
+		DaysUntilExp:   7,
+	}
+
+	testcases := []struct {
+		name                         string
+		updateIngredientOverrideFunc func(ctx context.Context, i store.Ingredient) (*store.Ingredient, error)
+		requestBody                  Ingredient
+		expectedResponse             *Ingredient
+		expectedStatus               int
+	}{
+		{
+			"happyPath",
+			nil,
+			goodIngredient,
+			&goodIngredient,
+			http.StatusOK,
+		},
+		{
+			"badRequest",
+			//it's misleading to have database override here, because it's not gonna hit the database anyway. To more clearly see it's a bad request, just leave it nil.
+			nil,
+			badIngredient,
+			nil,
+			http.StatusBadRequest,
+		},
+		{
+			"internalServerError",
+			func(ctx context.Context, i store.Ingredient) (*store.Ingredient, error) {
+				return nil, errors.New("internalServerError")
+			},
+			goodIngredient,
+			nil,
+			http.StatusInternalServerError,
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			reqBody, err := json.Marshal(testcase.requestBody)
+			assert.NoError(t, err, "unexpected error marshalling the request body")
+
+			req := httptest.NewRequest(http.MethodPost, "/ingredients/"+testcase.requestBody.IngredientUUID.String(), bytes.NewBuffer(reqBody))
+			w := httptest.NewRecorder()
+			authorizeAs(t, req, testUserUUID, store.RoleModerator)
+
+			testServer.db = &mockstore.Mockstore{UpdateIngredientOverride: testcase.updateIngredientOverrideFunc, GetUserStatusOverride: statusWithRole(store.RoleModerator)}
+			testServer.r.ServeHTTP(w, req)
+
+			assert.Equal(t, testcase.expectedStatus, w.Code)
+
+			if testcase.expectedResponse != nil {
+				var resBody Ingredient
+
+				err := json.Unmarshal(w.Body.Bytes(), &resBody)
+				assert.NoError(t, err, "unexpected error unmarshalling the response body")
+
+				assert.Equal(t, *testcase.expectedResponse, resBody)
+				// assert.Equal(t, testcase.expectedResponse.IngredientName, resBody.IngredientName)
+				// assert.Equal(t, testcase.expectedResponse.Category, resBody.Category)
+				// assert.Equal(t, testcase.expectedResponse.DaysUntilExp, resBody.DaysUntilExp)
+				// assert.Equal(t, testcase.expectedResponse.IngredientUUID, resBody.IngredientUUID)
+			} else {
+				assert.Equal(t, 0, w.Body.Len()) //이거 w.Body.Len이 아니라 끝에 꼭 () 붙여줘 ㅎㅎ;;
+			}
+		})
+	}
+}
+
+func TestDeleteIngredient(t *testing.T) {
+	testcases := []struct {
+		name                         string
+		deleteIngredientOverrideFunc func(ctx context.Context, id uuid.UUID) error
+		requestBody                  string
+		expectedStatus               int
+	}{
+		{
+			"happyPath",
+			nil,
+			"080b5f09-527b-4581-bb56-19adbfe50ebf",
+			http.StatusOK,
+		},
+		{
+			"badRequest",
+			nil,
+			"maerongmaerong",
+			http.StatusBadRequest,
+		},
+		{
+			"happyPath",
+			func(ctx context.Context, id uuid.UUID) error {
+				return errors.New("internalServerError")
+			},
+			"080b5f09-527b-4581-bb56-19adbfe50ebf",
+			http.StatusInternalServerError,
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodDelete, "/ingredients/"+testcase.requestBody, nil)
+			w := httptest.NewRecorder()
+			authorizeAs(t, req, testUserUUID, store.RoleModerator)
+
+			testServer.db = &mockstore.Mockstore{DeleteIngredientOverride: testcase.deleteIngredientOverrideFunc, GetUserStatusOverride: statusWithRole(store.RoleModerator)}
+			testServer.r.ServeHTTP(w, req)
+
+			assert.Equal(t, testcase.expectedStatus, w.Code)
+		})
+	}
+}
+
+func TestListFridgeIngredients(t *testing.T) {
+	testcases := []struct {
+		name                              string
+		listFridgeIngredientsOverrideFunc func(ctx context.Context, id uuid.UUID) ([]store.FridgeIngredient, error)
+		requestBody                       string
+		expectedResponse                  []FridgeIngredient
+		expectedStatus                    int
+	}{
+		{
+			"happyPath",
+			nil,
+			"080b5f09-527b-4581-bb56-19adbfe50ebf",
+			[]FridgeIngredient{
+				{
+					FridgeItemUUID: uuid.MustParse("9b1f4c2e-6d3a-4f8b-a2c5-0e7d1b3f5a91"),
+					HouseholdUUID:  testHouseholdUUID,
+					UserUUID:       uuid.MustParse("080b5f09-527b-4581-bb56-19adbfe50ebf"),
+					IngredientUUID: uuid.MustParse("ffff7c73-52b0-4e3d-bf3f-0c26785ef972"),
+					Amount:         units.Whole(3),
+					Unit:           "kg",
+					PurchasedDate:  time.Date(2023, time.March, 24, 15, 0, 0, 0, time.UTC),
+					ExpirationDate: time.Date(2023, time.March, 24, 15, 0, 0, 0, time.UTC),
+					Location:       "fridge",
+				},
+				{
+					FridgeItemUUID: uuid.MustParse("4e8a2d6c-1f5b-4c7e-9a3d-8b2f0c6e4d17"),
+					HouseholdUUID:  testHouseholdUUID,
+					UserUUID:       uuid.MustParse("080b5f09-527b-4581-bb56-19adbfe50ebf"),
+					IngredientUUID: uuid.MustParse("ffff7c73-52b0-4e3d-bf3f-0c26785ef972"),
+					Amount:         units.Whole(1),
+					Unit:           "kg",
+					PurchasedDate:  time.Date(2023, time.March, 28, 15, 0, 0, 0, time.UTC),
+					ExpirationDate: time.Date(2023, time.March, 28, 15, 0, 0, 0, time.UTC),
+					Location:       "fridge",
+				},
+				{
+					FridgeItemUUID: uuid.MustParse("c3d5e7f9-2a4b-4d6e-8f1a-3b5c7d9e1f20"),
+					HouseholdUUID:  testHouseholdUUID,
+					UserUUID:       uuid.MustParse("080b5f09-527b-4581-bb56-19adbfe50ebf"),
+					IngredientUUID: uuid.MustParse("2c98fff4-7ccc-4536-8259-67a88380e99c"),
+					Amount:         units.Whole(2),
+					Unit:           "L",
+					PurchasedDate:  time.Date(2023, time.March, 24, 15, 0, 0, 0, time.UTC),
+					ExpirationDate: time.Date(2023, time.March, 31, 15, 0, 0, 0, time.UTC),
+					Location:       "fridge",
+				},
+			},
+			http.StatusOK,
+		},
+		{
+			"badRequest",
+			nil,
+			"maerong",
+			nil,
+			http.StatusBadRequest,
+		},
+		{
+			"forbidden",
+			nil,
+			"2c98fff4-7ccc-4536-8259-67a88380e99c",
+			nil,
+			http.StatusForbidden,
+		},
+		{
+			"internalServerError",
+			func(ctx context.Context, id uuid.UUID) ([]store.FridgeIngredient, error) {
+				return nil, errors.New("internalServerError")
+			},
+			"080b5f09-527b-4581-bb56-19adbfe50ebf",
+			nil,
+			http.StatusInternalServerError,
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/users/"+testcase.requestBody+"/fridge_ingredients", nil)
+			w := httptest.NewRecorder()
+			authorize(t, req, testUserUUID)
+
+			testServer.db = &mockstore.Mockstore{ListFridgeIngredientsOverride: testcase.listFridgeIngredientsOverrideFunc}
+			testServer.r.ServeHTTP(w, req)
+
+			assert.Equal(t, testcase.expectedStatus, w.Code)
+
+			if testcase.expectedResponse != nil {
+				var resBody []FridgeIngredient
+
+				err := json.Unmarshal(w.Body.Bytes(), &resBody)
+				assert.NoError(t, err, "unexpected error unmarshalling the response body")
+
+				assert.Equal(t, len(testcase.expectedResponse), len(resBody))
+
+				for i := range testcase.expectedResponse {
+					assert.Equal(t, testcase.expectedResponse[i], resBody[i])
+				}
+			} else {
+				assert.Equal(t, 0, w.Body.Len())
+			}
+		})
+	}
+}
+
+func TestListFridgeIngredientsFractions(t *testing.T) {
+	testServer.db = &mockstore.Mockstore{
+		ListFridgeIngredientsOverride: func(ctx context.Context, hid uuid.UUID) ([]store.FridgeIngredient, error) {
+			return []store.FridgeIngredient{
+				{HouseholdUUID: hid, Amount: units.MustParseAmount("1/3"), Unit: "cup"},
+				{HouseholdUUID: hid, Amount: units.MustParseAmount("2.5"), Unit: "kg"},
+			}, nil
+		},
+	}
+
+	for query, expected := range map[string][]string{
+		"":                   {"0.3333", "2.5"},
+		"?amounts=fraction":  {`"1/3"`, `"2 1/2"`},
+		"?amounts=something": {"0.3333", "2.5"},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/users/"+testUserUUID.String()+"/fridge_ingredients"+query, nil)
+		w := httptest.NewRecorder()
+		authorize(t, req, testUserUUID)
+
+		testServer.r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var resBody []map[string]json.RawMessage
+
+		err := json.Unmarshal(w.Body.Bytes(), &resBody)
+		assert.NoError(t, err, "unexpected error unmarshalling the response body")
+		assert.Len(t, resBody, len(expected))
+
+		for i := range resBody {
+			assert.Equal(t, expected[i], string(resBody[i]["amount"]), "query: %q", query)
+		}
+
+		var amounts []FridgeIngredient //both ways read back the same amounts
+
+		err = json.Unmarshal(w.Body.Bytes(), &amounts)
+		assert.NoError(t, err, "unexpected error unmarshalling the response body")
+		assert.Equal(t, units.MustParseAmount("1/3"), amounts[0].Amount)
+	}
+}
+
+func TestListFridgeIngredientsGroupBy(t *testing.T) {
+	testcases := []struct {
+		name             string
+		query            string
+		expectedResponse []FridgeIngredientGroup
+		expectedStatus   int
+	}{
+		{
+			"ingredient",
+			"?group_by=ingredient",
+			[]FridgeIngredientGroup{
+				{
+					IngredientUUID: uuid.MustParse("ffff7c73-52b0-4e3d-bf3f-0c26785ef972"),
+					ExpirationDate: time.Date(2023, time.March, 24, 15, 0, 0, 0, time.UTC),
+				},
+				{
+					IngredientUUID: uuid.MustParse("2c98fff4-7ccc-4536-8259-67a88380e99c"),
+					ExpirationDate: time.Date(2023, time.March, 31, 15, 0, 0, 0, time.UTC),
+				},
+			},
+			http.StatusOK,
+		},
+		{
+			"badRequest",
+			"?group_by=unit",
+			nil,
+			http.StatusBadRequest,
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/users/"+testUserUUID.String()+"/fridge_ingredients"+testcase.query, nil)
+			w := httptest.NewRecorder()
+			authorize(t, req, testUserUUID)
+
+			testServer.db = &mockstore.Mockstore{}
+			testServer.r.ServeHTTP(w, req)
+
+			assert.Equal(t, testcase.expectedStatus, w.Code)
+
+			if testcase.expectedResponse == nil {
+				assert.Equal(t, 0, w.Body.Len())
+				return
+			}
+
+			var resBody []FridgeIngredientGroup
+
+			err := json.Unmarshal(w.Body.Bytes(), &resBody)
+			assert.NoError(t, err, "unexpected error unmarshalling the response body")
+
+			if assert.Len(t, resBody, len(testcase.expectedResponse)) {
+				for i := range testcase.expectedResponse {
+					assert.Equal(t, testcase.expectedResponse[i].IngredientUUID, resBody[i].IngredientUUID)
+					assert.Equal(t, testcase.expectedResponse[i].ExpirationDate, resBody[i].ExpirationDate)
+				}
+				assert.Len(t, resBody[0].Lots, 2) //two lots of the same ingredient
+				assert.Len(t, resBody[1].Lots, 1)
+				assert.Equal(t, uuid.MustParse("9b1f4c2e-6d3a-4f8b-a2c5-0e7d1b3f5a91"), resBody[0].Lots[0].FridgeItemUUID)
+			}
+		})
+	}
+}
+
+func TestListFridgeIngredientsAsOf(t *testing.T) {
+	milkLot := uuid.MustParse("c3d5e7f9-2a4b-4d6e-8f1a-3b5c7d9e1f20")
+	onionLot := uuid.MustParse("4e8a2d6c-1f5b-4c7e-9a3d-8b2f0c6e4d17")
+	milk := uuid.MustParse("2c98fff4-7ccc-4536-8259-67a88380e99c")
+	onion := uuid.MustParse("ffff7c73-52b0-4e3d-bf3f-0c26785ef972")
+	bought := time.Date(2023, time.March, 24, 15, 0, 0, 0, time.UTC)
+	opened := bought.AddDate(0, 0, 3)
+
+	at := func(days int) time.Time {
+		return bought.AddDate(0, 0, days)
+	}
+	event := func(eventType string, fid, iid uuid.UUID, amount, unit, location string, expirationDate time.Time, openedDate *time.Time, createdAt time.Time) store.FridgeEvent {
+		return store.FridgeEvent{FridgeEventUUID: uuid.New(), EventType: eventType, HouseholdUUID: testHouseholdUUID, UserUUID: testUserUUID, FridgeItemUUID: fid, IngredientUUID: iid, Amount: units.MustParseAmount(amount), Unit: unit, PurchasedDate: bought, ExpirationDate: expirationDate, Location: location, OpenedDate: openedDate, CreatedAt: createdAt}
+	}
+
+	deleted := event(store.FridgeEventTypeDelete, milkLot, milk, "1", "L", "freezer", at(70), &opened, at(6))
+	deleted.Reason = store.FridgeEventConsumed
+
+	events := []store.FridgeEvent{ //in the order they happened
+		event(store.FridgeEventTypeAdd, milkLot, milk, "2", "L", "fridge", at(7), nil, bought),
+		event(store.FridgeEventTypeAdd, onionLot, onion, "3", "kg", "fridge", at(14), nil, bought.Add(time.Hour)),
+		event(store.FridgeEventTypeConsume, onionLot, onion, "2500", "g", "fridge", at(14), nil, at(1)), //took 500 g off, so it's in grams now
+		event(store.FridgeEventTypeMove, milkLot, milk, "2", "L", "freezer", at(90), nil, at(2)),
+		event(store.FridgeEventTypeOpen, milkLot, milk, "2", "L", "freezer", at(70), &opened, at(3)),
+		event(store.FridgeEventTypeUpdate, milkLot, milk, "1", "L", "freezer", at(70), &opened, at(4)),
+		event(store.FridgeEventTypeConsume, onionLot, onion, "0", "g", "fridge", at(14), nil, at(5)),
+		deleted,
+		event(store.FridgeEventTypeConsume, uuid.New(), onion, "1", "kg", "fridge", at(14), nil, at(6)), //a lot that was never added
+	}
+
+	lot := func(fid, iid uuid.UUID, amount, unit, location string, expirationDate time.Time, openedDate *time.Time) FridgeIngredient {
+		return FridgeIngredient{FridgeItemUUID: fid, HouseholdUUID: testHouseholdUUID, UserUUID: testUserUUID, IngredientUUID: iid, Amount: units.MustParseAmount(amount), Unit: unit, PurchasedDate: bought, ExpirationDate: expirationDate, Location: location, OpenedDate: openedDate}
+	}
+
+	testcases := []struct {
+		name                         string
+		listFridgeEventsOverrideFunc func(ctx context.Context, hid uuid.UUID, from, to time.Time) ([]store.FridgeEvent, error)
+		query                        string
+		expectedResponse             []FridgeIngredient
+		expectedStatus               int
+	}{
+		{
+			"happyPath:justAdded",
+			nil,
+			"?as_of=2023-03-24T15:30:00Z",
+			[]FridgeIngredient{lot(milkLot, milk, "2", "L", "fridge", at(7), nil)},
+			http.StatusOK,
+		},
+		{
+			"happyPath:consumed",
+			nil,
+			"?as_of=2023-03-25T15:00:01Z",
+			[]FridgeIngredient{
+				lot(milkLot, milk, "2", "L", "fridge", at(7), nil),
+				lot(onionLot, onion, "2500", "g", "fridge", at(14), nil),
+			},
+			http.StatusOK,
+		},
+		{
+			"happyPath:movedAndOpened",
+			nil,
+			"?as_of=2023-03-27T16:00:00Z",
+			[]FridgeIngredient{
+				lot(milkLot, milk, "2", "L", "freezer", at(70), &opened),
+				lot(onionLot, onion, "2500", "g", "fridge", at(14), nil),
+			},
+			http.StatusOK,
+		},
+		{
+			"happyPath:consumedAway",
+			nil,
+			"?as_of=2023-03-29T16:00:00Z",
+			[]FridgeIngredient{lot(milkLot, milk, "1", "L", "freezer", at(70), &opened)},
+			http.StatusOK,
+		},
+		{
+			"happyPath:offset",
+			nil,
+			"?as_of=" + url.QueryEscape("2023-03-25T00:30:00+09:00"), //15:30 UTC the day before
+			[]FridgeIngredient{lot(milkLot, milk, "2", "L", "fridge", at(7), nil)},
+			http.StatusOK,
+		},
+		{
+			"happyPath:beforeAnything",
+			nil,
+			"?as_of=2023-03-24T15:00:00Z", //the add is at as_of, so it's not in yet
+			nil,
+			http.StatusOK,
+		},
+		{
+			"happyPath:allGone",
+			nil,
+			"?as_of=2023-04-01T00:00:00Z",
+			nil,
+			http.StatusOK,
+		},
+		{
+			"badRequest",
+			nil,
+			"?as_of=yesterday",
+			nil,
+			http.StatusBadRequest,
+		},
+		{
+			"badRequest:noZone",
+			nil,
+			"?as_of=2023-03-25T00:00:00",
+			nil,
+			http.StatusBadRequest,
+		},
+		{
+			"internalServerError",
+			func(ctx context.Context, hid uuid.UUID, from, to time.Time) ([]store.FridgeEvent, error) {
+				return nil, errors.New("internalServerError")
+			},
+			"?as_of=2023-03-25T00:00:00Z",
+			nil,
+			http.StatusInternalServerError,
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/users/"+testUserUUID.String()+"/fridge_ingredients"+testcase.query, nil)
+			w := httptest.NewRecorder()
+			authorize(t, req, testUserUUID)
+
+			listFridgeEvents := testcase.listFridgeEventsOverrideFunc
+			if listFridgeEvents == nil {
+				listFridgeEvents = func(ctx context.Context, hid uuid.UUID, from, to time.Time) ([]store.FridgeEvent, error) {
+					assert.Equal(t, testHouseholdUUID, hid)
+					assert.True(t, from.IsZero(), "from: %s", from) //the whole ledger up to then
+
+					var before []store.FridgeEvent
+					for _, e := range events {
+						if e.CreatedAt.Before(to) {
+							before = append(before, e)
+						}
+					}
+					return before, nil
+				}
+			}
+
+			testServer.db = &mockstore.Mockstore{
+				ListFridgeEventsOverride: listFridgeEvents,
+				ListFridgeIngredientsOverride: func(ctx context.Context, hid uuid.UUID) ([]store.FridgeIngredient, error) {
+					t.Error("listed the fridge as it is now")
+					return nil, nil
+				},
+			}
+			testServer.r.ServeHTTP(w, req)
+
+			assert.Equal(t, testcase.expectedStatus, w.Code)
+
+			if testcase.expectedResponse == nil {
+				assert.Equal(t, 0, w.Body.Len())
+				return
+			}
+
+			var resBody []FridgeIngredient
+
+			err := json.Unmarshal(w.Body.Bytes(), &resBody)
+			assert.NoError(t, err, "unexpected error unmarshalling the response body")
+
+			if assert.Len(t, resBody, len(testcase.expectedResponse)) {
+				for i, expected := range testcase.expectedResponse {
+					assert.Equal(t, expected.FridgeItemUUID, resBody[i].FridgeItemUUID)
+					assert.Equal(t, expected.IngredientUUID, resBody[i].IngredientUUID)
+					assert.Equal(t, expected.UserUUID, resBody[i].UserUUID)
+					assert.Equal(t, expected.Amount, resBody[i].Amount)
+					assert.Equal(t, expected.Unit, resBody[i].Unit)
+					assert.Equal(t, expected.Location, resBody[i].Location)
+					assert.True(t, expected.ExpirationDate.Equal(resBody[i].ExpirationDate), "expiration date: %s", resBody[i].ExpirationDate)
+					assert.Equal(t, expected.OpenedDate == nil, resBody[i].OpenedDate == nil)
+				}
+			}
+		})
+	}
+
+	t.Run("groupBy", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/users/"+testUserUUID.String()+"/fridge_ingredients?group_by=ingredient&as_of=2023-03-25T15:00:01Z", nil)
+		w := httptest.NewRecorder()
+		authorize(t, req, testUserUUID)
+
+		testServer.db = &mockstore.Mockstore{
+			ListFridgeEventsOverride: func(ctx context.Context, hid uuid.UUID, from, to time.Time) ([]store.FridgeEvent, error) {
+				return events[:3], nil
+			},
+		}
+		testServer.r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var resBody []FridgeIngredientGroup
+
+		err := json.Unmarshal(w.Body.Bytes(), &resBody)
+		assert.NoError(t, err, "unexpected error unmarshalling the response body")
+
+		if assert.Len(t, resBody, 2) {
+			assert.Equal(t, milk, resBody[0].IngredientUUID)
+			assert.Equal(t, onion, resBody[1].IngredientUUID)
+			assert.Len(t, resBody[1].Lots, 1)
+		}
+	})
+}
+
+func TestCreateFridgeIngredient(t *testing.T) {
+	goodFridgeIngredient := FridgeIngredient{
+		UserUUID:       uuid.MustParse("080b5f09-527b-4581-bb56-19adbfe50ebf"),
+		IngredientUUID: uuid.MustParse("ffff7c73-52b0-4e3d-bf3f-0c26785ef972"),
+		Amount:         units.Whole(3),
+		Unit:           "kg",
+		PurchasedDate:  time.Now(),
+	}
+
+	badFridgeIngredient := FridgeIngredient{
+		UserUUID:       uuid.Nil,
+		IngredientUUID: uuid.MustParse("2c98fff4-7ccc-4536-8259-67a88380e99c"),
+		Amount:         units.Whole(3),
+		Unit:           "kg",
+		PurchasedDate:  time.Now(),
+	}
+
+	otherFridgeIngredient := goodFridgeIngredient
+	otherFridgeIngredient.UserUUID = uuid.MustParse("2c98fff4-7ccc-4536-8259-67a88380e99c")
+
+	unknownUnitFridgeIngredient := goodFridgeIngredient
+	unknownUnitFridgeIngredient.Unit = "handful"
+
+	frozenFridgeIngredient := goodFridgeIngredient
+	frozenFridgeIngredient.Location = "freezer"
+
+	openedFridgeIngredient := goodFridgeIngredient
+	openedFridgeIngredient.OpenedDate = &goodFridgeIngredient.PurchasedDate
+
+	unknownLocationFridgeIngredient := goodFridgeIngredient
+	unknownLocationFridgeIngredient.Location = "garage"
+
+	openedEarlyFridgeIngredient := goodFridgeIngredient
+	openedEarly := goodFridgeIngredient.PurchasedDate.Add(-24 * time.Hour)
+	openedEarlyFridgeIngredient.OpenedDate = &openedEarly
+
+	testcases := []struct {
+		name                               string
+		getIngredientOverrideFunc          func(ctx context.Context, id uuid.UUID) (*store.Ingredient, error)
+		createFridgeIngredientOverrideFunc func(ctx context.Context, f store.FridgeIngredient) (*store.FridgeIngredient, error)
+		requestBody                        FridgeIngredient
+		expectedResponse                   *FridgeIngredient
+		expectedStatus                     int
+	}{
+		{
+			"happyPath",
+			nil,
+			nil,
+			goodFridgeIngredient,
+			&FridgeIngredient{
+				UserUUID:       uuid.MustParse("080b5f09-527b-4581-bb56-19adbfe50ebf"),
+				IngredientUUID: uuid.MustParse("ffff7c73-52b0-4e3d-bf3f-0c26785ef972"),
+				Amount:         units.Whole(3),
+				Unit:           "kg",
+				PurchasedDate:  time.Now(),
+				ExpirationDate: time.Now().Add(7 * 24 * time.Hour), //여기서의 time.Now()는 직전의 time.Now()랑 아주 약간 달라질 것이므로 expectedResponse 검사할 때 정확한 time.Time을 검사하는게 아니라 year, month, day만 검사하래..
+			},
+			http.StatusOK,
+		},
+		{
+			"happyPath:freezer",
+			nil,
+			nil,
+			frozenFridgeIngredient,
+			&FridgeIngredient{
+				UserUUID:       uuid.MustParse("080b5f09-527b-4581-bb56-19adbfe50ebf"),
+				IngredientUUID: uuid.MustParse("ffff7c73-52b0-4e3d-bf3f-0c26785ef972"),
+				Amount:         units.Whole(3),
+				Unit:           "kg",
+				PurchasedDate:  time.Now(),
+				ExpirationDate: time.Now().Add(240 * 24 * time.Hour),
+				Location:       "freezer",
+			},
+			http.StatusOK,
+		},
+		{
+			"happyPath:opened",
+			nil,
+			nil,
+			openedFridgeIngredient,
+			&FridgeIngredient{
+				UserUUID:       uuid.MustParse("080b5f09-527b-4581-bb56-19adbfe50ebf"),
+				IngredientUUID: uuid.MustParse("ffff7c73-52b0-4e3d-bf3f-0c26785ef972"),
+				Amount:         units.Whole(3),
+				Unit:           "kg",
+				PurchasedDate:  time.Now(),
+				ExpirationDate: time.Now().Add(3 * 24 * time.Hour),
+			},
+			http.StatusOK,
+		},
+		{
+			"badRequest:location",
+			nil,
+			nil,
+			unknownLocationFridgeIngredient,
+			nil,
+			http.StatusBadRequest,
+		},
+		{
+			"badRequest:openedDate",
+			nil,
+			nil,
+			openedEarlyFridgeIngredient,
+			nil,
+			http.StatusBadRequest,
+		},
+		{
+			"badRequest",
+			nil,
+			nil,
+			badFridgeIngredient,
+			nil,
+			http.StatusBadRequest,
+		},
+		{
+			"badRequest:unit",
+			nil,
+			nil,
+			unknownUnitFridgeIngredient,
+			nil,
+			http.StatusBadRequest,
+		},
+		{
+			"forbidden",
+			nil,
+			nil,
+			otherFridgeIngredient,
+			nil,
+			http.StatusForbidden,
+		},
+		{
+			"internalServerError:getIngredient",
+			func(ctx context.Context, id uuid.UUID) (*store.Ingredient, error) {
+				return nil, errors.New("internalServerError:getIngredient")
+			},
+			nil,
+			goodFridgeIngredient,
+			nil,
+			http.StatusInternalServerError,
+		},
+		{
+			"internalServerError:createFridgeIngredient",
+			nil,
+			func(ctx context.Context, f store.FridgeIngredient) (*store.FridgeIngredient, error) {
+				return nil, errors.New("internalServerError:createFridgeIngredient")
+			},
+			goodFridgeIngredient,
+			nil,
+			http.StatusInternalServerError,
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			reqBody, err := json.Marshal(testcase.requestBody)
+			assert.NoError(t, err, "unexpected error marshalling the request body")
+
+			req := httptest.NewRequest(http.MethodPost, "/fridge_ingredients", bytes.NewBuffer(reqBody))
+			w := httptest.NewRecorder()
+			authorize(t, req, testUserUUID)
+
+			testServer.db = &mockstore.Mockstore{
+				GetIngredientOverride:          testcase.getIngredientOverrideFunc,
+				CreateFridgeIngredientOverride: testcase.createFridgeIngredientOverrideFunc}
+			testServer.r.ServeHTTP(w, req)
+
+			assert.Equal(t, testcase.expectedStatus, w.Code)
+
+			if testcase.expectedResponse != nil {
+				var resBody FridgeIngredient
+
+				err := json.Unmarshal(w.Body.Bytes(), &resBody)
+				assert.NoError(t, err, "unexpected error unmarshalling the response body")
+
+				assert.Equal(t, testcase.expectedResponse.PurchasedDate.Year(), resBody.PurchasedDate.Year())
+				assert.Equal(t, testcase.expectedResponse.PurchasedDate.Month(), resBody.PurchasedDate.Month())
+				assert.Equal(t, testcase.expectedResponse.PurchasedDate.Day(), resBody.PurchasedDate.Day()) //이거 한줄로 줄이는 방법 없을까..
+
+				assert.Equal(t, testcase.expectedResponse.ExpirationDate.Year(), resBody.ExpirationDate.Year())
+				assert.Equal(t, testcase.expectedResponse.ExpirationDate.Month(), resBody.ExpirationDate.Month())
+				assert.Equal(t, testcase.expectedResponse.ExpirationDate.Day(), resBody.ExpirationDate.Day())
+
+				assert.Equal(t, testcase.expectedResponse.UserUUID, resBody.UserUUID)
+				assert.Equal(t, testcase.expectedResponse.IngredientUUID, resBody.IngredientUUID)
+				assert.Equal(t, testcase.expectedResponse.Amount, resBody.Amount)
+				assert.Equal(t, testcase.expectedResponse.Amount, resBody.Amount)
+				assert.Equal(t, testcase.expectedResponse.Unit, resBody.Unit)
+
+				expectedLocation := testcase.expectedResponse.Location
+				if expectedLocation == "" {
+					expectedLocation = "fridge"
+				}
+				assert.Equal(t, expectedLocation, resBody.Location)
+			} else {
+				assert.Equal(t, 0, w.Body.Len())
+			}
+		})
+	}
+}
+
+func TestUpdateFridgeIngredient(t *testing.T) {
+	goodFridgeIngredient := FridgeIngredient{
+		FridgeItemUUID: uuid.MustParse("9b1f4c2e-6d3a-4f8b-a2c5-0e7d1b3f5a91"),
+		UserUUID:       uuid.MustParse("080b5f09-527b-4581-bb56-19adbfe50ebf"),
+		IngredientUUID: uuid.MustParse("ffff7c73-52b0-4e3d-bf3f-0c26785ef972"),
+		Amount:         units.Whole(5),
+		Unit:           "lb",
+		PurchasedDate:  time.Now(),
+	}
+
+	badFridgeIngredient := FridgeIngredient{
+		FridgeItemUUID: uuid.MustParse("9b1f4c2e-6d3a-4f8b-a2c5-0e7d1b3f5a91"),
+		UserUUID:       uuid.Nil,
+		IngredientUUID: uuid.MustParse("2c98fff4-7ccc-4536-8259-67a88380e99c"),
+		Amount:         units.Whole(5),
+		Unit:           "kg",
+		PurchasedDate:  time.Now(),
+	}
+
+	otherFridgeIngredient := goodFridgeIngredient
+	otherFridgeIngredient.UserUUID = uuid.MustParse("2c98fff4-7ccc-4536-8259-67a88380e99c")
+
+	testcases := []struct {
+		name                               string
+		updateFridgeIngredientOverrideFunc func(ctx context.Context, f store.FridgeIngredient) (*store.FridgeIngredient, error)
+		requestBody                        FridgeIngredient
+		expectedResponse                   *FridgeIngredient
+		expectedStatus                     int
+	}{
+		{
+			"happyPath",
+			nil,
+			goodFridgeIngredient,
+			&FridgeIngredient{
+				UserUUID:       uuid.MustParse("080b5f09-527b-4581-bb56-19adbfe50ebf"),
+				IngredientUUID: uuid.MustParse("ffff7c73-52b0-4e3d-bf3f-0c26785ef972"),
+				Amount:         units.Whole(5),
+				Unit:           "lb",
+				PurchasedDate:  time.Now(),
+				ExpirationDate: time.Now().Add(7 * 24 * time.Hour),
+			},
+			http.StatusOK,
+		},
+		{
+			"badRequest",
+			nil,
+			badFridgeIngredient,
+			nil,
+			http.StatusBadRequest,
+		},
+		{
+			"forbidden",
+			nil,
+			otherFridgeIngredient,
+			nil,
+			http.StatusForbidden,
+		},
+		{
+			"internalServerError",
+			func(ctx context.Context, f store.FridgeIngredient) (*store.FridgeIngredient, error) {
+				return nil, errors.New("internalServerError")
+			},
+			goodFridgeIngredient,
+			nil,
+			http.StatusInternalServerError,
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			reqBody, err := json.Marshal(testcase.requestBody)
+			assert.NoError(t, err, "unexpected error marshalling the request body")
+
+			req := httptest.NewRequest(http.MethodPost, "/fridge_ingredients/"+testcase.requestBody.FridgeItemUUID.String(), bytes.NewBuffer(reqBody))
+			w := httptest.NewRecorder()
+			authorize(t, req, testUserUUID)
+
+			testServer.db = &mockstore.Mockstore{UpdateFridgeIngredientOverride: testcase.updateFridgeIngredientOverrideFunc}
+			testServer.r.ServeHTTP(w, req)
+
+			assert.Equal(t, testcase.expectedStatus, w.Code)
+
+			if testcase.expectedResponse != nil {
+				var resBody FridgeIngredient
+
+				err := json.Unmarshal(w.Body.Bytes(), &resBody)
+				assert.NoError(t, err, "unexpected error unmarshalling the response body")
+
+				assert.Equal(t, testcase.expectedResponse.PurchasedDate.Year(), resBody.PurchasedDate.Year())
+				assert.Equal(t, testcase.expectedResponse.PurchasedDate.Month(), resBody.PurchasedDate.Month())
+				assert.Equal(t, testcase.expectedResponse.PurchasedDate.Day(), resBody.PurchasedDate.Day()) //이거 한줄로 줄이는 방법 없을까..
+
+				assert.Equal(t, testcase.expectedResponse.ExpirationDate.Year(), resBody.ExpirationDate.Year())
+				assert.Equal(t, testcase.expectedResponse.ExpirationDate.Month(), resBody.ExpirationDate.Month())
+				assert.Equal(t, testcase.expectedResponse.ExpirationDate.Day(), resBody.ExpirationDate.Day())
+
+				assert.Equal(t, testcase.expectedResponse.UserUUID, resBody.UserUUID)
+				assert.Equal(t, testcase.expectedResponse.IngredientUUID, resBody.IngredientUUID)
+				assert.Equal(t, testcase.expectedResponse.Amount, resBody.Amount)
+				assert.Equal(t, testcase.expectedResponse.Amount, resBody.Amount)
+				assert.Equal(t, testcase.expectedResponse.Unit, resBody.Unit)
+			} else {
+				assert.Equal(t, 0, w.Body.Len())
+			}
+		})
+	}
+}
+
+func TestUpdateFridgeIngredientExpiry(t *testing.T) {
+	pinClock(t)
+
+	fid := uuid.MustParse("9b1f4c2e-6d3a-4f8b-a2c5-0e7d1b3f5a91")
+	onion := uuid.MustParse("ffff7c73-52b0-4e3d-bf3f-0c26785ef972") //7 days in the fridge, 240 in the freezer, 3 once it's open
+	bought := testNow.AddDate(0, 0, -2)
+	day := 24 * time.Hour
+	late := bought.Add(5 * day)
+
+	frozenLot := func(ctx context.Context, hid, fid uuid.UUID) (*store.FridgeIngredient, error) { //moved to the freezer, half its freezer life left
+		return &store.FridgeIngredient{FridgeItemUUID: fid, HouseholdUUID: hid, IngredientUUID: onion, PurchasedDate: bought, ExpirationDate: testNow.Add(120 * day), Location: "freezer"}, nil
+	}
+	fridgeLot := func(ctx context.Context, hid, fid uuid.UUID) (*store.FridgeIngredient, error) { //went off a day early for some reason
+		return &store.FridgeIngredient{FridgeItemUUID: fid, HouseholdUUID: hid, IngredientUUID: onion, PurchasedDate: bought, ExpirationDate: bought.Add(6 * day), Location: "fridge"}, nil
+	}
+
+	update := func(purchased time.Time, location string, opened *time.Time) FridgeIngredient {
+		return FridgeIngredient{FridgeItemUUID: fid, UserUUID: testUserUUID, IngredientUUID: onion, Amount: units.Whole(2), Unit: "kg", PurchasedDate: purchased, Location: location, OpenedDate: opened}
+	}
+
+	testcases := []struct {
+		name                            string
+		getFridgeIngredientOverrideFunc func(ctx context.Context, hid, fid uuid.UUID) (*store.FridgeIngredient, error)
+		requestBody                     FridgeIngredient
+		expectedExpirationDate          time.Time
+		expectedStatus                  int
+	}{
+		{"amountOnly", frozenLot, update(bought, "freezer", nil), testNow.Add(120 * day), http.StatusOK}, //not bought+240 days
+		{"purchasedDate", frozenLot, update(bought.Add(-day), "freezer", nil), testNow.Add(119 * day), http.StatusOK},
+		{"location", frozenLot, update(bought, "fridge", nil), testNow.Add(84 * time.Hour), http.StatusOK}, //half of 7 days, from now
+		{"opened", fridgeLot, update(bought, "fridge", &testNow), testNow.Add(3 * day), http.StatusOK},
+		{"openedLate", fridgeLot, update(bought, "fridge", &late), bought.Add(6 * day), http.StatusOK},
+		{
+			"notFound",
+			func(ctx context.Context, hid, fid uuid.UUID) (*store.FridgeIngredient, error) {
+				return nil, store.ErrNotFound
+			},
+			update(bought, "fridge", nil),
+			time.Time{},
+			http.StatusNotFound,
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			reqBody, err := json.Marshal(testcase.requestBody)
+			assert.NoError(t, err, "unexpected error marshalling the request body")
+
+			req := httptest.NewRequest(http.MethodPost, "/fridge_ingredients/"+fid.String(), bytes.NewBuffer(reqBody))
+			w := httptest.NewRecorder()
+			authorize(t, req, testUserUUID)
+
+			testServer.db = &mockstore.Mockstore{GetFridgeIngredientOverride: testcase.getFridgeIngredientOverrideFunc}
+			testServer.r.ServeHTTP(w, req)
+
+			assert.Equal(t, testcase.expectedStatus, w.Code)
+
+			if testcase.expectedStatus == http.StatusOK {
+				var resBody FridgeIngredient
+
+				err := json.Unmarshal(w.Body.Bytes(), &resBody)
+				assert.NoError(t, err, "unexpected error unmarshalling the response body")
+				assert.True(t, testcase.expectedExpirationDate.Equal(resBody.ExpirationDate), "expiration date: %s", resBody.ExpirationDate)
+			}
+		})
+	}
+}
+
+func TestDeleteFridgeIngredient(t *testing.T) {
+	fid := uuid.MustParse("ffff7c73-52b0-4e3d-bf3f-0c26785ef972")
+	cost := units.MustParseAmount("2.5")
+
+	testcases := []struct {
+		name                               string
+		deleteFridgeIngredientOverrideFunc func(ctx context.Context, e store.FridgeEvent) error
+		uid                                string
+		fid                                string
+		query                              string
+		expectedEvent                      *store.FridgeEvent
+		expectedStatus                     int
+	}{
+		{
+			"happyPath",
+			nil,
+			"080b5f09-527b-4581-bb56-19adbfe50ebf",
+			"ffff7c73-52b0-4e3d-bf3f-0c26785ef972",
+			"?reason=consumed",
+			&store.FridgeEvent{HouseholdUUID: testHouseholdUUID, UserUUID: testUserUUID, FridgeItemUUID: fid, Reason: store.FridgeEventConsumed},
+			http.StatusOK,
+		},
+		{
+			"happyPath:cost",
+			nil,
+			"080b5f09-527b-4581-bb56-19adbfe50ebf",
+			"ffff7c73-52b0-4e3d-bf3f-0c26785ef972",
+			"?reason=expired&estimated_cost=2.50",
+			&store.FridgeEvent{HouseholdUUID: testHouseholdUUID, UserUUID: testUserUUID, FridgeItemUUID: fid, Reason: store.FridgeEventExpired, EstimatedCost: &cost},
+			http.StatusOK,
+		},
+		{
+			"badRequest",
+			nil,
+			"maerong",
+			"maerong",
+			"?reason=consumed",
+			nil,
+			http.StatusBadRequest,
+		},
+		{
+			"badRequest:noReason",
+			nil,
+			"080b5f09-527b-4581-bb56-19adbfe50ebf",
+			"ffff7c73-52b0-4e3d-bf3f-0c26785ef972",
+			"",
+			nil,
+			http.StatusBadRequest,
+		},
+		{
+			"badRequest:reason",
+			nil,
+			"080b5f09-527b-4581-bb56-19adbfe50ebf",
+			"ffff7c73-52b0-4e3d-bf3f-0c26785ef972",
+			"?reason=eaten_by_the_cat",
+			nil,
+			http.StatusBadRequest,
+		},
+		{
+			"badRequest:cost",
+			nil,
+			"080b5f09-527b-4581-bb56-19adbfe50ebf",
+			"ffff7c73-52b0-4e3d-bf3f-0c26785ef972",
+			"?reason=discarded&estimated_cost=cheap",
+			nil,
+			http.StatusBadRequest,
+		},
+		{
+			"badRequest:negativeCost",
+			nil,
+			"080b5f09-527b-4581-bb56-19adbfe50ebf",
+			"ffff7c73-52b0-4e3d-bf3f-0c26785ef972",
+			"?reason=discarded&estimated_cost=-1",
+			nil,
+			http.StatusBadRequest,
+		},
+		{
+			"forbidden",
+			nil,
+			"2c98fff4-7ccc-4536-8259-67a88380e99c",
+			"ffff7c73-52b0-4e3d-bf3f-0c26785ef972",
+			"?reason=consumed",
+			nil,
+			http.StatusForbidden,
+		},
+		{
+			"notFound",
+			func(ctx context.Context, e store.FridgeEvent) error {
+				return store.ErrNotFound
+			},
+			"080b5f09-527b-4581-bb56-19adbfe50ebf",
+			"ffff7c73-52b0-4e3d-bf3f-0c26785ef972",
+			"?reason=consumed",
+			nil,
+			http.StatusNotFound,
+		},
+		{
+			"internalServerError",
+			func(ctx context.Context, e store.FridgeEvent) error {
+				return errors.New("internalServerError")
+			},
+			"080b5f09-527b-4581-bb56-19adbfe50ebf",
+			"ffff7c73-52b0-4e3d-bf3f-0c26785ef972",
+			"?reason=consumed",
+			nil,
+			http.StatusInternalServerError,
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodDelete, "/users/"+testcase.uid+"/fridge_ingredients/"+testcase.fid+testcase.query, nil)
+			w := httptest.NewRecorder()
+			authorize(t, req, testUserUUID)
+
+			var got *store.FridgeEvent
+			deleteFridgeIngredient := testcase.deleteFridgeIngredientOverrideFunc
+			if deleteFridgeIngredient == nil {
+				deleteFridgeIngredient = func(ctx context.Context, e store.FridgeEvent) error {
+					got = &e
+					return nil
+				}
+			}
+
+			testServer.db = &mockstore.Mockstore{DeleteFridgeIngredientOverride: deleteFridgeIngredient}
+			testServer.r.ServeHTTP(w, req)
+
+			assert.Equal(t, testcase.expectedStatus, w.Code)
+			assert.Equal(t, testcase.expectedEvent, got)
+		})
+	}
+}
+
+func TestConsumeFridgeIngredient(t *testing.T) {
+	ingredientUUID := uuid.MustParse("ffff7c73-52b0-4e3d-bf3f-0c26785ef972")
+
+	testcases := []struct {
+		name                                string
+		consumeFridgeIngredientOverrideFunc func(ctx context.Context, hid, iid, uid uuid.UUID, amount units.Amount, unit string) ([]store.FridgeIngredient, error)
+		user                                uuid.UUID
+		path                                string
+		requestBody                         ConsumeFridgeIngredient
+		expectedLeft                        int
+		expectedStatus                      int
+	}{
+		{
+			"happyPath",
+			nil,
+			testUserUUID,
+			ingredientUUID.String(),
+			ConsumeFridgeIngredient{Amount: units.Whole(3), Unit: "kg"},
+			1,
+			http.StatusOK,
+		},
+		{
+			"allGone",
+			func(ctx context.Context, hid, iid, uid uuid.UUID, amount units.Amount, unit string) ([]store.FridgeIngredient, error) {
+				return nil, nil
+			},
+			testUserUUID,
+			ingredientUUID.String(),
+			ConsumeFridgeIngredient{Amount: units.Whole(4), Unit: "kg"},
+			0,
+			http.StatusOK,
+		},
+		{
+			"badRequest:path",
+			nil,
+			testUserUUID,
+			"maerong",
+			ConsumeFridgeIngredient{Amount: units.Whole(3), Unit: "kg"},
+			0,
+			http.StatusBadRequest,
+		},
+		{
+			"happyPath:alias",
+			nil,
+			testUserUUID,
+			ingredientUUID.String(),
+			ConsumeFridgeIngredient{Amount: units.Whole(3000), Unit: "Grams"},
+			1,
+			http.StatusOK,
+		},
+		{
+			"happyPath:fraction",
+			nil,
+			testUserUUID,
+			ingredientUUID.String(),
+			ConsumeFridgeIngredient{Amount: units.MustParseAmount("1 1/2"), Unit: "kg"},
+			1,
+			http.StatusOK,
+		},
+		{
+			"badRequest:amount",
+			nil,
+			testUserUUID,
+			ingredientUUID.String(),
+			ConsumeFridgeIngredient{Amount: units.Whole(0), Unit: "kg"},
+			0,
+			http.StatusBadRequest,
+		},
+		{
+			"badRequest:unit",
+			nil,
+			testUserUUID,
+			ingredientUUID.String(),
+			ConsumeFridgeIngredient{Amount: units.Whole(3), Unit: "handful"},
+			0,
+			http.StatusBadRequest,
+		},
+		{
+			"forbidden",
+			nil,
+			testRecipeOwnerUUID,
+			ingredientUUID.String(),
+			ConsumeFridgeIngredient{Amount: units.Whole(3), Unit: "kg"},
+			0,
+			http.StatusForbidden,
+		},
+		{
+			"conflict:notEnough",
+			func(ctx context.Context, hid, iid, uid uuid.UUID, amount units.Amount, unit string) ([]store.FridgeIngredient, error) {
+				return nil, store.ErrNotEnough
+			},
+			testUserUUID,
+			ingredientUUID.String(),
+			ConsumeFridgeIngredient{Amount: units.Whole(5), Unit: "kg"},
+			0,
+			http.StatusConflict,
+		},
+		{
+			"internalServerError",
+			func(ctx context.Context, hid, iid, uid uuid.UUID, amount units.Amount, unit string) ([]store.FridgeIngredient, error) {
+				return nil, errors.New("internalServerError")
+			},
+			testUserUUID,
+			ingredientUUID.String(),
+			ConsumeFridgeIngredient{Amount: units.Whole(3), Unit: "kg"},
+			0,
+			http.StatusInternalServerError,
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			reqBody, err := json.Marshal(testcase.requestBody)
+			assert.NoError(t, err, "unexpected error marshalling the request body")
+
+			req := httptest.NewRequest(http.MethodPost, "/users/"+testcase.user.String()+"/ingredients/"+testcase.path+"/consume", bytes.NewBuffer(reqBody))
+			w := httptest.NewRecorder()
+			authorize(t, req, testUserUUID)
+
+			var gotHousehold, gotIngredient, gotUser uuid.UUID
+			var gotAmount units.Amount
+			var gotUnit string
+
+			consume := testcase.consumeFridgeIngredientOverrideFunc
+			testServer.db = &mockstore.Mockstore{
+				ConsumeFridgeIngredientOverride: func(ctx context.Context, hid, iid, uid uuid.UUID, amount units.Amount, unit string) ([]store.FridgeIngredient, error) {
+					gotHousehold, gotIngredient, gotUser, gotAmount, gotUnit = hid, iid, uid, amount, unit
+					if consume != nil {
+						return consume(ctx, hid, iid, uid, amount, unit)
+					}
+					return (&mockstore.Mockstore{}).ConsumeFridgeIngredient(ctx, hid, iid, uid, amount, unit)
+				},
+			}
+			testServer.r.ServeHTTP(w, req)
+
+			assert.Equal(t, testcase.expectedStatus, w.Code)
+
+			if testcase.expectedStatus != http.StatusOK {
+				assert.Equal(t, 0, w.Body.Len())
+				return
+			}
+
+			assert.Equal(t, testHouseholdUUID, gotHousehold)
+			assert.Equal(t, ingredientUUID, gotIngredient)
+			assert.Equal(t, testUserUUID, gotUser) //it's on the ledger as theirs
+			assert.Equal(t, testcase.requestBody.Amount, gotAmount)
+			assert.Equal(t, units.Canonical(testcase.requestBody.Unit), gotUnit) //the store only ever sees symbols
+
+			if testcase.expectedLeft == 0 {
+				assert.Equal(t, 0, w.Body.Len())
+				return
+			}
+
+			var resBody []FridgeIngredient
+
+			err = json.Unmarshal(w.Body.Bytes(), &resBody)
+			assert.NoError(t, err, "unexpected error unmarshalling the response body")
+			assert.Len(t, resBody, testcase.expectedLeft)
+		})
+	}
+}
+
+func TestMoveFridgeIngredient(t *testing.T) {
+	fid := uuid.MustParse("9b1f4c2e-6d3a-4f8b-a2c5-0e7d1b3f5a91")
+	bought := time.Date(2023, time.March, 24, 15, 0, 0, 0, time.UTC) //the mockstore's lot keeps 7 days in the fridge, the onion 240 in the freezer
+	opened := bought
+
+	at := func(days int) *time.Time {
+		t := bought.AddDate(0, 0, days)
+		return &t
+	}
+	future := time.Now().Add(time.Hour)
+
+	openedLot := func(ctx context.Context, hid, fid uuid.UUID) (*store.FridgeIngredient, error) {
+		return &store.FridgeIngredient{FridgeItemUUID: fid, HouseholdUUID: hid, PurchasedDate: bought, ExpirationDate: *at(3), Location: "fridge", OpenedDate: &opened}, nil
+	}
+
+	testcases := []struct {
+		name                                   string
+		getFridgeIngredientOverrideFunc        func(ctx context.Context, hid, fid uuid.UUID) (*store.FridgeIngredient, error)
+		setFridgeIngredientStorageOverrideFunc func(ctx context.Context, was, f store.FridgeIngredient, uid uuid.UUID, eventType string) (*store.FridgeIngredient, error)
+		path                                   string
+		requestBody                            MoveFridgeIngredient
+		expectedLocation                       string
+		expectedExpirationDate                 time.Time
+		expectedStatus                         int
+	}{
+		{
+			"happyPath",
+			nil,
+			nil,
+			fid.String(),
+			MoveFridgeIngredient{UserUUID: testUserUUID, Location: "freezer", MovedAt: at(0)},
+			"freezer",
+			*at(240),
+			http.StatusOK,
+		},
+		{
+			"happyPath:pantry",
+			nil,
+			nil,
+			fid.String(),
+			MoveFridgeIngredient{UserUUID: testUserUUID, Location: "pantry", MovedAt: at(0)},
+			"pantry",
+			*at(30),
+			http.StatusOK,
+		},
+		{
+			"happyPath:opened",
+			openedLot,
+			nil,
+			fid.String(),
+			MoveFridgeIngredient{UserUUID: testUserUUID, Location: "freezer", MovedAt: at(1)}, //2 of its 3 days left
+			"freezer",
+			*at(1 + 160),
+			http.StatusOK,
+		},
+		{
+			"happyPath:goneOff",
+			nil,
+			nil,
+			fid.String(),
+			MoveFridgeIngredient{UserUUID: testUserUUID, Location: "freezer", MovedAt: at(10)},
+			"freezer",
+			*at(7),
+			http.StatusOK,
+		},
+		{
+			"badRequest:path",
+			nil,
+			nil,
+			"maerong",
+			MoveFridgeIngredient{UserUUID: testUserUUID, Location: "freezer", MovedAt: at(0)},
+			"",
+			time.Time{},
+			http.StatusBadRequest,
+		},
+		{
+			"badRequest:location",
+			nil,
+			nil,
+			fid.String(),
+			MoveFridgeIngredient{UserUUID: testUserUUID, Location: "garage", MovedAt: at(0)},
+			"",
+			time.Time{},
+			http.StatusBadRequest,
+		},
+		{
+			"badRequest:beforePurchase",
+			nil,
+			nil,
+			fid.String(),
+			MoveFridgeIngredient{UserUUID: testUserUUID, Location: "freezer", MovedAt: at(-1)},
+			"",
+			time.Time{},
+			http.StatusBadRequest,
+		},
+		{
+			"badRequest:future",
+			nil,
+			nil,
+			fid.String(),
+			MoveFridgeIngredient{UserUUID: testUserUUID, Location: "freezer", MovedAt: &future},
+			"",
+			time.Time{},
+			http.StatusBadRequest,
+		},
+		{
+			"conflict:changedSince",
+			nil,
+			func(ctx context.Context, was, f store.FridgeIngredient, uid uuid.UUID, eventType string) (*store.FridgeIngredient, error) {
+				return nil, store.ErrConflict
+			},
+			fid.String(),
+			MoveFridgeIngredient{UserUUID: testUserUUID, Location: "freezer", MovedAt: at(0)},
+			"",
+			time.Time{},
+			http.StatusConflict,
+		},
+		{
+			"forbidden",
+			nil,
+			nil,
+			fid.String(),
+			MoveFridgeIngredient{UserUUID: testRecipeOwnerUUID, Location: "freezer", MovedAt: at(0)},
+			"",
+			time.Time{},
+			http.StatusForbidden,
+		},
+		{
+			"notFound",
+			func(ctx context.Context, hid, fid uuid.UUID) (*store.FridgeIngredient, error) {
+				return nil, store.ErrNotFound
+			},
+			nil,
+			fid.String(),
+			MoveFridgeIngredient{UserUUID: testUserUUID, Location: "freezer", MovedAt: at(0)},
+			"",
+			time.Time{},
+			http.StatusNotFound,
+		},
+		{
+			"internalServerError",
+			nil,
+			func(ctx context.Context, was, f store.FridgeIngredient, uid uuid.UUID, eventType string) (*store.FridgeIngredient, error) {
+				return nil, errors.New("internalServerError")
+			},
+			fid.String(),
+			MoveFridgeIngredient{UserUUID: testUserUUID, Location: "freezer", MovedAt: at(0)},
+			"",
+			time.Time{},
+			http.StatusInternalServerError,
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			reqBody, err := json.Marshal(testcase.requestBody)
+			assert.NoError(t, err, "unexpected error marshalling the request body")
+
+			req := httptest.NewRequest(http.MethodPost, "/fridge_ingredients/"+testcase.path+"/move", bytes.NewBuffer(reqBody))
+			w := httptest.NewRecorder()
+			authorize(t, req, testUserUUID)
+
+			var gotUser uuid.UUID
+			var gotEventType string
+			var gotWas store.FridgeIngredient
+
+			set := testcase.setFridgeIngredientStorageOverrideFunc
+			testServer.db = &mockstore.Mockstore{
+				GetFridgeIngredientOverride: testcase.getFridgeIngredientOverrideFunc,
+				SetFridgeIngredientStorageOverride: func(ctx context.Context, was, f store.FridgeIngredient, uid uuid.UUID, eventType string) (*store.FridgeIngredient, error) {
+					gotUser, gotEventType = uid, eventType
+					gotWas = was
+					if set != nil {
+						return set(ctx, was, f, uid, eventType)
+					}
+					return (&mockstore.Mockstore{}).SetFridgeIngredientStorage(ctx, was, f, uid, eventType)
+				},
+			}
+			testServer.r.ServeHTTP(w, req)
+
+			assert.Equal(t, testcase.expectedStatus, w.Code)
+
+			if testcase.expectedStatus != http.StatusOK {
+				assert.Equal(t, 0, w.Body.Len())
+				return
+			}
+
+			assert.Equal(t, testUserUUID, gotUser)
+			assert.Equal(t, store.FridgeEventTypeMove, gotEventType)
+			assert.Equal(t, "fridge", gotWas.Location, "the store compares the lot to how it was before the move")
+
+			var resBody FridgeIngredient
+
+			err = json.Unmarshal(w.Body.Bytes(), &resBody)
+			assert.NoError(t, err, "unexpected error unmarshalling the response body")
+			assert.Equal(t, testcase.expectedLocation, resBody.Location)
+			assert.True(t, testcase.expectedExpirationDate.Equal(resBody.ExpirationDate), "expiration date: %s", resBody.ExpirationDate)
+		})
+	}
+}
+
+func TestOpenFridgeIngredient(t *testing.T) {
+	fid := uuid.MustParse("9b1f4c2e-6d3a-4f8b-a2c5-0e7d1b3f5a91")
+	bought := time.Date(2023, time.March, 24, 15, 0, 0, 0, time.UTC) //the mockstore's lot keeps 7 days in the fridge, the onion 3 once it's open
+
+	at := func(days int) *time.Time {
+		t := bought.AddDate(0, 0, days)
+		return &t
+	}
+	future := time.Now().Add(time.Hour)
+
+	testcases := []struct {
+		name                                   string
+		getFridgeIngredientOverrideFunc        func(ctx context.Context, hid, fid uuid.UUID) (*store.FridgeIngredient, error)
+		setFridgeIngredientStorageOverrideFunc func(ctx context.Context, was, f store.FridgeIngredient, uid uuid.UUID, eventType string) (*store.FridgeIngredient, error)
+		path                                   string
+		requestBody                            OpenFridgeIngredient
+		expectedExpirationDate                 time.Time
+		expectedStatus                         int
+	}{
+		{
+			"happyPath",
+			nil,
+			nil,
+			fid.String(),
+			OpenFridgeIngredient{UserUUID: testUserUUID, OpenedAt: at(1)},
+			*at(4),
+			http.StatusOK,
+		},
+		{
+			"happyPath:late",
+			nil,
+			nil,
+			fid.String(),
+			OpenFridgeIngredient{UserUUID: testUserUUID, OpenedAt: at(5)},
+			*at(7),
+			http.StatusOK,
+		},
+		{
+			"happyPath:freezer",
+			func(ctx context.Context, hid, fid uuid.UUID) (*store.FridgeIngredient, error) {
+				return &store.FridgeIngredient{FridgeItemUUID: fid, HouseholdUUID: hid, PurchasedDate: bought, ExpirationDate: *at(240), Location: "freezer"}, nil
+			},
+			nil,
+			fid.String(),
+			OpenFridgeIngredient{UserUUID: testUserUUID, OpenedAt: at(1)},
+			*at(240),
+			http.StatusOK,
+		},
+		{
+			"badRequest:path",
+			nil,
+			nil,
+			"maerong",
+			OpenFridgeIngredient{UserUUID: testUserUUID, OpenedAt: at(1)},
+			time.Time{},
+			http.StatusBadRequest,
+		},
+		{
+			"badRequest:beforePurchase",
+			nil,
+			nil,
+			fid.String(),
+			OpenFridgeIngredient{UserUUID: testUserUUID, OpenedAt: at(-1)},
+			time.Time{},
+			http.StatusBadRequest,
+		},
+		{
+			"badRequest:future",
+			nil,
+			nil,
+			fid.String(),
+			OpenFridgeIngredient{UserUUID: testUserUUID, OpenedAt: &future},
+			time.Time{},
+			http.StatusBadRequest,
+		},
+		{
+			"conflict:changedSince",
+			nil,
+			func(ctx context.Context, was, f store.FridgeIngredient, uid uuid.UUID, eventType string) (*store.FridgeIngredient, error) {
+				return nil, store.ErrConflict
+			},
+			fid.String(),
+			OpenFridgeIngredient{UserUUID: testUserUUID, OpenedAt: at(1)},
+			time.Time{},
+			http.StatusConflict,
+		},
+		{
+			"forbidden",
+			nil,
+			nil,
+			fid.String(),
+			OpenFridgeIngredient{UserUUID: testRecipeOwnerUUID, OpenedAt: at(1)},
+			time.Time{},
+			http.StatusForbidden,
+		},
+		{
+			"notFound",
+			func(ctx context.Context, hid, fid uuid.UUID) (*store.FridgeIngredient, error) {
+				return nil, store.ErrNotFound
+			},
+			nil,
+			fid.String(),
+			OpenFridgeIngredient{UserUUID: testUserUUID, OpenedAt: at(1)},
+			time.Time{},
+			http.StatusNotFound,
+		},
+		{
+			"conflict:opened",
+			func(ctx context.Context, hid, fid uuid.UUID) (*store.FridgeIngredient, error) {
+				return &store.FridgeIngredient{FridgeItemUUID: fid, HouseholdUUID: hid, PurchasedDate: bought, ExpirationDate: *at(3), Location: "fridge", OpenedDate: at(0)}, nil
+			},
+			nil,
+			fid.String(),
+			OpenFridgeIngredient{UserUUID: testUserUUID, OpenedAt: at(1)},
+			time.Time{},
+			http.StatusConflict,
+		},
+		{
+			"internalServerError",
+			nil,
+			func(ctx context.Context, was, f store.FridgeIngredient, uid uuid.UUID, eventType string) (*store.FridgeIngredient, error) {
+				return nil, errors.New("internalServerError")
+			},
+			fid.String(),
+			OpenFridgeIngredient{UserUUID: testUserUUID, OpenedAt: at(1)},
+			time.Time{},
+			http.StatusInternalServerError,
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			reqBody, err := json.Marshal(testcase.requestBody)
+			assert.NoError(t, err, "unexpected error marshalling the request body")
+
+			req := httptest.NewRequest(http.MethodPost, "/fridge_ingredients/"+testcase.path+"/open", bytes.NewBuffer(reqBody))
+			w := httptest.NewRecorder()
+			authorize(t, req, testUserUUID)
+
+			var gotUser uuid.UUID
+			var gotEventType string
+			var gotWas store.FridgeIngredient
+
+			set := testcase.setFridgeIngredientStorageOverrideFunc
+			testServer.db = &mockstore.Mockstore{
+				GetFridgeIngredientOverride: testcase.getFridgeIngredientOverrideFunc,
+				SetFridgeIngredientStorageOverride: func(ctx context.Context, was, f store.FridgeIngredient, uid uuid.UUID, eventType string) (*store.FridgeIngredient, error) {
+					gotUser, gotEventType = uid, eventType
+					gotWas = was
+					if set != nil {
+						return set(ctx, was, f, uid, eventType)
+					}
+					return (&mockstore.Mockstore{}).SetFridgeIngredientStorage(ctx, was, f, uid, eventType)
+				},
+			}
+			testServer.r.ServeHTTP(w, req)
+
+			assert.Equal(t, testcase.expectedStatus, w.Code)
+
+			if testcase.expectedStatus != http.StatusOK {
+				assert.Equal(t, 0, w.Body.Len())
+				return
+			}
+
+			assert.Equal(t, testUserUUID, gotUser)
+			assert.Equal(t, store.FridgeEventTypeOpen, gotEventType)
+			assert.Nil(t, gotWas.OpenedDate, "the store compares the lot to how it was before it was opened")
+
+			var resBody FridgeIngredient
+
+			err = json.Unmarshal(w.Body.Bytes(), &resBody)
+			assert.NoError(t, err, "unexpected error unmarshalling the response body")
+			assert.True(t, testcase.expectedExpirationDate.Equal(resBody.ExpirationDate), "expiration date: %s", resBody.ExpirationDate)
+			if assert.NotNil(t, resBody.OpenedDate) {
+				assert.True(t, testcase.requestBody.OpenedAt.Equal(*resBody.OpenedDate))
+			}
+		})
+	}
+}
+
+func TestActiveHousehold(t *testing.T) {
+	otherHouseholdUUID := uuid.MustParse("7d0c2b9e-1a4f-4e8b-b3c6-5f9e0a1d2c3b")
+
+	noActive := func(ctx context.Context, uid uuid.UUID) (*store.HouseholdMembership, error) {
+		return nil, store.ErrNotFound
+	}
+
+	testcases := []struct {
+		name                      string
+		getActiveHouseholdFunc    func(ctx context.Context, uid uuid.UUID) (*store.HouseholdMembership, error)
+		ensureActiveHouseholdFunc func(ctx context.Context, uid uuid.UUID, name string) (*store.HouseholdMembership, error)
+		expectedHousehold         uuid.UUID
+		expectedEnsured           bool
+		expectedResponseStatus    int
+	}{
+		{"active", nil, nil, testHouseholdUUID, false, http.StatusOK},
+		{
+			"noActive", //the store picks the first household or makes one, under a lock
+			noActive,
+			func(ctx context.Context, uid uuid.UUID, name string) (*store.HouseholdMembership, error) {
+				return &store.HouseholdMembership{HouseholdUUID: otherHouseholdUUID, Role: store.HouseholdRoleMember, Active: true}, nil
+			},
+			otherHouseholdUUID,
+			true,
+			http.StatusOK,
+		},
+		{
+			"internalServerError",
+			func(ctx context.Context, uid uuid.UUID) (*store.HouseholdMembership, error) {
+				return nil, errors.New("internalServerError")
+			},
+			nil,
+			uuid.Nil,
+			false,
+			http.StatusInternalServerError,
+		},
+		{
+			"internalServerError:ensure",
+			noActive,
+			func(ctx context.Context, uid uuid.UUID, name string) (*store.HouseholdMembership, error) {
+				return nil, errors.New("internalServerError")
+			},
+			uuid.Nil,
+			true,
+			http.StatusInternalServerError,
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/users/"+testUserUUID.String()+"/fridge_ingredients", nil)
+			w := httptest.NewRecorder()
+			authorize(t, req, testUserUUID)
+
+			var listed uuid.UUID
+			var ensured bool
+			testServer.db = &mockstore.Mockstore{
+				GetActiveHouseholdOverride: testcase.getActiveHouseholdFunc,
+				EnsureActiveHouseholdOverride: func(ctx context.Context, uid uuid.UUID, name string) (*store.HouseholdMembership, error) {
+					assert.Equal(t, testUserUUID, uid)
+					assert.Equal(t, "jy's household", name) //if it has to make one
+					ensured = true
+					return testcase.ensureActiveHouseholdFunc(ctx, uid, name)
+				},
+				ListFridgeIngredientsOverride: func(ctx context.Context, hid uuid.UUID) ([]store.FridgeIngredient, error) {
+					listed = hid
+					return nil, nil
+				},
+			}
+			testServer.r.ServeHTTP(w, req)
+
+			assert.Equal(t, testcase.expectedResponseStatus, w.Code)
+			assert.Equal(t, testcase.expectedEnsured, ensured, "only users without an active household go through the lock")
+			if w.Code != http.StatusOK {
+				return
+			}
+
+			assert.Equal(t, testcase.expectedHousehold, listed)
+		})
+	}
+}
+
+// TestFridgeViewer checks viewers can look at the fridge but not change it.
+func TestFridgeViewer(t *testing.T) {
+	fridgeIngredient := FridgeIngredient{
+		FridgeItemUUID: uuid.MustParse("9b1f4c2e-6d3a-4f8b-a2c5-0e7d1b3f5a91"),
+		UserUUID:       testUserUUID,
+		IngredientUUID: uuid.MustParse("ffff7c73-52b0-4e3d-bf3f-0c26785ef972"),
+		Amount:         units.Whole(3),
+		Unit:           "kg",
+		PurchasedDate:  time.Now(),
+	}
+
+	newFridgeIngredient := fridgeIngredient
+	newFridgeIngredient.FridgeItemUUID = uuid.Nil
+
+	consumed := ConsumeFridgeIngredient{Amount: units.Whole(1), Unit: "kg"}
+
+	testcases := []struct {
+		name                   string
+		method                 string
+		path                   string
+		requestBody            interface{}
+		expectedResponseStatus int
+	}{
+		{"list", http.MethodGet, "/users/" + testUserUUID.String() + "/fridge_ingredients", nil, http.StatusOK},
+		{"suggest", http.MethodGet, "/users/" + testUserUUID.String() + "/suggestions", nil, http.StatusOK},
+		{"create", http.MethodPost, "/fridge_ingredients", &newFridgeIngredient, http.StatusForbidden},
+		{"update", http.MethodPost, "/fridge_ingredients/" + fridgeIngredient.FridgeItemUUID.String(), &fridgeIngredient, http.StatusForbidden},
+		{"delete", http.MethodDelete, "/users/" + testUserUUID.String() + "/fridge_ingredients/" + fridgeIngredient.FridgeItemUUID.String() + "?reason=expired", nil, http.StatusForbidden},
+		{"consume", http.MethodPost, "/users/" + testUserUUID.String() + "/ingredients/" + fridgeIngredient.IngredientUUID.String() + "/consume", &consumed, http.StatusForbidden},
+		{"move", http.MethodPost, "/fridge_ingredients/" + fridgeIngredient.FridgeItemUUID.String() + "/move", &MoveFridgeIngredient{UserUUID: testUserUUID, Location: "freezer"}, http.StatusForbidden},
+		{"open", http.MethodPost, "/fridge_ingredients/" + fridgeIngredient.FridgeItemUUID.String() + "/open", &OpenFridgeIngredient{UserUUID: testUserUUID}, http.StatusForbidden},
+		{"cook", http.MethodPost, "/recipes/" + fridgeIngredient.IngredientUUID.String() + "/cook", &CookRequest{UserUUID: testUserUUID}, http.StatusForbidden},
+		{"cook:dryRun", http.MethodPost, "/recipes/" + fridgeIngredient.IngredientUUID.String() + "/cook", &CookRequest{UserUUID: testUserUUID, DryRun: true}, http.StatusOK},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			var body bytes.Buffer
+			if testcase.requestBody != nil {
+				assert.NoError(t, json.NewEncoder(&body).Encode(testcase.requestBody))
+			}
+
+			req := httptest.NewRequest(testcase.method, testcase.path, &body)
+			w := httptest.NewRecorder()
+			authorize(t, req, testUserUUID)
+
+			changed := false
+			testServer.db = &mockstore.Mockstore{
+				GetActiveHouseholdOverride: func(ctx context.Context, uid uuid.UUID) (*store.HouseholdMembership, error) {
+					return &store.HouseholdMembership{HouseholdUUID: testHouseholdUUID, Role: store.HouseholdRoleViewer, Active: true}, nil
+				},
+				CreateFridgeIngredientOverride: func(ctx context.Context, f store.FridgeIngredient) (*store.FridgeIngredient, error) {
+					changed = true
+					return &f, nil
+				},
+				UpdateFridgeIngredientOverride: func(ctx context.Context, f store.FridgeIngredient) (*store.FridgeIngredient, error) {
+					changed = true
+					return &f, nil
+				},
+				DeleteFridgeIngredientOverride: func(ctx context.Context, e store.FridgeEvent) error {
+					changed = true
+					return nil
+				},
+				ConsumeFridgeIngredientOverride: func(ctx context.Context, hid, iid, uid uuid.UUID, amount units.Amount, unit string) ([]store.FridgeIngredient, error) {
+					changed = true
+					return nil, nil
+				},
+				SetFridgeIngredientStorageOverride: func(ctx context.Context, was, f store.FridgeIngredient, uid uuid.UUID, eventType string) (*store.FridgeIngredient, error) {
+					changed = true
+					return &f, nil
+				},
+				CookRecipeOverride: func(ctx context.Context, l store.CookLog, deductions []store.FridgeDeduction) (*store.CookLog, error) {
+					changed = true
+					return &l, nil
+				},
+			}
+			testServer.r.ServeHTTP(w, req)
+
+			assert.Equal(t, testcase.expectedResponseStatus, w.Code)
+			assert.False(t, changed)
+		})
+	}
+}
+
+func TestCreateHousehold(t *testing.T) {
+	testcases := []struct {
+		name                   string
+		createHouseholdFunc    func(ctx context.Context, h store.Household, owner uuid.UUID) (*store.Household, error)
+		requestBody            Household
+		expectedResponseStatus int
+	}{
+		{"happyPath", nil, Household{HouseholdName: "apartment 3b"}, http.StatusOK},
+		{"badRequest:noName", nil, Household{HouseholdName: "  "}, http.StatusBadRequest},
+		{"badRequest:tooLong", nil, Household{HouseholdName: strings.Repeat("a", 65)}, http.StatusBadRequest},
+		{"badRequest:uuid", nil, Household{HouseholdUUID: testHouseholdUUID, HouseholdName: "apartment 3b"}, http.StatusBadRequest},
+		{
+			"internalServerError",
+			func(ctx context.Context, h store.Household, owner uuid.UUID) (*store.Household, error) {
+				return nil, errors.New("internalServerError")
+			},
+			Household{HouseholdName: "apartment 3b"},
+			http.StatusInternalServerError,
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			reqBody, err := json.Marshal(testcase.requestBody)
+			assert.NoError(t, err, "unexpected error marshalling the request body")
+
+			req := httptest.NewRequest(http.MethodPost, "/households", bytes.NewBuffer(reqBody))
+			w := httptest.NewRecorder()
+			authorize(t, req, testUserUUID)
+
+			m := &mockstore.Mockstore{CreateHouseholdOverride: testcase.createHouseholdFunc}
+			if testcase.createHouseholdFunc == nil {
+				m.CreateHouseholdOverride = func(ctx context.Context, h store.Household, owner uuid.UUID) (*store.Household, error) {
+					assert.Equal(t, testUserUUID, owner)
+					return (&mockstore.Mockstore{}).CreateHousehold(ctx, h, owner)
+				}
+			}
+			testServer.db = m
+			testServer.r.ServeHTTP(w, req)
+
+			assert.Equal(t, testcase.expectedResponseStatus, w.Code)
+
+			if w.Code == http.StatusOK {
+				var resBody Household
+
+				err := json.Unmarshal(w.Body.Bytes(), &resBody)
+				assert.NoError(t, err, "unexpected error unmarshalling the response body")
+
+				assert.NotEqual(t, uuid.Nil, resBody.HouseholdUUID)
+				assert.Equal(t, testcase.requestBody.HouseholdName, resBody.HouseholdName)
+			}
+		})
+	}
+}
+
+func TestListHouseholds(t *testing.T) {
+	testcases := []struct {
+		name                   string
+		listHouseholdsFunc     func(ctx context.Context, uid uuid.UUID) ([]store.HouseholdMembership, error)
+		requestPath            string
+		expectedResponse       []HouseholdMembership
+		expectedResponseStatus int
+	}{
+		{
+			"happyPath",
+			nil,
+			"080b5f09-527b-4581-bb56-19adbfe50ebf",
+			[]HouseholdMembership{{HouseholdUUID: testHouseholdUUID, HouseholdName: "jy's household", Role: store.HouseholdRoleOwner, Active: true, JoinedAt: time.Date(2022, 12, 1, 0, 0, 0, 0, time.UTC)}},
+			http.StatusOK,
+		},
+		{"badRequest", nil, "potatoes", nil, http.StatusBadRequest},
+		{"forbidden", nil, "2c98fff4-7ccc-4536-8259-67a88380e99c", nil, http.StatusForbidden},
+		{
+			"internalServerError",
+			func(ctx context.Context, uid uuid.UUID) ([]store.HouseholdMembership, error) {
+				return nil, errors.New("internalServerError")
+			},
+			"080b5f09-527b-4581-bb56-19adbfe50ebf",
+			nil,
+			http.StatusInternalServerError,
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/users/"+testcase.requestPath+"/households", nil)
+			w := httptest.NewRecorder()
+			authorize(t, req, testUserUUID)
+
+			testServer.db = &mockstore.Mockstore{ListHouseholdsOverride: testcase.listHouseholdsFunc}
+			testServer.r.ServeHTTP(w, req)
+
+			assert.Equal(t, testcase.expectedResponseStatus, w.Code)
+
+			if testcase.expectedResponse != nil {
+				var resBody []HouseholdMembership
+
+				err := json.Unmarshal(w.Body.Bytes(), &resBody)
+				assert.NoError(t, err, "unexpected error unmarshalling the response body")
+
+				assert.Equal(t, testcase.expectedResponse, resBody)
+			} else {
+				assert.Equal(t, 0, w.Body.Len())
+			}
+		})
+	}
+}
+
+func TestGetHousehold(t *testing.T) {
+	testcases := []struct {
+		name                       string
+		getHouseholdFunc           func(ctx context.Context, id uuid.UUID) (*store.Household, error)
+		getHouseholdMembershipFunc func(ctx context.Context, hid, uid uuid.UUID) (*store.HouseholdMembership, error)
+		requestPath                string
+		expectedResponseStatus     int
+	}{
+		{"happyPath", nil, nil, testHouseholdUUID.String(), http.StatusOK},
+		{"badRequest", nil, nil, "potatoes", http.StatusBadRequest},
+		{
+			"notFound",
+			func(ctx context.Context, id uuid.UUID) (*store.Household, error) {
+				return nil, store.ErrNotFound
+			},
+			nil,
+			testHouseholdUUID.String(),
+			http.StatusNotFound,
+		},
+		{
+			"forbidden:notMember",
+			nil,
+			func(ctx context.Context, hid, uid uuid.UUID) (*store.HouseholdMembership, error) {
+				return nil, store.ErrNotFound
+			},
+			testHouseholdUUID.String(),
+			http.StatusForbidden,
+		},
+		{
+			"internalServerError",
+			func(ctx context.Context, id uuid.UUID) (*store.Household, error) {
+				return nil, errors.New("internalServerError")
+			},
+			nil,
+			testHouseholdUUID.String(),
+			http.StatusInternalServerError,
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/households/"+testcase.requestPath, nil)
+			w := httptest.NewRecorder()
+			authorize(t, req, testUserUUID)
+
+			testServer.db = &mockstore.Mockstore{
+				GetHouseholdOverride:           testcase.getHouseholdFunc,
+				GetHouseholdMembershipOverride: testcase.getHouseholdMembershipFunc,
+			}
+			testServer.r.ServeHTTP(w, req)
+
+			assert.Equal(t, testcase.expectedResponseStatus, w.Code)
+
+			if w.Code == http.StatusOK {
+				var resBody Household
+
+				err := json.Unmarshal(w.Body.Bytes(), &resBody)
+				assert.NoError(t, err, "unexpected error unmarshalling the response body")
+
+				assert.Equal(t, testHouseholdUUID, resBody.HouseholdUUID)
+				if assert.Len(t, resBody.Members, 2) {
+					assert.Equal(t, HouseholdMember{
+						UserUUID:     testUserUUID,
+						Role:         store.HouseholdRoleOwner,
+						FirstName:    "jy",
+						LastName:     "woo",
+						EmailAddress: "jywoo92324@gmail.com",
+						JoinedAt:     time.Date(2022, 12, 1, 0, 0, 0, 0, time.UTC),
+					}, resBody.Members[0])
+				}
+			}
+		})
+	}
+}
+
+func TestSetActiveHousehold(t *testing.T) {
+	testcases := []struct {
+		name                   string
+		setActiveHouseholdFunc func(ctx context.Context, uid, hid uuid.UUID) error
+		requestPath            string
+		requestBody            HouseholdMembership
+		expectedResponseStatus int
+	}{
+		{"happyPath", nil, "080b5f09-527b-4581-bb56-19adbfe50ebf", HouseholdMembership{HouseholdUUID: testHouseholdUUID}, http.StatusOK},
+		{"badRequest", nil, "080b5f09-527b-4581-bb56-19adbfe50ebf", HouseholdMembership{}, http.StatusBadRequest},
+		{"forbidden", nil, "2c98fff4-7ccc-4536-8259-67a88380e99c", HouseholdMembership{HouseholdUUID: testHouseholdUUID}, http.StatusForbidden},
+		{
+			"notFound:notMember",
+			func(ctx context.Context, uid, hid uuid.UUID) error {
+				return store.ErrNotFound
+			},
+			"080b5f09-527b-4581-bb56-19adbfe50ebf",
+			HouseholdMembership{HouseholdUUID: testHouseholdUUID},
+			http.StatusNotFound,
+		},
+		{
+			"internalServerError",
+			func(ctx context.Context, uid, hid uuid.UUID) error {
+				return errors.New("internalServerError")
+			},
+			"080b5f09-527b-4581-bb56-19adbfe50ebf",
+			HouseholdMembership{HouseholdUUID: testHouseholdUUID},
+			http.StatusInternalServerError,
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			reqBody, err := json.Marshal(testcase.requestBody)
+			assert.NoError(t, err, "unexpected error marshalling the request body")
+
+			req := httptest.NewRequest(http.MethodPost, "/users/"+testcase.requestPath+"/active_household", bytes.NewBuffer(reqBody))
+			w := httptest.NewRecorder()
+			authorize(t, req, testUserUUID)
+
+			testServer.db = &mockstore.Mockstore{SetActiveHouseholdOverride: testcase.setActiveHouseholdFunc}
+			testServer.r.ServeHTTP(w, req)
+
+			assert.Equal(t, testcase.expectedResponseStatus, w.Code)
+
+			if w.Code == http.StatusOK {
+				var resBody HouseholdMembership
+
+				err := json.Unmarshal(w.Body.Bytes(), &resBody)
+				assert.NoError(t, err, "unexpected error unmarshalling the response body")
+
+				assert.Equal(t, testHouseholdUUID, resBody.HouseholdUUID)
+				assert.True(t, resBody.Active)
+			}
+		})
+	}
+}
+
+// memberAs is a GetHouseholdMembershipOverride for the caller being in the household with role.
+func memberAs(role string) func(ctx context.Context, hid, uid uuid.UUID) (*store.HouseholdMembership, error) {
+	return func(ctx context.Context, hid, uid uuid.UUID) (*store.HouseholdMembership, error) {
+		return &store.HouseholdMembership{HouseholdUUID: hid, HouseholdName: "jy's household", Role: role}, nil
+	}
+}
+
+func TestCreateHouseholdInvitation(t *testing.T) {
+	pinClock(t)
+
+	testcases := []struct {
+		name                       string
+		getHouseholdMembershipFunc func(ctx context.Context, hid, uid uuid.UUID) (*store.HouseholdMembership, error)
+		sendOverrideFunc           func(ctx context.Context, m mailer.Message) error
+		requestBody                HouseholdInvitation
+		expectedResponseStatus     int
+	}{
+		{"happyPath", nil, nil, HouseholdInvitation{EmailAddress: "jiyoon@wdiet.test", Role: store.HouseholdRoleMember}, http.StatusOK},
+		{"happyPath:viewer", nil, nil, HouseholdInvitation{EmailAddress: "jiyoon@wdiet.test", Role: store.HouseholdRoleViewer}, http.StatusOK},
+		{"badRequest:owner", nil, nil, HouseholdInvitation{EmailAddress: "jiyoon@wdiet.test", Role: store.HouseholdRoleOwner}, http.StatusBadRequest},
+		{"badRequest:email", nil, nil, HouseholdInvitation{EmailAddress: "jiyoon", Role: store.HouseholdRoleMember}, http.StatusBadRequest},
+		{
+			"forbidden:member",
+			memberAs(store.HouseholdRoleMember),
+			nil,
+			HouseholdInvitation{EmailAddress: "jiyoon@wdiet.test", Role: store.HouseholdRoleMember},
+			http.StatusForbidden,
+		},
+		{
+			"forbidden:notMember",
+			func(ctx context.Context, hid, uid uuid.UUID) (*store.HouseholdMembership, error) {
+				return nil, store.ErrNotFound
+			},
+			nil,
+			HouseholdInvitation{EmailAddress: "jiyoon@wdiet.test", Role: store.HouseholdRoleMember},
+			http.StatusForbidden,
+		},
+		{
+			"internalServerError:mailer",
+			nil,
+			func(ctx context.Context, m mailer.Message) error {
+				return errors.New("internalServerError")
+			},
+			HouseholdInvitation{EmailAddress: "jiyoon@wdiet.test", Role: store.HouseholdRoleMember},
+			http.StatusInternalServerError,
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			reqBody, err := json.Marshal(testcase.requestBody)
+			assert.NoError(t, err, "unexpected error marshalling the request body")
+
+			req := httptest.NewRequest(http.MethodPost, "/households/"+testHouseholdUUID.String()+"/invitations", bytes.NewBuffer(reqBody))
+			w := httptest.NewRecorder()
+			authorize(t, req, testUserUUID)
+
+			var stored *store.HouseholdInvitation
+			testServer.db = &mockstore.Mockstore{
+				GetHouseholdMembershipOverride: testcase.getHouseholdMembershipFunc,
+				CreateHouseholdInvitationOverride: func(ctx context.Context, i store.HouseholdInvitation) (*store.HouseholdInvitation, error) {
+					stored = &i
+					return (&mockstore.Mockstore{}).CreateHouseholdInvitation(ctx, i)
+				},
+			}
+			sentBefore := len(testMailer.Sent())
+			testMailer.SendOverride = testcase.sendOverrideFunc
+			defer func() { testMailer.SendOverride = nil }()
+
+			testServer.r.ServeHTTP(w, req)
+
+			assert.Equal(t, testcase.expectedResponseStatus, w.Code)
+
+			sent := testMailer.Sent()[sentBefore:]
+			if w.Code != http.StatusOK {
+				assert.Empty(t, sent)
+				return
+			}
+
+			var resBody HouseholdInvitation
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resBody))
+			assert.Equal(t, testcase.requestBody.EmailAddress, resBody.EmailAddress)
+			assert.Equal(t, testcase.requestBody.Role, resBody.Role)
+			assert.Equal(t, testNow.Add(householdInvitationTTL), resBody.ExpiresAt)
+
+			if assert.NotNil(t, stored) && assert.Len(t, sent, 1) {
+				assert.Equal(t, testHouseholdUUID, stored.HouseholdUUID)
+				assert.Equal(t, testUserUUID, stored.InvitedBy)
+				assert.Equal(t, testcase.requestBody.EmailAddress, sent[0].To)
+				assert.Contains(t, sent[0].Body, `"jy's household"`)
+
+				token := strings.TrimPrefix(sent[0].Body[strings.Index(sent[0].Body, "?token="):], "?token=")
+				token = strings.Fields(token)[0]
+				assert.Equal(t, stored.HashedToken, hashToken(token)) //we mail the token, we only keep its hash
+				assert.NotContains(t, w.Body.String(), token)
+			}
+		})
+	}
+}
+
+func TestAcceptHouseholdInvitation(t *testing.T) {
+	testcases := []struct {
+		name                          string
+		acceptHouseholdInvitationFunc func(ctx context.Context, hashedToken string, uid uuid.UUID, email string) (*store.HouseholdMembership, error)
+		requestBody                   AcceptHouseholdInvitation
+		expectedResponseStatus        int
+	}{
+		{"happyPath", nil, AcceptHouseholdInvitation{Token: "invitation"}, http.StatusOK},
+		{"badRequest", nil, AcceptHouseholdInvitation{}, http.StatusBadRequest},
+		{
+			"badRequest:unknownToken",
+			func(ctx context.Context, hashedToken string, uid uuid.UUID, email string) (*store.HouseholdMembership, error) {
+				return nil, store.ErrNotFound
+			},
+			AcceptHouseholdInvitation{Token: "invitation"},
+			http.StatusBadRequest,
+		},
+		{
+			"conflict:alreadyMember",
+			func(ctx context.Context, hashedToken string, uid uuid.UUID, email string) (*store.HouseholdMembership, error) {
+				return nil, store.ErrConflict
+			},
+			AcceptHouseholdInvitation{Token: "invitation"},
+			http.StatusConflict,
+		},
+		{
+			"internalServerError",
+			func(ctx context.Context, hashedToken string, uid uuid.UUID, email string) (*store.HouseholdMembership, error) {
+				return nil, errors.New("internalServerError")
+			},
+			AcceptHouseholdInvitation{Token: "invitation"},
+			http.StatusInternalServerError,
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			reqBody, err := json.Marshal(testcase.requestBody)
+			assert.NoError(t, err, "unexpected error marshalling the request body")
+
+			req := httptest.NewRequest(http.MethodPost, "/household_invitations/accept", bytes.NewBuffer(reqBody))
+			w := httptest.NewRecorder()
+			authorize(t, req, testUserUUID)
+
+			m := &mockstore.Mockstore{AcceptHouseholdInvitationOverride: testcase.acceptHouseholdInvitationFunc}
+			if testcase.acceptHouseholdInvitationFunc == nil {
+				m.AcceptHouseholdInvitationOverride = func(ctx context.Context, hashedToken string, uid uuid.UUID, email string) (*store.HouseholdMembership, error) {
+					assert.Equal(t, hashToken("invitation"), hashedToken)
+					assert.Equal(t, testUserUUID, uid)
+					assert.Equal(t, "jywoo92324@gmail.com", email) //the account's address, the invitation has to be for it
+					return (&mockstore.Mockstore{}).AcceptHouseholdInvitation(ctx, hashedToken, uid, email)
+				}
+			}
+			testServer.db = m
+			testServer.r.ServeHTTP(w, req)
+
+			assert.Equal(t, testcase.expectedResponseStatus, w.Code)
+
+			if w.Code == http.StatusOK {
+				var resBody HouseholdMembership
+
+				err := json.Unmarshal(w.Body.Bytes(), &resBody)
+				assert.NoError(t, err, "unexpected error unmarshalling the response body")
+
+				assert.Equal(t, testHouseholdUUID, resBody.HouseholdUUID)
+				assert.Equal(t, store.HouseholdRoleMember, resBody.Role)
+				assert.True(t, resBody.Active)
+			}
+		})
+	}
+}
+
+func TestSetHouseholdMemberRole(t *testing.T) {
+	testcases := []struct {
+		name                       string
+		getHouseholdMembershipFunc func(ctx context.Context, hid, uid uuid.UUID) (*store.HouseholdMembership, error)
+		setHouseholdMemberRoleFunc func(ctx context.Context, hid, uid uuid.UUID, role string) (*store.HouseholdMember, error)
+		requestBody                UserRole
+		expectedResponseStatus     int
+	}{
+		{"happyPath", nil, nil, UserRole{Role: store.HouseholdRoleViewer}, http.StatusOK},
+		{"badRequest", nil, nil, UserRole{Role: store.RoleAdmin}, http.StatusBadRequest},
+		{"forbidden:member", memberAs(store.HouseholdRoleMember), nil, UserRole{Role: store.HouseholdRoleViewer}, http.StatusForbidden},
+		{
+			"notFound:notMember",
+			nil,
+			func(ctx context.Context, hid, uid uuid.UUID, role string) (*store.HouseholdMember, error) {
+				return nil, store.ErrNotFound
+			},
+			UserRole{Role: store.HouseholdRoleViewer},
+			http.StatusNotFound,
+		},
+		{
+			"conflict:lastOwner",
+			nil,
+			func(ctx context.Context, hid, uid uuid.UUID, role string) (*store.HouseholdMember, error) {
+				return nil, store.ErrConflict
+			},
+			UserRole{Role: store.HouseholdRoleViewer},
+			http.StatusConflict,
+		},
+		{
+			"internalServerError",
+			nil,
+			func(ctx context.Context, hid, uid uuid.UUID, role string) (*store.HouseholdMember, error) {
+				return nil, errors.New("internalServerError")
+			},
+			UserRole{Role: store.HouseholdRoleViewer},
+			http.StatusInternalServerError,
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			reqBody, err := json.Marshal(testcase.requestBody)
+			assert.NoError(t, err, "unexpected error marshalling the request body")
+
+			req := httptest.NewRequest(http.MethodPost, "/households/"+testHouseholdUUID.String()+"/members/"+testRecipeOwnerUUID.String()+"/role", bytes.NewBuffer(reqBody))
+			w := httptest.NewRecorder()
+			authorize(t, req, testUserUUID)
+
+			testServer.db = &mockstore.Mockstore{
+				GetHouseholdMembershipOverride: testcase.getHouseholdMembershipFunc,
+				SetHouseholdMemberRoleOverride: testcase.setHouseholdMemberRoleFunc,
+			}
+			testServer.r.ServeHTTP(w, req)
+
+			assert.Equal(t, testcase.expectedResponseStatus, w.Code)
+
+			if w.Code == http.StatusOK {
+				var resBody HouseholdMember
+
+				err := json.Unmarshal(w.Body.Bytes(), &resBody)
+				assert.NoError(t, err, "unexpected error unmarshalling the response body")
+
+				assert.Equal(t, testRecipeOwnerUUID, resBody.UserUUID)
+				assert.Equal(t, testcase.requestBody.Role, resBody.Role)
+			}
+		})
+	}
+}
+
+func TestRemoveHouseholdMember(t *testing.T) {
+	testcases := []struct {
+		name                       string
+		getHouseholdMembershipFunc func(ctx context.Context, hid, uid uuid.UUID) (*store.HouseholdMembership, error)
+		removeHouseholdMemberFunc  func(ctx context.Context, hid, uid uuid.UUID) error
+		requestPath                uuid.UUID //the member to remove
+		expectedResponseStatus     int
+	}{
+		{"happyPath:ownerRemoves", nil, nil, testRecipeOwnerUUID, http.StatusOK},
+		{"happyPath:memberLeaves", memberAs(store.HouseholdRoleMember), nil, testUserUUID, http.StatusOK},
+		{"happyPath:viewerLeaves", memberAs(store.HouseholdRoleViewer), nil, testUserUUID, http.StatusOK},
+		{"forbidden:memberRemoves", memberAs(store.HouseholdRoleMember), nil, testRecipeOwnerUUID, http.StatusForbidden},
+		{
+			"notFound",
+			nil,
+			func(ctx context.Context, hid, uid uuid.UUID) error {
+				return store.ErrNotFound
+			},
+			testRecipeOwnerUUID,
+			http.StatusNotFound,
+		},
+		{
+			"conflict:lastOwner",
+			nil,
+			func(ctx context.Context, hid, uid uuid.UUID) error {
+				return store.ErrConflict
+			},
+			testUserUUID,
+			http.StatusConflict,
+		},
+		{
+			"internalServerError",
+			nil,
+			func(ctx context.Context, hid, uid uuid.UUID) error {
+				return errors.New("internalServerError")
+			},
+			testRecipeOwnerUUID,
+			http.StatusInternalServerError,
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodDelete, "/households/"+testHouseholdUUID.String()+"/members/"+testcase.requestPath.String(), nil)
+			w := httptest.NewRecorder()
+			authorize(t, req, testUserUUID)
+
+			testServer.db = &mockstore.Mockstore{
+				GetHouseholdMembershipOverride: testcase.getHouseholdMembershipFunc,
+				RemoveHouseholdMemberOverride:  testcase.removeHouseholdMemberFunc,
+			}
+			testServer.r.ServeHTTP(w, req)
+
+			assert.Equal(t, testcase.expectedResponseStatus, w.Code)
+		})
+	}
+}
+
+func TestGetRecipe(t *testing.T) {
+	testcases := []struct {
+		name                  string
+		getRecipeOverrideFunc func(ctx context.Context, id uuid.UUID) (*store.Recipe, error)
+		requestBody           string
+		expectedResponse      *Recipe
+		expectedStatus        int
+	}{
+		{
+			"happyPath",
+			nil,
+			"080b5f09-527b-4581-bb56-19adbfe50ebf",
+			&Recipe{
+				RecipeUUID: uuid.MustParse("080b5f09-527b-4581-bb56-19adbfe50ebf"),
+				UserUUID:   uuid.MustParse("2c98fff4-7ccc-4536-8259-67a88380e99c"),
+				RecipeName: "kimchi fried rice",
+				Category:   "Korean",
+			},
+			http.StatusOK,
+		},
+		{
+			"badRequest",
+			nil,
+			"maerong",
+			nil,
+			http.StatusBadRequest,
+		},
+		{
+			"internalServerError",
+			func(ctx context.Context, id uuid.UUID) (*store.Recipe, error) {
+				return nil, errors.New("internalServerError")
+			},
+			"080b5f09-527b-4581-bb56-19adbfe50ebf",
+			nil,
+			http.StatusInternalServerError,
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/recipes/"+testcase.requestBody, nil)
+			w := httptest.NewRecorder()
+			authorize(t, req, testUserUUID)
+
+			testServer.db = &mockstore.Mockstore{GetRecipeOverride: testcase.getRecipeOverrideFunc}
+			testServer.r.ServeHTTP(w, req)
+
+			assert.Equal(t, testcase.expectedStatus, w.Code)
+
+			if testcase.expectedResponse != nil {
+				var resBody Recipe
+
+				err := json.Unmarshal(w.Body.Bytes(), &resBody)
+				assert.NoError(t, err, "unexpected error unmarshalling the response body")
+
+				assert.Equal(t, *testcase.expectedResponse, resBody)
+			} else {
+				assert.Equal(t, 0, w.Body.Len())
+			}
+		})
+	}
+}
+
+func TestListRecipes(t *testing.T) {
+	testcases := []struct {
+		name                    string
+		listRecipesOverrideFunc func(ctx context.Context, id uuid.UUID) ([]store.Recipe, error)
+		requestBody             string
+		expectedResponse        []Recipe
+		expectedStatus          int
+	}{
+		{
+			"happyPath",
+			nil,
+			"080b5f09-527b-4581-bb56-19adbfe50ebf",
+			[]Recipe{
+				{
+					RecipeUUID: uuid.MustParse("ffff7c73-52b0-4e3d-bf3f-0c26785ef972"),
+					UserUUID:   uuid.MustParse("080b5f09-527b-4581-bb56-19adbfe50ebf"),
+					RecipeName: "kimchi jeon",
+					Category:   "Korean",
+				},
+				{
+					RecipeUUID: uuid.MustParse("2c98fff4-7ccc-4536-8259-67a88380e99c"),
+					UserUUID:   uuid.MustParse("080b5f09-527b-4581-bb56-19adbfe50ebf"),
+					RecipeName: "kimchi mandu",
+					Category:   "Korean",
+				},
+			},
+			http.StatusOK,
+		},
+		{
+			"badRequest",
+			nil,
+			"babo",
+			nil,
+			http.StatusBadRequest,
+		},
+		{
+			"internalServerError",
+			func(ctx context.Context, id uuid.UUID) ([]store.Recipe, error) {
+				return nil, errors.New("internalServerError")
+			},
+			"080b5f09-527b-4581-bb56-19adbfe50ebf",
+			nil,
+			http.StatusInternalServerError,
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/users/"+testcase.requestBody+"/recipes", nil)
+			w := httptest.NewRecorder()
+			authorize(t, req, testUserUUID)
+
+			testServer.db = &mockstore.Mockstore{ListRecipesOverride: testcase.listRecipesOverrideFunc}
+			testServer.r.ServeHTTP(w, req)
+
+			assert.Equal(t, testcase.expectedStatus, w.Code)
+
+			if testcase.expectedResponse != nil {
+				var resBody []Recipe
+
+				err := json.Unmarshal(w.Body.Bytes(), &resBody)
+				assert.NoError(t, err, "unexpected error unmarshalling the response body")
+
+				assert.Equal(t, len(testcase.expectedResponse), len(resBody))
+
+				for i := range testcase.expectedResponse {
+					assert.Equal(t, testcase.expectedResponse[i], resBody[i])
+				}
+			} else {
+				assert.Equal(t, 0, w.Body.Len())
+			}
+		})
+	}
+}
+
+func TestSearchRecipes(t *testing.T) {
+	goodRecipe := SearchRecipes{
+		RecipeName: "salmon nigiri",
+	}
+
+	badRecipe := SearchRecipes{}
+
+	testcases := []struct {
+		name                      string
+		searchRecipesOverrideFunc func(ctx context.Context, r store.SearchRecipes) ([]store.Recipe, error)
+		requestBody               SearchRecipes
+		expectedResponse          []Recipe
+		expectedStatus            int
+	}{
+		{
+			"happyPath",
+			nil,
+			goodRecipe,
+			[]Recipe{
+				{
+					RecipeUUID: uuid.MustParse("ffff7c73-52b0-4e3d-bf3f-0c26785ef972"),
+					UserUUID:   uuid.MustParse("080b5f09-527b-4581-bb56-19adbfe50ebf"),
+					RecipeName: "salmon nigiri",
+					Category:   "Japanese",
+				},
+				{
+					RecipeUUID: uuid.MustParse("2c98fff4-7ccc-4536-8259-67a88380e99c"),
+					UserUUID:   uuid.MustParse("ebe96725-44ef-47ee-979f-8baf823d7283"),
+					RecipeName: "salmon nigiri",
+					Category:   "Japanese",
+				},
+			},
+			http.StatusOK,
+		},
+		{
+			"badRequest",
+			nil,
+			badRecipe,
+			nil,
+			http.StatusBadRequest,
+		},
+		{
+			"internalServerError",
+			func(ctx context.Context, r store.SearchRecipes) ([]store.Recipe, error) {
+				return nil, errors.New("internalServerError")
+			},
+			goodRecipe,
+			nil,
+			http.StatusInternalServerError,
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			reqBody, err := json.Marshal(testcase.requestBody)
+			assert.NoError(t, err, "unexpected error marshalling the request body")
+
+			req := httptest.NewRequest(http.MethodPost, "/recipes/search", bytes.NewBuffer(reqBody))
+			w := httptest.NewRecorder()
+			authorize(t, req, testUserUUID)
+
+			testServer.db = &mockstore.Mockstore{SearchRecipesOverride: testcase.searchRecipesOverrideFunc}
+			testServer.r.ServeHTTP(w, req)
+
+			assert.Equal(t, testcase.expectedStatus, w.Code)
+
+			if testcase.expectedResponse != nil {
+				var resBody []Recipe
+
+				err := json.Unmarshal(w.Body.Bytes(), &resBody)
+				assert.NoError(t, err, "unexpected error unmarshalling the response body")
+
+				assert.Equal(t, len(testcase.expectedResponse), len(resBody))
+
+				for i := range testcase.expectedResponse {
+					assert.Equal(t, testcase.expectedResponse[i], resBody[i])
+				}
+			} else {
+				assert.Equal(t, 0, w.Body.Len())
+			}
+		})
+	}
+}
+
+func TestCreateRecipe(t *testing.T) {
+	goodRecipe := Recipe{
+		UserUUID:   uuid.MustParse("2c98fff4-7ccc-4536-8259-67a88380e99c"),
+		RecipeName: "kimchi fried rice",
+		Category:   "Korean",
+		Ingredients: []RecipeIngredient{
+			{
+				IngredientUUID: uuid.MustParse("2c98fff4-7ccc-4536-8259-67a88380e99b"),
+				Amount:         units.Whole(1),
+				Unit:           "kg",
+			},
+			{
+				IngredientUUID: uuid.MustParse("2c98fff4-7ccc-4536-8259-67a88380e99b"),
+				Amount:         units.Whole(1),
+				Unit:           "unit",
+			},
+		},
+		Instructions: []RecipeInstruction{
+			{
+				StepNum:     1,
+				Instruction: "Chop kimchi, onion and pork belly",
+			},
+			{
+				StepNum:     2,
+				Instruction: "grill the pan and put some oil on it",
+			},
+		},
+	}
+
+	badRecipe := Recipe{
+		UserUUID:     uuid.MustParse("2c98fff4-7ccc-4536-8259-67a88380e99c"),
+		RecipeName:   "kimchi fried rice",
+		Category:     "",
+		Ingredients:  []RecipeIngredient{},
+		Instructions: []RecipeInstruction{},
+	}
+
+	otherRecipe := goodRecipe
+	otherRecipe.UserUUID = testUserUUID
+
+	unknownUnitRecipe := goodRecipe
+	unknownUnitRecipe.Ingredients = []RecipeIngredient{{IngredientUUID: goodRecipe.Ingredients[0].IngredientUUID, Amount: units.Whole(1), Unit: "handful"}}
+
+	zeroAmountRecipe := goodRecipe
+	zeroAmountRecipe.Ingredients = []RecipeIngredient{{IngredientUUID: goodRecipe.Ingredients[0].IngredientUUID, Unit: "kg"}}
+
+	negativeAmountRecipe := goodRecipe
+	negativeAmountRecipe.Ingredients = []RecipeIngredient{{IngredientUUID: goodRecipe.Ingredients[0].IngredientUUID, Amount: units.Whole(-1), Unit: "kg"}}
+
+	testcases := []struct {
+		name                     string
+		createRecipeOverrideFunc func(ctx context.Context, r store.Recipe) (*store.Recipe, error)
+		requestBody              Recipe
+		expectedReponse          *Recipe
+		expectedStatus           int
+	}{
+		{
+			"happyPath",
+			nil,
+			goodRecipe,
+			&goodRecipe, //RecipeUUID 필드가 핸들러에서 돌아오겠지만(w.Body()), 내가 여기서 expected response로 체크하고 싶은건 내맘대로 쓸 수 있다. RecipeUUID는 밑에서 그냥 uuid.Nil이 아닌지만 체크하고, 나머지 필드들만 값이 내가 예상한거랑 같은지 보는것!
+			http.StatusOK,
+		},
+		{
+			"badRequest",
+			nil,
+			badRecipe,
+			nil,
+			http.StatusBadRequest,
+		},
+		{
+			"badRequest:unit",
+			nil,
+			unknownUnitRecipe,
+			nil,
+			http.StatusBadRequest,
+		},
+		{
+			"badRequest:zeroAmount",
+			nil,
+			zeroAmountRecipe,
+			nil,
+			http.StatusBadRequest,
+		},
+		{
+			"badRequest:negativeAmount",
+			nil,
+			negativeAmountRecipe,
+			nil,
+			http.StatusBadRequest,
+		},
+		{
+			"forbidden",
+			nil,
+			otherRecipe,
+			nil,
+			http.StatusForbidden,
+		},
+		{
+			"internalServerError",
+			func(ctx context.Context, r store.Recipe) (*store.Recipe, error) {
+				return nil, errors.New("internalServerError")
+			},
+			goodRecipe,
+			nil,
+			http.StatusInternalServerError,
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			reqBody, err := json.Marshal(testcase.requestBody)
+			assert.NoError(t, err, "unexpected error marshalling the request body")
+
+			req := httptest.NewRequest(http.MethodPost, "/recipes", bytes.NewBuffer(reqBody))
+			w := httptest.NewRecorder()
+			authorize(t, req, testRecipeOwnerUUID)
+
+			testServer.db = &mockstore.Mockstore{CreateRecipeOverride: testcase.createRecipeOverrideFunc}
+			testServer.r.ServeHTTP(w, req)
+
+			assert.Equal(t, testcase.expectedStatus, w.Code)
+
+			if testcase.expectedReponse != nil {
+				var resBody Recipe
+
+				err := json.Unmarshal(w.Body.Bytes(), &resBody)
+				assert.NoError(t, err, "unexpected error unmarshalling the response body")
+
+				assert.NotEqual(t, resBody.RecipeUUID, uuid.Nil)
+				assert.Equal(t, testcase.expectedReponse.UserUUID, resBody.UserUUID)
+				assert.Equal(t, testcase.expectedReponse.RecipeName, resBody.RecipeName)
+				assert.Equal(t, testcase.expectedReponse.Category, resBody.Category)
+				assert.Equal(t, testcase.expectedReponse.Ingredients, resBody.Ingredients)
+				assert.Equal(t, testcase.expectedReponse.Instructions, resBody.Instructions)
+			} else {
+				assert.Equal(t, 0, w.Body.Len())
+			}
+		})
+	}
+}
+
+func TestUpdateRecipe(t *testing.T) {
+	goodRecipe := Recipe{
+		RecipeUUID: uuid.MustParse("2c98fff4-7ccc-4536-8259-67a88380e99d"),
+		UserUUID:   uuid.MustParse("2c98fff4-7ccc-4536-8259-67a88380e99c"),
+		RecipeName: "kimchi fried rice",
+		Category:   "Korean",
+		Ingredients: []RecipeIngredient{
+			{
+				IngredientUUID: uuid.MustParse("2c98fff4-7ccc-4536-8259-67a88380e99b"),
+				Amount:         units.Whole(1),
+				Unit:           "kg",
+			},
+			{
+				IngredientUUID: uuid.MustParse("2c98fff4-7ccc-4536-8259-67a88380e99b"),
+				Amount:         units.Whole(1),
+				Unit:           "pc",
+			},
+		},
+		Instructions: []RecipeInstruction{
+			{
+				StepNum:     1,
+				Instruction: "Chop kimchi, onion and pork belly",
+			},
+			{
+				StepNum:     2,
+				Instruction: "grill the pan and put some oil on it",
+			},
+		},
+	}
+
+	badRecipe := Recipe{
+		UserUUID:     uuid.MustParse("2c98fff4-7ccc-4536-8259-67a88380e99c"),
+		RecipeName:   "kimchi fried rice",
+		Category:     "",
+		Ingredients:  []RecipeIngredient{},
+		Instructions: []RecipeInstruction{},
+	}
+
+	otherRecipe := goodRecipe
+	otherRecipe.UserUUID = testUserUUID
+
+	unknownUnitRecipe := goodRecipe
+	unknownUnitRecipe.Ingredients = []RecipeIngredient{{IngredientUUID: goodRecipe.Ingredients[0].IngredientUUID, Amount: units.Whole(1), Unit: "handful"}}
+
+	zeroAmountRecipe := goodRecipe
+	zeroAmountRecipe.Ingredients = []RecipeIngredient{{IngredientUUID: goodRecipe.Ingredients[0].IngredientUUID, Unit: "kg"}}
+
+	negativeAmountRecipe := goodRecipe
+	negativeAmountRecipe.Ingredients = []RecipeIngredient{{IngredientUUID: goodRecipe.Ingredients[0].IngredientUUID, Amount: units.Whole(-1), Unit: "kg"}}
+
+	testcases := []struct {
+		name                     string
+		getRecipeOverrideFunc    func(ctx context.Context, id uuid.UUID) (*store.Recipe, error)
+		updateRecipeOverrideFunc func(ctx context.Context, r store.Recipe) (*store.Recipe, error)
+		requestBody              Recipe
+		expectedReponse          *Recipe
+		expectedStatus           int
+	}{
+		{
+			"happyPath",
+			nil,
+			nil,
+			goodRecipe,
+			&goodRecipe,
+			http.StatusOK,
+		},
+		{
+			"badRequest",
+			nil,
+			nil,
+			badRecipe,
+			nil,
+			http.StatusBadRequest,
+		},
+		{
+			"badRequest:unit",
+			nil,
+			nil,
+			unknownUnitRecipe,
+			nil,
+			http.StatusBadRequest,
+		},
+		{
+			"badRequest:zeroAmount",
+			nil,
+			nil,
+			zeroAmountRecipe,
+			nil,
+			http.StatusBadRequest,
+		},
+		{
+			"badRequest:negativeAmount",
+			nil,
+			nil,
+			negativeAmountRecipe,
+			nil,
+			http.StatusBadRequest,
+		},
+		{
+			"forbidden:handingOver",
+			nil,
+			nil,
+			otherRecipe,
+			nil,
+			http.StatusForbidden,
+		},
+		{
+			"forbidden:notTheOwner",
+			func(ctx context.Context, id uuid.UUID) (*store.Recipe, error) {
+				return &store.Recipe{RecipeUUID: id, UserUUID: testUserUUID}, nil
+			},
+			nil,
+			goodRecipe,
+			nil,
+			http.StatusForbidden,
+		},
+		{
+			"notFound",
+			func(ctx context.Context, id uuid.UUID) (*store.Recipe, error) {
+				return nil, store.ErrNotFound
+			},
+			nil,
+			goodRecipe,
+			nil,
+			http.StatusNotFound,
+		},
+		{
+			"internalServerError",
+			nil,
+			func(ctx context.Context, r store.Recipe) (*store.Recipe, error) {
+				return nil, errors.New("internalServerError")
+			},
+			goodRecipe,
+			nil,
+			http.StatusInternalServerError,
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			reqBody, err := json.Marshal(testcase.requestBody)
+			assert.NoError(t, err, "unexpected error marshalling the request body")
+
+			req := httptest.NewRequest(http.MethodPost, "/recipes/"+testcase.requestBody.RecipeUUID.String(), bytes.NewBuffer(reqBody))
+			w := httptest.NewRecorder()
+			authorize(t, req, testRecipeOwnerUUID)
+
+			testServer.db = &mockstore.Mockstore{
+				GetRecipeOverride:    testcase.getRecipeOverrideFunc,
+				UpdateRecipeOverride: testcase.updateRecipeOverrideFunc}
+			testServer.r.ServeHTTP(w, req)
+
+			assert.Equal(t, testcase.expectedStatus, w.Code)
+
+			if testcase.expectedReponse != nil {
+				var resBody Recipe
+
+				err := json.Unmarshal(w.Body.Bytes(), &resBody)
+				assert.NoError(t, err, "unexpected error unmarshalling the response body")
+
+				assert.Equal(t, *testcase.expectedReponse, resBody)
+			} else {
+				assert.Equal(t, 0, w.Body.Len())
+			}
+		})
+	}
+}
+
+func TestDeleteRecipe(t *testing.T) {
+	testcases := []struct {
+		name                     string
+		getRecipeOverrideFunc    func(ctx context.Context, id uuid.UUID) (*store.Recipe, error)
+		deleteRecipeOverrideFunc func(ctx context.Context, id uuid.UUID) error
+		requestBody              string
+		expectedStatus           int
+	}{
+		{
+			"happyPath",
+			nil,
+			nil,
+			"080b5f09-527b-4581-bb56-19adbfe50ebf",
+			http.StatusOK,
+		},
+		{
+			"badRequest",
+			nil,
+			nil,
+			"maerong",
+			http.StatusBadRequest,
+		},
+		{
+			"forbidden",
+			func(ctx context.Context, id uuid.UUID) (*store.Recipe, error) {
+				return &store.Recipe{RecipeUUID: id, UserUUID: testUserUUID}, nil
+			},
+			nil,
+			"080b5f09-527b-4581-bb56-19adbfe50ebf",
+			http.StatusForbidden,
+		},
+		{
+			"internalServerError",
+			nil,
+			func(ctx context.Context, id uuid.UUID) error {
+				return errors.New("internalServerError")
+			},
+			"080b5f09-527b-4581-bb56-19adbfe50ebf",
+			http.StatusInternalServerError,
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodDelete, "/recipes/"+testcase.requestBody, nil)
+			w := httptest.NewRecorder()
+			authorize(t, req, testRecipeOwnerUUID)
+
+			testServer.db = &mockstore.Mockstore{
+				GetRecipeOverride:    testcase.getRecipeOverrideFunc,
+				DeleteRecipeOverride: testcase.deleteRecipeOverrideFunc}
+			testServer.r.ServeHTTP(w, req)
+
+			assert.Equal(t, testcase.expectedStatus, w.Code)
+		})
+	}
+}
+
+func TestSuggestRecipes(t *testing.T) {
+	testcases := []struct {
+		name                       string
+		suggestRecipesOverrideFunc func(ctx context.Context, id uuid.UUID, q store.SuggestionQuery) ([]store.RecipeSuggestion, error)
+		requestBody                string
+		query                      string
+		expectedResponse           []RecipeSuggestion
+		expectedStatus             int
+	}{
+		{
+			"happyPath",
+			nil,
+			"080b5f09-527b-4581-bb56-19adbfe50ebf",
+			"",
+			[]RecipeSuggestion{
+				{
+					RecipeUUID: uuid.MustParse("ffff7c73-52b0-4e3d-bf3f-0c26785ef972"),
+					UserUUID:   uuid.MustParse("2c98fff4-7ccc-4536-8259-67a88380e99c"),
+					RecipeName: "kimchi jeon",
+					Category:   "Korean",
+					Coverage:   100,
+				},
+				{
+					RecipeUUID: uuid.MustParse("2c98fff4-7ccc-4536-8259-67a88380e99c"),
+					UserUUID:   uuid.MustParse("2c98fff4-7ccc-4536-8259-67a88380e99c"),
+					RecipeName: "kimchi mandu",
+					Category:   "Korean",
+					Coverage:   75,
+					MissingIngredients: []MissingIngredient{
+						{
+							IngredientUUID: uuid.MustParse("2c98fff4-7ccc-4536-8259-67a88380e99b"),
+							Amount:         units.Whole(4),
+							AmountShort:    units.Whole(2),
+							Unit:           "L",
+						},
+					},
+				},
+			},
+			http.StatusOK,
+		},
+		{
+			"happyPath:expiring",
+			func(ctx context.Context, id uuid.UUID, q store.SuggestionQuery) ([]store.RecipeSuggestion, error) {
+				suggestions, err := (&mockstore.Mockstore{}).SuggestRecipes(ctx, id, q)
+				suggestions[0].Score, suggestions[1].Score = 1, 1.5
+
+				return []store.RecipeSuggestion{suggestions[1], suggestions[0]}, err //the way the db ranks them
+			},
+			"080b5f09-527b-4581-bb56-19adbfe50ebf",
+			"?mode=expiring&within_days=3&coverage_weight=1&expiry_weight=1",
+			[]RecipeSuggestion{
+				{
+					RecipeUUID:   uuid.MustParse("2c98fff4-7ccc-4536-8259-67a88380e99c"),
+					UserUUID:     uuid.MustParse("2c98fff4-7ccc-4536-8259-67a88380e99c"),
+					RecipeName:   "kimchi mandu",
+					Category:     "Korean",
+					Coverage:     75,
+					Score:        1.5, //0.75 coverage + milk expiring in 1 of 3 days, (3+1-1)/(3+1) = 0.75
+					Explanations: []string{"uses milk (expires in 1 day)"},
+					MissingIngredients: []MissingIngredient{
+						{
+							IngredientUUID: uuid.MustParse("2c98fff4-7ccc-4536-8259-67a88380e99b"),
+							Amount:         units.Whole(4),
+							AmountShort:    units.Whole(2),
+							Unit:           "L",
+						},
+					},
+				},
+				{
+					RecipeUUID: uuid.MustParse("ffff7c73-52b0-4e3d-bf3f-0c26785ef972"),
+					UserUUID:   uuid.MustParse("2c98fff4-7ccc-4536-8259-67a88380e99c"),
+					RecipeName: "kimchi jeon",
+					Category:   "Korean",
+					Coverage:   100,
+					Score:      1, //kimchi expires in 10 days, so only coverage counts
+				},
+			},
+			http.StatusOK,
+		},
+		{
+			"happyPath:expiredLot",
+			func(ctx context.Context, id uuid.UUID, q store.SuggestionQuery) ([]store.RecipeSuggestion, error) {
+				milkUUID := uuid.MustParse("2c98fff4-7ccc-4536-8259-67a88380e99b")
+				teaUUID := uuid.MustParse("4d2b6f8e-0a3c-4e5d-b7f9-1c3e5a7b9d0f")
+				expired := time.Now().Add(-48 * time.Hour)
+				soon := time.Now().Add(24 * time.Hour)
+				later := time.Now().Add(10 * 24 * time.Hour)
+
+				return []store.RecipeSuggestion{
+					{
+						RecipeUUID: uuid.MustParse("ffff7c73-52b0-4e3d-bf3f-0c26785ef972"),
+						RecipeName: "milk pudding",
+						Coverage:   100,
+						Score:      1.75,
+						Ingredients: []store.SuggestionIngredient{
+							{IngredientUUID: milkUUID, IngredientName: "milk", Amount: units.Whole(1), Unit: "L", Available: []store.FridgeAmount{{Amount: units.Whole(1), Unit: "L", ExpirationDate: expired}, {Amount: units.Whole(1), Unit: "L", ExpirationDate: soon}}},
+						},
+					},
+					{
+						RecipeUUID: uuid.MustParse("2c98fff4-7ccc-4536-8259-67a88380e99c"),
+						RecipeName: "milk tea",
+						Coverage:   50,
+						Score:      0.5,
+						Ingredients: []store.SuggestionIngredient{
+							{IngredientUUID: milkUUID, IngredientName: "milk", Amount: units.Whole(1), Unit: "L", Available: []store.FridgeAmount{{Amount: units.Whole(2), Unit: "L", ExpirationDate: expired}}},
+							{IngredientUUID: teaUUID, IngredientName: "tea", Amount: units.Whole(2), Unit: "g", Available: []store.FridgeAmount{{Amount: units.Whole(5), Unit: "g", ExpirationDate: later}}},
+						},
+					},
+				}, nil
+			},
+			"080b5f09-527b-4581-bb56-19adbfe50ebf",
+			"?mode=expiring&within_days=3&coverage_weight=1&expiry_weight=1",
+			[]RecipeSuggestion{
+				{
+					RecipeUUID:   uuid.MustParse("ffff7c73-52b0-4e3d-bf3f-0c26785ef972"),
+					RecipeName:   "milk pudding",
+					Coverage:     100,
+					Score:        1.75,
+					Explanations: []string{"uses milk (expires in 1 day)"}, //the expired lot doesn't hide the one expiring tomorrow
+				},
+				{
+					RecipeUUID: uuid.MustParse("2c98fff4-7ccc-4536-8259-67a88380e99c"),
+					RecipeName: "milk tea",
+					Coverage:   50,
+					Score:      0.5, //only expired milk, nothing to explain
+					MissingIngredients: []MissingIngredient{
+						{IngredientUUID: uuid.MustParse("2c98fff4-7ccc-4536-8259-67a88380e99b"), Amount: units.Whole(1), AmountShort: units.Whole(1), Unit: "L"}, //2 L of it, but gone off
+					},
+				},
+			},
+			http.StatusOK,
+		},
+		{
+			"happyPath:units",
+			func(ctx context.Context, id uuid.UUID, q store.SuggestionQuery) ([]store.RecipeSuggestion, error) {
+				flourUUID := uuid.MustParse("5a1e3c7b-9d2f-4b6a-8e0c-2f4d6b8a0c1e")
+				sugarUUID := uuid.MustParse("6b2f4d8c-0e3a-4c7b-9f1d-3a5e7c9b1d2f")
+				eggUUID := uuid.MustParse("7c3a5e9d-1f4b-4d8c-a02e-4b6f8d0c2e3a")
+				good := time.Now().Add(7 * 24 * time.Hour)
+
+				return []store.RecipeSuggestion{ //ranked, like the db lists them
+					{
+						RecipeUUID: uuid.MustParse("2c98fff4-7ccc-4536-8259-67a88380e99c"),
+						RecipeName: "egg rolls",
+						Coverage:   100,
+						Ingredients: []store.SuggestionIngredient{
+							{IngredientUUID: eggUUID, Amount: units.Whole(1), Unit: "dozen", Available: []store.FridgeAmount{{Amount: units.Whole(6), Unit: "pc", ExpirationDate: good}, {Amount: units.Whole(6), Unit: "pcs", ExpirationDate: good}}},
+						},
+					},
+					{
+						RecipeUUID: uuid.MustParse("ffff7c73-52b0-4e3d-bf3f-0c26785ef972"),
+						RecipeName: "crepes",
+						Coverage:   50,
+						Ingredients: []store.SuggestionIngredient{
+							{IngredientUUID: flourUUID, Density: 0.5, Amount: units.Whole(2), Unit: "cup", Available: []store.FridgeAmount{{Amount: units.Whole(250), Unit: "g", ExpirationDate: good}}}, //2 cups are 236.6 g
+							{IngredientUUID: sugarUUID, Amount: units.Whole(1), Unit: "cup", Available: []store.FridgeAmount{{Amount: units.Whole(100), Unit: "g", ExpirationDate: good}}},               //no density, can't tell
+						},
+					},
+				}, nil
+			},
+			"080b5f09-527b-4581-bb56-19adbfe50ebf",
+			"",
+			[]RecipeSuggestion{
+				{
+					RecipeUUID: uuid.MustParse("2c98fff4-7ccc-4536-8259-67a88380e99c"),
+					RecipeName: "egg rolls",
+					Coverage:   100,
+				},
+				{
+					RecipeUUID: uuid.MustParse("ffff7c73-52b0-4e3d-bf3f-0c26785ef972"),
+					RecipeName: "crepes",
+					Coverage:   50,
+					MissingIngredients: []MissingIngredient{
+						{IngredientUUID: uuid.MustParse("6b2f4d8c-0e3a-4c7b-9f1d-3a5e7c9b1d2f"), Amount: units.Whole(1), AmountShort: units.Whole(1), Unit: "cup"},
+					},
+				},
+			},
+			http.StatusOK,
+		},
+		{
+			"happyPath:nothing",
+			func(ctx context.Context, id uuid.UUID, q store.SuggestionQuery) ([]store.RecipeSuggestion, error) {
+				return nil, nil
+			},
+			"080b5f09-527b-4581-bb56-19adbfe50ebf",
+			"",
+			nil,
+			http.StatusOK,
+		},
+		{
+			"badRequest",
+			nil,
+			"maerong",
+			"",
+			nil,
+			http.StatusBadRequest,
+		},
+		{
+			"forbidden",
+			nil,
+			"2c98fff4-7ccc-4536-8259-67a88380e99c",
+			"",
+			nil,
+			http.StatusForbidden,
+		},
+		{
+			"badRequest:mode",
+			nil,
+			"080b5f09-527b-4581-bb56-19adbfe50ebf",
+			"?mode=whatever",
+			nil,
+			http.StatusBadRequest,
+		},
+		{
+			"badRequest:weights",
 			nil,
-			goodFridgeIngredient,
-			&goodFridgeIngredient,
-			http.StatusOK,
+			"080b5f09-527b-4581-bb56-19adbfe50ebf",
+			"?mode=expiring&coverage_weight=0&expiry_weight=0",
+			nil,
+			http.StatusBadRequest,
 		},
 		{
-			"badRequest",
+			"badRequest:weightNaN",
 			nil,
-			badFridgeIngredient,
+			"080b5f09-527b-4581-bb56-19adbfe50ebf",
+			"?mode=expiring&coverage_weight=NaN",
+			nil,
+			http.StatusBadRequest,
+		},
+		{
+			"badRequest:weightInf",
+			nil,
+			"080b5f09-527b-4581-bb56-19adbfe50ebf",
+			"?mode=expiring&expiry_weight=Inf",
+			nil,
+			http.StatusBadRequest,
+		},
+		{
+			"badRequest:weightTooBig",
+			nil,
+			"080b5f09-527b-4581-bb56-19adbfe50ebf",
+			"?mode=expiring&coverage_weight=1e308",
+			nil,
+			http.StatusBadRequest,
+		},
+		{
+			"badRequest:limit",
+			nil,
+			"080b5f09-527b-4581-bb56-19adbfe50ebf",
+			"?limit=0",
+			nil,
+			http.StatusBadRequest,
+		},
+		{
+			"badRequest:limitTooBig",
+			nil,
+			"080b5f09-527b-4581-bb56-19adbfe50ebf",
+			"?limit=101",
 			nil,
 			http.StatusBadRequest,
 		},
 		{
 			"internalServerError",
-			func(ctx context.Context, f store.FridgeIngredient) (*store.FridgeIngredient, error) {
+			func(ctx context.Context, id uuid.UUID, q store.SuggestionQuery) ([]store.RecipeSuggestion, error) {
 				return nil, errors.New("internalServerError")
 			},
-			goodFridgeIngredient,
+			"080b5f09-527b-4581-bb56-19adbfe50ebf",
+			"",
 			nil,
 			http.StatusInternalServerError,
 		},
@@ -989,36 +7041,22 @@ func TestUpdateFridgeIngredient(t *testing.T) {
 
 	for _, testcase := range testcases {
 		t.Run(testcase.name, func(t *testing.T) {
-			reqBody, err := json.Marshal(testcase.requestBody)
-			assert.NoError(t, err, "unexpected error marshalling the request body")
-
-			req := httptest.NewRequest(http.MethodPost, "/fridge_ingredients/"+testcase.requestBody.UserUUID.String(), bytes.NewBuffer(reqBody))
+			req := httptest.NewRequest(http.MethodGet, "/users/"+testcase.requestBody+"/suggestions"+testcase.query, nil)
 			w := httptest.NewRecorder()
+			authorize(t, req, testUserUUID)
 
-			testServer.db = &mockstore.Mockstore{UpdateFridgeIngredientOverride: testcase.updateFridgeIngredientOverrideFunc}
+			testServer.db = &mockstore.Mockstore{SuggestRecipesOverride: testcase.suggestRecipesOverrideFunc}
 			testServer.r.ServeHTTP(w, req)
 
 			assert.Equal(t, testcase.expectedStatus, w.Code)
 
 			if testcase.expectedResponse != nil {
-				var resBody FridgeIngredient
+				var resBody []RecipeSuggestion
 
 				err := json.Unmarshal(w.Body.Bytes(), &resBody)
 				assert.NoError(t, err, "unexpected error unmarshalling the response body")
 
-				assert.Equal(t, testcase.expectedResponse.PurchasedDate.Year(), resBody.PurchasedDate.Year())
-				assert.Equal(t, testcase.expectedResponse.PurchasedDate.Month(), resBody.PurchasedDate.Month())
-				assert.Equal(t, testcase.expectedResponse.PurchasedDate.Day(), resBody.PurchasedDate.Day()) //이거 한줄로 줄이는 방법 없을까..
-
-				assert.Equal(t, testcase.expectedResponse.ExpirationDate.Year(), resBody.ExpirationDate.Year())
-				assert.Equal(t, testcase.expectedResponse.ExpirationDate.Month(), resBody.ExpirationDate.Month())
-				assert.Equal(t, testcase.expectedResponse.ExpirationDate.Day(), resBody.ExpirationDate.Day())
-
-				assert.Equal(t, testcase.expectedResponse.UserUUID, resBody.UserUUID)
-				assert.Equal(t, testcase.expectedResponse.IngredientUUID, resBody.IngredientUUID)
-				assert.Equal(t, testcase.expectedResponse.Amount, resBody.Amount)
-				assert.Equal(t, testcase.expectedResponse.Amount, resBody.Amount)
-				assert.Equal(t, testcase.expectedResponse.Unit, resBody.Unit)
+				assert.Equal(t, testcase.expectedResponse, resBody)
 			} else {
 				assert.Equal(t, 0, w.Body.Len())
 			}
@@ -1026,235 +7064,362 @@ func TestUpdateFridgeIngredient(t *testing.T) {
 	}
 }
 
-func TestDeleteFridgeIngredient(t *testing.T) {
+func TestSuggestRecipesQuery(t *testing.T) {
+	pinClock(t)
+
 	testcases := []struct {
-		name                               string
-		deleteFridgeIngredientOverrideFunc func(ctx context.Context, uid uuid.UUID, fid uuid.UUID) error
-		uid                                string
-		fid                                string
-		expectedStatus                     int
+		name          string
+		query         string
+		expectedQuery store.SuggestionQuery
 	}{
 		{
-			"happyPath",
-			nil,
-			"080b5f09-527b-4581-bb56-19adbfe50ebf",
-			"ffff7c73-52b0-4e3d-bf3f-0c26785ef972",
-			http.StatusOK,
+			"coverage",
+			"",
+			store.SuggestionQuery{Now: testNow, WithinDays: 3, CoverageWeight: 1, Limit: 20},
 		},
 		{
-			"badRequest",
-			nil,
-			"",
-			"",
-			http.StatusBadRequest,
+			"coverage:weightsIgnored",
+			"?coverage_weight=3&expiry_weight=2",
+			store.SuggestionQuery{Now: testNow, WithinDays: 3, CoverageWeight: 1, Limit: 20},
 		},
 		{
-			"internalServerError",
-			func(ctx context.Context, uid uuid.UUID, fid uuid.UUID) error {
-				return errors.New("internalServerError")
-			},
-			"080b5f09-527b-4581-bb56-19adbfe50ebf",
-			"ffff7c73-52b0-4e3d-bf3f-0c26785ef972",
-			http.StatusInternalServerError,
+			"expiring",
+			"?mode=expiring&within_days=5&coverage_weight=0.5&expiry_weight=2&limit=5",
+			store.SuggestionQuery{Now: testNow, WithinDays: 5, CoverageWeight: 0.5, ExpiryWeight: 2, Limit: 5},
 		},
 	}
 
 	for _, testcase := range testcases {
 		t.Run(testcase.name, func(t *testing.T) {
-			req := httptest.NewRequest(http.MethodDelete, "/users/"+testcase.uid+"/fridge_ingredients/"+testcase.fid, nil)
+			req := httptest.NewRequest(http.MethodGet, "/users/"+testUserUUID.String()+"/suggestions"+testcase.query, nil)
 			w := httptest.NewRecorder()
+			authorize(t, req, testUserUUID)
+
+			var gotQuery store.SuggestionQuery
 
-			testServer.db = &mockstore.Mockstore{DeleteFridgeIngredientOverride: testcase.deleteFridgeIngredientOverrideFunc}
+			testServer.db = &mockstore.Mockstore{
+				SuggestRecipesOverride: func(ctx context.Context, hid uuid.UUID, q store.SuggestionQuery) ([]store.RecipeSuggestion, error) {
+					gotQuery = q
+					return nil, nil
+				},
+			}
 			testServer.r.ServeHTTP(w, req)
 
-			assert.Equal(t, testcase.expectedStatus, w.Code)
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, testcase.expectedQuery, gotQuery) //the db ranks and cuts the list, so it has to get all of it
 		})
 	}
 }
 
-func TestGetRecipe(t *testing.T) {
+func TestCookRecipe(t *testing.T) {
+	kimchiUUID := uuid.MustParse("ffff7c73-52b0-4e3d-bf3f-0c26785ef972")
+	milkUUID := uuid.MustParse("2c98fff4-7ccc-4536-8259-67a88380e99c")
+
+	getRecipe := func(ctx context.Context, id uuid.UUID) (*store.Recipe, error) {
+		return &store.Recipe{
+			RecipeUUID: id,
+			UserUUID:   testRecipeOwnerUUID,
+			RecipeName: "kimchi jjigae",
+			Category:   "Korean",
+			Ingredients: []store.RecipeIngredient{
+				{RecipeUUID: id, IngredientUUID: kimchiUUID, Amount: units.Whole(500), Unit: "g"}, //the fridge has it in kg
+				{RecipeUUID: id, IngredientUUID: milkUUID, Amount: units.Whole(750), Unit: "ml"},  //and this in L
+			},
+		}, nil
+	}
+
 	testcases := []struct {
-		name                  string
-		getRecipeOverrideFunc func(ctx context.Context, id uuid.UUID) (*store.Recipe, error)
-		requestBody           string
-		expectedResponse      *Recipe
-		expectedStatus        int
+		name                   string
+		getRecipeOverrideFunc  func(ctx context.Context, id uuid.UUID) (*store.Recipe, error)
+		cookRecipeOverrideFunc func(ctx context.Context, l store.CookLog, deductions []store.FridgeDeduction) (*store.CookLog, error)
+		path                   string
+		requestBody            CookRequest
+		expectedDeductions     []CookDeduction
+		expectedShortfalls     []MissingIngredient
+		expectedCooked         bool
+		expectedStatus         int
 	}{
 		{
 			"happyPath",
+			getRecipe,
 			nil,
-			"080b5f09-527b-4581-bb56-19adbfe50ebf",
-			&Recipe{
-				RecipeUUID: uuid.MustParse("080b5f09-527b-4581-bb56-19adbfe50ebf"),
-				UserUUID:   uuid.MustParse("2c98fff4-7ccc-4536-8259-67a88380e99c"),
-				RecipeName: "kimchi fried rice",
-				Category:   "Korean",
+			"7f3e9a1c-5b2d-4e8f-a6c4-1d3b5f7e9a2c",
+			CookRequest{UserUUID: testUserUUID, Servings: 2},
+			[]CookDeduction{
+				{FridgeItemUUID: uuid.MustParse("9b1f4c2e-6d3a-4f8b-a2c5-0e7d1b3f5a91"), IngredientUUID: kimchiUUID, Amount: units.Whole(3), Unit: "kg", AmountLeft: units.Whole(2), UnitLeft: "kg"}, //the older lot first
+				{FridgeItemUUID: uuid.MustParse("c3d5e7f9-2a4b-4d6e-8f1a-3b5c7d9e1f20"), IngredientUUID: milkUUID, Amount: units.Whole(2), Unit: "L", AmountLeft: units.MustParseAmount("0.5"), UnitLeft: "L"},
 			},
+			nil,
+			true,
 			http.StatusOK,
 		},
 		{
-			"badRequest",
+			"happyPath:dryRun",
+			getRecipe,
+			nil,
+			"7f3e9a1c-5b2d-4e8f-a6c4-1d3b5f7e9a2c",
+			CookRequest{UserUUID: testUserUUID, Servings: 3, DryRun: true},
+			[]CookDeduction{
+				{FridgeItemUUID: uuid.MustParse("9b1f4c2e-6d3a-4f8b-a2c5-0e7d1b3f5a91"), IngredientUUID: kimchiUUID, Amount: units.Whole(3), Unit: "kg", AmountLeft: units.MustParseAmount("1.5"), UnitLeft: "kg"},
+				{FridgeItemUUID: uuid.MustParse("c3d5e7f9-2a4b-4d6e-8f1a-3b5c7d9e1f20"), IngredientUUID: milkUUID, Amount: units.Whole(2), Unit: "L", AmountLeft: units.Whole(0), UnitLeft: "L"},
+			},
+			[]MissingIngredient{{IngredientUUID: milkUUID, Amount: units.Whole(2250), AmountShort: units.Whole(250), Unit: "ml"}},
+			false,
+			http.StatusOK,
+		},
+		{
+			"conflict:shortfall",
+			getRecipe,
+			nil,
+			"7f3e9a1c-5b2d-4e8f-a6c4-1d3b5f7e9a2c",
+			CookRequest{UserUUID: testUserUUID, Servings: 3},
+			[]CookDeduction{
+				{FridgeItemUUID: uuid.MustParse("9b1f4c2e-6d3a-4f8b-a2c5-0e7d1b3f5a91"), IngredientUUID: kimchiUUID, Amount: units.Whole(3), Unit: "kg", AmountLeft: units.MustParseAmount("1.5"), UnitLeft: "kg"},
+				{FridgeItemUUID: uuid.MustParse("c3d5e7f9-2a4b-4d6e-8f1a-3b5c7d9e1f20"), IngredientUUID: milkUUID, Amount: units.Whole(2), Unit: "L", AmountLeft: units.Whole(0), UnitLeft: "L"},
+			},
+			[]MissingIngredient{{IngredientUUID: milkUUID, Amount: units.Whole(2250), AmountShort: units.Whole(250), Unit: "ml"}},
+			false,
+			http.StatusConflict,
+		},
+		{
+			"badRequest:path",
+			getRecipe,
 			nil,
 			"maerong",
+			CookRequest{UserUUID: testUserUUID},
+			nil,
 			nil,
+			false,
 			http.StatusBadRequest,
 		},
 		{
-			"internalServerError",
+			"badRequest:servings",
+			getRecipe,
+			nil,
+			"7f3e9a1c-5b2d-4e8f-a6c4-1d3b5f7e9a2c",
+			CookRequest{UserUUID: testUserUUID, Servings: -1},
+			nil,
+			nil,
+			false,
+			http.StatusBadRequest,
+		},
+		{
+			"forbidden",
+			getRecipe,
+			nil,
+			"7f3e9a1c-5b2d-4e8f-a6c4-1d3b5f7e9a2c",
+			CookRequest{UserUUID: testRecipeOwnerUUID},
+			nil,
+			nil,
+			false,
+			http.StatusForbidden,
+		},
+		{
+			"notFound",
 			func(ctx context.Context, id uuid.UUID) (*store.Recipe, error) {
+				return nil, store.ErrNotFound
+			},
+			nil,
+			"7f3e9a1c-5b2d-4e8f-a6c4-1d3b5f7e9a2c",
+			CookRequest{UserUUID: testUserUUID},
+			nil,
+			nil,
+			false,
+			http.StatusNotFound,
+		},
+		{
+			"conflict:fridgeChanged",
+			getRecipe,
+			func(ctx context.Context, l store.CookLog, deductions []store.FridgeDeduction) (*store.CookLog, error) {
+				return nil, store.ErrConflict
+			},
+			"7f3e9a1c-5b2d-4e8f-a6c4-1d3b5f7e9a2c",
+			CookRequest{UserUUID: testUserUUID},
+			nil,
+			nil,
+			false,
+			http.StatusConflict,
+		},
+		{
+			"internalServerError",
+			getRecipe,
+			func(ctx context.Context, l store.CookLog, deductions []store.FridgeDeduction) (*store.CookLog, error) {
 				return nil, errors.New("internalServerError")
 			},
-			"080b5f09-527b-4581-bb56-19adbfe50ebf",
+			"7f3e9a1c-5b2d-4e8f-a6c4-1d3b5f7e9a2c",
+			CookRequest{UserUUID: testUserUUID},
+			nil,
 			nil,
+			false,
 			http.StatusInternalServerError,
 		},
 	}
 
 	for _, testcase := range testcases {
 		t.Run(testcase.name, func(t *testing.T) {
-			req := httptest.NewRequest(http.MethodGet, "/recipes/"+testcase.requestBody, nil)
+			reqBody, err := json.Marshal(testcase.requestBody)
+			assert.NoError(t, err, "unexpected error marshalling the request body")
+
+			req := httptest.NewRequest(http.MethodPost, "/recipes/"+testcase.path+"/cook", bytes.NewBuffer(reqBody))
 			w := httptest.NewRecorder()
+			authorize(t, req, testUserUUID)
 
-			testServer.db = &mockstore.Mockstore{GetRecipeOverride: testcase.getRecipeOverrideFunc}
+			var cooked *store.CookLog
+			var deducted []store.FridgeDeduction
+
+			cook := testcase.cookRecipeOverrideFunc
+			testServer.db = &mockstore.Mockstore{
+				GetRecipeOverride: testcase.getRecipeOverrideFunc,
+				CookRecipeOverride: func(ctx context.Context, l store.CookLog, deductions []store.FridgeDeduction) (*store.CookLog, error) {
+					if cook != nil {
+						return cook(ctx, l, deductions)
+					}
+					cooked, deducted = &l, deductions
+					return (&mockstore.Mockstore{}).CookRecipe(ctx, l, deductions)
+				},
+			}
 			testServer.r.ServeHTTP(w, req)
 
 			assert.Equal(t, testcase.expectedStatus, w.Code)
 
-			if testcase.expectedResponse != nil {
-				var resBody Recipe
-
-				err := json.Unmarshal(w.Body.Bytes(), &resBody)
-				assert.NoError(t, err, "unexpected error unmarshalling the response body")
+			if !testcase.expectedCooked {
+				assert.Nil(t, cooked)
+			} else if assert.NotNil(t, cooked) {
+				assert.Equal(t, testHouseholdUUID, cooked.HouseholdUUID)
+				assert.Equal(t, testUserUUID, cooked.UserUUID)
+				assert.Equal(t, "kimchi jjigae", cooked.RecipeName)
+				assert.Equal(t, testcase.requestBody.Servings, cooked.Servings)
+				assert.Equal(t, apiDeductions2DBDeductions(testcase.expectedDeductions), deducted)
+			}
 
-				assert.Equal(t, *testcase.expectedResponse, resBody)
-			} else {
-				assert.Equal(t, 0, w.Body.Len())
+			if testcase.expectedDeductions == nil {
+				return
 			}
+
+			var resBody CookResult
+
+			err = json.Unmarshal(w.Body.Bytes(), &resBody)
+			assert.NoError(t, err, "unexpected error unmarshalling the response body")
+
+			assert.Equal(t, testcase.requestBody.DryRun, resBody.DryRun)
+			assert.Equal(t, testcase.expectedDeductions, resBody.Deductions)
+			assert.Equal(t, testcase.expectedShortfalls, resBody.Shortfalls)
+			assert.Equal(t, testcase.expectedCooked, resBody.CookLogUUID != uuid.Nil)
 		})
 	}
 }
 
-func TestListRecipes(t *testing.T) {
+func TestCookRecipeDensity(t *testing.T) {
+	flourUUID := uuid.MustParse("5a1e3c7b-9d2f-4b6a-8e0c-2f4d6b8a0c1e")
+	lotUUID := uuid.MustParse("8d4b6f0e-2a5c-4e9d-b13f-5c7a9e1d3f4b")
+
 	testcases := []struct {
-		name                    string
-		listRecipesOverrideFunc func(ctx context.Context, id uuid.UUID) ([]store.Recipe, error)
-		requestBody             string
-		expectedResponse        []Recipe
-		expectedStatus          int
+		name               string
+		density            float64
+		expectedDeductions []CookDeduction
+		expectedShortfalls []MissingIngredient
 	}{
 		{
 			"happyPath",
+			0.5, //a cup is 118.3 g
+			[]CookDeduction{{FridgeItemUUID: lotUUID, IngredientUUID: flourUUID, Amount: units.Whole(500), Unit: "g", AmountLeft: units.MustParseAmount("381.7059"), UnitLeft: "g"}},
 			nil,
-			"080b5f09-527b-4581-bb56-19adbfe50ebf",
-			[]Recipe{
-				{
-					RecipeUUID: uuid.MustParse("ffff7c73-52b0-4e3d-bf3f-0c26785ef972"),
-					UserUUID:   uuid.MustParse("080b5f09-527b-4581-bb56-19adbfe50ebf"),
-					RecipeName: "kimchi jeon",
-					Category:   "Korean",
-				},
-				{
-					RecipeUUID: uuid.MustParse("2c98fff4-7ccc-4536-8259-67a88380e99c"),
-					UserUUID:   uuid.MustParse("080b5f09-527b-4581-bb56-19adbfe50ebf"),
-					RecipeName: "kimchi mandu",
-					Category:   "Korean",
-				},
-			},
-			http.StatusOK,
-		},
-		{
-			"badRequest",
-			nil,
-			"babo",
-			nil,
-			http.StatusBadRequest,
 		},
 		{
-			"internalServerError",
-			func(ctx context.Context, id uuid.UUID) ([]store.Recipe, error) {
-				return nil, errors.New("internalServerError")
-			},
-			"080b5f09-527b-4581-bb56-19adbfe50ebf",
+			"noDensity", //grams don't go into cups then
+			0,
 			nil,
-			http.StatusInternalServerError,
+			[]MissingIngredient{{IngredientUUID: flourUUID, Amount: units.Whole(1), AmountShort: units.Whole(1), Unit: "cup"}},
 		},
 	}
 
 	for _, testcase := range testcases {
 		t.Run(testcase.name, func(t *testing.T) {
-			req := httptest.NewRequest(http.MethodGet, "/users/"+testcase.requestBody+"/recipes", nil)
+			reqBody, err := json.Marshal(CookRequest{UserUUID: testUserUUID, DryRun: true})
+			assert.NoError(t, err, "unexpected error marshalling the request body")
+
+			req := httptest.NewRequest(http.MethodPost, "/recipes/7f3e9a1c-5b2d-4e8f-a6c4-1d3b5f7e9a2c/cook", bytes.NewBuffer(reqBody))
 			w := httptest.NewRecorder()
+			authorize(t, req, testUserUUID)
 
-			testServer.db = &mockstore.Mockstore{ListRecipesOverride: testcase.listRecipesOverrideFunc}
+			testServer.db = &mockstore.Mockstore{
+				GetRecipeOverride: func(ctx context.Context, id uuid.UUID) (*store.Recipe, error) {
+					return &store.Recipe{
+						RecipeUUID:  id,
+						RecipeName:  "pancakes",
+						Ingredients: []store.RecipeIngredient{{RecipeUUID: id, IngredientUUID: flourUUID, Amount: units.Whole(1), Unit: "cup"}},
+					}, nil
+				},
+				ListFridgeIngredientsOverride: func(ctx context.Context, hid uuid.UUID) ([]store.FridgeIngredient, error) {
+					return []store.FridgeIngredient{{FridgeItemUUID: lotUUID, HouseholdUUID: hid, IngredientUUID: flourUUID, Amount: units.Whole(500), Unit: "g"}}, nil
+				},
+				GetIngredientOverride: func(ctx context.Context, id uuid.UUID) (*store.Ingredient, error) {
+					return &store.Ingredient{IngredientUUID: id, IngredientName: "flour", Density: testcase.density}, nil
+				},
+			}
 			testServer.r.ServeHTTP(w, req)
 
-			assert.Equal(t, testcase.expectedStatus, w.Code)
-
-			if testcase.expectedResponse != nil {
-				var resBody []Recipe
+			assert.Equal(t, http.StatusOK, w.Code)
 
-				err := json.Unmarshal(w.Body.Bytes(), &resBody)
-				assert.NoError(t, err, "unexpected error unmarshalling the response body")
+			var resBody CookResult
 
-				assert.Equal(t, len(testcase.expectedResponse), len(resBody))
+			err = json.Unmarshal(w.Body.Bytes(), &resBody)
+			assert.NoError(t, err, "unexpected error unmarshalling the response body")
 
-				for i := range testcase.expectedResponse {
-					assert.Equal(t, testcase.expectedResponse[i], resBody[i])
-				}
-			} else {
-				assert.Equal(t, 0, w.Body.Len())
-			}
+			assert.Equal(t, testcase.expectedDeductions, resBody.Deductions)
+			assert.Equal(t, testcase.expectedShortfalls, resBody.Shortfalls)
 		})
 	}
 }
 
-func TestSearchRecipes(t *testing.T) {
-	goodRecipe := SearchRecipes{
-		RecipeName: "salmon nigiri",
-	}
-
-	badRecipe := SearchRecipes{}
+func TestListExpiringFridgeIngredients(t *testing.T) {
+	pinClock(t)
 
-	testcases := []struct {
-		name                      string
-		searchRecipesOverrideFunc func(ctx context.Context, r store.SearchRecipes) ([]store.Recipe, error)
-		requestBody               SearchRecipes
-		expectedResponse          []Recipe
-		expectedStatus            int
-	}{
-		{
-			"happyPath",
-			nil,
-			goodRecipe,
-			[]Recipe{
-				{
-					RecipeUUID: uuid.MustParse("ffff7c73-52b0-4e3d-bf3f-0c26785ef972"),
-					UserUUID:   uuid.MustParse("080b5f09-527b-4581-bb56-19adbfe50ebf"),
-					RecipeName: "salmon nigiri",
-					Category:   "Japanese",
-				},
-				{
-					RecipeUUID: uuid.MustParse("2c98fff4-7ccc-4536-8259-67a88380e99c"),
-					UserUUID:   uuid.MustParse("ebe96725-44ef-47ee-979f-8baf823d7283"),
-					RecipeName: "salmon nigiri",
-					Category:   "Japanese",
-				},
-			},
-			http.StatusOK,
-		},
+	lot := func(name string, expiresIn time.Duration) store.FridgeIngredient {
+		return store.FridgeIngredient{FridgeItemUUID: uuid.NewSHA1(uuid.Nil, []byte(name)), HouseholdUUID: testHouseholdUUID, Amount: units.Whole(1), Unit: "kg", ExpirationDate: testNow.Add(expiresIn)}
+	}
+
+	lots := []store.FridgeIngredient{ //by ingredient, like the store lists them
+		lot("in5days", 5*24*time.Hour),
+		lot("goneOff", -24*time.Hour),
+		lot("tomorrow", 24*time.Hour),
+		lot("in10hours", 10*time.Hour),
+		lot("in3days", 3*24*time.Hour),
+	}
+
+	testcases := []struct {
+		name                              string
+		listFridgeIngredientsOverrideFunc func(ctx context.Context, id uuid.UUID) ([]store.FridgeIngredient, error)
+		path                              string
+		query                             string
+		expected                          []string
+		expectedStatus                    int
+	}{
+		{"happyPath", nil, testUserUUID.String(), "", []string{"goneOff", "in10hours", "tomorrow", "in3days"}, http.StatusOK},
+		{"happyPath:days", nil, testUserUUID.String(), "?within=7d", []string{"goneOff", "in10hours", "tomorrow", "in3days", "in5days"}, http.StatusOK},
+		{"happyPath:hours", nil, testUserUUID.String(), "?within=12h", []string{"goneOff", "in10hours"}, http.StatusOK},
 		{
-			"badRequest",
-			nil,
-			badRecipe,
+			"happyPath:nothing",
+			func(ctx context.Context, id uuid.UUID) ([]store.FridgeIngredient, error) {
+				return []store.FridgeIngredient{lot("in5days", 5*24*time.Hour)}, nil
+			},
+			testUserUUID.String(),
+			"",
 			nil,
-			http.StatusBadRequest,
+			http.StatusOK,
 		},
+		{"badRequest:path", nil, "maerong", "", nil, http.StatusBadRequest},
+		{"badRequest:within", nil, testUserUUID.String(), "?within=soon", nil, http.StatusBadRequest},
+		{"badRequest:zero", nil, testUserUUID.String(), "?within=0d", nil, http.StatusBadRequest},
+		{"badRequest:tooFar", nil, testUserUUID.String(), "?within=365d", nil, http.StatusBadRequest},
+		{"forbidden", nil, testRecipeOwnerUUID.String(), "", nil, http.StatusForbidden},
 		{
 			"internalServerError",
-			func(ctx context.Context, r store.SearchRecipes) ([]store.Recipe, error) {
+			func(ctx context.Context, id uuid.UUID) ([]store.FridgeIngredient, error) {
 				return nil, errors.New("internalServerError")
 			},
-			goodRecipe,
+			testUserUUID.String(),
+			"",
 			nil,
 			http.StatusInternalServerError,
 		},
@@ -1262,99 +7427,77 @@ func TestSearchRecipes(t *testing.T) {
 
 	for _, testcase := range testcases {
 		t.Run(testcase.name, func(t *testing.T) {
-			reqBody, err := json.Marshal(testcase.requestBody)
-			assert.NoError(t, err, "unexpected error marshalling the request body")
-
-			req := httptest.NewRequest(http.MethodPost, "/recipes/search", bytes.NewBuffer(reqBody))
+			req := httptest.NewRequest(http.MethodGet, "/users/"+testcase.path+"/fridge_ingredients/expiring"+testcase.query, nil)
 			w := httptest.NewRecorder()
+			authorize(t, req, testUserUUID)
 
-			testServer.db = &mockstore.Mockstore{SearchRecipesOverride: testcase.searchRecipesOverrideFunc}
+			list := testcase.listFridgeIngredientsOverrideFunc
+			if list == nil {
+				list = func(ctx context.Context, id uuid.UUID) ([]store.FridgeIngredient, error) {
+					return lots, nil
+				}
+			}
+
+			testServer.db = &mockstore.Mockstore{ListFridgeIngredientsOverride: list}
 			testServer.r.ServeHTTP(w, req)
 
 			assert.Equal(t, testcase.expectedStatus, w.Code)
 
-			if testcase.expectedResponse != nil {
-				var resBody []Recipe
+			if testcase.expected == nil {
+				assert.Equal(t, 0, w.Body.Len())
+				return
+			}
 
-				err := json.Unmarshal(w.Body.Bytes(), &resBody)
-				assert.NoError(t, err, "unexpected error unmarshalling the response body")
+			var resBody []FridgeIngredient
 
-				assert.Equal(t, len(testcase.expectedResponse), len(resBody))
+			err := json.Unmarshal(w.Body.Bytes(), &resBody)
+			assert.NoError(t, err, "unexpected error unmarshalling the response body")
 
-				for i := range testcase.expectedResponse {
-					assert.Equal(t, testcase.expectedResponse[i], resBody[i])
+			var got []string
+			for _, f := range resBody {
+				for _, name := range []string{"in5days", "goneOff", "tomorrow", "in10hours", "in3days"} {
+					if f.FridgeItemUUID == uuid.NewSHA1(uuid.Nil, []byte(name)) {
+						got = append(got, name)
+					}
 				}
-			} else {
-				assert.Equal(t, 0, w.Body.Len())
 			}
+			assert.Equal(t, testcase.expected, got)
 		})
 	}
 }
 
-func TestCreateRecipe(t *testing.T) {
-	goodRecipe := Recipe{
-		UserUUID:   uuid.MustParse("2c98fff4-7ccc-4536-8259-67a88380e99c"),
-		RecipeName: "kimchi fried rice",
-		Category:   "Korean",
-		Ingredients: []RecipeIngredient{
-			{
-				IngredientUUID: uuid.MustParse("2c98fff4-7ccc-4536-8259-67a88380e99b"),
-				Amount:         1,
-				Unit:           "kg",
-			},
-			{
-				IngredientUUID: uuid.MustParse("2c98fff4-7ccc-4536-8259-67a88380e99b"),
-				Amount:         1,
-				Unit:           "unit",
-			},
-		},
-		Instructions: []RecipeInstruction{
-			{
-				StepNum:     1,
-				Instruction: "Chop kimchi, onion and pork belly",
-			},
-			{
-				StepNum:     2,
-				Instruction: "grill the pan and put some oil on it",
-			},
-		},
-	}
-
-	badRecipe := Recipe{
-		UserUUID:     uuid.MustParse("2c98fff4-7ccc-4536-8259-67a88380e99c"),
-		RecipeName:   "kimchi fried rice",
-		Category:     "",
-		Ingredients:  []RecipeIngredient{},
-		Instructions: []RecipeInstruction{},
-	}
-
+func TestGetDigestSettings(t *testing.T) {
 	testcases := []struct {
-		name                     string
-		createRecipeOverrideFunc func(ctx context.Context, r store.Recipe) (*store.Recipe, error)
-		requestBody              Recipe
-		expectedReponse          *Recipe
-		expectedStatus           int
+		name                          string
+		getDigestSettingsOverrideFunc func(ctx context.Context, uid uuid.UUID) (*store.DigestSettings, error)
+		path                          string
+		expectedResponse              *DigestSettings
+		expectedStatus                int
 	}{
 		{
 			"happyPath",
 			nil,
-			goodRecipe,
-			&goodRecipe, //RecipeUUID 필드가 핸들러에서 돌아오겠지만(w.Body()), 내가 여기서 expected response로 체크하고 싶은건 내맘대로 쓸 수 있다. RecipeUUID는 밑에서 그냥 uuid.Nil이 아닌지만 체크하고, 나머지 필드들만 값이 내가 예상한거랑 같은지 보는것!
+			testUserUUID.String(),
+			&DigestSettings{UserUUID: testUserUUID, Enabled: true, Time: "08:00", Timezone: "Asia/Seoul", Channel: "email", WithinDays: 3},
 			http.StatusOK,
 		},
 		{
-			"badRequest",
-			nil,
-			badRecipe,
-			nil,
-			http.StatusBadRequest,
+			"happyPath:neverSet",
+			func(ctx context.Context, uid uuid.UUID) (*store.DigestSettings, error) {
+				return nil, store.ErrNotFound
+			},
+			testUserUUID.String(),
+			&DigestSettings{UserUUID: testUserUUID, Enabled: false, Time: "08:00", Timezone: "UTC", Channel: "email", WithinDays: 3},
+			http.StatusOK,
 		},
+		{"badRequest", nil, "maerong", nil, http.StatusBadRequest},
+		{"forbidden", nil, testRecipeOwnerUUID.String(), nil, http.StatusForbidden},
 		{
 			"internalServerError",
-			func(ctx context.Context, r store.Recipe) (*store.Recipe, error) {
+			func(ctx context.Context, uid uuid.UUID) (*store.DigestSettings, error) {
 				return nil, errors.New("internalServerError")
 			},
-			goodRecipe,
+			testUserUUID.String(),
 			nil,
 			http.StatusInternalServerError,
 		},
@@ -1362,29 +7505,21 @@ func TestCreateRecipe(t *testing.T) {
 
 	for _, testcase := range testcases {
 		t.Run(testcase.name, func(t *testing.T) {
-			reqBody, err := json.Marshal(testcase.requestBody)
-			assert.NoError(t, err, "unexpected error marshalling the request body")
-
-			req := httptest.NewRequest(http.MethodPost, "/recipes", bytes.NewBuffer(reqBody))
+			req := httptest.NewRequest(http.MethodGet, "/users/"+testcase.path+"/digest_settings", nil)
 			w := httptest.NewRecorder()
+			authorize(t, req, testUserUUID)
 
-			testServer.db = &mockstore.Mockstore{CreateRecipeOverride: testcase.createRecipeOverrideFunc}
+			testServer.db = &mockstore.Mockstore{GetDigestSettingsOverride: testcase.getDigestSettingsOverrideFunc}
 			testServer.r.ServeHTTP(w, req)
 
 			assert.Equal(t, testcase.expectedStatus, w.Code)
 
-			if testcase.expectedReponse != nil {
-				var resBody Recipe
+			if testcase.expectedResponse != nil {
+				var resBody DigestSettings
 
 				err := json.Unmarshal(w.Body.Bytes(), &resBody)
 				assert.NoError(t, err, "unexpected error unmarshalling the response body")
-
-				assert.NotEqual(t, resBody.RecipeUUID, uuid.Nil)
-				assert.Equal(t, testcase.expectedReponse.UserUUID, resBody.UserUUID)
-				assert.Equal(t, testcase.expectedReponse.RecipeName, resBody.RecipeName)
-				assert.Equal(t, testcase.expectedReponse.Category, resBody.Category)
-				assert.Equal(t, testcase.expectedReponse.Ingredients, resBody.Ingredients)
-				assert.Equal(t, testcase.expectedReponse.Instructions, resBody.Instructions)
+				assert.Equal(t, *testcase.expectedResponse, resBody)
 			} else {
 				assert.Equal(t, 0, w.Body.Len())
 			}
@@ -1392,74 +7527,40 @@ func TestCreateRecipe(t *testing.T) {
 	}
 }
 
-func TestUpdateRecipe(t *testing.T) {
-	goodRecipe := Recipe{
-		RecipeUUID: uuid.MustParse("2c98fff4-7ccc-4536-8259-67a88380e99d"),
-		UserUUID:   uuid.MustParse("2c98fff4-7ccc-4536-8259-67a88380e99c"),
-		RecipeName: "kimchi fried rice",
-		Category:   "Korean",
-		Ingredients: []RecipeIngredient{
-			{
-				IngredientUUID: uuid.MustParse("2c98fff4-7ccc-4536-8259-67a88380e99b"),
-				Amount:         1,
-				Unit:           "kg",
-			},
-			{
-				IngredientUUID: uuid.MustParse("2c98fff4-7ccc-4536-8259-67a88380e99b"),
-				Amount:         1,
-				Unit:           "unit",
-			},
-		},
-		Instructions: []RecipeInstruction{
-			{
-				StepNum:     1,
-				Instruction: "Chop kimchi, onion and pork belly",
-			},
-			{
-				StepNum:     2,
-				Instruction: "grill the pan and put some oil on it",
-			},
-		},
-	}
-
-	badRecipe := Recipe{
-		UserUUID:     uuid.MustParse("2c98fff4-7ccc-4536-8259-67a88380e99c"),
-		RecipeName:   "kimchi fried rice",
-		Category:     "",
-		Ingredients:  []RecipeIngredient{},
-		Instructions: []RecipeInstruction{},
-	}
-
+func TestSetDigestSettings(t *testing.T) {
 	testcases := []struct {
-		name                     string
-		updateRecipeOverrideFunc func(ctx context.Context, r store.Recipe) (*store.Recipe, error)
-		requestBody              Recipe
-		expectedReponse          *Recipe
-		expectedStatus           int
+		name             string
+		requestBody      DigestSettings
+		expectedSettings *store.DigestSettings
+		expectedStatus   int
 	}{
 		{
 			"happyPath",
-			nil,
-			goodRecipe,
-			&goodRecipe,
+			DigestSettings{UserUUID: testUserUUID, Enabled: true, Time: "07:30", Timezone: "Asia/Seoul", Channel: "email", WithinDays: 2},
+			&store.DigestSettings{UserUUID: testUserUUID, Enabled: true, Minute: 7*60 + 30, Timezone: "Asia/Seoul", Channel: "email", WithinDays: 2},
 			http.StatusOK,
 		},
 		{
-			"badRequest",
-			nil,
-			badRecipe,
-			nil,
-			http.StatusBadRequest,
+			"happyPath:defaults",
+			DigestSettings{UserUUID: testUserUUID, Enabled: true},
+			&store.DigestSettings{UserUUID: testUserUUID, Enabled: true, Minute: 8 * 60, Timezone: "UTC", Channel: "email", WithinDays: 3},
+			http.StatusOK,
 		},
 		{
-			"internalServerError",
-			func(ctx context.Context, r store.Recipe) (*store.Recipe, error) {
-				return nil, errors.New("internalServerError")
-			},
-			goodRecipe,
-			nil,
-			http.StatusInternalServerError,
+			"happyPath:webhook",
+			DigestSettings{UserUUID: testUserUUID, Enabled: true, Channel: "webhook", WebhookURL: "https://hooks.example.com/wdiet"},
+			&store.DigestSettings{UserUUID: testUserUUID, Enabled: true, Minute: 8 * 60, Timezone: "UTC", Channel: "webhook", WebhookURL: "https://hooks.example.com/wdiet", WithinDays: 3},
+			http.StatusOK,
 		},
+		{"badRequest:userUUID", DigestSettings{UserUUID: testRecipeOwnerUUID, Enabled: true}, nil, http.StatusBadRequest},
+		{"badRequest:time", DigestSettings{UserUUID: testUserUUID, Time: "25:00"}, nil, http.StatusBadRequest},
+		{"badRequest:timezone", DigestSettings{UserUUID: testUserUUID, Timezone: "Mars/Olympus_Mons"}, nil, http.StatusBadRequest},
+		{"badRequest:local", DigestSettings{UserUUID: testUserUUID, Timezone: "Local"}, nil, http.StatusBadRequest},
+		{"badRequest:withinDays", DigestSettings{UserUUID: testUserUUID, WithinDays: 31}, nil, http.StatusBadRequest},
+		{"badRequest:channel", DigestSettings{UserUUID: testUserUUID, Channel: "carrier pigeon"}, nil, http.StatusBadRequest},
+		{"badRequest:webhookHTTP", DigestSettings{UserUUID: testUserUUID, Channel: "webhook", WebhookURL: "http://hooks.example.com/wdiet"}, nil, http.StatusBadRequest},
+		{"badRequest:webhookMissing", DigestSettings{UserUUID: testUserUUID, Channel: "webhook"}, nil, http.StatusBadRequest},
+		{"badRequest:webhookForEmail", DigestSettings{UserUUID: testUserUUID, WebhookURL: "https://hooks.example.com/wdiet"}, nil, http.StatusBadRequest},
 	}
 
 	for _, testcase := range testcases {
@@ -1467,66 +7568,285 @@ func TestUpdateRecipe(t *testing.T) {
 			reqBody, err := json.Marshal(testcase.requestBody)
 			assert.NoError(t, err, "unexpected error marshalling the request body")
 
-			req := httptest.NewRequest(http.MethodPost, "/recipes/"+testcase.requestBody.RecipeUUID.String(), bytes.NewBuffer(reqBody))
+			req := httptest.NewRequest(http.MethodPost, "/users/"+testUserUUID.String()+"/digest_settings", bytes.NewBuffer(reqBody))
 			w := httptest.NewRecorder()
+			authorize(t, req, testUserUUID)
 
-			testServer.db = &mockstore.Mockstore{UpdateRecipeOverride: testcase.updateRecipeOverrideFunc}
+			var got *store.DigestSettings
+			testServer.db = &mockstore.Mockstore{
+				SetDigestSettingsOverride: func(ctx context.Context, d store.DigestSettings) (*store.DigestSettings, error) {
+					got = &d
+					return &d, nil
+				},
+			}
 			testServer.r.ServeHTTP(w, req)
 
 			assert.Equal(t, testcase.expectedStatus, w.Code)
+			assert.Equal(t, testcase.expectedSettings, got)
 
-			if testcase.expectedReponse != nil {
-				var resBody Recipe
+			if testcase.expectedSettings != nil {
+				var resBody DigestSettings
 
 				err := json.Unmarshal(w.Body.Bytes(), &resBody)
 				assert.NoError(t, err, "unexpected error unmarshalling the response body")
-
-				assert.Equal(t, *testcase.expectedReponse, resBody)
+				assert.Equal(t, dbDigest2ApiDigest(testcase.expectedSettings), resBody)
 			} else {
 				assert.Equal(t, 0, w.Body.Len())
 			}
 		})
 	}
+
+	req := httptest.NewRequest(http.MethodPost, "/users/"+testRecipeOwnerUUID.String()+"/digest_settings", strings.NewReader(`{"user_uuid": "`+testRecipeOwnerUUID.String()+`"}`))
+	w := httptest.NewRecorder()
+	authorize(t, req, testUserUUID)
+
+	testServer.db = &mockstore.Mockstore{}
+	testServer.r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
 }
 
-func TestDeleteRecipe(t *testing.T) {
+func TestDigestDue(t *testing.T) {
+	sentOn := func(y int, m time.Month, d int) *time.Time {
+		day := time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+		return &day
+	}
+
 	testcases := []struct {
-		name                     string
-		deleteRecipeOverrideFunc func(ctx context.Context, id uuid.UUID) error
-		requestBody              string
-		expectedStatus           int
+		name        string
+		settings    store.DigestSettings
+		now         time.Time
+		expectedDay time.Time
+		expectedDue bool
+	}{
+		{"due", store.DigestSettings{Minute: 8 * 60, Timezone: "UTC"}, time.Date(2023, time.March, 24, 8, 0, 0, 0, time.UTC), time.Date(2023, time.March, 24, 0, 0, 0, 0, time.UTC), true},
+		{"tooEarly", store.DigestSettings{Minute: 8 * 60, Timezone: "UTC"}, time.Date(2023, time.March, 24, 7, 59, 0, 0, time.UTC), time.Date(2023, time.March, 24, 0, 0, 0, 0, time.UTC), false},
+		{"sentToday", store.DigestSettings{Minute: 8 * 60, Timezone: "UTC", LastSentOn: sentOn(2023, time.March, 24)}, time.Date(2023, time.March, 24, 9, 0, 0, 0, time.UTC), time.Date(2023, time.March, 24, 0, 0, 0, 0, time.UTC), false},
+		{"sentYesterday", store.DigestSettings{Minute: 8 * 60, Timezone: "UTC", LastSentOn: sentOn(2023, time.March, 23)}, time.Date(2023, time.March, 24, 9, 0, 0, 0, time.UTC), time.Date(2023, time.March, 24, 0, 0, 0, 0, time.UTC), true},
+		{"seoulIsTomorrow", store.DigestSettings{Minute: 8 * 60, Timezone: "Asia/Seoul", LastSentOn: sentOn(2023, time.March, 24)}, time.Date(2023, time.March, 24, 23, 30, 0, 0, time.UTC), time.Date(2023, time.March, 25, 0, 0, 0, 0, time.UTC), true}, //08:30 on the 25th there
+		{"newYorkIsYesterday", store.DigestSettings{Minute: 8 * 60, Timezone: "America/New_York"}, time.Date(2023, time.March, 24, 3, 0, 0, 0, time.UTC), time.Date(2023, time.March, 23, 0, 0, 0, 0, time.UTC), true},                                    //23:00 on the 23rd there
+		{"unknownTimezone", store.DigestSettings{Minute: 8 * 60, Timezone: "Mars/Olympus_Mons"}, time.Date(2023, time.March, 24, 9, 0, 0, 0, time.UTC), time.Time{}, false},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			day, due := digestDue(testcase.settings, testcase.now)
+			assert.Equal(t, testcase.expectedDay, day)
+			assert.Equal(t, testcase.expectedDue, due)
+		})
+	}
+}
+
+func TestSendDigests(t *testing.T) {
+	pinClock(t) //2022-12-25 00:01 UTC, 09:01 in Seoul
+
+	due := uuid.MustParse("0a1b2c3d-4e5f-4a6b-8c7d-9e0f1a2b3c4d")
+	webhook := uuid.MustParse("1b2c3d4e-5f6a-4b7c-8d9e-0f1a2b3c4d5e")
+	notYet := uuid.MustParse("2c3d4e5f-6a7b-4c8d-9e0f-1a2b3c4d5e6f")
+	unknownChannel := uuid.MustParse("3d4e5f6a-7b8c-4d9e-8f1a-2b3c4d5e6f70")
+	claimed := uuid.MustParse("4e5f6a7b-8c9d-4e0f-9a2b-3c4d5e6f7a81")
+	nothingExpiring := uuid.MustParse("5f6a7b8c-9d0e-4f1a-8b3c-4d5e6f7a8b92")
+
+	expiring := []store.FridgeIngredient{
+		{FridgeItemUUID: uuid.New(), IngredientUUID: uuid.New(), Amount: units.Whole(2), Unit: "l", Location: "fridge", ExpirationDate: testNow.Add(48 * time.Hour)},
+		{FridgeItemUUID: uuid.New(), IngredientUUID: uuid.New(), Amount: units.Whole(1), Unit: "kg", Location: "fridge", ExpirationDate: testNow.Add(10 * 24 * time.Hour)},
+		{FridgeItemUUID: uuid.New(), IngredientUUID: uuid.New(), Amount: units.Whole(3), Unit: "pc", Location: "pantry", ExpirationDate: testNow.Add(time.Hour)},
+	}
+
+	var claims []uuid.UUID
+
+	testServer.db = &mockstore.Mockstore{
+		ListEnabledDigestSettingsOverride: func(ctx context.Context) ([]store.DigestSettings, error) {
+			return []store.DigestSettings{
+				{UserUUID: due, Enabled: true, Minute: 9 * 60, Timezone: "Asia/Seoul", Channel: "email", WithinDays: 3},
+				{UserUUID: webhook, Enabled: true, Minute: 0, Timezone: "UTC", Channel: "webhook", WebhookURL: "https://hooks.example.com/wdiet", WithinDays: 3},
+				{UserUUID: notYet, Enabled: true, Minute: 10 * 60, Timezone: "Asia/Seoul", Channel: "email", WithinDays: 3},
+				{UserUUID: unknownChannel, Enabled: true, Minute: 0, Timezone: "UTC", Channel: "sms", WithinDays: 3},
+				{UserUUID: claimed, Enabled: true, Minute: 0, Timezone: "UTC", Channel: "email", WithinDays: 3},
+				{UserUUID: nothingExpiring, Enabled: true, Minute: 0, Timezone: "UTC", Channel: "email", WithinDays: 3},
+			}, nil
+		},
+		ClaimDigestOverride: func(ctx context.Context, uid uuid.UUID, day time.Time) (bool, error) {
+			claims = append(claims, uid)
+			return uid != claimed, nil
+		},
+		ListFridgeIngredientsOverride: func(ctx context.Context, hid uuid.UUID) ([]store.FridgeIngredient, error) {
+			return expiring, nil
+		},
+		GetActiveHouseholdOverride: func(ctx context.Context, uid uuid.UUID) (*store.HouseholdMembership, error) {
+			if uid == nothingExpiring {
+				return nil, store.ErrNotFound
+			}
+			return &store.HouseholdMembership{HouseholdUUID: testHouseholdUUID, Role: store.HouseholdRoleOwner, Active: true}, nil
+		},
+	}
+
+	before := len(testDigests.Sent())
+
+	assert.Equal(t, 2, testServer.sendDigests(context.Background()))
+	assert.Equal(t, []uuid.UUID{due, webhook, claimed, nothingExpiring}, claims)
+
+	sent := testDigests.Sent()[before:]
+	if assert.Len(t, sent, 2) {
+		assert.Equal(t, due, sent[0].UserUUID)
+		assert.Equal(t, "2022-12-25", sent[0].Day)
+		assert.NotEmpty(t, sent[0].EmailAddress)
+		if assert.Len(t, sent[0].Items, 2) { //soonest first, the kg is 10 days off
+			assert.Equal(t, expiring[2].FridgeItemUUID, sent[0].Items[0].FridgeItemUUID)
+			assert.Equal(t, expiring[0].FridgeItemUUID, sent[0].Items[1].FridgeItemUUID)
+			assert.Equal(t, "onion", sent[0].Items[0].IngredientName)
+		}
+
+		assert.Equal(t, webhook, sent[1].UserUUID)
+		assert.Equal(t, "https://hooks.example.com/wdiet", sent[1].WebhookURL)
+	}
+}
+
+func TestGetWasteStats(t *testing.T) {
+	pinClock(t)
+
+	onion := uuid.MustParse("ffff7c73-52b0-4e3d-bf3f-0c26785ef972")
+	milk := uuid.MustParse("9c1e3a5b-7d2f-4e6a-8b0c-2d4f6a8c0e13")
+	cost := func(s string) *units.Amount {
+		c := units.MustParseAmount(s)
+		return &c
+	}
+	event := func(reason string, iid uuid.UUID, name, category, amount, unit string, estimatedCost *units.Amount, at time.Time) store.FridgeEvent {
+		return store.FridgeEvent{FridgeEventUUID: uuid.New(), EventType: store.FridgeEventTypeDelete, HouseholdUUID: testHouseholdUUID, IngredientUUID: iid, IngredientName: name, Category: category, Amount: units.MustParseAmount(amount), Unit: unit, Reason: reason, EstimatedCost: estimatedCost, CreatedAt: at}
+	}
+	bought := event("", onion, "onion", "vegetables", "3", "kg", nil, time.Date(2022, time.September, 28, 9, 0, 0, 0, time.UTC))
+	bought.EventType = store.FridgeEventTypeAdd //only deletes count
+
+	events := []store.FridgeEvent{ //oldest first
+		bought,
+		event(store.FridgeEventExpired, onion, "onion", "vegetables", "1", "kg", cost("2"), time.Date(2022, time.October, 3, 9, 0, 0, 0, time.UTC)),
+		event(store.FridgeEventConsumed, onion, "onion", "vegetables", "2", "kg", nil, time.Date(2022, time.October, 4, 9, 0, 0, 0, time.UTC)),
+		event(store.FridgeEventExpired, milk, "milk", "dairy", "1", "l", cost("1.8"), time.Date(2022, time.November, 12, 9, 0, 0, 0, time.UTC)),
+		event(store.FridgeEventDiscarded, onion, "onion", "vegetables", "500", "g", nil, time.Date(2022, time.November, 20, 9, 0, 0, 0, time.UTC)),
+		event(store.FridgeEventGivenAway, milk, "milk", "dairy", "2", "l", cost("3.6"), time.Date(2022, time.December, 1, 9, 0, 0, 0, time.UTC)),
+		event(store.FridgeEventDiscarded, uuid.Nil, "durian", "fruit", "1", "pc", cost("12"), time.Date(2022, time.December, 2, 9, 0, 0, 0, time.UTC)), //nobody wanted it in the catalog either
+	}
+
+	total := func(items, expired, discarded int, amounts []UnitAmount, estimatedCost string, costed int) WasteTotal {
+		return WasteTotal{Items: items, Expired: expired, Discarded: discarded, Amounts: amounts, EstimatedCost: units.MustParseAmount(estimatedCost), CostedItems: costed}
+	}
+	onions := []UnitAmount{{Amount: units.Whole(1500), Unit: "g"}}
+	milks := []UnitAmount{{Amount: units.Whole(1000), Unit: "ml"}}
+	durians := []UnitAmount{{Amount: units.Whole(1), Unit: "pc"}}
+
+	testcases := []struct {
+		name                         string
+		listFridgeEventsOverrideFunc func(ctx context.Context, hid uuid.UUID, from, to time.Time) ([]store.FridgeEvent, error)
+		path                         string
+		query                        string
+		expectedFrom                 time.Time
+		expectedTo                   time.Time
+		expectedResponse             *WasteStats
+		expectedStatus               int
 	}{
 		{
 			"happyPath",
 			nil,
-			"080b5f09-527b-4581-bb56-19adbfe50ebf",
+			testUserUUID.String(),
+			"",
+			time.Date(2022, time.January, 1, 0, 0, 0, 0, time.UTC),
+			time.Date(2022, time.December, 26, 0, 0, 0, 0, time.UTC),
+			&WasteStats{
+				From:  "2022-01-01",
+				To:    "2022-12-25",
+				Total: total(4, 2, 2, []UnitAmount{{Amount: units.Whole(1500), Unit: "g"}, {Amount: units.Whole(1000), Unit: "ml"}, {Amount: units.Whole(1), Unit: "pc"}}, "15.8", 3),
+				ByCategory: []CategoryWaste{
+					{Category: "vegetables", WasteTotal: total(2, 1, 1, onions, "2", 1)},
+					{Category: "fruit", WasteTotal: total(1, 0, 1, durians, "12", 1)},
+					{Category: "dairy", WasteTotal: total(1, 1, 0, milks, "1.8", 1)},
+				},
+				ByIngredient: []IngredientWaste{
+					{IngredientUUID: onion, IngredientName: "onion", Category: "vegetables", WasteTotal: total(2, 1, 1, onions, "2", 1)},
+					{IngredientName: "durian", Category: "fruit", WasteTotal: total(1, 0, 1, durians, "12", 1)},
+					{IngredientUUID: milk, IngredientName: "milk", Category: "dairy", WasteTotal: total(1, 1, 0, milks, "1.8", 1)},
+				},
+				ByMonth: []MonthWaste{
+					{Month: "2022-10", WasteTotal: total(1, 1, 0, []UnitAmount{{Amount: units.Whole(1000), Unit: "g"}}, "2", 1)},
+					{Month: "2022-11", WasteTotal: total(2, 1, 1, []UnitAmount{{Amount: units.Whole(500), Unit: "g"}, {Amount: units.Whole(1000), Unit: "ml"}}, "1.8", 1)},
+					{Month: "2022-12", WasteTotal: total(1, 0, 1, durians, "12", 1)},
+				},
+			},
 			http.StatusOK,
 		},
 		{
-			"badRequest",
-			nil,
-			"maerong",
-			http.StatusBadRequest,
+			"happyPath:nothingThrownOut",
+			func(ctx context.Context, hid uuid.UUID, from, to time.Time) ([]store.FridgeEvent, error) {
+				return nil, nil
+			},
+			testUserUUID.String(),
+			"?from=2022-03-01&to=2022-03-31",
+			time.Date(2022, time.March, 1, 0, 0, 0, 0, time.UTC),
+			time.Date(2022, time.April, 1, 0, 0, 0, 0, time.UTC),
+			&WasteStats{From: "2022-03-01", To: "2022-03-31"},
+			http.StatusOK,
 		},
+		{
+			"happyPath:oneDay",
+			func(ctx context.Context, hid uuid.UUID, from, to time.Time) ([]store.FridgeEvent, error) {
+				return nil, nil
+			},
+			testUserUUID.String(),
+			"?from=2022-03-01&to=2022-03-01",
+			time.Date(2022, time.March, 1, 0, 0, 0, 0, time.UTC),
+			time.Date(2022, time.March, 2, 0, 0, 0, 0, time.UTC),
+			&WasteStats{From: "2022-03-01", To: "2022-03-01"},
+			http.StatusOK,
+		},
+		{"badRequest:path", nil, "maerong", "", time.Time{}, time.Time{}, nil, http.StatusBadRequest},
+		{"badRequest:from", nil, testUserUUID.String(), "?from=last+year", time.Time{}, time.Time{}, nil, http.StatusBadRequest},
+		{"badRequest:backwards", nil, testUserUUID.String(), "?from=2022-03-01&to=2022-02-01", time.Time{}, time.Time{}, nil, http.StatusBadRequest},
+		{"forbidden", nil, testRecipeOwnerUUID.String(), "", time.Time{}, time.Time{}, nil, http.StatusForbidden},
 		{
 			"internalServerError",
-			func(ctx context.Context, id uuid.UUID) error {
-				return errors.New("internalServerError")
+			func(ctx context.Context, hid uuid.UUID, from, to time.Time) ([]store.FridgeEvent, error) {
+				return nil, errors.New("internalServerError")
 			},
-			"080b5f09-527b-4581-bb56-19adbfe50ebf",
+			testUserUUID.String(),
+			"",
+			time.Time{},
+			time.Time{},
+			nil,
 			http.StatusInternalServerError,
 		},
 	}
 
 	for _, testcase := range testcases {
 		t.Run(testcase.name, func(t *testing.T) {
-			req := httptest.NewRequest(http.MethodDelete, "/recipes/"+testcase.requestBody, nil)
+			req := httptest.NewRequest(http.MethodGet, "/users/"+testcase.path+"/stats/waste"+testcase.query, nil)
 			w := httptest.NewRecorder()
+			authorize(t, req, testUserUUID)
 
-			testServer.db = &mockstore.Mockstore{DeleteRecipeOverride: testcase.deleteRecipeOverrideFunc}
+			var gotFrom, gotTo time.Time
+			testServer.db = &mockstore.Mockstore{
+				ListFridgeEventsOverride: func(ctx context.Context, hid uuid.UUID, from, to time.Time) ([]store.FridgeEvent, error) {
+					gotFrom, gotTo = from, to
+					if testcase.listFridgeEventsOverrideFunc != nil {
+						return testcase.listFridgeEventsOverrideFunc(ctx, hid, from, to)
+					}
+					return events, nil
+				},
+			}
 			testServer.r.ServeHTTP(w, req)
 
 			assert.Equal(t, testcase.expectedStatus, w.Code)
+
+			if testcase.expectedResponse != nil {
+				assert.Equal(t, testcase.expectedFrom, gotFrom)
+				assert.Equal(t, testcase.expectedTo, gotTo)
+
+				var resBody WasteStats
+
+				err := json.Unmarshal(w.Body.Bytes(), &resBody)
+				assert.NoError(t, err, "unexpected error unmarshalling the response body")
+				assert.Equal(t, *testcase.expectedResponse, resBody)
+			} else {
+				assert.Equal(t, 0, w.Body.Len())
+			}
 		})
 	}
 }
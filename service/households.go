@@ -0,0 +1,453 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"unicode/utf8"
+	"wdiet/store"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// activeHousehold gets uid's membership in the household the fridge routes work on. Users without one, new users or
+// users who left the one that was active, are switched to the first household they're in, or get a new household of
+// their own if they're in none. The store does that under a lock, see EnsureActiveHousehold. If it returns false it
+// has written the response.
+func (s *Service) activeHousehold(c *gin.Context, l *zap.Logger, uid uuid.UUID) (*store.HouseholdMembership, bool) {
+	m, err := s.db.GetActiveHousehold(context.Background(), uid)
+	switch {
+	case err == nil:
+		return m, true
+	case !errors.Is(err, store.ErrNotFound):
+		l.Error("error getting active household", zap.Error(err))
+		c.Status(http.StatusInternalServerError)
+		return nil, false
+	}
+
+	user, err := s.db.GetUser(context.Background(), uid)
+	if err != nil {
+		l.Error("error getting user", zap.Error(err))
+		c.Status(http.StatusInternalServerError)
+		return nil, false
+	}
+
+	m, err = s.db.EnsureActiveHousehold(context.Background(), uid, personalHouseholdName(user.FirstName)) //two first requests mustn't make two households
+	if err != nil {
+		l.Error("error ensuring active household", zap.Error(err))
+		c.Status(http.StatusInternalServerError)
+		return nil, false
+	}
+
+	return m, true
+}
+
+// personalHouseholdName names the household a user gets when they aren't in any, the same way the migration named the
+// ones it made for everybody's fridge.
+func personalHouseholdName(firstName string) string {
+	name := firstName + "'s household"
+	if utf8.RuneCountInString(name) > 64 {
+		name = string([]rune(name)[:64])
+	}
+	return name
+}
+
+// canChangeFridge tells if the member can put things in the household's fridge and take them out. Viewers only look.
+func canChangeFridge(m *store.HouseholdMembership) bool {
+	return m.Role == store.HouseholdRoleOwner || m.Role == store.HouseholdRoleMember
+}
+
+// householdMembership looks the household hid up and gets the authenticated user's membership in it.
+// If it returns false it has written the response.
+func (s *Service) householdMembership(c *gin.Context, l *zap.Logger, hid uuid.UUID) (*store.Household, *store.HouseholdMembership, bool) {
+	household, err := s.db.GetHousehold(context.Background(), hid)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			l.Info("error checking household membership", zap.Error(err))
+			c.Status(http.StatusNotFound)
+			return nil, nil, false
+		}
+		l.Error("error checking household membership", zap.Error(err))
+		c.Status(http.StatusInternalServerError)
+		return nil, nil, false
+	}
+
+	m, err := s.db.GetHouseholdMembership(context.Background(), hid, authorizedUser(c))
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			l.Info("error checking household membership, forbidden")
+			c.Status(http.StatusForbidden)
+			return nil, nil, false
+		}
+		l.Error("error checking household membership", zap.Error(err))
+		c.Status(http.StatusInternalServerError)
+		return nil, nil, false
+	}
+
+	return household, m, true
+}
+
+// CreateHousehold makes a new household with the caller as its owner and switches them over to it.
+func (s *Service) CreateHousehold(c *gin.Context) {
+	l := s.l.Named("CreateHousehold")
+
+	var householdRequest Household
+
+	if err := json.NewDecoder(c.Request.Body).Decode(&householdRequest); err != nil {
+		l.Info("error creating household", zap.Error(err))
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	if !isValidHouseholdRequest(householdRequest) {
+		l.Info("error creating household")
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	household, err := s.db.CreateHousehold(context.Background(), store.Household{HouseholdName: householdRequest.HouseholdName}, authorizedUser(c))
+	if err != nil {
+		l.Error("error creating household", zap.Error(err))
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(http.StatusOK, dbHousehold2ApiHousehold(household, nil))
+}
+
+func (s *Service) ListHouseholds(c *gin.Context) {
+	l := s.l.Named("ListHouseholds")
+
+	uid, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		l.Info("error listing households", zap.Error(err))
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	if !isOwner(c, uid) {
+		l.Info("error listing households, forbidden")
+		c.Status(http.StatusForbidden)
+		return
+	}
+
+	memberships, err := s.db.ListHouseholds(context.Background(), uid)
+	if err != nil {
+		l.Error("error listing households", zap.Error(err))
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	if len(memberships) == 0 {
+		c.Status(http.StatusOK)
+		return
+	}
+
+	var listHouseholdsResponse []HouseholdMembership
+
+	for _, m := range memberships {
+		listHouseholdsResponse = append(listHouseholdsResponse, dbMembership2ApiMembership(&m))
+	}
+
+	c.JSON(http.StatusOK, listHouseholdsResponse)
+}
+
+// GetHousehold shows a household and who's in it, to its members.
+func (s *Service) GetHousehold(c *gin.Context) {
+	l := s.l.Named("GetHousehold")
+
+	hid, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		l.Info("error getting household", zap.Error(err))
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	household, _, ok := s.householdMembership(c, l, hid)
+	if !ok {
+		return
+	}
+
+	members, err := s.db.ListHouseholdMembers(context.Background(), hid)
+	if err != nil {
+		l.Error("error getting household", zap.Error(err))
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(http.StatusOK, dbHousehold2ApiHousehold(household, members))
+}
+
+// SetActiveHousehold switches the household the caller's fridge routes work on.
+func (s *Service) SetActiveHousehold(c *gin.Context) {
+	l := s.l.Named("SetActiveHousehold")
+
+	uid, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		l.Info("error setting active household", zap.Error(err))
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	if !isOwner(c, uid) {
+		l.Info("error setting active household, forbidden")
+		c.Status(http.StatusForbidden)
+		return
+	}
+
+	var activeRequest HouseholdMembership
+
+	if err := json.NewDecoder(c.Request.Body).Decode(&activeRequest); err != nil || activeRequest.HouseholdUUID == uuid.Nil {
+		l.Info("error setting active household", zap.Error(err))
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	if err := s.db.SetActiveHousehold(context.Background(), uid, activeRequest.HouseholdUUID); err != nil {
+		if errors.Is(err, store.ErrNotFound) { //no such household, or not theirs
+			l.Info("error setting active household", zap.Error(err))
+			c.Status(http.StatusNotFound)
+			return
+		}
+		l.Error("error setting active household", zap.Error(err))
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	m, err := s.db.GetHouseholdMembership(context.Background(), activeRequest.HouseholdUUID, uid)
+	if err != nil {
+		l.Error("error setting active household", zap.Error(err))
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(http.StatusOK, dbMembership2ApiMembership(m))
+}
+
+// CreateHouseholdInvitation mails an invitation to join the household. Only owners invite, and only as member or viewer.
+func (s *Service) CreateHouseholdInvitation(c *gin.Context) {
+	l := s.l.Named("CreateHouseholdInvitation")
+
+	hid, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		l.Info("error creating household invitation", zap.Error(err))
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	var invitationRequest HouseholdInvitation
+
+	if err := json.NewDecoder(c.Request.Body).Decode(&invitationRequest); err != nil {
+		l.Info("error creating household invitation", zap.Error(err))
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	if !isValidHouseholdInvitationRequest(invitationRequest) {
+		l.Info("error creating household invitation")
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	household, m, ok := s.householdMembership(c, l, hid)
+	if !ok {
+		return
+	}
+
+	if m.Role != store.HouseholdRoleOwner {
+		l.Info("error creating household invitation, not an owner")
+		c.Status(http.StatusForbidden)
+		return
+	}
+
+	inviter, err := s.db.GetUser(context.Background(), authorizedUser(c))
+	if err != nil {
+		l.Error("error creating household invitation", zap.Error(err))
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	token, err := newOpaqueToken()
+	if err != nil {
+		l.Error("error creating household invitation", zap.Error(err))
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	invitation, err := s.db.CreateHouseholdInvitation(context.Background(), store.HouseholdInvitation{
+		HouseholdUUID: hid,
+		EmailAddress:  invitationRequest.EmailAddress,
+		Role:          invitationRequest.Role,
+		HashedToken:   hashToken(token),
+		InvitedBy:     inviter.UserUUID,
+		ExpiresAt:     s.now().Add(householdInvitationTTL),
+	})
+	if err != nil {
+		l.Error("error creating household invitation", zap.Error(err))
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	if err := s.mailer.Send(context.Background(), householdInvitationMessage(invitation.EmailAddress, s.publicURL, inviter.FirstName, household.HouseholdName, token)); err != nil {
+		l.Error("error sending household invitation mail", zap.Error(err))
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(http.StatusOK, dbInvitation2ApiInvitation(invitation))
+}
+
+// AcceptHouseholdInvitation adds the caller to the household they were invited to, if the invitation was mailed to their
+// address, and switches them over to it.
+func (s *Service) AcceptHouseholdInvitation(c *gin.Context) {
+	l := s.l.Named("AcceptHouseholdInvitation")
+
+	var acceptRequest AcceptHouseholdInvitation
+
+	if err := json.NewDecoder(c.Request.Body).Decode(&acceptRequest); err != nil || acceptRequest.Token == "" {
+		l.Info("error accepting household invitation", zap.Error(err))
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	user, err := s.db.GetUser(context.Background(), authorizedUser(c))
+	if err != nil {
+		l.Error("error accepting household invitation", zap.Error(err))
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	m, err := s.db.AcceptHouseholdInvitation(context.Background(), hashToken(acceptRequest.Token), user.UserUUID, user.EmailAddress)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) { //unknown, used, expired or somebody else's, we don't say which
+			l.Info("error accepting household invitation", zap.Error(err))
+			c.Status(http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, store.ErrConflict) {
+			l.Info("error accepting household invitation, already a member", zap.Error(err))
+			c.Status(http.StatusConflict)
+			return
+		}
+		l.Error("error accepting household invitation", zap.Error(err))
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(http.StatusOK, dbMembership2ApiMembership(m))
+}
+
+// SetHouseholdMemberRole changes what a member can do. Only owners change roles, and a household always keeps an owner.
+func (s *Service) SetHouseholdMemberRole(c *gin.Context) {
+	l := s.l.Named("SetHouseholdMemberRole")
+
+	hid, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		l.Info("error setting household member role", zap.Error(err))
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	uid, err := uuid.Parse(c.Param("uid"))
+	if err != nil {
+		l.Info("error setting household member role", zap.Error(err))
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	var roleRequest UserRole
+
+	if err := json.NewDecoder(c.Request.Body).Decode(&roleRequest); err != nil {
+		l.Info("error setting household member role", zap.Error(err))
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	if !isValidHouseholdRoleRequest(roleRequest) {
+		l.Info("error setting household member role")
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	_, m, ok := s.householdMembership(c, l, hid)
+	if !ok {
+		return
+	}
+
+	if m.Role != store.HouseholdRoleOwner {
+		l.Info("error setting household member role, not an owner")
+		c.Status(http.StatusForbidden)
+		return
+	}
+
+	member, err := s.db.SetHouseholdMemberRole(context.Background(), hid, uid, roleRequest.Role)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			l.Info("error setting household member role", zap.Error(err))
+			c.Status(http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, store.ErrConflict) {
+			l.Info("error setting household member role, last owner", zap.Error(err))
+			c.Status(http.StatusConflict)
+			return
+		}
+		l.Error("error setting household member role", zap.Error(err))
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	c.JSON(http.StatusOK, dbMember2ApiMember(member))
+}
+
+// RemoveHouseholdMember takes someone out of a household. Owners remove anybody, everyone else can only leave. The last
+// one to leave takes the household and its fridge with them, the last owner can't leave while others are still in.
+func (s *Service) RemoveHouseholdMember(c *gin.Context) {
+	l := s.l.Named("RemoveHouseholdMember")
+
+	hid, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		l.Info("error removing household member", zap.Error(err))
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	uid, err := uuid.Parse(c.Param("uid"))
+	if err != nil {
+		l.Info("error removing household member", zap.Error(err))
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	_, m, ok := s.householdMembership(c, l, hid)
+	if !ok {
+		return
+	}
+
+	if !isOwner(c, uid) && m.Role != store.HouseholdRoleOwner {
+		l.Info("error removing household member, not an owner")
+		c.Status(http.StatusForbidden)
+		return
+	}
+
+	if err := s.db.RemoveHouseholdMember(context.Background(), hid, uid); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			l.Info("error removing household member", zap.Error(err))
+			c.Status(http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, store.ErrConflict) {
+			l.Info("error removing household member, last owner", zap.Error(err))
+			c.Status(http.StatusConflict)
+			return
+		}
+		l.Error("error removing household member", zap.Error(err))
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
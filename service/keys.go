@@ -0,0 +1,218 @@
+package service
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// KeySet holds the keys tokens are signed and verified with. Exactly one key signs new tokens, every key in the set
+// verifies, so to rotate you add the new key, make it the signing key and drop the old one once its tokens have expired.
+type KeySet struct {
+	signing *signingKey
+	keys    map[string]*signingKey //by kid
+}
+
+type signingKey struct {
+	kid       string
+	method    jwt.SigningMethod
+	signKey   interface{} //[]byte, *rsa.PrivateKey or ed25519.PrivateKey. nil if we only verify with this key.
+	verifyKey interface{} //[]byte, *rsa.PublicKey or ed25519.PublicKey
+}
+
+// keySetFile is what WDIET_JWT_KEYS / WDIET_JWT_KEYS_FILE contain, e.g.
+//
+//	{
+//	  "signing_key": "2024-06",
+//	  "keys": [
+//	    {"kid": "2024-06", "alg": "EdDSA", "key_file": "/run/secrets/jwt_ed25519.pem"},
+//	    {"kid": "2024-01", "alg": "RS256", "key": "-----BEGIN PUBLIC KEY-----\n..."},
+//	    {"kid": "legacy", "alg": "HS512", "key": "<base64 encoded secret>"}
+//	  ]
+//	}
+//
+// RS256 and EdDSA keys are PEM, private keys can sign, public keys only verify. (openssl genpkey -algorithm ed25519 makes one)
+type keySetFile struct {
+	SigningKey string        `json:"signing_key"`
+	Keys       []keyFileItem `json:"keys"`
+}
+
+type keyFileItem struct {
+	Kid     string `json:"kid"`
+	Alg     string `json:"alg"`
+	Key     string `json:"key"`
+	KeyFile string `json:"key_file"`
+}
+
+const minHMACKeyLength = 32 //bytes. HS512 wants more but less than 32 is a password, not a key.
+
+// ParseKeySet reads a key set in the keySetFile format.
+func ParseKeySet(data []byte) (*KeySet, error) {
+	var f keySetFile
+
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("error parsing key set: %w", err)
+	}
+
+	ks := &KeySet{keys: make(map[string]*signingKey, len(f.Keys))}
+
+	for _, item := range f.Keys {
+		k, err := parseKey(item)
+		if err != nil {
+			return nil, err
+		}
+
+		if _, exists := ks.keys[k.kid]; exists {
+			return nil, fmt.Errorf("error parsing key set: duplicate kid %q", k.kid)
+		}
+		ks.keys[k.kid] = k
+	}
+
+	signing, ok := ks.keys[f.SigningKey]
+	if !ok {
+		return nil, fmt.Errorf("error parsing key set: signing key %q is not in the set", f.SigningKey)
+	}
+	if signing.signKey == nil {
+		return nil, fmt.Errorf("error parsing key set: signing key %q is a public key", f.SigningKey)
+	}
+	ks.signing = signing
+
+	return ks, nil
+}
+
+func parseKey(item keyFileItem) (*signingKey, error) {
+	if item.Kid == "" {
+		return nil, fmt.Errorf("error parsing key: kid is empty")
+	}
+
+	raw := []byte(item.Key)
+	if item.KeyFile != "" {
+		var err error
+		if raw, err = os.ReadFile(item.KeyFile); err != nil {
+			return nil, fmt.Errorf("error reading key %q: %w", item.Kid, err)
+		}
+	}
+	if len(raw) == 0 {
+		return nil, fmt.Errorf("error parsing key %q: key is empty", item.Kid)
+	}
+
+	k := &signingKey{kid: item.Kid}
+
+	switch item.Alg {
+	case "HS256", "HS384", "HS512":
+		secret, err := base64.StdEncoding.DecodeString(string(raw))
+		if err != nil {
+			return nil, fmt.Errorf("error parsing key %q: %w", item.Kid, err)
+		}
+		if len(secret) < minHMACKeyLength {
+			return nil, fmt.Errorf("error parsing key %q: hmac secret shorter than %d bytes", item.Kid, minHMACKeyLength)
+		}
+		k.method = jwt.GetSigningMethod(item.Alg)
+		k.signKey, k.verifyKey = secret, secret
+
+	case "RS256":
+		k.method = jwt.SigningMethodRS256
+		if private, err := jwt.ParseRSAPrivateKeyFromPEM(raw); err == nil {
+			k.signKey, k.verifyKey = private, &private.PublicKey
+			break
+		}
+		public, err := jwt.ParseRSAPublicKeyFromPEM(raw)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing key %q: %w", item.Kid, err)
+		}
+		k.verifyKey = public
+
+	case "EdDSA":
+		k.method = jwt.SigningMethodEdDSA
+		if private, err := jwt.ParseEdPrivateKeyFromPEM(raw); err == nil {
+			k.signKey, k.verifyKey = private, private.(ed25519.PrivateKey).Public()
+			break
+		}
+		public, err := jwt.ParseEdPublicKeyFromPEM(raw)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing key %q: %w", item.Kid, err)
+		}
+		k.verifyKey = public
+
+	default:
+		return nil, fmt.Errorf("error parsing key %q: unsupported alg %q", item.Kid, item.Alg)
+	}
+
+	return k, nil
+}
+
+// sign signs claims with the signing key and puts its kid in the header.
+func (ks *KeySet) sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(ks.signing.method, claims)
+	token.Header["kid"] = ks.signing.kid
+
+	return token.SignedString(ks.signing.signKey)
+}
+
+// keyFunc picks the verification key by the token's kid. The alg has to be the one the key was configured with,
+// otherwise somebody could hand us an HS256 token "signed" with our public RSA key.
+func (ks *KeySet) keyFunc(t *jwt.Token) (interface{}, error) {
+	kid, _ := t.Header["kid"].(string)
+
+	k, ok := ks.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown kid: %q", kid)
+	}
+
+	if t.Method.Alg() != k.method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method: %v", t.Header["alg"])
+	}
+
+	return k.verifyKey, nil
+}
+
+// algs is every alg in the set, for jwt.WithValidMethods.
+func (ks *KeySet) algs() []string {
+	seen := map[string]bool{}
+	var algs []string
+
+	for _, k := range ks.keys {
+		if !seen[k.method.Alg()] {
+			seen[k.method.Alg()] = true
+			algs = append(algs, k.method.Alg())
+		}
+	}
+
+	return algs
+}
+
+// jwks returns the public keys of the set. HMAC keys are secrets so they never show up here.
+func (ks *KeySet) jwks() JWKS {
+	set := JWKS{Keys: []JWK{}}
+
+	for _, k := range ks.keys {
+		switch public := k.verifyKey.(type) {
+		case *rsa.PublicKey:
+			set.Keys = append(set.Keys, JWK{
+				Kty: "RSA",
+				Kid: k.kid,
+				Use: "sig",
+				Alg: k.method.Alg(),
+				N:   base64.RawURLEncoding.EncodeToString(public.N.Bytes()),
+				E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes()),
+			})
+		case ed25519.PublicKey:
+			set.Keys = append(set.Keys, JWK{
+				Kty: "OKP",
+				Kid: k.kid,
+				Use: "sig",
+				Alg: k.method.Alg(),
+				Crv: "Ed25519",
+				X:   base64.RawURLEncoding.EncodeToString(public),
+			})
+		}
+	}
+
+	return set
+}
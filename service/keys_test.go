@@ -0,0 +1,137 @@
+package service
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseKeySet(t *testing.T) {
+	edPublic, edPrivate, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err, "unexpected error generating the key")
+
+	rsaPrivate, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err, "unexpected error generating the key")
+
+	toPEM := func(typ string, der []byte) string {
+		return string(pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}))
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(edPrivate)
+	assert.NoError(t, err, "unexpected error marshalling the key")
+	edPrivatePEM := toPEM("PRIVATE KEY", der)
+
+	der, err = x509.MarshalPKIXPublicKey(edPublic)
+	assert.NoError(t, err, "unexpected error marshalling the key")
+	edPublicPEM := toPEM("PUBLIC KEY", der)
+
+	rsaPrivatePEM := toPEM("RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rsaPrivate))
+
+	der, err = x509.MarshalPKIXPublicKey(&rsaPrivate.PublicKey)
+	assert.NoError(t, err, "unexpected error marshalling the key")
+	rsaPublicPEM := toPEM("PUBLIC KEY", der)
+	secret := base64.StdEncoding.EncodeToString([]byte("jyoonieisthebestandsheisprettyandsheissmart"))
+
+	testcases := []struct {
+		name           string
+		file           keySetFile
+		expectedSigner string
+		expectedAlg    string
+		expectedErr    bool
+	}{
+		{
+			"happyPath:eddsa",
+			keySetFile{SigningKey: "a", Keys: []keyFileItem{{Kid: "a", Alg: "EdDSA", Key: edPrivatePEM}, {Kid: "b", Alg: "RS256", Key: rsaPublicPEM}}},
+			"a",
+			"EdDSA",
+			false,
+		},
+		{
+			"happyPath:rsa",
+			keySetFile{SigningKey: "b", Keys: []keyFileItem{{Kid: "a", Alg: "EdDSA", Key: edPublicPEM}, {Kid: "b", Alg: "RS256", Key: rsaPrivatePEM}}},
+			"b",
+			"RS256",
+			false,
+		},
+		{
+			"happyPath:hmac",
+			keySetFile{SigningKey: "a", Keys: []keyFileItem{{Kid: "a", Alg: "HS512", Key: secret}}},
+			"a",
+			"HS512",
+			false,
+		},
+		{
+			"signingKeyMissing",
+			keySetFile{SigningKey: "c", Keys: []keyFileItem{{Kid: "a", Alg: "EdDSA", Key: edPrivatePEM}}},
+			"",
+			"",
+			true,
+		},
+		{
+			"signingKeyIsPublic",
+			keySetFile{SigningKey: "a", Keys: []keyFileItem{{Kid: "a", Alg: "EdDSA", Key: edPublicPEM}}},
+			"",
+			"",
+			true,
+		},
+		{
+			"duplicateKid",
+			keySetFile{SigningKey: "a", Keys: []keyFileItem{{Kid: "a", Alg: "EdDSA", Key: edPrivatePEM}, {Kid: "a", Alg: "HS512", Key: secret}}},
+			"",
+			"",
+			true,
+		},
+		{
+			"shortSecret",
+			keySetFile{SigningKey: "a", Keys: []keyFileItem{{Kid: "a", Alg: "HS256", Key: base64.StdEncoding.EncodeToString([]byte("secret"))}}},
+			"",
+			"",
+			true,
+		},
+		{
+			"wrongKeyForAlg",
+			keySetFile{SigningKey: "a", Keys: []keyFileItem{{Kid: "a", Alg: "RS256", Key: edPrivatePEM}}},
+			"",
+			"",
+			true,
+		},
+		{
+			"unsupportedAlg",
+			keySetFile{SigningKey: "a", Keys: []keyFileItem{{Kid: "a", Alg: "none", Key: secret}}},
+			"",
+			"",
+			true,
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			data, err := json.Marshal(testcase.file)
+			assert.NoError(t, err, "unexpected error marshalling the key set")
+
+			ks, err := ParseKeySet(data)
+			if testcase.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+
+			assert.Equal(t, testcase.expectedSigner, ks.signing.kid)
+			assert.Equal(t, testcase.expectedAlg, ks.signing.method.Alg())
+
+			signed, err := ks.sign(jwt.RegisteredClaims{Subject: "jy"}) //whatever we sign we have to be able to verify
+			assert.NoError(t, err, "unexpected error signing the token")
+
+			_, err = jwt.Parse(signed, ks.keyFunc, jwt.WithValidMethods(ks.algs()))
+			assert.NoError(t, err, "unexpected error parsing the token")
+		})
+	}
+}
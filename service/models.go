@@ -2,6 +2,7 @@ package service
 
 import (
 	"time"
+	"wdiet/units"
 
 	"github.com/google/uuid"
 )
@@ -12,10 +13,12 @@ import (
 type User struct {
 	UserUUID uuid.UUID `json:"user_uuid,omitempty"`
 	//HashedPassword string    `json:"hashed_password,omitempty"`
-	Active       bool   `json:"active,omitempty"`
-	FirstName    string `json:"first_name,omitempty"`
-	LastName     string `json:"last_name,omitempty"`
-	EmailAddress string `json:"email_address,omitempty"`
+	Active          bool       `json:"active,omitempty"`
+	Role            string     `json:"role,omitempty"` //read only, admins change it with POST /admin/users/:id/role
+	FirstName       string     `json:"first_name,omitempty"`
+	LastName        string     `json:"last_name,omitempty"`
+	EmailAddress    string     `json:"email_address,omitempty"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at,omitempty"` //read only, set by GET /users/verify
 	//CreatedAt    time.Time `json:"created_at,omitempty"`
 	//UpdatedAt    time.Time `json:"updated_at,omitempty"`
 }
@@ -25,15 +28,96 @@ type Login struct {
 	Password     string `json:"password,omitempty"`
 }
 
+// Reactivation is POST /users/:id/reactivate. Code is only needed when the user has two-factor authentication on.
+type Reactivation struct {
+	EmailAddress string `json:"email_address,omitempty"`
+	Password     string `json:"password,omitempty"`
+	Code         string `json:"code,omitempty"` //from the app, or a recovery code
+}
+
+type PersonalAccessToken struct {
+	PersonalAccessTokenUUID uuid.UUID  `json:"personal_access_token_uuid,omitempty"`
+	Name                    string     `json:"name,omitempty"`
+	Scopes                  []string   `json:"scopes,omitempty"`
+	Token                   string     `json:"token,omitempty"` //only in the response to creating it
+	ExpiresAt               *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt              *time.Time `json:"last_used_at,omitempty"`
+	CreatedAt               time.Time  `json:"created_at,omitempty"`
+}
+
+type UserRole struct {
+	Role string `json:"role,omitempty"`
+}
+
+// TwoFactorChallenge is what Login answers with instead of a Token when the user has 2fa on.
+type TwoFactorChallenge struct {
+	TwoFactorRequired bool      `json:"two_factor_required,omitempty"`
+	ChallengeToken    string    `json:"challenge_token,omitempty"`
+	ExpiresAt         time.Time `json:"expires_at,omitempty"`
+}
+
+type TwoFactorLogin struct {
+	ChallengeToken string `json:"challenge_token,omitempty"`
+	Code           string `json:"code,omitempty"` //from the app, or a recovery code
+}
+
+type TwoFactorCode struct {
+	Code string `json:"code,omitempty"`
+}
+
+type TwoFactorEnrolment struct {
+	Secret        string   `json:"secret,omitempty"` //for typing into the app when the QR code doesn't work
+	OTPAuthURI    string   `json:"otpauth_uri,omitempty"`
+	RecoveryCodes []string `json:"recovery_codes,omitempty"`
+}
+
+type ChangePassword struct {
+	CurrentPassword string `json:"current_password,omitempty"`
+	NewPassword     string `json:"new_password,omitempty"`
+}
+
+type PasswordReset struct {
+	EmailAddress string `json:"email_address,omitempty"`
+}
+
+type ConfirmPasswordReset struct {
+	Token       string `json:"token,omitempty"`
+	NewPassword string `json:"new_password,omitempty"`
+}
+
 type Token struct {
-	Token string `json:"token,omitempty"`
+	Token        string `json:"token,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+}
+
+type RefreshToken struct {
+	RefreshToken string `json:"refresh_token,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	N   string `json:"n,omitempty"`   //RSA
+	E   string `json:"e,omitempty"`   //RSA
+	Crv string `json:"crv,omitempty"` //OKP
+	X   string `json:"x,omitempty"`   //OKP
 }
 
 type Ingredient struct {
 	IngredientUUID uuid.UUID `json:"ingredient_uuid,omitempty"`
 	IngredientName string    `json:"ingredient_name,omitempty"`
 	Category       string    `json:"category,omitempty"`
-	DaysUntilExp   int       `json:"days_until_exp,omitempty"`
+	DaysUntilExp   int       `json:"days_until_exp,omitempty"` //in the fridge
+	FreezerDays    int       `json:"freezer_days,omitempty"`   //these three are left out if we don't know them
+	PantryDays     int       `json:"pantry_days,omitempty"`
+	OpenedDays     int       `json:"opened_days,omitempty"` //once it's open, in the fridge or the pantry
+	Density        float64   `json:"density,omitempty"`     //g per ml, lets recipes in cups use what's in the fridge in grams
 	//created_at           time.Time
 	//updated_at           time.Time
 }
@@ -44,16 +128,144 @@ type SearchIngredient struct {
 }
 
 type FridgeIngredient struct {
-	UserUUID       uuid.UUID `json:"user_uuid,omitempty"`
-	IngredientUUID uuid.UUID `json:"ingredient_uuid,omitempty"`
-	Amount         int       `json:"amount,omitempty"`
-	Unit           string    `json:"unit,omitempty"`
-	PurchasedDate  time.Time `json:"purchased_date,omitempty"`
-	ExpirationDate time.Time `json:"expiration_date,omitempty"`
+	FridgeItemUUID uuid.UUID    `json:"fridge_item_uuid,omitempty"` //the lot, an ingredient can be in the fridge more than once
+	HouseholdUUID  uuid.UUID    `json:"household_uuid,omitempty"`   //always the caller's active household, set by us
+	UserUUID       uuid.UUID    `json:"user_uuid,omitempty"`        //who put it in the fridge
+	IngredientUUID uuid.UUID    `json:"ingredient_uuid,omitempty"`
+	Amount         units.Amount `json:"amount"`
+	Unit           string       `json:"unit,omitempty"` //anything the units package can parse, we keep its symbol
+	PurchasedDate  time.Time    `json:"purchased_date,omitempty"`
+	ExpirationDate time.Time    `json:"expiration_date,omitempty"` //read only, worked out by the shelflife package
+	Location       string       `json:"location,omitempty"`        //fridge, freezer or pantry, fridge if it's not there
+	OpenedDate     *time.Time   `json:"opened_date,omitempty"`
 	// created_at       time.Time
 	// updated_at       time.Time
 }
 
+// ConsumeFridgeIngredient is POST /users/:id/ingredients/:iid/consume, how much of the ingredient got used.
+type ConsumeFridgeIngredient struct {
+	Amount units.Amount `json:"amount"`
+	Unit   string       `json:"unit,omitempty"`
+}
+
+// MoveFridgeIngredient is POST /fridge_ingredients/:id/move, a lot going into the freezer or out of it.
+type MoveFridgeIngredient struct {
+	UserUUID uuid.UUID  `json:"user_uuid,omitempty"`
+	Location string     `json:"location,omitempty"`
+	MovedAt  *time.Time `json:"moved_at,omitempty"` //now if it's not there
+}
+
+// OpenFridgeIngredient is POST /fridge_ingredients/:id/open.
+type OpenFridgeIngredient struct {
+	UserUUID uuid.UUID  `json:"user_uuid,omitempty"`
+	OpenedAt *time.Time `json:"opened_at,omitempty"` //now if it's not there
+}
+
+type DeleteFIngrOptions struct { //query string of DELETE /users/:uid/fridge_ingredients/:fid, why it's going
+	Reason        string `form:"reason"`         //consumed, expired, discarded or given_away
+	EstimatedCost string `form:"estimated_cost"` //what it cost, e.g. 2.50. optional
+}
+
+type WasteStatsOptions struct { //query string of GET /users/:id/stats/waste, both days included
+	From string `form:"from"` //2006-01-02, the start of the month 11 months before to if it's not there, so 12 months
+	To   string `form:"to"`   //today if it's not there
+}
+
+// WasteStats is what a household threw out between from and to, the lots deleted as expired or discarded.
+type WasteStats struct {
+	From         string            `json:"from"`
+	To           string            `json:"to"`
+	Total        WasteTotal        `json:"total"`
+	ByCategory   []CategoryWaste   `json:"by_category,omitempty"`   //most thrown out first
+	ByIngredient []IngredientWaste `json:"by_ingredient,omitempty"` //most thrown out first
+	ByMonth      []MonthWaste      `json:"by_month,omitempty"`      //oldest first, only the months something got thrown out
+}
+
+// WasteTotal is what some of the waste adds up to.
+type WasteTotal struct {
+	Items         int          `json:"items"` //lots
+	Expired       int          `json:"expired"`
+	Discarded     int          `json:"discarded"`
+	Amounts       []UnitAmount `json:"amounts,omitempty"` //in g, ml and pc so they add up, units we don't know as they are
+	EstimatedCost units.Amount `json:"estimated_cost"`    //of the lots somebody said what they cost
+	CostedItems   int          `json:"costed_items"`      //how many those are
+}
+
+type UnitAmount struct {
+	Amount units.Amount `json:"amount"`
+	Unit   string       `json:"unit,omitempty"`
+}
+
+type CategoryWaste struct {
+	Category string `json:"category"`
+	WasteTotal
+}
+
+type IngredientWaste struct {
+	IngredientUUID uuid.UUID `json:"ingredient_uuid,omitempty"` //empty once the ingredient is deleted
+	IngredientName string    `json:"ingredient_name"`
+	Category       string    `json:"category"`
+	WasteTotal
+}
+
+type MonthWaste struct {
+	Month string `json:"month"` //2006-01
+	WasteTotal
+}
+
+type ExpiringOptions struct { //query string of GET /users/:id/fridge_ingredients/expiring
+	Within string `form:"within,default=3d"` //days like 3d, or a duration like 12h
+}
+
+type FridgeListOptions struct { //query string of GET /users/:id/fridge_ingredients
+	GroupBy string `form:"group_by"` //empty for a flat list of lots, or ingredient
+	AsOf    string `form:"as_of"`    //RFC 3339, the fridge as it was then instead of now
+}
+
+// FridgeIngredientGroup is every lot of one ingredient in the fridge, GET /users/:id/fridge_ingredients?group_by=ingredient.
+type FridgeIngredientGroup struct {
+	IngredientUUID uuid.UUID          `json:"ingredient_uuid,omitempty"`
+	ExpirationDate time.Time          `json:"expiration_date,omitempty"` //of the lot that goes off first
+	Lots           []FridgeIngredient `json:"lots,omitempty"`            //oldest expiry first
+}
+
+type Household struct {
+	HouseholdUUID uuid.UUID         `json:"household_uuid,omitempty"`
+	HouseholdName string            `json:"household_name,omitempty"`
+	Members       []HouseholdMember `json:"members,omitempty"`
+	CreatedAt     time.Time         `json:"created_at,omitempty"`
+}
+
+type HouseholdMember struct {
+	UserUUID     uuid.UUID `json:"user_uuid,omitempty"`
+	Role         string    `json:"role,omitempty"`
+	FirstName    string    `json:"first_name,omitempty"`
+	LastName     string    `json:"last_name,omitempty"`
+	EmailAddress string    `json:"email_address,omitempty"`
+	JoinedAt     time.Time `json:"joined_at,omitempty"`
+}
+
+// HouseholdMembership is a household in the list of the caller's households.
+type HouseholdMembership struct {
+	HouseholdUUID uuid.UUID `json:"household_uuid,omitempty"`
+	HouseholdName string    `json:"household_name,omitempty"`
+	Role          string    `json:"role,omitempty"`
+	Active        bool      `json:"active"` //the fridge routes work on the active one
+	JoinedAt      time.Time `json:"joined_at,omitempty"`
+}
+
+// HouseholdInvitation is the request and the answer of POST /households/:id/invitations. The token only goes out by mail.
+type HouseholdInvitation struct {
+	HouseholdInvitationUUID uuid.UUID `json:"household_invitation_uuid,omitempty"`
+	EmailAddress            string    `json:"email_address,omitempty"`
+	Role                    string    `json:"role,omitempty"` //member or viewer, owners are made with the role route
+	ExpiresAt               time.Time `json:"expires_at,omitempty"`
+}
+
+type AcceptHouseholdInvitation struct {
+	Token string `json:"token,omitempty"`
+}
+
 type DeleteFIngr struct {
 	UserUUID       uuid.UUID `json:"user_uuid,omitempty"`
 	IngredientUUID uuid.UUID `json:"ingredient_uuid,omitempty"`
@@ -77,12 +289,155 @@ type SearchRecipes struct {
 }
 
 type RecipeIngredient struct {
-	IngredientUUID uuid.UUID `json:"ingredient_uuid,omitempty"`
-	Amount         int       `json:"amount,omitempty"`
-	Unit           string    `json:"unit,omitempty"`
+	IngredientUUID uuid.UUID    `json:"ingredient_uuid,omitempty"`
+	Amount         units.Amount `json:"amount"`
+	Unit           string       `json:"unit,omitempty"`
 }
 
 type RecipeInstruction struct {
 	StepNum     int    `json:"step_num,omitempty"`
 	Instruction string `json:"instruction,omitempty"`
 }
+
+type RecipeSuggestion struct {
+	RecipeUUID         uuid.UUID           `json:"recipe_uuid,omitempty"`
+	UserUUID           uuid.UUID           `json:"user_uuid,omitempty"`
+	RecipeName         string              `json:"recipe_name,omitempty"`
+	Category           string              `json:"category,omitempty"`
+	Coverage           float64             `json:"coverage"` //percentage of the recipe the fridge already covers. no omitempty, 0 is a real answer.
+	Score              float64             `json:"score,omitempty"`
+	Explanations       []string            `json:"explanations,omitempty"` //e.g. "uses spinach (expires in 1 day)"
+	MissingIngredients []MissingIngredient `json:"missing_ingredients,omitempty"`
+}
+
+type SuggestionOptions struct { //query string of GET /users/:id/suggestions, so the weights can change per request.
+	Mode           string  `form:"mode,default=coverage"`
+	WithinDays     int     `form:"within_days,default=3"`
+	CoverageWeight float64 `form:"coverage_weight,default=1"`
+	ExpiryWeight   float64 `form:"expiry_weight,default=1"`
+	Limit          int     `form:"limit,default=20"`
+}
+
+type MissingIngredient struct {
+	IngredientUUID uuid.UUID    `json:"ingredient_uuid,omitempty"`
+	Amount         units.Amount `json:"amount"`       //amount the recipe needs
+	AmountShort    units.Amount `json:"amount_short"` //amount still missing from the fridge
+	Unit           string       `json:"unit,omitempty"`
+}
+
+// CookRequest is POST /recipes/:id/cook.
+type CookRequest struct {
+	UserUUID uuid.UUID `json:"user_uuid,omitempty"` //who cooks, out of their active household's fridge
+	Servings float64   `json:"servings,omitempty"`  //multiplies every amount in the recipe, 1 if left out
+	DryRun   bool      `json:"dry_run,omitempty"`   //only work out what cooking would do to the fridge
+}
+
+// CookResult is what cooking did to the fridge, or would do on a dry run.
+type CookResult struct {
+	CookLogUUID uuid.UUID           `json:"cook_log_uuid,omitempty"` //not on a dry run
+	RecipeUUID  uuid.UUID           `json:"recipe_uuid,omitempty"`
+	RecipeName  string              `json:"recipe_name,omitempty"`
+	Servings    float64             `json:"servings,omitempty"`
+	DryRun      bool                `json:"dry_run"`
+	Deductions  []CookDeduction     `json:"deductions,omitempty"`
+	Shortfalls  []MissingIngredient `json:"shortfalls,omitempty"` //what the fridge doesn't have enough of, nothing gets cooked while there are any
+	CookedAt    *time.Time          `json:"cooked_at,omitempty"`
+}
+
+// CookDeduction is what cooking takes out of one lot.
+type CookDeduction struct {
+	FridgeItemUUID uuid.UUID    `json:"fridge_item_uuid,omitempty"`
+	IngredientUUID uuid.UUID    `json:"ingredient_uuid,omitempty"`
+	Amount         units.Amount `json:"amount"` //what the lot has before
+	Unit           string       `json:"unit,omitempty"`
+	AmountLeft     units.Amount `json:"amount_left"` //0 takes the lot out of the fridge
+	UnitLeft       string       `json:"unit_left,omitempty"`
+}
+
+type CookLog struct {
+	CookLogUUID   uuid.UUID `json:"cook_log_uuid,omitempty"`
+	HouseholdUUID uuid.UUID `json:"household_uuid,omitempty"`
+	RecipeUUID    uuid.UUID `json:"recipe_uuid,omitempty"` //empty once the recipe is deleted
+	RecipeName    string    `json:"recipe_name,omitempty"`
+	Servings      float64   `json:"servings,omitempty"`
+	CookedAt      time.Time `json:"cooked_at,omitempty"`
+}
+
+type LockoutEvent struct {
+	LockoutEventUUID uuid.UUID `json:"lockout_event_uuid,omitempty"`
+	Scope            string    `json:"scope,omitempty"`
+	Subject          string    `json:"subject,omitempty"`
+	Failures         int       `json:"failures,omitempty"`
+	LockedUntil      time.Time `json:"locked_until,omitempty"`
+	CreatedAt        time.Time `json:"created_at,omitempty"`
+}
+
+// UserExport is everything we keep on a user, GET /users/:id/export.
+type UserExport struct {
+	ExportedAt           time.Time             `json:"exported_at"`
+	User                 User                  `json:"user"`
+	CreatedAt            time.Time             `json:"created_at"`
+	TwoFactorEnabledAt   *time.Time            `json:"two_factor_enabled_at,omitempty"`
+	Households           []HouseholdMembership `json:"households"`         //no omitempty on the lists, an empty list says there's nothing
+	FridgeIngredients    []FridgeIngredient    `json:"fridge_ingredients"` //what the user put in any of their households' fridges
+	FridgeEvents         []FridgeEvent         `json:"fridge_events"`      //everything the user did in a fridge, households they left too
+	Recipes              []Recipe              `json:"recipes"`
+	CookLogs             []CookLog             `json:"cook_logs"`
+	Identities           []UserIdentity        `json:"identities"`
+	PersonalAccessTokens []PersonalAccessToken `json:"personal_access_tokens"`
+	Sessions             []Session             `json:"sessions"`
+	DigestSettings       *DigestSettings       `json:"digest_settings,omitempty"` //none if they never set any
+}
+
+// FridgeEvent is something that happened to a lot in a fridge, as the export has it.
+type FridgeEvent struct {
+	FridgeEventUUID uuid.UUID     `json:"fridge_event_uuid,omitempty"`
+	EventType       string        `json:"event_type,omitempty"` //add, update, move, open, consume or delete
+	HouseholdUUID   uuid.UUID     `json:"household_uuid,omitempty"`
+	FridgeItemUUID  uuid.UUID     `json:"fridge_item_uuid,omitempty"`
+	IngredientUUID  uuid.UUID     `json:"ingredient_uuid,omitempty"`
+	IngredientName  string        `json:"ingredient_name,omitempty"` //as it was when it happened
+	Category        string        `json:"category,omitempty"`
+	Amount          units.Amount  `json:"amount"`
+	Unit            string        `json:"unit,omitempty"`
+	PurchasedDate   *time.Time    `json:"purchased_date,omitempty"` //none on deletes from before the ledger
+	ExpirationDate  *time.Time    `json:"expiration_date,omitempty"`
+	Location        string        `json:"location,omitempty"`
+	OpenedDate      *time.Time    `json:"opened_date,omitempty"`
+	Reason          string        `json:"reason,omitempty"` //only on deletes
+	EstimatedCost   *units.Amount `json:"estimated_cost,omitempty"`
+	CreatedAt       time.Time     `json:"created_at,omitempty"`
+}
+
+type UserIdentity struct {
+	Provider     string     `json:"provider,omitempty"`
+	Subject      string     `json:"subject,omitempty"`
+	EmailAddress string     `json:"email_address,omitempty"`
+	CreatedAt    time.Time  `json:"created_at,omitempty"`
+	LastLoginAt  *time.Time `json:"last_login_at,omitempty"`
+}
+
+// Session is one refresh token. Every refresh makes a new one in the same family, so they're the login history too.
+type Session struct {
+	FamilyUUID uuid.UUID  `json:"family_uuid,omitempty"` //one per login
+	CreatedAt  time.Time  `json:"created_at,omitempty"`
+	ExpiresAt  time.Time  `json:"expires_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+// AccountDeletion is the answer to DELETE /users/:id. Until DeleteAfter, reactivating the account calls it off.
+type AccountDeletion struct {
+	DeleteAfter time.Time `json:"delete_after,omitempty"`
+}
+
+// DigestSettings is GET and POST /users/:id/digest_settings, when and how the daily digest of what's about to go off
+// arrives. Empty fields get the defaults, 08:00 UTC by email for what goes off within 3 days.
+type DigestSettings struct {
+	UserUUID   uuid.UUID `json:"user_uuid,omitempty"`
+	Enabled    bool      `json:"enabled"`
+	Time       string    `json:"time,omitempty"`        //local time of day, 08:00
+	Timezone   string    `json:"timezone,omitempty"`    //IANA name, Asia/Seoul
+	Channel    string    `json:"channel,omitempty"`     //email or webhook
+	WebhookURL string    `json:"webhook_url,omitempty"` //https only, for the webhook channel
+	WithinDays int       `json:"within_days,omitempty"`
+}
@@ -0,0 +1,236 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"wdiet/oidc"
+	"wdiet/store"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// OIDCLogin sends the user to their provider to log in. What we need to check the answer (state, nonce and the PKCE
+// verifier) waits in the store for OIDCCallback.
+func (s *Service) OIDCLogin(c *gin.Context) {
+	l := s.l.Named("OIDCLogin")
+
+	p, ok := s.providers[c.Param("provider")]
+	if !ok {
+		l.Info("error starting oidc login, unknown provider", zap.String("provider", c.Param("provider")))
+		c.Status(http.StatusNotFound)
+		return
+	}
+
+	state, err := newOpaqueToken()
+	if err != nil {
+		l.Error("error creating oidc state", zap.Error(err))
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	nonce, err := newOpaqueToken()
+	if err != nil {
+		l.Error("error creating oidc nonce", zap.Error(err))
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	verifier, err := oidc.NewVerifier()
+	if err != nil {
+		l.Error("error creating pkce verifier", zap.Error(err))
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	authURL, err := p.AuthCodeURL(context.Background(), state, nonce, verifier)
+	if err != nil {
+		l.Error("error building authorization url", zap.Error(err)) //most likely the provider's discovery is down
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	if _, err := s.db.CreateOIDCState(context.Background(), store.OIDCState{
+		HashedState:  hashToken(state),
+		Provider:     p.Name(),
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		ExpiresAt:    s.now().Add(oidcStateTTL),
+	}); err != nil {
+		l.Error("error creating oidc state", zap.Error(err))
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// OIDCCallback is where the provider sends the user back. The code is swapped for an ID token, and the identity in it
+// logs in the user it's linked to, gets linked to the user with the same verified email, or signs up a new user.
+func (s *Service) OIDCCallback(c *gin.Context) {
+	l := s.l.Named("OIDCCallback")
+
+	p, ok := s.providers[c.Param("provider")]
+	if !ok {
+		l.Info("error finishing oidc login, unknown provider", zap.String("provider", c.Param("provider")))
+		c.Status(http.StatusNotFound)
+		return
+	}
+
+	if e := c.Query("error"); e != "" { //the user said no at the provider, or the provider didn't like our request
+		l.Info("error finishing oidc login, provider returned an error", zap.String("error", e), zap.String("description", c.Query("error_description")))
+		c.Status(http.StatusUnauthorized)
+		return
+	}
+
+	code, state := c.Query("code"), c.Query("state")
+	if code == "" || state == "" {
+		l.Info("error finishing oidc login, missing code or state")
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	st, err := s.db.UseOIDCState(context.Background(), hashToken(state))
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) { //used already, or never ours. either way somebody's replaying or forging
+			l.Info("error finishing oidc login, unknown state", zap.Error(err))
+			c.Status(http.StatusUnauthorized)
+			return
+		}
+		l.Error("error using oidc state", zap.Error(err))
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	if st.Provider != p.Name() || !s.now().Before(st.ExpiresAt) {
+		l.Info("error finishing oidc login, state expired or for another provider")
+		c.Status(http.StatusUnauthorized)
+		return
+	}
+
+	rawIDToken, err := p.Exchange(context.Background(), code, st.CodeVerifier)
+	if err != nil {
+		if errors.Is(err, oidc.ErrExchange) {
+			l.Info("error finishing oidc login", zap.Error(err))
+			c.Status(http.StatusUnauthorized)
+			return
+		}
+		l.Error("error exchanging oidc code", zap.Error(err))
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	identity, err := p.VerifyIDToken(context.Background(), rawIDToken, st.Nonce)
+	if err != nil {
+		if errors.Is(err, oidc.ErrInvalidToken) {
+			l.Info("error finishing oidc login", zap.Error(err))
+			c.Status(http.StatusUnauthorized)
+			return
+		}
+		l.Error("error verifying id token", zap.Error(err))
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	user, ok := s.oidcUser(c, l, p.Name(), identity)
+	if !ok {
+		return
+	}
+
+	if !user.Active {
+		l.Info("error finishing oidc login, user is deactivated")
+		c.Status(http.StatusForbidden)
+		return
+	}
+
+	s.finishLogin(c, l, user)
+}
+
+// oidcUser finds or makes the user behind identity. If it returns false it has written the response.
+func (s *Service) oidcUser(c *gin.Context, l *zap.Logger, provider string, identity *oidc.Identity) (*store.User, bool) {
+	linked, err := s.db.UseUserIdentity(context.Background(), provider, identity.Subject)
+	switch {
+	case err == nil:
+		user, err := s.db.GetUser(context.Background(), linked.UserUUID)
+		if err != nil {
+			l.Error("error getting linked user", zap.Error(err))
+			c.Status(http.StatusInternalServerError)
+			return nil, false
+		}
+		return user, true
+	case !errors.Is(err, store.ErrNotFound):
+		l.Error("error getting user identity", zap.Error(err))
+		c.Status(http.StatusInternalServerError)
+		return nil, false
+	}
+
+	//not linked yet. all we can go by is the email, and only if the provider vouches for it
+	if identity.Email == "" || !identity.EmailVerified {
+		l.Info("error finishing oidc login, provider didn't verify the email")
+		c.Status(http.StatusForbidden)
+		return nil, false
+	}
+
+	link := store.UserIdentity{Provider: provider, Subject: identity.Subject, EmailAddress: identity.Email}
+
+	user, err := s.db.GetUserByEmail(context.Background(), identity.Email)
+	switch {
+	case err == nil:
+		//an unverified account could be somebody else's squatting on the address, linking it would hand that account
+		//to the address' owner with whatever the squatter set up in it. they have to verify or reset the password first
+		if user.EmailVerifiedAt == nil {
+			l.Info("error finishing oidc login, account with that email isn't verified")
+			c.Status(http.StatusConflict)
+			return nil, false
+		}
+
+		link.UserUUID = user.UserUUID
+		if _, err := s.db.CreateUserIdentity(context.Background(), link); err != nil {
+			if errors.Is(err, store.ErrConflict) { //linked to another login at this provider already
+				l.Info("error finishing oidc login, user already has an identity at the provider", zap.Error(err))
+				c.Status(http.StatusConflict)
+				return nil, false
+			}
+			l.Error("error creating user identity", zap.Error(err))
+			c.Status(http.StatusInternalServerError)
+			return nil, false
+		}
+
+		return user, true
+	case !errors.Is(err, store.ErrNotFound):
+		l.Error("error getting user", zap.Error(err))
+		c.Status(http.StatusInternalServerError)
+		return nil, false
+	}
+
+	password, err := newOpaqueToken() //nobody gets to know it. a password reset sets a real one if they want one
+	if err != nil {
+		l.Error("error generating password", zap.Error(err))
+		c.Status(http.StatusInternalServerError)
+		return nil, false
+	}
+
+	hashedPassword, err := s.hasher.Hash(password)
+	if err != nil {
+		l.Error("error generating hashed password", zap.Error(err))
+		c.Status(http.StatusInternalServerError)
+		return nil, false
+	}
+
+	user, err = s.db.CreateUserWithIdentity(context.Background(), store.User{
+		HashedPassword: hashedPassword,
+		Active:         true,
+		FirstName:      identity.GivenName,
+		LastName:       identity.FamilyName,
+		EmailAddress:   strings.TrimSpace(identity.Email),
+	}, link)
+	if err != nil {
+		l.Error("error creating user with identity", zap.Error(err))
+		c.Status(http.StatusInternalServerError)
+		return nil, false
+	}
+
+	return user, true
+}
@@ -1,35 +1,113 @@
 package service
 
+import "wdiet/store"
+
 func (s *Service) registerRoutes() {
 	s.r.GET("/ping", s.Ping)
+	s.r.GET("/.well-known/jwks.json", s.JWKS)
 
 	s.r.POST("/login", s.Login)
+	s.r.POST("/login/2fa", s.LoginTwoFactor)
+	s.r.POST("/token/refresh", s.RefreshToken)
+
+	s.r.GET("/oidc/:provider/login", s.OIDCLogin)
+	s.r.GET("/oidc/:provider/callback", s.OIDCCallback)
 
 	s.r.POST("/users", s.CreateUser)
+	s.r.POST("/users/:id/reactivate", s.ReactivateUser)
+
+	s.r.POST("/password_reset", s.RequestPasswordReset)
+	s.r.GET("/password_reset/confirm", s.PasswordResetForm)
+	s.r.POST("/password_reset/confirm", s.ConfirmPasswordReset)
 
 	s.r.POST("/ingredients/search", s.SearchIngredients)
 
+	s.r.GET("/users/verify", s.VerifyEmail)
+
 	authorized := s.r.Group("/")
 	authorized.Use(s.ValidateToken)
+
+	session := authorized.Group("/")
+	session.Use(s.RequireSession)
+	{ //unverified users get these, enough to look at and fix their account
+		session.POST("/logout", s.Logout)
+
+		session.GET("/users/:id", s.GetUser)
+		session.POST("/users/:id", s.UpdateUser)
+		session.POST("/users/:id/deactivate", s.DeactivateUser)
+		session.DELETE("/users/:uid", s.DeleteUser)
+		session.GET("/users/:id/export", s.ExportUser)
+		session.POST("/users/:id/password", s.ChangePassword)
+		session.POST("/users/:id/verification", s.ResendVerification)
+
+		session.POST("/users/:id/2fa", s.StartTwoFactor)
+		session.POST("/users/:id/2fa/confirm", s.ConfirmTwoFactor)
+		session.DELETE("/users/:uid/2fa", s.DisableTwoFactor)
+
+		session.GET("/users/:id/tokens", s.ListPersonalAccessTokens)
+		session.POST("/users/:id/tokens", s.CreatePersonalAccessToken)
+		session.DELETE("/users/:uid/tokens/:tid", s.DeletePersonalAccessToken)
+	}
+
+	admin := session.Group("/admin")
+	admin.Use(s.RequireRole(store.RoleAdmin))
+	{
+		admin.GET("/lockout_events", s.ListLockoutEvents)
+		admin.POST("/users/:id/role", s.SetUserRole)
+	}
+
+	verified := authorized.Group("/")
+	verified.Use(s.RequireVerifiedEmail)
+	{ //personal access tokens get these if they have the scope
+		verified.GET("/ingredients/:id", s.RequireScope(scopeIngredientsRead), s.GetIngredient)
+
+		verified.GET("/users/:id/fridge_ingredients", s.RequireScope(scopeFridgeRead), s.ListFridgeIngredients)
+		verified.GET("/users/:id/fridge_ingredients/expiring", s.RequireScope(scopeFridgeRead), s.ListExpiringFridgeIngredients)
+		verified.POST("/fridge_ingredients", s.RequireScope(scopeFridgeWrite), s.CreateFridgeIngredient)
+		verified.POST("/fridge_ingredients/:id", s.RequireScope(scopeFridgeWrite), s.UpdateFridgeIngredient)
+		verified.POST("/fridge_ingredients/:id/move", s.RequireScope(scopeFridgeWrite), s.MoveFridgeIngredient)
+		verified.POST("/fridge_ingredients/:id/open", s.RequireScope(scopeFridgeWrite), s.OpenFridgeIngredient)
+		verified.DELETE("/users/:uid/fridge_ingredients/:fid", s.RequireScope(scopeFridgeWrite), s.DeleteFridgeIngredient)
+		verified.POST("/users/:id/ingredients/:iid/consume", s.RequireScope(scopeFridgeWrite), s.ConsumeFridgeIngredient) //an ingredient, not a lot like /fridge_ingredients/:id
+
+		verified.GET("/recipes/:id", s.RequireScope(scopeRecipesRead), s.GetRecipe)
+		verified.GET("/users/:id/recipes", s.RequireScope(scopeRecipesRead), s.ListRecipes)
+		verified.POST("/recipes/search", s.RequireScope(scopeRecipesRead), s.SearchRecipes)
+		verified.POST("/recipes", s.RequireScope(scopeRecipesWrite), s.CreateRecipe)
+		verified.POST("/recipes/:id", s.RequireScope(scopeRecipesWrite), s.UpdateRecipe)
+		verified.DELETE("/recipes/:id", s.RequireScope(scopeRecipesWrite), s.DeleteRecipe)
+		verified.POST("/recipes/:id/cook", s.RequireScope(scopeFridgeWrite), s.CookRecipe)
+
+		verified.GET("/users/:id/suggestions", s.RequireScope(scopeRecipesRead), s.SuggestRecipes)
+
+		verified.GET("/users/:id/stats/waste", s.RequireScope(scopeFridgeRead), s.GetWasteStats)
+	}
+
+	households := verified.Group("/")
+	households.Use(s.RequireSession)
+	{ //who shares which fridge is managed with a session, personal access tokens only get at the fridge itself
+		households.POST("/households", s.CreateHousehold)
+		households.GET("/households/:id", s.GetHousehold)
+		households.GET("/users/:id/households", s.ListHouseholds)
+		households.POST("/users/:id/active_household", s.SetActiveHousehold)
+		households.POST("/households/:id/invitations", s.CreateHouseholdInvitation)
+		households.POST("/household_invitations/accept", s.AcceptHouseholdInvitation)
+		households.POST("/households/:id/members/:uid/role", s.SetHouseholdMemberRole)
+		households.DELETE("/households/:id/members/:uid", s.RemoveHouseholdMember)
+	}
+
+	digests := verified.Group("/")
+	digests.Use(s.RequireSession)
+	{ //a token that can read the fridge doesn't get to send what's in it somewhere else
+		digests.GET("/users/:id/digest_settings", s.GetDigestSettings)
+		digests.POST("/users/:id/digest_settings", s.SetDigestSettings)
+	}
+
+	catalog := verified.Group("/") //the ingredient catalog is shared by everyone, so not everyone gets to change it
+	catalog.Use(s.RequireRole(store.RoleModerator, store.RoleAdmin))
 	{
-		authorized.GET("/users/:id", s.GetUser)
-		authorized.POST("/users/:id", s.UpdateUser)
-
-		authorized.GET("/ingredients/:id", s.GetIngredient)
-		authorized.POST("/ingredients", s.CreateIngredient)
-		authorized.POST("/ingredients/:id", s.UpdateIngredient)
-		authorized.DELETE("/ingredients/:id", s.DeleteIngredient)
-
-		authorized.GET("/users/:id/fridge_ingredients", s.ListFridgeIngredients)
-		authorized.POST("/fridge_ingredients", s.CreateFridgeIngredient)
-		authorized.POST("/fridge_ingredients/:id", s.UpdateFridgeIngredient)
-		authorized.DELETE("/users/:uid/fridge_ingredients/:fid", s.DeleteFridgeIngredient)
-
-		authorized.GET("/recipes/:id", s.GetRecipe)
-		authorized.GET("/users/:id/recipes", s.ListRecipes)
-		authorized.POST("/recipes/search", s.SearchRecipes)
-		authorized.POST("/recipes", s.CreateRecipe)
-		authorized.POST("/recipes/:id", s.UpdateRecipe)
-		authorized.DELETE("/recipes/:id", s.DeleteRecipe)
+		catalog.POST("/ingredients", s.RequireScope(scopeIngredientsWrite), s.CreateIngredient)
+		catalog.POST("/ingredients/:id", s.RequireScope(scopeIngredientsWrite), s.UpdateIngredient)
+		catalog.DELETE("/ingredients/:id", s.RequireScope(scopeIngredientsWrite), s.DeleteIngredient)
 	}
 }
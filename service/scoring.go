@@ -0,0 +1,88 @@
+package service
+
+import (
+	"fmt"
+	"math/big"
+	"time"
+	"wdiet/store"
+	"wdiet/units"
+)
+
+const (
+	suggestionModeCoverage = "coverage" //best coverage first
+	suggestionModeExpiring = "expiring" //ranks by score too, so food about to go off gets used first
+)
+
+// explainSuggestion says which of r's ingredients made it rank higher in the expiring mode: every one that's in the
+// fridge and expires within withinDays, e.g. "uses spinach (expires in 1 day)". The db does the scoring itself, see
+// store.SuggestionQuery, this only has to agree with it on which lots count. Food that has already expired is left out,
+// we don't want to suggest cooking with it, but a lot of the same ingredient that's still good does count.
+func explainSuggestion(r *store.RecipeSuggestion, withinDays int, now time.Time) []string {
+	var explanations []string
+
+	for _, ingr := range r.Ingredients {
+		daysLeft, ok := daysUntilExpiry(ingr, now)
+		if !ok || daysLeft > withinDays {
+			continue
+		}
+
+		explanations = append(explanations, fmt.Sprintf("uses %s (%s)", ingr.IngredientName, expiresIn(daysLeft)))
+	}
+
+	return explanations
+}
+
+// available adds up what the fridge has of ingr that's still good at now, in the unit the recipe wants it in. Whatever
+// has expired or is in a unit that doesn't convert to that one doesn't count.
+func available(ingr store.SuggestionIngredient, now time.Time) *big.Rat {
+	sum := new(big.Rat)
+
+	for _, a := range ingr.Available {
+		if !a.ExpirationDate.After(now) {
+			continue
+		}
+
+		if amount, err := units.ConvertNamed(a.Amount.Rat(), a.Unit, ingr.Unit, ingr.Density); err == nil {
+			sum.Add(sum, amount)
+		}
+	}
+
+	return sum
+}
+
+// daysUntilExpiry is how many days the first lot of ingr that hasn't expired at now has left, false if there's none.
+// Expired is the same as in available, so what counts for coverage and for urgency is the same food.
+func daysUntilExpiry(ingr store.SuggestionIngredient, now time.Time) (int, bool) {
+	var first time.Time
+
+	for _, a := range ingr.Available {
+		if a.ExpirationDate.After(now) && (first.IsZero() || a.ExpirationDate.Before(first)) {
+			first = a.ExpirationDate
+		}
+	}
+
+	if first.IsZero() {
+		return 0, false
+	}
+
+	return daysUntil(first, now), true
+}
+
+// daysUntil counts calendar days, not 24h blocks, so something expiring tonight is "today" and not "in 0.3 days".
+func daysUntil(t time.Time, now time.Time) int {
+	y, m, d := t.UTC().Date()
+	ny, nm, nd := now.UTC().Date()
+
+	return int(time.Date(y, m, d, 0, 0, 0, 0, time.UTC).Sub(time.Date(ny, nm, nd, 0, 0, 0, 0, time.UTC)).Hours() / 24)
+}
+
+func expiresIn(days int) string {
+	switch days {
+	case 0:
+		return "expires today"
+	case 1:
+		return "expires in 1 day"
+	}
+
+	return fmt.Sprintf("expires in %d days", days)
+}
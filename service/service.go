@@ -1,25 +1,66 @@
 package service
 
 import (
+	"context"
+	"errors"
+	"time"
+	"wdiet/hasher"
+	"wdiet/lockout"
+	"wdiet/mailer"
+	"wdiet/notifier"
+	"wdiet/oidc"
 	"wdiet/store"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
 	"go.uber.org/zap"
 )
 
 type Service struct {
-	r               *gin.Engine
-	db              store.Store
-	l               *zap.Logger
-	mySigningKey    []byte
-	mySigningMethod jwt.SigningMethod
+	r         *gin.Engine
+	db        store.Store
+	l         *zap.Logger
+	keys      *KeySet
+	hasher    hasher.PasswordHasher
+	dummyHash string //what unknown emails get checked against
+	lockout   *lockout.Tracker
+	now       func() time.Time //time.Now, tests pin it
+
+	mailer    mailer.Mailer
+	publicURL string
+
+	digestChannels map[string]notifier.Channel //by the name users pick in their digest settings
+
+	providers map[string]*oidc.Provider //openid providers users can log in with, by name
+
+	deletionGracePeriod time.Duration
 }
 
-func New(s store.Store, l *zap.Logger) *Service {
-	newService := &Service{r: gin.Default(), db: s, l: l}
-	newService.mySigningKey = []byte("jyoonieisthebestandsheisprettyandsheissmart") //signing key는 HS512의 경우 80자 권장..ㄷㄷ 길수록 좋음
-	newService.mySigningMethod = jwt.SigningMethodHS512
+func New(s store.Store, l *zap.Logger, cfg Config) *Service {
+	newService := &Service{r: gin.Default(), db: s, l: l, keys: cfg.Keys, hasher: cfg.Hasher, lockout: cfg.Lockout, now: time.Now, mailer: cfg.Mailer, publicURL: cfg.PublicURL, deletionGracePeriod: cfg.DeletionGracePeriod, digestChannels: cfg.DigestChannels}
+
+	if err := newService.r.SetTrustedProxies(cfg.TrustedProxies); err != nil { //gin trusts everyone unless told otherwise
+		l.Fatal("error setting trusted proxies", zap.Error(err))
+	}
+
+	if newService.deletionGracePeriod <= 0 {
+		newService.deletionGracePeriod = defaultDeletionGracePeriod
+	}
+
+	if newService.lockout == nil {
+		newService.lockout = lockout.New(lockout.NewMemory(), lockout.DefaultAccountPolicy, lockout.DefaultIPPolicy)
+	}
+
+	newService.providers = make(map[string]*oidc.Provider, len(cfg.OIDCProviders))
+	for _, p := range cfg.OIDCProviders {
+		newService.providers[p.Name] = oidc.New(p, nil)
+	}
+
+	dummyHash, err := cfg.Hasher.Hash(uuid.NewString())
+	if err != nil {
+		l.Fatal("error creating dummy password hash", zap.Error(err))
+	}
+	newService.dummyHash = dummyHash
 
 	newService.registerRoutes()
 
@@ -29,7 +70,49 @@ func New(s store.Store, l *zap.Logger) *Service {
 func (s *Service) Run() {
 	l := s.l.Named("Run") //logger specifically created for this function
 
+	go s.purgeDeletedUsersEvery(context.Background(), purgeInterval)
+	go s.sendDigestsEvery(context.Background(), digestInterval)
+
 	if err := s.r.Run(); err != nil {
 		l.Fatal("service failed to start", zap.Error(err))
 	}
 }
+
+// purgeDeletedUsersEvery runs purgeDeletedUsers every interval until ctx is done.
+func (s *Service) purgeDeletedUsersEvery(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		s.purgeDeletedUsers(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// purgeDeletedUsers erases the accounts whose grace period is over. It returns how many it erased.
+func (s *Service) purgeDeletedUsers(ctx context.Context) int {
+	l := s.l.Named("purgeDeletedUsers")
+
+	due, err := s.db.ListUsersDueForDeletion(ctx, s.now())
+	if err != nil {
+		l.Error("error listing users due for deletion", zap.Error(err))
+		return 0
+	}
+
+	purged := 0
+	for _, uid := range due {
+		if err := s.db.DeleteUser(ctx, uid); err != nil && !errors.Is(err, store.ErrNotFound) { //not found is somebody else got there first
+			l.Error("error deleting user", zap.String("user_uuid", uid.String()), zap.Error(err))
+			continue
+		}
+		l.Info("deleted user", zap.String("user_uuid", uid.String()))
+		purged++
+	}
+
+	return purged
+}
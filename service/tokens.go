@@ -0,0 +1,143 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+	"wdiet/store"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+)
+
+const (
+	accessTokenTTL  = 15 * time.Minute //짧게. 길게 쓰고 싶으면 refresh token으로 새로 받으면 됨
+	refreshTokenTTL = 30 * 24 * time.Hour
+
+	passwordResetTTL     = time.Hour
+	emailVerificationTTL = 48 * time.Hour
+
+	loginChallengeTTL     = 5 * time.Minute
+	loginChallengeRetries = 5 //wrong codes per challenge, then it's back to the password
+	recoveryCodeCount     = 10
+
+	oidcStateTTL = 10 * time.Minute //long enough to type a password at the provider
+
+	reauthWindow = 10 * time.Minute //how recent a login has to be to delete the account or turn off 2fa without the password
+
+	householdInvitationTTL = 7 * 24 * time.Hour
+
+	totpIssuer = "whatDoIEatToday" //what authenticator apps show the account under
+)
+
+// Claims is what goes in our access tokens.
+type Claims struct {
+	Role     string           `json:"role,omitempty"`      //the user's role when the token was signed, ValidateToken checks it's still current
+	AuthTime *jwt.NumericDate `json:"auth_time,omitempty"` //when the user logged in, like openid's. only tokens from a login have it, not refreshed ones
+	jwt.RegisteredClaims
+}
+
+// validAt is the claims validation jwt.Parse does, expiry, issued at and not before, at now instead of time.Now.
+func (c *Claims) validAt(now time.Time) bool {
+	return c.VerifyExpiresAt(now, false) && c.VerifyIssuedAt(now, false) && c.VerifyNotBefore(now, false)
+}
+
+// signAccessToken signs an access token for the user uid with the role role. The user goes in the subject and every token gets
+// its own jti, so a single token can be revoked on logout without touching the user's other sessions. login is true when the
+// user just logged in, with a password, a provider or a second factor, and false for a refresh.
+func (s *Service) signAccessToken(uid uuid.UUID, role string, login bool) (string, error) {
+	now := s.now()
+
+	var authTime *jwt.NumericDate
+	if login {
+		authTime = jwt.NewNumericDate(now)
+	}
+
+	claims := Claims{
+		Role:     role,
+		AuthTime: authTime,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(now.Add(accessTokenTTL)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			Issuer:    "whatDoIEatToday",
+			Subject:   uid.String(),
+			ID:        uuid.NewString(),
+			Audience:  []string{"whatDoIEatToday"},
+		},
+	}
+
+	return s.keys.sign(claims)
+}
+
+// issueRefreshToken creates a refresh token for uid in the family familyID. If rotated is not nil, that token gets revoked
+// and replaced by the new one. The returned string is the only copy of the token, the db only keeps its hash.
+func (s *Service) issueRefreshToken(ctx context.Context, uid, familyID uuid.UUID, rotated *store.RefreshToken) (string, error) {
+	token, err := newOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+
+	next := store.RefreshToken{
+		FamilyUUID:  familyID,
+		UserUUID:    uid,
+		HashedToken: hashToken(token),
+		ExpiresAt:   s.now().Add(refreshTokenTTL),
+	}
+
+	if rotated != nil {
+		_, err = s.db.RotateRefreshToken(ctx, rotated.RefreshTokenUUID, next)
+	} else {
+		_, err = s.db.CreateRefreshToken(ctx, next)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// newOpaqueToken returns 32 random bytes, url safe base64 encoded.
+func newOpaqueToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("error generating token: %w", err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashToken is how opaque tokens are stored and looked up. They're random enough that a plain sha256 is fine, no need for bcrypt.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// newRecoveryCodes returns recoveryCodeCount codes like "k3j9a-x2mqp". 50 random bits each, like tokens they only get sha256'd.
+func newRecoveryCodes() ([]string, error) {
+	codes := make([]string, recoveryCodeCount)
+
+	for i := range codes {
+		b := make([]byte, 7)
+		if _, err := rand.Read(b); err != nil {
+			return nil, fmt.Errorf("error generating recovery code: %w", err)
+		}
+
+		code := strings.ToLower(base32.StdEncoding.EncodeToString(b))[:10]
+		codes[i] = code[:5] + "-" + code[5:]
+	}
+
+	return codes, nil
+}
+
+// hashRecoveryCode hashes a recovery code the way it was typed, people leave out the dash or use caps.
+func hashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	return hashToken(code)
+}
@@ -1,6 +1,16 @@
 package service
 
 import (
+	"math"
+	"net/url"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+	"wdiet/shelflife"
+	"wdiet/store"
+	"wdiet/units"
+
 	"github.com/google/uuid"
 )
 
@@ -12,6 +22,54 @@ func isValidLoginRequest(l Login) bool {
 	return true
 }
 
+func isValidReactivationRequest(r Reactivation) bool {
+	return isValidLoginRequest(Login{EmailAddress: r.EmailAddress, Password: r.Password})
+}
+
+func isValidTwoFactorLoginRequest(t TwoFactorLogin) bool {
+	if t.ChallengeToken == "" || t.Code == "" {
+		return false
+	}
+
+	return true
+}
+
+func isValidRefreshTokenRequest(r RefreshToken) bool {
+	if r.RefreshToken == "" {
+		return false
+	}
+
+	return true
+}
+
+func isValidUserRoleRequest(r UserRole) bool {
+	return store.IsValidRole(r.Role)
+}
+
+// isValidCreatePersonalAccessTokenRequest wants a name, at least one known scope and, if there's an expiry, one after now.
+func isValidCreatePersonalAccessTokenRequest(t PersonalAccessToken, now time.Time) bool {
+	switch {
+	case t.PersonalAccessTokenUUID != uuid.Nil, t.Token != "", t.LastUsedAt != nil:
+		return false
+	case strings.TrimSpace(t.Name) == "", utf8.RuneCountInString(t.Name) > 64:
+		return false
+	case len(t.Scopes) == 0:
+		return false
+	case t.ExpiresAt != nil && !t.ExpiresAt.After(now):
+		return false
+	}
+
+	seen := make(map[string]bool, len(t.Scopes))
+	for _, scope := range t.Scopes {
+		if !validScopes[scope] || seen[scope] {
+			return false
+		}
+		seen[scope] = true
+	}
+
+	return true
+}
+
 func isValidCreateUserRequest(u User, pwd string) bool {
 	switch {
 	case u.UserUUID != uuid.Nil:
@@ -22,7 +80,84 @@ func isValidCreateUserRequest(u User, pwd string) bool {
 		return false
 	case u.EmailAddress == "":
 		return false
-	case pwd == "":
+	case !isStrongPassword(pwd, passwordPersonal(u.EmailAddress, u.FirstName, u.LastName)...):
+		return false
+	}
+
+	return true
+}
+
+const (
+	minPasswordLength = 10 //characters
+	maxPasswordLength = 72 //bytes, bcrypt ignores everything after that
+)
+
+// isStrongPassword is the password policy: 10 characters or more, at least two kinds out of lowercase, uppercase, digits
+// and symbols, and not built around personal, e.g. the user's name or the local part of their email.
+func isStrongPassword(pwd string, personal ...string) bool {
+	if utf8.RuneCountInString(pwd) < minPasswordLength || len(pwd) > maxPasswordLength {
+		return false
+	}
+
+	var lower, upper, digit, other int
+	for _, r := range pwd {
+		switch {
+		case unicode.IsLower(r):
+			lower = 1
+		case unicode.IsUpper(r):
+			upper = 1
+		case unicode.IsDigit(r):
+			digit = 1
+		default:
+			other = 1
+		}
+	}
+	if lower+upper+digit+other < 2 {
+		return false
+	}
+
+	for _, p := range personal {
+		if len(p) >= 3 && strings.Contains(strings.ToLower(pwd), strings.ToLower(p)) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// passwordPersonal is what a user's password can't be built around, see isStrongPassword.
+func passwordPersonal(email, firstName, lastName string) []string {
+	return []string{strings.Split(email, "@")[0], firstName, lastName}
+}
+
+// isValidChangePasswordRequest checks the new password against personal, the user's passwordPersonal.
+func isValidChangePasswordRequest(p ChangePassword, personal ...string) bool {
+	switch {
+	case p.CurrentPassword == "":
+		return false
+	case p.NewPassword == p.CurrentPassword:
+		return false
+	case !isStrongPassword(p.NewPassword, personal...):
+		return false
+	}
+
+	return true
+}
+
+func isValidPasswordResetRequest(p PasswordReset) bool {
+	if p.EmailAddress == "" {
+		return false
+	}
+
+	return true
+}
+
+// isValidConfirmPasswordResetRequest checks the new password against personal, the user's passwordPersonal.
+func isValidConfirmPasswordResetRequest(p ConfirmPasswordReset, personal ...string) bool {
+	switch {
+	case p.Token == "":
+		return false
+	case !isStrongPassword(p.NewPassword, personal...):
 		return false
 	}
 
@@ -62,7 +197,9 @@ func isValidCreateIngrRequest(i Ingredient) bool {
 		return false
 	case !isCategory(i.Category):
 		return false
-	case i.DaysUntilExp < 0:
+	case i.DaysUntilExp < 0, i.FreezerDays < 0, i.PantryDays < 0, i.OpenedDays < 0:
+		return false
+	case i.Density < 0: //0 is we don't know
 		return false
 	}
 
@@ -104,7 +241,9 @@ func isValidUpdateIngrRequest(i Ingredient, uidFromPath uuid.UUID) bool {
 		return false
 	case !isCategory(i.Category):
 		return false
-	case i.DaysUntilExp < 0:
+	case i.DaysUntilExp < 0, i.FreezerDays < 0, i.PantryDays < 0, i.OpenedDays < 0:
+		return false
+	case i.Density < 0: //0 is we don't know
 		return false
 	}
 
@@ -113,44 +252,175 @@ func isValidUpdateIngrRequest(i Ingredient, uidFromPath uuid.UUID) bool {
 
 func isValidCreateFIngrRequest(f FridgeIngredient) bool {
 	switch {
+	case f.FridgeItemUUID != uuid.Nil: //every create is a new lot
+		return false
+	case f.HouseholdUUID != uuid.Nil: //it goes in the active household, switch households to fill another fridge
+		return false
 	case f.UserUUID == uuid.Nil:
 		return false
 	case f.IngredientUUID == uuid.Nil:
 		return false
-	case f.Amount <= 0:
+	case f.Amount.Sign() <= 0:
 		return false
-	case f.Unit == "":
+	case !units.IsKnown(f.Unit):
 		return false
 	case f.PurchasedDate.IsZero():
 		return false
 	case !f.ExpirationDate.IsZero():
 		return false
+	case f.Location != "" && !shelflife.IsLocation(shelflife.Location(f.Location)):
+		return false
+	case f.OpenedDate != nil && f.OpenedDate.Before(f.PurchasedDate):
+		return false
 	}
 
 	return true
 }
 
-func isValidUpdateFIngrRequest(f FridgeIngredient, uidFromPath uuid.UUID) bool {
+func isValidUpdateFIngrRequest(f FridgeIngredient, fidFromPath uuid.UUID) bool {
 	switch {
-	case uidFromPath != f.IngredientUUID:
+	case fidFromPath != f.FridgeItemUUID:
+		return false
+	case f.FridgeItemUUID == uuid.Nil:
+		return false
+	case f.HouseholdUUID != uuid.Nil:
 		return false
 	case f.UserUUID == uuid.Nil:
 		return false
 	case f.IngredientUUID == uuid.Nil:
 		return false
-	case f.Amount <= 0:
+	case f.Amount.Sign() <= 0:
 		return false
-	case f.Unit == "":
+	case !units.IsKnown(f.Unit):
 		return false
 	case f.PurchasedDate.IsZero():
 		return false
 	case !f.ExpirationDate.IsZero(): //always validate the data like the front end is retarded
 		return false
+	case f.Location != "" && !shelflife.IsLocation(shelflife.Location(f.Location)):
+		return false
+	case f.OpenedDate != nil && f.OpenedDate.Before(f.PurchasedDate):
+		return false
+	}
+
+	return true
+}
+
+func isValidConsumeFIngrRequest(f ConsumeFridgeIngredient) bool {
+	switch {
+	case f.Amount.Sign() <= 0:
+		return false
+	case !units.IsKnown(f.Unit):
+		return false
+	}
+
+	return true
+}
+
+func isValidMoveFIngrRequest(m MoveFridgeIngredient) bool {
+	switch {
+	case m.UserUUID == uuid.Nil:
+		return false
+	case !shelflife.IsLocation(shelflife.Location(m.Location)):
+		return false
 	}
 
 	return true
 }
 
+func isValidOpenFIngrRequest(o OpenFridgeIngredient) bool {
+	return o.UserUUID != uuid.Nil
+}
+
+const fridgeGroupByIngredient = "ingredient" //one entry per ingredient with its lots in it
+
+func isValidDeleteFIngrOptions(o DeleteFIngrOptions) bool {
+	if !store.IsValidFridgeEventReason(o.Reason) {
+		return false
+	}
+
+	if o.EstimatedCost != "" {
+		cost, err := units.ParseAmount(o.EstimatedCost)
+		if err != nil || cost.Sign() < 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+func isValidExpiringOptions(o ExpiringOptions) bool {
+	_, ok := parseWithin(o.Within)
+	return ok
+}
+
+// isValidDigestSettingsRequest checks d after the defaults went in, see withDigestDefaults.
+func isValidDigestSettingsRequest(d DigestSettings, uidFromPath uuid.UUID) bool {
+	switch {
+	case d.UserUUID != uidFromPath:
+		return false
+	case d.WithinDays < 1 || d.WithinDays > maxDigestWithinDays:
+		return false
+	case d.Channel == digestChannelWebhook && !isHTTPSURL(d.WebhookURL):
+		return false
+	case d.Channel != digestChannelWebhook && d.WebhookURL != "":
+		return false
+	}
+
+	if _, err := time.Parse(digestTimeLayout, d.Time); err != nil {
+		return false
+	}
+
+	if _, err := time.LoadLocation(d.Timezone); err != nil || d.Timezone == "Local" { //Local is wherever the server is
+		return false
+	}
+
+	return true
+}
+
+func isHTTPSURL(raw string) bool {
+	u, err := url.Parse(raw)
+	return err == nil && u.Scheme == "https" && u.Host != "" && u.User == nil && len(raw) <= 2048
+}
+
+func isValidFridgeListOptions(o FridgeListOptions) bool {
+	if o.AsOf != "" {
+		if _, err := time.Parse(time.RFC3339, o.AsOf); err != nil {
+			return false
+		}
+	}
+
+	return o.GroupBy == "" || o.GroupBy == fridgeGroupByIngredient
+}
+
+func isValidHouseholdRequest(h Household) bool {
+	switch {
+	case h.HouseholdUUID != uuid.Nil, len(h.Members) != 0:
+		return false
+	case strings.TrimSpace(h.HouseholdName) == "", utf8.RuneCountInString(h.HouseholdName) > 64:
+		return false
+	}
+
+	return true
+}
+
+func isValidHouseholdInvitationRequest(i HouseholdInvitation) bool {
+	switch {
+	case i.HouseholdInvitationUUID != uuid.Nil, !i.ExpiresAt.IsZero():
+		return false
+	case i.EmailAddress == "", !strings.Contains(i.EmailAddress, "@"):
+		return false
+	case i.Role != store.HouseholdRoleMember && i.Role != store.HouseholdRoleViewer:
+		return false
+	}
+
+	return true
+}
+
+func isValidHouseholdRoleRequest(r UserRole) bool {
+	return store.IsValidHouseholdRole(r.Role)
+}
+
 // func isValidDeleteFIngrRequest(f DeleteFIngr, uidFromPath uuid.UUID) bool { //이제 user_uuid랑 ingredient_uuid 둘 다 파람으로 넘겨줘서 필요없어짐 ㅋ
 // 	switch {
 // 	case uidFromPath != f.UserUUID:
@@ -184,6 +454,8 @@ func isValidCreateRecipeRequest(r Recipe) bool {
 		return false
 	case len(r.Ingredients) == 0:
 		return false
+	case !isValidRecipeIngredients(r.Ingredients):
+		return false
 	case len(r.Instructions) == 0:
 		return false
 	}
@@ -205,9 +477,59 @@ func isValidUpdateRecipeRequest(r Recipe, uidFromPath uuid.UUID) bool {
 		return false
 	case len(r.Ingredients) == 0:
 		return false
+	case !isValidRecipeIngredients(r.Ingredients):
+		return false
 	case len(r.Instructions) == 0:
 		return false
 	}
 
 	return true
 }
+
+func isValidRecipeIngredients(ingredients []RecipeIngredient) bool {
+	for _, ingr := range ingredients {
+		switch {
+		case ingr.Amount.Sign() <= 0: //a recipe that needs nothing, or less than nothing, is covered by any fridge
+			return false
+		case !units.IsKnown(ingr.Unit):
+			return false
+		}
+	}
+
+	return true
+}
+
+func isValidCookRequest(r CookRequest) bool {
+	switch {
+	case r.UserUUID == uuid.Nil:
+		return false
+	case r.Servings < 0 || r.Servings > 100: //0 is left out, that's 1
+		return false
+	}
+
+	return true
+}
+
+const maxSuggestionWeight = 100 //plenty to make one part of the score win, small enough that it can't overflow
+
+func isValidSuggestionOptions(o SuggestionOptions) bool {
+	switch {
+	case o.Mode != suggestionModeCoverage && o.Mode != suggestionModeExpiring:
+		return false
+	case o.WithinDays < 0 || o.WithinDays > 30:
+		return false
+	case !isValidSuggestionWeight(o.CoverageWeight) || !isValidSuggestionWeight(o.ExpiryWeight):
+		return false
+	case o.CoverageWeight == 0 && o.ExpiryWeight == 0:
+		return false
+	case o.Limit < 1 || o.Limit > 100:
+		return false
+	}
+
+	return true
+}
+
+// isValidSuggestionWeight is false for NaN and Inf too, the score would be one of them and the response can't be written.
+func isValidSuggestionWeight(w float64) bool {
+	return !math.IsNaN(w) && !math.IsInf(w, 0) && w >= 0 && w <= maxSuggestionWeight
+}
@@ -0,0 +1,246 @@
+package service
+
+import (
+	"context"
+	"math/big"
+	"net/http"
+	"sort"
+	"time"
+	"wdiet/store"
+	"wdiet/units"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+const (
+	wasteDayLayout   = "2006-01-02"
+	wasteMonthLayout = "2006-01"
+)
+
+// isWaste tells if a lot deleted for reason got thrown out. Eaten or given away isn't waste.
+func isWaste(reason string) bool {
+	return reason == store.FridgeEventExpired || reason == store.FridgeEventDiscarded
+}
+
+// wasteRange is the days o asks for, from midnight UTC of from to midnight UTC of to. No to is today, no from is the
+// start of the month a year before to, so there are 12 whole months.
+func wasteRange(o WasteStatsOptions, now time.Time) (from, to time.Time, ok bool) {
+	now = now.UTC()
+	to = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+
+	if o.To != "" {
+		t, err := time.Parse(wasteDayLayout, o.To)
+		if err != nil {
+			return time.Time{}, time.Time{}, false
+		}
+		to = t
+	}
+
+	from = time.Date(to.Year(), to.Month()-11, 1, 0, 0, 0, 0, time.UTC)
+
+	if o.From != "" {
+		t, err := time.Parse(wasteDayLayout, o.From)
+		if err != nil {
+			return time.Time{}, time.Time{}, false
+		}
+		from = t
+	}
+
+	return from, to, !from.After(to)
+}
+
+func (s *Service) GetWasteStats(c *gin.Context) {
+	l := s.l.Named("GetWasteStats")
+
+	uid, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		l.Info("error getting waste stats", zap.Error(err))
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	if !isOwner(c, uid) {
+		l.Info("error getting waste stats, forbidden")
+		c.Status(http.StatusForbidden)
+		return
+	}
+
+	var options WasteStatsOptions
+
+	if err := c.ShouldBindQuery(&options); err != nil {
+		l.Info("error getting waste stats", zap.Error(err))
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	from, to, ok := wasteRange(options, s.now())
+	if !ok {
+		l.Info("error getting waste stats, bad range")
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	household, ok := s.activeHousehold(c, l, uid)
+	if !ok {
+		return
+	}
+
+	events, err := s.db.ListFridgeEvents(context.Background(), household.HouseholdUUID, from, to.AddDate(0, 0, 1))
+	if err != nil {
+		l.Error("error getting waste stats", zap.Error(err))
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	amountsJSON(c, http.StatusOK, wasteStats(events, from, to))
+}
+
+// wasteTally adds up waste as it goes, amounts and costs stay exact until the end.
+type wasteTally struct {
+	items, expired, discarded, costed int
+	amounts                           map[string]*big.Rat //by unit
+	cost                              *big.Rat
+}
+
+func newWasteTally() *wasteTally {
+	return &wasteTally{amounts: make(map[string]*big.Rat), cost: new(big.Rat)}
+}
+
+func (t *wasteTally) add(e store.FridgeEvent) {
+	t.items++
+	if e.Reason == store.FridgeEventExpired {
+		t.expired++
+	} else {
+		t.discarded++
+	}
+
+	amount, unit := e.Amount.Rat(), e.Unit
+	if u, err := units.Parse(e.Unit); err == nil {
+		base := units.Base(u.Kind)
+		if converted, err := units.Convert(amount, u, base, 0); err == nil { //same kind, so never needs a density
+			amount, unit = converted, base.Symbol
+		}
+	}
+
+	if _, ok := t.amounts[unit]; !ok {
+		t.amounts[unit] = new(big.Rat)
+	}
+	t.amounts[unit].Add(t.amounts[unit], amount)
+
+	if e.EstimatedCost != nil {
+		t.costed++
+		t.cost.Add(t.cost, e.EstimatedCost.Rat())
+	}
+}
+
+func (t *wasteTally) total() WasteTotal {
+	total := WasteTotal{
+		Items:         t.items,
+		Expired:       t.expired,
+		Discarded:     t.discarded,
+		EstimatedCost: units.NewAmount(t.cost),
+		CostedItems:   t.costed,
+	}
+
+	for unit, amount := range t.amounts {
+		total.Amounts = append(total.Amounts, UnitAmount{Amount: units.NewAmount(amount), Unit: unit})
+	}
+	sort.Slice(total.Amounts, func(i, j int) bool {
+		return total.Amounts[i].Unit < total.Amounts[j].Unit
+	})
+
+	return total
+}
+
+func tallyFor(tallies map[string]*wasteTally, key string) *wasteTally {
+	if _, ok := tallies[key]; !ok {
+		tallies[key] = newWasteTally()
+	}
+	return tallies[key]
+}
+
+// moreWaste orders waste most thrown out first: more lots, then the dearer.
+func moreWaste(a, b WasteTotal) (bool, bool) {
+	if a.Items != b.Items {
+		return a.Items > b.Items, true
+	}
+	if c := a.EstimatedCost.Cmp(b.EstimatedCost); c != 0 {
+		return c > 0, true
+	}
+	return false, false
+}
+
+// wasteStats adds up the waste in events, which are from..to and in the order they happened.
+func wasteStats(events []store.FridgeEvent, from, to time.Time) WasteStats {
+	type ingredientKey struct {
+		ingredientUUID uuid.UUID
+		name           string //only for the ones whose ingredient is deleted, they can't be told apart otherwise
+	}
+
+	total := newWasteTally()
+	categories := make(map[string]*wasteTally)
+	ingredients := make(map[ingredientKey]*wasteTally)
+	ingredientNames := make(map[ingredientKey]IngredientWaste) //the newest name and category of each
+	months := make(map[string]*wasteTally)
+
+	for _, e := range events {
+		if e.EventType != store.FridgeEventTypeDelete || !isWaste(e.Reason) {
+			continue
+		}
+
+		key := ingredientKey{ingredientUUID: e.IngredientUUID}
+		if e.IngredientUUID == uuid.Nil {
+			key.name = e.IngredientName
+		}
+		month := e.CreatedAt.UTC().Format(wasteMonthLayout)
+
+		tallyFor(categories, e.Category).add(e)
+		tallyFor(months, month).add(e)
+		if _, ok := ingredients[key]; !ok {
+			ingredients[key] = newWasteTally()
+		}
+		ingredients[key].add(e)
+		ingredientNames[key] = IngredientWaste{IngredientUUID: e.IngredientUUID, IngredientName: e.IngredientName, Category: e.Category}
+
+		total.add(e)
+	}
+
+	stats := WasteStats{
+		From:  from.Format(wasteDayLayout),
+		To:    to.Format(wasteDayLayout),
+		Total: total.total(),
+	}
+
+	for category, t := range categories {
+		stats.ByCategory = append(stats.ByCategory, CategoryWaste{Category: category, WasteTotal: t.total()})
+	}
+	sort.Slice(stats.ByCategory, func(i, j int) bool {
+		if more, ok := moreWaste(stats.ByCategory[i].WasteTotal, stats.ByCategory[j].WasteTotal); ok {
+			return more
+		}
+		return stats.ByCategory[i].Category < stats.ByCategory[j].Category
+	})
+
+	for key, t := range ingredients {
+		ingredient := ingredientNames[key]
+		ingredient.WasteTotal = t.total()
+		stats.ByIngredient = append(stats.ByIngredient, ingredient)
+	}
+	sort.Slice(stats.ByIngredient, func(i, j int) bool {
+		if more, ok := moreWaste(stats.ByIngredient[i].WasteTotal, stats.ByIngredient[j].WasteTotal); ok {
+			return more
+		}
+		return stats.ByIngredient[i].IngredientName < stats.ByIngredient[j].IngredientName
+	})
+
+	for month, t := range months {
+		stats.ByMonth = append(stats.ByMonth, MonthWaste{Month: month, WasteTotal: t.total()})
+	}
+	sort.Slice(stats.ByMonth, func(i, j int) bool {
+		return stats.ByMonth[i].Month < stats.ByMonth[j].Month
+	})
+
+	return stats
+}
@@ -0,0 +1,101 @@
+// Package shelflife works out when something in the fridge goes off, from where it's kept and whether it's been opened.
+//
+// The rules:
+//
+//   - Unopened, an item keeps for its location's shelf life from the day it was bought. The fridge one is the
+//     ingredient's days_until_exp. A freezer or pantry shelf life we don't know is the fridge one, we don't guess.
+//   - Opened, it keeps for the opened shelf life from the day it was opened, unless it would have gone off before that
+//     anyway. Opening never makes something keep longer. The freezer stops that clock, an opened bag of peas in the
+//     freezer keeps as long as any other.
+//   - Moved, it keeps the share of its shelf life it had left. Half way through 4 days in the fridge and moved to a
+//     freezer that keeps it 90 days, it has 45 days left from the day it was moved. Something that's already gone off
+//     stays gone off wherever it goes.
+//
+// Shelf lives are in whole days, 0 is one we don't know.
+package shelflife
+
+import (
+	"time"
+)
+
+type Location string
+
+const (
+	Fridge  Location = "fridge"
+	Freezer Location = "freezer"
+	Pantry  Location = "pantry"
+)
+
+const day = 24 * time.Hour
+
+// IsLocation is whether l is one of the places we know.
+func IsLocation(l Location) bool {
+	switch l {
+	case Fridge, Freezer, Pantry:
+		return true
+	}
+	return false
+}
+
+// Life is how many days an ingredient keeps where.
+type Life struct {
+	Fridge  int
+	Freezer int
+	Pantry  int
+	Opened  int //once it's open, out of the freezer
+}
+
+// Days is how long an unopened item keeps at l.
+func (life Life) Days(l Location) int {
+	switch {
+	case l == Freezer && life.Freezer > 0:
+		return life.Freezer
+	case l == Pantry && life.Pantry > 0:
+		return life.Pantry
+	}
+	return life.Fridge
+}
+
+// days is how long an item keeps at l once it's opened or not.
+func (life Life) days(l Location, opened bool) int {
+	if opened && l != Freezer && life.Opened > 0 {
+		return life.Opened
+	}
+	return life.Days(l)
+}
+
+// Expiry is when an item bought at purchased goes off if it's been at l since, and opened at opened. opened is the zero
+// time if it hasn't been.
+func Expiry(life Life, purchased time.Time, l Location, opened time.Time) time.Time {
+	expiry := purchased.Add(day * time.Duration(life.Days(l)))
+	if opened.IsZero() {
+		return expiry
+	}
+	return Open(life, expiry, l, opened)
+}
+
+// Open is when an item that would go off at expiry goes off once it's opened at at.
+func Open(life Life, expiry time.Time, l Location, at time.Time) time.Time {
+	if l == Freezer || life.Opened <= 0 {
+		return expiry
+	}
+
+	if opened := at.Add(day * time.Duration(life.Opened)); opened.Before(expiry) {
+		return opened
+	}
+	return expiry
+}
+
+// Move is when an item that would go off at expiry at from goes off once it's moved to to at at, rounded to the minute.
+func Move(life Life, expiry time.Time, from, to Location, at time.Time, opened bool) time.Time {
+	fromDays, toDays := life.days(from, opened), life.days(to, opened)
+
+	left := expiry.Sub(at)
+	if from == to || left <= 0 || fromDays <= 0 {
+		return expiry
+	}
+
+	share := float64(left) / float64(day*time.Duration(fromDays))
+
+	return at.Add(time.Duration(share * float64(day*time.Duration(toDays)))).Round(time.Minute)
+}
@@ -0,0 +1,88 @@
+package shelflife
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	milk     = Life{Fridge: 7, Freezer: 90, Opened: 3}
+	rice     = Life{Fridge: 30, Pantry: 365}
+	testDate = time.Date(2023, time.March, 24, 15, 0, 0, 0, time.UTC)
+)
+
+func date(days int) time.Time {
+	return testDate.AddDate(0, 0, days)
+}
+
+func TestDays(t *testing.T) {
+	assert.Equal(t, 7, milk.Days(Fridge))
+	assert.Equal(t, 90, milk.Days(Freezer))
+	assert.Equal(t, 7, milk.Days(Pantry)) //we don't know, so it's the fridge one
+	assert.Equal(t, 365, rice.Days(Pantry))
+	assert.Equal(t, 30, rice.Days(Freezer))
+}
+
+func TestExpiry(t *testing.T) {
+	testcases := []struct {
+		name     string
+		life     Life
+		location Location
+		opened   time.Time
+		expected time.Time
+	}{
+		{"fridge", milk, Fridge, time.Time{}, date(7)},
+		{"freezer", milk, Freezer, time.Time{}, date(90)},
+		{"pantry", rice, Pantry, time.Time{}, date(365)},
+		{"pantryUnknown", milk, Pantry, time.Time{}, date(7)},
+		{"openedRightAway", milk, Fridge, date(0), date(3)},
+		{"openedLater", milk, Fridge, date(2), date(5)},
+		{"openedLate", milk, Fridge, date(6), date(7)}, //opening doesn't make it keep longer
+		{"openedInFreezer", milk, Freezer, date(2), date(90)},
+		{"openedUnknown", rice, Pantry, date(10), date(365)},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			assert.Equal(t, testcase.expected, Expiry(testcase.life, testDate, testcase.location, testcase.opened))
+		})
+	}
+}
+
+func TestMove(t *testing.T) {
+	testcases := []struct {
+		name     string
+		life     Life
+		expiry   time.Time
+		from     Location
+		to       Location
+		at       time.Time
+		opened   bool
+		expected time.Time
+	}{
+		{"fridgeToFreezerRightAway", milk, date(7), Fridge, Freezer, date(0), false, date(90)},
+		{"fridgeToFreezer", milk, date(7), Fridge, Freezer, date(2), false, date(2 + 90*5/7).Add(6*time.Hour + 51*time.Minute)}, //5/7 of 90 days is 64 days 6:51
+		{"freezerToFridge", milk, date(90), Freezer, Fridge, date(45), false, date(45).Add(84 * time.Hour)},                     //half of 7 days
+		{"openedToFreezer", milk, date(3), Fridge, Freezer, date(1), true, date(61)},                                            //2/3 of 3 days
+		{"openedFromFreezer", milk, date(61), Freezer, Fridge, date(31), true, date(32)},                                        //1/3 of 3 days
+		{"pantryToFridge", rice, date(365), Pantry, Fridge, date(73), false, date(73 + 24)},                                     //4/5 of 30 days
+		{"sameLocation", milk, date(7), Fridge, Fridge, date(2), false, date(7)},
+		{"goneOff", milk, date(7), Fridge, Freezer, date(8), false, date(7)},
+		{"unknownLife", Life{}, date(0), Fridge, Freezer, date(0), false, date(0)},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			assert.Equal(t, testcase.expected, Move(testcase.life, testcase.expiry, testcase.from, testcase.to, testcase.at, testcase.opened))
+		})
+	}
+}
+
+func TestOpen(t *testing.T) {
+	assert.Equal(t, date(5), Open(milk, date(7), Fridge, date(2)))
+	assert.Equal(t, date(7), Open(milk, date(7), Fridge, date(5)))
+	assert.Equal(t, date(90), Open(milk, date(90), Freezer, date(5)))
+	assert.Equal(t, date(365), Open(rice, date(365), Pantry, date(5)))
+}
@@ -0,0 +1,63 @@
+package store
+
+import (
+	"bytes"
+	"sort"
+
+	"github.com/google/uuid"
+)
+
+// ReplayFridgeEvents works out what's in the fridge after events, which are in the order they happened. fridge_ingredients
+// is this for every event there is. Events of a lot that was never added, like the deletes from before there was a
+// ledger, change nothing. The lots are ordered like ListFridgeIngredients orders them.
+func ReplayFridgeEvents(events []FridgeEvent) []FridgeIngredient {
+	lots := make(map[uuid.UUID]*FridgeIngredient)
+
+	for _, e := range events {
+		if e.EventType == FridgeEventTypeAdd {
+			lots[e.FridgeItemUUID] = &FridgeIngredient{
+				FridgeItemUUID: e.FridgeItemUUID,
+				HouseholdUUID:  e.HouseholdUUID,
+				UserUUID:       e.UserUUID, //whoever added it put it there
+				CreatedAt:      e.CreatedAt,
+			}
+		}
+
+		lot, ok := lots[e.FridgeItemUUID]
+		if !ok {
+			continue
+		}
+
+		if e.EventType == FridgeEventTypeDelete || (e.EventType == FridgeEventTypeConsume && e.Amount.Sign() == 0) {
+			delete(lots, e.FridgeItemUUID)
+			continue
+		}
+
+		lot.IngredientUUID = e.IngredientUUID
+		lot.Amount = e.Amount
+		lot.Unit = e.Unit
+		lot.PurchasedDate = e.PurchasedDate
+		lot.ExpirationDate = e.ExpirationDate
+		lot.Location = e.Location
+		lot.OpenedDate = e.OpenedDate
+		lot.UpdatedAt = e.CreatedAt
+	}
+
+	fridge := make([]FridgeIngredient, 0, len(lots))
+	for _, lot := range lots {
+		fridge = append(fridge, *lot)
+	}
+
+	sort.Slice(fridge, func(i, j int) bool {
+		a, b := fridge[i], fridge[j]
+		if c := bytes.Compare(a.IngredientUUID[:], b.IngredientUUID[:]); c != 0 {
+			return c < 0
+		}
+		if !a.ExpirationDate.Equal(b.ExpirationDate) {
+			return a.ExpirationDate.Before(b.ExpirationDate)
+		}
+		return bytes.Compare(a.FridgeItemUUID[:], b.FridgeItemUUID[:]) < 0
+	})
+
+	return fridge
+}
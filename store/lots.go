@@ -0,0 +1,47 @@
+package store
+
+import (
+	"math/big"
+	"wdiet/units"
+)
+
+// TakeFromLots works out how to take amount of unit out of lots, going through them in the order they're in, so hand
+// them over oldest expiry first. The lots are all of one ingredient and density is its density in g per ml, 0 if we
+// don't know it. Lots that don't convert to unit are left alone. It also returns how much of unit the lots were
+// short of.
+// What's left of a lot stays in the lot's unit, rounded to units.Scale decimals. A lot that rounds to nothing is gone.
+func TakeFromLots(lots []FridgeIngredient, amount units.Amount, unit string, density float64) ([]FridgeDeduction, units.Amount) {
+	need := amount.Rat()
+
+	var deductions []FridgeDeduction
+
+	for _, lot := range lots {
+		if units.NewAmount(need).Sign() <= 0 { //what a conversion leaves over past the last decimal doesn't count
+			break
+		}
+
+		have, err := units.ConvertNamed(lot.Amount.Rat(), lot.Unit, unit, density)
+		if err != nil { //can't take grams out of a bottle in liters without knowing how heavy it is
+			continue
+		}
+
+		take := have
+		if need.Cmp(take) < 0 {
+			take = need
+		}
+		left := new(big.Rat).Sub(have, take)
+		need = new(big.Rat).Sub(need, take)
+
+		leftInLotUnit, _ := units.ConvertNamed(left, unit, lot.Unit, density) //it converted the other way, so this works too
+
+		deductions = append(deductions, FridgeDeduction{
+			FridgeItemUUID: lot.FridgeItemUUID,
+			Amount:         lot.Amount,
+			Unit:           lot.Unit,
+			LeftAmount:     units.NewAmount(leftInLotUnit),
+			LeftUnit:       lot.Unit,
+		})
+	}
+
+	return deductions, units.NewAmount(need)
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"time"
 	"wdiet/store"
+	"wdiet/units"
 
 	"github.com/google/uuid"
 	"golang.org/x/crypto/bcrypt"
@@ -19,6 +20,15 @@ type Mockstore struct {
 	GetUserByEmailOverride func(ctx context.Context, email string) (*store.User, error)
 	CreateUserOverride     func(ctx context.Context, u store.User) (*store.User, error)
 	UpdateUserOverride     func(ctx context.Context, u store.User) (*store.User, error)
+	SetUserActiveOverride  func(ctx context.Context, id uuid.UUID, active bool) (*store.User, error)
+	GetUserStatusOverride  func(ctx context.Context, id uuid.UUID) (*store.UserStatus, error)
+	SetUserRoleOverride    func(ctx context.Context, id uuid.UUID, role string) (*store.User, error)
+	ChangePasswordOverride func(ctx context.Context, id uuid.UUID, hashedPassword string) error
+
+	UpdatePasswordHashOverride      func(ctx context.Context, id uuid.UUID, oldHash, newHash string) error
+	RequestUserDeletionOverride     func(ctx context.Context, id uuid.UUID, deleteAfter time.Time) error
+	ListUsersDueForDeletionOverride func(ctx context.Context, now time.Time) ([]uuid.UUID, error)
+	DeleteUserOverride              func(ctx context.Context, id uuid.UUID) error
 
 	GetIngredientOverride     func(ctx context.Context, id uuid.UUID) (*store.Ingredient, error)
 	SearchIngredientsOverride func(ctx context.Context, i store.SearchIngredient) ([]store.Ingredient, error)
@@ -26,10 +36,29 @@ type Mockstore struct {
 	UpdateIngredientOverride  func(ctx context.Context, i store.Ingredient) (*store.Ingredient, error)
 	DeleteIngredientOverride  func(ctx context.Context, id uuid.UUID) error
 
-	ListFridgeIngredientsOverride  func(ctx context.Context, id uuid.UUID) ([]store.FridgeIngredient, error)
-	CreateFridgeIngredientOverride func(ctx context.Context, f store.FridgeIngredient) (*store.FridgeIngredient, error)
-	UpdateFridgeIngredientOverride func(ctx context.Context, f store.FridgeIngredient) (*store.FridgeIngredient, error)
-	DeleteFridgeIngredientOverride func(ctx context.Context, uid uuid.UUID, fid uuid.UUID) error
+	CreateHouseholdOverride           func(ctx context.Context, h store.Household, owner uuid.UUID) (*store.Household, error)
+	GetHouseholdOverride              func(ctx context.Context, id uuid.UUID) (*store.Household, error)
+	ListHouseholdsOverride            func(ctx context.Context, uid uuid.UUID) ([]store.HouseholdMembership, error)
+	GetHouseholdMembershipOverride    func(ctx context.Context, hid, uid uuid.UUID) (*store.HouseholdMembership, error)
+	GetActiveHouseholdOverride        func(ctx context.Context, uid uuid.UUID) (*store.HouseholdMembership, error)
+	SetActiveHouseholdOverride        func(ctx context.Context, uid, hid uuid.UUID) error
+	EnsureActiveHouseholdOverride     func(ctx context.Context, uid uuid.UUID, name string) (*store.HouseholdMembership, error)
+	ListHouseholdMembersOverride      func(ctx context.Context, hid uuid.UUID) ([]store.HouseholdMember, error)
+	SetHouseholdMemberRoleOverride    func(ctx context.Context, hid, uid uuid.UUID, role string) (*store.HouseholdMember, error)
+	RemoveHouseholdMemberOverride     func(ctx context.Context, hid, uid uuid.UUID) error
+	CreateHouseholdInvitationOverride func(ctx context.Context, i store.HouseholdInvitation) (*store.HouseholdInvitation, error)
+	AcceptHouseholdInvitationOverride func(ctx context.Context, hashedToken string, uid uuid.UUID, email string) (*store.HouseholdMembership, error)
+
+	ListFridgeIngredientsOverride      func(ctx context.Context, hid uuid.UUID) ([]store.FridgeIngredient, error)
+	CreateFridgeIngredientOverride     func(ctx context.Context, f store.FridgeIngredient) (*store.FridgeIngredient, error)
+	UpdateFridgeIngredientOverride     func(ctx context.Context, f store.FridgeIngredient) (*store.FridgeIngredient, error)
+	GetFridgeIngredientOverride        func(ctx context.Context, hid, fid uuid.UUID) (*store.FridgeIngredient, error)
+	SetFridgeIngredientStorageOverride func(ctx context.Context, was, f store.FridgeIngredient, uid uuid.UUID, eventType string) (*store.FridgeIngredient, error)
+	DeleteFridgeIngredientOverride     func(ctx context.Context, e store.FridgeEvent) error
+	ListFridgeEventsOverride           func(ctx context.Context, hid uuid.UUID, from, to time.Time) ([]store.FridgeEvent, error)
+	ListUserFridgeEventsOverride       func(ctx context.Context, uid uuid.UUID) ([]store.FridgeEvent, error)
+
+	ConsumeFridgeIngredientOverride func(ctx context.Context, hid, iid, uid uuid.UUID, amount units.Amount, unit string) ([]store.FridgeIngredient, error)
 
 	GetRecipeOverride     func(ctx context.Context, id uuid.UUID) (*store.Recipe, error)
 	ListRecipesOverride   func(ctx context.Context, id uuid.UUID) ([]store.Recipe, error)
@@ -37,6 +66,57 @@ type Mockstore struct {
 	CreateRecipeOverride  func(ctx context.Context, r store.Recipe) (*store.Recipe, error)
 	UpdateRecipeOverride  func(ctx context.Context, r store.Recipe) (*store.Recipe, error)
 	DeleteRecipeOverride  func(ctx context.Context, id uuid.UUID) error
+
+	SuggestRecipesOverride func(ctx context.Context, hid uuid.UUID, q store.SuggestionQuery) ([]store.RecipeSuggestion, error)
+
+	CookRecipeOverride   func(ctx context.Context, l store.CookLog, deductions []store.FridgeDeduction) (*store.CookLog, error)
+	ListCookLogsOverride func(ctx context.Context, uid uuid.UUID) ([]store.CookLog, error)
+
+	GetDigestSettingsOverride         func(ctx context.Context, uid uuid.UUID) (*store.DigestSettings, error)
+	SetDigestSettingsOverride         func(ctx context.Context, d store.DigestSettings) (*store.DigestSettings, error)
+	ListEnabledDigestSettingsOverride func(ctx context.Context) ([]store.DigestSettings, error)
+	ClaimDigestOverride               func(ctx context.Context, uid uuid.UUID, day time.Time) (bool, error)
+
+	GetRefreshTokenOverride          func(ctx context.Context, hashedToken string) (*store.RefreshToken, error)
+	ListRefreshTokensOverride        func(ctx context.Context, uid uuid.UUID) ([]store.RefreshToken, error)
+	CreateRefreshTokenOverride       func(ctx context.Context, t store.RefreshToken) (*store.RefreshToken, error)
+	RotateRefreshTokenOverride       func(ctx context.Context, id uuid.UUID, next store.RefreshToken) (*store.RefreshToken, error)
+	RevokeRefreshTokenFamilyOverride func(ctx context.Context, familyID uuid.UUID) error
+	RevokeAccessTokenOverride        func(ctx context.Context, jti uuid.UUID, expiresAt time.Time) error
+	IsAccessTokenRevokedOverride     func(ctx context.Context, jti uuid.UUID) (bool, error)
+
+	CreatePersonalAccessTokenOverride func(ctx context.Context, t store.PersonalAccessToken) (*store.PersonalAccessToken, error)
+	ListPersonalAccessTokensOverride  func(ctx context.Context, uid uuid.UUID) ([]store.PersonalAccessToken, error)
+	DeletePersonalAccessTokenOverride func(ctx context.Context, uid, tid uuid.UUID) error
+	UsePersonalAccessTokenOverride    func(ctx context.Context, hashedToken string) (*store.PersonalAccessToken, error)
+
+	GetTOTPOverride            func(ctx context.Context, uid uuid.UUID) (*store.TOTP, error)
+	StartTOTPEnrolmentOverride func(ctx context.Context, t store.TOTP, hashedRecoveryCodes []string) (*store.TOTP, error)
+	EnableTOTPOverride         func(ctx context.Context, uid uuid.UUID, step int64) error
+	DisableTOTPOverride        func(ctx context.Context, uid uuid.UUID) error
+	UseTOTPStepOverride        func(ctx context.Context, uid uuid.UUID, step int64) (bool, error)
+	UseRecoveryCodeOverride    func(ctx context.Context, uid uuid.UUID, hashedCode string) error
+
+	CreateLoginChallengeOverride  func(ctx context.Context, c store.LoginChallenge) (*store.LoginChallenge, error)
+	AttemptLoginChallengeOverride func(ctx context.Context, hashedToken string) (*store.LoginChallenge, error)
+	UseLoginChallengeOverride     func(ctx context.Context, id uuid.UUID) error
+
+	UseUserIdentityOverride        func(ctx context.Context, provider, subject string) (*store.UserIdentity, error)
+	ListUserIdentitiesOverride     func(ctx context.Context, uid uuid.UUID) ([]store.UserIdentity, error)
+	CreateUserIdentityOverride     func(ctx context.Context, i store.UserIdentity) (*store.UserIdentity, error)
+	CreateUserWithIdentityOverride func(ctx context.Context, u store.User, i store.UserIdentity) (*store.User, error)
+	CreateOIDCStateOverride        func(ctx context.Context, st store.OIDCState) (*store.OIDCState, error)
+	UseOIDCStateOverride           func(ctx context.Context, hashedState string) (*store.OIDCState, error)
+
+	CreatePasswordResetTokenOverride func(ctx context.Context, t store.PasswordResetToken) (*store.PasswordResetToken, error)
+	GetPasswordResetUserOverride     func(ctx context.Context, hashedToken string) (*store.User, error)
+	ResetPasswordOverride            func(ctx context.Context, hashedToken string, hashedPassword string) error
+
+	CreateEmailVerificationTokenOverride func(ctx context.Context, t store.EmailVerificationToken) (*store.EmailVerificationToken, error)
+	VerifyEmailOverride                  func(ctx context.Context, hashedToken string) (*store.User, error)
+
+	CreateLockoutEventOverride func(ctx context.Context, e store.LockoutEvent) (*store.LockoutEvent, error)
+	ListLockoutEventsOverride  func(ctx context.Context, limit int) ([]store.LockoutEvent, error)
 }
 
 func (m *Mockstore) Ping() error {
@@ -55,6 +135,7 @@ func (m *Mockstore) GetUser(ctx context.Context, id uuid.UUID) (*store.User, err
 		UserUUID:       id,
 		HashedPassword: "5994471abb01112afcc18159f6cc74b4f511b99806da59b3caf5a9c173cacfc5",
 		Active:         true,
+		Role:           store.RoleUser,
 		FirstName:      "jy",
 		LastName:       "woo",
 		EmailAddress:   "jywoo92324@gmail.com",
@@ -76,7 +157,8 @@ func (m *Mockstore) GetUserByEmail(ctx context.Context, email string) (*store.Us
 	return &store.User{
 		UserUUID:       uuid.MustParse("080b5f09-527b-4581-bb56-19adbfe50ebf"),
 		HashedPassword: string(hashedPassword),
-		Active:         false,
+		Active:         true,
+		Role:           store.RoleUser,
 		FirstName:      "jy",
 		LastName:       "woo",
 		EmailAddress:   email, //"jywoo92324@gmail.com"
@@ -94,6 +176,7 @@ func (m *Mockstore) CreateUser(ctx context.Context, u store.User) (*store.User,
 		UserUUID:       uuid.New(),
 		HashedPassword: u.HashedPassword,
 		Active:         u.Active,
+		Role:           store.RoleUser,
 		FirstName:      u.FirstName,
 		LastName:       u.LastName,
 		EmailAddress:   u.EmailAddress,
@@ -107,11 +190,94 @@ func (m *Mockstore) UpdateUser(ctx context.Context, u store.User) (*store.User,
 		return m.UpdateUserOverride(ctx, u)
 	}
 
+	u.Active = true //UpdateUser doesn't touch active, so it's whatever the account has
 	u.UpdatedAt = time.Now()
 
 	return &u, nil //method.go의 UpdateUser를 따라 updated_at 필드를 now()로 바꿔줌. 이게 best practice. 근데 그 필드는 무시하고 request 그대로 반환해도 그게 그거다. mock store는 너무 빡빡하게 굴지말자 ^_^;
 }
 
+func (m *Mockstore) SetUserActive(ctx context.Context, id uuid.UUID, active bool) (*store.User, error) {
+	if m.SetUserActiveOverride != nil {
+		return m.SetUserActiveOverride(ctx, id, active)
+	}
+
+	return &store.User{
+		UserUUID:     id,
+		Active:       active,
+		Role:         store.RoleUser,
+		FirstName:    "jy",
+		LastName:     "woo",
+		EmailAddress: "jywoo92324@gmail.com",
+		CreatedAt:    time.Now(),
+		UpdatedAt:    time.Now(),
+	}, nil
+}
+
+func (m *Mockstore) GetUserStatus(ctx context.Context, id uuid.UUID) (*store.UserStatus, error) {
+	if m.GetUserStatusOverride != nil {
+		return m.GetUserStatusOverride(ctx, id)
+	}
+
+	return &store.UserStatus{Active: true, EmailVerified: true, Role: store.RoleUser}, nil
+}
+
+func (m *Mockstore) SetUserRole(ctx context.Context, id uuid.UUID, role string) (*store.User, error) {
+	if m.SetUserRoleOverride != nil {
+		return m.SetUserRoleOverride(ctx, id, role)
+	}
+
+	return &store.User{
+		UserUUID:     id,
+		Active:       true,
+		Role:         role,
+		FirstName:    "jy",
+		LastName:     "woo",
+		EmailAddress: "jywoo92324@gmail.com",
+		CreatedAt:    time.Now(),
+		UpdatedAt:    time.Now(),
+	}, nil
+}
+
+func (m *Mockstore) ChangePassword(ctx context.Context, id uuid.UUID, hashedPassword string) error {
+	if m.ChangePasswordOverride != nil {
+		return m.ChangePasswordOverride(ctx, id, hashedPassword)
+	}
+
+	return nil
+}
+
+func (m *Mockstore) UpdatePasswordHash(ctx context.Context, id uuid.UUID, oldHash, newHash string) error {
+	if m.UpdatePasswordHashOverride != nil {
+		return m.UpdatePasswordHashOverride(ctx, id, oldHash, newHash)
+	}
+
+	return nil
+}
+
+func (m *Mockstore) RequestUserDeletion(ctx context.Context, id uuid.UUID, deleteAfter time.Time) error {
+	if m.RequestUserDeletionOverride != nil {
+		return m.RequestUserDeletionOverride(ctx, id, deleteAfter)
+	}
+
+	return nil
+}
+
+func (m *Mockstore) ListUsersDueForDeletion(ctx context.Context, now time.Time) ([]uuid.UUID, error) {
+	if m.ListUsersDueForDeletionOverride != nil {
+		return m.ListUsersDueForDeletionOverride(ctx, now)
+	}
+
+	return nil, nil //nobody's leaving until a test says so
+}
+
+func (m *Mockstore) DeleteUser(ctx context.Context, id uuid.UUID) error {
+	if m.DeleteUserOverride != nil {
+		return m.DeleteUserOverride(ctx, id)
+	}
+
+	return nil
+}
+
 func (m *Mockstore) GetIngredient(ctx context.Context, id uuid.UUID) (*store.Ingredient, error) {
 	if m.GetIngredientOverride != nil {
 		return m.GetIngredientOverride(ctx, id)
@@ -121,6 +287,9 @@ func (m *Mockstore) GetIngredient(ctx context.Context, id uuid.UUID) (*store.Ing
 		IngredientName: "onion",
 		Category:       "vegetables",
 		DaysUntilExp:   7,
+		FreezerDays:    240,
+		PantryDays:     30,
+		OpenedDays:     3,
 		CreatedAt:      time.Now(),
 		UpdatedAt:      time.Now(),
 	}, nil
@@ -161,6 +330,10 @@ func (m *Mockstore) CreateIngredient(ctx context.Context, i store.Ingredient) (*
 		IngredientName: i.IngredientName,
 		Category:       i.Category,
 		DaysUntilExp:   i.DaysUntilExp,
+		FreezerDays:    i.FreezerDays,
+		PantryDays:     i.PantryDays,
+		OpenedDays:     i.OpenedDays,
+		Density:        i.Density,
 		CreatedAt:      time.Now(),
 		UpdatedAt:      time.Now(),
 	}, nil
@@ -184,29 +357,211 @@ func (m *Mockstore) DeleteIngredient(ctx context.Context, id uuid.UUID) error {
 	return nil
 }
 
-func (m *Mockstore) ListFridgeIngredients(ctx context.Context, id uuid.UUID) ([]store.FridgeIngredient, error) {
+var defaultHousehold = uuid.MustParse("5e1f0a8c-3b7d-4c2e-9f61-2d8a7b4c0e13") //everyone's active household, owned by 080b5f09-527b-4581-bb56-19adbfe50ebf
+
+func (m *Mockstore) CreateHousehold(ctx context.Context, h store.Household, owner uuid.UUID) (*store.Household, error) {
+	if m.CreateHouseholdOverride != nil {
+		return m.CreateHouseholdOverride(ctx, h, owner)
+	}
+
+	h.HouseholdUUID = uuid.New()
+	h.CreatedAt = time.Now()
+	h.UpdatedAt = time.Now()
+
+	return &h, nil
+}
+
+func (m *Mockstore) GetHousehold(ctx context.Context, id uuid.UUID) (*store.Household, error) {
+	if m.GetHouseholdOverride != nil {
+		return m.GetHouseholdOverride(ctx, id)
+	}
+
+	return &store.Household{
+		HouseholdUUID: id,
+		HouseholdName: "jy's household",
+		CreatedAt:     time.Date(2022, 12, 1, 0, 0, 0, 0, time.UTC),
+		UpdatedAt:     time.Date(2022, 12, 1, 0, 0, 0, 0, time.UTC),
+	}, nil
+}
+
+func (m *Mockstore) ListHouseholds(ctx context.Context, uid uuid.UUID) ([]store.HouseholdMembership, error) {
+	if m.ListHouseholdsOverride != nil {
+		return m.ListHouseholdsOverride(ctx, uid)
+	}
+
+	return []store.HouseholdMembership{
+		{
+			HouseholdUUID: defaultHousehold,
+			HouseholdName: "jy's household",
+			Role:          store.HouseholdRoleOwner,
+			Active:        true,
+			CreatedAt:     time.Date(2022, 12, 1, 0, 0, 0, 0, time.UTC),
+		},
+	}, nil
+}
+
+func (m *Mockstore) GetHouseholdMembership(ctx context.Context, hid, uid uuid.UUID) (*store.HouseholdMembership, error) {
+	if m.GetHouseholdMembershipOverride != nil {
+		return m.GetHouseholdMembershipOverride(ctx, hid, uid)
+	}
+
+	return &store.HouseholdMembership{
+		HouseholdUUID: hid,
+		HouseholdName: "jy's household",
+		Role:          store.HouseholdRoleOwner,
+		Active:        hid == defaultHousehold,
+		CreatedAt:     time.Date(2022, 12, 1, 0, 0, 0, 0, time.UTC),
+	}, nil
+}
+
+func (m *Mockstore) GetActiveHousehold(ctx context.Context, uid uuid.UUID) (*store.HouseholdMembership, error) {
+	if m.GetActiveHouseholdOverride != nil {
+		return m.GetActiveHouseholdOverride(ctx, uid)
+	}
+
+	return &store.HouseholdMembership{
+		HouseholdUUID: defaultHousehold,
+		HouseholdName: "jy's household",
+		Role:          store.HouseholdRoleOwner,
+		Active:        true,
+		CreatedAt:     time.Date(2022, 12, 1, 0, 0, 0, 0, time.UTC),
+	}, nil
+}
+
+func (m *Mockstore) SetActiveHousehold(ctx context.Context, uid, hid uuid.UUID) error {
+	if m.SetActiveHouseholdOverride != nil {
+		return m.SetActiveHouseholdOverride(ctx, uid, hid)
+	}
+
+	return nil
+}
+
+func (m *Mockstore) EnsureActiveHousehold(ctx context.Context, uid uuid.UUID, name string) (*store.HouseholdMembership, error) {
+	if m.EnsureActiveHouseholdOverride != nil {
+		return m.EnsureActiveHouseholdOverride(ctx, uid, name)
+	}
+
+	return (&Mockstore{}).GetActiveHousehold(ctx, uid) //the default one, whatever GetActiveHouseholdOverride says
+}
+
+func (m *Mockstore) ListHouseholdMembers(ctx context.Context, hid uuid.UUID) ([]store.HouseholdMember, error) {
+	if m.ListHouseholdMembersOverride != nil {
+		return m.ListHouseholdMembersOverride(ctx, hid)
+	}
+
+	return []store.HouseholdMember{
+		{
+			HouseholdUUID: hid,
+			UserUUID:      uuid.MustParse("080b5f09-527b-4581-bb56-19adbfe50ebf"),
+			Role:          store.HouseholdRoleOwner,
+			FirstName:     "jy",
+			LastName:      "woo",
+			EmailAddress:  "jywoo92324@gmail.com",
+			CreatedAt:     time.Date(2022, 12, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			HouseholdUUID: hid,
+			UserUUID:      uuid.MustParse("2c98fff4-7ccc-4536-8259-67a88380e99c"),
+			Role:          store.HouseholdRoleMember,
+			FirstName:     "jiyoon",
+			LastName:      "woo",
+			EmailAddress:  "jiyoon@wdiet.test",
+			CreatedAt:     time.Date(2022, 12, 2, 0, 0, 0, 0, time.UTC),
+		},
+	}, nil
+}
+
+func (m *Mockstore) SetHouseholdMemberRole(ctx context.Context, hid, uid uuid.UUID, role string) (*store.HouseholdMember, error) {
+	if m.SetHouseholdMemberRoleOverride != nil {
+		return m.SetHouseholdMemberRoleOverride(ctx, hid, uid, role)
+	}
+
+	return &store.HouseholdMember{
+		HouseholdUUID: hid,
+		UserUUID:      uid,
+		Role:          role,
+		FirstName:     "jiyoon",
+		LastName:      "woo",
+		EmailAddress:  "jiyoon@wdiet.test",
+		CreatedAt:     time.Date(2022, 12, 2, 0, 0, 0, 0, time.UTC),
+	}, nil
+}
+
+func (m *Mockstore) RemoveHouseholdMember(ctx context.Context, hid, uid uuid.UUID) error {
+	if m.RemoveHouseholdMemberOverride != nil {
+		return m.RemoveHouseholdMemberOverride(ctx, hid, uid)
+	}
+
+	return nil
+}
+
+func (m *Mockstore) CreateHouseholdInvitation(ctx context.Context, i store.HouseholdInvitation) (*store.HouseholdInvitation, error) {
+	if m.CreateHouseholdInvitationOverride != nil {
+		return m.CreateHouseholdInvitationOverride(ctx, i)
+	}
+
+	i.HouseholdInvitationUUID = uuid.New()
+	i.CreatedAt = time.Now()
+
+	return &i, nil
+}
+
+func (m *Mockstore) AcceptHouseholdInvitation(ctx context.Context, hashedToken string, uid uuid.UUID, email string) (*store.HouseholdMembership, error) {
+	if m.AcceptHouseholdInvitationOverride != nil {
+		return m.AcceptHouseholdInvitationOverride(ctx, hashedToken, uid, email)
+	}
+
+	return &store.HouseholdMembership{
+		HouseholdUUID: defaultHousehold,
+		HouseholdName: "jy's household",
+		Role:          store.HouseholdRoleMember,
+		Active:        true,
+		CreatedAt:     time.Now(),
+	}, nil
+}
+
+func (m *Mockstore) ListFridgeIngredients(ctx context.Context, hid uuid.UUID) ([]store.FridgeIngredient, error) {
 	if m.ListFridgeIngredientsOverride != nil {
-		return m.ListFridgeIngredientsOverride(ctx, id)
+		return m.ListFridgeIngredientsOverride(ctx, hid)
 	}
 
-	return []store.FridgeIngredient{
+	return []store.FridgeIngredient{ //two lots of the first ingredient, oldest expiry first like postgres lists them
+		{
+			FridgeItemUUID: uuid.MustParse("9b1f4c2e-6d3a-4f8b-a2c5-0e7d1b3f5a91"),
+			HouseholdUUID:  hid,
+			UserUUID:       uuid.MustParse("080b5f09-527b-4581-bb56-19adbfe50ebf"),
+			IngredientUUID: uuid.MustParse("ffff7c73-52b0-4e3d-bf3f-0c26785ef972"),
+			Amount:         units.Whole(3),
+			Unit:           "kg",
+			PurchasedDate:  time.Date(2023, time.March, 24, 15, 0, 0, 0, time.UTC),
+			ExpirationDate: time.Date(2023, time.March, 24, 15, 0, 0, 0, time.UTC),
+			Location:       "fridge",
+			CreatedAt:      time.Now(),
+			UpdatedAt:      time.Now(),
+		},
 		{
-			UserUUID:       id,
+			FridgeItemUUID: uuid.MustParse("4e8a2d6c-1f5b-4c7e-9a3d-8b2f0c6e4d17"),
+			HouseholdUUID:  hid,
+			UserUUID:       uuid.MustParse("080b5f09-527b-4581-bb56-19adbfe50ebf"),
 			IngredientUUID: uuid.MustParse("ffff7c73-52b0-4e3d-bf3f-0c26785ef972"),
-			Amount:         3,
+			Amount:         units.Whole(1),
 			Unit:           "kg",
-			PurchasedDate:  time.Date(2023, time.March, 24, 15, 0, 0, 0, time.Now().Location()),
-			ExpirationDate: time.Date(2023, time.March, 24, 15, 0, 0, 0, time.Now().Location()),
+			PurchasedDate:  time.Date(2023, time.March, 28, 15, 0, 0, 0, time.UTC),
+			ExpirationDate: time.Date(2023, time.March, 28, 15, 0, 0, 0, time.UTC),
+			Location:       "fridge",
 			CreatedAt:      time.Now(),
 			UpdatedAt:      time.Now(),
 		},
 		{
-			UserUUID:       id,
+			FridgeItemUUID: uuid.MustParse("c3d5e7f9-2a4b-4d6e-8f1a-3b5c7d9e1f20"),
+			HouseholdUUID:  hid,
+			UserUUID:       uuid.MustParse("080b5f09-527b-4581-bb56-19adbfe50ebf"),
 			IngredientUUID: uuid.MustParse("2c98fff4-7ccc-4536-8259-67a88380e99c"),
-			Amount:         2,
+			Amount:         units.Whole(2),
 			Unit:           "L",
-			PurchasedDate:  time.Date(2023, time.March, 24, 15, 0, 0, 0, time.Now().Location()),
-			ExpirationDate: time.Date(2023, time.March, 31, 15, 0, 0, 0, time.Now().Location()),
+			PurchasedDate:  time.Date(2023, time.March, 24, 15, 0, 0, 0, time.UTC),
+			ExpirationDate: time.Date(2023, time.March, 31, 15, 0, 0, 0, time.UTC),
+			Location:       "fridge",
 			CreatedAt:      time.Now(),
 			UpdatedAt:      time.Now(),
 		},
@@ -219,12 +574,16 @@ func (m *Mockstore) CreateFridgeIngredient(ctx context.Context, f store.FridgeIn
 	}
 
 	return &store.FridgeIngredient{
+		FridgeItemUUID: uuid.New(),
+		HouseholdUUID:  f.HouseholdUUID,
 		UserUUID:       f.UserUUID,
 		IngredientUUID: f.IngredientUUID,
 		Amount:         f.Amount,
 		Unit:           f.Unit,
 		PurchasedDate:  f.PurchasedDate,
 		ExpirationDate: f.ExpirationDate,
+		Location:       f.Location,
+		OpenedDate:     f.OpenedDate,
 		CreatedAt:      time.Now(),
 		UpdatedAt:      time.Now(),
 	}, nil
@@ -240,14 +599,119 @@ func (m *Mockstore) UpdateFridgeIngredient(ctx context.Context, f store.FridgeIn
 	return &f, nil
 }
 
-func (m *Mockstore) DeleteFridgeIngredient(ctx context.Context, uid uuid.UUID, fid uuid.UUID) error {
+func (m *Mockstore) GetFridgeIngredient(ctx context.Context, hid, fid uuid.UUID) (*store.FridgeIngredient, error) {
+	if m.GetFridgeIngredientOverride != nil {
+		return m.GetFridgeIngredientOverride(ctx, hid, fid)
+	}
+
+	return &store.FridgeIngredient{ //a week's worth of fridge life, bought on the 24th
+		FridgeItemUUID: fid,
+		HouseholdUUID:  hid,
+		UserUUID:       uuid.MustParse("080b5f09-527b-4581-bb56-19adbfe50ebf"),
+		IngredientUUID: uuid.MustParse("ffff7c73-52b0-4e3d-bf3f-0c26785ef972"),
+		Amount:         units.Whole(3),
+		Unit:           "kg",
+		PurchasedDate:  time.Date(2023, time.March, 24, 15, 0, 0, 0, time.UTC),
+		ExpirationDate: time.Date(2023, time.March, 31, 15, 0, 0, 0, time.UTC),
+		Location:       "fridge",
+		CreatedAt:      time.Now(),
+		UpdatedAt:      time.Now(),
+	}, nil
+}
+
+func (m *Mockstore) SetFridgeIngredientStorage(ctx context.Context, was, f store.FridgeIngredient, uid uuid.UUID, eventType string) (*store.FridgeIngredient, error) {
+	if m.SetFridgeIngredientStorageOverride != nil {
+		return m.SetFridgeIngredientStorageOverride(ctx, was, f, uid, eventType)
+	}
+
+	f.UpdatedAt = time.Now()
+
+	return &f, nil
+}
+
+func (m *Mockstore) DeleteFridgeIngredient(ctx context.Context, e store.FridgeEvent) error {
 	if m.DeleteFridgeIngredientOverride != nil {
-		return m.DeleteFridgeIngredientOverride(ctx, uid, fid)
+		return m.DeleteFridgeIngredientOverride(ctx, e)
 	}
 
 	return nil
 }
 
+func (m *Mockstore) ListFridgeEvents(ctx context.Context, hid uuid.UUID, from, to time.Time) ([]store.FridgeEvent, error) {
+	if m.ListFridgeEventsOverride != nil {
+		return m.ListFridgeEventsOverride(ctx, hid, from, to)
+	}
+
+	cost := units.MustParseAmount("3.5")
+
+	return []store.FridgeEvent{ //a lot of onions that got put in and went off
+		{
+			FridgeEventUUID: uuid.MustParse("5a1c3e7b-9d2f-4b6a-8c0e-6f8a0c2e4b70"),
+			EventType:       store.FridgeEventTypeAdd,
+			HouseholdUUID:   hid,
+			UserUUID:        uuid.MustParse("080b5f09-527b-4581-bb56-19adbfe50ebf"),
+			FridgeItemUUID:  uuid.MustParse("4e8a2d6c-1f5b-4c7e-9a3d-8b2f0c6e4d17"),
+			IngredientUUID:  uuid.MustParse("ffff7c73-52b0-4e3d-bf3f-0c26785ef972"),
+			IngredientName:  "onion",
+			Category:        "vegetables",
+			Amount:          units.Whole(1),
+			Unit:            "kg",
+			PurchasedDate:   time.Date(2023, time.March, 24, 15, 0, 0, 0, time.UTC),
+			ExpirationDate:  time.Date(2023, time.March, 31, 15, 0, 0, 0, time.UTC),
+			Location:        "fridge",
+			CreatedAt:       time.Date(2023, time.March, 24, 15, 0, 0, 0, time.UTC),
+		},
+		{
+			FridgeEventUUID: uuid.MustParse("7b3d5f9a-1c2e-4a4b-8d6f-8e0a2c4b6d81"),
+			EventType:       store.FridgeEventTypeDelete,
+			HouseholdUUID:   hid,
+			UserUUID:        uuid.MustParse("080b5f09-527b-4581-bb56-19adbfe50ebf"),
+			FridgeItemUUID:  uuid.MustParse("4e8a2d6c-1f5b-4c7e-9a3d-8b2f0c6e4d17"),
+			IngredientUUID:  uuid.MustParse("ffff7c73-52b0-4e3d-bf3f-0c26785ef972"),
+			IngredientName:  "onion",
+			Category:        "vegetables",
+			Amount:          units.Whole(1),
+			Unit:            "kg",
+			PurchasedDate:   time.Date(2023, time.March, 24, 15, 0, 0, 0, time.UTC),
+			ExpirationDate:  time.Date(2023, time.March, 31, 15, 0, 0, 0, time.UTC),
+			Location:        "fridge",
+			Reason:          store.FridgeEventExpired,
+			EstimatedCost:   &cost,
+			CreatedAt:       time.Date(2023, time.April, 1, 9, 0, 0, 0, time.UTC),
+		},
+	}, nil
+}
+
+func (m *Mockstore) ListUserFridgeEvents(ctx context.Context, uid uuid.UUID) ([]store.FridgeEvent, error) {
+	if m.ListUserFridgeEventsOverride != nil {
+		return m.ListUserFridgeEventsOverride(ctx, uid)
+	}
+
+	return m.ListFridgeEvents(ctx, defaultHousehold, time.Time{}, time.Now()) //the same onions
+}
+
+func (m *Mockstore) ConsumeFridgeIngredient(ctx context.Context, hid, iid, uid uuid.UUID, amount units.Amount, unit string) ([]store.FridgeIngredient, error) {
+	if m.ConsumeFridgeIngredientOverride != nil {
+		return m.ConsumeFridgeIngredientOverride(ctx, hid, iid, uid, amount, unit)
+	}
+
+	return []store.FridgeIngredient{ //what's left of the newer lot
+		{
+			FridgeItemUUID: uuid.MustParse("4e8a2d6c-1f5b-4c7e-9a3d-8b2f0c6e4d17"),
+			HouseholdUUID:  hid,
+			UserUUID:       uuid.MustParse("080b5f09-527b-4581-bb56-19adbfe50ebf"),
+			IngredientUUID: iid,
+			Amount:         units.Whole(1),
+			Unit:           unit,
+			PurchasedDate:  time.Date(2023, time.March, 28, 15, 0, 0, 0, time.UTC),
+			ExpirationDate: time.Date(2023, time.March, 28, 15, 0, 0, 0, time.UTC),
+			Location:       "fridge",
+			CreatedAt:      time.Now(),
+			UpdatedAt:      time.Now(),
+		},
+	}, nil
+}
+
 func (m *Mockstore) GetRecipe(ctx context.Context, id uuid.UUID) (*store.Recipe, error) {
 	if m.GetRecipeOverride != nil {
 		return m.GetRecipeOverride(ctx, id)
@@ -329,13 +793,13 @@ func (m *Mockstore) CreateRecipe(ctx context.Context, r store.Recipe) (*store.Re
 			{
 				RecipeUUID:     recipeID,                                               //이바부야.. methods.go에서 이미 recipe.RecipeUUID로 채워놨자나..
 				IngredientUUID: uuid.MustParse("2c98fff4-7ccc-4536-8259-67a88380e99b"), //니 맘대로 uuid 바꿔도 상관없어~ 숫자, 소문자, 대문자 다 상관없어, as long as they're 0~9,a~f
-				Amount:         1,
+				Amount:         units.Whole(1),
 				Unit:           "kg",
 			},
 			{
 				RecipeUUID:     recipeID,
 				IngredientUUID: uuid.MustParse("2c98fff4-7ccc-4536-8259-67a88380e99b"),
-				Amount:         1,
+				Amount:         units.Whole(1),
 				Unit:           "unit",
 			},
 		},
@@ -373,3 +837,535 @@ func (m *Mockstore) DeleteRecipe(ctx context.Context, id uuid.UUID) error {
 
 	return nil
 }
+
+func (m *Mockstore) SuggestRecipes(ctx context.Context, hid uuid.UUID, q store.SuggestionQuery) ([]store.RecipeSuggestion, error) {
+	if m.SuggestRecipesOverride != nil {
+		return m.SuggestRecipesOverride(ctx, hid, q)
+	}
+
+	kimchiExpirationDate := time.Now().Add(10 * 24 * time.Hour)
+	milkExpirationDate := time.Now().Add(24 * time.Hour)
+
+	return []store.RecipeSuggestion{
+		{
+			RecipeUUID: uuid.MustParse("ffff7c73-52b0-4e3d-bf3f-0c26785ef972"),
+			UserUUID:   uuid.MustParse("2c98fff4-7ccc-4536-8259-67a88380e99c"),
+			RecipeName: "kimchi jeon",
+			Category:   "Korean",
+			Coverage:   100,
+			Score:      1, //ranked by coverage only
+			Ingredients: []store.SuggestionIngredient{
+				{
+					IngredientUUID: uuid.MustParse("ffff7c73-52b0-4e3d-bf3f-0c26785ef972"),
+					IngredientName: "kimchi",
+					Amount:         units.Whole(1),
+					Unit:           "kg",
+					Available:      []store.FridgeAmount{{Amount: units.Whole(3), Unit: "kg", ExpirationDate: kimchiExpirationDate}},
+				},
+			},
+		},
+		{
+			RecipeUUID: uuid.MustParse("2c98fff4-7ccc-4536-8259-67a88380e99c"),
+			UserUUID:   uuid.MustParse("2c98fff4-7ccc-4536-8259-67a88380e99c"),
+			RecipeName: "kimchi mandu",
+			Category:   "Korean",
+			Coverage:   75,
+			Score:      0.75,
+			Ingredients: []store.SuggestionIngredient{
+				{
+					IngredientUUID: uuid.MustParse("ffff7c73-52b0-4e3d-bf3f-0c26785ef972"),
+					IngredientName: "kimchi",
+					Amount:         units.Whole(1),
+					Unit:           "kg",
+					Available:      []store.FridgeAmount{{Amount: units.Whole(3), Unit: "kg", ExpirationDate: kimchiExpirationDate}},
+				},
+				{
+					IngredientUUID: uuid.MustParse("2c98fff4-7ccc-4536-8259-67a88380e99b"),
+					IngredientName: "milk",
+					Amount:         units.Whole(4),
+					Unit:           "L",
+					Available:      []store.FridgeAmount{{Amount: units.Whole(1), Unit: "L", ExpirationDate: milkExpirationDate}, {Amount: units.Whole(1000), Unit: "ml", ExpirationDate: milkExpirationDate}},
+				},
+			},
+		},
+	}, nil
+}
+
+func (m *Mockstore) CookRecipe(ctx context.Context, l store.CookLog, deductions []store.FridgeDeduction) (*store.CookLog, error) {
+	if m.CookRecipeOverride != nil {
+		return m.CookRecipeOverride(ctx, l, deductions)
+	}
+
+	l.CookLogUUID = uuid.New()
+	l.CreatedAt = time.Now()
+
+	return &l, nil
+}
+
+func (m *Mockstore) ListCookLogs(ctx context.Context, uid uuid.UUID) ([]store.CookLog, error) {
+	if m.ListCookLogsOverride != nil {
+		return m.ListCookLogsOverride(ctx, uid)
+	}
+
+	return []store.CookLog{
+		{
+			CookLogUUID:   uuid.MustParse("6a2c4e8f-0b1d-4f3a-9c5e-7d9f1b3a5c70"),
+			HouseholdUUID: defaultHousehold,
+			UserUUID:      uid,
+			RecipeUUID:    uuid.MustParse("ffff7c73-52b0-4e3d-bf3f-0c26785ef972"),
+			RecipeName:    "kimchi jeon",
+			Servings:      2,
+			CreatedAt:     time.Date(2023, time.March, 25, 19, 0, 0, 0, time.UTC),
+		},
+	}, nil
+}
+
+func (m *Mockstore) GetDigestSettings(ctx context.Context, uid uuid.UUID) (*store.DigestSettings, error) {
+	if m.GetDigestSettingsOverride != nil {
+		return m.GetDigestSettingsOverride(ctx, uid)
+	}
+
+	return &store.DigestSettings{
+		UserUUID:   uid,
+		Enabled:    true,
+		Minute:     8 * 60,
+		Timezone:   "Asia/Seoul",
+		Channel:    "email",
+		WithinDays: 3,
+		CreatedAt:  time.Now(),
+		UpdatedAt:  time.Now(),
+	}, nil
+}
+
+func (m *Mockstore) SetDigestSettings(ctx context.Context, d store.DigestSettings) (*store.DigestSettings, error) {
+	if m.SetDigestSettingsOverride != nil {
+		return m.SetDigestSettingsOverride(ctx, d)
+	}
+
+	d.CreatedAt = time.Now()
+	d.UpdatedAt = time.Now()
+
+	return &d, nil
+}
+
+func (m *Mockstore) ListEnabledDigestSettings(ctx context.Context) ([]store.DigestSettings, error) {
+	if m.ListEnabledDigestSettingsOverride != nil {
+		return m.ListEnabledDigestSettingsOverride(ctx)
+	}
+
+	return []store.DigestSettings{
+		{
+			UserUUID:   uuid.MustParse("080b5f09-527b-4581-bb56-19adbfe50ebf"),
+			Enabled:    true,
+			Minute:     8 * 60,
+			Timezone:   "Asia/Seoul",
+			Channel:    "email",
+			WithinDays: 3,
+			CreatedAt:  time.Now(),
+			UpdatedAt:  time.Now(),
+		},
+	}, nil
+}
+
+func (m *Mockstore) ClaimDigest(ctx context.Context, uid uuid.UUID, day time.Time) (bool, error) {
+	if m.ClaimDigestOverride != nil {
+		return m.ClaimDigestOverride(ctx, uid, day)
+	}
+
+	return true, nil
+}
+
+func (m *Mockstore) GetRefreshToken(ctx context.Context, hashedToken string) (*store.RefreshToken, error) {
+	if m.GetRefreshTokenOverride != nil {
+		return m.GetRefreshTokenOverride(ctx, hashedToken)
+	}
+
+	return &store.RefreshToken{
+		RefreshTokenUUID: uuid.MustParse("ffff7c73-52b0-4e3d-bf3f-0c26785ef972"),
+		FamilyUUID:       uuid.MustParse("2c98fff4-7ccc-4536-8259-67a88380e99c"),
+		UserUUID:         uuid.MustParse("080b5f09-527b-4581-bb56-19adbfe50ebf"),
+		HashedToken:      hashedToken,
+		ExpiresAt:        time.Now().Add(24 * time.Hour),
+		CreatedAt:        time.Now(),
+	}, nil
+}
+
+func (m *Mockstore) ListRefreshTokens(ctx context.Context, uid uuid.UUID) ([]store.RefreshToken, error) {
+	if m.ListRefreshTokensOverride != nil {
+		return m.ListRefreshTokensOverride(ctx, uid)
+	}
+
+	revokedAt := time.Date(2022, 12, 24, 12, 0, 0, 0, time.UTC)
+
+	return []store.RefreshToken{
+		{
+			RefreshTokenUUID: uuid.MustParse("ffff7c73-52b0-4e3d-bf3f-0c26785ef972"),
+			FamilyUUID:       uuid.MustParse("2c98fff4-7ccc-4536-8259-67a88380e99c"),
+			UserUUID:         uid,
+			HashedToken:      "4f1c2e7a9b3d5f60718293a4b5c6d7e8f90a1b2c3d4e5f60718293a4b5c6d7e8",
+			ExpiresAt:        time.Date(2023, 1, 24, 12, 0, 0, 0, time.UTC),
+			CreatedAt:        time.Date(2022, 12, 25, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			RefreshTokenUUID: uuid.MustParse("0d9e8f7a-6b5c-4d3e-8f2a-1b0c9d8e7f6a"),
+			FamilyUUID:       uuid.MustParse("2c98fff4-7ccc-4536-8259-67a88380e99c"),
+			UserUUID:         uid,
+			HashedToken:      "9a8b7c6d5e4f30211203f4e5d6c7b8a99a8b7c6d5e4f30211203f4e5d6c7b8a9",
+			ExpiresAt:        time.Date(2023, 1, 23, 12, 0, 0, 0, time.UTC),
+			RevokedAt:        &revokedAt, //rotated
+			CreatedAt:        time.Date(2022, 12, 24, 12, 0, 0, 0, time.UTC),
+		},
+	}, nil
+}
+
+func (m *Mockstore) CreateRefreshToken(ctx context.Context, t store.RefreshToken) (*store.RefreshToken, error) {
+	if m.CreateRefreshTokenOverride != nil {
+		return m.CreateRefreshTokenOverride(ctx, t)
+	}
+
+	t.RefreshTokenUUID = uuid.New()
+	t.CreatedAt = time.Now()
+
+	return &t, nil
+}
+
+func (m *Mockstore) RotateRefreshToken(ctx context.Context, id uuid.UUID, next store.RefreshToken) (*store.RefreshToken, error) {
+	if m.RotateRefreshTokenOverride != nil {
+		return m.RotateRefreshTokenOverride(ctx, id, next)
+	}
+
+	next.RefreshTokenUUID = uuid.New()
+	next.CreatedAt = time.Now()
+
+	return &next, nil
+}
+
+func (m *Mockstore) RevokeRefreshTokenFamily(ctx context.Context, familyID uuid.UUID) error {
+	if m.RevokeRefreshTokenFamilyOverride != nil {
+		return m.RevokeRefreshTokenFamilyOverride(ctx, familyID)
+	}
+
+	return nil
+}
+
+func (m *Mockstore) RevokeAccessToken(ctx context.Context, jti uuid.UUID, expiresAt time.Time) error {
+	if m.RevokeAccessTokenOverride != nil {
+		return m.RevokeAccessTokenOverride(ctx, jti, expiresAt)
+	}
+
+	return nil
+}
+
+func (m *Mockstore) IsAccessTokenRevoked(ctx context.Context, jti uuid.UUID) (bool, error) {
+	if m.IsAccessTokenRevokedOverride != nil {
+		return m.IsAccessTokenRevokedOverride(ctx, jti)
+	}
+
+	return false, nil
+}
+
+func (m *Mockstore) CreatePersonalAccessToken(ctx context.Context, t store.PersonalAccessToken) (*store.PersonalAccessToken, error) {
+	if m.CreatePersonalAccessTokenOverride != nil {
+		return m.CreatePersonalAccessTokenOverride(ctx, t)
+	}
+
+	t.PersonalAccessTokenUUID = uuid.New()
+	t.CreatedAt = time.Now()
+
+	return &t, nil
+}
+
+func (m *Mockstore) ListPersonalAccessTokens(ctx context.Context, uid uuid.UUID) ([]store.PersonalAccessToken, error) {
+	if m.ListPersonalAccessTokensOverride != nil {
+		return m.ListPersonalAccessTokensOverride(ctx, uid)
+	}
+
+	lastUsedAt := time.Date(2022, 12, 26, 0, 0, 0, 0, time.UTC)
+
+	return []store.PersonalAccessToken{
+		{
+			PersonalAccessTokenUUID: uuid.MustParse("3f6c2a8e-1b4d-4c7e-9a2f-5d8e1c3b7a90"),
+			UserUUID:                uid,
+			Name:                    "fridge sync",
+			Scopes:                  []string{"fridge:read", "fridge:write"},
+			HashedToken:             "5994471abb01112afcc18159f6cc74b4f511b99806da59b3caf5a9c173cacfc5",
+			LastUsedAt:              &lastUsedAt,
+			CreatedAt:               time.Date(2022, 12, 25, 0, 0, 0, 0, time.UTC),
+		},
+	}, nil
+}
+
+func (m *Mockstore) DeletePersonalAccessToken(ctx context.Context, uid, tid uuid.UUID) error {
+	if m.DeletePersonalAccessTokenOverride != nil {
+		return m.DeletePersonalAccessTokenOverride(ctx, uid, tid)
+	}
+
+	return nil
+}
+
+func (m *Mockstore) UsePersonalAccessToken(ctx context.Context, hashedToken string) (*store.PersonalAccessToken, error) {
+	if m.UsePersonalAccessTokenOverride != nil {
+		return m.UsePersonalAccessTokenOverride(ctx, hashedToken)
+	}
+
+	now := time.Now()
+
+	return &store.PersonalAccessToken{
+		PersonalAccessTokenUUID: uuid.MustParse("3f6c2a8e-1b4d-4c7e-9a2f-5d8e1c3b7a90"),
+		UserUUID:                uuid.MustParse("080b5f09-527b-4581-bb56-19adbfe50ebf"),
+		Name:                    "fridge sync",
+		Scopes:                  []string{"fridge:read", "fridge:write"},
+		HashedToken:             hashedToken,
+		LastUsedAt:              &now,
+		CreatedAt:               time.Date(2022, 12, 25, 0, 0, 0, 0, time.UTC),
+	}, nil
+}
+
+// GetTOTP defaults to no 2fa, so logins stay password only unless a test wants otherwise.
+func (m *Mockstore) GetTOTP(ctx context.Context, uid uuid.UUID) (*store.TOTP, error) {
+	if m.GetTOTPOverride != nil {
+		return m.GetTOTPOverride(ctx, uid)
+	}
+
+	return nil, store.ErrNotFound
+}
+
+func (m *Mockstore) StartTOTPEnrolment(ctx context.Context, t store.TOTP, hashedRecoveryCodes []string) (*store.TOTP, error) {
+	if m.StartTOTPEnrolmentOverride != nil {
+		return m.StartTOTPEnrolmentOverride(ctx, t, hashedRecoveryCodes)
+	}
+
+	t.CreatedAt = time.Now()
+
+	return &t, nil
+}
+
+func (m *Mockstore) EnableTOTP(ctx context.Context, uid uuid.UUID, step int64) error {
+	if m.EnableTOTPOverride != nil {
+		return m.EnableTOTPOverride(ctx, uid, step)
+	}
+
+	return nil
+}
+
+func (m *Mockstore) DisableTOTP(ctx context.Context, uid uuid.UUID) error {
+	if m.DisableTOTPOverride != nil {
+		return m.DisableTOTPOverride(ctx, uid)
+	}
+
+	return nil
+}
+
+func (m *Mockstore) UseTOTPStep(ctx context.Context, uid uuid.UUID, step int64) (bool, error) {
+	if m.UseTOTPStepOverride != nil {
+		return m.UseTOTPStepOverride(ctx, uid, step)
+	}
+
+	return true, nil
+}
+
+func (m *Mockstore) UseRecoveryCode(ctx context.Context, uid uuid.UUID, hashedCode string) error {
+	if m.UseRecoveryCodeOverride != nil {
+		return m.UseRecoveryCodeOverride(ctx, uid, hashedCode)
+	}
+
+	return store.ErrNotFound
+}
+
+func (m *Mockstore) CreateLoginChallenge(ctx context.Context, c store.LoginChallenge) (*store.LoginChallenge, error) {
+	if m.CreateLoginChallengeOverride != nil {
+		return m.CreateLoginChallengeOverride(ctx, c)
+	}
+
+	c.LoginChallengeUUID = uuid.New()
+	c.CreatedAt = time.Now()
+
+	return &c, nil
+}
+
+// AttemptLoginChallenge defaults to a first attempt on a challenge that's good until 2022-12-25 00:05 UTC.
+func (m *Mockstore) AttemptLoginChallenge(ctx context.Context, hashedToken string) (*store.LoginChallenge, error) {
+	if m.AttemptLoginChallengeOverride != nil {
+		return m.AttemptLoginChallengeOverride(ctx, hashedToken)
+	}
+
+	return &store.LoginChallenge{
+		LoginChallengeUUID: uuid.MustParse("b1e2c3d4-5f60-4718-8a9b-0c1d2e3f4a5b"),
+		UserUUID:           uuid.MustParse("080b5f09-527b-4581-bb56-19adbfe50ebf"),
+		HashedToken:        hashedToken,
+		Attempts:           1,
+		ExpiresAt:          time.Date(2022, 12, 25, 0, 5, 0, 0, time.UTC),
+		CreatedAt:          time.Date(2022, 12, 25, 0, 0, 0, 0, time.UTC),
+	}, nil
+}
+
+func (m *Mockstore) UseLoginChallenge(ctx context.Context, id uuid.UUID) error {
+	if m.UseLoginChallengeOverride != nil {
+		return m.UseLoginChallengeOverride(ctx, id)
+	}
+
+	return nil
+}
+
+func (m *Mockstore) UseUserIdentity(ctx context.Context, provider, subject string) (*store.UserIdentity, error) {
+	if m.UseUserIdentityOverride != nil {
+		return m.UseUserIdentityOverride(ctx, provider, subject)
+	}
+
+	return nil, store.ErrNotFound //nobody's linked until a test says so
+}
+
+func (m *Mockstore) ListUserIdentities(ctx context.Context, uid uuid.UUID) ([]store.UserIdentity, error) {
+	if m.ListUserIdentitiesOverride != nil {
+		return m.ListUserIdentitiesOverride(ctx, uid)
+	}
+
+	return nil, nil
+}
+
+func (m *Mockstore) CreateUserIdentity(ctx context.Context, i store.UserIdentity) (*store.UserIdentity, error) {
+	if m.CreateUserIdentityOverride != nil {
+		return m.CreateUserIdentityOverride(ctx, i)
+	}
+
+	now := time.Now()
+	i.UserIdentityUUID = uuid.New()
+	i.CreatedAt = now
+	i.LastLoginAt = &now
+
+	return &i, nil
+}
+
+func (m *Mockstore) CreateUserWithIdentity(ctx context.Context, u store.User, i store.UserIdentity) (*store.User, error) {
+	if m.CreateUserWithIdentityOverride != nil {
+		return m.CreateUserWithIdentityOverride(ctx, u, i)
+	}
+
+	now := time.Now()
+
+	return &store.User{
+		UserUUID:        uuid.New(),
+		HashedPassword:  u.HashedPassword,
+		Active:          u.Active,
+		Role:            store.RoleUser,
+		FirstName:       u.FirstName,
+		LastName:        u.LastName,
+		EmailAddress:    u.EmailAddress,
+		EmailVerifiedAt: &now,
+		CreatedAt:       now,
+		UpdatedAt:       now,
+	}, nil
+}
+
+func (m *Mockstore) CreateOIDCState(ctx context.Context, st store.OIDCState) (*store.OIDCState, error) {
+	if m.CreateOIDCStateOverride != nil {
+		return m.CreateOIDCStateOverride(ctx, st)
+	}
+
+	st.OIDCStateUUID = uuid.New()
+	st.CreatedAt = time.Now()
+
+	return &st, nil
+}
+
+func (m *Mockstore) UseOIDCState(ctx context.Context, hashedState string) (*store.OIDCState, error) {
+	if m.UseOIDCStateOverride != nil {
+		return m.UseOIDCStateOverride(ctx, hashedState)
+	}
+
+	return &store.OIDCState{
+		OIDCStateUUID: uuid.MustParse("6a0f4c1e-8d2b-4e3a-b5c7-9f1d2e3a4b5c"),
+		HashedState:   hashedState,
+		Provider:      "google",
+		Nonce:         "nonce",
+		CodeVerifier:  "verifier",
+		ExpiresAt:     time.Date(2022, 12, 25, 0, 10, 0, 0, time.UTC),
+		CreatedAt:     time.Date(2022, 12, 25, 0, 0, 0, 0, time.UTC),
+	}, nil
+}
+
+func (m *Mockstore) CreatePasswordResetToken(ctx context.Context, t store.PasswordResetToken) (*store.PasswordResetToken, error) {
+	if m.CreatePasswordResetTokenOverride != nil {
+		return m.CreatePasswordResetTokenOverride(ctx, t)
+	}
+
+	t.PasswordResetTokenUUID = uuid.New()
+	t.CreatedAt = time.Now()
+
+	return &t, nil
+}
+
+func (m *Mockstore) GetPasswordResetUser(ctx context.Context, hashedToken string) (*store.User, error) {
+	if m.GetPasswordResetUserOverride != nil {
+		return m.GetPasswordResetUserOverride(ctx, hashedToken)
+	}
+
+	return m.GetUser(ctx, uuid.MustParse("080b5f09-527b-4581-bb56-19adbfe50ebf"))
+}
+
+func (m *Mockstore) ResetPassword(ctx context.Context, hashedToken string, hashedPassword string) error {
+	if m.ResetPasswordOverride != nil {
+		return m.ResetPasswordOverride(ctx, hashedToken, hashedPassword)
+	}
+
+	return nil
+}
+
+func (m *Mockstore) CreateEmailVerificationToken(ctx context.Context, t store.EmailVerificationToken) (*store.EmailVerificationToken, error) {
+	if m.CreateEmailVerificationTokenOverride != nil {
+		return m.CreateEmailVerificationTokenOverride(ctx, t)
+	}
+
+	t.EmailVerificationTokenUUID = uuid.New()
+	t.CreatedAt = time.Now()
+
+	return &t, nil
+}
+
+func (m *Mockstore) VerifyEmail(ctx context.Context, hashedToken string) (*store.User, error) {
+	if m.VerifyEmailOverride != nil {
+		return m.VerifyEmailOverride(ctx, hashedToken)
+	}
+
+	verifiedAt := time.Date(2022, 12, 25, 0, 0, 0, 0, time.UTC)
+
+	return &store.User{
+		UserUUID:        uuid.MustParse("080b5f09-527b-4581-bb56-19adbfe50ebf"),
+		Active:          true,
+		Role:            store.RoleUser,
+		FirstName:       "jy",
+		LastName:        "woo",
+		EmailAddress:    "jywoo92324@gmail.com",
+		EmailVerifiedAt: &verifiedAt,
+		CreatedAt:       time.Now(),
+		UpdatedAt:       time.Now(),
+	}, nil
+}
+
+func (m *Mockstore) CreateLockoutEvent(ctx context.Context, e store.LockoutEvent) (*store.LockoutEvent, error) {
+	if m.CreateLockoutEventOverride != nil {
+		return m.CreateLockoutEventOverride(ctx, e)
+	}
+
+	e.LockoutEventUUID = uuid.New()
+	e.CreatedAt = time.Now()
+
+	return &e, nil
+}
+
+func (m *Mockstore) ListLockoutEvents(ctx context.Context, limit int) ([]store.LockoutEvent, error) {
+	if m.ListLockoutEventsOverride != nil {
+		return m.ListLockoutEventsOverride(ctx, limit)
+	}
+
+	return []store.LockoutEvent{
+		{
+			LockoutEventUUID: uuid.MustParse("7d4f1e1e-9a7b-4b0e-8f5e-3f1c2b6a9d10"),
+			Scope:            "account",
+			Subject:          "jywoo92324@gmail.com",
+			Failures:         10,
+			LockedUntil:      time.Date(2022, 12, 25, 0, 15, 0, 0, time.UTC),
+			CreatedAt:        time.Date(2022, 12, 25, 0, 0, 0, 0, time.UTC),
+		},
+	}, nil
+}
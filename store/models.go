@@ -2,26 +2,56 @@ package store
 
 import (
 	"time"
+	"wdiet/units"
 
 	"github.com/google/uuid"
 )
 
 type User struct {
-	UserUUID       uuid.UUID
-	HashedPassword string
-	Active         bool
-	FirstName      string
-	LastName       string
-	EmailAddress   string
-	CreatedAt      time.Time
-	UpdatedAt      time.Time
+	UserUUID        uuid.UUID
+	HashedPassword  string
+	Active          bool
+	Role            string //one of the Role constants, only SetUserRole changes it
+	FirstName       string
+	LastName        string
+	EmailAddress    string
+	EmailVerifiedAt *time.Time //nil until the user clicks the link we mailed
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+}
+
+// UserStatus is what ValidateToken needs to know about a user on every request.
+type UserStatus struct {
+	Active        bool
+	EmailVerified bool
+	Role          string
+}
+
+// roles, each one gets everything the one before it gets.
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator" //can change the shared ingredient catalog
+	RoleAdmin     = "admin"
+)
+
+// IsValidRole tells if role is one of the Role constants.
+func IsValidRole(role string) bool {
+	switch role {
+	case RoleUser, RoleModerator, RoleAdmin:
+		return true
+	}
+	return false
 }
 
 type Ingredient struct {
 	IngredientUUID uuid.UUID
 	IngredientName string
 	Category       string
-	DaysUntilExp   int
+	DaysUntilExp   int //in the fridge
+	FreezerDays    int //0 if we don't know these
+	PantryDays     int
+	OpenedDays     int
+	Density        float64 //g per ml, so volumes of it convert to mass. 0 if we don't know it
 	CreatedAt      time.Time
 	UpdatedAt      time.Time
 }
@@ -37,17 +67,80 @@ type SearchIngredient struct {
 	Category       *string
 }
 
+// FridgeIngredient is one lot of an ingredient in a fridge. The same ingredient can have several, e.g. two cartons of
+// milk bought on different days.
 type FridgeIngredient struct {
-	UserUUID       uuid.UUID
+	FridgeItemUUID uuid.UUID
+	HouseholdUUID  uuid.UUID //whose fridge it's in
+	UserUUID       uuid.UUID //who put it there, uuid.Nil once they deleted their account
 	IngredientUUID uuid.UUID
-	Amount         int
+	Amount         units.Amount
 	Unit           string
 	PurchasedDate  time.Time
 	ExpirationDate time.Time
+	Location       string     //fridge, freezer or pantry
+	OpenedDate     *time.Time //nil while it's unopened
 	CreatedAt      time.Time
 	UpdatedAt      time.Time
 }
 
+// Household is a fridge and the people sharing it.
+type Household struct {
+	HouseholdUUID uuid.UUID
+	HouseholdName string
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+// household roles
+const (
+	HouseholdRoleOwner  = "owner"  //can do everything, including inviting people and changing their roles
+	HouseholdRoleMember = "member" //can change the fridge
+	HouseholdRoleViewer = "viewer" //can only look
+)
+
+// IsValidHouseholdRole tells if role is one of the HouseholdRole constants.
+func IsValidHouseholdRole(role string) bool {
+	switch role {
+	case HouseholdRoleOwner, HouseholdRoleMember, HouseholdRoleViewer:
+		return true
+	}
+	return false
+}
+
+// HouseholdMember is a user in a household, with enough of the user to show who it is.
+type HouseholdMember struct {
+	HouseholdUUID uuid.UUID
+	UserUUID      uuid.UUID
+	Role          string
+	FirstName     string
+	LastName      string
+	EmailAddress  string
+	CreatedAt     time.Time //when they joined
+}
+
+// HouseholdMembership is a household as one of its members sees it.
+type HouseholdMembership struct {
+	HouseholdUUID uuid.UUID
+	HouseholdName string
+	Role          string
+	Active        bool      //the fridge routes work on this one
+	CreatedAt     time.Time //when they joined
+}
+
+// HouseholdInvitation is an invitation mailed to someone to join a household.
+type HouseholdInvitation struct {
+	HouseholdInvitationUUID uuid.UUID
+	HouseholdUUID           uuid.UUID
+	EmailAddress            string //only a user with this verified address can accept it
+	Role                    string
+	HashedToken             string
+	InvitedBy               uuid.UUID //uuid.Nil once they deleted their account
+	ExpiresAt               time.Time
+	AcceptedAt              *time.Time
+	CreatedAt               time.Time
+}
+
 type DeleteFIngr struct {
 	UserUUID       uuid.UUID
 	IngredientUUID uuid.UUID
@@ -73,7 +166,7 @@ type SearchRecipes struct {
 type RecipeIngredient struct { //your db model always matches your table. 그래서 여기에서는 init magrate up에 있는 모든 필드 다 있음.
 	RecipeUUID     uuid.UUID
 	IngredientUUID uuid.UUID
-	Amount         int
+	Amount         units.Amount
 	Unit           string
 }
 
@@ -82,3 +175,220 @@ type RecipeInstruction struct {
 	StepNum     int
 	Instruction string
 }
+
+type RecipeSuggestion struct { //recipe 하나 + 그 recipe의 재료들이 fridge에 얼마나 있는지.
+	RecipeUUID  uuid.UUID
+	UserUUID    uuid.UUID
+	RecipeName  string
+	Category    string
+	Coverage    float64 //0 to 100, one decimal: the average over the ingredients of how much of what the recipe needs the fridge has
+	Score       float64 //two decimals, see SuggestionQuery
+	Ingredients []SuggestionIngredient
+}
+
+// SuggestionQuery is how SuggestRecipes ranks recipes and how many it lists. They're ranked by
+//
+//	score = CoverageWeight * coverage/100 + ExpiryWeight * sum(urgency)
+//
+// and then by coverage. Every ingredient whose first lot that hasn't expired yet expires within WithinDays adds
+// urgency = (WithinDays + 1 - days_left) / (WithinDays + 1), so something expiring today counts the most.
+type SuggestionQuery struct {
+	Now            time.Time
+	WithinDays     int
+	CoverageWeight float64
+	ExpiryWeight   float64
+	Limit          int
+}
+
+type SuggestionIngredient struct {
+	IngredientUUID uuid.UUID
+	IngredientName string
+	Density        float64
+	Amount         units.Amount
+	Unit           string
+	Available      []FridgeAmount //what the household's fridge has of this ingredient. Some of it might have expired already.
+}
+
+// FridgeAmount is how much of an ingredient the fridge has in one unit that goes off at one time, the lots that are
+// the same added up.
+type FridgeAmount struct {
+	Amount         units.Amount
+	Unit           string
+	ExpirationDate time.Time
+}
+
+// FridgeDeduction is what cooking does to one lot. Amount and Unit are what the lot had when the deduction was worked
+// out, if it changed since then the fridge isn't what the cook was planned on anymore.
+type FridgeDeduction struct {
+	FridgeItemUUID uuid.UUID
+	Amount         units.Amount
+	Unit           string
+	LeftAmount     units.Amount //0 takes the lot out of the fridge
+	LeftUnit       string
+}
+
+// CookLog is a recipe somebody cooked out of a household's fridge.
+type CookLog struct {
+	CookLogUUID   uuid.UUID
+	HouseholdUUID uuid.UUID
+	UserUUID      uuid.UUID //who cooked, uuid.Nil once they deleted their account
+	RecipeUUID    uuid.UUID //uuid.Nil once the recipe is deleted
+	RecipeName    string
+	Servings      float64
+	CreatedAt     time.Time
+}
+
+// FridgeEvent is something that happened to a lot in a household's fridge. The fridge is the events replayed, see
+// ReplayFridgeEvents. Every event has the lot as it is after it, except a delete, which has it as it was.
+type FridgeEvent struct {
+	FridgeEventUUID uuid.UUID
+	EventType       string
+	HouseholdUUID   uuid.UUID
+	UserUUID        uuid.UUID //who did it, uuid.Nil once they deleted their account
+	FridgeItemUUID  uuid.UUID
+	IngredientUUID  uuid.UUID //uuid.Nil once the ingredient is deleted
+	IngredientName  string    //as it was when it happened
+	Category        string
+	Amount          units.Amount
+	Unit            string
+	PurchasedDate   time.Time //zero on the deletes from before there was a ledger, we don't know them
+	ExpirationDate  time.Time
+	Location        string
+	OpenedDate      *time.Time
+	Reason          string        //why it got deleted, only on deletes
+	EstimatedCost   *units.Amount //nil if they didn't say what it cost
+	CreatedAt       time.Time
+}
+
+// fridge event types
+const (
+	FridgeEventTypeAdd     = "add"
+	FridgeEventTypeUpdate  = "update"
+	FridgeEventTypeMove    = "move"
+	FridgeEventTypeOpen    = "open"
+	FridgeEventTypeConsume = "consume" //consumed or cooked, a lot that gets to 0 is gone
+	FridgeEventTypeDelete  = "delete"
+)
+
+// fridge event reasons
+const (
+	FridgeEventConsumed  = "consumed"
+	FridgeEventExpired   = "expired"
+	FridgeEventDiscarded = "discarded" //thrown out before it went off, e.g. it got mouldy or nobody liked it
+	FridgeEventGivenAway = "given_away"
+)
+
+// IsValidFridgeEventReason tells if reason is one of the fridge event reasons.
+func IsValidFridgeEventReason(reason string) bool {
+	switch reason {
+	case FridgeEventConsumed, FridgeEventExpired, FridgeEventDiscarded, FridgeEventGivenAway:
+		return true
+	}
+	return false
+}
+
+type RefreshToken struct {
+	RefreshTokenUUID uuid.UUID
+	FamilyUUID       uuid.UUID
+	UserUUID         uuid.UUID
+	HashedToken      string
+	ExpiresAt        time.Time
+	RevokedAt        *time.Time
+	CreatedAt        time.Time
+}
+
+// PersonalAccessToken is a long lived token a user makes for scripts, so they don't have to keep the password around.
+type PersonalAccessToken struct {
+	PersonalAccessTokenUUID uuid.UUID
+	UserUUID                uuid.UUID
+	Name                    string
+	Scopes                  []string
+	HashedToken             string
+	ExpiresAt               *time.Time //nil never expires
+	LastUsedAt              *time.Time
+	CreatedAt               time.Time
+}
+
+// TOTP is a user's authenticator app enrolment.
+type TOTP struct {
+	UserUUID  uuid.UUID
+	Secret    string
+	EnabledAt *time.Time //nil while enrolment isn't confirmed, login doesn't ask for a code until it is
+	LastStep  int64      //the time step of the last code used, codes can't be used twice
+	CreatedAt time.Time
+}
+
+// LoginChallenge is handed out instead of tokens when the password was right but the user still owes us a second factor.
+type LoginChallenge struct {
+	LoginChallengeUUID uuid.UUID
+	UserUUID           uuid.UUID
+	HashedToken        string
+	Attempts           int //counting the current one
+	ExpiresAt          time.Time
+	UsedAt             *time.Time
+	CreatedAt          time.Time
+}
+
+// UserIdentity is a user's login at an OpenID provider.
+type UserIdentity struct {
+	UserIdentityUUID uuid.UUID
+	UserUUID         uuid.UUID
+	Provider         string //the provider's name in the config
+	Subject          string
+	EmailAddress     string //as the provider had it when we linked
+	CreatedAt        time.Time
+	LastLoginAt      *time.Time
+}
+
+// OIDCState is what we remember between sending a user to their provider and them coming back.
+type OIDCState struct {
+	OIDCStateUUID uuid.UUID
+	HashedState   string
+	Provider      string
+	Nonce         string
+	CodeVerifier  string
+	ExpiresAt     time.Time
+	CreatedAt     time.Time
+}
+
+type PasswordResetToken struct {
+	PasswordResetTokenUUID uuid.UUID
+	UserUUID               uuid.UUID
+	HashedToken            string
+	ExpiresAt              time.Time
+	UsedAt                 *time.Time
+	CreatedAt              time.Time
+}
+
+type EmailVerificationToken struct {
+	EmailVerificationTokenUUID uuid.UUID
+	UserUUID                   uuid.UUID
+	EmailAddress               string
+	HashedToken                string
+	ExpiresAt                  time.Time
+	UsedAt                     *time.Time
+	CreatedAt                  time.Time
+}
+
+type LockoutEvent struct {
+	LockoutEventUUID uuid.UUID
+	Scope            string //account or ip
+	Subject          string //the email or the ip
+	Failures         int
+	LockedUntil      time.Time
+	CreatedAt        time.Time
+}
+
+// DigestSettings is when and how a user gets the daily digest of what in their fridge is about to go off.
+type DigestSettings struct {
+	UserUUID   uuid.UUID
+	Enabled    bool
+	Minute     int        //minutes after midnight in Timezone
+	Timezone   string     //IANA name, Asia/Seoul
+	Channel    string     //one of the service's digest channels, email or webhook
+	WebhookURL string     //only for the webhook channel
+	WithinDays int        //what goes off within this many days is in it
+	LastSentOn *time.Time //the user's local date the last digest was for, midnight UTC. nil if there hasn't been one
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
@@ -0,0 +1,63 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+	"wdiet/lockout"
+)
+
+var _ lockout.Backend = (*lockoutBackend)(nil)
+
+type lockoutBackend struct {
+	db *sql.DB
+}
+
+// LockoutBackend keeps login attempts in wdiet.login_attempts, for when several instances have to share the counts.
+func (pg *PG) LockoutBackend() lockout.Backend {
+	return &lockoutBackend{db: pg.db}
+}
+
+func (b *lockoutBackend) Get(ctx context.Context, key string) (lockout.Attempts, error) {
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	var a lockout.Attempts
+
+	row := b.db.QueryRowContext(ctx, sqlGetLoginAttempts, key)
+	if err := row.Scan(&a.Failures, &a.LastFailure); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return lockout.Attempts{}, nil
+		}
+		return lockout.Attempts{}, fmt.Errorf("error getting login attempts: %w", err)
+	}
+
+	return a, nil
+}
+
+func (b *lockoutBackend) AddFailure(ctx context.Context, key string, now time.Time, window time.Duration) (lockout.Attempts, error) {
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	var a lockout.Attempts
+
+	row := b.db.QueryRowContext(ctx, sqlAddLoginFailure, key, now.UTC(), window.Seconds())
+	if err := row.Scan(&a.Failures, &a.LastFailure); err != nil {
+		return lockout.Attempts{}, fmt.Errorf("error adding login failure: %w", err)
+	}
+
+	return a, nil
+}
+
+func (b *lockoutBackend) Reset(ctx context.Context, key string) error {
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	if _, err := b.db.ExecContext(ctx, sqlResetLoginAttempts, key); err != nil {
+		return fmt.Errorf("error resetting login attempts: %w", err)
+	}
+
+	return nil
+}
@@ -9,8 +9,10 @@ import (
 	"time"
 
 	"wdiet/store"
+	"wdiet/units"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
 func (pg *PG) Ping() error { //implementing the Store interface, nice to separate the postgres definition with the methods that fulfill the interface.
@@ -19,23 +21,45 @@ func (pg *PG) Ping() error { //implementing the Store interface, nice to separat
 
 const defaultTimeout = 5 * time.Second
 
-func (pg *PG) GetUser(ctx context.Context, id uuid.UUID) (*store.User, error) {
-	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
-	defer cancel()
+type scanner interface { //*sql.Row and *sql.Rows
+	Scan(dest ...interface{}) error
+}
 
-	var user store.User
+// scanUser scans a row of the user columns, in the order every user query in sql.go selects them.
+// don't half fill a struct, if you're returning a *store.User, return every field. don't mess up the order on a Scan either.
+func scanUser(row scanner, user *store.User) error {
+	var emailVerifiedAt sql.NullTime
 
-	row := pg.db.QueryRowContext(ctx, sqlGetUser, id)
 	if err := row.Scan(
 		&user.UserUUID,
 		&user.HashedPassword,
 		&user.Active,
+		&user.Role,
 		&user.FirstName,
 		&user.LastName,
 		&user.EmailAddress,
+		&emailVerifiedAt,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 	); err != nil {
+		return err
+	}
+
+	if emailVerifiedAt.Valid {
+		user.EmailVerifiedAt = &emailVerifiedAt.Time
+	}
+
+	return nil
+}
+
+func (pg *PG) GetUser(ctx context.Context, id uuid.UUID) (*store.User, error) {
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	var user store.User
+
+	row := pg.db.QueryRowContext(ctx, sqlGetUser, id)
+	if err := scanUser(row, &user); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, store.ErrNotFound
 		}
@@ -52,16 +76,7 @@ func (pg *PG) GetUserByEmail(ctx context.Context, email string) (*store.User, er
 	var user store.User
 
 	row := pg.db.QueryRowContext(ctx, sqlGetUserByEmail, email)
-	if err := row.Scan(
-		&user.UserUUID,       //don't half fill a struct, if you're returning a *store.User, return every field. Make every field valid, instead of just filling two fields of it.
-		&user.HashedPassword, //don't mess up the order on a Scan, cause it's gonna follow the order from sql.go
-		&user.Active,
-		&user.FirstName,
-		&user.LastName,
-		&user.EmailAddress,
-		&user.CreatedAt,
-		&user.UpdatedAt,
-	); err != nil {
+	if err := scanUser(row, &user); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, store.ErrNotFound
 		}
@@ -90,16 +105,7 @@ func (pg *PG) CreateUser(ctx context.Context, u store.User) (*store.User, error)
 		u.EmailAddress,
 	)
 
-	if err = row.Scan( //여기선 위에서 생성된 row를 scan해서 user에 복붙?한다음 그 user의 주소를 return하는고지..
-		&user.UserUUID,
-		&user.HashedPassword,
-		&user.Active,
-		&user.FirstName,
-		&user.LastName,
-		&user.EmailAddress,
-		&user.CreatedAt,
-		&user.UpdatedAt,
-	); err != nil {
+	if err = scanUser(row, &user); err != nil {
 		tx.Rollback()
 		return nil, fmt.Errorf("error creating user: %w", err)
 	}
@@ -124,23 +130,13 @@ func (pg *PG) UpdateUser(ctx context.Context, u store.User) (*store.User, error)
 	var user store.User
 
 	row := tx.QueryRowContext(ctx, sqlUpdateUser,
-		u.Active,
 		u.FirstName,
 		u.LastName,
 		u.EmailAddress,
 		u.UserUUID,
 	)
 
-	if err = row.Scan( //여기선 위에서 생성된 row를 scan해서 user에 복붙?한다음 그 user의 주소를 return하는고지..
-		&user.UserUUID,
-		&user.HashedPassword,
-		&user.Active,
-		&user.FirstName,
-		&user.LastName,
-		&user.EmailAddress,
-		&user.CreatedAt,
-		&user.UpdatedAt,
-	); err != nil {
+	if err = scanUser(row, &user); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			tx.Rollback()
 			return nil, store.ErrNotFound
@@ -157,6 +153,281 @@ func (pg *PG) UpdateUser(ctx context.Context, u store.User) (*store.User, error)
 	return &user, nil
 }
 
+// SetUserActive (de)activates the user id. Deactivating also revokes all of the user's refresh tokens.
+func (pg *PG) SetUserActive(ctx context.Context, id uuid.UUID, active bool) (*store.User, error) {
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	tx, err := pg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error setting user active: %w", err)
+	}
+
+	var user store.User
+
+	row := tx.QueryRowContext(ctx, sqlSetUserActive, active, id)
+
+	if err = scanUser(row, &user); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			tx.Rollback()
+			return nil, store.ErrNotFound
+		}
+		tx.Rollback()
+		return nil, fmt.Errorf("error setting user active: %w", err)
+	}
+
+	if !active {
+		if _, err := tx.ExecContext(ctx, sqlRevokeUserRefreshTokens, id); err != nil {
+			tx.Rollback()
+			return nil, fmt.Errorf("error setting user active: %w", err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("error setting user active: %w", err)
+	}
+
+	return &user, nil
+}
+
+// RequestUserDeletion deactivates the user, revokes their refresh tokens and schedules the account to be deleted after
+// deleteAfter. Reactivating before then calls it off.
+func (pg *PG) RequestUserDeletion(ctx context.Context, id uuid.UUID, deleteAfter time.Time) error {
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	tx, err := pg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error requesting user deletion: %w", err)
+	}
+
+	res, err := tx.ExecContext(ctx, sqlRequestUserDeletion, id, deleteAfter)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("error requesting user deletion: %w", err)
+	}
+
+	if affected, _ := res.RowsAffected(); affected == 0 {
+		tx.Rollback()
+		return store.ErrNotFound
+	}
+
+	if _, err := tx.ExecContext(ctx, sqlRevokeUserRefreshTokens, id); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("error requesting user deletion: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("error requesting user deletion: %w", err)
+	}
+
+	return nil
+}
+
+func (pg *PG) ListUsersDueForDeletion(ctx context.Context, now time.Time) ([]uuid.UUID, error) {
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	rows, err := pg.db.QueryContext(ctx, sqlListUsersDueForDeletion, now)
+	if err != nil {
+		return nil, fmt.Errorf("error listing users due for deletion: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []uuid.UUID
+
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("error listing users due for deletion: %w", err)
+		}
+		ids = append(ids, id)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error listing users due for deletion: %w", err)
+	}
+
+	return ids, nil
+}
+
+// DeleteUser erases the user for good. Their rows in other tables go with them (ON DELETE CASCADE), what's only keyed
+// by their email, the login throttling, is deleted here. Households they were alone in are deleted, the ones they were
+// the only owner of go to the longest standing member.
+func (pg *PG) DeleteUser(ctx context.Context, id uuid.UUID) error {
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	tx, err := pg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error deleting user: %w", err)
+	}
+
+	if _, err = tx.ExecContext(ctx, sqlDeleteUserSoleHouseholds, id); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("error deleting user: %w", err)
+	}
+
+	if _, err = tx.ExecContext(ctx, sqlPromoteHouseholdHeirs, id); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("error deleting user: %w", err)
+	}
+
+	var email string
+
+	if err = tx.QueryRowContext(ctx, sqlDeleteUser, id).Scan(&email); err != nil {
+		tx.Rollback()
+		if errors.Is(err, sql.ErrNoRows) {
+			return store.ErrNotFound
+		}
+		return fmt.Errorf("error deleting user: %w", err)
+	}
+
+	if _, err = tx.ExecContext(ctx, sqlDeleteUserLoginAttempts, email); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("error deleting user: %w", err)
+	}
+
+	if _, err = tx.ExecContext(ctx, sqlDeleteUserLockoutEvents, email); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("error deleting user: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("error deleting user: %w", err)
+	}
+
+	return nil
+}
+
+func (pg *PG) GetUserStatus(ctx context.Context, id uuid.UUID) (*store.UserStatus, error) {
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	var status store.UserStatus
+
+	row := pg.db.QueryRowContext(ctx, sqlGetUserStatus, id)
+	if err := row.Scan(&status.Active, &status.EmailVerified, &status.Role); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, store.ErrNotFound
+		}
+		return nil, fmt.Errorf("error getting user status: %w", err)
+	}
+
+	return &status, nil
+}
+
+func (pg *PG) SetUserRole(ctx context.Context, id uuid.UUID, role string) (*store.User, error) {
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	var user store.User
+
+	row := pg.db.QueryRowContext(ctx, sqlSetUserRole, role, id)
+	if err := scanUser(row, &user); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, store.ErrNotFound
+		}
+		return nil, fmt.Errorf("error setting user role: %w", err)
+	}
+
+	return &user, nil
+}
+
+// ChangePassword sets the user's password hash and logs out their other sessions by revoking their refresh tokens.
+func (pg *PG) ChangePassword(ctx context.Context, id uuid.UUID, hashedPassword string) error {
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	tx, err := pg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error changing password: %w", err)
+	}
+
+	if err := changePassword(ctx, tx, id, hashedPassword); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("error changing password: %w", err)
+	}
+
+	return nil
+}
+
+func changePassword(ctx context.Context, tx *sql.Tx, id uuid.UUID, hashedPassword string) error {
+	res, err := tx.ExecContext(ctx, sqlChangePassword, hashedPassword, id)
+	if err != nil {
+		return fmt.Errorf("error changing password: %w", err)
+	}
+
+	if affected, _ := res.RowsAffected(); affected != 1 {
+		return store.ErrNotFound
+	}
+
+	if _, err := tx.ExecContext(ctx, sqlRevokeUserRefreshTokens, id); err != nil {
+		return fmt.Errorf("error changing password: %w", err)
+	}
+
+	return nil
+}
+
+// UpdatePasswordHash swaps the stored hash for a new hash of the same password. It only does so while the stored hash is
+// still oldHash, if the password was changed in the meantime it returns store.ErrNotFound and leaves it alone.
+func (pg *PG) UpdatePasswordHash(ctx context.Context, id uuid.UUID, oldHash, newHash string) error {
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	res, err := pg.db.ExecContext(ctx, sqlUpdatePasswordHash, newHash, id, oldHash)
+	if err != nil {
+		return fmt.Errorf("error updating password hash: %w", err)
+	}
+
+	if affected, _ := res.RowsAffected(); affected != 1 {
+		return store.ErrNotFound
+	}
+
+	return nil
+}
+
+// scanIngredient scans a row of the ingredient columns, in the order sql.go selects them.
+func scanIngredient(row scanner, i *store.Ingredient) error {
+	var freezerDays, pantryDays, openedDays sql.NullInt32
+	var density sql.NullFloat64
+
+	if err := row.Scan(
+		&i.IngredientUUID,
+		&i.IngredientName,
+		&i.Category,
+		&i.DaysUntilExp,
+		&freezerDays,
+		&pantryDays,
+		&openedDays,
+		&density,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	); err != nil {
+		return err
+	}
+
+	i.FreezerDays = int(freezerDays.Int32)
+	i.PantryDays = int(pantryDays.Int32)
+	i.OpenedDays = int(openedDays.Int32)
+	i.Density = density.Float64
+
+	return nil
+}
+
+// nullDays is a shelf life for a column where null is one we don't know.
+func nullDays(days int) sql.NullInt32 {
+	return sql.NullInt32{Int32: int32(days), Valid: days > 0}
+}
+
 func (pg *PG) GetIngredient(ctx context.Context, id uuid.UUID) (*store.Ingredient, error) {
 	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
 	defer cancel()
@@ -164,14 +435,7 @@ func (pg *PG) GetIngredient(ctx context.Context, id uuid.UUID) (*store.Ingredien
 	var ingredient store.Ingredient
 
 	row := pg.db.QueryRowContext(ctx, sqlGetIngredient, id)
-	if err := row.Scan(
-		&ingredient.IngredientUUID,
-		&ingredient.IngredientName,
-		&ingredient.Category,
-		&ingredient.DaysUntilExp,
-		&ingredient.CreatedAt,
-		&ingredient.UpdatedAt,
-	); err != nil {
+	if err := scanIngredient(row, &ingredient); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, store.ErrNotFound
 		}
@@ -213,14 +477,7 @@ func (pg *PG) SearchIngredients(ctx context.Context, i store.SearchIngredient) (
 
 	for rows.Next() {
 		var ingredient store.Ingredient
-		if err := rows.Scan(
-			&ingredient.IngredientUUID,
-			&ingredient.IngredientName,
-			&ingredient.Category,
-			&ingredient.DaysUntilExp,
-			&ingredient.CreatedAt,
-			&ingredient.UpdatedAt,
-		); err != nil {
+		if err := scanIngredient(rows, &ingredient); err != nil {
 			// if errors.Is(err, sql.ErrNoRows) {
 			// 	return nil, store.ErrNotFound
 			// }
@@ -252,16 +509,13 @@ func (pg *PG) CreateIngredient(ctx context.Context, i store.Ingredient) (*store.
 		&i.IngredientName,
 		&i.Category,
 		&i.DaysUntilExp,
+		nullDays(i.FreezerDays),
+		nullDays(i.PantryDays),
+		nullDays(i.OpenedDays),
+		sql.NullFloat64{Float64: i.Density, Valid: i.Density > 0},
 	)
 
-	if err = row.Scan(
-		&ingredient.IngredientUUID,
-		&ingredient.IngredientName,
-		&ingredient.Category,
-		&ingredient.DaysUntilExp,
-		&ingredient.CreatedAt,
-		&ingredient.UpdatedAt,
-	); err != nil {
+	if err = scanIngredient(row, &ingredient); err != nil {
 		tx.Rollback()
 		return nil, fmt.Errorf("error creating ingredient: %w", err)
 	}
@@ -289,17 +543,14 @@ func (pg *PG) UpdateIngredient(ctx context.Context, i store.Ingredient) (*store.
 		i.IngredientName,
 		i.Category,
 		i.DaysUntilExp,
+		nullDays(i.FreezerDays),
+		nullDays(i.PantryDays),
+		nullDays(i.OpenedDays),
+		sql.NullFloat64{Float64: i.Density, Valid: i.Density > 0},
 		i.IngredientUUID,
 	)
 
-	if err = row.Scan(
-		&ingredient.IngredientUUID,
-		&ingredient.IngredientName,
-		&ingredient.Category,
-		&ingredient.DaysUntilExp,
-		&ingredient.CreatedAt,
-		&ingredient.UpdatedAt,
-	); err != nil {
+	if err = scanIngredient(row, &ingredient); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			tx.Rollback()
 			return nil, store.ErrNotFound
@@ -345,13 +596,43 @@ func (pg *PG) DeleteIngredient(ctx context.Context, id uuid.UUID) error {
 	return nil
 }
 
-func (pg *PG) ListFridgeIngredients(ctx context.Context, id uuid.UUID) ([]store.FridgeIngredient, error) {
+// scanFridgeIngredient scans a row of the fridge ingredient columns, in the order sql.go selects them.
+func scanFridgeIngredient(row scanner, f *store.FridgeIngredient) error {
+	var userUUID uuid.NullUUID
+	var openedDate sql.NullTime
+
+	if err := row.Scan(
+		&f.FridgeItemUUID,
+		&f.HouseholdUUID,
+		&userUUID,
+		&f.IngredientUUID,
+		&f.Amount,
+		&f.Unit,
+		&f.PurchasedDate,
+		&f.ExpirationDate,
+		&f.Location,
+		&openedDate,
+		&f.CreatedAt,
+		&f.UpdatedAt,
+	); err != nil {
+		return err
+	}
+
+	f.UserUUID = userUUID.UUID //uuid.Nil if whoever put it there is gone
+	if openedDate.Valid {
+		f.OpenedDate = &openedDate.Time
+	}
+
+	return nil
+}
+
+func (pg *PG) ListFridgeIngredients(ctx context.Context, hid uuid.UUID) ([]store.FridgeIngredient, error) {
 	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
 	defer cancel()
 
 	var fridgeIngredients []store.FridgeIngredient
 
-	rows, err := pg.db.QueryContext(ctx, sqlListFridgeIngredients, id)
+	rows, err := pg.db.QueryContext(ctx, sqlListFridgeIngredients, hid)
 	if err != nil {
 		return nil, fmt.Errorf("error listing fridge ingredients: %w", err)
 	}
@@ -359,25 +640,17 @@ func (pg *PG) ListFridgeIngredients(ctx context.Context, id uuid.UUID) ([]store.
 
 	for rows.Next() {
 		var fridgeIngredient store.FridgeIngredient
-		if err := rows.Scan(
-			&fridgeIngredient.UserUUID,
-			&fridgeIngredient.IngredientUUID,
-			&fridgeIngredient.Amount,
-			&fridgeIngredient.Unit,
-			&fridgeIngredient.PurchasedDate,
-			&fridgeIngredient.ExpirationDate,
-			&fridgeIngredient.CreatedAt,
-			&fridgeIngredient.UpdatedAt,
-		); err != nil {
-			// if errors.Is(err, sql.ErrNoRows) {
-			// 	return nil, store.ErrNotFound
-			// }
+		if err := scanFridgeIngredient(rows, &fridgeIngredient); err != nil {
 			return nil, fmt.Errorf("error listing fridge ingredients: %w", err)
 		}
 		fridgeIngredients = append(fridgeIngredients, fridgeIngredient)
 	}
 
-	return fridgeIngredients, nil
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error listing fridge ingredients: %w", err)
+	}
+
+	return fridgeIngredients, nil
 }
 
 func (pg *PG) CreateFridgeIngredient(ctx context.Context, f store.FridgeIngredient) (*store.FridgeIngredient, error) {
@@ -392,25 +665,23 @@ func (pg *PG) CreateFridgeIngredient(ctx context.Context, f store.FridgeIngredie
 	var fridgeIngredient store.FridgeIngredient
 
 	row := tx.QueryRowContext(ctx, sqlCreateFridgeIngredient,
+		&f.HouseholdUUID,
 		&f.UserUUID,
 		&f.IngredientUUID,
 		&f.Amount,
 		&f.Unit,
 		&f.PurchasedDate,
 		&f.ExpirationDate,
+		&f.Location,
+		f.OpenedDate,
 	)
 
-	err = row.Scan(
-		&fridgeIngredient.UserUUID,
-		&fridgeIngredient.IngredientUUID,
-		&fridgeIngredient.Amount,
-		&fridgeIngredient.Unit,
-		&fridgeIngredient.PurchasedDate,
-		&fridgeIngredient.ExpirationDate,
-		&fridgeIngredient.CreatedAt,
-		&fridgeIngredient.UpdatedAt,
-	)
-	if err != nil {
+	if err = scanFridgeIngredient(row, &fridgeIngredient); err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("error creating fridge ingredient: %w", err)
+	}
+
+	if err = createFridgeEvent(ctx, tx, lotEvent(store.FridgeEventTypeAdd, fridgeIngredient, f.UserUUID)); err != nil {
 		tx.Rollback()
 		return nil, fmt.Errorf("error creating fridge ingredient: %w", err)
 	}
@@ -438,20 +709,15 @@ func (pg *PG) UpdateFridgeIngredient(ctx context.Context, f store.FridgeIngredie
 		&f.Amount,
 		&f.Unit,
 		&f.PurchasedDate,
-		&f.UserUUID,
+		&f.ExpirationDate,
+		&f.Location,
+		f.OpenedDate,
+		&f.HouseholdUUID,
+		&f.FridgeItemUUID,
 		&f.IngredientUUID,
 	)
 
-	if err = row.Scan( //여기에 나온 순서는 sql.go에서 RETURNING 뒤의 필드 순서.
-		&fridgeIngredient.UserUUID,
-		&fridgeIngredient.IngredientUUID,
-		&fridgeIngredient.Amount,
-		&fridgeIngredient.Unit,
-		&fridgeIngredient.PurchasedDate,
-		&f.ExpirationDate, //update fridge ingredient에서 f.purchased date로 산출된 expiration date를 여기에 넣어줘야함..
-		&fridgeIngredient.CreatedAt,
-		&fridgeIngredient.UpdatedAt,
-	); err != nil {
+	if err = scanFridgeIngredient(row, &fridgeIngredient); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			tx.Rollback()
 			return nil, store.ErrNotFound
@@ -460,6 +726,11 @@ func (pg *PG) UpdateFridgeIngredient(ctx context.Context, f store.FridgeIngredie
 		return nil, fmt.Errorf("error updating fridge ingredient: %w", err)
 	}
 
+	if err = createFridgeEvent(ctx, tx, lotEvent(store.FridgeEventTypeUpdate, fridgeIngredient, f.UserUUID)); err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("error updating fridge ingredient: %w", err)
+	}
+
 	if err = tx.Commit(); err != nil {
 		tx.Rollback()
 		return nil, fmt.Errorf("error updating fridge ingredient: %w", err)
@@ -468,7 +739,81 @@ func (pg *PG) UpdateFridgeIngredient(ctx context.Context, f store.FridgeIngredie
 	return &fridgeIngredient, nil
 }
 
-func (pg *PG) DeleteFridgeIngredient(ctx context.Context, uid uuid.UUID, fid uuid.UUID) error {
+func (pg *PG) GetFridgeIngredient(ctx context.Context, hid, fid uuid.UUID) (*store.FridgeIngredient, error) {
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	var fridgeIngredient store.FridgeIngredient
+
+	row := pg.db.QueryRowContext(ctx, sqlGetFridgeIngredient, hid, fid)
+	if err := scanFridgeIngredient(row, &fridgeIngredient); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, store.ErrNotFound
+		}
+		return nil, fmt.Errorf("error getting fridge ingredient: %w", err)
+	}
+
+	return &fridgeIngredient, nil
+}
+
+func (pg *PG) SetFridgeIngredientStorage(ctx context.Context, was, f store.FridgeIngredient, uid uuid.UUID, eventType string) (*store.FridgeIngredient, error) {
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	tx, err := pg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error setting fridge ingredient storage: %w", err)
+	}
+
+	var location string
+	var openedDate sql.NullTime
+	var expirationDate time.Time
+
+	if err = tx.QueryRowContext(ctx, sqlLockFridgeLotStorage, f.HouseholdUUID, f.FridgeItemUUID).Scan(&location, &openedDate, &expirationDate); err != nil {
+		tx.Rollback()
+		if errors.Is(err, sql.ErrNoRows) { //consumed or deleted since we looked at it
+			return nil, store.ErrNotFound
+		}
+		return nil, fmt.Errorf("error setting fridge ingredient storage: %w", err)
+	}
+
+	if location != was.Location || openedDate.Valid != (was.OpenedDate != nil) || (openedDate.Valid && !openedDate.Time.Equal(*was.OpenedDate)) || !expirationDate.Equal(was.ExpirationDate) {
+		tx.Rollback() //moved or opened in the meantime, what we worked out is from before that
+		return nil, store.ErrConflict
+	}
+
+	var fridgeIngredient store.FridgeIngredient
+
+	row := tx.QueryRowContext(ctx, sqlSetFridgeIngredientStorage,
+		f.Location,
+		f.OpenedDate,
+		f.ExpirationDate,
+		f.HouseholdUUID,
+		f.FridgeItemUUID,
+	)
+
+	if err = scanFridgeIngredient(row, &fridgeIngredient); err != nil {
+		tx.Rollback()
+		if errors.Is(err, sql.ErrNoRows) { //consumed or deleted since we looked at it
+			return nil, store.ErrNotFound
+		}
+		return nil, fmt.Errorf("error setting fridge ingredient storage: %w", err)
+	}
+
+	if err = createFridgeEvent(ctx, tx, lotEvent(eventType, fridgeIngredient, uid)); err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("error setting fridge ingredient storage: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("error setting fridge ingredient storage: %w", err)
+	}
+
+	return &fridgeIngredient, nil
+}
+
+func (pg *PG) DeleteFridgeIngredient(ctx context.Context, e store.FridgeEvent) error {
 	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
 	defer cancel() //to make sure that the cancel function runs, otherwise I have to say it before every return cause by error
 
@@ -477,15 +822,23 @@ func (pg *PG) DeleteFridgeIngredient(ctx context.Context, uid uuid.UUID, fid uui
 		return fmt.Errorf("error deleting fridge ingredient: %w", err)
 	}
 
-	res, err := tx.ExecContext(ctx, sqlDeleteFridgeIngredient, uid, fid)
-	if err != nil {
+	var lot store.FridgeIngredient
+
+	if err = scanFridgeIngredient(tx.QueryRowContext(ctx, sqlDeleteFridgeIngredient, e.HouseholdUUID, e.FridgeItemUUID), &lot); err != nil {
 		tx.Rollback()
+		if errors.Is(err, sql.ErrNoRows) { //somebody else took it out already, or it's another household's
+			return store.ErrNotFound
+		}
 		return fmt.Errorf("error deleting fridge ingredient: %w", err)
 	}
 
-	if affected, _ := res.RowsAffected(); affected != 1 {
+	event := lotEvent(store.FridgeEventTypeDelete, lot, e.UserUUID)
+	event.Reason = e.Reason
+	event.EstimatedCost = e.EstimatedCost
+
+	if err = createFridgeEvent(ctx, tx, event); err != nil {
 		tx.Rollback()
-		return fmt.Errorf("error deleting fridge ingredient, rows affected %d instead of 1", affected)
+		return fmt.Errorf("error deleting fridge ingredient: %w", err)
 	}
 
 	if err = tx.Commit(); err != nil {
@@ -496,463 +849,2645 @@ func (pg *PG) DeleteFridgeIngredient(ctx context.Context, uid uuid.UUID, fid uui
 	return nil
 }
 
-func (pg *PG) GetRecipe(ctx context.Context, id uuid.UUID) (*store.Recipe, error) {
+// ConsumeFridgeIngredient takes amount of the ingredient iid out of the household's fridge, from the lots that expire
+// first. Lots that get to zero are deleted. It's all or nothing, ErrNotEnough if the lots converted to unit don't add up
+// to amount.
+// It returns what's left of the ingredient.
+func (pg *PG) ConsumeFridgeIngredient(ctx context.Context, hid, iid, uid uuid.UUID, amount units.Amount, unit string) ([]store.FridgeIngredient, error) {
 	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
 	defer cancel()
 
-	var recipe store.Recipe
+	tx, err := pg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error consuming fridge ingredient: %w", err)
+	}
 
-	row := pg.db.QueryRowContext(ctx, sqlGetRecipe, id)
-	if err := row.Scan(
-		&recipe.RecipeUUID,
-		&recipe.UserUUID,
-		&recipe.RecipeName,
-		&recipe.Category,
-		&recipe.CreatedAt,
-		&recipe.UpdatedAt,
-	); err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return nil, store.ErrNotFound
+	if err = consumeFridgeLots(ctx, tx, hid, iid, uid, amount, unit); err != nil {
+		tx.Rollback()
+		if errors.Is(err, store.ErrNotEnough) {
+			return nil, err
 		}
-		return nil, fmt.Errorf("error getting recipe: %w", err)
+		return nil, fmt.Errorf("error consuming fridge ingredient: %w", err)
 	}
 
-	ingredients, err := pg.db.QueryContext(ctx, sqlListRecipeIngr, recipe.RecipeUUID)
+	left, err := listFridgeLots(ctx, tx, hid, iid)
 	if err != nil {
-		return nil, fmt.Errorf("error listing recipe ingredients: %w", err)
+		tx.Rollback()
+		return nil, fmt.Errorf("error consuming fridge ingredient: %w", err)
 	}
-	defer ingredients.Close()
 
-	for ingredients.Next() {
-		var recipeIngr store.RecipeIngredient
-		if err := ingredients.Scan(
-			&recipeIngr.RecipeUUID,
-			&recipeIngr.IngredientUUID,
-			&recipeIngr.Amount,
-			&recipeIngr.Unit,
-		); err != nil {
-			return nil, fmt.Errorf("error listing recipe ingredients: %w", err)
+	if err = tx.Commit(); err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("error consuming fridge ingredient: %w", err)
+	}
+
+	return left, nil
+}
+
+// consumeFridgeLots is ConsumeFridgeIngredient inside somebody's transaction. The lots stay locked until tx is done.
+func consumeFridgeLots(ctx context.Context, tx *sql.Tx, hid, iid, uid uuid.UUID, amount units.Amount, unit string) error {
+	var density sql.NullFloat64
+
+	if err := tx.QueryRowContext(ctx, sqlGetIngredientDensity, iid).Scan(&density); err != nil {
+		if errors.Is(err, sql.ErrNoRows) { //no such ingredient, so there's none of it in the fridge either
+			return store.ErrNotEnough
 		}
-		recipe.Ingredients = append(recipe.Ingredients, recipeIngr)
+		return err
 	}
 
-	instructions, err := pg.db.QueryContext(ctx, sqlListRecipeInst, recipe.RecipeUUID)
+	rows, err := tx.QueryContext(ctx, sqlLockFridgeLots, hid, iid)
 	if err != nil {
-		return nil, fmt.Errorf("error listing recipe instructions: %w", err)
+		return err
 	}
-	defer instructions.Close()
 
-	for instructions.Next() {
-		var recipeInst store.RecipeInstruction
-		if err := instructions.Scan(
-			&recipeInst.RecipeUUID,
-			&recipeInst.StepNum,
-			&recipeInst.Instruction,
-		); err != nil {
-			return nil, fmt.Errorf("error listing recipe instructions: %w", err)
+	var lots []store.FridgeIngredient
+
+	for rows.Next() {
+		var lot store.FridgeIngredient
+		if err := rows.Scan(&lot.FridgeItemUUID, &lot.Amount, &lot.Unit); err != nil {
+			rows.Close()
+			return err
 		}
-		recipe.Instructions = append(recipe.Instructions, recipeInst)
+		lots = append(lots, lot)
 	}
+	rows.Close()
 
-	return &recipe, nil
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	deductions, short := store.TakeFromLots(lots, amount, unit, density.Float64) //oldest expiry first
+	if short.Sign() > 0 {
+		return store.ErrNotEnough
+	}
+
+	for _, d := range deductions {
+		if err := takeFromFridgeLot(ctx, tx, uid, d); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
-func (pg *PG) ListRecipes(ctx context.Context, id uuid.UUID) ([]store.Recipe, error) {
-	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
-	defer cancel()
+// takeFromFridgeLot leaves what d says is left in its lot, or takes the lot out if that's nothing, and records it as
+// consumed by uid. The lot has to be locked already.
+func takeFromFridgeLot(ctx context.Context, tx *sql.Tx, uid uuid.UUID, d store.FridgeDeduction) error {
+	var lot store.FridgeIngredient
 
-	var recipes []store.Recipe
+	if d.LeftAmount.Sign() == 0 {
+		if err := scanFridgeIngredient(tx.QueryRowContext(ctx, sqlDeleteFridgeLot, d.FridgeItemUUID), &lot); err != nil {
+			return err
+		}
+		lot.Amount, lot.Unit = d.LeftAmount, d.LeftUnit //the event has the lot after, and after there's nothing
+	} else {
+		if err := scanFridgeIngredient(tx.QueryRowContext(ctx, sqlSetFridgeLot, d.FridgeItemUUID, d.LeftAmount, d.LeftUnit), &lot); err != nil {
+			return err
+		}
+	}
 
-	rows, err := pg.db.QueryContext(ctx, sqlListRecipes, id)
+	return createFridgeEvent(ctx, tx, lotEvent(store.FridgeEventTypeConsume, lot, uid))
+}
+
+// listFridgeLots lists the lots of the ingredient iid in the household's fridge, oldest expiry first.
+func listFridgeLots(ctx context.Context, tx *sql.Tx, hid, iid uuid.UUID) ([]store.FridgeIngredient, error) {
+	rows, err := tx.QueryContext(ctx, sqlListFridgeLots, hid, iid)
 	if err != nil {
-		return nil, fmt.Errorf("error listing recipes: %w", err)
+		return nil, err
 	}
 	defer rows.Close()
 
+	var lots []store.FridgeIngredient
+
 	for rows.Next() {
-		var recipe store.Recipe
-		if err := rows.Scan(
-			&recipe.RecipeUUID,
-			&recipe.UserUUID,
-			&recipe.RecipeName,
-			&recipe.Category,
-			&recipe.CreatedAt,
-			&recipe.UpdatedAt,
-		); err != nil {
-			return nil, fmt.Errorf("error listing recipes: %w", err)
+		var lot store.FridgeIngredient
+		if err := scanFridgeIngredient(rows, &lot); err != nil {
+			return nil, err
 		}
+		lots = append(lots, lot)
+	}
 
-		ingredients, err := pg.db.QueryContext(ctx, sqlListRecipeIngr, recipe.RecipeUUID)
-		if err != nil {
-			return nil, fmt.Errorf("error listing recipe ingredients: %w", err)
-		}
-		defer ingredients.Close()
+	return lots, rows.Err()
+}
 
-		for ingredients.Next() {
-			var recipeIngr store.RecipeIngredient
-			if err := ingredients.Scan(
-				&recipeIngr.RecipeUUID,
-				&recipeIngr.IngredientUUID,
-				&recipeIngr.Amount,
-				&recipeIngr.Unit,
-			); err != nil {
-				return nil, fmt.Errorf("error listing recipe ingredients: %w", err)
-			}
-			recipe.Ingredients = append(recipe.Ingredients, recipeIngr)
-		}
+// scanHouseholdMembership scans a row of the membership columns, in the order sql.go selects them.
+func scanHouseholdMembership(row scanner, m *store.HouseholdMembership) error {
+	return row.Scan(
+		&m.HouseholdUUID,
+		&m.HouseholdName,
+		&m.Role,
+		&m.Active,
+		&m.CreatedAt,
+	)
+}
 
-		instructions, err := pg.db.QueryContext(ctx, sqlListRecipeInst, recipe.RecipeUUID)
-		if err != nil {
-			return nil, fmt.Errorf("error listing recipe instructions: %w", err)
-		}
-		defer instructions.Close()
+// scanHouseholdMember scans a row of the member columns, in the order sql.go selects them.
+func scanHouseholdMember(row scanner, m *store.HouseholdMember) error {
+	return row.Scan(
+		&m.HouseholdUUID,
+		&m.UserUUID,
+		&m.Role,
+		&m.FirstName,
+		&m.LastName,
+		&m.EmailAddress,
+		&m.CreatedAt,
+	)
+}
 
-		for instructions.Next() {
-			var recipeInst store.RecipeInstruction
-			if err := instructions.Scan(
-				&recipeInst.RecipeUUID,
-				&recipeInst.StepNum,
-				&recipeInst.Instruction,
-			); err != nil {
-				return nil, fmt.Errorf("error listing recipe instructions: %w", err)
-			}
-			recipe.Instructions = append(recipe.Instructions, recipeInst)
-		}
+// CreateHousehold creates a household with owner as its owner, and makes it the owner's active household.
+func (pg *PG) CreateHousehold(ctx context.Context, h store.Household, owner uuid.UUID) (*store.Household, error) {
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
 
-		recipes = append(recipes, recipe)
+	tx, err := pg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating household: %w", err)
 	}
 
-	return recipes, nil
-}
+	var household store.Household
 
-func (pg *PG) SearchRecipes(ctx context.Context, r store.SearchRecipes) ([]store.Recipe, error) {
-	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
-	defer cancel()
+	if err = tx.QueryRowContext(ctx, sqlCreateHousehold, h.HouseholdName).Scan(
+		&household.HouseholdUUID,
+		&household.HouseholdName,
+		&household.CreatedAt,
+		&household.UpdatedAt,
+	); err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("error creating household: %w", err)
+	}
 
-	var wheres []string
-	var vars []interface{}
-	var count int
+	if _, err = tx.ExecContext(ctx, sqlCreateHouseholdMember, household.HouseholdUUID, owner, store.HouseholdRoleOwner); err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("error creating household: %w", err)
+	}
 
-	if r.UserUUID != nil {
-		count++
-		wheres = append(wheres, fmt.Sprintf(" user_uuid = $%d", count))
-		vars = append(vars, r.UserUUID)
+	if _, err = tx.ExecContext(ctx, sqlSetActiveHousehold, owner, household.HouseholdUUID); err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("error creating household: %w", err)
 	}
 
-	if r.RecipeName != nil {
-		count++
-		wheres = append(wheres, fmt.Sprintf(" recipe_name = $%d", count))
-		vars = append(vars, r.RecipeName)
+	if err = tx.Commit(); err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("error creating household: %w", err)
 	}
 
-	if r.Category != nil {
-		count++
-		wheres = append(wheres, fmt.Sprintf(" category = $%d", count))
-		vars = append(vars, r.Category)
+	return &household, nil
+}
+
+func (pg *PG) GetHousehold(ctx context.Context, id uuid.UUID) (*store.Household, error) {
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	var household store.Household
+
+	if err := pg.db.QueryRowContext(ctx, sqlGetHousehold, id).Scan(
+		&household.HouseholdUUID,
+		&household.HouseholdName,
+		&household.CreatedAt,
+		&household.UpdatedAt,
+	); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, store.ErrNotFound
+		}
+		return nil, fmt.Errorf("error getting household: %w", err)
 	}
 
-	whereClause := strings.Join(wheres, " AND ")
+	return &household, nil
+}
 
-	var recipes []store.Recipe
+// ListHouseholds lists the households uid is a member of, the one they joined first first.
+func (pg *PG) ListHouseholds(ctx context.Context, uid uuid.UUID) ([]store.HouseholdMembership, error) {
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
 
-	fmt.Println("sql statement is")
-	rows, err := pg.db.QueryContext(ctx, sqlsearchRecipes+" WHERE "+whereClause, vars...)
+	rows, err := pg.db.QueryContext(ctx, sqlListHouseholds, uid)
 	if err != nil {
-		return nil, fmt.Errorf("error searching recipes: %w", err)
+		return nil, fmt.Errorf("error listing households: %w", err)
 	}
+	defer rows.Close()
+
+	var memberships []store.HouseholdMembership
 
 	for rows.Next() {
-		var recipe store.Recipe
-		if err = rows.Scan( //여기서 하는 짓은, recipe table에서 찾은 row를 각각 recipe struct의 필드에 맞게 할당해주는 거임.
-			&recipe.RecipeUUID,
-			&recipe.UserUUID,
-			&recipe.RecipeName,
-			&recipe.Category,
-			&recipe.CreatedAt,
-			&recipe.UpdatedAt,
-		); err != nil {
-			return nil, fmt.Errorf("error searching recipes: %w", err)
+		var m store.HouseholdMembership
+		if err := scanHouseholdMembership(rows, &m); err != nil {
+			return nil, fmt.Errorf("error listing households: %w", err)
 		}
+		memberships = append(memberships, m)
+	}
 
-		ingredients, err := pg.db.QueryContext(ctx, sqlListRecipeIngr, recipe.RecipeUUID)
-		if err != nil {
-			return nil, fmt.Errorf("error listing recipe ingredients: %w", err)
-		}
-		defer ingredients.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error listing households: %w", err)
+	}
 
-		for ingredients.Next() {
-			var recipeIngr store.RecipeIngredient
-			if err := ingredients.Scan(
-				&recipeIngr.RecipeUUID,
-				&recipeIngr.IngredientUUID,
-				&recipeIngr.Amount,
-				&recipeIngr.Unit,
-			); err != nil {
-				return nil, fmt.Errorf("error listing recipe ingredients: %w", err)
-			}
-			recipe.Ingredients = append(recipe.Ingredients, recipeIngr) //여기서 하는 짓은, recipe_ingredients table에서 찾은 row를 각각 recipe struct의 필드에 맞게 할당해주는 거임. & 써야하나..
-		}
+	return memberships, nil
+}
 
-		instructions, err := pg.db.QueryContext(ctx, sqlListRecipeInst, recipe.RecipeUUID)
-		if err != nil {
-			return nil, fmt.Errorf("error listing recipe instructions: %w", err)
+// GetHouseholdMembership gets uid's membership in the household hid, ErrNotFound if they aren't a member.
+func (pg *PG) GetHouseholdMembership(ctx context.Context, hid, uid uuid.UUID) (*store.HouseholdMembership, error) {
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	var m store.HouseholdMembership
+
+	if err := scanHouseholdMembership(pg.db.QueryRowContext(ctx, sqlGetHouseholdMembership, hid, uid), &m); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, store.ErrNotFound
 		}
-		defer instructions.Close()
+		return nil, fmt.Errorf("error getting household membership: %w", err)
+	}
 
-		for instructions.Next() {
-			var recipeInst store.RecipeInstruction
-			if err := instructions.Scan(
-				&recipeInst.RecipeUUID,
-				&recipeInst.StepNum,
-				&recipeInst.Instruction,
-			); err != nil {
-				return nil, fmt.Errorf("error listing recipe instructions: %w", err)
-			}
-			recipe.Instructions = append(recipe.Instructions, recipeInst)
+	return &m, nil
+}
+
+// GetActiveHousehold gets uid's membership in their active household, ErrNotFound if they have none or aren't a member
+// anymore.
+func (pg *PG) GetActiveHousehold(ctx context.Context, uid uuid.UUID) (*store.HouseholdMembership, error) {
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	var m store.HouseholdMembership
+
+	if err := scanHouseholdMembership(pg.db.QueryRowContext(ctx, sqlGetActiveHousehold, uid), &m); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, store.ErrNotFound
 		}
-		recipes = append(recipes, recipe)
+		return nil, fmt.Errorf("error getting active household: %w", err)
 	}
 
-	return recipes, nil
+	return &m, nil
 }
 
-func (pg *PG) CreateRecipe(ctx context.Context, r store.Recipe) (*store.Recipe, error) {
+// EnsureActiveHousehold gets uid's active household and sets one if they have none, in one transaction with uid's row
+// locked, see store.Store.
+func (pg *PG) EnsureActiveHousehold(ctx context.Context, uid uuid.UUID, name string) (*store.HouseholdMembership, error) {
 	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
 	defer cancel()
 
 	tx, err := pg.db.BeginTx(ctx, nil)
 	if err != nil {
-		return nil, fmt.Errorf("error creating recipe: %w", err)
+		return nil, fmt.Errorf("error ensuring active household: %w", err)
 	}
 
-	var recipe store.Recipe
-
-	row := tx.QueryRowContext(ctx, sqlCreateRecipe,
-		&r.UserUUID,
-		&r.RecipeName,
-		&r.Category,
-	)
+	var locked uuid.UUID
 
-	if err = row.Scan(
-		&recipe.RecipeUUID,
-		&recipe.UserUUID,
-		&recipe.RecipeName,
-		&recipe.Category,
-		&recipe.CreatedAt,
-		&recipe.UpdatedAt,
-	); err != nil {
+	if err = tx.QueryRowContext(ctx, sqlLockUser, uid).Scan(&locked); err != nil {
 		tx.Rollback()
-		return nil, fmt.Errorf("error creating recipe: %w", err)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, store.ErrNotFound
+		}
+		return nil, fmt.Errorf("error ensuring active household: %w", err)
 	}
 
-	for _, recipeingr := range r.Ingredients {
-		var recipeIngr store.RecipeIngredient
-
-		row := tx.QueryRowContext(ctx, sqlCreateRecipeIngr,
-			&recipe.RecipeUUID, //여기 조오심..!! RecipeIngredient db model에 recipe uuid 필드가 있긴 하지만, api model에서 빈채로 요청이 오기 때문에(그리고 db에서 recipe uuid가 만들어지기 때문에) 실제로는 recipe의 recipe_uuid를 recipe_ingredients 테이블에 집어넣어야함.
-			&recipeingr.IngredientUUID,
-			&recipeingr.Amount,
-			&recipeingr.Unit,
-		)
+	var m store.HouseholdMembership
 
-		if err = row.Scan(
-			&recipeIngr.RecipeUUID,
-			&recipeIngr.IngredientUUID,
-			&recipeIngr.Amount,
-			&recipeIngr.Unit,
-		); err != nil {
-			tx.Rollback()
-			return nil, fmt.Errorf("error creating recipe ingredients: %w", err)
+	err = scanHouseholdMembership(tx.QueryRowContext(ctx, sqlGetActiveHousehold, uid), &m)
+	if err == nil { //the request we waited for set it
+		if err = tx.Commit(); err != nil {
+			return nil, fmt.Errorf("error ensuring active household: %w", err)
 		}
-		recipe.Ingredients = append(recipe.Ingredients, recipeIngr)
+		return &m, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		tx.Rollback()
+		return nil, fmt.Errorf("error ensuring active household: %w", err)
 	}
 
-	for _, recipeinst := range r.Instructions {
-		var recipeInst store.RecipeInstruction
-
-		row := tx.QueryRowContext(ctx, sqlCreateRecipeInst,
-			&recipe.RecipeUUID,
-			&recipeinst.StepNum,
-			&recipeinst.Instruction,
-		)
+	var household store.Household
 
-		if err = row.Scan(
-			&recipeInst.RecipeUUID,
-			&recipeInst.StepNum,
-			&recipeInst.Instruction,
+	err = tx.QueryRowContext(ctx, sqlGetFirstHousehold, uid).Scan(&household.HouseholdUUID)
+	if errors.Is(err, sql.ErrNoRows) { //in none, a household of their own
+		if err = tx.QueryRowContext(ctx, sqlCreateHousehold, name).Scan(
+			&household.HouseholdUUID,
+			&household.HouseholdName,
+			&household.CreatedAt,
+			&household.UpdatedAt,
 		); err != nil {
 			tx.Rollback()
-			return nil, fmt.Errorf("error creating recipe instructions: %w", err)
+			return nil, fmt.Errorf("error ensuring active household: %w", err)
 		}
-		recipe.Instructions = append(recipe.Instructions, recipeInst)
+		_, err = tx.ExecContext(ctx, sqlCreateHouseholdMember, household.HouseholdUUID, uid, store.HouseholdRoleOwner)
+	}
+	if err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("error ensuring active household: %w", err)
+	}
+
+	if _, err = tx.ExecContext(ctx, sqlSetActiveHousehold, uid, household.HouseholdUUID); err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("error ensuring active household: %w", err)
+	}
+
+	if err = scanHouseholdMembership(tx.QueryRowContext(ctx, sqlGetActiveHousehold, uid), &m); err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("error ensuring active household: %w", err)
 	}
 
 	if err = tx.Commit(); err != nil {
 		tx.Rollback()
-		return nil, fmt.Errorf("error creating recipe: %w", err)
+		return nil, fmt.Errorf("error ensuring active household: %w", err)
 	}
 
-	return &recipe, nil
+	return &m, nil
 }
 
-func (pg *PG) UpdateRecipe(ctx context.Context, r store.Recipe) (*store.Recipe, error) {
+// SetActiveHousehold makes hid uid's active household, ErrNotFound if they aren't a member of it.
+func (pg *PG) SetActiveHousehold(ctx context.Context, uid, hid uuid.UUID) error {
 	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
 	defer cancel()
 
-	tx, err := pg.db.BeginTx(ctx, nil)
+	res, err := pg.db.ExecContext(ctx, sqlSetActiveHousehold, uid, hid)
 	if err != nil {
-		return nil, fmt.Errorf("error updating recipe: %w", err)
+		return fmt.Errorf("error setting active household: %w", err)
 	}
 
-	var recipe store.Recipe
+	if affected, _ := res.RowsAffected(); affected == 0 {
+		return store.ErrNotFound
+	}
 
-	row := tx.QueryRowContext(ctx, sqlUpdateRecipe,
-		r.RecipeName,
-		r.Category,
-		r.RecipeUUID,
-	)
+	return nil
+}
 
-	if err = row.Scan(
-		&recipe.RecipeUUID,
-		&recipe.UserUUID,
-		&recipe.RecipeName,
-		&recipe.Category,
-		&recipe.CreatedAt,
-		&recipe.UpdatedAt,
-	); err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			tx.Rollback()
-			return nil, store.ErrNotFound
-		}
-		tx.Rollback()
-		return nil, fmt.Errorf("error updating recipe: %w", err)
-	}
+func (pg *PG) ListHouseholdMembers(ctx context.Context, hid uuid.UUID) ([]store.HouseholdMember, error) {
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
 
-	res, err := tx.ExecContext(ctx, sqlDeleteRecipeIngr,
-		r.RecipeUUID,
-	)
+	rows, err := pg.db.QueryContext(ctx, sqlListHouseholdMembers, hid)
 	if err != nil {
-		tx.Rollback()
-		return nil, fmt.Errorf("error deleting recipe ingredients: %w", err) //exec context는 return 값이 없을때 사용하는 거라던데, 이 update recipe는 *store.Recipe를 돌려줘야해서 nil 썼는데, 그럴거면 queryContext를 써야하나..
+		return nil, fmt.Errorf("error listing household members: %w", err)
 	}
+	defer rows.Close()
 
-	if _, affected := res.RowsAffected(); affected != nil {
-		tx.Rollback()
-		return nil, fmt.Errorf("error deleting recipe ingredients, rows affected is %d instead of 1", affected)
+	var members []store.HouseholdMember
+
+	for rows.Next() {
+		var m store.HouseholdMember
+		if err := scanHouseholdMember(rows, &m); err != nil {
+			return nil, fmt.Errorf("error listing household members: %w", err)
+		}
+		members = append(members, m)
 	}
 
-	for _, recipeingr := range r.Ingredients {
-		var recipeIngr store.RecipeIngredient
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error listing household members: %w", err)
+	}
 
-		row := tx.QueryRowContext(ctx, sqlCreateRecipeIngr,
-			&recipe.RecipeUUID,
-			&recipeingr.IngredientUUID,
-			&recipeingr.Amount,
-			&recipeingr.Unit,
-		)
+	return members, nil
+}
 
-		if err = row.Scan(
-			&recipeIngr.RecipeUUID,
-			&recipeIngr.IngredientUUID,
-			&recipeIngr.Amount,
-			&recipeIngr.Unit,
-		); err != nil {
-			tx.Rollback()
-			return nil, fmt.Errorf("error creating recipe ingredients: %w", err)
+// lockHouseholdMembers locks the household hid for the rest of tx and counts its members and owners, and gets uid's
+// role in it ("" if they aren't a member). ErrNotFound if there's no such household.
+func lockHouseholdMembers(ctx context.Context, tx *sql.Tx, hid, uid uuid.UUID) (members, owners int, role string, err error) {
+	var locked uuid.UUID
+
+	if err = tx.QueryRowContext(ctx, sqlLockHousehold, hid).Scan(&locked); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, 0, "", store.ErrNotFound
 		}
-		recipe.Ingredients = append(recipe.Ingredients, recipeIngr)
+		return 0, 0, "", err
 	}
 
-	res, err = tx.ExecContext(ctx, sqlDeleteRecipeInst,
-		r.RecipeUUID,
-	)
+	if err = tx.QueryRowContext(ctx, sqlCountHouseholdMembers, hid, uid).Scan(&members, &owners, &role); err != nil {
+		return 0, 0, "", err
+	}
+
+	return members, owners, role, nil
+}
+
+// SetHouseholdMemberRole changes uid's role in the household hid. ErrNotFound if they aren't a member, ErrConflict if
+// they're the last owner and role would leave the household without one.
+func (pg *PG) SetHouseholdMemberRole(ctx context.Context, hid, uid uuid.UUID, role string) (*store.HouseholdMember, error) {
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	tx, err := pg.db.BeginTx(ctx, nil)
 	if err != nil {
-		tx.Rollback()
-		return nil, fmt.Errorf("error deleting recipe instructions: %w", err)
+		return nil, fmt.Errorf("error setting household member role: %w", err)
 	}
 
-	if _, affected := res.RowsAffected(); affected != nil {
+	_, owners, current, err := lockHouseholdMembers(ctx, tx, hid, uid)
+	if err != nil {
 		tx.Rollback()
-		return nil, fmt.Errorf("error deleting recipe instructions, rows affected is %d instead of 1", affected)
+		if errors.Is(err, store.ErrNotFound) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("error setting household member role: %w", err)
 	}
 
-	for _, recipeinst := range r.Instructions {
-		var recipeInst store.RecipeInstruction
+	switch {
+	case current == "":
+		tx.Rollback()
+		return nil, store.ErrNotFound
+	case current == store.HouseholdRoleOwner && role != store.HouseholdRoleOwner && owners == 1:
+		tx.Rollback()
+		return nil, store.ErrConflict
+	}
 
-		row := tx.QueryRowContext(ctx, sqlCreateRecipeInst,
-			&recipe.RecipeUUID,
-			&recipeinst.StepNum,
-			&recipeinst.Instruction,
-		)
+	var member store.HouseholdMember
 
-		if err = row.Scan(
-			&recipeInst.RecipeUUID,
-			&recipeInst.StepNum,
-			&recipeInst.Instruction,
-		); err != nil {
-			tx.Rollback()
-			return nil, fmt.Errorf("error creating recipe instructions: %w", err)
-		}
-		recipe.Instructions = append(recipe.Instructions, recipeInst)
+	if err = scanHouseholdMember(tx.QueryRowContext(ctx, sqlSetHouseholdMemberRole, hid, uid, role), &member); err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("error setting household member role: %w", err)
 	}
 
 	if err = tx.Commit(); err != nil {
 		tx.Rollback()
-		return nil, fmt.Errorf("error updating recipe: %w", err)
+		return nil, fmt.Errorf("error setting household member role: %w", err)
 	}
 
-	return &recipe, nil
+	return &member, nil
 }
 
-func (pg *PG) DeleteRecipe(ctx context.Context, id uuid.UUID) error {
+// RemoveHouseholdMember takes uid out of the household hid. The last one out deletes the household and its fridge.
+// ErrNotFound if they aren't a member, ErrConflict if they're the last owner and others are still in.
+func (pg *PG) RemoveHouseholdMember(ctx context.Context, hid, uid uuid.UUID) error {
 	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
 	defer cancel()
 
 	tx, err := pg.db.BeginTx(ctx, nil)
 	if err != nil {
-		return fmt.Errorf("error deleting recipe: %w", err)
+		return fmt.Errorf("error removing household member: %w", err)
 	}
 
-	//deleting everything from recipe_ingredients table
-	res, err := tx.ExecContext(ctx, sqlDeleteRecipeIngr, id)
+	members, owners, role, err := lockHouseholdMembers(ctx, tx, hid, uid)
 	if err != nil {
 		tx.Rollback()
-		return fmt.Errorf("error deleting recipe ingredients: %w", err)
+		if errors.Is(err, store.ErrNotFound) {
+			return err
+		}
+		return fmt.Errorf("error removing household member: %w", err)
 	}
 
-	if _, affected := res.RowsAffected(); affected != nil {
+	switch {
+	case role == "":
 		tx.Rollback()
-		return fmt.Errorf("error deleting recipe ingredients, rows affected is %d instead of 1", affected)
+		return store.ErrNotFound
+	case members == 1:
+		_, err = tx.ExecContext(ctx, sqlDeleteHousehold, hid)
+	case role == store.HouseholdRoleOwner && owners == 1:
+		tx.Rollback()
+		return store.ErrConflict
+	default:
+		if _, err = tx.ExecContext(ctx, sqlDeleteHouseholdMember, hid, uid); err == nil {
+			_, err = tx.ExecContext(ctx, sqlClearActiveHousehold, uid, hid)
+		}
 	}
-
-	//deleting everything from recipe_instructions table
-	res, err = tx.ExecContext(ctx, sqlDeleteRecipeInst, id)
 	if err != nil {
 		tx.Rollback()
-		return fmt.Errorf("error deleting recipe instructions: %w", err)
+		return fmt.Errorf("error removing household member: %w", err)
 	}
 
-	if _, affected := res.RowsAffected(); affected != nil {
+	if err = tx.Commit(); err != nil {
 		tx.Rollback()
-		return fmt.Errorf("error deleting recipe instructions, rows affected is %d instead of 1", affected)
+		return fmt.Errorf("error removing household member: %w", err)
 	}
 
-	//deleting everything from recipes table
-	res, err = tx.ExecContext(ctx, sqlDeleteRecipe, id)
-	if err != nil {
-		tx.Rollback()
-		return fmt.Errorf("error deleting recipe: %w", err)
-	}
+	return nil
+}
 
-	if _, affected := res.RowsAffected(); affected != nil {
-		tx.Rollback()
-		return fmt.Errorf("error deleting recipe, rows affected is %d instead of 1", affected)
+func (pg *PG) CreateHouseholdInvitation(ctx context.Context, i store.HouseholdInvitation) (*store.HouseholdInvitation, error) {
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	var invitation store.HouseholdInvitation
+	var invitedBy uuid.NullUUID
+	var acceptedAt sql.NullTime
+
+	if err := pg.db.QueryRowContext(ctx, sqlCreateHouseholdInvitation,
+		i.HouseholdUUID,
+		i.EmailAddress,
+		i.Role,
+		i.HashedToken,
+		uuid.NullUUID{UUID: i.InvitedBy, Valid: i.InvitedBy != uuid.Nil},
+		i.ExpiresAt,
+	).Scan(
+		&invitation.HouseholdInvitationUUID,
+		&invitation.HouseholdUUID,
+		&invitation.EmailAddress,
+		&invitation.Role,
+		&invitation.HashedToken,
+		&invitedBy,
+		&invitation.ExpiresAt,
+		&acceptedAt,
+		&invitation.CreatedAt,
+	); err != nil {
+		return nil, fmt.Errorf("error creating household invitation: %w", err)
 	}
 
-	if err = tx.Commit(); err != nil {
-		tx.Rollback()
-		return fmt.Errorf("error deleting recipe: %w", err)
+	invitation.InvitedBy = invitedBy.UUID
+	if acceptedAt.Valid {
+		invitation.AcceptedAt = &acceptedAt.Time
 	}
 
-	return nil
+	return &invitation, nil
+}
+
+// AcceptHouseholdInvitation uses the invitation and adds uid to its household with the role it was made for, and makes
+// it their active household. ErrNotFound if the invitation is unknown, used, expired or for another email than email,
+// ErrConflict if uid is a member already (the invitation stays unused then).
+func (pg *PG) AcceptHouseholdInvitation(ctx context.Context, hashedToken string, uid uuid.UUID, email string) (*store.HouseholdMembership, error) {
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	tx, err := pg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error accepting household invitation: %w", err)
+	}
+
+	var hid uuid.UUID
+	var role string
+
+	if err = tx.QueryRowContext(ctx, sqlUseHouseholdInvitation, hashedToken, email).Scan(&hid, &role); err != nil {
+		tx.Rollback()
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, store.ErrNotFound
+		}
+		return nil, fmt.Errorf("error accepting household invitation: %w", err)
+	}
+
+	var member store.HouseholdMember
+
+	if err = tx.QueryRowContext(ctx, sqlCreateHouseholdMember, hid, uid, role).Scan(
+		&member.HouseholdUUID,
+		&member.UserUUID,
+		&member.Role,
+		&member.CreatedAt,
+	); err != nil {
+		tx.Rollback()
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, store.ErrConflict
+		}
+		return nil, fmt.Errorf("error accepting household invitation: %w", err)
+	}
+
+	if _, err = tx.ExecContext(ctx, sqlSetActiveHousehold, uid, hid); err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("error accepting household invitation: %w", err)
+	}
+
+	var membership store.HouseholdMembership
+
+	if err = scanHouseholdMembership(tx.QueryRowContext(ctx, sqlGetHouseholdMembership, hid, uid), &membership); err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("error accepting household invitation: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("error accepting household invitation: %w", err)
+	}
+
+	return &membership, nil
+}
+
+func (pg *PG) GetRecipe(ctx context.Context, id uuid.UUID) (*store.Recipe, error) {
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	var recipe store.Recipe
+
+	row := pg.db.QueryRowContext(ctx, sqlGetRecipe, id)
+	if err := row.Scan(
+		&recipe.RecipeUUID,
+		&recipe.UserUUID,
+		&recipe.RecipeName,
+		&recipe.Category,
+		&recipe.CreatedAt,
+		&recipe.UpdatedAt,
+	); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, store.ErrNotFound
+		}
+		return nil, fmt.Errorf("error getting recipe: %w", err)
+	}
+
+	ingredients, err := pg.db.QueryContext(ctx, sqlListRecipeIngr, recipe.RecipeUUID)
+	if err != nil {
+		return nil, fmt.Errorf("error listing recipe ingredients: %w", err)
+	}
+	defer ingredients.Close()
+
+	for ingredients.Next() {
+		var recipeIngr store.RecipeIngredient
+		if err := ingredients.Scan(
+			&recipeIngr.RecipeUUID,
+			&recipeIngr.IngredientUUID,
+			&recipeIngr.Amount,
+			&recipeIngr.Unit,
+		); err != nil {
+			return nil, fmt.Errorf("error listing recipe ingredients: %w", err)
+		}
+		recipe.Ingredients = append(recipe.Ingredients, recipeIngr)
+	}
+
+	instructions, err := pg.db.QueryContext(ctx, sqlListRecipeInst, recipe.RecipeUUID)
+	if err != nil {
+		return nil, fmt.Errorf("error listing recipe instructions: %w", err)
+	}
+	defer instructions.Close()
+
+	for instructions.Next() {
+		var recipeInst store.RecipeInstruction
+		if err := instructions.Scan(
+			&recipeInst.RecipeUUID,
+			&recipeInst.StepNum,
+			&recipeInst.Instruction,
+		); err != nil {
+			return nil, fmt.Errorf("error listing recipe instructions: %w", err)
+		}
+		recipe.Instructions = append(recipe.Instructions, recipeInst)
+	}
+
+	return &recipe, nil
+}
+
+func (pg *PG) ListRecipes(ctx context.Context, id uuid.UUID) ([]store.Recipe, error) {
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	var recipes []store.Recipe
+
+	rows, err := pg.db.QueryContext(ctx, sqlListRecipes, id)
+	if err != nil {
+		return nil, fmt.Errorf("error listing recipes: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var recipe store.Recipe
+		if err := rows.Scan(
+			&recipe.RecipeUUID,
+			&recipe.UserUUID,
+			&recipe.RecipeName,
+			&recipe.Category,
+			&recipe.CreatedAt,
+			&recipe.UpdatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("error listing recipes: %w", err)
+		}
+
+		ingredients, err := pg.db.QueryContext(ctx, sqlListRecipeIngr, recipe.RecipeUUID)
+		if err != nil {
+			return nil, fmt.Errorf("error listing recipe ingredients: %w", err)
+		}
+		defer ingredients.Close()
+
+		for ingredients.Next() {
+			var recipeIngr store.RecipeIngredient
+			if err := ingredients.Scan(
+				&recipeIngr.RecipeUUID,
+				&recipeIngr.IngredientUUID,
+				&recipeIngr.Amount,
+				&recipeIngr.Unit,
+			); err != nil {
+				return nil, fmt.Errorf("error listing recipe ingredients: %w", err)
+			}
+			recipe.Ingredients = append(recipe.Ingredients, recipeIngr)
+		}
+
+		instructions, err := pg.db.QueryContext(ctx, sqlListRecipeInst, recipe.RecipeUUID)
+		if err != nil {
+			return nil, fmt.Errorf("error listing recipe instructions: %w", err)
+		}
+		defer instructions.Close()
+
+		for instructions.Next() {
+			var recipeInst store.RecipeInstruction
+			if err := instructions.Scan(
+				&recipeInst.RecipeUUID,
+				&recipeInst.StepNum,
+				&recipeInst.Instruction,
+			); err != nil {
+				return nil, fmt.Errorf("error listing recipe instructions: %w", err)
+			}
+			recipe.Instructions = append(recipe.Instructions, recipeInst)
+		}
+
+		recipes = append(recipes, recipe)
+	}
+
+	return recipes, nil
+}
+
+func (pg *PG) SearchRecipes(ctx context.Context, r store.SearchRecipes) ([]store.Recipe, error) {
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	wheres := []string{" user_uuid IN (SELECT user_uuid FROM wdiet.users WHERE active)"} //deactivated accounts' recipes don't show up in search
+	var vars []interface{}
+	var count int
+
+	if r.UserUUID != nil {
+		count++
+		wheres = append(wheres, fmt.Sprintf(" user_uuid = $%d", count))
+		vars = append(vars, r.UserUUID)
+	}
+
+	if r.RecipeName != nil {
+		count++
+		wheres = append(wheres, fmt.Sprintf(" recipe_name = $%d", count))
+		vars = append(vars, r.RecipeName)
+	}
+
+	if r.Category != nil {
+		count++
+		wheres = append(wheres, fmt.Sprintf(" category = $%d", count))
+		vars = append(vars, r.Category)
+	}
+
+	whereClause := strings.Join(wheres, " AND ")
+
+	var recipes []store.Recipe
+
+	fmt.Println("sql statement is")
+	rows, err := pg.db.QueryContext(ctx, sqlsearchRecipes+" WHERE "+whereClause, vars...)
+	if err != nil {
+		return nil, fmt.Errorf("error searching recipes: %w", err)
+	}
+
+	for rows.Next() {
+		var recipe store.Recipe
+		if err = rows.Scan( //여기서 하는 짓은, recipe table에서 찾은 row를 각각 recipe struct의 필드에 맞게 할당해주는 거임.
+			&recipe.RecipeUUID,
+			&recipe.UserUUID,
+			&recipe.RecipeName,
+			&recipe.Category,
+			&recipe.CreatedAt,
+			&recipe.UpdatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("error searching recipes: %w", err)
+		}
+
+		ingredients, err := pg.db.QueryContext(ctx, sqlListRecipeIngr, recipe.RecipeUUID)
+		if err != nil {
+			return nil, fmt.Errorf("error listing recipe ingredients: %w", err)
+		}
+		defer ingredients.Close()
+
+		for ingredients.Next() {
+			var recipeIngr store.RecipeIngredient
+			if err := ingredients.Scan(
+				&recipeIngr.RecipeUUID,
+				&recipeIngr.IngredientUUID,
+				&recipeIngr.Amount,
+				&recipeIngr.Unit,
+			); err != nil {
+				return nil, fmt.Errorf("error listing recipe ingredients: %w", err)
+			}
+			recipe.Ingredients = append(recipe.Ingredients, recipeIngr) //여기서 하는 짓은, recipe_ingredients table에서 찾은 row를 각각 recipe struct의 필드에 맞게 할당해주는 거임. & 써야하나..
+		}
+
+		instructions, err := pg.db.QueryContext(ctx, sqlListRecipeInst, recipe.RecipeUUID)
+		if err != nil {
+			return nil, fmt.Errorf("error listing recipe instructions: %w", err)
+		}
+		defer instructions.Close()
+
+		for instructions.Next() {
+			var recipeInst store.RecipeInstruction
+			if err := instructions.Scan(
+				&recipeInst.RecipeUUID,
+				&recipeInst.StepNum,
+				&recipeInst.Instruction,
+			); err != nil {
+				return nil, fmt.Errorf("error listing recipe instructions: %w", err)
+			}
+			recipe.Instructions = append(recipe.Instructions, recipeInst)
+		}
+		recipes = append(recipes, recipe)
+	}
+
+	return recipes, nil
+}
+
+func (pg *PG) CreateRecipe(ctx context.Context, r store.Recipe) (*store.Recipe, error) {
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	tx, err := pg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating recipe: %w", err)
+	}
+
+	var recipe store.Recipe
+
+	row := tx.QueryRowContext(ctx, sqlCreateRecipe,
+		&r.UserUUID,
+		&r.RecipeName,
+		&r.Category,
+	)
+
+	if err = row.Scan(
+		&recipe.RecipeUUID,
+		&recipe.UserUUID,
+		&recipe.RecipeName,
+		&recipe.Category,
+		&recipe.CreatedAt,
+		&recipe.UpdatedAt,
+	); err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("error creating recipe: %w", err)
+	}
+
+	for _, recipeingr := range r.Ingredients {
+		var recipeIngr store.RecipeIngredient
+
+		row := tx.QueryRowContext(ctx, sqlCreateRecipeIngr,
+			&recipe.RecipeUUID, //여기 조오심..!! RecipeIngredient db model에 recipe uuid 필드가 있긴 하지만, api model에서 빈채로 요청이 오기 때문에(그리고 db에서 recipe uuid가 만들어지기 때문에) 실제로는 recipe의 recipe_uuid를 recipe_ingredients 테이블에 집어넣어야함.
+			&recipeingr.IngredientUUID,
+			&recipeingr.Amount,
+			&recipeingr.Unit,
+		)
+
+		if err = row.Scan(
+			&recipeIngr.RecipeUUID,
+			&recipeIngr.IngredientUUID,
+			&recipeIngr.Amount,
+			&recipeIngr.Unit,
+		); err != nil {
+			tx.Rollback()
+			return nil, fmt.Errorf("error creating recipe ingredients: %w", err)
+		}
+		recipe.Ingredients = append(recipe.Ingredients, recipeIngr)
+	}
+
+	for _, recipeinst := range r.Instructions {
+		var recipeInst store.RecipeInstruction
+
+		row := tx.QueryRowContext(ctx, sqlCreateRecipeInst,
+			&recipe.RecipeUUID,
+			&recipeinst.StepNum,
+			&recipeinst.Instruction,
+		)
+
+		if err = row.Scan(
+			&recipeInst.RecipeUUID,
+			&recipeInst.StepNum,
+			&recipeInst.Instruction,
+		); err != nil {
+			tx.Rollback()
+			return nil, fmt.Errorf("error creating recipe instructions: %w", err)
+		}
+		recipe.Instructions = append(recipe.Instructions, recipeInst)
+	}
+
+	if err = tx.Commit(); err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("error creating recipe: %w", err)
+	}
+
+	return &recipe, nil
+}
+
+func (pg *PG) UpdateRecipe(ctx context.Context, r store.Recipe) (*store.Recipe, error) {
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	tx, err := pg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error updating recipe: %w", err)
+	}
+
+	var recipe store.Recipe
+
+	row := tx.QueryRowContext(ctx, sqlUpdateRecipe,
+		r.RecipeName,
+		r.Category,
+		r.RecipeUUID,
+	)
+
+	if err = row.Scan(
+		&recipe.RecipeUUID,
+		&recipe.UserUUID,
+		&recipe.RecipeName,
+		&recipe.Category,
+		&recipe.CreatedAt,
+		&recipe.UpdatedAt,
+	); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			tx.Rollback()
+			return nil, store.ErrNotFound
+		}
+		tx.Rollback()
+		return nil, fmt.Errorf("error updating recipe: %w", err)
+	}
+
+	res, err := tx.ExecContext(ctx, sqlDeleteRecipeIngr,
+		r.RecipeUUID,
+	)
+	if err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("error deleting recipe ingredients: %w", err) //exec context는 return 값이 없을때 사용하는 거라던데, 이 update recipe는 *store.Recipe를 돌려줘야해서 nil 썼는데, 그럴거면 queryContext를 써야하나..
+	}
+
+	if _, affected := res.RowsAffected(); affected != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("error deleting recipe ingredients, rows affected is %d instead of 1", affected)
+	}
+
+	for _, recipeingr := range r.Ingredients {
+		var recipeIngr store.RecipeIngredient
+
+		row := tx.QueryRowContext(ctx, sqlCreateRecipeIngr,
+			&recipe.RecipeUUID,
+			&recipeingr.IngredientUUID,
+			&recipeingr.Amount,
+			&recipeingr.Unit,
+		)
+
+		if err = row.Scan(
+			&recipeIngr.RecipeUUID,
+			&recipeIngr.IngredientUUID,
+			&recipeIngr.Amount,
+			&recipeIngr.Unit,
+		); err != nil {
+			tx.Rollback()
+			return nil, fmt.Errorf("error creating recipe ingredients: %w", err)
+		}
+		recipe.Ingredients = append(recipe.Ingredients, recipeIngr)
+	}
+
+	res, err = tx.ExecContext(ctx, sqlDeleteRecipeInst,
+		r.RecipeUUID,
+	)
+	if err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("error deleting recipe instructions: %w", err)
+	}
+
+	if _, affected := res.RowsAffected(); affected != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("error deleting recipe instructions, rows affected is %d instead of 1", affected)
+	}
+
+	for _, recipeinst := range r.Instructions {
+		var recipeInst store.RecipeInstruction
+
+		row := tx.QueryRowContext(ctx, sqlCreateRecipeInst,
+			&recipe.RecipeUUID,
+			&recipeinst.StepNum,
+			&recipeinst.Instruction,
+		)
+
+		if err = row.Scan(
+			&recipeInst.RecipeUUID,
+			&recipeInst.StepNum,
+			&recipeInst.Instruction,
+		); err != nil {
+			tx.Rollback()
+			return nil, fmt.Errorf("error creating recipe instructions: %w", err)
+		}
+		recipe.Instructions = append(recipe.Instructions, recipeInst)
+	}
+
+	if err = tx.Commit(); err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("error updating recipe: %w", err)
+	}
+
+	return &recipe, nil
+}
+
+func (pg *PG) DeleteRecipe(ctx context.Context, id uuid.UUID) error {
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	tx, err := pg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error deleting recipe: %w", err)
+	}
+
+	//deleting everything from recipe_ingredients table
+	res, err := tx.ExecContext(ctx, sqlDeleteRecipeIngr, id)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("error deleting recipe ingredients: %w", err)
+	}
+
+	if _, affected := res.RowsAffected(); affected != nil {
+		tx.Rollback()
+		return fmt.Errorf("error deleting recipe ingredients, rows affected is %d instead of 1", affected)
+	}
+
+	//deleting everything from recipe_instructions table
+	res, err = tx.ExecContext(ctx, sqlDeleteRecipeInst, id)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("error deleting recipe instructions: %w", err)
+	}
+
+	if _, affected := res.RowsAffected(); affected != nil {
+		tx.Rollback()
+		return fmt.Errorf("error deleting recipe instructions, rows affected is %d instead of 1", affected)
+	}
+
+	//deleting everything from recipes table
+	res, err = tx.ExecContext(ctx, sqlDeleteRecipe, id)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("error deleting recipe: %w", err)
+	}
+
+	if _, affected := res.RowsAffected(); affected != nil {
+		tx.Rollback()
+		return fmt.Errorf("error deleting recipe, rows affected is %d instead of 1", affected)
+	}
+
+	if err = tx.Commit(); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("error deleting recipe: %w", err)
+	}
+
+	return nil
+}
+
+func (pg *PG) SuggestRecipes(ctx context.Context, hid uuid.UUID, q store.SuggestionQuery) ([]store.RecipeSuggestion, error) {
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	var suggestions []store.RecipeSuggestion
+
+	symbols, kinds, factors := unitFactors()
+
+	rows, err := pg.db.QueryContext(ctx, sqlSuggestRecipes,
+		hid,
+		pq.Array(symbols),
+		pq.Array(kinds),
+		pq.Array(factors),
+		q.Now.UTC(), //expiration_date is a timestamp in UTC
+		q.WithinDays,
+		q.CoverageWeight,
+		q.ExpiryWeight,
+		q.Limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error suggesting recipes: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() { //row 하나가 recipe ingredient 하나 + fridge에 있는 단위, 유통기한 하나. 같은 recipe, 같은 재료의 row들은 sql에서 붙어서 나오니까 바뀔 때마다 새로 시작함.
+		var suggestion store.RecipeSuggestion
+		var ingredient store.SuggestionIngredient
+		var density sql.NullFloat64
+		var unit sql.NullString
+		var amount units.Amount
+		var expirationDate sql.NullTime
+
+		if err := rows.Scan(
+			&suggestion.RecipeUUID,
+			&suggestion.UserUUID,
+			&suggestion.RecipeName,
+			&suggestion.Category,
+			&suggestion.Coverage,
+			&suggestion.Score,
+			&ingredient.IngredientUUID,
+			&ingredient.IngredientName,
+			&density,
+			&ingredient.Amount,
+			&ingredient.Unit,
+			&unit,
+			&amount,
+			&expirationDate,
+		); err != nil {
+			return nil, fmt.Errorf("error suggesting recipes: %w", err)
+		}
+
+		ingredient.Density = density.Float64
+
+		if len(suggestions) == 0 || suggestions[len(suggestions)-1].RecipeUUID != suggestion.RecipeUUID {
+			suggestions = append(suggestions, suggestion)
+		}
+
+		last := &suggestions[len(suggestions)-1]
+		if len(last.Ingredients) == 0 || last.Ingredients[len(last.Ingredients)-1].IngredientUUID != ingredient.IngredientUUID {
+			last.Ingredients = append(last.Ingredients, ingredient)
+		}
+
+		if !unit.Valid { //the fridge doesn't have it
+			continue
+		}
+
+		ingr := &last.Ingredients[len(last.Ingredients)-1]
+		ingr.Available = append(ingr.Available, store.FridgeAmount{Amount: amount, Unit: unit.String, ExpirationDate: expirationDate.Time})
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error suggesting recipes: %w", err)
+	}
+
+	return suggestions, nil
+}
+
+// unitFactors is the units registry as arrays for unnest, so the db converts amounts the same way the units package
+// does. Every factor is a terminating decimal, 12 places keep them exact.
+func unitFactors() (symbols, kinds, factors []string) {
+	for _, symbol := range units.Symbols() {
+		u, _ := units.Parse(symbol) //always there
+
+		symbols = append(symbols, u.Symbol)
+		kinds = append(kinds, string(u.Kind))
+		factors = append(factors, u.Factor().FloatString(12))
+	}
+
+	return symbols, kinds, factors
+}
+
+// CookRecipe takes what the recipe used out of the household's fridge and logs that it got cooked, all or nothing.
+// ErrConflict if one of the lots isn't what the deductions were worked out from anymore.
+func (pg *PG) CookRecipe(ctx context.Context, l store.CookLog, deductions []store.FridgeDeduction) (*store.CookLog, error) {
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	tx, err := pg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error cooking recipe: %w", err)
+	}
+
+	for _, d := range deductions {
+		if err = deductFridgeLot(ctx, tx, l.HouseholdUUID, l.UserUUID, d); err != nil {
+			tx.Rollback()
+			if errors.Is(err, store.ErrConflict) {
+				return nil, err
+			}
+			return nil, fmt.Errorf("error cooking recipe: %w", err)
+		}
+	}
+
+	var cookLog store.CookLog
+
+	row := tx.QueryRowContext(ctx, sqlCreateCookLog,
+		l.HouseholdUUID,
+		uuid.NullUUID{UUID: l.UserUUID, Valid: l.UserUUID != uuid.Nil},
+		uuid.NullUUID{UUID: l.RecipeUUID, Valid: l.RecipeUUID != uuid.Nil},
+		l.RecipeName,
+		l.Servings,
+	)
+
+	if err = scanCookLog(row, &cookLog); err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("error cooking recipe: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("error cooking recipe: %w", err)
+	}
+
+	return &cookLog, nil
+}
+
+// deductFridgeLot applies d to its lot, cooked by uid. The lot stays locked until tx is done.
+func deductFridgeLot(ctx context.Context, tx *sql.Tx, hid, uid uuid.UUID, d store.FridgeDeduction) error {
+	var amount units.Amount
+	var unit string
+
+	if err := tx.QueryRowContext(ctx, sqlLockFridgeLot, hid, d.FridgeItemUUID).Scan(&amount, &unit); err != nil {
+		if errors.Is(err, sql.ErrNoRows) { //somebody took it out in the meantime
+			return store.ErrConflict
+		}
+		return err
+	}
+
+	if amount.Cmp(d.Amount) != 0 || unit != d.Unit {
+		return store.ErrConflict
+	}
+
+	return takeFromFridgeLot(ctx, tx, uid, d)
+}
+
+// scanCookLog scans a row of the cook log columns, in the order sql.go selects them.
+func scanCookLog(row scanner, l *store.CookLog) error {
+	var userUUID, recipeUUID uuid.NullUUID
+
+	if err := row.Scan(
+		&l.CookLogUUID,
+		&l.HouseholdUUID,
+		&userUUID,
+		&recipeUUID,
+		&l.RecipeName,
+		&l.Servings,
+		&l.CreatedAt,
+	); err != nil {
+		return err
+	}
+
+	l.UserUUID = userUUID.UUID
+	l.RecipeUUID = recipeUUID.UUID
+
+	return nil
+}
+
+// lotEvent is eventType happening to lot, done by uid. lot is as it is after, or as it was for a delete.
+func lotEvent(eventType string, lot store.FridgeIngredient, uid uuid.UUID) store.FridgeEvent {
+	return store.FridgeEvent{
+		EventType:      eventType,
+		HouseholdUUID:  lot.HouseholdUUID,
+		UserUUID:       uid,
+		FridgeItemUUID: lot.FridgeItemUUID,
+		IngredientUUID: lot.IngredientUUID,
+		Amount:         lot.Amount,
+		Unit:           lot.Unit,
+		PurchasedDate:  lot.PurchasedDate,
+		ExpirationDate: lot.ExpirationDate,
+		Location:       lot.Location,
+		OpenedDate:     lot.OpenedDate,
+	}
+}
+
+// createFridgeEvent adds e to the ledger inside somebody's transaction. Everything that changes fridge_ingredients does
+// it in the same transaction, so the lots are always what replaying the events gets.
+func createFridgeEvent(ctx context.Context, tx *sql.Tx, e store.FridgeEvent) error {
+	_, err := tx.ExecContext(ctx, sqlCreateFridgeEvent,
+		e.EventType,
+		e.HouseholdUUID,
+		uuid.NullUUID{UUID: e.UserUUID, Valid: e.UserUUID != uuid.Nil},
+		e.FridgeItemUUID,
+		e.IngredientUUID,
+		e.Amount,
+		e.Unit,
+		e.PurchasedDate,
+		e.ExpirationDate,
+		e.Location,
+		e.OpenedDate,
+		sql.NullString{String: e.Reason, Valid: e.Reason != ""},
+		e.EstimatedCost,
+	)
+	return err
+}
+
+// scanFridgeEvent scans a row of the fridge event columns, in the order sql.go selects them.
+func scanFridgeEvent(row scanner, e *store.FridgeEvent) error {
+	var userUUID, ingredientUUID uuid.NullUUID
+	var purchasedDate, expirationDate, openedDate sql.NullTime
+	var location, reason, estimatedCost sql.NullString
+
+	if err := row.Scan(
+		&e.FridgeEventUUID,
+		&e.EventType,
+		&e.HouseholdUUID,
+		&userUUID,
+		&e.FridgeItemUUID,
+		&ingredientUUID,
+		&e.IngredientName,
+		&e.Category,
+		&e.Amount,
+		&e.Unit,
+		&purchasedDate,
+		&expirationDate,
+		&location,
+		&openedDate,
+		&reason,
+		&estimatedCost,
+		&e.CreatedAt,
+	); err != nil {
+		return err
+	}
+
+	e.UserUUID = userUUID.UUID
+	e.IngredientUUID = ingredientUUID.UUID
+	e.PurchasedDate = purchasedDate.Time //null on the deletes from before there was a ledger
+	e.ExpirationDate = expirationDate.Time
+	e.Location = location.String
+	if openedDate.Valid {
+		e.OpenedDate = &openedDate.Time
+	}
+	e.Reason = reason.String
+	if estimatedCost.Valid {
+		cost, err := units.ParseAmount(estimatedCost.String)
+		if err != nil {
+			return err
+		}
+		e.EstimatedCost = &cost
+	}
+
+	return nil
+}
+
+func (pg *PG) ListFridgeEvents(ctx context.Context, hid uuid.UUID, from, to time.Time) ([]store.FridgeEvent, error) {
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	var events []store.FridgeEvent
+
+	rows, err := pg.db.QueryContext(ctx, sqlListFridgeEvents, hid, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("error listing fridge events: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var event store.FridgeEvent
+		if err := scanFridgeEvent(rows, &event); err != nil {
+			return nil, fmt.Errorf("error listing fridge events: %w", err)
+		}
+		events = append(events, event)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error listing fridge events: %w", err)
+	}
+
+	return events, nil
+}
+
+func (pg *PG) ListUserFridgeEvents(ctx context.Context, uid uuid.UUID) ([]store.FridgeEvent, error) {
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	var events []store.FridgeEvent
+
+	rows, err := pg.db.QueryContext(ctx, sqlListUserFridgeEvents, uid)
+	if err != nil {
+		return nil, fmt.Errorf("error listing user fridge events: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var event store.FridgeEvent
+		if err := scanFridgeEvent(rows, &event); err != nil {
+			return nil, fmt.Errorf("error listing user fridge events: %w", err)
+		}
+		events = append(events, event)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error listing user fridge events: %w", err)
+	}
+
+	return events, nil
+}
+
+const rebuildTimeout = 5 * time.Minute //it reads the whole ledger
+
+// FridgeRebuild is what RebuildFridgeIngredients did.
+type FridgeRebuild struct {
+	Events  int //replayed
+	Lots    int //in the fridges now
+	Changed int //lots that weren't there, weren't the same or shouldn't have been there before
+}
+
+// RebuildFridgeIngredients makes fridge_ingredients again out of the ledger, for when it got out of step with it. Nobody
+// can change a fridge while it runs. With dryRun nothing changes, it only says what would.
+// It's only for wdietctl, the service never needs it.
+func (pg *PG) RebuildFridgeIngredients(ctx context.Context, dryRun bool) (*FridgeRebuild, error) {
+	ctx, cancel := context.WithTimeout(ctx, rebuildTimeout)
+	defer cancel()
+
+	tx, err := pg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error rebuilding fridge ingredients: %w", err)
+	}
+
+	if _, err = tx.ExecContext(ctx, sqlLockFridgeLedger); err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("error rebuilding fridge ingredients: %w", err)
+	}
+
+	events, err := listAllFridgeEvents(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("error rebuilding fridge ingredients: %w", err)
+	}
+
+	before, err := listAllFridgeLots(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("error rebuilding fridge ingredients: %w", err)
+	}
+
+	lots := store.ReplayFridgeEvents(events)
+	rebuild := FridgeRebuild{Events: len(events), Lots: len(lots)}
+
+	for _, lot := range lots {
+		if was, ok := before[lot.FridgeItemUUID]; !ok || !sameLot(was, lot) {
+			rebuild.Changed++
+		}
+		delete(before, lot.FridgeItemUUID)
+	}
+	rebuild.Changed += len(before) //the ones that shouldn't be there
+
+	if dryRun {
+		tx.Rollback()
+		return &rebuild, nil
+	}
+
+	if _, err = tx.ExecContext(ctx, sqlDeleteAllFridgeIngredients); err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("error rebuilding fridge ingredients: %w", err)
+	}
+
+	for _, lot := range lots {
+		if _, err = tx.ExecContext(ctx, sqlRestoreFridgeIngredient,
+			lot.FridgeItemUUID,
+			lot.HouseholdUUID,
+			uuid.NullUUID{UUID: lot.UserUUID, Valid: lot.UserUUID != uuid.Nil},
+			lot.IngredientUUID,
+			lot.Amount,
+			lot.Unit,
+			lot.PurchasedDate,
+			lot.ExpirationDate,
+			lot.Location,
+			lot.OpenedDate,
+			lot.CreatedAt,
+			lot.UpdatedAt,
+		); err != nil {
+			tx.Rollback()
+			return nil, fmt.Errorf("error rebuilding fridge ingredients: %w", err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("error rebuilding fridge ingredients: %w", err)
+	}
+
+	return &rebuild, nil
+}
+
+// listAllFridgeEvents lists every fridge event there is, in the order they happened.
+func listAllFridgeEvents(ctx context.Context, tx *sql.Tx) ([]store.FridgeEvent, error) {
+	rows, err := tx.QueryContext(ctx, sqlListAllFridgeEvents)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []store.FridgeEvent
+
+	for rows.Next() {
+		var event store.FridgeEvent
+		if err := scanFridgeEvent(rows, &event); err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+
+	return events, rows.Err()
+}
+
+// listAllFridgeLots gets every lot in every fridge, by fridge_item_uuid.
+func listAllFridgeLots(ctx context.Context, tx *sql.Tx) (map[uuid.UUID]store.FridgeIngredient, error) {
+	rows, err := tx.QueryContext(ctx, sqlListAllFridgeIngredients)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lots := make(map[uuid.UUID]store.FridgeIngredient)
+
+	for rows.Next() {
+		var lot store.FridgeIngredient
+		if err := scanFridgeIngredient(rows, &lot); err != nil {
+			return nil, err
+		}
+		lots[lot.FridgeItemUUID] = lot
+	}
+
+	return lots, rows.Err()
+}
+
+// sameLot tells if a and b are the same lot with the same everything.
+func sameLot(a, b store.FridgeIngredient) bool {
+	switch {
+	case a.FridgeItemUUID != b.FridgeItemUUID, a.HouseholdUUID != b.HouseholdUUID, a.UserUUID != b.UserUUID, a.IngredientUUID != b.IngredientUUID:
+		return false
+	case a.Amount.Cmp(b.Amount) != 0, a.Unit != b.Unit, a.Location != b.Location:
+		return false
+	case !a.PurchasedDate.Equal(b.PurchasedDate), !a.ExpirationDate.Equal(b.ExpirationDate):
+		return false
+	case !a.CreatedAt.Equal(b.CreatedAt), !a.UpdatedAt.Equal(b.UpdatedAt):
+		return false
+	case (a.OpenedDate == nil) != (b.OpenedDate == nil):
+		return false
+	case a.OpenedDate != nil && !a.OpenedDate.Equal(*b.OpenedDate):
+		return false
+	}
+	return true
+}
+
+// ListCookLogs lists what uid cooked, newest first.
+func (pg *PG) ListCookLogs(ctx context.Context, uid uuid.UUID) ([]store.CookLog, error) {
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	var cookLogs []store.CookLog
+
+	rows, err := pg.db.QueryContext(ctx, sqlListCookLogs, uid)
+	if err != nil {
+		return nil, fmt.Errorf("error listing cook logs: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var cookLog store.CookLog
+		if err := scanCookLog(rows, &cookLog); err != nil {
+			return nil, fmt.Errorf("error listing cook logs: %w", err)
+		}
+		cookLogs = append(cookLogs, cookLog)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error listing cook logs: %w", err)
+	}
+
+	return cookLogs, nil
+}
+
+// scanDigestSettings scans a row of the digest settings columns, in the order sql.go selects them.
+func scanDigestSettings(row scanner, d *store.DigestSettings) error {
+	var webhookURL sql.NullString
+	var lastSentOn sql.NullTime
+
+	if err := row.Scan(
+		&d.UserUUID,
+		&d.Enabled,
+		&d.Minute,
+		&d.Timezone,
+		&d.Channel,
+		&webhookURL,
+		&d.WithinDays,
+		&lastSentOn,
+		&d.CreatedAt,
+		&d.UpdatedAt,
+	); err != nil {
+		return err
+	}
+
+	d.WebhookURL = webhookURL.String
+	if lastSentOn.Valid {
+		d.LastSentOn = &lastSentOn.Time
+	}
+
+	return nil
+}
+
+func (pg *PG) GetDigestSettings(ctx context.Context, uid uuid.UUID) (*store.DigestSettings, error) {
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	var settings store.DigestSettings
+
+	row := pg.db.QueryRowContext(ctx, sqlGetDigestSettings, uid)
+	if err := scanDigestSettings(row, &settings); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, store.ErrNotFound
+		}
+		return nil, fmt.Errorf("error getting digest settings: %w", err)
+	}
+
+	return &settings, nil
+}
+
+func (pg *PG) SetDigestSettings(ctx context.Context, d store.DigestSettings) (*store.DigestSettings, error) {
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	tx, err := pg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error setting digest settings: %w", err)
+	}
+
+	var settings store.DigestSettings
+
+	row := tx.QueryRowContext(ctx, sqlSetDigestSettings,
+		d.UserUUID,
+		d.Enabled,
+		d.Minute,
+		d.Timezone,
+		d.Channel,
+		sql.NullString{String: d.WebhookURL, Valid: d.WebhookURL != ""},
+		d.WithinDays,
+	)
+
+	if err = scanDigestSettings(row, &settings); err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("error setting digest settings: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("error setting digest settings: %w", err)
+	}
+
+	return &settings, nil
+}
+
+func (pg *PG) ListEnabledDigestSettings(ctx context.Context) ([]store.DigestSettings, error) {
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	var settings []store.DigestSettings
+
+	rows, err := pg.db.QueryContext(ctx, sqlListEnabledDigestSettings)
+	if err != nil {
+		return nil, fmt.Errorf("error listing digest settings: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var d store.DigestSettings
+		if err := scanDigestSettings(rows, &d); err != nil {
+			return nil, fmt.Errorf("error listing digest settings: %w", err)
+		}
+		settings = append(settings, d)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error listing digest settings: %w", err)
+	}
+
+	return settings, nil
+}
+
+func (pg *PG) ClaimDigest(ctx context.Context, uid uuid.UUID, day time.Time) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	res, err := pg.db.ExecContext(ctx, sqlClaimDigest, uid, day.Format("2006-01-02"))
+	if err != nil {
+		return false, fmt.Errorf("error claiming digest: %w", err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("error claiming digest: %w", err)
+	}
+
+	return affected == 1, nil
+}
+
+// scanPersonalAccessToken scans a row of the personal access token columns, in the order sql.go selects them.
+func scanPersonalAccessToken(row scanner, t *store.PersonalAccessToken) error {
+	var expiresAt, lastUsedAt sql.NullTime
+
+	if err := row.Scan(
+		&t.PersonalAccessTokenUUID,
+		&t.UserUUID,
+		&t.Name,
+		pq.Array(&t.Scopes),
+		&t.HashedToken,
+		&expiresAt,
+		&lastUsedAt,
+		&t.CreatedAt,
+	); err != nil {
+		return err
+	}
+
+	if expiresAt.Valid {
+		t.ExpiresAt = &expiresAt.Time
+	}
+	if lastUsedAt.Valid {
+		t.LastUsedAt = &lastUsedAt.Time
+	}
+
+	return nil
+}
+
+func (pg *PG) CreatePersonalAccessToken(ctx context.Context, t store.PersonalAccessToken) (*store.PersonalAccessToken, error) {
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	var token store.PersonalAccessToken
+
+	row := pg.db.QueryRowContext(ctx, sqlCreatePersonalAccessToken,
+		t.UserUUID,
+		t.Name,
+		pq.Array(t.Scopes),
+		t.HashedToken,
+		t.ExpiresAt,
+	)
+	if err := scanPersonalAccessToken(row, &token); err != nil {
+		return nil, fmt.Errorf("error creating personal access token: %w", err)
+	}
+
+	return &token, nil
+}
+
+func (pg *PG) ListPersonalAccessTokens(ctx context.Context, uid uuid.UUID) ([]store.PersonalAccessToken, error) {
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	rows, err := pg.db.QueryContext(ctx, sqlListPersonalAccessTokens, uid)
+	if err != nil {
+		return nil, fmt.Errorf("error listing personal access tokens: %w", err)
+	}
+	defer rows.Close()
+
+	var tokens []store.PersonalAccessToken
+
+	for rows.Next() {
+		var token store.PersonalAccessToken
+		if err := scanPersonalAccessToken(rows, &token); err != nil {
+			return nil, fmt.Errorf("error listing personal access tokens: %w", err)
+		}
+		tokens = append(tokens, token)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error listing personal access tokens: %w", err)
+	}
+
+	return tokens, nil
+}
+
+func (pg *PG) DeletePersonalAccessToken(ctx context.Context, uid, tid uuid.UUID) error {
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	res, err := pg.db.ExecContext(ctx, sqlDeletePersonalAccessToken, uid, tid)
+	if err != nil {
+		return fmt.Errorf("error deleting personal access token: %w", err)
+	}
+
+	if affected, _ := res.RowsAffected(); affected == 0 {
+		return store.ErrNotFound
+	}
+
+	return nil
+}
+
+// UsePersonalAccessToken looks up an unexpired token by its hash and marks it used.
+func (pg *PG) UsePersonalAccessToken(ctx context.Context, hashedToken string) (*store.PersonalAccessToken, error) {
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	var token store.PersonalAccessToken
+
+	row := pg.db.QueryRowContext(ctx, sqlUsePersonalAccessToken, hashedToken)
+	if err := scanPersonalAccessToken(row, &token); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, store.ErrNotFound
+		}
+		return nil, fmt.Errorf("error using personal access token: %w", err)
+	}
+
+	return &token, nil
+}
+
+func scanTOTP(row scanner, t *store.TOTP) error {
+	var enabledAt sql.NullTime
+
+	if err := row.Scan(
+		&t.UserUUID,
+		&t.Secret,
+		&enabledAt,
+		&t.LastStep,
+		&t.CreatedAt,
+	); err != nil {
+		return err
+	}
+
+	if enabledAt.Valid {
+		t.EnabledAt = &enabledAt.Time
+	}
+
+	return nil
+}
+
+func (pg *PG) GetTOTP(ctx context.Context, uid uuid.UUID) (*store.TOTP, error) {
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	var t store.TOTP
+
+	row := pg.db.QueryRowContext(ctx, sqlGetTOTP, uid)
+	if err := scanTOTP(row, &t); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, store.ErrNotFound
+		}
+		return nil, fmt.Errorf("error getting totp: %w", err)
+	}
+
+	return &t, nil
+}
+
+// StartTOTPEnrolment saves a new, not yet enabled secret and replaces the user's recovery codes. Starting over is fine
+// until enrolment is confirmed, after that it returns store.ErrConflict.
+func (pg *PG) StartTOTPEnrolment(ctx context.Context, t store.TOTP, hashedRecoveryCodes []string) (*store.TOTP, error) {
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	tx, err := pg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error starting totp enrolment: %w", err)
+	}
+
+	var enrolment store.TOTP
+
+	row := tx.QueryRowContext(ctx, sqlStartTOTPEnrolment, t.UserUUID, t.Secret)
+	if err = scanTOTP(row, &enrolment); err != nil {
+		tx.Rollback()
+		if errors.Is(err, sql.ErrNoRows) { //the WHERE on the upsert didn't match, it's enabled already
+			return nil, store.ErrConflict
+		}
+		return nil, fmt.Errorf("error starting totp enrolment: %w", err)
+	}
+
+	if _, err = tx.ExecContext(ctx, sqlDeleteRecoveryCodes, t.UserUUID); err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("error starting totp enrolment: %w", err)
+	}
+
+	for _, code := range hashedRecoveryCodes {
+		if _, err = tx.ExecContext(ctx, sqlCreateRecoveryCode, t.UserUUID, code); err != nil {
+			tx.Rollback()
+			return nil, fmt.Errorf("error starting totp enrolment: %w", err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("error starting totp enrolment: %w", err)
+	}
+
+	return &enrolment, nil
+}
+
+// EnableTOTP confirms the enrolment, step is the code the user confirmed with so it can't be used again to log in.
+func (pg *PG) EnableTOTP(ctx context.Context, uid uuid.UUID, step int64) error {
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	res, err := pg.db.ExecContext(ctx, sqlEnableTOTP, uid, step)
+	if err != nil {
+		return fmt.Errorf("error enabling totp: %w", err)
+	}
+
+	if affected, _ := res.RowsAffected(); affected == 0 {
+		return store.ErrNotFound
+	}
+
+	return nil
+}
+
+// DisableTOTP removes the user's secret and recovery codes, login goes back to password only.
+func (pg *PG) DisableTOTP(ctx context.Context, uid uuid.UUID) error {
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	tx, err := pg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error disabling totp: %w", err)
+	}
+
+	res, err := tx.ExecContext(ctx, sqlDisableTOTP, uid)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("error disabling totp: %w", err)
+	}
+
+	if affected, _ := res.RowsAffected(); affected == 0 {
+		tx.Rollback()
+		return store.ErrNotFound
+	}
+
+	if _, err = tx.ExecContext(ctx, sqlDeleteRecoveryCodes, uid); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("error disabling totp: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("error disabling totp: %w", err)
+	}
+
+	return nil
+}
+
+// UseTOTPStep marks the code at step used. false means it, or a later one, was used already.
+func (pg *PG) UseTOTPStep(ctx context.Context, uid uuid.UUID, step int64) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	res, err := pg.db.ExecContext(ctx, sqlUseTOTPStep, uid, step)
+	if err != nil {
+		return false, fmt.Errorf("error using totp step: %w", err)
+	}
+
+	affected, _ := res.RowsAffected()
+
+	return affected == 1, nil
+}
+
+// UseRecoveryCode marks an unused recovery code used, or returns store.ErrNotFound.
+func (pg *PG) UseRecoveryCode(ctx context.Context, uid uuid.UUID, hashedCode string) error {
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	res, err := pg.db.ExecContext(ctx, sqlUseRecoveryCode, uid, hashedCode)
+	if err != nil {
+		return fmt.Errorf("error using recovery code: %w", err)
+	}
+
+	if affected, _ := res.RowsAffected(); affected == 0 {
+		return store.ErrNotFound
+	}
+
+	return nil
+}
+
+func scanLoginChallenge(row scanner, c *store.LoginChallenge) error {
+	var usedAt sql.NullTime
+
+	if err := row.Scan(
+		&c.LoginChallengeUUID,
+		&c.UserUUID,
+		&c.HashedToken,
+		&c.Attempts,
+		&c.ExpiresAt,
+		&usedAt,
+		&c.CreatedAt,
+	); err != nil {
+		return err
+	}
+
+	if usedAt.Valid {
+		c.UsedAt = &usedAt.Time
+	}
+
+	return nil
+}
+
+func (pg *PG) CreateLoginChallenge(ctx context.Context, c store.LoginChallenge) (*store.LoginChallenge, error) {
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	var challenge store.LoginChallenge
+
+	row := pg.db.QueryRowContext(ctx, sqlCreateLoginChallenge, c.UserUUID, c.HashedToken, c.ExpiresAt)
+	if err := scanLoginChallenge(row, &challenge); err != nil {
+		return nil, fmt.Errorf("error creating login challenge: %w", err)
+	}
+
+	return &challenge, nil
+}
+
+// AttemptLoginChallenge counts an attempt on an unused challenge and returns it, expired or not.
+func (pg *PG) AttemptLoginChallenge(ctx context.Context, hashedToken string) (*store.LoginChallenge, error) {
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	var challenge store.LoginChallenge
+
+	row := pg.db.QueryRowContext(ctx, sqlAttemptLoginChallenge, hashedToken)
+	if err := scanLoginChallenge(row, &challenge); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, store.ErrNotFound
+		}
+		return nil, fmt.Errorf("error attempting login challenge: %w", err)
+	}
+
+	return &challenge, nil
+}
+
+// UseLoginChallenge marks the challenge used. If somebody else used it first it returns store.ErrRevoked.
+func (pg *PG) UseLoginChallenge(ctx context.Context, id uuid.UUID) error {
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	res, err := pg.db.ExecContext(ctx, sqlUseLoginChallenge, id)
+	if err != nil {
+		return fmt.Errorf("error using login challenge: %w", err)
+	}
+
+	if affected, _ := res.RowsAffected(); affected == 0 {
+		return store.ErrRevoked
+	}
+
+	return nil
+}
+
+func scanUserIdentity(row scanner, i *store.UserIdentity) error {
+	var lastLoginAt sql.NullTime
+
+	if err := row.Scan(
+		&i.UserIdentityUUID,
+		&i.UserUUID,
+		&i.Provider,
+		&i.Subject,
+		&i.EmailAddress,
+		&i.CreatedAt,
+		&lastLoginAt,
+	); err != nil {
+		return err
+	}
+
+	if lastLoginAt.Valid {
+		i.LastLoginAt = &lastLoginAt.Time
+	}
+
+	return nil
+}
+
+// UseUserIdentity finds the identity a provider's subject is linked to and stamps the login.
+func (pg *PG) UseUserIdentity(ctx context.Context, provider, subject string) (*store.UserIdentity, error) {
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	var identity store.UserIdentity
+
+	row := pg.db.QueryRowContext(ctx, sqlUseUserIdentity, provider, subject)
+	if err := scanUserIdentity(row, &identity); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, store.ErrNotFound
+		}
+		return nil, fmt.Errorf("error using user identity: %w", err)
+	}
+
+	return &identity, nil
+}
+
+func (pg *PG) ListUserIdentities(ctx context.Context, uid uuid.UUID) ([]store.UserIdentity, error) {
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	rows, err := pg.db.QueryContext(ctx, sqlListUserIdentities, uid)
+	if err != nil {
+		return nil, fmt.Errorf("error listing user identities: %w", err)
+	}
+	defer rows.Close()
+
+	var identities []store.UserIdentity
+
+	for rows.Next() {
+		var identity store.UserIdentity
+		if err := scanUserIdentity(rows, &identity); err != nil {
+			return nil, fmt.Errorf("error listing user identities: %w", err)
+		}
+		identities = append(identities, identity)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error listing user identities: %w", err)
+	}
+
+	return identities, nil
+}
+
+// CreateUserIdentity links i to its user. store.ErrConflict if the subject or the user already has a link at the provider.
+func (pg *PG) CreateUserIdentity(ctx context.Context, i store.UserIdentity) (*store.UserIdentity, error) {
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	var identity store.UserIdentity
+
+	row := pg.db.QueryRowContext(ctx, sqlCreateUserIdentity, i.UserUUID, i.Provider, i.Subject, i.EmailAddress)
+	if err := scanUserIdentity(row, &identity); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, store.ErrConflict
+		}
+		return nil, fmt.Errorf("error creating user identity: %w", err)
+	}
+
+	return &identity, nil
+}
+
+// CreateUserWithIdentity signs up somebody who came from a provider, with their email verified since the provider did that.
+func (pg *PG) CreateUserWithIdentity(ctx context.Context, u store.User, i store.UserIdentity) (*store.User, error) {
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	tx, err := pg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating user with identity: %w", err)
+	}
+
+	var user store.User
+
+	row := tx.QueryRowContext(ctx, sqlCreateVerifiedUser,
+		u.HashedPassword,
+		u.Active,
+		u.FirstName,
+		u.LastName,
+		u.EmailAddress,
+	)
+	if err = scanUser(row, &user); err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("error creating user with identity: %w", err)
+	}
+
+	var identity store.UserIdentity
+
+	row = tx.QueryRowContext(ctx, sqlCreateUserIdentity, user.UserUUID, i.Provider, i.Subject, i.EmailAddress)
+	if err = scanUserIdentity(row, &identity); err != nil {
+		tx.Rollback()
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, store.ErrConflict
+		}
+		return nil, fmt.Errorf("error creating user with identity: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("error creating user with identity: %w", err)
+	}
+
+	return &user, nil
+}
+
+func scanOIDCState(row scanner, st *store.OIDCState) error {
+	return row.Scan(
+		&st.OIDCStateUUID,
+		&st.HashedState,
+		&st.Provider,
+		&st.Nonce,
+		&st.CodeVerifier,
+		&st.ExpiresAt,
+		&st.CreatedAt,
+	)
+}
+
+func (pg *PG) CreateOIDCState(ctx context.Context, st store.OIDCState) (*store.OIDCState, error) {
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	var state store.OIDCState
+
+	row := pg.db.QueryRowContext(ctx, sqlCreateOIDCState, st.HashedState, st.Provider, st.Nonce, st.CodeVerifier, st.ExpiresAt)
+	if err := scanOIDCState(row, &state); err != nil {
+		return nil, fmt.Errorf("error creating oidc state: %w", err)
+	}
+
+	return &state, nil
+}
+
+// UseOIDCState takes the state out of the store, it only works once. Returns it expired or not.
+func (pg *PG) UseOIDCState(ctx context.Context, hashedState string) (*store.OIDCState, error) {
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	var state store.OIDCState
+
+	row := pg.db.QueryRowContext(ctx, sqlUseOIDCState, hashedState)
+	if err := scanOIDCState(row, &state); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, store.ErrNotFound
+		}
+		return nil, fmt.Errorf("error using oidc state: %w", err)
+	}
+
+	return &state, nil
+}
+
+func (pg *PG) GetRefreshToken(ctx context.Context, hashedToken string) (*store.RefreshToken, error) {
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	var refreshToken store.RefreshToken
+
+	row := pg.db.QueryRowContext(ctx, sqlGetRefreshToken, hashedToken)
+	if err := scanRefreshToken(row, &refreshToken); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, store.ErrNotFound
+		}
+		return nil, fmt.Errorf("error getting refresh token: %w", err)
+	}
+
+	return &refreshToken, nil
+}
+
+func scanRefreshToken(row scanner, t *store.RefreshToken) error {
+	var revokedAt sql.NullTime
+
+	if err := row.Scan(
+		&t.RefreshTokenUUID,
+		&t.FamilyUUID,
+		&t.UserUUID,
+		&t.HashedToken,
+		&t.ExpiresAt,
+		&revokedAt,
+		&t.CreatedAt,
+	); err != nil {
+		return err
+	}
+
+	if revokedAt.Valid {
+		t.RevokedAt = &revokedAt.Time
+	}
+
+	return nil
+}
+
+// ListRefreshTokens is every refresh token the user has had, newest first. Rotated ones stay around revoked, so it's
+// their login history as well.
+func (pg *PG) ListRefreshTokens(ctx context.Context, uid uuid.UUID) ([]store.RefreshToken, error) {
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	rows, err := pg.db.QueryContext(ctx, sqlListRefreshTokens, uid)
+	if err != nil {
+		return nil, fmt.Errorf("error listing refresh tokens: %w", err)
+	}
+	defer rows.Close()
+
+	var tokens []store.RefreshToken
+
+	for rows.Next() {
+		var token store.RefreshToken
+		if err := scanRefreshToken(rows, &token); err != nil {
+			return nil, fmt.Errorf("error listing refresh tokens: %w", err)
+		}
+		tokens = append(tokens, token)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error listing refresh tokens: %w", err)
+	}
+
+	return tokens, nil
+}
+
+func (pg *PG) CreateRefreshToken(ctx context.Context, t store.RefreshToken) (*store.RefreshToken, error) {
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	tx, err := pg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating refresh token: %w", err)
+	}
+
+	refreshToken, err := createRefreshToken(ctx, tx, t)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("error creating refresh token: %w", err)
+	}
+
+	return refreshToken, nil
+}
+
+// RotateRefreshToken revokes the token id and creates next in its place, in one transaction.
+// If id was already revoked it returns store.ErrRevoked and creates nothing.
+func (pg *PG) RotateRefreshToken(ctx context.Context, id uuid.UUID, next store.RefreshToken) (*store.RefreshToken, error) {
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	tx, err := pg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error rotating refresh token: %w", err)
+	}
+
+	res, err := tx.ExecContext(ctx, sqlRevokeRefreshToken, id)
+	if err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("error rotating refresh token: %w", err)
+	}
+
+	if affected, _ := res.RowsAffected(); affected != 1 {
+		tx.Rollback()
+		return nil, store.ErrRevoked
+	}
+
+	refreshToken, err := createRefreshToken(ctx, tx, next)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("error rotating refresh token: %w", err)
+	}
+
+	return refreshToken, nil
+}
+
+func createRefreshToken(ctx context.Context, tx *sql.Tx, t store.RefreshToken) (*store.RefreshToken, error) {
+	var refreshToken store.RefreshToken
+	var revokedAt sql.NullTime
+
+	row := tx.QueryRowContext(ctx, sqlCreateRefreshToken,
+		t.FamilyUUID,
+		t.UserUUID,
+		t.HashedToken,
+		t.ExpiresAt,
+	)
+
+	if err := row.Scan(
+		&refreshToken.RefreshTokenUUID,
+		&refreshToken.FamilyUUID,
+		&refreshToken.UserUUID,
+		&refreshToken.HashedToken,
+		&refreshToken.ExpiresAt,
+		&revokedAt,
+		&refreshToken.CreatedAt,
+	); err != nil {
+		return nil, fmt.Errorf("error creating refresh token: %w", err)
+	}
+
+	if revokedAt.Valid {
+		refreshToken.RevokedAt = &revokedAt.Time
+	}
+
+	return &refreshToken, nil
+}
+
+func (pg *PG) RevokeRefreshTokenFamily(ctx context.Context, familyID uuid.UUID) error {
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	tx, err := pg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error revoking refresh token family: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, sqlRevokeRefreshTokenFamily, familyID); err != nil { //no rows affected is fine, the family might be revoked already
+		tx.Rollback()
+		return fmt.Errorf("error revoking refresh token family: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("error revoking refresh token family: %w", err)
+	}
+
+	return nil
+}
+
+func (pg *PG) RevokeAccessToken(ctx context.Context, jti uuid.UUID, expiresAt time.Time) error {
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	tx, err := pg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error revoking access token: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, sqlDeleteExpiredAccessTokens); err != nil { //cleaning up on the way in keeps the denylist small without a cron job
+		tx.Rollback()
+		return fmt.Errorf("error revoking access token: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, sqlRevokeAccessToken, jti, expiresAt); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("error revoking access token: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("error revoking access token: %w", err)
+	}
+
+	return nil
+}
+
+func (pg *PG) IsAccessTokenRevoked(ctx context.Context, jti uuid.UUID) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	var revoked bool
+
+	row := pg.db.QueryRowContext(ctx, sqlIsAccessTokenRevoked, jti)
+	if err := row.Scan(&revoked); err != nil {
+		return false, fmt.Errorf("error checking access token: %w", err)
+	}
+
+	return revoked, nil
+}
+
+func (pg *PG) CreatePasswordResetToken(ctx context.Context, t store.PasswordResetToken) (*store.PasswordResetToken, error) {
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	tx, err := pg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating password reset token: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, sqlUseUserPasswordResetTokens, t.UserUUID); err != nil { //only the latest mail works
+		tx.Rollback()
+		return nil, fmt.Errorf("error creating password reset token: %w", err)
+	}
+
+	var resetToken store.PasswordResetToken
+	var usedAt sql.NullTime
+
+	row := tx.QueryRowContext(ctx, sqlCreatePasswordResetToken,
+		t.UserUUID,
+		t.HashedToken,
+		t.ExpiresAt,
+	)
+
+	if err = row.Scan(
+		&resetToken.PasswordResetTokenUUID,
+		&resetToken.UserUUID,
+		&resetToken.HashedToken,
+		&resetToken.ExpiresAt,
+		&usedAt,
+		&resetToken.CreatedAt,
+	); err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("error creating password reset token: %w", err)
+	}
+
+	if usedAt.Valid {
+		resetToken.UsedAt = &usedAt.Time
+	}
+
+	if err = tx.Commit(); err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("error creating password reset token: %w", err)
+	}
+
+	return &resetToken, nil
+}
+
+// GetPasswordResetUser returns store.ErrNotFound for unknown, used and expired tokens, like ResetPassword.
+func (pg *PG) GetPasswordResetUser(ctx context.Context, hashedToken string) (*store.User, error) {
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	var user store.User
+
+	row := pg.db.QueryRowContext(ctx, sqlGetPasswordResetUser, hashedToken)
+	if err := scanUser(row, &user); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, store.ErrNotFound
+		}
+		return nil, fmt.Errorf("error getting password reset user: %w", err)
+	}
+
+	return &user, nil
+}
+
+// ResetPassword uses up the reset token and sets the password of the user it was issued to.
+// Unknown, used and expired tokens all return store.ErrNotFound.
+func (pg *PG) ResetPassword(ctx context.Context, hashedToken string, hashedPassword string) error {
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	tx, err := pg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error resetting password: %w", err)
+	}
+
+	var uid uuid.UUID
+
+	row := tx.QueryRowContext(ctx, sqlUsePasswordResetToken, hashedToken)
+	if err := row.Scan(&uid); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			tx.Rollback()
+			return store.ErrNotFound
+		}
+		tx.Rollback()
+		return fmt.Errorf("error resetting password: %w", err)
+	}
+
+	if err := changePassword(ctx, tx, uid, hashedPassword); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("error resetting password: %w", err)
+	}
+
+	return nil
+}
+
+// CreateEmailVerificationToken stores a verification token. Older tokens of the user stop working, only the latest mail counts.
+func (pg *PG) CreateEmailVerificationToken(ctx context.Context, t store.EmailVerificationToken) (*store.EmailVerificationToken, error) {
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	tx, err := pg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating email verification token: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, sqlUseUserEmailVerificationTokens, t.UserUUID); err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("error creating email verification token: %w", err)
+	}
+
+	var verificationToken store.EmailVerificationToken
+	var usedAt sql.NullTime
+
+	row := tx.QueryRowContext(ctx, sqlCreateEmailVerificationToken,
+		t.UserUUID,
+		t.EmailAddress,
+		t.HashedToken,
+		t.ExpiresAt,
+	)
+
+	if err = row.Scan(
+		&verificationToken.EmailVerificationTokenUUID,
+		&verificationToken.UserUUID,
+		&verificationToken.EmailAddress,
+		&verificationToken.HashedToken,
+		&verificationToken.ExpiresAt,
+		&usedAt,
+		&verificationToken.CreatedAt,
+	); err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("error creating email verification token: %w", err)
+	}
+
+	if usedAt.Valid {
+		verificationToken.UsedAt = &usedAt.Time
+	}
+
+	if err = tx.Commit(); err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("error creating email verification token: %w", err)
+	}
+
+	return &verificationToken, nil
+}
+
+// VerifyEmail uses up the token and marks the email of its user verified. Unknown, used and expired tokens, and tokens
+// sent to an address the user has changed since, all return store.ErrNotFound.
+func (pg *PG) VerifyEmail(ctx context.Context, hashedToken string) (*store.User, error) {
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	tx, err := pg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error verifying email: %w", err)
+	}
+
+	var user store.User
+
+	row := tx.QueryRowContext(ctx, sqlVerifyEmail, hashedToken)
+	if err := scanUser(row, &user); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			tx.Rollback()
+			return nil, store.ErrNotFound
+		}
+		tx.Rollback()
+		return nil, fmt.Errorf("error verifying email: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("error verifying email: %w", err)
+	}
+
+	return &user, nil
+}
+
+func (pg *PG) CreateLockoutEvent(ctx context.Context, e store.LockoutEvent) (*store.LockoutEvent, error) {
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	var event store.LockoutEvent
+
+	row := pg.db.QueryRowContext(ctx, sqlCreateLockoutEvent,
+		e.Scope,
+		e.Subject,
+		e.Failures,
+		e.LockedUntil,
+	)
+
+	if err := row.Scan(
+		&event.LockoutEventUUID,
+		&event.Scope,
+		&event.Subject,
+		&event.Failures,
+		&event.LockedUntil,
+		&event.CreatedAt,
+	); err != nil {
+		return nil, fmt.Errorf("error creating lockout event: %w", err)
+	}
+
+	return &event, nil
+}
+
+func (pg *PG) ListLockoutEvents(ctx context.Context, limit int) ([]store.LockoutEvent, error) {
+	ctx, cancel := context.WithTimeout(ctx, defaultTimeout)
+	defer cancel()
+
+	rows, err := pg.db.QueryContext(ctx, sqlListLockoutEvents, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error listing lockout events: %w", err)
+	}
+	defer rows.Close()
+
+	var events []store.LockoutEvent
+
+	for rows.Next() {
+		var event store.LockoutEvent
+		if err := rows.Scan(
+			&event.LockoutEventUUID,
+			&event.Scope,
+			&event.Subject,
+			&event.Failures,
+			&event.LockedUntil,
+			&event.CreatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("error listing lockout events: %w", err)
+		}
+		events = append(events, event)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error listing lockout events: %w", err)
+	}
+
+	return events, nil
 }
@@ -0,0 +1,39 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS wdiet.refresh_tokens
+(
+    refresh_token_uuid uuid not null default gen_random_uuid()
+        constraint refresh_tokens_primary_key
+            primary key,
+    family_uuid            uuid            not null, --every token rotated out of the same login shares a family, so reusing an old one can revoke them all.
+    user_uuid              uuid            not null
+        constraint user_uuid_fk references wdiet.users,
+    hashed_token           varchar(128)    not null UNIQUE, --sha256 of the token, the token itself is only ever given to the client.
+    expires_at             timestamp       not null,
+    revoked_at             timestamp,
+    created_at             timestamp       not null default now()
+);
+
+CREATE INDEX ON wdiet.refresh_tokens (family_uuid);
+CREATE INDEX ON wdiet.refresh_tokens (user_uuid);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS wdiet.revoked_access_tokens --jti denylist. rows are only useful until the access token would have expired anyway.
+(
+    jti                    uuid            not null
+        constraint revoked_access_tokens_primary_key
+            primary key,
+    expires_at             timestamp       not null,
+    created_at             timestamp       not null default now()
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS wdiet.revoked_access_tokens;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+DROP TABLE IF EXISTS wdiet.refresh_tokens;
+-- +goose StatementEnd
@@ -0,0 +1,22 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS wdiet.password_reset_tokens
+(
+    password_reset_token_uuid uuid not null default gen_random_uuid()
+        constraint password_reset_tokens_primary_key
+            primary key,
+    user_uuid              uuid            not null
+        constraint user_uuid_fk references wdiet.users,
+    hashed_token           varchar(128)    not null UNIQUE, --sha256 of the token we mailed, same as refresh_tokens
+    expires_at             timestamp       not null,
+    used_at                timestamp,  --single use. set when the password is reset, or when a newer reset made this one pointless.
+    created_at             timestamp       not null default now()
+);
+
+CREATE INDEX ON wdiet.password_reset_tokens (user_uuid);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS wdiet.password_reset_tokens;
+-- +goose StatementEnd
@@ -0,0 +1,33 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE wdiet.users ADD COLUMN IF NOT EXISTS email_verified_at timestamp;
+
+UPDATE wdiet.users SET email_verified_at = created_at WHERE email_verified_at IS NULL; --accounts from before verification existed keep working
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS wdiet.email_verification_tokens
+(
+    email_verification_token_uuid uuid not null default gen_random_uuid()
+        constraint email_verification_tokens_primary_key
+            primary key,
+    user_uuid              uuid            not null
+        constraint user_uuid_fk references wdiet.users,
+    email_address          varchar(128)    not null, --the address the link went to. if the user changed it since, the link is no good.
+    hashed_token           varchar(128)    not null UNIQUE,
+    expires_at             timestamp       not null,
+    used_at                timestamp,
+    created_at             timestamp       not null default now()
+);
+
+CREATE INDEX ON wdiet.email_verification_tokens (user_uuid);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS wdiet.email_verification_tokens;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE wdiet.users DROP COLUMN IF EXISTS email_verified_at;
+-- +goose StatementEnd
@@ -0,0 +1,36 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS wdiet.login_attempts --only used when WDIET_LOCKOUT_BACKEND=postgres, so every instance sees the same counts
+(
+    attempt_key            varchar(320)    not null
+        constraint login_attempts_primary_key
+            primary key, --"account:<email>" or "ip:<ip>"
+    failures               int             not null,
+    last_failure_at        timestamp       not null
+);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS wdiet.lockout_events
+(
+    lockout_event_uuid uuid not null default gen_random_uuid()
+        constraint lockout_events_primary_key
+            primary key,
+    scope                  varchar(16)     not null, --account or ip
+    subject                varchar(320)    not null,
+    failures               int             not null,
+    locked_until           timestamp       not null,
+    created_at             timestamp       not null default now()
+);
+
+CREATE INDEX ON wdiet.lockout_events (created_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS wdiet.lockout_events;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+DROP TABLE IF EXISTS wdiet.login_attempts;
+-- +goose StatementEnd
@@ -0,0 +1,10 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE wdiet.users ADD COLUMN IF NOT EXISTS role varchar(16) not null default 'user'
+    constraint users_role_check check (role IN ('user', 'moderator', 'admin'));
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE wdiet.users DROP COLUMN IF EXISTS role;
+-- +goose StatementEnd
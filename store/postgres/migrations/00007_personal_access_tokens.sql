@@ -0,0 +1,24 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS wdiet.personal_access_tokens
+(
+    personal_access_token_uuid uuid not null default gen_random_uuid()
+        constraint personal_access_tokens_primary_key
+            primary key,
+    user_uuid              uuid            not null
+        constraint user_uuid_fk references wdiet.users,
+    name                   varchar(64)     not null,
+    scopes                 text[]          not null, --what the token is allowed to do, see service/scopes.go
+    hashed_token           varchar(128)    not null UNIQUE, --sha256 of the token, same as refresh tokens
+    expires_at             timestamp, --null never expires
+    last_used_at           timestamp,
+    created_at             timestamp       not null default now()
+);
+
+CREATE INDEX ON wdiet.personal_access_tokens (user_uuid);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS wdiet.personal_access_tokens;
+-- +goose StatementEnd
@@ -0,0 +1,59 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS wdiet.user_totp
+(
+    user_uuid              uuid            not null
+        constraint user_totp_primary_key
+            primary key
+        constraint user_uuid_fk references wdiet.users,
+    secret                 varchar(64)     not null, --base32. we need it in the clear to make codes, so this table is as sensitive as the jwt keys.
+    enabled_at             timestamp, --null until the user proves their app works with a first code
+    last_step              bigint          not null default 0, --codes at or before this step are used up
+    created_at             timestamp       not null default now()
+);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS wdiet.recovery_codes
+(
+    recovery_code_uuid uuid not null default gen_random_uuid()
+        constraint recovery_codes_primary_key
+            primary key,
+    user_uuid              uuid            not null
+        constraint user_uuid_fk references wdiet.users,
+    hashed_code            varchar(128)    not null,
+    used_at                timestamp,
+    created_at             timestamp       not null default now()
+);
+
+CREATE UNIQUE INDEX ON wdiet.recovery_codes (user_uuid, hashed_code);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS wdiet.login_challenges --between the password and the code. lives for minutes.
+(
+    login_challenge_uuid uuid not null default gen_random_uuid()
+        constraint login_challenges_primary_key
+            primary key,
+    user_uuid              uuid            not null
+        constraint user_uuid_fk references wdiet.users,
+    hashed_token           varchar(128)    not null UNIQUE,
+    attempts               int             not null default 0,
+    expires_at             timestamp       not null,
+    used_at                timestamp,
+    created_at             timestamp       not null default now()
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS wdiet.login_challenges;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+DROP TABLE IF EXISTS wdiet.recovery_codes;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+DROP TABLE IF EXISTS wdiet.user_totp;
+-- +goose StatementEnd
@@ -0,0 +1,43 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS wdiet.user_identities --logins at openid providers, linked to our users
+(
+    user_identity_uuid uuid not null default gen_random_uuid()
+        constraint user_identities_primary_key
+            primary key,
+    user_uuid              uuid            not null
+        constraint user_uuid_fk references wdiet.users,
+    provider               varchar(64)     not null, --the name from the config, not the issuer. renaming a provider unlinks everyone.
+    subject                varchar(255)    not null, --sub, the only claim providers promise never changes
+    email_address          varchar(255)    not null, --what the provider said when we linked, for the user to recognise it
+    created_at             timestamp       not null default now(),
+    last_login_at          timestamp
+);
+
+CREATE UNIQUE INDEX ON wdiet.user_identities (provider, subject);
+CREATE UNIQUE INDEX ON wdiet.user_identities (user_uuid, provider);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS wdiet.oidc_states --between sending the user to the provider and them coming back. lives for minutes.
+(
+    oidc_state_uuid uuid not null default gen_random_uuid()
+        constraint oidc_states_primary_key
+            primary key,
+    hashed_state           varchar(128)    not null UNIQUE,
+    provider               varchar(64)     not null,
+    nonce                  varchar(128)    not null,
+    code_verifier          varchar(128)    not null, --pkce. in the clear, we have to send it
+    expires_at             timestamp       not null,
+    created_at             timestamp       not null default now()
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS wdiet.oidc_states;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+DROP TABLE IF EXISTS wdiet.user_identities;
+-- +goose StatementEnd
@@ -0,0 +1,114 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE wdiet.users
+    ADD COLUMN IF NOT EXISTS delete_after timestamp; --set while a deletion is pending, the account is gone for good after this
+
+CREATE INDEX ON wdiet.users (delete_after) WHERE delete_after IS NOT NULL;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+-- deleting a user takes everything of theirs with it
+ALTER TABLE wdiet.fridge_ingredients
+    DROP CONSTRAINT user_uuid_fk,
+    ADD CONSTRAINT user_uuid_fk FOREIGN KEY (user_uuid) REFERENCES wdiet.users ON DELETE CASCADE;
+
+ALTER TABLE wdiet.recipes
+    DROP CONSTRAINT user_uuid_fk,
+    ADD CONSTRAINT user_uuid_fk FOREIGN KEY (user_uuid) REFERENCES wdiet.users ON DELETE CASCADE;
+
+ALTER TABLE wdiet.refresh_tokens
+    DROP CONSTRAINT user_uuid_fk,
+    ADD CONSTRAINT user_uuid_fk FOREIGN KEY (user_uuid) REFERENCES wdiet.users ON DELETE CASCADE;
+
+ALTER TABLE wdiet.password_reset_tokens
+    DROP CONSTRAINT user_uuid_fk,
+    ADD CONSTRAINT user_uuid_fk FOREIGN KEY (user_uuid) REFERENCES wdiet.users ON DELETE CASCADE;
+
+ALTER TABLE wdiet.email_verification_tokens
+    DROP CONSTRAINT user_uuid_fk,
+    ADD CONSTRAINT user_uuid_fk FOREIGN KEY (user_uuid) REFERENCES wdiet.users ON DELETE CASCADE;
+
+ALTER TABLE wdiet.personal_access_tokens
+    DROP CONSTRAINT user_uuid_fk,
+    ADD CONSTRAINT user_uuid_fk FOREIGN KEY (user_uuid) REFERENCES wdiet.users ON DELETE CASCADE;
+
+ALTER TABLE wdiet.user_totp
+    DROP CONSTRAINT user_uuid_fk,
+    ADD CONSTRAINT user_uuid_fk FOREIGN KEY (user_uuid) REFERENCES wdiet.users ON DELETE CASCADE;
+
+ALTER TABLE wdiet.recovery_codes
+    DROP CONSTRAINT user_uuid_fk,
+    ADD CONSTRAINT user_uuid_fk FOREIGN KEY (user_uuid) REFERENCES wdiet.users ON DELETE CASCADE;
+
+ALTER TABLE wdiet.login_challenges
+    DROP CONSTRAINT user_uuid_fk,
+    ADD CONSTRAINT user_uuid_fk FOREIGN KEY (user_uuid) REFERENCES wdiet.users ON DELETE CASCADE;
+
+ALTER TABLE wdiet.user_identities
+    DROP CONSTRAINT user_uuid_fk,
+    ADD CONSTRAINT user_uuid_fk FOREIGN KEY (user_uuid) REFERENCES wdiet.users ON DELETE CASCADE;
+
+ALTER TABLE wdiet.recipe_ingredients
+    DROP CONSTRAINT recipe_uuid_fk,
+    ADD CONSTRAINT recipe_uuid_fk FOREIGN KEY (recipe_uuid) REFERENCES wdiet.recipes ON DELETE CASCADE;
+
+ALTER TABLE wdiet.recipe_instructions
+    DROP CONSTRAINT recipe_uuid_fk,
+    ADD CONSTRAINT recipe_uuid_fk FOREIGN KEY (recipe_uuid) REFERENCES wdiet.recipes ON DELETE CASCADE;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE wdiet.recipe_ingredients
+    DROP CONSTRAINT recipe_uuid_fk,
+    ADD CONSTRAINT recipe_uuid_fk FOREIGN KEY (recipe_uuid) REFERENCES wdiet.recipes;
+
+ALTER TABLE wdiet.recipe_instructions
+    DROP CONSTRAINT recipe_uuid_fk,
+    ADD CONSTRAINT recipe_uuid_fk FOREIGN KEY (recipe_uuid) REFERENCES wdiet.recipes;
+
+ALTER TABLE wdiet.fridge_ingredients
+    DROP CONSTRAINT user_uuid_fk,
+    ADD CONSTRAINT user_uuid_fk FOREIGN KEY (user_uuid) REFERENCES wdiet.users;
+
+ALTER TABLE wdiet.recipes
+    DROP CONSTRAINT user_uuid_fk,
+    ADD CONSTRAINT user_uuid_fk FOREIGN KEY (user_uuid) REFERENCES wdiet.users;
+
+ALTER TABLE wdiet.refresh_tokens
+    DROP CONSTRAINT user_uuid_fk,
+    ADD CONSTRAINT user_uuid_fk FOREIGN KEY (user_uuid) REFERENCES wdiet.users;
+
+ALTER TABLE wdiet.password_reset_tokens
+    DROP CONSTRAINT user_uuid_fk,
+    ADD CONSTRAINT user_uuid_fk FOREIGN KEY (user_uuid) REFERENCES wdiet.users;
+
+ALTER TABLE wdiet.email_verification_tokens
+    DROP CONSTRAINT user_uuid_fk,
+    ADD CONSTRAINT user_uuid_fk FOREIGN KEY (user_uuid) REFERENCES wdiet.users;
+
+ALTER TABLE wdiet.personal_access_tokens
+    DROP CONSTRAINT user_uuid_fk,
+    ADD CONSTRAINT user_uuid_fk FOREIGN KEY (user_uuid) REFERENCES wdiet.users;
+
+ALTER TABLE wdiet.user_totp
+    DROP CONSTRAINT user_uuid_fk,
+    ADD CONSTRAINT user_uuid_fk FOREIGN KEY (user_uuid) REFERENCES wdiet.users;
+
+ALTER TABLE wdiet.recovery_codes
+    DROP CONSTRAINT user_uuid_fk,
+    ADD CONSTRAINT user_uuid_fk FOREIGN KEY (user_uuid) REFERENCES wdiet.users;
+
+ALTER TABLE wdiet.login_challenges
+    DROP CONSTRAINT user_uuid_fk,
+    ADD CONSTRAINT user_uuid_fk FOREIGN KEY (user_uuid) REFERENCES wdiet.users;
+
+ALTER TABLE wdiet.user_identities
+    DROP CONSTRAINT user_uuid_fk,
+    ADD CONSTRAINT user_uuid_fk FOREIGN KEY (user_uuid) REFERENCES wdiet.users;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE wdiet.users
+    DROP COLUMN IF EXISTS delete_after;
+-- +goose StatementEnd
@@ -0,0 +1,124 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS wdiet.households --a shared fridge and the people sharing it
+(
+    household_uuid uuid not null default gen_random_uuid()
+        constraint households_primary_key
+            primary key,
+    household_name         varchar(64)     not null,
+    created_at             timestamp       not null default now(),
+    updated_at             timestamp       not null default now()
+);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS wdiet.household_members
+(
+    household_uuid         uuid            not null
+        constraint household_uuid_fk references wdiet.households ON DELETE CASCADE,
+    user_uuid              uuid            not null
+        constraint user_uuid_fk references wdiet.users ON DELETE CASCADE,
+    role                   varchar(16)     not null
+        constraint household_members_role_check check (role IN ('owner', 'member', 'viewer')),
+    created_at             timestamp       not null default now(),
+    PRIMARY KEY (household_uuid, user_uuid)
+);
+
+CREATE INDEX ON wdiet.household_members (user_uuid);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS wdiet.household_invitations
+(
+    household_invitation_uuid uuid not null default gen_random_uuid()
+        constraint household_invitations_primary_key
+            primary key,
+    household_uuid         uuid            not null
+        constraint household_uuid_fk references wdiet.households ON DELETE CASCADE,
+    email_address          varchar(128)    not null, --only this address can accept it
+    role                   varchar(16)     not null
+        constraint household_invitations_role_check check (role IN ('member', 'viewer')),
+    hashed_token           varchar(128)    not null UNIQUE,
+    invited_by             uuid
+        constraint invited_by_fk references wdiet.users ON DELETE SET NULL,
+    expires_at             timestamp       not null,
+    accepted_at            timestamp,
+    created_at             timestamp       not null default now()
+);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE wdiet.users
+    ADD COLUMN IF NOT EXISTS active_household_uuid uuid --whose fridge the fridge routes work on
+        constraint active_household_uuid_fk references wdiet.households ON DELETE SET NULL;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+-- everybody gets a household of their own with their fridge in it. it gets the user's uuid so we don't need a mapping
+-- to move the fridges over, nothing else relies on the two being equal.
+INSERT INTO wdiet.households (household_uuid, household_name, created_at)
+    SELECT user_uuid, left(first_name || '''s household', 64), created_at FROM wdiet.users;
+
+INSERT INTO wdiet.household_members (household_uuid, user_uuid, role, created_at)
+    SELECT user_uuid, user_uuid, 'owner', created_at FROM wdiet.users;
+
+UPDATE wdiet.users SET active_household_uuid = user_uuid;
+
+ALTER TABLE wdiet.fridge_ingredients
+    ADD COLUMN IF NOT EXISTS household_uuid uuid;
+
+UPDATE wdiet.fridge_ingredients SET household_uuid = user_uuid;
+
+-- user_uuid stays as who put it in, the fridge belongs to the household now
+ALTER TABLE wdiet.fridge_ingredients
+    ALTER COLUMN household_uuid SET NOT NULL,
+    ADD CONSTRAINT household_uuid_fk FOREIGN KEY (household_uuid) REFERENCES wdiet.households ON DELETE CASCADE,
+    DROP CONSTRAINT fridge_ingredients_pkey,
+    ADD PRIMARY KEY (household_uuid, ingredient_uuid),
+    ALTER COLUMN user_uuid DROP NOT NULL,
+    DROP CONSTRAINT user_uuid_fk,
+    ADD CONSTRAINT user_uuid_fk FOREIGN KEY (user_uuid) REFERENCES wdiet.users ON DELETE SET NULL;
+
+CREATE INDEX ON wdiet.fridge_ingredients (user_uuid);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+-- back to one fridge per user: every item goes to whoever put it in. items of deleted users are lost, and if somebody
+-- put the same ingredient in two households only the newer one survives.
+DELETE FROM wdiet.fridge_ingredients WHERE user_uuid IS NULL;
+
+DELETE FROM wdiet.fridge_ingredients a
+    USING wdiet.fridge_ingredients b
+    WHERE a.user_uuid = b.user_uuid
+        AND a.ingredient_uuid = b.ingredient_uuid
+        AND a.household_uuid <> b.household_uuid
+        AND (a.updated_at, a.household_uuid) < (b.updated_at, b.household_uuid);
+
+ALTER TABLE wdiet.fridge_ingredients
+    DROP CONSTRAINT user_uuid_fk,
+    ADD CONSTRAINT user_uuid_fk FOREIGN KEY (user_uuid) REFERENCES wdiet.users ON DELETE CASCADE,
+    ALTER COLUMN user_uuid SET NOT NULL,
+    DROP CONSTRAINT fridge_ingredients_pkey,
+    ADD PRIMARY KEY (user_uuid, ingredient_uuid),
+    DROP CONSTRAINT household_uuid_fk,
+    DROP COLUMN household_uuid;
+
+DROP INDEX IF EXISTS wdiet.fridge_ingredients_user_uuid_idx;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE wdiet.users DROP COLUMN IF EXISTS active_household_uuid;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+DROP TABLE IF EXISTS wdiet.household_invitations;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+DROP TABLE IF EXISTS wdiet.household_members;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+DROP TABLE IF EXISTS wdiet.households;
+-- +goose StatementEnd
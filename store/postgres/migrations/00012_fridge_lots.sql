@@ -0,0 +1,31 @@
+-- +goose Up
+-- +goose StatementBegin
+-- every row is a lot now, so the same ingredient can be in the fridge more than once with its own amount and dates.
+-- existing rows keep everything and get a uuid of their own.
+ALTER TABLE wdiet.fridge_ingredients
+    ADD COLUMN IF NOT EXISTS fridge_item_uuid uuid not null default gen_random_uuid();
+
+ALTER TABLE wdiet.fridge_ingredients
+    DROP CONSTRAINT fridge_ingredients_pkey,
+    ADD CONSTRAINT fridge_ingredients_primary_key PRIMARY KEY (fridge_item_uuid);
+
+CREATE INDEX fridge_ingredients_lots_idx ON wdiet.fridge_ingredients (household_uuid, ingredient_uuid, expiration_date);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+-- back to one row per ingredient in a household. only the lot that expires last survives, the other lots are lost.
+DELETE FROM wdiet.fridge_ingredients a
+    USING wdiet.fridge_ingredients b
+    WHERE a.household_uuid = b.household_uuid
+        AND a.ingredient_uuid = b.ingredient_uuid
+        AND a.fridge_item_uuid <> b.fridge_item_uuid
+        AND (a.expiration_date, a.fridge_item_uuid) < (b.expiration_date, b.fridge_item_uuid);
+
+DROP INDEX IF EXISTS wdiet.fridge_ingredients_lots_idx;
+
+ALTER TABLE wdiet.fridge_ingredients
+    DROP CONSTRAINT fridge_ingredients_primary_key,
+    ADD PRIMARY KEY (household_uuid, ingredient_uuid),
+    DROP COLUMN fridge_item_uuid;
+-- +goose StatementEnd
@@ -0,0 +1,26 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS wdiet.cook_logs --every time somebody cooked a recipe out of a household's fridge
+(
+    cook_log_uuid uuid not null default gen_random_uuid()
+        constraint cook_logs_primary_key
+            primary key,
+    household_uuid         uuid            not null
+        constraint household_uuid_fk references wdiet.households ON DELETE CASCADE,
+    user_uuid              uuid
+        constraint user_uuid_fk references wdiet.users ON DELETE SET NULL, --who cooked
+    recipe_uuid            uuid
+        constraint recipe_uuid_fk references wdiet.recipes ON DELETE SET NULL,
+    recipe_name            varchar(64)     not null, --as it was when it got cooked, the recipe can change or go away
+    servings               numeric         not null,
+    created_at             timestamp       not null default now()
+);
+
+CREATE INDEX ON wdiet.cook_logs (household_uuid, created_at);
+CREATE INDEX ON wdiet.cook_logs (user_uuid);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS wdiet.cook_logs;
+-- +goose StatementEnd
@@ -0,0 +1,42 @@
+-- +goose Up
+-- +goose StatementBegin
+-- g per ml, so a cup of flour can be weighed. null if we don't know it.
+ALTER TABLE wdiet.ingredients
+    ADD COLUMN IF NOT EXISTS density numeric CHECK (density > 0);
+
+-- units were free text until now, the ones people wrote most get their canonical symbol from the units package.
+-- symbols in another case ("L", "KG") get lowercased. anything else stays as it is, it still goes with the exact same text.
+CREATE TEMPORARY TABLE unit_aliases (alias varchar(64) PRIMARY KEY, symbol varchar(64) not null) ON COMMIT DROP;
+
+INSERT INTO unit_aliases VALUES
+    ('g', 'g'), ('kg', 'kg'), ('mg', 'mg'), ('oz', 'oz'), ('lb', 'lb'),
+    ('ml', 'ml'), ('l', 'l'), ('tsp', 'tsp'), ('tbsp', 'tbsp'), ('cup', 'cup'), ('pc', 'pc'),
+    ('gram', 'g'), ('grams', 'g'), ('gr', 'g'), ('gm', 'g'),
+    ('kgs', 'kg'), ('kilo', 'kg'), ('kilos', 'kg'), ('kilogram', 'kg'), ('kilograms', 'kg'),
+    ('milligram', 'mg'), ('milligrams', 'mg'),
+    ('ounce', 'oz'), ('ounces', 'oz'),
+    ('lbs', 'lb'), ('pound', 'lb'), ('pounds', 'lb'),
+    ('milliliter', 'ml'), ('milliliters', 'ml'), ('millilitre', 'ml'), ('millilitres', 'ml'),
+    ('ltr', 'l'), ('liter', 'l'), ('liters', 'l'), ('litre', 'l'), ('litres', 'l'),
+    ('teaspoon', 'tsp'), ('teaspoons', 'tsp'),
+    ('tbs', 'tbsp'), ('tablespoon', 'tbsp'), ('tablespoons', 'tbsp'),
+    ('cups', 'cup'),
+    ('pcs', 'pc'), ('piece', 'pc'), ('pieces', 'pc'), ('ea', 'pc'), ('each', 'pc'), ('unit', 'pc'), ('units', 'pc');
+
+UPDATE wdiet.fridge_ingredients f
+    SET unit = a.symbol
+    FROM unit_aliases a
+    WHERE a.alias = lower(trim(f.unit)) AND f.unit <> a.symbol;
+
+UPDATE wdiet.recipe_ingredients r
+    SET unit = a.symbol
+    FROM unit_aliases a
+    WHERE a.alias = lower(trim(r.unit)) AND r.unit <> a.symbol;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+-- the units keep their canonical symbols, they were the same units before too.
+ALTER TABLE wdiet.ingredients
+    DROP COLUMN IF EXISTS density;
+-- +goose StatementEnd
@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+-- amounts can be 0.5 kg or 1/3 cup now. 4 decimals, whole numbers fit as they are so nothing changes for them.
+ALTER TABLE wdiet.fridge_ingredients
+    ALTER COLUMN amount TYPE numeric(14, 4) USING amount::numeric(14, 4);
+
+ALTER TABLE wdiet.recipe_ingredients
+    ALTER COLUMN amount TYPE numeric(14, 4) USING amount::numeric(14, 4);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+-- fractions get rounded up to the next whole number, so half an onion is still there after going back.
+ALTER TABLE wdiet.fridge_ingredients
+    ALTER COLUMN amount TYPE integer USING ceil(amount)::integer;
+
+ALTER TABLE wdiet.recipe_ingredients
+    ALTER COLUMN amount TYPE integer USING ceil(amount)::integer;
+-- +goose StatementEnd
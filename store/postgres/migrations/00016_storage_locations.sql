@@ -0,0 +1,26 @@
+-- +goose Up
+-- +goose StatementBegin
+-- days_until_exp is how long it keeps in the fridge. the others are null if we don't know them, see the shelflife package.
+ALTER TABLE wdiet.ingredients
+    ADD COLUMN IF NOT EXISTS freezer_days integer CHECK (freezer_days > 0),
+    ADD COLUMN IF NOT EXISTS pantry_days integer CHECK (pantry_days > 0),
+    ADD COLUMN IF NOT EXISTS opened_days integer CHECK (opened_days > 0);
+
+-- everything that's there already is in the fridge and unopened, so the expiration dates stay right.
+ALTER TABLE wdiet.fridge_ingredients
+    ADD COLUMN IF NOT EXISTS location varchar(16) not null default 'fridge' CHECK (location IN ('fridge', 'freezer', 'pantry')),
+    ADD COLUMN IF NOT EXISTS opened_date timestamp;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+-- whatever's in the freezer or the pantry keeps the expiration date it got there.
+ALTER TABLE wdiet.fridge_ingredients
+    DROP COLUMN IF EXISTS opened_date,
+    DROP COLUMN IF EXISTS location;
+
+ALTER TABLE wdiet.ingredients
+    DROP COLUMN IF EXISTS opened_days,
+    DROP COLUMN IF EXISTS pantry_days,
+    DROP COLUMN IF EXISTS freezer_days;
+-- +goose StatementEnd
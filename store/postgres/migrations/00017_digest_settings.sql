@@ -0,0 +1,26 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS wdiet.digest_settings --when and how a user gets the daily mail of what's about to go off, no row is no digest
+(
+    user_uuid              uuid            not null
+        constraint digest_settings_primary_key
+            primary key
+        constraint user_uuid_fk references wdiet.users ON DELETE CASCADE,
+    enabled                boolean         not null default false,
+    digest_minute          smallint        not null default 480 CHECK (digest_minute >= 0 AND digest_minute < 1440), --minutes after midnight in timezone
+    timezone               varchar(64)     not null default 'UTC', --IANA name, Asia/Seoul
+    channel                varchar(16)     not null default 'email',
+    webhook_url            varchar(2048),
+    within_days            smallint        not null default 3 CHECK (within_days > 0),
+    last_sent_on           date, --the user's local date the last digest was for, so every day gets one at most
+    created_at             timestamp       not null default now(),
+    updated_at             timestamp       not null default now()
+);
+
+CREATE INDEX ON wdiet.digest_settings (user_uuid) WHERE enabled;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS wdiet.digest_settings;
+-- +goose StatementEnd
@@ -0,0 +1,31 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS wdiet.fridge_events --every lot deleted from a household's fridge and why, so what we throw out isn't lost with it
+(
+    fridge_event_uuid uuid not null default gen_random_uuid()
+        constraint fridge_events_primary_key
+            primary key,
+    household_uuid         uuid            not null
+        constraint household_uuid_fk references wdiet.households ON DELETE CASCADE,
+    user_uuid              uuid
+        constraint user_uuid_fk references wdiet.users ON DELETE SET NULL, --who deleted it
+    fridge_item_uuid       uuid            not null, --the lot's gone, so no fk
+    ingredient_uuid        uuid
+        constraint ingredient_uuid_fk references wdiet.ingredients ON DELETE SET NULL,
+    ingredient_name        varchar(64)     not null, --as it was when it got deleted, like cook_logs.recipe_name
+    category               varchar(64)     not null,
+    amount                 numeric(14, 4)  not null, --what was left of the lot
+    unit                   varchar(64)     not null,
+    reason                 varchar(16)     not null CHECK (reason IN ('consumed', 'expired', 'discarded', 'given_away')),
+    estimated_cost         numeric(14, 4)  CHECK (estimated_cost >= 0), --null if they didn't say
+    created_at             timestamp       not null default now()
+);
+
+CREATE INDEX ON wdiet.fridge_events (household_uuid, created_at);
+CREATE INDEX ON wdiet.fridge_events (user_uuid);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS wdiet.fridge_events;
+-- +goose StatementEnd
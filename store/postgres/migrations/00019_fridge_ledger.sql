@@ -0,0 +1,42 @@
+-- +goose Up
+-- +goose StatementBegin
+-- fridge_events is the ledger now: every add, update, move, open, consume and delete, with the lot as it is after it.
+-- fridge_ingredients is what replaying it gets, kept up to date in the same transaction and rebuilt with wdietctl rebuild-fridge.
+-- event_seq is the order they happened in, created_at can be the same for several in one transaction.
+-- the deletes already here are from before, we don't know the dates of those lots so they stay null.
+ALTER TABLE wdiet.fridge_events
+    ADD COLUMN IF NOT EXISTS event_seq bigserial not null UNIQUE,
+    ADD COLUMN IF NOT EXISTS event_type varchar(16) not null default 'delete' CHECK (event_type IN ('add', 'update', 'move', 'open', 'consume', 'delete')),
+    ADD COLUMN IF NOT EXISTS purchased_date timestamp,
+    ADD COLUMN IF NOT EXISTS expiration_date timestamp,
+    ADD COLUMN IF NOT EXISTS location varchar(16),
+    ADD COLUMN IF NOT EXISTS opened_date timestamp,
+    ALTER COLUMN reason DROP NOT NULL;
+
+ALTER TABLE wdiet.fridge_events
+    ALTER COLUMN event_type DROP DEFAULT,
+    ADD CONSTRAINT fridge_events_reason_check CHECK ((event_type = 'delete') = (reason IS NOT NULL)); --only deletes have a reason
+
+-- what's in the fridge already gets added when it was put there. we don't know how it changed since, so it's as it is now.
+INSERT INTO wdiet.fridge_events (event_type, household_uuid, user_uuid, fridge_item_uuid, ingredient_uuid, ingredient_name, category, amount, unit, purchased_date, expiration_date, location, opened_date, created_at)
+    SELECT  'add', f.household_uuid, f.user_uuid, f.fridge_item_uuid, f.ingredient_uuid, i.ingredient_name, i.category, f.amount, f.unit, f.purchased_date, f.expiration_date, f.location, f.opened_date, f.created_at
+    FROM    wdiet.fridge_ingredients f
+    JOIN    wdiet.ingredients i ON i.ingredient_uuid = f.ingredient_uuid
+    ORDER BY f.created_at, f.fridge_item_uuid;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+-- back to only the deletes, the rest of the history is lost. fridge_ingredients doesn't change.
+DELETE FROM wdiet.fridge_events WHERE event_type <> 'delete';
+
+ALTER TABLE wdiet.fridge_events
+    DROP CONSTRAINT IF EXISTS fridge_events_reason_check,
+    ALTER COLUMN reason SET NOT NULL,
+    DROP COLUMN IF EXISTS opened_date,
+    DROP COLUMN IF EXISTS location,
+    DROP COLUMN IF EXISTS expiration_date,
+    DROP COLUMN IF EXISTS purchased_date,
+    DROP COLUMN IF EXISTS event_type,
+    DROP COLUMN IF EXISTS event_seq;
+-- +goose StatementEnd
@@ -4,9 +4,11 @@ const sqlGetUser = `
 	SELECT 	user_uuid,
 			hashed_password,
 			active,
+			role,
 			first_name,
 			last_name,
 			email_address,
+			email_verified_at,
 			created_at,
 			updated_at
 	
@@ -22,9 +24,11 @@ const sqlGetUserByEmail = `
 	SELECT 	user_uuid,
 			hashed_password,
 			active,
+			role,
 			first_name,
 			last_name,
 			email_address,
+			email_verified_at,
 			created_at,
 			updated_at
 	
@@ -51,20 +55,119 @@ const sqlCreateUser = `
 		$4,
 		$5
 	)
-	RETURNING user_uuid, hashed_password, active, first_name, last_name, email_address, created_at, updated_at
+	RETURNING user_uuid, hashed_password, active, role, first_name, last_name, email_address, email_verified_at, created_at, updated_at
 	;
 `
 
+// email 바꾸면 다시 인증 받아야 함.
 const sqlUpdateUser = `
+	UPDATE wdiet.users
+		SET 
+			first_name = $1,
+			last_name = $2,
+			email_verified_at = CASE WHEN email_address = $3 THEN email_verified_at ELSE NULL END,
+			email_address = $3,
+			updated_at = now()
+	WHERE user_uuid = $4
+	RETURNING user_uuid, hashed_password, active, role, first_name, last_name, email_address, email_verified_at, created_at, updated_at
+	;
+`
+
+// active는 deactivate/reactivate으로만 바뀜. UpdateUser에서 active 빼먹으면 계정이 잠겨버렸었음.
+// 다시 활성화하면 삭제 예약도 취소됨.
+const sqlSetUserActive = `
 	UPDATE wdiet.users
 		SET 
 			active = $1,
-			first_name = $2,
-			last_name = $3,
-			email_address = $4,
+			delete_after = CASE WHEN $1 THEN NULL ELSE delete_after END,
+			updated_at = now()
+	WHERE user_uuid = $2
+	RETURNING user_uuid, hashed_password, active, role, first_name, last_name, email_address, email_verified_at, created_at, updated_at
+	;
+`
+
+// 비활성화 + 삭제 예약. 유예기간 안에 reactivate 하면 취소.
+const sqlRequestUserDeletion = `
+	UPDATE wdiet.users
+		SET 
+			active = false,
+			delete_after = $2,
+			updated_at = now()
+	WHERE user_uuid = $1
+	;
+`
+
+const sqlListUsersDueForDeletion = `
+	SELECT 	user_uuid
+
+	FROM 	wdiet.users
+
+	WHERE	delete_after IS NOT NULL AND delete_after <= $1 AND active = false
+	;
+`
+
+// 나머지는 ON DELETE CASCADE로 같이 지워짐. 이메일은 login_attempts, lockout_events 지울 때 씀.
+const sqlDeleteUser = `
+	DELETE 
+		FROM wdiet.users
+
+	WHERE user_uuid = $1
+	RETURNING email_address
+	;
+`
+
+// lockout 패키지의 key 형식("account:<email>")을 따라야 함.
+const sqlDeleteUserLoginAttempts = `
+	DELETE 
+		FROM wdiet.login_attempts
+
+	WHERE attempt_key = 'account:' || lower(trim($1))
+	;
+`
+
+const sqlDeleteUserLockoutEvents = `
+	DELETE 
+		FROM wdiet.lockout_events
+
+	WHERE scope = 'account' AND subject = lower(trim($1))
+	;
+`
+
+// role도 active처럼 따로. UpdateUser로 자기 자신을 admin으로 만들면 안 되니까.
+const sqlSetUserRole = `
+	UPDATE wdiet.users
+		SET 
+			role = $1,
+			updated_at = now()
+	WHERE user_uuid = $2
+	RETURNING user_uuid, hashed_password, active, role, first_name, last_name, email_address, email_verified_at, created_at, updated_at
+	;
+`
+
+const sqlGetUserStatus = `
+	SELECT 	active,
+			email_verified_at IS NOT NULL,
+			role
+	FROM 	wdiet.users
+	WHERE 	user_uuid = $1
+	;
+`
+
+const sqlChangePassword = `
+	UPDATE wdiet.users
+		SET 
+			hashed_password = $1,
 			updated_at = now()
-	WHERE user_uuid = $5
-	RETURNING user_uuid, hashed_password, active, first_name, last_name, email_address, created_at, updated_at
+	WHERE user_uuid = $2
+	;
+`
+
+// 같은 비밀번호의 hash만 바꾸는 거라 refresh token은 건드리지 않음. old hash가 그대로일 때만 바꿈.
+const sqlUpdatePasswordHash = `
+	UPDATE wdiet.users
+		SET 
+			hashed_password = $1
+	WHERE user_uuid = $2 AND hashed_password = $3
 	;
 `
 
@@ -73,6 +176,10 @@ const sqlGetIngredient = `
 			ingredient_name,
 			category,
 			days_until_exp,
+			freezer_days,
+			pantry_days,
+			opened_days,
+			density,
 			created_at,
 			updated_at
 	
@@ -89,6 +196,10 @@ const sqlsearchIngredients = `
 			ingredient_name,
 			category,
 			days_until_exp,
+			freezer_days,
+			pantry_days,
+			opened_days,
+			density,
 			created_at,
 			updated_at
 
@@ -99,14 +210,22 @@ const sqlCreateIngredient = `
 	INSERT INTO wdiet.ingredients(
 		ingredient_name,
 		category,
-		days_until_exp
+		days_until_exp,
+		freezer_days,
+		pantry_days,
+		opened_days,
+		density
 	)
 	VALUES(
 		$1,
 		$2,
-		$3
+		$3,
+		$4,
+		$5,
+		$6,
+		$7
 	)
-	RETURNING ingredient_uuid, ingredient_name, category, days_until_exp, created_at, updated_at
+	RETURNING ingredient_uuid, ingredient_name, category, days_until_exp, freezer_days, pantry_days, opened_days, density, created_at, updated_at
 	;
 `
 
@@ -116,9 +235,13 @@ const sqlUpdateIngredient = `
 			ingredient_name = $1,
 			category = $2,
 			days_until_exp = $3,
+			freezer_days = $4,
+			pantry_days = $5,
+			opened_days = $6,
+			density = $7,
 			updated_at = now()
-	WHERE ingredient_uuid = $4
-	RETURNING ingredient_uuid, ingredient_name, category, days_until_exp, created_at, updated_at
+	WHERE ingredient_uuid = $8
+	RETURNING ingredient_uuid, ingredient_name, category, days_until_exp, freezer_days, pantry_days, opened_days, density, created_at, updated_at
 	;
 `
 
@@ -130,30 +253,41 @@ const sqlDeleteIngredient = `
 	;
 `
 
+// oldest expiry first inside an ingredient, so the lots of one ingredient come out next to each other.
 const sqlListFridgeIngredients = `
-	SELECT 	user_uuid,
+	SELECT 	fridge_item_uuid,
+			household_uuid,
+			user_uuid,
 			ingredient_uuid,
 			amount,
 			unit,
 			purchased_date,
 			expiration_date,
+			location,
+			opened_date,
 			created_at,
 			updated_at
 	
 	FROM 	wdiet.fridge_ingredients
 	
-	WHERE	user_uuid = $1
+	WHERE	household_uuid = $1
+
+	ORDER BY ingredient_uuid, expiration_date, fridge_item_uuid
 	;
 `
 
+// user_uuid는 누가 넣었는지. fridge 주인은 household.
 const sqlCreateFridgeIngredient = `
 	INSERT INTO wdiet.fridge_ingredients(
+				household_uuid,
 				user_uuid,
 				ingredient_uuid,
 				amount,
 				unit,
 				purchased_date,
-				expiration_date
+				expiration_date,
+				location,
+				opened_date
 	)
 	VALUES(
 		$1,
@@ -161,9 +295,12 @@ const sqlCreateFridgeIngredient = `
 		$3,
 		$4,
 		$5,
-		$6
+		$6,
+		$7,
+		$8,
+		$9
 	)
-	RETURNING user_uuid, ingredient_uuid, amount, unit, purchased_date, expiration_date, created_at, updated_at
+	RETURNING fridge_item_uuid, household_uuid, user_uuid, ingredient_uuid, amount, unit, purchased_date, expiration_date, location, opened_date, created_at, updated_at
 	;
 `
 
@@ -173,9 +310,59 @@ const sqlUpdateFridgeIngredient = `
 			amount = $1,
 			unit = $2,
 			purchased_date = $3,
+			expiration_date = $4,
+			location = $5,
+			opened_date = $6,
+			updated_at = now()
+	WHERE household_uuid = $7 AND fridge_item_uuid = $8 AND ingredient_uuid = $9
+	RETURNING fridge_item_uuid, household_uuid, user_uuid, ingredient_uuid, amount, unit, purchased_date, expiration_date, location, opened_date, created_at, updated_at
+	;
+`
+
+const sqlGetFridgeIngredient = `
+	SELECT 	fridge_item_uuid,
+			household_uuid,
+			user_uuid,
+			ingredient_uuid,
+			amount,
+			unit,
+			purchased_date,
+			expiration_date,
+			location,
+			opened_date,
+			created_at,
+			updated_at
+	
+	FROM 	wdiet.fridge_ingredients
+	
+	WHERE	household_uuid = $1 AND fridge_item_uuid = $2
+	;
+`
+
+// 옮기거나 열기 전에 잠그고, service가 계산할 때 본 거랑 같은지 확인. 동시에 두 번 열거나 열면서 옮기면 하나는 conflict.
+const sqlLockFridgeLotStorage = `
+	SELECT 	location,
+			opened_date,
+			expiration_date
+
+	FROM 	wdiet.fridge_ingredients
+
+	WHERE	household_uuid = $1 AND fridge_item_uuid = $2
+
+	FOR UPDATE
+	;
+`
+
+// 옮기거나 열었을 때. amount는 안 건드리니까 그 사이에 consume해도 괜찮음.
+const sqlSetFridgeIngredientStorage = `
+	UPDATE wdiet.fridge_ingredients
+		SET 
+			location = $1,
+			opened_date = $2,
+			expiration_date = $3,
 			updated_at = now()
-	WHERE user_uuid = $4 AND ingredient_uuid = $5
-	RETURNING user_uuid, ingredient_uuid, amount, unit, purchased_date, expiration_date, created_at, updated_at
+	WHERE household_uuid = $4 AND fridge_item_uuid = $5
+	RETURNING fridge_item_uuid, household_uuid, user_uuid, ingredient_uuid, amount, unit, purchased_date, expiration_date, location, opened_date, created_at, updated_at
 	;
 `
 
@@ -183,154 +370,1467 @@ const sqlDeleteFridgeIngredient = `
 	DELETE 
 		FROM wdiet.fridge_ingredients
 
-	WHERE user_uuid = $1 AND ingredient_uuid = $2
+	WHERE household_uuid = $1 AND fridge_item_uuid = $2
+	RETURNING fridge_item_uuid, household_uuid, user_uuid, ingredient_uuid, amount, unit, purchased_date, expiration_date, location, opened_date, created_at, updated_at
 	;
 `
-const sqlGetRecipe = `
-	SELECT 	recipe_uuid,
-			user_uuid,
-			recipe_name,
-			category,
-			created_at,
-			updated_at
-	
-	FROM 	wdiet.recipes
-	
-	WHERE	recipe_uuid = $1
 
-	LIMIT 1
+// fridge_ingredients를 바꿀 때마다 같은 transaction에서 남기는 event. 재료 이름이랑 카테고리는 그때 그대로 복사해둠, 재료가 바뀌거나 지워져도 통계가 안 바뀌게.
+// created_at은 now()라서 lot의 updated_at이랑 똑같음. 그래야 rebuild해도 그대로 나옴.
+const sqlCreateFridgeEvent = `
+	INSERT INTO wdiet.fridge_events(
+				event_type,
+				household_uuid,
+				user_uuid,
+				fridge_item_uuid,
+				ingredient_uuid,
+				ingredient_name,
+				category,
+				amount,
+				unit,
+				purchased_date,
+				expiration_date,
+				location,
+				opened_date,
+				reason,
+				estimated_cost
+	)
+	VALUES(
+		$1,
+		$2,
+		$3,
+		$4,
+		$5,
+		(SELECT ingredient_name FROM wdiet.ingredients WHERE ingredient_uuid = $5),
+		(SELECT category FROM wdiet.ingredients WHERE ingredient_uuid = $5),
+		$6,
+		$7,
+		$8,
+		$9,
+		$10,
+		$11,
+		$12,
+		$13
+	)
 	;
 `
 
-// recipe 하나당 여러 recipe ingredient이므로 얘는 필연적으로 list recipe ingredients임,, 하나의 recipe ingredient만 불러오는건 의미 ㄴ
-const sqlListRecipeIngr = ` 
-	SELECT 	recipe_uuid,
+// fridge_events 순서는 created_at이 아니라 event_seq. 한 transaction 안에서는 created_at이 다 똑같아서.
+const sqlListFridgeEvents = `
+	SELECT 	fridge_event_uuid,
+			event_type,
+			household_uuid,
+			user_uuid,
+			fridge_item_uuid,
 			ingredient_uuid,
+			ingredient_name,
+			category,
 			amount,
-			unit
-	
-	FROM 	wdiet.recipe_ingredients
-	
-	WHERE	recipe_uuid = $1
-	;
+			unit,
+			purchased_date,
+			expiration_date,
+			location,
+			opened_date,
+			reason,
+			estimated_cost,
+			created_at
 
-`
-const sqlListRecipeInst = `
-	SELECT 	recipe_uuid,
-			step_num,
-			instruction
-	
-	FROM 	wdiet.recipe_instructions
-	
-	WHERE	recipe_uuid = $1
+	FROM 	wdiet.fridge_events
+
+	WHERE	household_uuid = $1 AND created_at >= $2 AND created_at < $3
+
+	ORDER BY event_seq
 	;
 `
 
-const sqlListRecipes = `
-	SELECT 	recipe_uuid,
+// export용. 지금은 아닌 household에서 한 것도 다.
+const sqlListUserFridgeEvents = `
+	SELECT 	fridge_event_uuid,
+			event_type,
+			household_uuid,
 			user_uuid,
-			recipe_name,
+			fridge_item_uuid,
+			ingredient_uuid,
+			ingredient_name,
 			category,
-			created_at,
-			updated_at
-	
-	FROM 	wdiet.recipes
-	
+			amount,
+			unit,
+			purchased_date,
+			expiration_date,
+			location,
+			opened_date,
+			reason,
+			estimated_cost,
+			created_at
+
+	FROM 	wdiet.fridge_events
+
 	WHERE	user_uuid = $1
+
+	ORDER BY event_seq
 	;
 `
 
-const sqlsearchRecipes = `
-	SELECT 	recipe_uuid,
+// rebuild할 때만 씀. 다 가져와서 service랑 똑같이 store.ReplayFridgeEvents로 다시 만듦.
+const sqlListAllFridgeEvents = `
+	SELECT 	fridge_event_uuid,
+			event_type,
+			household_uuid,
 			user_uuid,
-			recipe_name,
+			fridge_item_uuid,
+			ingredient_uuid,
+			ingredient_name,
 			category,
+			amount,
+			unit,
+			purchased_date,
+			expiration_date,
+			location,
+			opened_date,
+			reason,
+			estimated_cost,
+			created_at
+
+	FROM 	wdiet.fridge_events
+
+	ORDER BY event_seq
+	;
+`
+
+// rebuild하는 동안 아무도 fridge를 못 바꾸게. 읽는 건 괜찮음.
+const sqlLockFridgeLedger = `
+	LOCK TABLE wdiet.fridge_events, wdiet.fridge_ingredients IN EXCLUSIVE MODE
+	;
+`
+
+const sqlListAllFridgeIngredients = `
+	SELECT 	fridge_item_uuid,
+			household_uuid,
+			user_uuid,
+			ingredient_uuid,
+			amount,
+			unit,
+			purchased_date,
+			expiration_date,
+			location,
+			opened_date,
 			created_at,
 			updated_at
-
-	FROM wdiet.recipes
+	
+	FROM 	wdiet.fridge_ingredients
+	;
 `
 
-const sqlCreateRecipe = `
-	INSERT INTO wdiet.recipes(
-		user_uuid,
-		recipe_name,
-		category
-	)
-	VALUES(
-		$1,
-		$2,
-		$3
-	)
-	RETURNING recipe_uuid, user_uuid, recipe_name, category, created_at, updated_at
+const sqlDeleteAllFridgeIngredients = `
+	DELETE 
+		FROM wdiet.fridge_ingredients
 	;
 `
 
-const sqlCreateRecipeIngr = `
-	INSERT INTO wdiet.recipe_ingredients(
-		recipe_uuid,
-		ingredient_uuid,
-		amount,
-		unit
+// rebuild한 lot을 그대로 넣음. created_at, updated_at도 event에서 나온 그대로.
+const sqlRestoreFridgeIngredient = `
+	INSERT INTO wdiet.fridge_ingredients(
+				fridge_item_uuid,
+				household_uuid,
+				user_uuid,
+				ingredient_uuid,
+				amount,
+				unit,
+				purchased_date,
+				expiration_date,
+				location,
+				opened_date,
+				created_at,
+				updated_at
 	)
 	VALUES(
 		$1,
 		$2,
 		$3,
-		$4
+		$4,
+		$5,
+		$6,
+		$7,
+		$8,
+		$9,
+		$10,
+		$11,
+		$12
 	)
-	RETURNING recipe_uuid, ingredient_uuid, amount, unit
 	;
 `
 
-const sqlCreateRecipeInst = `
-	INSERT INTO wdiet.recipe_instructions(
-		recipe_uuid,
-		step_num,
-		instruction
-	)
-	VALUES(
-		$1,
-		$2,
-		$3
-	)
-	RETURNING recipe_uuid, step_num, instruction
+// consume할 때 쓰는 lot들. 단위는 units package로 변환하니까 단위 상관없이 다 가져옴.
+// 제일 빨리 상하는 것부터 꺼내니까 그 순서로, 다른 요청이 같은 lot을 동시에 못 건드리게 잠금.
+const sqlLockFridgeLots = `
+	SELECT 	fridge_item_uuid,
+			amount,
+			unit
+
+	FROM 	wdiet.fridge_ingredients
+
+	WHERE	household_uuid = $1 AND ingredient_uuid = $2
+
+	ORDER BY expiration_date, purchased_date, fridge_item_uuid
+
+	FOR UPDATE
 	;
 `
 
-const sqlUpdateRecipe = `
-	UPDATE wdiet.recipes
-		SET 
-			recipe_name = $1,
-			category = $2,
-			updated_at = now()
-	WHERE recipe_uuid = $3
-	RETURNING recipe_uuid, user_uuid, recipe_name, category, created_at, updated_at
+const sqlGetIngredientDensity = `
+	SELECT 	density
+
+	FROM 	wdiet.ingredients
+
+	WHERE	ingredient_uuid = $1
 	;
 `
 
-// AND WHERE ingredient_uuid = $2 이 부분 뺌.. 아예 특정 recipe에 해당하는 모든 ingredient들을 싹 다 지울거니까 어차피.. ingredient uuid 필요 ㄴ
-// methods.go에서도 for range 안에 이걸 넣을 게 아니라 이건 바깥으로 빼놓음. 돌아가면서 ingredient들을 하나하나 지우는게 아니라 싹 다 지우고 시작.
-const sqlDeleteRecipeIngr = `
+const sqlDeleteFridgeLot = `
 	DELETE 
-	FROM wdiet.recipe_ingredients
+		FROM wdiet.fridge_ingredients
 
-	WHERE recipe_uuid = $1
+	WHERE fridge_item_uuid = $1
+	RETURNING fridge_item_uuid, household_uuid, user_uuid, ingredient_uuid, amount, unit, purchased_date, expiration_date, location, opened_date, created_at, updated_at
 	;
 `
 
-const sqlDeleteRecipeInst = `
-	DELETE 
-	FROM wdiet.recipe_instructions
+const sqlListFridgeLots = `
+	SELECT 	fridge_item_uuid,
+			household_uuid,
+			user_uuid,
+			ingredient_uuid,
+			amount,
+			unit,
+			purchased_date,
+			expiration_date,
+			location,
+			opened_date,
+			created_at,
+			updated_at
+	
+	FROM 	wdiet.fridge_ingredients
+	
+	WHERE	household_uuid = $1 AND ingredient_uuid = $2
+
+	ORDER BY expiration_date, fridge_item_uuid
+	;
+`
+
+const sqlCreateHousehold = `
+	INSERT INTO wdiet.households(
+		household_name
+	)
+	VALUES(
+		$1
+	)
+	RETURNING household_uuid, household_name, created_at, updated_at
+	;
+`
+
+const sqlGetHousehold = `
+	SELECT 	household_uuid,
+			household_name,
+			created_at,
+			updated_at
+
+	FROM 	wdiet.households
+
+	WHERE	household_uuid = $1
+	;
+`
+
+// 같은 household에 두 번 못 들어감.
+const sqlCreateHouseholdMember = `
+	INSERT INTO wdiet.household_members(
+		household_uuid,
+		user_uuid,
+		role
+	)
+	VALUES(
+		$1,
+		$2,
+		$3
+	)
+	ON CONFLICT DO NOTHING
+	RETURNING household_uuid, user_uuid, role, created_at
+	;
+`
+
+const sqlListHouseholds = `
+	SELECT 	h.household_uuid,
+			h.household_name,
+			m.role,
+			h.household_uuid IS NOT DISTINCT FROM u.active_household_uuid,
+			m.created_at
+
+	FROM 	wdiet.household_members m
+
+	JOIN 	wdiet.households h ON h.household_uuid = m.household_uuid
+	JOIN 	wdiet.users u ON u.user_uuid = m.user_uuid
+
+	WHERE	m.user_uuid = $1
+
+	ORDER BY m.created_at, h.household_uuid
+	;
+`
+
+const sqlGetHouseholdMembership = `
+	SELECT 	h.household_uuid,
+			h.household_name,
+			m.role,
+			h.household_uuid IS NOT DISTINCT FROM u.active_household_uuid,
+			m.created_at
+
+	FROM 	wdiet.household_members m
+
+	JOIN 	wdiet.households h ON h.household_uuid = m.household_uuid
+	JOIN 	wdiet.users u ON u.user_uuid = m.user_uuid
+
+	WHERE	m.household_uuid = $1 AND m.user_uuid = $2
+	;
+`
+
+// membership이랑 같이 join하니까 쫓겨난 household는 안 나옴.
+const sqlGetActiveHousehold = `
+	SELECT 	h.household_uuid,
+			h.household_name,
+			m.role,
+			true,
+			m.created_at
+
+	FROM 	wdiet.users u
+
+	JOIN 	wdiet.household_members m ON m.household_uuid = u.active_household_uuid AND m.user_uuid = u.user_uuid
+	JOIN 	wdiet.households h ON h.household_uuid = m.household_uuid
+
+	WHERE	u.user_uuid = $1
+	;
+`
+
+// member가 아니면 안 바뀜.
+const sqlSetActiveHousehold = `
+	UPDATE wdiet.users
+		SET
+			active_household_uuid = $2
+	WHERE user_uuid = $1
+		AND EXISTS (SELECT 1 FROM wdiet.household_members WHERE household_uuid = $2 AND user_uuid = $1)
+	;
+`
+
+// 나간 household가 active였으면 비워둠. 다음에 fridge 볼 때 service가 다른 걸 골라줌.
+const sqlClearActiveHousehold = `
+	UPDATE wdiet.users
+		SET
+			active_household_uuid = NULL
+	WHERE user_uuid = $1 AND active_household_uuid = $2
+	;
+`
+
+const sqlListHouseholdMembers = `
+	SELECT 	m.household_uuid,
+			m.user_uuid,
+			m.role,
+			u.first_name,
+			u.last_name,
+			u.email_address,
+			m.created_at
+
+	FROM 	wdiet.household_members m
+
+	JOIN 	wdiet.users u ON u.user_uuid = m.user_uuid
+
+	WHERE	m.household_uuid = $1
+
+	ORDER BY m.created_at, m.user_uuid
+	;
+`
+
+// active household 없는 user한테 household 골라주거나 만들어 줄 때, 같은 user의 요청 두 개가 동시에 household를 두 개 만들지 않게 잠금.
+const sqlLockUser = `
+	SELECT 	user_uuid
+
+	FROM 	wdiet.users
+
+	WHERE	user_uuid = $1
+
+	FOR UPDATE
+	;
+`
+
+// 제일 먼저 들어간 household. (ListHouseholds랑 같은 순서)
+const sqlGetFirstHousehold = `
+	SELECT 	household_uuid
+
+	FROM 	wdiet.household_members
+
+	WHERE	user_uuid = $1
+
+	ORDER BY created_at, household_uuid
+	LIMIT 	1
+	;
+`
+
+// role 바꾸거나 member 뺄 때 owner 수 세는 동안 다른 요청이 끼어들지 못하게 household row를 잠금.
+const sqlLockHousehold = `
+	SELECT 	household_uuid
+
+	FROM 	wdiet.households
+
+	WHERE	household_uuid = $1
+
+	FOR UPDATE
+	;
+`
+
+const sqlCountHouseholdMembers = `
+	SELECT 	COUNT(*),
+			COUNT(*) FILTER (WHERE role = 'owner'),
+			COALESCE(MAX(role) FILTER (WHERE user_uuid = $2), '')
+
+	FROM 	wdiet.household_members
+
+	WHERE	household_uuid = $1
+	;
+`
+
+const sqlSetHouseholdMemberRole = `
+	WITH updated AS (
+		UPDATE wdiet.household_members
+			SET
+				role = $3
+		WHERE household_uuid = $1 AND user_uuid = $2
+		RETURNING household_uuid, user_uuid, role, created_at
+	)
+	SELECT 	updated.household_uuid,
+			updated.user_uuid,
+			updated.role,
+			u.first_name,
+			u.last_name,
+			u.email_address,
+			updated.created_at
+
+	FROM 	updated
+
+	JOIN 	wdiet.users u ON u.user_uuid = updated.user_uuid
+	;
+`
+
+const sqlDeleteHouseholdMember = `
+	DELETE 
+		FROM wdiet.household_members
+
+	WHERE household_uuid = $1 AND user_uuid = $2
+	;
+`
+
+// fridge도 member도 invitation도 ON DELETE CASCADE로 같이 지워짐.
+const sqlDeleteHousehold = `
+	DELETE 
+		FROM wdiet.households
+
+	WHERE household_uuid = $1
+	;
+`
+
+const sqlCreateHouseholdInvitation = `
+	INSERT INTO wdiet.household_invitations(
+		household_uuid,
+		email_address,
+		role,
+		hashed_token,
+		invited_by,
+		expires_at
+	)
+	VALUES(
+		$1,
+		$2,
+		$3,
+		$4,
+		$5,
+		$6
+	)
+	RETURNING household_invitation_uuid, household_uuid, email_address, role, hashed_token, invited_by, expires_at, accepted_at, created_at
+	;
+`
+
+// 초대받은 이메일이랑 로그인한 user 이메일이 같아야 받을 수 있음.
+const sqlUseHouseholdInvitation = `
+	UPDATE wdiet.household_invitations
+		SET
+			accepted_at = now()
+	WHERE hashed_token = $1 AND accepted_at IS NULL AND expires_at > now() AND lower(email_address) = lower($2)
+	RETURNING household_uuid, role
+	;
+`
+
+// 혼자 있던 household는 user랑 같이 없어짐.
+const sqlDeleteUserSoleHouseholds = `
+	DELETE 
+		FROM wdiet.households h
+
+	WHERE h.household_uuid IN (SELECT household_uuid FROM wdiet.household_members WHERE user_uuid = $1)
+		AND NOT EXISTS (SELECT 1 FROM wdiet.household_members m WHERE m.household_uuid = h.household_uuid AND m.user_uuid <> $1)
+	;
+`
+
+// 유일한 owner가 떠나는 household는 제일 오래된 member(없으면 viewer)가 owner를 물려받음.
+const sqlPromoteHouseholdHeirs = `
+	UPDATE wdiet.household_members hm
+		SET
+			role = 'owner'
+	FROM (
+		SELECT DISTINCT ON (m.household_uuid) m.household_uuid, m.user_uuid
+
+		FROM 	wdiet.household_members m
+
+		WHERE	m.user_uuid <> $1
+			AND m.household_uuid IN (SELECT household_uuid FROM wdiet.household_members WHERE user_uuid = $1 AND role = 'owner')
+			AND NOT EXISTS (SELECT 1 FROM wdiet.household_members o WHERE o.household_uuid = m.household_uuid AND o.role = 'owner' AND o.user_uuid <> $1)
+
+		ORDER BY m.household_uuid, m.role = 'member' DESC, m.created_at, m.user_uuid
+	) heir
+	WHERE hm.household_uuid = heir.household_uuid AND hm.user_uuid = heir.user_uuid
+	;
+`
+
+const sqlGetRecipe = `
+	SELECT 	recipe_uuid,
+			user_uuid,
+			recipe_name,
+			category,
+			created_at,
+			updated_at
+	
+	FROM 	wdiet.recipes
+	
+	WHERE	recipe_uuid = $1
+
+	LIMIT 1
+	;
+`
+
+// recipe 하나당 여러 recipe ingredient이므로 얘는 필연적으로 list recipe ingredients임,, 하나의 recipe ingredient만 불러오는건 의미 ㄴ
+const sqlListRecipeIngr = ` 
+	SELECT 	recipe_uuid,
+			ingredient_uuid,
+			amount,
+			unit
+	
+	FROM 	wdiet.recipe_ingredients
+	
+	WHERE	recipe_uuid = $1
+	;
+
+`
+const sqlListRecipeInst = `
+	SELECT 	recipe_uuid,
+			step_num,
+			instruction
+	
+	FROM 	wdiet.recipe_instructions
+	
+	WHERE	recipe_uuid = $1
+	;
+`
+
+const sqlListRecipes = `
+	SELECT 	recipe_uuid,
+			user_uuid,
+			recipe_name,
+			category,
+			created_at,
+			updated_at
+	
+	FROM 	wdiet.recipes
+	
+	WHERE	user_uuid = $1
+	;
+`
+
+const sqlsearchRecipes = `
+	SELECT 	recipe_uuid,
+			user_uuid,
+			recipe_name,
+			category,
+			created_at,
+			updated_at
+
+	FROM wdiet.recipes
+`
+
+const sqlCreateRecipe = `
+	INSERT INTO wdiet.recipes(
+		user_uuid,
+		recipe_name,
+		category
+	)
+	VALUES(
+		$1,
+		$2,
+		$3
+	)
+	RETURNING recipe_uuid, user_uuid, recipe_name, category, created_at, updated_at
+	;
+`
+
+const sqlCreateRecipeIngr = `
+	INSERT INTO wdiet.recipe_ingredients(
+		recipe_uuid,
+		ingredient_uuid,
+		amount,
+		unit
+	)
+	VALUES(
+		$1,
+		$2,
+		$3,
+		$4
+	)
+	RETURNING recipe_uuid, ingredient_uuid, amount, unit
+	;
+`
+
+const sqlCreateRecipeInst = `
+	INSERT INTO wdiet.recipe_instructions(
+		recipe_uuid,
+		step_num,
+		instruction
+	)
+	VALUES(
+		$1,
+		$2,
+		$3
+	)
+	RETURNING recipe_uuid, step_num, instruction
+	;
+`
+
+const sqlUpdateRecipe = `
+	UPDATE wdiet.recipes
+		SET 
+			recipe_name = $1,
+			category = $2,
+			updated_at = now()
+	WHERE recipe_uuid = $3
+	RETURNING recipe_uuid, user_uuid, recipe_name, category, created_at, updated_at
+	;
+`
+
+// AND WHERE ingredient_uuid = $2 이 부분 뺌.. 아예 특정 recipe에 해당하는 모든 ingredient들을 싹 다 지울거니까 어차피.. ingredient uuid 필요 ㄴ
+// methods.go에서도 for range 안에 이걸 넣을 게 아니라 이건 바깥으로 빼놓음. 돌아가면서 ingredient들을 하나하나 지우는게 아니라 싹 다 지우고 시작.
+const sqlDeleteRecipeIngr = `
+	DELETE 
+	FROM wdiet.recipe_ingredients
+
+	WHERE recipe_uuid = $1
+	;
+`
+
+const sqlDeleteRecipeInst = `
+	DELETE 
+	FROM wdiet.recipe_instructions
+
+	WHERE recipe_uuid = $1
+	;
+`
+
+const sqlDeleteRecipe = `
+	DELETE 
+		FROM wdiet.recipes
+
+	WHERE recipe_uuid = $1
+	;
+`
+
+// fridge에 있는 재료로 recipe마다 coverage랑 score를 계산해서 순위대로 $9개만 고름. 고른 recipe는 row 하나가 recipe ingredient 하나
+// + fridge에 있는 단위, 유통기한 하나. (missing ingredient랑 explanation은 service에서 만듦)
+// 단위 변환은 units package의 registry를 $2, $3, $4로 받아서 함. 이름이 같으면 모르는 단위라도 그대로 더하고, mass <-> volume은
+// density가 있을 때만. 바꿀 수 없는 건 NULL이라 SUM에서 빠짐.
+// score = $7 * coverage/100 + $8 * urgency 합. $6일 안에 상하는 재료마다 urgency = ($6 + 1 - 남은 날) / ($6 + 1).
+// 남은 날은 UTC 날짜로 셈. 오늘 밤에 상하는 건 0일.
+const sqlSuggestRecipes = `
+	WITH unit_factors AS (
+		SELECT 	*
+		FROM 	unnest($2::text[], $3::text[], $4::numeric[]) AS u (unit, kind, factor)
+	),
+	fridge_lots AS ( -- 유통기한별로 나눠서. 하나라도 지난 게 있으면 MIN이 그걸로 나와서 아직 괜찮은 lot이 묻혀버림.
+		SELECT 	ingredient_uuid,
+				unit,
+				SUM(amount) AS amount,
+				expiration_date,
+				expiration_date > $5::timestamp AS usable, -- 지난 건 coverage에도 urgency에도 안 셈
+				expiration_date::date - $5::timestamp::date AS days_left
+
+		FROM 	wdiet.fridge_ingredients
+
+		WHERE 	household_uuid = $1
+
+		GROUP BY ingredient_uuid, unit, expiration_date
+	),
+	ingredient_coverage AS ( -- recipe ingredient 하나당 하나. covered는 0~1, amount가 0이면 있는 걸로 침.
+		SELECT 	ri.recipe_uuid,
+				COUNT(fl.ingredient_uuid) FILTER (WHERE fl.usable) > 0 AS in_fridge,
+				CASE
+					WHEN ri.amount = 0 THEN 1
+					ELSE LEAST(COALESCE(SUM(
+						CASE
+							WHEN fl.unit = ri.unit THEN fl.amount
+							WHEN fu.kind = ru.kind THEN fl.amount * fu.factor / ru.factor
+							WHEN fu.kind = 'volume' AND ru.kind = 'mass' THEN fl.amount * fu.factor * i.density / ru.factor
+							WHEN fu.kind = 'mass' AND ru.kind = 'volume' THEN fl.amount * fu.factor / i.density / ru.factor
+						END
+					) FILTER (WHERE fl.usable), 0) / ri.amount, 1)
+				END AS covered,
+				MIN(fl.days_left) FILTER (WHERE fl.usable) AS days_left
+
+		FROM 	wdiet.recipe_ingredients ri
+
+		JOIN 	wdiet.ingredients i ON i.ingredient_uuid = ri.ingredient_uuid
+		LEFT JOIN unit_factors ru ON ru.unit = ri.unit
+		LEFT JOIN fridge_lots fl ON fl.ingredient_uuid = ri.ingredient_uuid
+		LEFT JOIN unit_factors fu ON fu.unit = fl.unit
+
+		GROUP BY ri.recipe_uuid, ri.ingredient_uuid, ri.amount
+	),
+	ranked AS (
+		SELECT 	r.recipe_uuid,
+				r.user_uuid,
+				r.recipe_name,
+				r.category,
+				ROUND(AVG(ic.covered) * 100, 1) AS coverage,
+				ROUND(
+					$7::numeric * AVG(ic.covered) +
+					$8::numeric * COALESCE(SUM(($6::int + 1 - ic.days_left)::numeric / ($6::int + 1)) FILTER (WHERE ic.days_left <= $6::int), 0),
+				2) AS score
+
+		FROM 	wdiet.recipes r
+
+		JOIN 	wdiet.users u ON u.user_uuid = r.user_uuid AND u.active
+		JOIN 	ingredient_coverage ic ON ic.recipe_uuid = r.recipe_uuid
+
+		GROUP BY r.recipe_uuid
+
+		HAVING 	bool_or(ic.in_fridge) AND ROUND(AVG(ic.covered) * 100, 1) > 0 -- fridge에 있어도 recipe 단위로 못 바꾸면 0
+
+		ORDER BY score DESC, coverage DESC, r.recipe_name, r.recipe_uuid
+		LIMIT 	$9
+	)
+	SELECT 	rk.recipe_uuid,
+			rk.user_uuid,
+			rk.recipe_name,
+			rk.category,
+			rk.coverage,
+			rk.score,
+			ri.ingredient_uuid,
+			i.ingredient_name,
+			i.density,
+			ri.amount,
+			ri.unit,
+			fl.unit,
+			COALESCE(fl.amount, 0),
+			fl.expiration_date
+
+	FROM 	ranked rk
+
+	JOIN 	wdiet.recipe_ingredients ri ON ri.recipe_uuid = rk.recipe_uuid
+	JOIN 	wdiet.ingredients i ON i.ingredient_uuid = ri.ingredient_uuid
+	LEFT JOIN fridge_lots fl ON fl.ingredient_uuid = ri.ingredient_uuid
+
+	ORDER BY rk.score DESC, rk.coverage DESC, rk.recipe_name, rk.recipe_uuid, ri.ingredient_uuid, fl.unit, fl.expiration_date
+	;
+`
+
+// cook할 때 계획 세운 뒤에 lot이 바뀌었는지 확인하려고 잠금.
+const sqlLockFridgeLot = `
+	SELECT 	amount,
+			unit
+
+	FROM 	wdiet.fridge_ingredients
+
+	WHERE	household_uuid = $1 AND fridge_item_uuid = $2
+
+	FOR UPDATE
+	;
+`
+
+const sqlSetFridgeLot = `
+	UPDATE wdiet.fridge_ingredients
+		SET
+			amount = $2,
+			unit = $3,
+			updated_at = now()
+	WHERE fridge_item_uuid = $1
+	RETURNING fridge_item_uuid, household_uuid, user_uuid, ingredient_uuid, amount, unit, purchased_date, expiration_date, location, opened_date, created_at, updated_at
+	;
+`
+
+const sqlCreateCookLog = `
+	INSERT INTO wdiet.cook_logs(
+				household_uuid,
+				user_uuid,
+				recipe_uuid,
+				recipe_name,
+				servings
+	)
+	VALUES(
+		$1,
+		$2,
+		$3,
+		$4,
+		$5
+	)
+	RETURNING cook_log_uuid, household_uuid, user_uuid, recipe_uuid, recipe_name, servings::float8, created_at
+	;
+`
+
+const sqlListCookLogs = `
+	SELECT 	cook_log_uuid,
+			household_uuid,
+			user_uuid,
+			recipe_uuid,
+			recipe_name,
+			servings::float8,
+			created_at
+
+	FROM 	wdiet.cook_logs
+
+	WHERE	user_uuid = $1
+
+	ORDER BY created_at DESC
+	;
+`
+
+const sqlGetDigestSettings = `
+	SELECT 	user_uuid,
+			enabled,
+			digest_minute,
+			timezone,
+			channel,
+			webhook_url,
+			within_days,
+			last_sent_on,
+			created_at,
+			updated_at
+
+	FROM 	wdiet.digest_settings
+
+	WHERE	user_uuid = $1
+	;
+`
+
+// last_sent_on은 건드리지 않음. 시간을 바꿔도 오늘 이미 보냈으면 내일부터.
+const sqlSetDigestSettings = `
+	INSERT INTO wdiet.digest_settings(
+		user_uuid,
+		enabled,
+		digest_minute,
+		timezone,
+		channel,
+		webhook_url,
+		within_days
+	)
+	VALUES(
+		$1,
+		$2,
+		$3,
+		$4,
+		$5,
+		$6,
+		$7
+	)
+	ON CONFLICT (user_uuid) DO UPDATE
+		SET
+			enabled = EXCLUDED.enabled,
+			digest_minute = EXCLUDED.digest_minute,
+			timezone = EXCLUDED.timezone,
+			channel = EXCLUDED.channel,
+			webhook_url = EXCLUDED.webhook_url,
+			within_days = EXCLUDED.within_days,
+			updated_at = now()
+	RETURNING user_uuid, enabled, digest_minute, timezone, channel, webhook_url, within_days, last_sent_on, created_at, updated_at
+	;
+`
+
+// 비활성화된 계정(탈퇴 대기 중 포함)한테는 안 보냄.
+const sqlListEnabledDigestSettings = `
+	SELECT 	d.user_uuid,
+			d.enabled,
+			d.digest_minute,
+			d.timezone,
+			d.channel,
+			d.webhook_url,
+			d.within_days,
+			d.last_sent_on,
+			d.created_at,
+			d.updated_at
+
+	FROM 	wdiet.digest_settings d
+	JOIN 	wdiet.users u ON u.user_uuid = d.user_uuid
+
+	WHERE	d.enabled AND u.active
+	;
+`
+
+// 인스턴스가 여러 개여도 하루에 한 번만 보내도록, 먼저 바꾼 쪽이 보냄.
+const sqlClaimDigest = `
+	UPDATE wdiet.digest_settings
+		SET
+			last_sent_on = $2::date
+	WHERE user_uuid = $1 AND (last_sent_on IS NULL OR last_sent_on < $2::date)
+	;
+`
+
+const sqlListRefreshTokens = `
+	SELECT 	refresh_token_uuid,
+			family_uuid,
+			user_uuid,
+			hashed_token,
+			expires_at,
+			revoked_at,
+			created_at
+
+	FROM 	wdiet.refresh_tokens
+
+	WHERE	user_uuid = $1
 
-	WHERE recipe_uuid = $1
+	ORDER BY created_at DESC
 	;
 `
 
-const sqlDeleteRecipe = `
+const sqlGetRefreshToken = `
+	SELECT 	refresh_token_uuid,
+			family_uuid,
+			user_uuid,
+			hashed_token,
+			expires_at,
+			revoked_at,
+			created_at
+
+	FROM 	wdiet.refresh_tokens
+
+	WHERE	hashed_token = $1
+
+	LIMIT 1
+	;
+`
+
+const sqlCreateRefreshToken = `
+	INSERT INTO wdiet.refresh_tokens(
+		family_uuid,
+		user_uuid,
+		hashed_token,
+		expires_at
+	)
+	VALUES(
+		$1,
+		$2,
+		$3,
+		$4
+	)
+	RETURNING refresh_token_uuid, family_uuid, user_uuid, hashed_token, expires_at, revoked_at, created_at
+	;
+`
+
+// revoked_at IS NULL 조건 때문에 이미 쓴 token이면 affected가 0이 됨. 동시에 두 번 refresh해도 하나만 성공함.
+const sqlRevokeRefreshToken = `
+	UPDATE wdiet.refresh_tokens
+		SET
+			revoked_at = now()
+	WHERE refresh_token_uuid = $1 AND revoked_at IS NULL
+	;
+`
+
+const sqlRevokeRefreshTokenFamily = `
+	UPDATE wdiet.refresh_tokens
+		SET
+			revoked_at = now()
+	WHERE family_uuid = $1 AND revoked_at IS NULL
+	;
+`
+
+const sqlRevokeAccessToken = `
+	INSERT INTO wdiet.revoked_access_tokens(
+		jti,
+		expires_at
+	)
+	VALUES(
+		$1,
+		$2
+	)
+	ON CONFLICT (jti) DO NOTHING
+	;
+`
+
+const sqlRevokeUserRefreshTokens = `
+	UPDATE wdiet.refresh_tokens
+		SET
+			revoked_at = now()
+	WHERE user_uuid = $1 AND revoked_at IS NULL
+	;
+`
+
+// expired jti는 어차피 ValidateToken에서 걸러지니까 denylist에 남겨둘 필요 없음.
+const sqlDeleteExpiredAccessTokens = `
+	DELETE
+		FROM wdiet.revoked_access_tokens
+
+	WHERE expires_at < now()
+	;
+`
+
+const sqlIsAccessTokenRevoked = `
+	SELECT EXISTS(
+		SELECT 	1
+		FROM 	wdiet.revoked_access_tokens
+		WHERE 	jti = $1
+	)
+	;
+`
+
+const sqlCreatePasswordResetToken = `
+	INSERT INTO wdiet.password_reset_tokens(
+		user_uuid,
+		hashed_token,
+		expires_at
+	)
+	VALUES(
+		$1,
+		$2,
+		$3
+	)
+	RETURNING password_reset_token_uuid, user_uuid, hashed_token, expires_at, used_at, created_at
+	;
+`
+
+// 새 password가 이름이나 email이랑 겹치는지 보려고, token은 아직 안 씀.
+const sqlGetPasswordResetUser = `
+	SELECT 	u.user_uuid,
+			u.hashed_password,
+			u.active,
+			u.role,
+			u.first_name,
+			u.last_name,
+			u.email_address,
+			u.email_verified_at,
+			u.created_at,
+			u.updated_at
+
+	FROM 	wdiet.password_reset_tokens t
+	JOIN 	wdiet.users u ON u.user_uuid = t.user_uuid
+
+	WHERE	t.hashed_token = $1 AND t.used_at IS NULL AND t.expires_at > now()
+	;
+`
+
+// 쓰는 순간 used_at 찍어버림. 두 요청이 동시에 와도 하나만 row를 받음.
+const sqlUsePasswordResetToken = `
+	UPDATE wdiet.password_reset_tokens
+		SET
+			used_at = now()
+	WHERE hashed_token = $1 AND used_at IS NULL AND expires_at > now()
+	RETURNING user_uuid
+	;
+`
+
+const sqlUseUserPasswordResetTokens = `
+	UPDATE wdiet.password_reset_tokens
+		SET
+			used_at = now()
+	WHERE user_uuid = $1 AND used_at IS NULL
+	;
+`
+
+const sqlCreateEmailVerificationToken = `
+	INSERT INTO wdiet.email_verification_tokens(
+		user_uuid,
+		email_address,
+		hashed_token,
+		expires_at
+	)
+	VALUES(
+		$1,
+		$2,
+		$3,
+		$4
+	)
+	RETURNING email_verification_token_uuid, user_uuid, email_address, hashed_token, expires_at, used_at, created_at
+	;
+`
+
+const sqlUseUserEmailVerificationTokens = `
+	UPDATE wdiet.email_verification_tokens
+		SET
+			used_at = now()
+	WHERE user_uuid = $1 AND used_at IS NULL
+	;
+`
+
+// token이 보내진 주소가 지금 주소랑 같아야만 인증됨.
+const sqlVerifyEmail = `
+	WITH used AS (
+		UPDATE wdiet.email_verification_tokens
+			SET
+				used_at = now()
+		WHERE hashed_token = $1 AND used_at IS NULL AND expires_at > now()
+		RETURNING user_uuid, email_address
+	)
+	UPDATE wdiet.users u
+		SET
+			email_verified_at = COALESCE(u.email_verified_at, now()),
+			updated_at = now()
+	FROM used
+	WHERE u.user_uuid = used.user_uuid AND u.email_address = used.email_address
+	RETURNING u.user_uuid, u.hashed_password, u.active, u.role, u.first_name, u.last_name, u.email_address, u.email_verified_at, u.created_at, u.updated_at
+	;
+`
+
+const sqlCreatePersonalAccessToken = `
+	INSERT INTO wdiet.personal_access_tokens(
+		user_uuid,
+		name,
+		scopes,
+		hashed_token,
+		expires_at
+	)
+	VALUES(
+		$1,
+		$2,
+		$3,
+		$4,
+		$5
+	)
+	RETURNING personal_access_token_uuid, user_uuid, name, scopes, hashed_token, expires_at, last_used_at, created_at
+	;
+`
+
+const sqlListPersonalAccessTokens = `
+	SELECT 	personal_access_token_uuid,
+			user_uuid,
+			name,
+			scopes,
+			hashed_token,
+			expires_at,
+			last_used_at,
+			created_at
+
+	FROM 	wdiet.personal_access_tokens
+
+	WHERE	user_uuid = $1
+
+	ORDER BY created_at DESC
+	;
+`
+
+const sqlDeletePersonalAccessToken = `
 	DELETE 
-		FROM wdiet.recipes
+		FROM wdiet.personal_access_tokens
 
-	WHERE recipe_uuid = $1
+	WHERE user_uuid = $1 AND personal_access_token_uuid = $2
+	;
+`
+
+// 찾으면서 last_used_at도 같이 찍음. 만료된 건 없는 거랑 똑같이.
+const sqlUsePersonalAccessToken = `
+	UPDATE wdiet.personal_access_tokens
+		SET
+			last_used_at = now()
+	WHERE hashed_token = $1 AND (expires_at IS NULL OR expires_at > now())
+	RETURNING personal_access_token_uuid, user_uuid, name, scopes, hashed_token, expires_at, last_used_at, created_at
+	;
+`
+
+const sqlGetTOTP = `
+	SELECT 	user_uuid,
+			secret,
+			enabled_at,
+			last_step,
+			created_at
+
+	FROM 	wdiet.user_totp
+
+	WHERE	user_uuid = $1
+	;
+`
+
+// 켜져있는 2fa는 덮어쓰면 안 됨. 끄고 다시 해야함.
+const sqlStartTOTPEnrolment = `
+	INSERT INTO wdiet.user_totp(
+		user_uuid,
+		secret
+	)
+	VALUES(
+		$1,
+		$2
+	)
+	ON CONFLICT (user_uuid) DO UPDATE
+		SET
+			secret = EXCLUDED.secret,
+			enabled_at = NULL,
+			last_step = 0,
+			created_at = now()
+		WHERE wdiet.user_totp.enabled_at IS NULL
+	RETURNING user_uuid, secret, enabled_at, last_step, created_at
+	;
+`
+
+const sqlEnableTOTP = `
+	UPDATE wdiet.user_totp
+		SET
+			enabled_at = now(),
+			last_step = $2
+	WHERE user_uuid = $1 AND enabled_at IS NULL
+	;
+`
+
+const sqlDisableTOTP = `
+	DELETE 
+		FROM wdiet.user_totp
+
+	WHERE user_uuid = $1
+	;
+`
+
+// 같은 step의 코드를 두 번 못 쓰게.
+const sqlUseTOTPStep = `
+	UPDATE wdiet.user_totp
+		SET
+			last_step = $2
+	WHERE user_uuid = $1 AND last_step < $2 AND enabled_at IS NOT NULL
+	;
+`
+
+const sqlDeleteRecoveryCodes = `
+	DELETE 
+		FROM wdiet.recovery_codes
+
+	WHERE user_uuid = $1
+	;
+`
+
+const sqlCreateRecoveryCode = `
+	INSERT INTO wdiet.recovery_codes(
+		user_uuid,
+		hashed_code
+	)
+	VALUES(
+		$1,
+		$2
+	)
+	;
+`
+
+const sqlUseRecoveryCode = `
+	UPDATE wdiet.recovery_codes
+		SET
+			used_at = now()
+	WHERE user_uuid = $1 AND hashed_code = $2 AND used_at IS NULL
+	;
+`
+
+const sqlCreateLoginChallenge = `
+	INSERT INTO wdiet.login_challenges(
+		user_uuid,
+		hashed_token,
+		expires_at
+	)
+	VALUES(
+		$1,
+		$2,
+		$3
+	)
+	RETURNING login_challenge_uuid, user_uuid, hashed_token, attempts, expires_at, used_at, created_at
+	;
+`
+
+// 시도할 때마다 attempts 올림. 코드 맞추기 전에 몇 번까지 봐줄지는 service에서.
+const sqlAttemptLoginChallenge = `
+	UPDATE wdiet.login_challenges
+		SET
+			attempts = attempts + 1
+	WHERE hashed_token = $1 AND used_at IS NULL
+	RETURNING login_challenge_uuid, user_uuid, hashed_token, attempts, expires_at, used_at, created_at
+	;
+`
+
+const sqlUseLoginChallenge = `
+	UPDATE wdiet.login_challenges
+		SET
+			used_at = now()
+	WHERE login_challenge_uuid = $1 AND used_at IS NULL
+	;
+`
+
+// provider가 이메일 확인해줬으니까 인증된 걸로 만듦.
+const sqlCreateVerifiedUser = `
+	INSERT INTO wdiet.users(
+		hashed_password,
+		active,
+		first_name,
+		last_name,
+		email_address,
+		email_verified_at
+	)
+	VALUES(
+		$1,
+		$2,
+		$3,
+		$4,
+		$5,
+		now()
+	)
+	RETURNING user_uuid, hashed_password, active, role, first_name, last_name, email_address, email_verified_at, created_at, updated_at
+	;
+`
+
+// 이미 연결돼 있으면 아무것도 안 하고 row도 안 돌려줌.
+const sqlCreateUserIdentity = `
+	INSERT INTO wdiet.user_identities(
+		user_uuid,
+		provider,
+		subject,
+		email_address,
+		last_login_at
+	)
+	VALUES(
+		$1,
+		$2,
+		$3,
+		$4,
+		now()
+	)
+	ON CONFLICT DO NOTHING
+	RETURNING user_identity_uuid, user_uuid, provider, subject, email_address, created_at, last_login_at
+	;
+`
+
+// 찾으면서 last_login_at도 같이 찍음.
+const sqlUseUserIdentity = `
+	UPDATE wdiet.user_identities
+		SET
+			last_login_at = now()
+	WHERE provider = $1 AND subject = $2
+	RETURNING user_identity_uuid, user_uuid, provider, subject, email_address, created_at, last_login_at
+	;
+`
+
+const sqlListUserIdentities = `
+	SELECT 	user_identity_uuid,
+			user_uuid,
+			provider,
+			subject,
+			email_address,
+			created_at,
+			last_login_at
+
+	FROM 	wdiet.user_identities
+
+	WHERE	user_uuid = $1
+
+	ORDER BY created_at
+	;
+`
+
+const sqlCreateOIDCState = `
+	INSERT INTO wdiet.oidc_states(
+		hashed_state,
+		provider,
+		nonce,
+		code_verifier,
+		expires_at
+	)
+	VALUES(
+		$1,
+		$2,
+		$3,
+		$4,
+		$5
+	)
+	RETURNING oidc_state_uuid, hashed_state, provider, nonce, code_verifier, expires_at, created_at
+	;
+`
+
+// 한 번 쓰면 지움. 만료된 건 service에서 거름.
+const sqlUseOIDCState = `
+	DELETE 
+		FROM wdiet.oidc_states
+
+	WHERE hashed_state = $1
+	RETURNING oidc_state_uuid, hashed_state, provider, nonce, code_verifier, expires_at, created_at
+	;
+`
+
+const sqlGetLoginAttempts = `
+	SELECT 	failures,
+			last_failure_at
+
+	FROM 	wdiet.login_attempts
+
+	WHERE	attempt_key = $1
+	;
+`
+
+// 동시에 여러 instance에서 실패해도 count가 안 꼬이게 upsert 한 방에 처리. window 지난 건 1부터 다시 셈.
+const sqlAddLoginFailure = `
+	INSERT INTO wdiet.login_attempts(
+		attempt_key,
+		failures,
+		last_failure_at
+	)
+	VALUES(
+		$1,
+		1,
+		$2
+	)
+	ON CONFLICT (attempt_key) DO UPDATE
+		SET
+			failures = CASE
+				WHEN wdiet.login_attempts.last_failure_at < $2 - make_interval(secs => $3) THEN 1
+				ELSE wdiet.login_attempts.failures + 1
+			END,
+			last_failure_at = $2
+	RETURNING failures, last_failure_at
+	;
+`
+
+// 지우는 김에 오래된 row도 같이 정리.
+const sqlResetLoginAttempts = `
+	DELETE
+		FROM wdiet.login_attempts
+
+	WHERE attempt_key = $1 OR last_failure_at < now() - interval '1 day'
+	;
+`
+
+const sqlCreateLockoutEvent = `
+	INSERT INTO wdiet.lockout_events(
+		scope,
+		subject,
+		failures,
+		locked_until
+	)
+	VALUES(
+		$1,
+		$2,
+		$3,
+		$4
+	)
+	RETURNING lockout_event_uuid, scope, subject, failures, locked_until, created_at
+	;
+`
+
+const sqlListLockoutEvents = `
+	SELECT 	lockout_event_uuid,
+			scope,
+			subject,
+			failures,
+			locked_until,
+			created_at
+
+	FROM 	wdiet.lockout_events
+
+	ORDER BY created_at DESC
+
+	LIMIT $1
 	;
 `
@@ -3,12 +3,20 @@ package store
 import (
 	"context"
 	"fmt"
+	"time"
+	"wdiet/units"
 
 	"github.com/google/uuid"
 )
 
 var ErrNotFound = fmt.Errorf("there's no shit about shit")
 
+var ErrRevoked = fmt.Errorf("token has already been revoked")
+
+var ErrConflict = fmt.Errorf("conflicts with what's already there")
+
+var ErrNotEnough = fmt.Errorf("there isn't enough of it in the fridge")
+
 type Store interface { //keeping a strict separation between the layers of your service is the biggest benefit of having store interface.
 	//So like, your methods of your service shouldn't know anything about your database,
 	//they shouldn't rely on a database implementation. Nothing in your service should be dependent on your implementation details.
@@ -19,6 +27,14 @@ type Store interface { //keeping a strict separation between the layers of your
 	GetUserByEmail(ctx context.Context, email string) (*User, error)
 	CreateUser(ctx context.Context, u User) (*User, error)
 	UpdateUser(ctx context.Context, u User) (*User, error)
+	SetUserActive(ctx context.Context, id uuid.UUID, active bool) (*User, error)
+	GetUserStatus(ctx context.Context, id uuid.UUID) (*UserStatus, error)
+	SetUserRole(ctx context.Context, id uuid.UUID, role string) (*User, error)
+	ChangePassword(ctx context.Context, id uuid.UUID, hashedPassword string) error
+	UpdatePasswordHash(ctx context.Context, id uuid.UUID, oldHash, newHash string) error
+	RequestUserDeletion(ctx context.Context, id uuid.UUID, deleteAfter time.Time) error
+	ListUsersDueForDeletion(ctx context.Context, now time.Time) ([]uuid.UUID, error)
+	DeleteUser(ctx context.Context, id uuid.UUID) error
 
 	GetIngredient(ctx context.Context, id uuid.UUID) (*Ingredient, error)
 	SearchIngredients(ctx context.Context, i SearchIngredient) ([]Ingredient, error)
@@ -26,10 +42,43 @@ type Store interface { //keeping a strict separation between the layers of your
 	UpdateIngredient(ctx context.Context, i Ingredient) (*Ingredient, error)
 	DeleteIngredient(ctx context.Context, id uuid.UUID) error
 
-	ListFridgeIngredients(ctx context.Context, i uuid.UUID) ([]FridgeIngredient, error)
+	CreateHousehold(ctx context.Context, h Household, owner uuid.UUID) (*Household, error)
+	GetHousehold(ctx context.Context, id uuid.UUID) (*Household, error)
+	ListHouseholds(ctx context.Context, uid uuid.UUID) ([]HouseholdMembership, error)
+	GetHouseholdMembership(ctx context.Context, hid, uid uuid.UUID) (*HouseholdMembership, error)
+	GetActiveHousehold(ctx context.Context, uid uuid.UUID) (*HouseholdMembership, error)
+	SetActiveHousehold(ctx context.Context, uid, hid uuid.UUID) error
+	// EnsureActiveHousehold is GetActiveHousehold for a user who might not have one. It switches them to the first
+	// household they're in, or makes them a new one called name if they're in none. Concurrent calls for the same user
+	// wait for each other, so they all end up in the same household.
+	EnsureActiveHousehold(ctx context.Context, uid uuid.UUID, name string) (*HouseholdMembership, error)
+	ListHouseholdMembers(ctx context.Context, hid uuid.UUID) ([]HouseholdMember, error)
+	SetHouseholdMemberRole(ctx context.Context, hid, uid uuid.UUID, role string) (*HouseholdMember, error)
+	RemoveHouseholdMember(ctx context.Context, hid, uid uuid.UUID) error
+	CreateHouseholdInvitation(ctx context.Context, i HouseholdInvitation) (*HouseholdInvitation, error)
+	AcceptHouseholdInvitation(ctx context.Context, hashedToken string, uid uuid.UUID, email string) (*HouseholdMembership, error)
+
+	// The fridge is a ledger of FridgeEvents, and the lots are what replaying it gets. Everything that changes a lot
+	// records an event for it in the same transaction.
+
+	ListFridgeIngredients(ctx context.Context, hid uuid.UUID) ([]FridgeIngredient, error)
+	GetFridgeIngredient(ctx context.Context, hid, fid uuid.UUID) (*FridgeIngredient, error)
 	CreateFridgeIngredient(ctx context.Context, f FridgeIngredient) (*FridgeIngredient, error)
+	// UpdateFridgeIngredient updates the lot f, f.UserUUID is who does it. Who put it there doesn't change.
 	UpdateFridgeIngredient(ctx context.Context, f FridgeIngredient) (*FridgeIngredient, error)
-	DeleteFridgeIngredient(ctx context.Context, uid uuid.UUID, fid uuid.UUID) error
+	// SetFridgeIngredientStorage only writes where f is kept, when it was opened and when it goes off. It's a move or an
+	// open event, done by uid. was is the lot f was worked out from, if it's been moved or opened since then it's
+	// ErrConflict and nothing changes.
+	SetFridgeIngredientStorage(ctx context.Context, was, f FridgeIngredient, uid uuid.UUID, eventType string) (*FridgeIngredient, error)
+	// DeleteFridgeIngredient deletes the lot e.FridgeItemUUID from e.HouseholdUUID's fridge, done by e.UserUUID for
+	// e.Reason.
+	DeleteFridgeIngredient(ctx context.Context, e FridgeEvent) error
+	// ListFridgeEvents lists hid's fridge events from from up to to, in the order they happened.
+	ListFridgeEvents(ctx context.Context, hid uuid.UUID, from, to time.Time) ([]FridgeEvent, error)
+	// ListUserFridgeEvents lists the fridge events uid did in any household, in the order they happened.
+	ListUserFridgeEvents(ctx context.Context, uid uuid.UUID) ([]FridgeEvent, error)
+	// ConsumeFridgeIngredient is uid consuming some of iid, see the postgres one.
+	ConsumeFridgeIngredient(ctx context.Context, hid, iid, uid uuid.UUID, amount units.Amount, unit string) ([]FridgeIngredient, error)
 
 	GetRecipe(ctx context.Context, id uuid.UUID) (*Recipe, error)
 	ListRecipes(ctx context.Context, id uuid.UUID) ([]Recipe, error)
@@ -37,4 +86,60 @@ type Store interface { //keeping a strict separation between the layers of your
 	CreateRecipe(ctx context.Context, r Recipe) (*Recipe, error)
 	UpdateRecipe(ctx context.Context, r Recipe) (*Recipe, error)
 	DeleteRecipe(ctx context.Context, id uuid.UUID) error
+
+	// SuggestRecipes lists the best q.Limit recipes for what the household's fridge has, best first, and leaves out
+	// the ones it covers none of.
+	SuggestRecipes(ctx context.Context, hid uuid.UUID, q SuggestionQuery) ([]RecipeSuggestion, error)
+
+	CookRecipe(ctx context.Context, l CookLog, deductions []FridgeDeduction) (*CookLog, error)
+	ListCookLogs(ctx context.Context, uid uuid.UUID) ([]CookLog, error)
+
+	GetDigestSettings(ctx context.Context, uid uuid.UUID) (*DigestSettings, error)
+	SetDigestSettings(ctx context.Context, d DigestSettings) (*DigestSettings, error)
+	// ListEnabledDigestSettings lists the settings of the active users who want a digest.
+	ListEnabledDigestSettings(ctx context.Context) ([]DigestSettings, error)
+	// ClaimDigest marks uid's digest for day as sent. false if it already was, then somebody else is sending it.
+	ClaimDigest(ctx context.Context, uid uuid.UUID, day time.Time) (bool, error)
+
+	GetRefreshToken(ctx context.Context, hashedToken string) (*RefreshToken, error)
+	ListRefreshTokens(ctx context.Context, uid uuid.UUID) ([]RefreshToken, error)
+	CreateRefreshToken(ctx context.Context, t RefreshToken) (*RefreshToken, error)
+	RotateRefreshToken(ctx context.Context, id uuid.UUID, next RefreshToken) (*RefreshToken, error)
+	RevokeRefreshTokenFamily(ctx context.Context, familyID uuid.UUID) error
+	RevokeAccessToken(ctx context.Context, jti uuid.UUID, expiresAt time.Time) error
+	IsAccessTokenRevoked(ctx context.Context, jti uuid.UUID) (bool, error)
+
+	CreatePersonalAccessToken(ctx context.Context, t PersonalAccessToken) (*PersonalAccessToken, error)
+	ListPersonalAccessTokens(ctx context.Context, uid uuid.UUID) ([]PersonalAccessToken, error)
+	DeletePersonalAccessToken(ctx context.Context, uid, tid uuid.UUID) error
+	UsePersonalAccessToken(ctx context.Context, hashedToken string) (*PersonalAccessToken, error)
+
+	GetTOTP(ctx context.Context, uid uuid.UUID) (*TOTP, error)
+	StartTOTPEnrolment(ctx context.Context, t TOTP, hashedRecoveryCodes []string) (*TOTP, error)
+	EnableTOTP(ctx context.Context, uid uuid.UUID, step int64) error
+	DisableTOTP(ctx context.Context, uid uuid.UUID) error
+	UseTOTPStep(ctx context.Context, uid uuid.UUID, step int64) (bool, error)
+	UseRecoveryCode(ctx context.Context, uid uuid.UUID, hashedCode string) error
+
+	CreateLoginChallenge(ctx context.Context, c LoginChallenge) (*LoginChallenge, error)
+	AttemptLoginChallenge(ctx context.Context, hashedToken string) (*LoginChallenge, error)
+	UseLoginChallenge(ctx context.Context, id uuid.UUID) error
+
+	UseUserIdentity(ctx context.Context, provider, subject string) (*UserIdentity, error)
+	ListUserIdentities(ctx context.Context, uid uuid.UUID) ([]UserIdentity, error)
+	CreateUserIdentity(ctx context.Context, i UserIdentity) (*UserIdentity, error)
+	CreateUserWithIdentity(ctx context.Context, u User, i UserIdentity) (*User, error)
+	CreateOIDCState(ctx context.Context, st OIDCState) (*OIDCState, error)
+	UseOIDCState(ctx context.Context, hashedState string) (*OIDCState, error)
+
+	CreatePasswordResetToken(ctx context.Context, t PasswordResetToken) (*PasswordResetToken, error)
+	// GetPasswordResetUser gets the user an unused, unexpired reset token is for, without using it up.
+	GetPasswordResetUser(ctx context.Context, hashedToken string) (*User, error)
+	ResetPassword(ctx context.Context, hashedToken string, hashedPassword string) error
+
+	CreateEmailVerificationToken(ctx context.Context, t EmailVerificationToken) (*EmailVerificationToken, error)
+	VerifyEmail(ctx context.Context, hashedToken string) (*User, error)
+
+	CreateLockoutEvent(ctx context.Context, e LockoutEvent) (*LockoutEvent, error)
+	ListLockoutEvents(ctx context.Context, limit int) ([]LockoutEvent, error)
 }
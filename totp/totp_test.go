@@ -0,0 +1,87 @@
+package totp
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// the SHA1 vectors from RFC 6238 appendix B, 8 digits.
+func TestHOTPVectors(t *testing.T) {
+	key := []byte("12345678901234567890")
+
+	testcases := []struct {
+		unix     int64
+		expected string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	}
+
+	for _, testcase := range testcases {
+		assert.Equal(t, testcase.expected, hotp(key, uint64(Step(time.Unix(testcase.unix, 0))), 8), "time: %d", testcase.unix)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+	now := time.Unix(1111111109, 0) //step 37037036
+
+	code, err := Code(secret, now)
+	assert.NoError(t, err)
+	assert.Equal(t, "081804", code)
+
+	testcases := []struct {
+		name         string
+		code         string
+		at           time.Time
+		expectedStep int64
+		expectedOK   bool
+	}{
+		{"happyPath", "081804", now, 37037036, true},
+		{"happyPath:spaces", "081 804", now, 37037036, true},
+		{"happyPath:previousStep", "081804", now.Add(Period), 37037036, true},
+		{"happyPath:nextStep", "081804", now.Add(-Period), 37037036, true},
+		{"tooOld", "081804", now.Add(2 * Period), 0, false},
+		{"wrongCode", "123456", now, 0, false},
+		{"wrongLength", "81804", now, 0, false},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			step, ok := Verify(secret, testcase.code, testcase.at, 1)
+			assert.Equal(t, testcase.expectedOK, ok)
+			assert.Equal(t, testcase.expectedStep, step)
+		})
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	secret, err := GenerateSecret()
+	assert.NoError(t, err)
+	assert.Len(t, secret, 32)
+
+	_, err = Code(secret, time.Now())
+	assert.NoError(t, err)
+
+	other, err := GenerateSecret()
+	assert.NoError(t, err)
+	assert.NotEqual(t, secret, other)
+}
+
+func TestURI(t *testing.T) {
+	uri := URI("wdiet", "jywoo92324@gmail.com", "JBSWY3DPEHPK3PXP")
+
+	assert.True(t, strings.HasPrefix(uri, "otpauth://totp/wdiet:jywoo92324@gmail.com?"), uri)
+	assert.Contains(t, uri, "secret=JBSWY3DPEHPK3PXP")
+	assert.Contains(t, uri, "issuer=wdiet")
+	assert.Contains(t, uri, "digits=6")
+	assert.Contains(t, uri, "period=30")
+}
@@ -0,0 +1,238 @@
+package units
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Scale is how many decimals an Amount keeps. It's what the numeric(14, 4) amount columns keep too.
+const Scale = 4
+
+const (
+	one          = 10000 //1 in Amount.n
+	maxFraction  = 16    //kitchen fractions go down to sixteenths
+	maxAmountLen = 64
+)
+
+var maxAmount = big.NewRat(10000000000, 1) //numeric(14, 4) has 10 digits before the point
+
+var ErrInvalidAmount = errors.New("invalid amount")
+
+// Amount is an exact decimal amount with Scale decimals, 0.5 or 1.25 or 3. Fractions like 1/3 that don't end after
+// Scale decimals are rounded to the nearest one, which is still close enough to show them as 1/3 again.
+//
+// In JSON it's a number, or a string with a decimal, a fraction or a whole number and a fraction: "0.5", "1/3",
+// "1 1/2". It goes out as a number, or as a fraction string when it's been through AsFraction.
+type Amount struct {
+	n        int64 //in 1/10000ths
+	fraction bool  //MarshalJSON writes it as a fraction
+}
+
+// Whole is the amount n.
+func Whole(n int64) Amount {
+	return Amount{n: n * one}
+}
+
+// NewAmount rounds r to Scale decimals, halves away from zero.
+func NewAmount(r *big.Rat) Amount {
+	scaled := new(big.Rat).Mul(r, big.NewRat(one, 1))
+
+	n := new(big.Int).Quo(scaled.Num(), scaled.Denom()) //towards zero
+	rem := new(big.Rat).Sub(scaled, new(big.Rat).SetInt(n))
+	if rem.Abs(rem).Cmp(big.NewRat(1, 2)) >= 0 {
+		n.Add(n, big.NewInt(int64(scaled.Sign())))
+	}
+
+	return Amount{n: n.Int64()}
+}
+
+// ParseAmount parses "2", "0.5", "1/3" or "1 1/2".
+func ParseAmount(s string) (Amount, error) {
+	s = strings.TrimSpace(s)
+	if s == "" || len(s) > maxAmountLen {
+		return Amount{}, fmt.Errorf("%w %q", ErrInvalidAmount, s)
+	}
+
+	fields := strings.Fields(s)
+
+	var r *big.Rat
+	ok := false
+
+	switch len(fields) {
+	case 1:
+		r, ok = parseRat(fields[0])
+	case 2: //a whole number and a fraction
+		w, err := strconv.ParseInt(fields[0], 10, 64)
+		if r, ok = parseRat(fields[1]); ok && err == nil && w >= 0 && strings.Contains(fields[1], "/") && r.Sign() >= 0 {
+			r.Add(r, big.NewRat(w, 1))
+		} else {
+			ok = false
+		}
+	}
+
+	if !ok || new(big.Rat).Abs(r).Cmp(maxAmount) >= 0 {
+		return Amount{}, fmt.Errorf("%w %q", ErrInvalidAmount, s)
+	}
+
+	return NewAmount(r), nil
+}
+
+// MustParseAmount is ParseAmount for amounts that are written in the code, it panics if s isn't one.
+func MustParseAmount(s string) Amount {
+	a, err := ParseAmount(s)
+	if err != nil {
+		panic(err)
+	}
+	return a
+}
+
+// parseRat is big.Rat's SetString without the exponents, "1e9999999" would take forever.
+func parseRat(s string) (*big.Rat, bool) {
+	if strings.ContainsAny(s, "eE") {
+		return nil, false
+	}
+	return new(big.Rat).SetString(s)
+}
+
+// Rat is the amount as a big.Rat, for arithmetic.
+func (a Amount) Rat() *big.Rat {
+	return big.NewRat(a.n, one)
+}
+
+func (a Amount) Sign() int {
+	switch {
+	case a.n < 0:
+		return -1
+	case a.n > 0:
+		return 1
+	}
+	return 0
+}
+
+// Cmp compares a and b like big.Rat's Cmp.
+func (a Amount) Cmp(b Amount) int {
+	return Amount{n: a.n - b.n}.Sign()
+}
+
+// AsFraction is a, to be written as a fraction when it goes to JSON.
+func (a Amount) AsFraction() Amount {
+	a.fraction = true
+	return a
+}
+
+// String writes a as a decimal without trailing zeros, "1.5".
+func (a Amount) String() string {
+	s := a.Rat().FloatString(Scale)
+	if strings.Contains(s, ".") {
+		s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	}
+	return s
+}
+
+// Fraction writes a as a whole number and a fraction, "1 1/2", "1/3" or "2". The fraction is the kitchen fraction
+// (halves up to sixteenths) a was rounded from if there's one, otherwise the exact one.
+func (a Amount) Fraction() string {
+	sign := ""
+	n := a.n
+	if n < 0 {
+		sign, n = "-", -n
+	}
+
+	whole, rest := n/one, n%one
+
+	var frac string
+	if rest != 0 {
+		frac = new(big.Rat).SetFrac64(rest, one).RatString()
+		for d := int64(2); d <= maxFraction; d++ {
+			num := (rest*d + one/2) / one                              //closest sixteenth, eighth, ...
+			if num > 0 && num < d && 2*absInt64(num*one-rest*d) <= d { //rounding num/d to Scale decimals gives rest
+				frac = new(big.Rat).SetFrac64(num, d).RatString()
+				break
+			}
+		}
+	}
+
+	switch {
+	case frac == "":
+		return sign + strconv.FormatInt(whole, 10)
+	case whole == 0:
+		return sign + frac
+	}
+	return sign + strconv.FormatInt(whole, 10) + " " + frac
+}
+
+func absInt64(n int64) int64 {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+func (a Amount) MarshalJSON() ([]byte, error) {
+	if a.fraction {
+		return json.Marshal(a.Fraction())
+	}
+	return []byte(a.String()), nil
+}
+
+func (a *Amount) UnmarshalJSON(b []byte) error {
+	if string(b) == "null" { //like every other type, null leaves it alone
+		return nil
+	}
+
+	var s string
+	if len(b) > 0 && b[0] == '"' {
+		if err := json.Unmarshal(b, &s); err != nil {
+			return err
+		}
+	} else {
+		var n json.Number
+		if err := json.Unmarshal(b, &n); err != nil {
+			return fmt.Errorf("%w: %s", ErrInvalidAmount, b)
+		}
+		s = n.String()
+	}
+
+	parsed, err := ParseAmount(s)
+	if err != nil {
+		return err
+	}
+
+	*a = parsed
+	return nil
+}
+
+// Value stores a as the decimal it is, for a numeric column.
+func (a Amount) Value() (driver.Value, error) {
+	return a.String(), nil
+}
+
+// Scan reads a numeric column.
+func (a *Amount) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case []byte:
+		return a.scanString(string(v))
+	case string:
+		return a.scanString(v)
+	case int64:
+		*a = Whole(v)
+		return nil
+	}
+
+	return fmt.Errorf("%w: can't scan %T", ErrInvalidAmount, src)
+}
+
+func (a *Amount) scanString(s string) error {
+	parsed, err := ParseAmount(s)
+	if err != nil {
+		return err
+	}
+
+	*a = parsed
+	return nil
+}
@@ -0,0 +1,97 @@
+package units
+
+import (
+	"encoding/json"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseAmount(t *testing.T) {
+	testcases := []struct {
+		in       string
+		decimal  string
+		fraction string
+	}{
+		{"2", "2", "2"},
+		{"0.5", "0.5", "1/2"},
+		{".25", "0.25", "1/4"},
+		{"1/3", "0.3333", "1/3"},
+		{"2/3", "0.6667", "2/3"},
+		{"1 1/2", "1.5", "1 1/2"},
+		{" 2  3/4 ", "2.75", "2 3/4"},
+		{"1/16", "0.0625", "1/16"},
+		{"5/6", "0.8333", "5/6"},
+		{"0.1", "0.1", "1/10"},
+		{"0.1234", "0.1234", "617/5000"},
+		{"0.33333", "0.3333", "1/3"},
+		{"3/2", "1.5", "1 1/2"},
+		{"-1.5", "-1.5", "-1 1/2"},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.in, func(t *testing.T) {
+			a, err := ParseAmount(testcase.in)
+			assert.NoError(t, err)
+			assert.Equal(t, testcase.decimal, a.String())
+			assert.Equal(t, testcase.fraction, a.Fraction())
+		})
+	}
+
+	for _, in := range []string{"", "a", "1 1.5", "1/0", "1 2", "-1 1/2", "1 -1/2", "1e3", "1 1/2 1/2", "10000000000"} {
+		_, err := ParseAmount(in)
+		assert.True(t, errors.Is(err, ErrInvalidAmount), "in: %q", in)
+	}
+}
+
+func TestNewAmount(t *testing.T) {
+	assert.Equal(t, Whole(3), NewAmount(big.NewRat(3, 1)))
+	assert.Equal(t, "0.0001", NewAmount(big.NewRat(1, 20000)).String()) //half rounds up
+	assert.Equal(t, "0", NewAmount(big.NewRat(1, 20001)).String())
+	assert.Equal(t, "-0.0001", NewAmount(big.NewRat(-1, 20000)).String())
+	assert.Equal(t, 0, NewAmount(big.NewRat(1, 3)).Cmp(NewAmount(big.NewRat(3333, 10000))))
+}
+
+func TestAmountJSON(t *testing.T) {
+	var in struct {
+		A Amount `json:"a"`
+		B Amount `json:"b"`
+		C Amount `json:"c"`
+	}
+
+	err := json.Unmarshal([]byte(`{"a": 1.5, "b": "1 1/2", "c": "1/3"}`), &in)
+	assert.NoError(t, err)
+	assert.Equal(t, in.A, in.B)
+
+	out, err := json.Marshal(in)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"a":1.5,"b":1.5,"c":0.3333}`, string(out))
+
+	in.A, in.B, in.C = in.A.AsFraction(), in.B.AsFraction(), in.C.AsFraction()
+
+	out, err = json.Marshal(in)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"a":"1 1/2","b":"1 1/2","c":"1/3"}`, string(out))
+
+	for _, bad := range []string{`{"a": "lots"}`, `{"a": true}`, `{"a": 1e3}`} {
+		assert.Error(t, json.Unmarshal([]byte(bad), &in), "json: %s", bad)
+	}
+}
+
+func TestAmountScan(t *testing.T) {
+	var a Amount
+
+	assert.NoError(t, a.Scan([]byte("1.5000")))
+	assert.Equal(t, "1.5", a.String())
+
+	assert.NoError(t, a.Scan(int64(3)))
+	assert.Equal(t, Whole(3), a)
+
+	assert.Error(t, a.Scan(1.5))
+
+	v, err := NewAmount(big.NewRat(1, 3)).Value()
+	assert.NoError(t, err)
+	assert.Equal(t, "0.3333", v)
+}
@@ -0,0 +1,179 @@
+// Package units knows the units amounts in the fridge and in recipes come in: what they're called, what they measure
+// and how to convert between them. Amounts are big.Rat so converting back and forth doesn't lose anything.
+package units
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+var (
+	ErrUnknownUnit  = errors.New("unknown unit")
+	ErrIncompatible = errors.New("incompatible units") //e.g. pieces to grams, or grams to ml without a density
+)
+
+// Kind is what a unit measures. Units of the same kind always convert, mass and volume convert with a density.
+type Kind string
+
+const (
+	Mass   Kind = "mass"   //base unit g
+	Volume Kind = "volume" //base unit ml
+	Count  Kind = "count"  //base unit pc
+)
+
+// Unit is one unit of the registry. Symbol is its canonical name, the one we store.
+type Unit struct {
+	Symbol string
+	Kind   Kind
+	base   *big.Rat //how many of the base unit of Kind one of this is
+}
+
+func (u Unit) String() string {
+	return u.Symbol
+}
+
+// Factor is how many of the base unit of its kind one u is, e.g. 1000 for kg. It's a copy, changing it does nothing.
+func (u Unit) Factor() *big.Rat {
+	return new(big.Rat).Set(u.base)
+}
+
+// registry is every unit we know with the other names people write it as. Aliases are matched lowercase, with dots
+// dropped and spaces squashed, so "Tbsp." and "fl. oz" work too. US customary for the kitchen units.
+var registry = []struct {
+	symbol  string
+	kind    Kind
+	base    string
+	aliases []string
+}{
+	{"mg", Mass, "1/1000", []string{"milligram", "milligrams", "milligramme", "milligrammes"}},
+	{"g", Mass, "1", []string{"gr", "gm", "gms", "gram", "grams", "gramme", "grammes"}},
+	{"kg", Mass, "1000", []string{"kgs", "kilo", "kilos", "kilogram", "kilograms", "kilogramme", "kilogrammes"}},
+	{"oz", Mass, "28.349523125", []string{"ounce", "ounces"}},
+	{"lb", Mass, "453.59237", []string{"lbs", "pound", "pounds"}},
+
+	{"ml", Volume, "1", []string{"milliliter", "milliliters", "millilitre", "millilitres", "cc"}},
+	{"cl", Volume, "10", []string{"centiliter", "centiliters", "centilitre", "centilitres"}},
+	{"dl", Volume, "100", []string{"deciliter", "deciliters", "decilitre", "decilitres"}},
+	{"l", Volume, "1000", []string{"ltr", "liter", "liters", "litre", "litres"}},
+	{"tsp", Volume, "4.92892159375", []string{"tsps", "teaspoon", "teaspoons"}},
+	{"tbsp", Volume, "14.78676478125", []string{"tbsps", "tbs", "tbl", "tablespoon", "tablespoons"}},
+	{"fl oz", Volume, "29.5735295625", []string{"floz", "fluid ounce", "fluid ounces"}},
+	{"cup", Volume, "236.5882365", []string{"cups", "c"}},
+	{"pt", Volume, "473.176473", []string{"pint", "pints"}},
+	{"qt", Volume, "946.352946", []string{"quart", "quarts"}},
+	{"gal", Volume, "3785.411784", []string{"gallon", "gallons"}},
+
+	{"pc", Count, "1", []string{"pcs", "piece", "pieces", "ea", "each", "unit", "units", "whole"}},
+	{"dozen", Count, "12", []string{"doz", "dozens"}},
+}
+
+var (
+	units   = map[string]Unit{} //by symbol and by every alias
+	symbols []string            //in registry order
+	bases   = map[Kind]Unit{}
+)
+
+func init() {
+	for _, r := range registry {
+		base, ok := new(big.Rat).SetString(r.base)
+		if !ok {
+			panic(fmt.Sprintf("units: bad base %q for %s", r.base, r.symbol))
+		}
+
+		u := Unit{Symbol: r.symbol, Kind: r.kind, base: base}
+
+		for _, name := range append([]string{r.symbol}, r.aliases...) {
+			if _, ok := units[name]; ok {
+				panic(fmt.Sprintf("units: %q is registered twice", name))
+			}
+			units[name] = u
+		}
+		symbols = append(symbols, r.symbol)
+
+		if base.Cmp(big.NewRat(1, 1)) == 0 {
+			bases[r.kind] = u
+		}
+	}
+}
+
+// Parse finds the unit s names, by its symbol or any of its aliases.
+func Parse(s string) (Unit, error) {
+	name := strings.Join(strings.Fields(strings.ToLower(strings.ReplaceAll(s, ".", ""))), " ")
+
+	u, ok := units[name]
+	if !ok {
+		return Unit{}, fmt.Errorf("%w %q", ErrUnknownUnit, s)
+	}
+
+	return u, nil
+}
+
+// IsKnown tells if Parse knows s.
+func IsKnown(s string) bool {
+	_, err := Parse(s)
+	return err == nil
+}
+
+// Canonical is the symbol of the unit s names, or s as it is if we don't know it.
+func Canonical(s string) string {
+	if u, err := Parse(s); err == nil {
+		return u.Symbol
+	}
+	return s
+}
+
+// Symbols lists the symbols of every unit we know.
+func Symbols() []string {
+	return append([]string(nil), symbols...)
+}
+
+// Base is the unit everything of kind k converts through: g, ml or pc.
+func Base(k Kind) Unit {
+	return bases[k]
+}
+
+// Convert converts amount from one unit to another. density is in g per ml and only used between mass and volume,
+// 0 means we don't know it and those conversions fail with ErrIncompatible.
+func Convert(amount *big.Rat, from, to Unit, density float64) (*big.Rat, error) {
+	out := new(big.Rat).Mul(amount, from.base) //in the base unit of from
+
+	if from.Kind != to.Kind {
+		d := new(big.Rat)
+		if density <= 0 || d.SetFloat64(density) == nil {
+			return nil, fmt.Errorf("%w: %s to %s", ErrIncompatible, from, to)
+		}
+
+		switch {
+		case from.Kind == Volume && to.Kind == Mass: //ml * g/ml = g
+			out.Mul(out, d)
+		case from.Kind == Mass && to.Kind == Volume: //g / (g/ml) = ml
+			out.Quo(out, d)
+		default:
+			return nil, fmt.Errorf("%w: %s to %s", ErrIncompatible, from, to)
+		}
+	}
+
+	return out.Quo(out, to.base), nil
+}
+
+// ConvertNamed is Convert for units by name. Two names that are the same always convert, even when we don't know
+// them, so amounts saved before there was a registry still go with each other.
+func ConvertNamed(amount *big.Rat, from, to string, density float64) (*big.Rat, error) {
+	if from == to {
+		return new(big.Rat).Set(amount), nil
+	}
+
+	f, err := Parse(from)
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := Parse(to)
+	if err != nil {
+		return nil, err
+	}
+
+	return Convert(amount, f, t, density)
+}
@@ -0,0 +1,123 @@
+package units
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	testcases := []struct {
+		name     string
+		expected string
+		kind     Kind
+	}{
+		{"g", "g", Mass},
+		{"gram", "g", Mass},
+		{"Grams", "g", Mass},
+		{" KG ", "kg", Mass},
+		{"lbs", "lb", Mass},
+		{"L", "l", Volume},
+		{"millilitres", "ml", Volume},
+		{"Tbsp.", "tbsp", Volume},
+		{"teaspoons", "tsp", Volume},
+		{"fl. oz", "fl oz", Volume},
+		{"fluid  ounces", "fl oz", Volume},
+		{"cups", "cup", Volume},
+		{"pieces", "pc", Count},
+		{"doz", "dozen", Count},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			u, err := Parse(testcase.name)
+			assert.NoError(t, err)
+			assert.Equal(t, testcase.expected, u.Symbol)
+			assert.Equal(t, testcase.kind, u.Kind)
+		})
+	}
+
+	for _, name := range []string{"", "handful", "gramz", "kg/l"} {
+		_, err := Parse(name)
+		assert.True(t, errors.Is(err, ErrUnknownUnit), "name: %q", name)
+	}
+}
+
+func TestSymbolsParse(t *testing.T) {
+	for _, symbol := range Symbols() {
+		u, err := Parse(symbol)
+		assert.NoError(t, err)
+		assert.Equal(t, symbol, u.Symbol)
+	}
+}
+
+func TestFactor(t *testing.T) {
+	kg, err := Parse("kg")
+	assert.NoError(t, err)
+	assert.Equal(t, big.NewRat(1000, 1), kg.Factor())
+
+	kg.Factor().SetInt64(1) //a copy, the registry keeps its own
+	assert.Equal(t, big.NewRat(1000, 1), kg.Factor())
+	assert.Equal(t, big.NewRat(1, 1), Base(Mass).Factor())
+}
+
+func TestConvert(t *testing.T) {
+	testcases := []struct {
+		name     string
+		amount   string
+		from     string
+		to       string
+		density  float64
+		expected string
+		err      error
+	}{
+		{"kgToG", "3/2", "kg", "g", 0, "1500", nil},
+		{"gToKg", "250", "g", "kg", 0, "1/4", nil},
+		{"lbToKg", "1", "lb", "kg", 0, "45359237/100000000", nil},
+		{"cupToTbsp", "1", "cup", "tbsp", 0, "16", nil},
+		{"tbspToTsp", "1", "tbsp", "tsp", 0, "3", nil},
+		{"gallonToCups", "1", "gal", "cup", 0, "16", nil},
+		{"dozenToPieces", "2", "dozen", "pc", 0, "24", nil},
+		{"waterLToKg", "2", "l", "kg", 1, "2", nil},
+		{"flourCupToG", "1", "cup", "g", 0.5, "4731764730/40000000", nil}, //118.29 g
+		{"flourGToCup", "4731764730/40000000", "g", "cup", 0.5, "1", nil},
+		{"noDensity", "1", "cup", "g", 0, "", ErrIncompatible},
+		{"countToMass", "1", "pc", "g", 1, "", ErrIncompatible},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			amount, _ := new(big.Rat).SetString(testcase.amount)
+
+			from, err := Parse(testcase.from)
+			assert.NoError(t, err)
+			to, err := Parse(testcase.to)
+			assert.NoError(t, err)
+
+			converted, err := Convert(amount, from, to, testcase.density)
+			if testcase.err != nil {
+				assert.True(t, errors.Is(err, testcase.err))
+				return
+			}
+
+			assert.NoError(t, err)
+			expected, _ := new(big.Rat).SetString(testcase.expected)
+			assert.Equal(t, expected.String(), converted.String())
+		})
+	}
+}
+
+func TestConvertNamed(t *testing.T) {
+	converted, err := ConvertNamed(big.NewRat(2, 1), "grams", "kg", 0)
+	assert.NoError(t, err)
+	assert.Equal(t, "1/500", converted.String())
+
+	converted, err = ConvertNamed(big.NewRat(2, 1), "bunch", "bunch", 0) //not ours, but it's the same thing
+	assert.NoError(t, err)
+	assert.Equal(t, "2/1", converted.String())
+
+	_, err = ConvertNamed(big.NewRat(2, 1), "bunch", "g", 0)
+	assert.True(t, errors.Is(err, ErrUnknownUnit))
+}